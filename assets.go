@@ -0,0 +1,11 @@
+// Package badges embeds the HTML and SVG templates and the static files of
+// the service, so that the binary runs from any working directory. They are
+// served through internal/assets, which also applies on-disk overrides.
+package badges
+
+import "embed"
+
+// Files holds the templates and static directories
+//
+//go:embed templates static
+var Files embed.FS
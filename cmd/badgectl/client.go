@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client talks to the badge service HTTP API using an API key
+type client struct {
+	server string
+	apiKey string
+	http   *http.Client
+}
+
+func newClient(server, apiKey string) *client {
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		apiKey: apiKey,
+		http:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// do sends a request with an optional JSON body and returns the response body.
+// Non-2xx responses are turned into errors carrying the server's message.
+func (c *client) do(method, path string, body interface{}) ([]byte, error) {
+	if body == nil {
+		return c.send(method, path, "", nil)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return c.send(method, path, "application/json", bytes.NewReader(data))
+}
+
+// upload posts content as the file field of a multipart form
+func (c *client) upload(path, field, filename string, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	part.Write(content)
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return c.send(http.MethodPost, path, mw.FormDataContentType(), &buf)
+}
+
+// send sends a request with a body of the given content type
+func (c *client) send(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s (%d)", method, path, apiErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+
+	return data, nil
+}
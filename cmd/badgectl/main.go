@@ -0,0 +1,732 @@
+// Command badgectl administers a badge service over its HTTP API so operators can
+// script issuance without the web UI.
+//
+// Usage:
+//
+//	badgectl [--server URL] [--api-key KEY] <group> <command> [flags] [args]
+//
+// The server and API key default to the BADGECTL_SERVER and BADGECTL_API_KEY
+// environment variables. Every command goes through the API, so badgectl never
+// needs access to the database itself. Run "badgectl help" for the command list
+// and "badgectl <group> <command> --help" for the flags of a command.
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/groupapi"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "badgectl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newRootCommand returns the badgectl command with every group of commands.
+// The client is set up from the global flags before a command runs.
+func newRootCommand() *cobra.Command {
+	c := &client{}
+	var server, apiKey string
+
+	root := &cobra.Command{
+		Use:           "badgectl",
+		Short:         "Administer a badge service over its HTTP API",
+		Long:          "badgectl administers a badge service over its HTTP API, so issuance can be scripted\nwithout the web UI. Passwords not given with --password are read from standard input.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			*c = *newClient(server, apiKey)
+		},
+	}
+	root.PersistentFlags().StringVar(&server, "server", envOr("BADGECTL_SERVER", "http://localhost"), "base URL of the badge service")
+	root.PersistentFlags().StringVar(&apiKey, "api-key", os.Getenv("BADGECTL_API_KEY"), "API key sent as X-API-Key")
+
+	root.AddCommand(
+		group("badge", "Manage badges and their review",
+			badgeList(c), badgeGet(c), badgeCreate(c), badgeUpdate(c), badgeDelete(c), badgeReview(c),
+			badgeHistory(c), badgeComments(c), badgeComment(c), badgeAttachments(c), badgeAttach(c),
+			badgeSBOM(c), badgeRender(c)),
+		group("user", "Manage users", userCreate(c), userResetPassword(c)),
+		group("group", "Manage issuer groups", groupList(c), groupCreate(c), groupUpdate(c), groupDelete(c)),
+		group("apikey", "Manage API keys", apiKeyCreate(c), apiKeyRotate(c), apiKeyRevoke(c)),
+		group("db", "Maintain the database", dbMigrate(c), dbBackup(c)),
+		group("snapshot", "Export a static copy of the public site", snapshotExport(c)),
+	)
+	return root
+}
+
+// group returns a command grouping the given commands
+func group(name, short string, commands ...*cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{Use: name, Short: short}
+	cmd.AddCommand(commands...)
+	return cmd
+}
+
+// badgeFields registers a flag for every editable badge field
+type badgeFields struct {
+	fs     *pflag.FlagSet
+	values map[string]*string
+}
+
+// badgeFieldNames maps flag names to the JSON fields of badgeapi.Badge
+var badgeFieldNames = []string{
+	"type", "status", "issuer", "issue-date", "software-name", "software-version",
+	"software-url", "notes", "expiry-date", "issuer-url", "custom-config", "last-review",
+	"covered-version", "repository-link", "public-note", "internal-note", "contact-details", "publish-at",
+	"certificate-name", "specialty-domain", "software-sc-id", "software-sc-url",
+}
+
+func newBadgeFields(fs *pflag.FlagSet) *badgeFields {
+	bf := &badgeFields{fs: fs, values: make(map[string]*string)}
+	for _, name := range badgeFieldNames {
+		bf.values[name] = fs.String(name, "", "badge "+strings.ReplaceAll(name, "-", " "))
+	}
+	return bf
+}
+
+// badge builds a request containing only the flags that were set on the command line
+func (bf *badgeFields) badge(commitID string) (*badgeapi.Badge, error) {
+	fields := map[string]string{"commit_id": commitID}
+	bf.fs.Visit(func(f *pflag.Flag) {
+		if v, ok := bf.values[f.Name]; ok {
+			fields[strings.ReplaceAll(f.Name, "-", "_")] = *v
+		}
+	})
+
+	// Round-trip through JSON so the flag names stay in sync with the API field names
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var b badgeapi.Badge
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// getJSON returns a command printing the JSON response to a GET of the path
+// built from its arguments
+func getJSON(c *client, use, short string, args cobra.PositionalArgs, path func(args []string) string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodGet, path(args), nil)
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+}
+
+func badgeList(c *client) *cobra.Command {
+	return getJSON(c, "list", "List badges", cobra.NoArgs, func([]string) string {
+		return "/api/badges"
+	})
+}
+
+func badgeGet(c *client) *cobra.Command {
+	return getJSON(c, "get <commit_id>", "Show a badge", cobra.ExactArgs(1), func(args []string) string {
+		return "/api/badges/" + url.PathEscape(args[0])
+	})
+}
+
+func badgeCreate(c *client) *cobra.Command {
+	var commitID string
+	cmd := &cobra.Command{
+		Use:   "create --id <commit_id> [field flags]",
+		Short: "Create a badge",
+		Args:  cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&commitID, "id", "", "commit ID of the new badge (required)")
+	cmd.MarkFlagRequired("id")
+	fields := newBadgeFields(cmd.Flags())
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		req, err := fields.badge(commitID)
+		if err != nil {
+			return err
+		}
+		data, err := c.do(http.MethodPost, "/api/badges", req)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	}
+	return cmd
+}
+
+func badgeUpdate(c *client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update [field flags] <commit_id>",
+		Short: "Update the given fields of a badge",
+		Args:  cobra.ExactArgs(1),
+	}
+	fields := newBadgeFields(cmd.Flags())
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		req, err := fields.badge(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := c.do(http.MethodPatch, "/api/badges/"+url.PathEscape(args[0]), req)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	}
+	return cmd
+}
+
+func badgeDelete(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <commit_id>",
+		Short: "Delete a badge",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := c.do(http.MethodDelete, "/api/badges/"+url.PathEscape(args[0]), nil); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func badgeReview(c *client) *cobra.Command {
+	var action, comment string
+	cmd := &cobra.Command{
+		Use:   "review --action submit|approve|reject [--comment text] <commit_id>",
+		Short: "Submit, approve or reject a badge",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodPost, "/api/badges/"+url.PathEscape(args[0])+"/review", badgeapi.ReviewRequest{
+				Action:  action,
+				Comment: comment,
+			})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&action, "action", "", "submit, approve or reject (required)")
+	cmd.Flags().StringVar(&comment, "comment", "", "review comment (required to reject)")
+	cmd.MarkFlagRequired("action")
+	return cmd
+}
+
+func badgeHistory(c *client) *cobra.Command {
+	return getJSON(c, "history <commit_id>", "Show the review history of a badge", cobra.ExactArgs(1), func(args []string) string {
+		return "/api/badges/" + url.PathEscape(args[0]) + "/review"
+	})
+}
+
+func badgeComments(c *client) *cobra.Command {
+	return getJSON(c, "comments <commit_id>", "List the comments on a badge", cobra.ExactArgs(1), func(args []string) string {
+		return "/api/badges/" + url.PathEscape(args[0]) + "/comments"
+	})
+}
+
+func badgeComment(c *client) *cobra.Command {
+	var body string
+	cmd := &cobra.Command{
+		Use:   "comment --body text <commit_id>",
+		Short: "Comment on a badge",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodPost, "/api/badges/"+url.PathEscape(args[0])+"/comments", badgeapi.CommentRequest{Body: body})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&body, "body", "", "comment text (required)")
+	cmd.MarkFlagRequired("body")
+	return cmd
+}
+
+func badgeAttachments(c *client) *cobra.Command {
+	return getJSON(c, "attachments <commit_id>", "List the evidence attached to a badge", cobra.ExactArgs(1), func(args []string) string {
+		return "/api/badges/" + url.PathEscape(args[0]) + "/attachments"
+	})
+}
+
+func badgeAttach(c *client) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "attach --file path <commit_id>",
+		Short: "Attach an evidence document to a badge",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			data, err := c.upload("/api/badges/"+url.PathEscape(args[0])+"/attachments", "file", filepath.Base(file), content)
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", "evidence document to upload, e.g. a PDF scan or SBOM (required)")
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func badgeSBOM(c *client) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "sbom [--file path] <commit_id>",
+		Short: "Upload the SBOM of a badge, or show its summary",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/api/badges/" + url.PathEscape(args[0]) + "/sbom"
+
+			var data []byte
+			var err error
+			if file == "" {
+				data, err = c.do(http.MethodGet, path, nil)
+			} else {
+				var content []byte
+				if content, err = os.ReadFile(file); err != nil {
+					return fmt.Errorf("failed to read %s: %w", file, err)
+				}
+				data, err = c.send(http.MethodPost, path, "application/octet-stream", bytes.NewReader(content))
+			}
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", "CycloneDX or SPDX document to upload; shows the current SBOM summary if empty")
+	return cmd
+}
+
+func badgeRender(c *client) *cobra.Command {
+	var format, outlook, output string
+	cmd := &cobra.Command{
+		Use:   "render [--format svg|png|jpg] [--outlook badge|certificate] [-o file] <commit_id>",
+		Short: "Render a badge or certificate to a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			commitID := args[0]
+			if outlook != "badge" && outlook != "certificate" {
+				return fmt.Errorf("unknown outlook %q", outlook)
+			}
+
+			path := fmt.Sprintf("/%s/%s?format=%s", outlook, url.PathEscape(commitID), url.QueryEscape(format))
+			data, err := c.do(http.MethodGet, path, nil)
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				output = commitID + "." + format
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			fmt.Printf("wrote %s (%d bytes)\n", output, len(data))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "svg", "output format: svg, png or jpg")
+	cmd.Flags().StringVar(&outlook, "outlook", "badge", "outlook to render: badge or certificate")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default <commit_id>.<format>)")
+	return cmd
+}
+
+func userCreate(c *client) *cobra.Command {
+	var username, email, role, firstName, lastName, password string
+	cmd := &cobra.Command{
+		Use:   "create --username <name> --email <email> --role <role> [--first-name] [--last-name] [--password]",
+		Short: "Create a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := passwordOrStdin(password)
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodPost, "/api/users", map[string]string{
+				"username":   username,
+				"email":      email,
+				"password":   pw,
+				"first_name": firstName,
+				"last_name":  lastName,
+				"role":       role,
+			})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&username, "username", "", "username (required)")
+	cmd.Flags().StringVar(&email, "email", "", "email address (required)")
+	cmd.Flags().StringVar(&role, "role", "", "role name, e.g. admin (required)")
+	cmd.Flags().StringVar(&firstName, "first-name", "", "first name")
+	cmd.Flags().StringVar(&lastName, "last-name", "", "last name")
+	cmd.Flags().StringVar(&password, "password", "", "password (read from stdin if empty)")
+	for _, name := range []string{"username", "email", "role"} {
+		cmd.MarkFlagRequired(name)
+	}
+	return cmd
+}
+
+func userResetPassword(c *client) *cobra.Command {
+	var username, password string
+	cmd := &cobra.Command{
+		Use:   "reset-password --username <name> [--password]",
+		Short: "Set a new password for a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := passwordOrStdin(password)
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodPost, "/api/users/password", map[string]string{
+				"username": username,
+				"password": pw,
+			})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&username, "username", "", "username (required)")
+	cmd.Flags().StringVar(&password, "password", "", "new password (read from stdin if empty)")
+	cmd.MarkFlagRequired("username")
+	return cmd
+}
+
+func groupList(c *client) *cobra.Command {
+	return getJSON(c, "list", "List groups", cobra.NoArgs, func([]string) string {
+		return "/api/groups"
+	})
+}
+
+func groupCreate(c *client) *cobra.Command {
+	var id, name, members, badgeTypes string
+	cmd := &cobra.Command{
+		Use:   "create --id <group_id> --name <name> [--members user_id,...] [--badge-types type,...]",
+		Short: "Create a group",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodPost, "/api/groups", groupapi.Group{
+				GroupID:    id,
+				Name:       name,
+				Members:    splitList(members),
+				BadgeTypes: splitList(badgeTypes),
+			})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&id, "id", "", "group ID (required)")
+	cmd.Flags().StringVar(&name, "name", "", "group name (required)")
+	cmd.Flags().StringVar(&members, "members", "", "comma-separated list of member user IDs")
+	cmd.Flags().StringVar(&badgeTypes, "badge-types", "", "comma-separated list of badge types the group may issue")
+	cmd.MarkFlagRequired("id")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func groupUpdate(c *client) *cobra.Command {
+	var name, members, badgeTypes string
+	cmd := &cobra.Command{
+		Use:   "update [--name] [--members user_id,...] [--badge-types type,...] <group_id>",
+		Short: "Update the given fields of a group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Only send the flags that were set, so that --members "" empties the group
+			var req groupapi.UpdateRequest
+			cmd.Flags().Visit(func(f *pflag.Flag) {
+				switch f.Name {
+				case "name":
+					req.Name = &name
+				case "members":
+					list := splitList(members)
+					req.Members = &list
+				case "badge-types":
+					list := splitList(badgeTypes)
+					req.BadgeTypes = &list
+				}
+			})
+			if req.Members != nil && *req.Members == nil {
+				*req.Members = []string{}
+			}
+			if req.BadgeTypes != nil && *req.BadgeTypes == nil {
+				*req.BadgeTypes = []string{}
+			}
+
+			data, err := c.do(http.MethodPatch, "/api/groups/"+url.PathEscape(args[0]), req)
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "group name")
+	cmd.Flags().StringVar(&members, "members", "", "comma-separated list of member user IDs, replacing the current members")
+	cmd.Flags().StringVar(&badgeTypes, "badge-types", "", "comma-separated list of badge types, replacing the current ones")
+	return cmd
+}
+
+func groupDelete(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <group_id>",
+		Short: "Delete a group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := c.do(http.MethodDelete, "/api/groups/"+url.PathEscape(args[0]), nil); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func apiKeyCreate(c *client) *cobra.Command {
+	var name, expires, permissions, ipRestrictions string
+	cmd := &cobra.Command{
+		Use:   "create --name <name> --permissions badges:read,badges:write [--expires RFC3339]",
+		Short: "Create an API key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			perms := map[string]map[string]bool{}
+			for _, p := range splitList(permissions) {
+				resource, action, ok := strings.Cut(p, ":")
+				if !ok {
+					return fmt.Errorf("invalid permission %q, expected resource:action", p)
+				}
+				if perms[resource] == nil {
+					perms[resource] = map[string]bool{}
+				}
+				perms[resource][action] = true
+			}
+
+			data, err := c.do(http.MethodPost, "/api/keys", map[string]interface{}{
+				"name":            name,
+				"expires_at":      expires,
+				"ip_restrictions": splitList(ipRestrictions),
+				"permissions":     perms,
+			})
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "key name (required)")
+	cmd.Flags().StringVar(&expires, "expires", "", "expiry time in RFC3339 (default one year)")
+	cmd.Flags().StringVar(&permissions, "permissions", "badges:read", "comma-separated resource:action list")
+	cmd.Flags().StringVar(&ipRestrictions, "ip", "", "comma-separated list of allowed IPs or CIDRs")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func apiKeyRotate(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate <api_key_id>",
+		Short: "Replace the secret of an API key, keeping its settings",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodPost, "/api/keys/"+url.PathEscape(args[0])+"/rotate", nil)
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+}
+
+func apiKeyRevoke(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <api_key_id>",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := c.do(http.MethodDelete, "/api/keys?id="+url.QueryEscape(args[0]), nil); err != nil {
+				return err
+			}
+			fmt.Printf("revoked %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+// dbMigrate has the server apply any schema migrations its database is
+// missing, e.g. after the file was replaced with one from an older release
+func dbMigrate(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations to the server's database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodPost, "/api/admin/migrate", nil)
+			if err != nil {
+				return err
+			}
+			return printJSON(data)
+		},
+	}
+}
+
+func dbBackup(c *client) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "backup [-o file]",
+		Short: "Download a backup of the database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.do(http.MethodGet, "/api/backup", nil)
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			fmt.Printf("wrote %s (%d bytes)\n", output, len(data))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default stdout)")
+	return cmd
+}
+
+// snapshotExport downloads a static snapshot of the public site and unpacks it
+// into a directory, ready to be copied to a web server or bucket
+func snapshotExport(c *client) *cobra.Command {
+	var formats, output string
+	cmd := &cobra.Command{
+		Use:   "export [--formats png,...] [-o dir]",
+		Short: "Download and unpack a static snapshot of the public site",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Rendering every badge can take minutes
+			c.http.Timeout = 0
+			data, err := c.do(http.MethodGet, "/api/admin/export?formats="+url.QueryEscape(formats), nil)
+			if err != nil {
+				return err
+			}
+			files, err := unpackSnapshot(data, output)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("wrote %d files to %s\n", files, output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&formats, "formats", "", "raster formats exported besides SVG, or none (default png)")
+	cmd.Flags().StringVarP(&output, "output", "o", "snapshot", "output directory")
+	return cmd
+}
+
+// unpackSnapshot writes the files of a snapshot archive into a directory and
+// returns how many there were
+func unpackSnapshot(data []byte, output string) (int, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !filepath.IsLocal(name) {
+			return files, fmt.Errorf("invalid snapshot: unexpected entry %q", hdr.Name)
+		}
+		path := filepath.Join(output, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return files, err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return files, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return files, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		files++
+	}
+	return files, nil
+}
+
+// passwordOrStdin returns the given password or reads one line from standard input
+func passwordOrStdin(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// printJSON pretty-prints a JSON response body
+func printJSON(data []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -46,7 +46,7 @@ func main() {
 	fmt.Printf("  Type: %s\n", badge.Type)
 	fmt.Printf("  Status: %s\n", badge.Status)
 	fmt.Printf("  Issuer: %s\n", badge.Issuer)
-	fmt.Printf("  Issue Date: %s\n", badge.IssueDate)
+	fmt.Printf("  Issue Date: %s\n", database.FormatDate(badge.IssueDate))
 	fmt.Printf("  Software: %s %s\n", badge.SoftwareName, badge.SoftwareVersion)
 	
 	if badge.Notes.Valid {
@@ -54,7 +54,7 @@ func main() {
 	}
 	
 	if badge.ExpiryDate.Valid {
-		fmt.Printf("  Expiry Date: %s\n", badge.ExpiryDate.String)
+		fmt.Printf("  Expiry Date: %s\n", database.FormatNullDate(badge.ExpiryDate))
 	}
 	
 	if badge.IssuerURL.Valid {
@@ -0,0 +1,401 @@
+// Command loadtest requests badge and certificate images concurrently and
+// reports latency percentiles, so performance regressions in rendering and
+// caching show up before a deploy.
+//
+// By default it serves the requests in-process from a database, through the
+// badge and certificate handlers and the image cache, without the network or
+// the server's rate limiter:
+//
+//	loadtest -db ./db/badges.db -formats svg,png -c 16 -n 5000
+//	loadtest -db ./db/badges.db -cache=false -duration 30s
+//
+// With -url it loads a running instance instead. Bypassing its cache needs a
+// session token, and its rate limiter answers 429 beyond 100 requests per
+// minute and connection, which are counted as errors:
+//
+//	loadtest -url http://localhost:9000 -ids abc1234,def5678 -token $TOKEN -cache=false
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	baseURL := flag.String("url", "", "base URL of a running instance (default: serve in-process from -db)")
+	dbPath := flag.String("db", envOr("DB_PATH", "./db/badges.db"), "path to the SQLite database (without -url)")
+	ids := flag.String("ids", "", "comma-separated commit IDs to request (default: every badge in -db; required with -url)")
+	outlooks := flag.String("outlooks", "badge,certificate", "comma-separated outlooks to request: badge, certificate")
+	formats := flag.String("formats", "svg", "comma-separated formats to request: svg, png, jpg, webp, avif")
+	concurrency := flag.Int("c", 8, "number of concurrent workers")
+	total := flag.Int("n", 1000, "number of requests (ignored with -duration)")
+	duration := flag.Duration("duration", 0, "keep requesting for this long instead of -n requests")
+	useCache := flag.Bool("cache", true, "serve repeated requests from the image cache; false renders every request")
+	token := flag.String("token", os.Getenv("BADGES_TOKEN"), "bearer token of a session (with -url and -cache=false)")
+	flag.Parse()
+
+	if *concurrency < 1 {
+		return fmt.Errorf("-c must be at least 1")
+	}
+	if *duration <= 0 && *total < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+
+	var t target
+	var err error
+	if *baseURL != "" {
+		t, err = newRemoteTarget(*baseURL, *token, *useCache)
+	} else {
+		t, err = newLocalTarget(*dbPath, *useCache)
+	}
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	commitIDs := splitList(*ids)
+	if len(commitIDs) == 0 {
+		if commitIDs, err = t.CommitIDs(); err != nil {
+			return err
+		}
+		if len(commitIDs) == 0 {
+			return fmt.Errorf("no badges to request")
+		}
+	}
+	paths, err := requestPaths(commitIDs, splitList(*outlooks), splitList(*formats), *useCache)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "requesting %d images with %d workers against %s\n", len(paths), *concurrency, t)
+	res := load(t, paths, *concurrency, *total, *duration)
+	res.print(os.Stdout)
+	if stats, ok := t.CacheStats(); ok {
+		fmt.Fprintf(os.Stdout, "\ncache: %d hits, %d misses (%.1f%% hit ratio), %d items\n",
+			stats.Hits, stats.Misses, 100*stats.HitRatio(), stats.Items)
+	}
+	if res.errors() == res.count() {
+		return fmt.Errorf("every request failed")
+	}
+	return nil
+}
+
+// target serves the image requests of a load test
+type target interface {
+	// Get requests path and returns the response status
+	Get(ctx context.Context, path string) (int, error)
+	// CommitIDs lists the badges to request when -ids is not given
+	CommitIDs() ([]string, error)
+	// CacheStats returns the image cache statistics, if the target has them
+	CacheStats() (cache.Stats, bool)
+	Close() error
+	String() string
+}
+
+// localTarget serves requests with the badge and certificate handlers over a
+// database and an image cache of its own
+type localTarget struct {
+	db         *database.DB
+	dbPath     string
+	imageCache *cache.Cache
+	mux        *http.ServeMux
+	// claims, if set, sign requests in so that no_cache takes effect
+	claims *auth.Claims
+}
+
+func newLocalTarget(dbPath string, useCache bool) (*localTarget, error) {
+	// database.New would create an empty database, so insist on an existing file
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("database not found: %w", err)
+	}
+	db, err := database.New(dbPath, zap.NewNop())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	t := &localTarget{db: db, dbPath: dbPath, imageCache: cache.New(), mux: http.NewServeMux()}
+	t.mux.Handle("/badge/", badge.NewHandler(db, zap.NewNop(), t.imageCache))
+	t.mux.Handle("/certificate/", certificate.NewHandler(db, zap.NewNop(), t.imageCache))
+	if !useCache {
+		t.claims = &auth.Claims{Username: "loadtest"}
+	}
+	return t, nil
+}
+
+func (t *localTarget) Get(ctx context.Context, path string) (int, error) {
+	if t.claims != nil {
+		ctx = auth.AddClaimsToContext(ctx, t.claims)
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	t.mux.ServeHTTP(rec, req)
+	return rec.Code, nil
+}
+
+func (t *localTarget) CommitIDs() ([]string, error) {
+	badges, err := t.db.ListBadges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badges: %w", err)
+	}
+	ids := make([]string, len(badges))
+	for i, b := range badges {
+		ids[i] = b.CommitID
+	}
+	return ids, nil
+}
+
+func (t *localTarget) CacheStats() (cache.Stats, bool) { return t.imageCache.Stats(), true }
+func (t *localTarget) Close() error                    { return t.db.Close() }
+func (t *localTarget) String() string                  { return t.dbPath + " (in-process)" }
+
+// remoteTarget sends requests to a running instance
+type remoteTarget struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newRemoteTarget(baseURL, token string, useCache bool) (*remoteTarget, error) {
+	if !useCache && token == "" {
+		return nil, fmt.Errorf("-cache=false with -url needs a session -token, as only signed-in users bypass the cache")
+	}
+	// Every worker keeps a connection of its own
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 1024
+	return &remoteTarget{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Transport: transport, Timeout: time.Minute},
+	}, nil
+}
+
+func (t *remoteTarget) Get(ctx context.Context, path string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// The body is read so latencies include the transfer, as for browsers
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func (t *remoteTarget) CommitIDs() ([]string, error) {
+	return nil, fmt.Errorf("-ids is required with -url")
+}
+
+func (t *remoteTarget) CacheStats() (cache.Stats, bool) { return cache.Stats{}, false }
+func (t *remoteTarget) Close() error                    { return nil }
+func (t *remoteTarget) String() string                  { return t.baseURL }
+
+// requestPaths returns the image paths of every commit ID, outlook and format
+func requestPaths(ids, outlooks, formats []string, useCache bool) ([]string, error) {
+	if len(outlooks) == 0 || len(formats) == 0 {
+		return nil, fmt.Errorf("at least one outlook and format are required")
+	}
+	var paths []string
+	for _, outlook := range outlooks {
+		if outlook != "badge" && outlook != "certificate" {
+			return nil, fmt.Errorf("unknown outlook %q, supported outlooks: badge, certificate", outlook)
+		}
+		for _, format := range formats {
+			switch format {
+			case "svg", "png", "jpg", "webp", "avif":
+			default:
+				return nil, fmt.Errorf("unknown format %q, supported formats: svg, png, jpg, webp, avif", format)
+			}
+			for _, id := range ids {
+				path := fmt.Sprintf("/%s/%s?format=%s", outlook, id, format)
+				if !useCache {
+					path += "&no_cache=true"
+				}
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// load requests the paths in turn from concurrency workers, total times or
+// until duration has passed
+func load(t target, paths []string, concurrency, total int, duration time.Duration) *results {
+	ctx := context.Background()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	res := newResults()
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if duration <= 0 && i >= total {
+					return
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				path := paths[i%len(paths)]
+				begin := time.Now()
+				status, err := t.Get(ctx, path)
+				// Requests cut short by the end of the run are not counted
+				if ctx.Err() != nil {
+					return
+				}
+				res.add(group(path), time.Since(begin), err == nil && status == http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// group returns the outlook and format a request path is reported under
+func group(path string) string {
+	outlook, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	_, query, _ := strings.Cut(rest, "?format=")
+	format, _, _ := strings.Cut(query, "&")
+	return outlook + " " + format
+}
+
+// results collects the latencies of a load test by outlook and format
+type results struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	failed    map[string]int
+	elapsed   time.Duration
+}
+
+func newResults() *results {
+	return &results{latencies: map[string][]time.Duration{}, failed: map[string]int{}}
+}
+
+func (r *results) add(group string, latency time.Duration, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[group] = append(r.latencies[group], latency)
+	if !ok {
+		r.failed[group]++
+	}
+}
+
+func (r *results) count() int {
+	n := 0
+	for _, l := range r.latencies {
+		n += len(l)
+	}
+	return n
+}
+
+func (r *results) errors() int {
+	n := 0
+	for _, f := range r.failed {
+		n += f
+	}
+	return n
+}
+
+// print writes a table of the request counts, errors and latency
+// percentiles of each group and of all requests
+func (r *results) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "outlook\tformat\trequests\terrors\tp50\tp95\tp99\tmax\t")
+
+	groups := make([]string, 0, len(r.latencies))
+	var all []time.Duration
+	for g, l := range r.latencies {
+		groups = append(groups, g)
+		all = append(all, l...)
+	}
+	sort.Strings(groups)
+	for _, g := range groups {
+		outlook, format, _ := strings.Cut(g, " ")
+		printRow(tw, outlook, format, r.latencies[g], r.failed[g])
+	}
+	printRow(tw, "all", "", all, r.errors())
+	tw.Flush()
+
+	if secs := r.elapsed.Seconds(); secs > 0 {
+		fmt.Fprintf(w, "\n%d requests in %s (%.1f requests/s)\n", len(all), r.elapsed.Round(time.Millisecond), float64(len(all))/secs)
+	}
+}
+
+func printRow(w io.Writer, outlook, format string, latencies []time.Duration, failed int) {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n", outlook, format, len(sorted), failed,
+		percentile(sorted, 50), percentile(sorted, 95), percentile(sorted, 99), percentile(sorted, 100))
+}
+
+// percentile returns the p-th percentile of sorted latencies by the
+// nearest-rank method, 0 without latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 200; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{50: 100 * time.Millisecond, 95: 190 * time.Millisecond, 99: 198 * time.Millisecond, 100: 200 * time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%d: expected %s, got %s", p, want, got)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("expected 0 without latencies, got %s", got)
+	}
+}
+
+func TestRequestPaths(t *testing.T) {
+	paths, err := requestPaths([]string{"abc1234"}, []string{"badge", "certificate"}, []string{"svg", "png"}, false)
+	if err != nil {
+		t.Fatalf("requestPaths: %v", err)
+	}
+	if len(paths) != 4 || paths[0] != "/badge/abc1234?format=svg&no_cache=true" {
+		t.Errorf("unexpected paths %v", paths)
+	}
+	if g := group(paths[3]); g != "certificate png" {
+		t.Errorf("expected group certificate png, got %q", g)
+	}
+	if _, err := requestPaths([]string{"abc1234"}, []string{"badge"}, []string{"gif"}, true); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
+
+// fakeTarget fails requests for paths containing "fail"
+type fakeTarget struct{}
+
+func (fakeTarget) Get(ctx context.Context, path string) (int, error) {
+	if strings.Contains(path, "fail") {
+		return http.StatusNotFound, nil
+	}
+	return http.StatusOK, nil
+}
+func (fakeTarget) CommitIDs() ([]string, error)    { return nil, nil }
+func (fakeTarget) CacheStats() (cache.Stats, bool) { return cache.Stats{}, false }
+func (fakeTarget) Close() error                    { return nil }
+func (fakeTarget) String() string                  { return "fake" }
+
+func TestLoad(t *testing.T) {
+	paths := []string{"/badge/ok1234?format=svg", "/badge/fail123?format=svg", "/certificate/ok1234?format=png"}
+	res := load(fakeTarget{}, paths, 4, 300, 0)
+	if res.count() != 300 || res.errors() != 100 {
+		t.Errorf("expected 300 requests with 100 errors, got %d with %d", res.count(), res.errors())
+	}
+	if n := len(res.latencies["certificate png"]); n != 100 {
+		t.Errorf("expected 100 certificate png requests, got %d", n)
+	}
+
+	var out strings.Builder
+	res.print(&out)
+	if !strings.Contains(out.String(), "p95") || !strings.Contains(out.String(), "300 requests in") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
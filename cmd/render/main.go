@@ -0,0 +1,198 @@
+// Command render writes a badge or certificate image to disk without running the
+// server, e.g. to embed a generated certificate in release artifacts.
+//
+// The badge is read either from a JSON definition (the same format as the
+// /api/badges endpoint) or by commit ID from an existing database:
+//
+//	render -json badge.json -outlook certificate -format pdf -o cert.pdf
+//	render -db ./db/badges.db -id abc1234 -format png
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/logo"
+	"github.com/finki/badges/internal/theme"
+	"github.com/finki/badges/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	jsonPath := flag.String("json", "", "badge JSON definition file (\"-\" for stdin)")
+	commitID := flag.String("id", "", "commit ID of a badge stored in the database")
+	dbPath := flag.String("db", envOr("DB_PATH", "./db/badges.db"), "path to the SQLite database (with -id)")
+	outlook := flag.String("outlook", "badge", "outlook to render: badge or certificate")
+	format := flag.String("format", "", "output format: svg, png, jpg, webp, avif or pdf (default from -o extension, else svg)")
+	output := flag.String("o", "", "output file (default <commit_id>-<outlook>.<format>, \"-\" for stdout)")
+	templatePath := flag.String("template", "", "certificate SVG template file (default: the built-in template)")
+	width := flag.Int("width", 0, "raster width in pixels (png/jpg/webp/avif, keeps the aspect ratio)")
+	height := flag.Int("height", 0, "raster height in pixels (png/jpg/webp/avif, keeps the aspect ratio)")
+	scale := flag.Float64("scale", 0, "raster scale factor, e.g. 2 for retina (png/jpg/webp/avif, instead of -width/-height)")
+	quality := flag.Int("quality", 0, "webp/avif quality 1-100 (default: encoder default)")
+	themePath := flag.String("theme", os.Getenv("THEME_FILE"), "JSON theme file overriding the default colors, fonts and logo")
+	logoHosts := flag.String("logo-hosts", os.Getenv("LOGO_ALLOWED_HOSTS"), "comma-separated hosts per-badge logos may be fetched from")
+	flag.Parse()
+
+	if (*jsonPath == "") == (*commitID == "") {
+		return fmt.Errorf("exactly one of -json or -id is required")
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+		if *format == "" || *output == "-" {
+			*format = "svg"
+		}
+	}
+	*format = strings.ToLower(*format)
+
+	if *themePath != "" {
+		t, err := theme.Load(*themePath)
+		if err != nil {
+			return err
+		}
+		theme.Set(t)
+	}
+
+	b, err := loadBadge(*jsonPath, *commitID, *dbPath)
+	if err != nil {
+		return err
+	}
+
+	var hosts []string
+	if *logoHosts != "" {
+		hosts = strings.Split(*logoHosts, ",")
+	}
+	logos := logo.NewResolver(hosts, 0, nil)
+
+	var generator interface {
+		GenerateSVG(badge *database.Badge) ([]byte, error)
+	}
+	switch *outlook {
+	case "badge":
+		badgeGenerator := badge.NewGenerator()
+		badgeGenerator.SetLogoSource(logos)
+		generator = badgeGenerator
+	case "certificate":
+		certGenerator := certificate.NewGenerator()
+		if *templatePath != "" {
+			certGenerator.SetTemplatePath(*templatePath)
+		}
+		certGenerator.SetLogoSource(logos)
+		generator = certGenerator
+	default:
+		return fmt.Errorf("unknown outlook %q, supported outlooks: badge, certificate", *outlook)
+	}
+
+	svgData, err := generator.GenerateSVG(b)
+	if err != nil {
+		return fmt.Errorf("failed to generate SVG: %w", err)
+	}
+
+	size := utils.Size{Width: *width, Height: *height, Scale: *scale}
+	if err := size.Validate(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var data []byte
+	switch *format {
+	case "svg":
+		data = svgData
+	case "png":
+		data, err = utils.SVGToPNG(ctx, svgData, size)
+	case "jpg", "jpeg":
+		data, err = utils.SVGToJPG(ctx, svgData, size)
+	case "webp":
+		data, err = utils.SVGToWebP(ctx, svgData, size, *quality)
+	case "avif":
+		data, err = utils.SVGToAVIF(ctx, svgData, size, *quality)
+	case "pdf":
+		data, err = utils.SVGToPDF(ctx, svgData)
+	default:
+		return fmt.Errorf("unknown format %q, supported formats: svg, png, jpg, webp, avif, pdf", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("%s-%s.%s", b.CommitID, *outlook, *format)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s (%d bytes)\n", *output, len(data))
+	return nil
+}
+
+// loadBadge reads the badge from a JSON definition or from the database
+func loadBadge(jsonPath, commitID, dbPath string) (*database.Badge, error) {
+	if jsonPath != "" {
+		var r io.Reader = os.Stdin
+		if jsonPath != "-" {
+			f, err := os.Open(jsonPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open badge definition: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		var def badgeapi.Badge
+		if err := json.NewDecoder(r).Decode(&def); err != nil {
+			return nil, fmt.Errorf("invalid badge definition: %w", err)
+		}
+		if def.CommitID == "" {
+			def.CommitID = "badge"
+		}
+		return def.ToDatabase(), nil
+	}
+
+	// database.New would create an empty database, so insist on an existing file
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("database not found: %w", err)
+	}
+	db, err := database.New(dbPath, zap.NewNop())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	b, err := db.GetBadge(commitID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("badge %q not found in %s", commitID, dbPath)
+	}
+	return b, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
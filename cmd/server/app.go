@@ -0,0 +1,864 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/accesslog"
+	"github.com/finki/badges/internal/admin"
+	"github.com/finki/badges/internal/adminpages"
+	"github.com/finki/badges/internal/apikey"
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/backup"
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/certtypeapi"
+	"github.com/finki/badges/internal/config"
+	"github.com/finki/badges/internal/create"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/debug"
+	"github.com/finki/badges/internal/details"
+	"github.com/finki/badges/internal/edit"
+	"github.com/finki/badges/internal/eventapi"
+	"github.com/finki/badges/internal/export"
+	"github.com/finki/badges/internal/graphqlapi"
+	"github.com/finki/badges/internal/groupapi"
+	"github.com/finki/badges/internal/health"
+	"github.com/finki/badges/internal/home"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/issuer"
+	"github.com/finki/badges/internal/issuerapi"
+	"github.com/finki/badges/internal/jobs"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/list"
+	"github.com/finki/badges/internal/logo"
+	"github.com/finki/badges/internal/middleware"
+	"github.com/finki/badges/internal/oauth"
+	"github.com/finki/badges/internal/org"
+	"github.com/finki/badges/internal/orgapi"
+	"github.com/finki/badges/internal/rerender"
+	"github.com/finki/badges/internal/roleapi"
+	"github.com/finki/badges/internal/signing"
+	"github.com/finki/badges/internal/sitemap"
+	"github.com/finki/badges/internal/software"
+	"github.com/finki/badges/internal/stats"
+	"github.com/finki/badges/internal/templateapi"
+	"github.com/finki/badges/internal/verify"
+	"github.com/finki/badges/internal/version"
+	"go.uber.org/zap"
+)
+
+// app holds the HTTP routes of the service and the components main runs in
+// the background, serves over gRPC or flushes on shutdown
+type app struct {
+	// handler serves every route below the configured path prefix
+	handler    http.Handler
+	imageCache *cache.Cache
+	stats      *stats.Recorder
+	health     *health.Checker
+	jobs       *jobs.Queue
+	badgeAPI   *badgeapi.Handler
+	verify     *verify.Handler
+	apiKeys    func(string) (*auth.APIKeyInfo, error)
+	keyUsage   *apikey.UsageTracker
+	events     *eventapi.Handler
+	// certificates maps the client certificates verified by mutual TLS
+	// listeners to service accounts, nil unless MTLS_ACCOUNTS is set
+	certificates *auth.CertificateAuth
+	// accessLog is the access log sink, nil unless ACCESS_LOG is set
+	accessLog io.Closer
+}
+
+// newApp creates the handlers of the service on db and registers their routes.
+// The process-wide settings (theme, commit ID policy, links, limits) are
+// applied by main beforehand; the end-to-end tests build the same app.
+func newApp(cfg *config.Config, db *database.DB, logger *zap.Logger, signer *signing.Signer) (*app, error) {
+	a := &app{}
+
+	// Initialize cache
+	imageCache := cache.New()
+	// Expired images are kept a while to be served if the database fails
+	imageCache.SetStaleFor(cfg.StaleImageRetention)
+
+	// Cache-Control policies of served images; invalid policies fail fast
+	cachePolicies := httpcache.DefaultPolicies()
+	if cfg.ImageCacheControl != "" {
+		var err error
+		cachePolicies, err = httpcache.ParsePolicies(cfg.ImageCacheControl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image cache policy: %w", err)
+		}
+	}
+
+	// Initialize middleware
+	errorHandler, err := middleware.NewErrorHandler(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize error handler: %w", err)
+	}
+
+	sanitizer := middleware.NewSanitizer(logger)
+	rateLimiter := middleware.NewRateLimiter(logger, 100, time.Minute) // 100 requests per minute
+	requestLogger := middleware.NewRequestLogger(logger)
+
+	// Client addresses are logged in full, truncated or not at all
+	ipLogging, err := middleware.ParseIPLogging(cfg.ClientIPLogging)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client IP logging: %w", err)
+	}
+	rateLimiter.SetIPLogging(ipLogging)
+	// X-Forwarded-For and X-Forwarded-Proto are only believed from the
+	// configured proxies
+	if err := auth.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	links.SetTrustedProxy(auth.FromTrustedProxy)
+	requestLogger.SetIPLogging(ipLogging)
+	requestLogger.SetSlowThreshold(cfg.SlowRequestThreshold)
+	// Logins are recorded as sessions that can be listed and revoked; their
+	// client addresses are stored as they are logged
+	auth.SetSessionStore(db, ipLogging.Format)
+	// Tokens name only the role; its permissions are resolved per request
+	auth.SetPermissionCache(auth.NewPermissionCache(db, cfg.PermissionCacheTTL))
+	// Tokens of OAuth2 clients are checked against the client on every request
+	auth.SetClientStore(db)
+
+	// Handlers are bounded in time by route group; invalid limits fail fast
+	routeTimeouts, err := middleware.ParseRouteTimeouts(cfg.RouteTimeouts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route timeouts: %w", err)
+	}
+	timeout := middleware.NewTimeout(logger, routeTimeouts)
+
+	// Access logs go to a sink of their own when configured
+	if cfg.AccessLog != "" {
+		format, err := accesslog.ParseFormat(cfg.AccessLogFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log format: %w", err)
+		}
+		sink, err := accesslog.Open(cfg.AccessLog, int64(cfg.AccessLogMaxSize)<<20, cfg.AccessLogMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log %s: %w", cfg.AccessLog, err)
+		}
+		a.accessLog = sink
+		accessLog := accesslog.New(sink, format)
+		accessLog.SetSampling(cfg.AccessLogSample)
+		requestLogger.SetAccessLog(accessLog)
+	}
+
+	// Per-badge logos are fetched only from the configured hosts
+	logoResolver := logo.NewResolver(cfg.LogoAllowedHosts, cfg.LogoMaxSize, imageCache)
+
+	// Count badge image requests and renders for the admin statistics, unless
+	// analytics are disabled; a nil recorder records nothing
+	var statsRecorder *stats.Recorder
+	if cfg.AnalyticsEnabled {
+		statsRecorder = stats.NewRecorder(db, logger)
+		statsRecorder.SetHonorDNT(cfg.AnalyticsHonorDNT)
+		statsRecorder.SetAggregateAfter(cfg.AnalyticsAggregateAfter)
+	}
+
+	// Initialize handlers
+	badgeHandler := badge.NewHandler(db, logger, imageCache)
+	badgeHandler.SetLogoSource(logoResolver)
+	badgeHandler.SetCachePolicies(cachePolicies)
+	badgeHandler.SetStats(statsRecorder)
+	certificateHandler := certificate.NewHandler(db, logger, imageCache)
+	certificateHandler.SetLogoSource(logoResolver)
+	certificateHandler.SetCachePolicies(cachePolicies)
+	certificateHandler.SetStats(statsRecorder)
+
+	detailsHandler, err := details.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize details handler: %w", err)
+	}
+
+	listHandler, err := list.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize list handler: %w", err)
+	}
+
+	softwareHandler, err := software.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize software handler: %w", err)
+	}
+
+	issuerHandler, err := issuer.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize issuer handler: %w", err)
+	}
+
+	// Organization namespace: /org/{org_id}/badge|certificate|details/{commit_id}
+	orgHandler := org.NewHandler(db, logger, map[string]http.Handler{
+		"badge":       badgeHandler,
+		"certificate": certificateHandler,
+		"details":     detailsHandler,
+	})
+
+	sitemapHandler, err := sitemap.NewHandler(db, logger, imageCache, cfg.RobotsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize sitemap handler: %w", err)
+	}
+
+	// Initialize home handler
+	homeHandler, err := home.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize home handler: %w", err)
+	}
+
+	// Initialize admin handler
+	adminHandler, err := admin.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize admin handler: %w", err)
+	}
+	adminHandler.SetStats(statsRecorder)
+
+	// Initialize edit handler
+	editHandler, err := edit.NewHandler(db, logger, imageCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize edit handler: %w", err)
+	}
+	editHandler.SetRequireApproval(cfg.RequireApproval)
+
+	// Initialize API key handler
+	apiKeyHandler := apikey.NewHandler(db, logger)
+	apiKeyHandler.SetDefaultQuota(cfg.APIKeyMonthlyQuota)
+
+	// Initialize auth handler
+	authHandler := auth.NewHandler(db, logger)
+	// Failed logins back off by username and client address, counted in the
+	// database so that every process on it sees them
+	throttleOptions := auth.ThrottleOptions{
+		UserAttempts:    cfg.LoginThrottleUserAttempts,
+		IPAttempts:      cfg.LoginThrottleIPAttempts,
+		MaxDelay:        cfg.LoginThrottleMaxDelay,
+		BanAttempts:     cfg.LoginBanAttempts,
+		BanDuration:     cfg.LoginBanDuration,
+		CaptchaAttempts: cfg.LoginCaptchaAttempts,
+	}
+	if cfg.LoginCaptchaVerifyURL != "" {
+		throttleOptions.Captcha = &auth.SiteVerifyCaptcha{URL: cfg.LoginCaptchaVerifyURL, Secret: cfg.LoginCaptchaSecret}
+	}
+	authHandler.SetThrottle(auth.NewLoginThrottle(db, throttleOptions))
+	authHandler.SetLockoutAttempts(cfg.LoginLockoutAttempts)
+
+	// Initialize the JSON badge API used by badgectl and other scripted clients
+	badgeAPIHandler := badgeapi.NewHandler(db, logger, imageCache)
+	badgeAPIHandler.SetLogoSource(logoResolver)
+	badgeAPIHandler.SetRequireApproval(cfg.RequireApproval)
+	badgeAPIHandler.SetStats(statsRecorder)
+	templateAPIHandler := templateapi.NewHandler(db, logger, imageCache)
+	issuerAPIHandler := issuerapi.NewHandler(db, logger, imageCache)
+	certTypeAPIHandler := certtypeapi.NewHandler(db, logger, imageCache)
+	orgAPIHandler := orgapi.NewHandler(db, logger, imageCache)
+	orgAPIHandler.SetLogoSource(logoResolver)
+	groupAPIHandler := groupapi.NewHandler(db, logger)
+	roleAPIHandler := roleapi.NewHandler(db, logger)
+	// Services exchange client credentials for short-lived tokens
+	oauthTokenHandler := oauth.NewTokenHandler(db, logger)
+	oauthTokenHandler.SetTokenTTL(cfg.OAuthTokenTTL)
+	oauthClientsHandler := oauth.NewClientsHandler(db, logger)
+	verifyHandler := verify.NewHandler(db, logger, signer)
+	apiKeyValidator := auth.GetAPIKeyValidator(db)
+	// Protected routes accept a Bearer token, the session cookie or an API key
+	authenticator := auth.NewAuthenticator(apiKeyValidator)
+	authenticator.SetLogger(logger)
+	// Requests made with API keys are metered per day and held to monthly quotas
+	keyUsage := apikey.NewUsageTracker(db, logger)
+	authenticator.SetAPIKeyMiddleware(keyUsage.Middleware)
+	apiKeyHandler.SetUsageTracker(keyUsage)
+	// Client certificates verified by the mutual TLS listeners authenticate
+	// as the service accounts they are mapped to
+	if len(cfg.MTLSAccounts) > 0 {
+		accounts, err := auth.ParseCertificateAccounts(cfg.MTLSAccounts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MTLS_ACCOUNTS: %w", err)
+		}
+		a.certificates = auth.NewCertificateAuth(db, accounts)
+		authenticator.SetCertificateAuth(a.certificates)
+	}
+	graphqlHandler, err := graphqlapi.NewHandler(db, logger, badgeAPIHandler, verifyHandler)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GraphQL schema: %w", err)
+	}
+
+	// Initialize backup handler
+	backupHandler := backup.NewHandler(db, logger, imageCache)
+
+	// Initialize the authenticated-only admin pages (backup, restore, change password)
+	backupPageHandler, err := adminpages.NewHandler(logger, "/backup", "backup/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backup page handler: %w", err)
+	}
+	restorePageHandler, err := adminpages.NewHandler(logger, "/restore", "restore/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize restore page handler: %w", err)
+	}
+	passwordPageHandler, err := adminpages.NewHandler(logger, "/password", "password/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize password page handler: %w", err)
+	}
+
+	// Static snapshots render the public pages with handlers of their own, so
+	// that exporting does not count as badge requests
+	exportBadgeHandler := badge.NewHandler(db, logger, imageCache)
+	exportBadgeHandler.SetLogoSource(logoResolver)
+	exportCertificateHandler := certificate.NewHandler(db, logger, imageCache)
+	exportCertificateHandler.SetLogoSource(logoResolver)
+	exporter := export.New(db, logger, map[string]http.Handler{
+		"home":         homeHandler,
+		"certificates": listHandler,
+		"details":      detailsHandler,
+		"badge":        exportBadgeHandler,
+		"certificate":  exportCertificateHandler,
+	})
+	exporter.SetStatic(assets.Static())
+
+	// Track whether the database can be read, for /readyz
+	healthChecker := health.NewChecker(db, logger)
+
+	// Initialize HTTP server
+	mux := http.NewServeMux()
+
+	// Register routes
+	// Initialize create handler
+	createHandler := create.NewHandler(db, logger, imageCache)
+	// Form-based creation page; validation is shared with the badge API
+	newPageHandler, err := create.NewPageHandler(badgeAPIHandler, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize creation page handler: %w", err)
+	}
+	newPageHandler.SetLogoSource(logoResolver)
+
+	registerRoutes(mux, badgeHandler, certificateHandler, detailsHandler, listHandler, softwareHandler, issuerHandler, orgHandler, sitemapHandler, homeHandler, adminHandler, editHandler, createHandler, newPageHandler, apiKeyHandler, authHandler, badgeAPIHandler, templateAPIHandler, issuerAPIHandler, certTypeAPIHandler, orgAPIHandler, groupAPIHandler, roleAPIHandler, oauthTokenHandler, oauthClientsHandler, verifyHandler, graphqlHandler, authenticator, backupHandler, backupPageHandler, restorePageHandler, passwordPageHandler, errorHandler, sanitizer, rateLimiter, requestLogger)
+
+	// Health endpoint (minimal middleware)
+	mux.Handle("/health", requestLogger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "ok",
+			"version": version.Version,
+			"commit":  version.Commit,
+		})
+	})))
+
+	// Readiness endpoint: 503 while the database is unavailable and cached
+	// images are served in degraded mode
+	mux.Handle("/readyz", requestLogger.Middleware(http.HandlerFunc(healthChecker.Readyz)))
+
+	// Profiling and runtime statistics for instance administrators
+	if cfg.DebugEndpoints {
+		mux.Handle("/debug/", requestLogger.Middleware(debug.RequireAdmin(debug.Handler())))
+	}
+
+	// Domain event feed and stream (events:read, organization-scoped); the
+	// stream is long-lived, so the buffering error handler is left out
+	eventsHandler := eventapi.NewHandler(db, logger)
+	mux.Handle("/api/events", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Required(eventsHandler),
+				),
+			),
+		),
+	))
+	mux.Handle("/api/events/stream", requestLogger.Middleware(
+		rateLimiter.Middleware(
+			sanitizer.Middleware(
+				authenticator.Required(eventsHandler),
+			),
+		),
+	))
+
+	// Static snapshot export (users:read, not organization-scoped); the
+	// archive is streamed, so the buffering error handler is left out
+	mux.Handle("/api/admin/export", requestLogger.Middleware(
+		rateLimiter.Middleware(
+			sanitizer.Middleware(
+				authenticator.Optional(
+					auth.RequirePermissionMiddleware("users", "read", exporter),
+				),
+			),
+		),
+	))
+
+	// Background job queue, observable through /api/admin/jobs (users:read,
+	// retries users:write, not organization-scoped)
+	jobQueue := jobs.New(db, logger, cfg.JobWorkers)
+	jobsHandler := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "read", jobQueue),
+					),
+				),
+			),
+		),
+	)
+	mux.Handle("/api/admin/jobs", jobsHandler)
+	mux.Handle("/api/admin/jobs/", jobsHandler)
+
+	// Re-rendering of stored images as queued jobs (users:write, not
+	// organization-scoped), sharing the export's image handlers
+	rerenderer := rerender.New(jobQueue, db, logger, imageCache, map[string]http.Handler{
+		"badge":       exportBadgeHandler,
+		"certificate": exportCertificateHandler,
+	})
+	rerenderHandler := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "write", rerenderer),
+					),
+				),
+			),
+		),
+	)
+	mux.Handle("/api/admin/rerender", rerenderHandler)
+
+	a.handler = links.StripPrefix(timeout.Middleware(mux))
+	a.imageCache = imageCache
+	a.stats = statsRecorder
+	a.health = healthChecker
+	a.jobs = jobQueue
+	a.badgeAPI = badgeAPIHandler
+	a.verify = verifyHandler
+	a.apiKeys = apiKeyValidator
+	a.keyUsage = keyUsage
+	a.events = eventsHandler
+	return a, nil
+}
+
+// Close releases the files the app holds open
+func (a *app) Close() error {
+	if a.accessLog != nil {
+		return a.accessLog.Close()
+	}
+	return nil
+}
+
+func registerRoutes(
+	mux *http.ServeMux,
+	badgeHandler *badge.Handler,
+	certificateHandler *certificate.Handler,
+	detailsHandler *details.Handler,
+	listHandler *list.Handler,
+	softwareHandler *software.Handler,
+	issuerHandler *issuer.Handler,
+	orgHandler *org.Handler,
+	sitemapHandler *sitemap.Handler,
+	homeHandler *home.Handler,
+	adminHandler *admin.Handler,
+	editHandler *edit.Handler,
+	createHandler *create.Handler,
+	newPageHandler *create.PageHandler,
+	apiKeyHandler *apikey.Handler,
+	authHandler *auth.Handler,
+	badgeAPIHandler *badgeapi.Handler,
+	templateAPIHandler *templateapi.Handler,
+	issuerAPIHandler *issuerapi.Handler,
+	certTypeAPIHandler *certtypeapi.Handler,
+	orgAPIHandler *orgapi.Handler,
+	groupAPIHandler *groupapi.Handler,
+	roleAPIHandler *roleapi.Handler,
+	oauthTokenHandler *oauth.TokenHandler,
+	oauthClientsHandler *oauth.ClientsHandler,
+	verifyHandler *verify.Handler,
+	graphqlHandler *graphqlapi.Handler,
+	authenticator *auth.Authenticator,
+	backupHandler *backup.Handler,
+	backupPageHandler *adminpages.Handler,
+	restorePageHandler *adminpages.Handler,
+	passwordPageHandler *adminpages.Handler,
+	errorHandler *middleware.ErrorHandler,
+	sanitizer *middleware.Sanitizer,
+	rateLimiter *middleware.RateLimiter,
+	requestLogger *middleware.RequestLogger,
+) {
+	// Apply middleware to handlers
+	// Images read the session so that writers can preview every override
+	badgeHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(auth.OptionalJWTFromCookie(badgeHandler)),
+			),
+		),
+	)
+
+	certificateHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(auth.OptionalJWTFromCookie(certificateHandler)),
+			),
+		),
+	)
+
+	detailsHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(detailsHandler),
+				),
+			),
+		),
+	)
+
+	listHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(listHandler),
+				),
+			),
+		),
+	)
+
+	homeHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					// Signed-in issuers get a link to the creation form
+					auth.OptionalJWTFromCookie(homeHandler),
+				),
+			),
+		),
+	)
+
+	// Edit handler: must inject optional JWT (handler enforces permissions and renders empty page for unauthorized)
+	editHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(editHandler),
+				),
+			),
+		),
+	)
+
+	// API key management: list own keys, create (api_keys:write) and revoke (api_keys:delete)
+	apiKeysHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiKeyHandler.ListAPIKeys(w, r)
+		case http.MethodPost:
+			auth.RequirePermissionMiddleware("api_keys", "write", http.HandlerFunc(apiKeyHandler.CreateAPIKey)).ServeHTTP(w, r)
+		case http.MethodDelete:
+			auth.RequirePermissionMiddleware("api_keys", "delete", http.HandlerFunc(apiKeyHandler.RevokeAPIKey)).ServeHTTP(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// JSON API middleware: JWT bearer token, session cookie or API key (X-API-Key)
+	apiMiddleware := func(h http.Handler) http.Handler {
+		return requestLogger.Middleware(
+			errorHandler.Middleware(
+				rateLimiter.Middleware(
+					sanitizer.Middleware(
+						authenticator.Required(h),
+					),
+				),
+			),
+		)
+	}
+
+	// Create a handler function for the login endpoint
+	loginHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHandler.Login(w, r)
+	})
+
+	// Create a handler for logout
+	logoutHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHandler.Logout(w, r)
+	})
+
+	// Create a handler for session info
+	sessionHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHandler.Session(w, r)
+	})
+
+	// Apply middleware to the login handler
+	loginHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(loginHandler),
+			),
+		),
+	)
+
+	logoutHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(logoutHandler),
+			),
+		),
+	)
+
+	sessionHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(sessionHandler),
+			),
+		),
+	)
+
+	// Change-password endpoint: authenticated session required (enforced in the handler)
+	changePasswordHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(http.HandlerFunc(authHandler.ChangePassword)),
+				),
+			),
+		),
+	)
+
+	// Register routes
+	mux.Handle("/badge/", badgeHandlerWithMiddleware)
+	mux.Handle("/badge/composite", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(auth.OptionalJWTFromCookie(http.HandlerFunc(badgeHandler.ServeComposite))),
+			),
+		),
+	))
+	mux.Handle("/badge/latest", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(http.HandlerFunc(badgeHandler.ServeLatest)),
+			),
+		),
+	))
+	mux.Handle("/certificate/", certificateHandlerWithMiddleware)
+	mux.Handle("/details/", detailsHandlerWithMiddleware)
+	mux.Handle("/certificates", listHandlerWithMiddleware)
+	mux.Handle("/software/", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(softwareHandler),
+				),
+			),
+		),
+	))
+	// Create new certificate endpoint: authenticated + write permission required
+	createHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					// Browser flows authenticate with the session cookie, then permissions are enforced
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("badges", "write", createHandler),
+					),
+				),
+			),
+		),
+	)
+	mux.Handle("/certificates/new", createHandlerWithMiddleware)
+	mux.Handle("/admin", requestLogger.Middleware(errorHandler.Middleware(rateLimiter.Middleware(sanitizer.Middleware(adminHandler)))))
+	// Authenticated-only admin pages: handlers redirect to /admin if unauthenticated
+	adminPageMiddleware := func(h http.Handler) http.Handler {
+		return requestLogger.Middleware(
+			errorHandler.Middleware(
+				rateLimiter.Middleware(
+					sanitizer.Middleware(
+						authenticator.Optional(h),
+					),
+				),
+			),
+		)
+	}
+	mux.Handle("/backup", adminPageMiddleware(backupPageHandler))
+	mux.Handle("/restore", adminPageMiddleware(restorePageHandler))
+	mux.Handle("/password", adminPageMiddleware(passwordPageHandler))
+	mux.Handle("/edit/", editHandlerWithMiddleware)
+	mux.Handle("/new", adminPageMiddleware(newPageHandler))
+	mux.Handle("/new/preview", adminPageMiddleware(newPageHandler))
+	mux.Handle("/api/keys", apiMiddleware(apiKeysHandler))
+	mux.Handle("/api/keys/", apiMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/rotate") {
+			auth.RequirePermissionMiddleware("api_keys", "write", http.HandlerFunc(apiKeyHandler.RotateAPIKey)).ServeHTTP(w, r)
+			return
+		}
+		apiKeyHandler.Usage(w, r)
+	})))
+	mux.Handle("/api/badges", apiMiddleware(badgeAPIHandler))
+	// Embed snippets are public like the details page; the rest of /api/badges/ needs an API key or JWT
+	badgeEmbedHandlerWithMiddleware := requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(http.HandlerFunc(badgeAPIHandler.Embed)),
+				),
+			),
+		),
+	)
+	badgeAPIHandlerWithMiddleware := apiMiddleware(badgeAPIHandler)
+	mux.Handle("/api/badges/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/embed") {
+			badgeEmbedHandlerWithMiddleware.ServeHTTP(w, r)
+			return
+		}
+		badgeAPIHandlerWithMiddleware.ServeHTTP(w, r)
+	}))
+	// Public verification API: signed status statements for third parties
+	mux.Handle("/api/verify/", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(verifyHandler),
+			),
+		),
+	))
+	mux.Handle("/api/verify-by-commit", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(http.HandlerFunc(verifyHandler.ByCommit)),
+			),
+		),
+	))
+	mux.Handle("/api/templates", apiMiddleware(templateAPIHandler))
+	mux.Handle("/api/templates/", apiMiddleware(templateAPIHandler))
+	mux.Handle("/api/issuers", apiMiddleware(issuerAPIHandler))
+	mux.Handle("/api/issuers/", apiMiddleware(issuerAPIHandler))
+	mux.Handle("/api/certificate-types", apiMiddleware(certTypeAPIHandler))
+	mux.Handle("/api/certificate-types/", apiMiddleware(certTypeAPIHandler))
+	mux.Handle("/api/orgs", apiMiddleware(orgAPIHandler))
+	mux.Handle("/api/orgs/", apiMiddleware(orgAPIHandler))
+	mux.Handle("/api/groups", apiMiddleware(groupAPIHandler))
+	mux.Handle("/api/groups/", apiMiddleware(groupAPIHandler))
+	mux.Handle("/api/roles", apiMiddleware(roleAPIHandler))
+	mux.Handle("/api/roles/", apiMiddleware(roleAPIHandler))
+	mux.Handle("/api/permissions", apiMiddleware(roleAPIHandler))
+	mux.Handle("/api/oauth/clients", apiMiddleware(oauthClientsHandler))
+	mux.Handle("/api/oauth/clients/", apiMiddleware(oauthClientsHandler))
+	// OAuth2 token endpoint: clients authenticate with their own credentials
+	mux.Handle("/oauth/token", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(oauthTokenHandler),
+			),
+		),
+	))
+	mux.Handle("/api/graphql", apiMiddleware(graphqlHandler))
+	mux.Handle("/api/users", apiMiddleware(
+		auth.RequirePermissionMiddleware("users", "write", http.HandlerFunc(authHandler.CreateUser)),
+	))
+	mux.Handle("/api/users/password", apiMiddleware(
+		auth.RequirePermissionMiddleware("users", "write", http.HandlerFunc(authHandler.ResetPassword)),
+	))
+	// Acting as another user (users:write; the handler also requires an
+	// instance administrator session) and the audit trail of it
+	mux.Handle("/api/admin/impersonate", apiMiddleware(
+		auth.RequirePermissionMiddleware("users", "write", http.HandlerFunc(authHandler.Impersonate)),
+	))
+	mux.Handle("/api/auth/login", loginHandlerWithMiddleware)
+	mux.Handle("/api/auth/logout", logoutHandlerWithMiddleware)
+	mux.Handle("/api/auth/session", sessionHandlerWithMiddleware)
+	mux.Handle("/api/auth/password", changePasswordHandlerWithMiddleware)
+	mux.Handle("/api/auth/sessions", apiMiddleware(http.HandlerFunc(authHandler.Sessions)))
+	mux.Handle("/api/auth/sessions/", apiMiddleware(http.HandlerFunc(authHandler.Sessions)))
+
+	// Backup & restore endpoints (admin only: users:write permission + role check in handler;
+	// browser sessions use the JWT cookie, scripts an API key)
+	mux.Handle("/api/backup", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "write",
+							http.HandlerFunc(backupHandler.Backup)),
+					),
+				),
+			),
+		),
+	))
+	mux.Handle("/api/restore", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "write",
+							http.HandlerFunc(backupHandler.Restore)),
+					),
+				),
+			),
+		),
+	))
+
+	// Instance statistics for the admin dashboard (users:read, not organization-scoped)
+	mux.Handle("/api/admin/stats", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "read",
+							http.HandlerFunc(adminHandler.Stats)),
+					),
+				),
+			),
+		),
+	))
+
+	// Schema migrations for badgectl db migrate (users:write, not organization-scoped)
+	mux.Handle("/api/admin/migrate", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					authenticator.Optional(
+						auth.RequirePermissionMiddleware("users", "write",
+							http.HandlerFunc(adminHandler.Migrate)),
+					),
+				),
+			),
+		),
+	))
+
+	mux.Handle("/issuer/", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(issuerHandler),
+				),
+			),
+		),
+	))
+	mux.Handle("/org/", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(
+				sanitizer.Middleware(
+					auth.OptionalJWTFromCookie(orgHandler),
+				),
+			),
+		),
+	))
+	mux.Handle("/sitemap.xml", requestLogger.Middleware(
+		errorHandler.Middleware(
+			rateLimiter.Middleware(http.HandlerFunc(sitemapHandler.ServeSitemap)),
+		),
+	))
+	mux.Handle("/robots.txt", requestLogger.Middleware(http.HandlerFunc(sitemapHandler.ServeRobots)))
+
+	mux.Handle("/", homeHandlerWithMiddleware)
+
+	// Serve static files
+	// Serve favicon(s) from the static directory for standard browser requests
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, assets.Static(), "favicon.ico")
+	})
+	mux.HandleFunc("/favicon.svg", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, assets.Static(), "favicon.svg")
+	})
+
+	// Generic static assets
+	fs := http.FileServerFS(assets.Static())
+	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+}
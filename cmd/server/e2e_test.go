@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/config"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/signing"
+	"go.uber.org/zap"
+)
+
+// testPassword is the password of the admin user of test servers
+const testPassword = "E2e-Test-Passw0rd!"
+
+// testServer is the whole service, with every route and middleware, on a
+// temporary database and served by httptest
+type testServer struct {
+	*httptest.Server
+	t *testing.T
+	// db is the server's database, for checks the routes do not expose
+	db     *database.DB
+	signer *signing.Signer
+	// client keeps the session cookie, as browsers do
+	client *http.Client
+	// token is the bearer token of the last login
+	token string
+}
+
+// newTestServer starts a server with the default configuration and an admin
+// user whose password is testPassword; it is stopped when the test ends
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("ADMIN_PASSWORD", testPassword)
+
+	cfg, err := config.LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	db, err := database.New(filepath.Join(dir, "badges.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	signer, _, err := signing.LoadOrCreate(filepath.Join(dir, "signing.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+
+	a, err := newApp(cfg, db, zap.NewNop(), signer)
+	if err != nil {
+		t.Fatalf("newApp: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	s := &testServer{Server: httptest.NewServer(a.handler), t: t, db: db, signer: signer}
+	t.Cleanup(s.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New: %v", err)
+	}
+	s.client = &http.Client{Jar: jar}
+	return s
+}
+
+// login signs in as the admin user, keeping the session cookie and token
+func (s *testServer) login() {
+	s.t.Helper()
+	resp, body := s.do(http.MethodPost, "/api/auth/login", map[string]string{"username": "admin", "password": testPassword})
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("login: expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil || login.Token == "" {
+		s.t.Fatalf("login: expected a token, got %s (err %v)", body, err)
+	}
+	s.token = login.Token
+}
+
+// do sends a request with v as its JSON body, if any, and the bearer token of
+// the last login, and returns the response with its body read
+func (s *testServer) do(method, path string, v interface{}) (*http.Response, []byte) {
+	s.t.Helper()
+	var body io.Reader
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			s.t.Fatalf("%s %s: %v", method, path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return s.send(req)
+}
+
+// get requests path as a browser would, with the session cookie only
+func (s *testServer) get(path string) (*http.Response, []byte) {
+	s.t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+	if err != nil {
+		s.t.Fatalf("GET %s: %v", path, err)
+	}
+	return s.send(req)
+}
+
+func (s *testServer) send(req *http.Request) (*http.Response, []byte) {
+	s.t.Helper()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return resp, body
+}
+
+// expect fails unless resp has the status and its body contains every string
+func (s *testServer) expect(resp *http.Response, body []byte, status int, contains ...string) {
+	s.t.Helper()
+	if resp.StatusCode != status {
+		s.t.Fatalf("%s %s: expected %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, body)
+	}
+	for _, want := range contains {
+		if !bytes.Contains(body, []byte(want)) {
+			s.t.Errorf("%s %s: expected %q in %s", resp.Request.Method, resp.Request.URL.Path, want, body)
+		}
+	}
+}
+
+func TestBadgeLifecycle(t *testing.T) {
+	s := newTestServer(t)
+
+	// Writing needs a session or API key
+	resp, body := s.do(http.MethodPost, "/api/badges", map[string]string{"commit_id": "e2e1234"})
+	s.expect(resp, body, http.StatusUnauthorized)
+
+	s.login()
+	resp, body = s.do(http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":        "e2e1234",
+		"type":             "badge",
+		"status":           "valid",
+		"issuer":           "GÉANT",
+		"issue_date":       "2026-01-31",
+		"expiry_date":      "2099-01-31",
+		"software_name":    "E2E Tool",
+		"software_version": "v1.0.0",
+		"certificate_name": "Self-Assessed Dependencies",
+	})
+	s.expect(resp, body, http.StatusCreated, `"commit_id":"e2e1234"`)
+
+	// The public pages render the new badge
+	resp, body = s.get("/badge/e2e1234")
+	s.expect(resp, body, http.StatusOK, "<svg", "Self-Assessed Dependencies")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/svg+xml") {
+		t.Errorf("expected an SVG badge, got %s", ct)
+	}
+	resp, body = s.get("/certificate/e2e1234")
+	s.expect(resp, body, http.StatusOK, "<svg", "v1.0.0")
+	resp, body = s.get("/details/e2e1234")
+	s.expect(resp, body, http.StatusOK, "E2E Tool")
+	resp, body = s.get("/details/bad%20id!")
+	s.expect(resp, body, http.StatusBadRequest)
+
+	// The edit page takes the session cookie; the API edits the badge
+	resp, body = s.get("/edit/e2e1234")
+	s.expect(resp, body, http.StatusOK, "e2e1234")
+	resp, body = s.do(http.MethodPatch, "/api/badges/e2e1234", map[string]string{"software_version": "v2.0.0"})
+	s.expect(resp, body, http.StatusOK, `"software_version":"v2.0.0"`)
+	resp, body = s.get("/certificate/e2e1234")
+	s.expect(resp, body, http.StatusOK, "v2.0.0")
+
+	// Revoking shows in the images and the signed verification
+	resp, body = s.do(http.MethodPatch, "/api/badges/e2e1234", map[string]string{"status": "revoked"})
+	s.expect(resp, body, http.StatusOK, `"status":"revoked"`)
+	resp, body = s.get("/badge/e2e1234?show=status")
+	s.expect(resp, body, http.StatusOK, "revoked")
+
+	resp, body = s.get("/api/verify/e2e1234")
+	s.expect(resp, body, http.StatusOK, `"status":"revoked"`, `"software_version":"v2.0.0"`)
+	if !signing.Verify(s.signer.PublicKey(), body, resp.Header.Get("X-Signature")) {
+		t.Error("expected the verification response to be signed by the instance key")
+	}
+	resp, body = s.get("/api/verify/unknown1")
+	s.expect(resp, body, http.StatusNotFound)
+}
+
+func TestLoginRequiredForWrites(t *testing.T) {
+	s := newTestServer(t)
+
+	resp, body := s.do(http.MethodPost, "/api/auth/login", map[string]string{"username": "admin", "password": "wrong"})
+	s.expect(resp, body, http.StatusUnauthorized)
+	for _, path := range []string{"/api/badges", "/api/keys", "/api/admin/jobs"} {
+		resp, body = s.get(path)
+		if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s: expected 401 or 403 without a session, got %d: %s", path, resp.StatusCode, body)
+		}
+	}
+
+	s.login()
+	resp, body = s.get("/api/auth/session")
+	s.expect(resp, body, http.StatusOK, "admin")
+	resp, body = s.do(http.MethodPost, "/api/badges", map[string]string{
+		"commit_id": "e2e5678", "type": "badge", "status": "valid", "issuer": "GÉANT",
+		"issue_date": "2026-01-31", "software_name": "E2E Tool", "software_version": "v1.0.0",
+	})
+	s.expect(resp, body, http.StatusCreated)
+	resp, body = s.get("/edit/e2e5678")
+	s.expect(resp, body, http.StatusOK, `name="software_name"`)
+
+	// Logging out ends the browser session
+	resp, body = s.do(http.MethodPost, "/api/auth/logout", nil)
+	s.expect(resp, body, http.StatusOK)
+	s.token = ""
+	resp, body = s.get("/edit/e2e5678")
+	if bytes.Contains(body, []byte(`name="software_name"`)) {
+		t.Errorf("expected no edit form after logging out, got %d", resp.StatusCode)
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	s := newTestServer(t)
+	s.login()
+
+	resp, body := s.do(http.MethodGet, "/api/auth/sessions", nil)
+	s.expect(resp, body, http.StatusOK, `"current":true`)
+	var sessions []struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(body, &sessions); err != nil || len(sessions) != 1 {
+		t.Fatalf("expected one session, got %s (err %v)", body, err)
+	}
+
+	// A revoked session's token and cookie are refused from then on
+	resp, body = s.do(http.MethodDelete, "/api/auth/sessions/"+sessions[0].SessionID, nil)
+	s.expect(resp, body, http.StatusOK, "revoked")
+	resp, body = s.do(http.MethodGet, "/api/badges", nil)
+	s.expect(resp, body, http.StatusUnauthorized)
+	resp, body = s.get("/api/auth/session")
+	s.expect(resp, body, http.StatusOK, `"authenticated":false`)
+}
@@ -2,41 +2,71 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"encoding/json"
-
-	"github.com/finki/badges/internal/admin"
-	"github.com/finki/badges/internal/adminpages"
 	"github.com/finki/badges/internal/apikey"
+	"github.com/finki/badges/internal/assets"
 	"github.com/finki/badges/internal/auth"
-	"github.com/finki/badges/internal/badge"
-	"github.com/finki/badges/internal/backup"
-	"github.com/finki/badges/internal/cache"
-	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/blobstore"
+	"github.com/finki/badges/internal/catalogue"
+	"github.com/finki/badges/internal/cdn"
+	"github.com/finki/badges/internal/chat"
+	"github.com/finki/badges/internal/commitid"
 	"github.com/finki/badges/internal/config"
  "github.com/finki/badges/internal/database"
- "github.com/finki/badges/internal/details"
- "github.com/finki/badges/internal/create"
- "github.com/finki/badges/internal/edit"
- "github.com/finki/badges/internal/home"
- "github.com/finki/badges/internal/list"
- "github.com/finki/badges/internal/middleware"
+ "github.com/finki/badges/internal/debug"
+ "github.com/finki/badges/internal/fixtures"
+ "github.com/finki/badges/internal/forge"
+ "github.com/finki/badges/internal/grpcapi"
+ "github.com/finki/badges/internal/links"
+ "github.com/finki/badges/internal/listener"
+ "github.com/finki/badges/internal/mail"
+ "github.com/finki/badges/internal/overrides"
+ "github.com/finki/badges/internal/redact"
+ "github.com/finki/badges/internal/scheduler"
+ "github.com/finki/badges/internal/secrets"
+ "github.com/finki/badges/internal/service"
+ "github.com/finki/badges/internal/signing"
+ "github.com/finki/badges/internal/theme"
  "github.com/finki/badges/internal/version"
+ "github.com/finki/badges/pkg/utils"
  "go.uber.org/zap"
+ "google.golang.org/grpc"
+ "google.golang.org/grpc/credentials"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file; environment variables override it (env CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	seed := flag.Bool("seed", false, "load seed badges from SEED_DATA_PATH into the database (env SEED_DATA)")
+	flag.Parse()
+
 	// Initialize configuration
-	cfg, err := config.Load()
+	cfg, err := config.LoadFile(*configFile)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// Command-line flags override the environment
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			cfg.SeedData = *seed
+		}
+	})
+
+	if *printConfig {
+		if err := cfg.WriteRedacted(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
 	}
 
 	// Initialize logger
@@ -57,104 +87,175 @@ func main() {
 		zap.String("build_date", info.BuildDate),
 	)
 
+	// Templates and static files are embedded; a directory may override them
+	assetsDir := cfg.AssetsDir
+	if cfg.TemplateReload && assetsDir == "" {
+		// Reload the templates of the checkout the server runs from
+		assetsDir = "."
+	}
+	if assetsDir != "" {
+		if err := assets.SetDir(assetsDir); err != nil {
+			logger.Fatal("Failed to set assets directory", zap.Error(err))
+		}
+		logger.Info("Overriding embedded templates and static files", zap.String("dir", assetsDir))
+	}
+	if cfg.TemplateReload {
+		assets.SetReload(true)
+		logger.Info("Reloading HTML templates when they change")
+	}
+
+	// Secrets mounted as files through <ENV>_FILE are reloaded when they rotate
+	secretWatcher := secrets.NewWatcher(logger)
+	for name, path := range cfg.SecretFiles {
+		if name == "JWT_SECRET" || name == "CDN_PURGE_TOKEN" {
+			continue
+		}
+		// Other secrets are only read at startup
+		value, _ := secrets.ReadFile(path)
+		secretWatcher.Watch(name, path, value, func(string) {
+			logger.Warn("Secret changed; restart the server to apply it", zap.String("secret", name))
+		})
+	}
+
+	// Sign session tokens with the configured key
+	if cfg.JWTSecret != "" {
+		auth.SetJWTSecret(cfg.JWTSecret)
+		if path, ok := cfg.SecretFiles["JWT_SECRET"]; ok {
+			secretWatcher.Watch("JWT_SECRET", path, cfg.JWTSecret, auth.RotateJWTSecret)
+		}
+	} else {
+		logger.Warn("JWT_SECRET is not set; session tokens are signed with the built-in development key")
+	}
+
+	// Session cookie attributes and browser session lifetimes
+	sameSite, _ := auth.ParseSameSite(cfg.CookieSameSite) // checked by config validation
+	auth.SetCookieOptions(auth.CookieOptions{
+		Secure:      cfg.CookieSecure,
+		Domain:      cfg.CookieDomain,
+		SameSite:    sameSite,
+		IdleTimeout: cfg.SessionIdleTimeout,
+		MaxAge:      cfg.SessionMaxAge,
+	})
+
 	// Initialize database
 	db, err := database.New(cfg.DatabasePath, logger)
 	if err != nil {
 		logger.Fatal("Failed to initialize database", zap.Error(err))
 	}
 	defer db.Close()
+	db.SetQueryTimeout(cfg.DBQueryTimeout)
 
-	// Initialize cache
-	imageCache := cache.New()
+	// Load seed badges only when explicitly requested; fresh deployments start empty
+	if cfg.SeedData {
+		added, err := fixtures.Seed(db, cfg.SeedDataPath)
+		if err != nil {
+			logger.Fatal("Failed to load seed data", zap.Error(err), zap.String("path", cfg.SeedDataPath))
+		}
+		logger.Info("Loaded seed data", zap.String("path", cfg.SeedDataPath), zap.Int("added", added))
+	}
 
-	// Initialize middleware
-	errorHandler, err := middleware.NewErrorHandler(logger)
+	// Initialize blob store for generated images (nil keeps them in the database)
+	blobs, err := blobstore.New(blobstore.Config{
+		Backend:     cfg.BlobStore,
+		Path:        cfg.BlobStorePath,
+		S3Endpoint:  cfg.S3Endpoint,
+		S3Region:    cfg.S3Region,
+		S3Bucket:    cfg.S3Bucket,
+		S3AccessKey: cfg.S3AccessKey,
+		S3SecretKey: cfg.S3SecretKey,
+		S3PathStyle: cfg.S3PathStyle,
+	})
 	if err != nil {
-		logger.Fatal("Failed to initialize error handler", zap.Error(err))
+		logger.Fatal("Failed to initialize blob store", zap.Error(err))
+	}
+	if blobs != nil {
+		db.SetBlobStore(blobs)
+		logger.Info("Using external blob store for generated images", zap.String("backend", cfg.BlobStore))
 	}
 
-	sanitizer := middleware.NewSanitizer(logger)
-	rateLimiter := middleware.NewRateLimiter(logger, 100, time.Minute) // 100 requests per minute
-	requestLogger := middleware.NewRequestLogger(logger)
-
-	// Initialize handlers
-	badgeHandler := badge.NewHandler(db, logger, imageCache)
-	certificateHandler := certificate.NewHandler(db, logger, imageCache)
-
-	detailsHandler, err := details.NewHandler(db, logger, imageCache)
-	if err != nil {
-		logger.Fatal("Failed to initialize details handler", zap.Error(err))
+	// Absolute links use the configured public address, and every route and
+	// link the path prefix
+	links.SetBase(cfg.BaseURL)
+	links.SetPrefix(cfg.PathPrefix)
+	if cfg.BaseURL == "" {
+		logger.Warn("BASE_URL is not set; links in responses follow the Host header of each request")
 	}
 
-	listHandler, err := list.NewHandler(db, logger, imageCache)
-	if err != nil {
-		logger.Fatal("Failed to initialize list handler", zap.Error(err))
+	// Load the theme before any generator is created
+	if cfg.ThemeFile != "" {
+		t, err := theme.Load(cfg.ThemeFile)
+		if err != nil {
+			logger.Fatal("Failed to load theme", zap.Error(err), zap.String("path", cfg.ThemeFile))
+		}
+		theme.Set(t)
+		logger.Info("Using custom theme", zap.String("path", cfg.ThemeFile))
 	}
 
-	// Initialize home handler
-	homeHandler, err := home.NewHandler(db, logger, imageCache)
+	// Apply the commit ID policy before any route validates an ID
+	policy, err := commitid.NewPolicy(cfg.CommitIDPattern, cfg.CommitIDMinLength, cfg.CommitIDMaxLength)
 	if err != nil {
-		logger.Fatal("Failed to initialize home handler", zap.Error(err))
+		logger.Fatal("Invalid commit ID policy", zap.Error(err))
 	}
+	commitid.Set(policy)
+	logger.Info("Using commit ID policy", zap.Stringer("policy", policy))
 
-	// Initialize admin handler
-	adminHandler, err := admin.NewHandler(db, logger, imageCache)
+	// Hide the configured fields from public views
+	redaction, err := redact.NewPolicy(cfg.RedactFields)
 	if err != nil {
-		logger.Fatal("Failed to initialize admin handler", zap.Error(err))
+		logger.Fatal("Invalid redaction policy", zap.Error(err))
+	}
+	redact.Set(redaction)
+	if !redaction.Empty() {
+		logger.Info("Redacting public badge fields", zap.Stringer("fields", redaction))
 	}
 
-	// Initialize edit handler
-	editHandler, err := edit.NewHandler(db, logger, imageCache)
+	// Honor only the configured rendering parameters in public images
+	publicOverrides, err := overrides.NewPolicy(cfg.PublicOverrides)
 	if err != nil {
-		logger.Fatal("Failed to initialize edit handler", zap.Error(err))
+		logger.Fatal("Invalid public overrides", zap.Error(err))
+	}
+	overrides.Set(publicOverrides)
+	logger.Info("Honoring public rendering parameters", zap.Stringer("parameters", publicOverrides))
+	if cfg.ImageURLSecret != "" {
+		overrides.SetSigningKey([]byte(cfg.ImageURLSecret))
 	}
-	
-	// Initialize API key handler
-	apiKeyHandler := apikey.NewHandler(db, logger)
-	
-	// Initialize auth handler
-	authHandler := auth.NewHandler(db, logger)
 
-	// Initialize backup handler
-	backupHandler := backup.NewHandler(db, logger, imageCache)
+	// Bound the renders running at once, as each may start a converter
+	service.SetRenderLimit(cfg.RenderConcurrency, cfg.RenderQueueTimeout)
+	utils.SetConverterLimits(utils.ConverterLimits{
+		Timeout:   cfg.ConverterTimeout,
+		MaxOutput: cfg.ConverterMaxOutput,
+		Workers:   cfg.ConverterWorkers,
+	})
 
-	// Initialize the authenticated-only admin pages (backup, restore, change password)
-	backupPageHandler, err := adminpages.NewHandler(logger, "/backup", "templates/backup/index.html")
+	// Load the key that signs verification responses, creating it on first start
+	signer, created, err := signing.LoadOrCreate(cfg.SigningKeyFile)
 	if err != nil {
-		logger.Fatal("Failed to initialize backup page handler", zap.Error(err))
+		logger.Fatal("Failed to load signing key", zap.Error(err), zap.String("path", cfg.SigningKeyFile))
 	}
-	restorePageHandler, err := adminpages.NewHandler(logger, "/restore", "templates/restore/index.html")
-	if err != nil {
-		logger.Fatal("Failed to initialize restore page handler", zap.Error(err))
+	if created {
+		logger.Warn("Generated a new signing key; back it up, verifiers pin its key ID",
+			zap.String("path", cfg.SigningKeyFile),
+			zap.String("key_id", signer.KeyID()),
+		)
 	}
-	passwordPageHandler, err := adminpages.NewHandler(logger, "/password", "templates/password/index.html")
+
+	// Build the handlers and routes
+	a, err := newApp(cfg, db, logger, signer)
 	if err != nil {
-		logger.Fatal("Failed to initialize password page handler", zap.Error(err))
+		logger.Fatal("Failed to initialize handlers", zap.Error(err))
 	}
+	defer a.Close()
 
-	// Initialize HTTP server
-	mux := http.NewServeMux()
-
-	// Register routes
- // Initialize create handler
- createHandler := create.NewHandler(db, logger, imageCache)
-
- registerRoutes(mux, badgeHandler, certificateHandler, detailsHandler, listHandler, homeHandler, adminHandler, editHandler, createHandler, apiKeyHandler, authHandler, backupHandler, backupPageHandler, restorePageHandler, passwordPageHandler, errorHandler, sanitizer, rateLimiter, requestLogger)
-
-	// Health endpoint (minimal middleware)
-	mux.Handle("/health", requestLogger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "ok",
-			"version": version.Version,
-			"commit":  version.Commit,
-		})
-	})))
+	// Profiling and runtime statistics for instance administrators
+	if cfg.DebugEndpoints || cfg.DebugAddr != "" {
+		debug.Publish(a.imageCache)
+	}
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      mux,
+		Handler:      a.handler,
 		ReadTimeout:  time.Second * 15,
 		WriteTimeout: time.Second * 15,
 		IdleTimeout:  time.Second * 60,
@@ -170,34 +271,204 @@ func main() {
 			logger.Info("Badge", 
 				zap.String("commit_id", badge.CommitID), 
 				zap.String("type", badge.Type), 
-				zap.String("status", badge.Status),
+				zap.String("status", string(badge.Status)),
 				zap.String("software", badge.SoftwareName + " " + badge.SoftwareVersion))
 		}
 	}
 
+	// Publish badges whose scheduled publication time has come
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	go scheduler.NewPublisher(db, logger, a.imageCache, cfg.RequireApproval).Run(schedulerCtx)
+	go a.stats.Run(schedulerCtx)
+	go a.keyUsage.Run(schedulerCtx)
+	go a.health.Run(schedulerCtx)
+	go a.jobs.Run(schedulerCtx)
+
+	// Post certificate states as commit statuses to GitHub and GitLab
+	forgeTokens, err := forge.ParseTokens(cfg.ForgeTokens)
+	if err != nil {
+		logger.Fatal("Invalid FORGE_TOKENS", zap.Error(err))
+	}
+	go forge.NewSyncer(db, logger, links.Base(), forgeTokens).Run(schedulerCtx)
+
+	// Announce issued, expiring and revoked badges on organizations' chat connectors
+	notifier := chat.NewNotifier(db, logger, links.Base())
+	go notifier.Run(schedulerCtx)
+
+	// Warn the owners of API keys before their keys expire, by email when an
+	// SMTP relay is configured and on the keys' webhooks, signed with
+	// WEBHOOK_SECRET
+	expiryNotifier := apikey.NewExpiryNotifier(db, logger)
+	if cfg.SMTPAddr != "" {
+		expiryNotifier.SetMailer(&mail.SMTP{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.SMTPFrom})
+	}
+	expiryNotifier.SetSigningSecret(cfg.WebhookSecret)
+	if path, ok := cfg.SecretFiles["WEBHOOK_SECRET"]; ok {
+		secretWatcher.Watch("WEBHOOK_SECRET", path, cfg.WebhookSecret, expiryNotifier.SetSigningSecret)
+	}
+	go expiryNotifier.Run(schedulerCtx)
+
+	// Purge the public URLs of changed badges from the CDN along with the local cache
+	var purger *cdn.Purger
+	if cfg.CDNProvider != "" {
+		purger, err = cdn.NewPurger(logger, cfg.CDNProvider, cfg.CDNPurgeEndpoint, cfg.CDNPurgeToken, links.Base())
+		if err != nil {
+			logger.Fatal("Invalid CDN purge configuration", zap.Error(err))
+		}
+		a.imageCache.OnInvalidate(purger.Invalidated)
+		if path, ok := cfg.SecretFiles["CDN_PURGE_TOKEN"]; ok {
+			secretWatcher.Watch("CDN_PURGE_TOKEN", path, cfg.CDNPurgeToken, purger.SetToken)
+		}
+		go purger.Run(schedulerCtx)
+		logger.Info("Purging CDN on badge changes", zap.String("provider", cfg.CDNProvider))
+	}
+
+	// Keep software_sc_id links in step with the Software Catalogue
+	if cfg.CatalogueURL != "" {
+		go catalogue.NewSyncer(db, logger, a.imageCache, cfg.CatalogueURL).Run(schedulerCtx)
+	}
+
+	go secretWatcher.Run(schedulerCtx)
+
+	// Listen on the socket passed by systemd socket activation, if any, or on
+	// the port, next to the previous process with LISTEN_REUSE_PORT
+	ln, activated, err := listener.Listen(server.Addr, cfg.ListenReusePort)
+	if err != nil {
+		logger.Fatal("Failed to listen", zap.Error(err))
+	}
+
 	// Start HTTP server in a goroutine
 	go func() {
-		logger.Info("Starting server", zap.Int("port", cfg.Port))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("Starting server", zap.Int("port", cfg.Port), zap.Bool("socket_activation", activated), zap.Bool("reuse_port", cfg.ListenReusePort))
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Failed to start server", zap.Error(err))
 		}
 	}()
 
+	// Serve the same routes over mutual TLS, where service accounts
+	// authenticate with client certificates
+	var mtlsServer *http.Server
+	if cfg.MTLSAddr != "" {
+		tlsConfig, err := listener.MutualTLSConfig(cfg.MTLSCertFile, cfg.MTLSKeyFile, cfg.MTLSClientCAFile, cfg.MTLSClientAuth)
+		if err != nil {
+			logger.Fatal("Invalid mutual TLS configuration", zap.Error(err))
+		}
+		mtlsServer = &http.Server{
+			Addr:         cfg.MTLSAddr,
+			Handler:      a.handler,
+			TLSConfig:    tlsConfig,
+			ReadTimeout:  server.ReadTimeout,
+			WriteTimeout: server.WriteTimeout,
+			IdleTimeout:  server.IdleTimeout,
+		}
+		go func() {
+			logger.Info("Starting mutual TLS server", zap.String("addr", cfg.MTLSAddr), zap.String("client_auth", cfg.MTLSClientAuth))
+			if err := mtlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Failed to start mutual TLS server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Serve the gRPC API for service-to-service badge management, over
+	// mutual TLS with GRPC_CLIENT_AUTH
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			logger.Fatal("Failed to listen for gRPC", zap.Error(err))
+		}
+		var opts []grpc.ServerOption
+		if cfg.GRPCClientAuth != "" {
+			tlsConfig, err := listener.MutualTLSConfig(cfg.MTLSCertFile, cfg.MTLSKeyFile, cfg.MTLSClientCAFile, cfg.GRPCClientAuth)
+			if err != nil {
+				logger.Fatal("Invalid gRPC mutual TLS configuration", zap.Error(err))
+			}
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer = grpcapi.NewServer(a.badgeAPI, a.verify, a.apiKeys, a.certificates, logger, opts...)
+		go func() {
+			logger.Info("Starting gRPC server", zap.Int("port", cfg.GRPCPort), zap.String("client_auth", cfg.GRPCClientAuth))
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Fatal("Failed to start gRPC server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Serve the debug endpoints without authentication on a loopback address;
+	// it has no write timeout so that long CPU profiles and traces complete
+	var debugServer *http.Server
+	if cfg.DebugAddr != "" {
+		if err := debug.CheckLoopback(cfg.DebugAddr); err != nil {
+			logger.Fatal("Invalid debug address", zap.Error(err))
+		}
+		debugServer = &http.Server{Addr: cfg.DebugAddr, Handler: debug.Handler(), ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			logger.Info("Starting debug server", zap.String("addr", cfg.DebugAddr))
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Failed to start debug server", zap.Error(err))
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Info("Shutting down server...")
+	// Report not ready first, so that load balancers stop sending requests
+	// while the listener still accepts them
+	logger.Info("Draining server...", zap.Duration("delay", cfg.ShutdownDelay), zap.Duration("timeout", cfg.ShutdownTimeout))
+	a.health.SetDraining()
+	time.Sleep(cfg.ShutdownDelay)
 
-	// Create a deadline to wait for
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	// In-flight requests, running jobs and pending deliveries share one
+	// deadline
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
+	// Event streams never finish on their own; clients reconnect elsewhere
+	// from the last event they received
+	a.events.Close()
+
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Error("Server forced to shutdown", zap.Error(err))
+	}
+
+	if mtlsServer != nil {
+		if err := mtlsServer.Shutdown(ctx); err != nil {
+			logger.Error("Mutual TLS server forced to shutdown", zap.Error(err))
+		}
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	if debugServer != nil {
+		debugServer.Close()
+	}
+
+	// No new jobs are claimed; running ones may finish, others are queued
+	// again for the next start
+	if err := a.jobs.Drain(ctx); err != nil {
+		logger.Warn("Jobs still running at shutdown are queued again", zap.Error(err))
+	}
+	stopScheduler()
+
+	// Deliver the announcements and purges of the last changes
+	notifier.Notify(ctx, time.Now())
+	if purger != nil {
+		if err := purger.Flush(ctx); err != nil {
+			logger.Error("Failed to purge CDN at shutdown", zap.Error(err))
+		}
+	}
+
+	// Write the badge statistics counted since the last flush
+	if err := a.stats.Flush(context.Background()); err != nil {
+		logger.Error("Failed to write badge stats", zap.Error(err))
+	}
+	if err := a.keyUsage.Flush(context.Background()); err != nil {
+		logger.Error("Failed to write API key usage", zap.Error(err))
 	}
 
 	logger.Info("Server exited properly")
@@ -214,238 +485,3 @@ func initLogger(level string) (*zap.Logger, error) {
 
 	return cfg.Build()
 }
-
-func registerRoutes(
-    mux *http.ServeMux,
-    badgeHandler *badge.Handler,
-    certificateHandler *certificate.Handler,
-    detailsHandler *details.Handler,
-    listHandler *list.Handler,
-    homeHandler *home.Handler,
-    adminHandler *admin.Handler,
-    editHandler *edit.Handler,
-    createHandler *create.Handler,
-    apiKeyHandler *apikey.Handler,
-    authHandler *auth.Handler,
-    backupHandler *backup.Handler,
-    backupPageHandler *adminpages.Handler,
-    restorePageHandler *adminpages.Handler,
-    passwordPageHandler *adminpages.Handler,
-    errorHandler *middleware.ErrorHandler,
-    sanitizer *middleware.Sanitizer,
-    rateLimiter *middleware.RateLimiter,
-    requestLogger *middleware.RequestLogger,
-) {
-	// Apply middleware to handlers
-	badgeHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(badgeHandler),
-			),
-		),
-	)
-
-	certificateHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(certificateHandler),
-			),
-		),
-	)
-
- detailsHandlerWithMiddleware := requestLogger.Middleware(
-        errorHandler.Middleware(
-            rateLimiter.Middleware(
-                sanitizer.Middleware(
-                    auth.OptionalJWTFromCookie(detailsHandler),
-                ),
-            ),
-        ),
-    )
-
- listHandlerWithMiddleware := requestLogger.Middleware(
-        errorHandler.Middleware(
-            rateLimiter.Middleware(
-                sanitizer.Middleware(
-                    auth.OptionalJWTFromCookie(listHandler),
-                ),
-            ),
-        ),
-    )
-
- homeHandlerWithMiddleware := requestLogger.Middleware(
-        errorHandler.Middleware(
-            rateLimiter.Middleware(
-                sanitizer.Middleware(homeHandler),
-            ),
-        ),
-    )
-
-    // Edit handler: must inject optional JWT (handler enforces permissions and renders empty page for unauthorized)
-    editHandlerWithMiddleware := requestLogger.Middleware(
-        errorHandler.Middleware(
-            rateLimiter.Middleware(
-                sanitizer.Middleware(
-                    auth.OptionalJWTFromCookie(editHandler),
-                ),
-            ),
-        ),
-    )
-
-	// Create a handler function for the ListAPIKeys endpoint
-	listAPIKeysHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only handle GET requests
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		
-		// Call the ListAPIKeys method
-		apiKeyHandler.ListAPIKeys(w, r)
-	})
-	
-	// Apply middleware to the ListAPIKeys handler
-	listAPIKeysHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(
-					auth.JWTAuthMiddleware(listAPIKeysHandler),
-				),
-			),
-		),
-	)
-
-	// Create a handler function for the login endpoint
-	loginHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHandler.Login(w, r)
-	})
-
-	// Create a handler for logout
-	logoutHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHandler.Logout(w, r)
-	})
-
-	// Create a handler for session info
-	sessionHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHandler.Session(w, r)
-	})
-	
-	// Apply middleware to the login handler
-	loginHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(loginHandler),
-			),
-		),
-	)
-
-	logoutHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(logoutHandler),
-			),
-		),
-	)
-
-	sessionHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(sessionHandler),
-			),
-		),
-	)
-
-	// Change-password endpoint: authenticated session required (enforced in the handler)
-	changePasswordHandlerWithMiddleware := requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(
-					auth.OptionalJWTFromCookie(http.HandlerFunc(authHandler.ChangePassword)),
-				),
-			),
-		),
-	)
-
-	// Register routes
-	mux.Handle("/badge/", badgeHandlerWithMiddleware)
-	mux.Handle("/certificate/", certificateHandlerWithMiddleware)
- mux.Handle("/details/", detailsHandlerWithMiddleware)
- mux.Handle("/certificates", listHandlerWithMiddleware)
- // Create new certificate endpoint: authenticated + write permission required
- createHandlerWithMiddleware := requestLogger.Middleware(
-     errorHandler.Middleware(
-         rateLimiter.Middleware(
-             sanitizer.Middleware(
-                // For browser flows we authenticate via JWT cookie, then enforce permissions
-                auth.OptionalJWTFromCookie(
-                    auth.RequirePermissionMiddleware("badges", "write", createHandler),
-                ),
-             ),
-         ),
-     ),
- )
- mux.Handle("/certificates/new", createHandlerWithMiddleware)
- mux.Handle("/admin", requestLogger.Middleware(errorHandler.Middleware(rateLimiter.Middleware(sanitizer.Middleware(adminHandler)))))
- // Authenticated-only admin pages: inject optional JWT; handlers redirect to /admin if unauthenticated
- adminPageMiddleware := func(h http.Handler) http.Handler {
-     return requestLogger.Middleware(
-         errorHandler.Middleware(
-             rateLimiter.Middleware(
-                 sanitizer.Middleware(
-                     auth.OptionalJWTFromCookie(h),
-                 ),
-             ),
-         ),
-     )
- }
- mux.Handle("/backup", adminPageMiddleware(backupPageHandler))
- mux.Handle("/restore", adminPageMiddleware(restorePageHandler))
- mux.Handle("/password", adminPageMiddleware(passwordPageHandler))
- mux.Handle("/edit/", editHandlerWithMiddleware)
- mux.Handle("/api/keys", listAPIKeysHandlerWithMiddleware)
- mux.Handle("/api/auth/login", loginHandlerWithMiddleware)
- mux.Handle("/api/auth/logout", logoutHandlerWithMiddleware)
-	mux.Handle("/api/auth/session", sessionHandlerWithMiddleware)
-	mux.Handle("/api/auth/password", changePasswordHandlerWithMiddleware)
-
-	// Backup & restore endpoints (admin only: users:write permission + role check in handler)
-	mux.Handle("/api/backup", requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(
-					auth.OptionalJWTFromCookie(
-						auth.RequirePermissionMiddleware("users", "write",
-							http.HandlerFunc(backupHandler.Backup)),
-					),
-				),
-			),
-		),
-	))
-	mux.Handle("/api/restore", requestLogger.Middleware(
-		errorHandler.Middleware(
-			rateLimiter.Middleware(
-				sanitizer.Middleware(
-					auth.OptionalJWTFromCookie(
-						auth.RequirePermissionMiddleware("users", "write",
-							http.HandlerFunc(backupHandler.Restore)),
-					),
-				),
-			),
-		),
-	))
-
-	mux.Handle("/", homeHandlerWithMiddleware)
-
-	// Serve static files
-	// Serve favicon(s) from the static directory for standard browser requests
-	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./static/favicon.ico")
-	})
-	mux.HandleFunc("/favicon.svg", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./static/favicon.svg")
-	})
-
-	// Generic static assets
-	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
-}
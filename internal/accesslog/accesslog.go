@@ -0,0 +1,231 @@
+// Package accesslog writes one line per HTTP request, in JSON or the Apache
+// combined log format, to a sink of its own: standard output, standard error
+// or a size-rotated file. Access logs are kept apart from the application log,
+// so that LOG_LEVEL does not hide them and they do not drown its messages.
+// Successful requests for badge and certificate images, which make up most of
+// the traffic, can be sampled.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format is the layout of access log lines
+type Format string
+
+const (
+	// FormatJSON writes one JSON object per line
+	FormatJSON Format = "json"
+	// FormatCombined writes the Apache/NGINX combined log format
+	FormatCombined Format = "combined"
+)
+
+// ParseFormat parses the ACCESS_LOG_FORMAT setting; "" means FormatJSON
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCombined:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid access log format %q: expected json or combined", s)
+	}
+}
+
+// Entry is a request to log
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	URI       string        `json:"uri"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"-"`
+	ClientIP  string        `json:"client_ip,omitempty"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+}
+
+// jsonEntry adds the duration in milliseconds to an entry
+type jsonEntry struct {
+	Entry
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Logger writes access log lines
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	// sample is the share of successful image requests logged
+	sample float64
+	random func() float64
+}
+
+// New creates a logger writing every request to w
+func New(w io.Writer, format Format) *Logger {
+	return &Logger{w: w, format: format, sample: 1, random: rand.Float64}
+}
+
+// SetSampling logs only a share (0 to 1) of the successful requests for badge
+// and certificate images; other requests and errors are always logged
+func (l *Logger) SetSampling(rate float64) {
+	l.sample = rate
+}
+
+// Log writes an entry unless it is sampled out
+func (l *Logger) Log(e Entry) {
+	if l.sample < 1 && e.Status < 400 && isImagePath(e.URI) && l.random() >= l.sample {
+		return
+	}
+
+	var line []byte
+	switch l.format {
+	case FormatCombined:
+		line = []byte(combined(e))
+	default:
+		data, err := json.Marshal(jsonEntry{Entry: e, DurationMS: float64(e.Duration.Microseconds()) / 1000})
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// isImagePath reports whether a request URI is for a badge or certificate image
+func isImagePath(uri string) bool {
+	return strings.HasPrefix(uri, "/badge/") || strings.HasPrefix(uri, "/certificate/")
+}
+
+// combined formats an entry as
+//
+//	client - - [02/Jan/2006:15:04:05 -0700] "GET /uri HTTP/1.1" 200 123 "referer" "user agent"
+func combined(e Entry) string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		orDash(e.ClientIP), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, escape(e.URI), e.Proto, e.Status, bytes, escape(orDash(e.Referer)), escape(orDash(e.UserAgent)))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape quotes the characters that would break a combined log line
+func escape(s string) string {
+	s = strconv.Quote(s)
+	return s[1 : len(s)-1]
+}
+
+// Open returns the sink named by the ACCESS_LOG setting: "stdout", "stderr"
+// or a file path. Files are rotated once they reach maxSize bytes, keeping
+// maxBackups old files as path.1, path.2, ...; a maxSize of 0 never rotates.
+func Open(dest string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	switch dest {
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	}
+	f := &rotatingFile{path: dest, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// rotatingFile is a log file that is rotated by size
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// open opens the log file for appending
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// rotate renames the log file to path.1, shifting older backups up and
+// dropping those beyond maxBackups, and starts a new file
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("failed to rotate access log: %w", err)
+	}
+	if r.maxBackups <= 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(r.backup(r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return fmt.Errorf("failed to rotate access log: %w", err)
+		}
+	}
+	return r.open()
+}
+
+// backup returns the path of the nth old log file
+func (r *rotatingFile) backup(n int) string {
+	return r.path + "." + strconv.Itoa(n)
+}
@@ -0,0 +1,97 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func entry(uri string, status int) Entry {
+	return Entry{
+		Time:      time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC),
+		Method:    "GET",
+		URI:       uri,
+		Proto:     "HTTP/1.1",
+		Status:    status,
+		Bytes:     512,
+		Duration:  1500 * time.Microsecond,
+		ClientIP:  "203.0.113.0",
+		UserAgent: `curl "8"`,
+	}
+}
+
+func TestFormats(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, FormatJSON).Log(entry("/details/abc123", 200))
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	if got["uri"] != "/details/abc123" || got["status"] != float64(200) || got["duration_ms"] != 1.5 || got["client_ip"] != "203.0.113.0" {
+		t.Errorf("unexpected JSON entry %v", got)
+	}
+
+	buf.Reset()
+	New(&buf, FormatCombined).Log(entry("/badge/abc123?format=png", 200))
+	want := `203.0.113.0 - - [01/Mar/2026:12:30:00 +0000] "GET /badge/abc123?format=png HTTP/1.1" 200 512 "-" "curl \"8\""` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected combined line\n got %q\nwant %q", buf.String(), want)
+	}
+
+	if f, err := ParseFormat("Combined"); err != nil || f != FormatCombined {
+		t.Errorf("ParseFormat: %v %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, FormatCombined)
+	l.SetSampling(0.25)
+	l.random = func() float64 { return 0.5 }
+
+	l.Log(entry("/badge/abc123", 200))
+	l.Log(entry("/certificate/abc123", 304))
+	if buf.Len() != 0 {
+		t.Errorf("expected successful image requests to be sampled out, got %q", buf.String())
+	}
+	l.Log(entry("/badge/abc123", 404))
+	l.Log(entry("/details/abc123", 200))
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("expected errors and other routes to be logged, got %q", buf.String())
+	}
+	l.random = func() float64 { return 0.1 }
+	l.Log(entry("/badge/abc123", 200))
+	if n := strings.Count(buf.String(), "\n"); n != 3 {
+		t.Errorf("expected a sampled request to be logged, got %q", buf.String())
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	w.Close()
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(name), want, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected at most two backups")
+	}
+}
@@ -1,12 +1,13 @@
 package admin
 
 import (
-    "html/template"
     "net/http"
     "time"
 
+    "github.com/finki/badges/internal/assets"
     "github.com/finki/badges/internal/cache"
     "github.com/finki/badges/internal/database"
+    "github.com/finki/badges/internal/stats"
     "github.com/finki/badges/internal/version"
     "go.uber.org/zap"
 )
@@ -23,12 +24,13 @@ type Handler struct {
     db       *database.DB
     logger   *zap.Logger
     cache    *cache.Cache
-    template *template.Template
+    template *assets.Template
+    stats    *stats.Recorder
 }
 
 // NewHandler creates a new admin handler
 func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
-    tmpl, err := template.ParseFiles("templates/admin/index.html")
+    tmpl, err := assets.ParseTemplate("admin/index.html")
     if err != nil {
         return nil, err
     }
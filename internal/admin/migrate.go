@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/finki/badges/internal/auth"
+	"go.uber.org/zap"
+)
+
+// Migrate applies pending schema migrations to the database, so that
+// operators can upgrade a replaced database file without shell access to the
+// server. Only instance-wide callers may migrate.
+func (h *Handler) Migrate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if err := h.db.Migrate(); err != nil {
+		h.logger.Error("admin: failed to migrate database", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("admin: database migrated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "migrated"})
+}
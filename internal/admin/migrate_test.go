@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestMigrate(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "admin.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	h := &Handler{db: db, logger: logger}
+
+	// A database from an older release lacks the newer columns and indexes
+	if _, err := db.Exec("DROP INDEX idx_api_keys_lookup_hash"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+
+	for _, tc := range []struct {
+		method string
+		orgID  string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "geant", http.StatusForbidden},
+		{http.MethodPost, "", http.StatusOK},
+	} {
+		ctx := context.Background()
+		if tc.orgID != "" {
+			ctx = auth.AddClaimsToContext(ctx, &auth.Claims{UserID: "user-id", OrgID: tc.orgID})
+		}
+		rec := httptest.NewRecorder()
+		h.Migrate(rec, httptest.NewRequest(tc.method, "/api/admin/migrate", nil).WithContext(ctx))
+		if rec.Code != tc.status {
+			t.Errorf("%s as %q: expected %d, got %d", tc.method, tc.orgID, tc.status, rec.Code)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'idx_api_keys_lookup_hash'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected the migration to restore the index, got %d (%v)", n, err)
+	}
+}
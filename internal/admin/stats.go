@@ -0,0 +1,205 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/stats"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultStatsDays is the period request statistics cover unless ?days= is given
+	DefaultStatsDays = 30
+	// MaxStatsDays is the longest period ?days= accepts
+	MaxStatsDays = 365
+	// ExpiringWithin is how close to their expiry date certificates are listed as expiring
+	ExpiringWithin = 30 * 24 * time.Hour
+	// topBadges is how many of the most requested badges are listed
+	topBadges = 10
+)
+
+// Stats is the body of /api/admin/stats
+type Stats struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Days is the period renders_per_day and top_badges cover
+	Days          int                    `json:"days"`
+	Badges        BadgeCounts            `json:"badges"`
+	RendersPerDay []*database.BadgeStats `json:"renders_per_day"`
+	TopBadges     []TopBadge             `json:"top_badges"`
+	Cache         CacheStats             `json:"cache"`
+	Expiring      []ExpiringBadge        `json:"expiring"`
+}
+
+// BadgeCounts counts the badges of the instance. Valid badges past their
+// expiry date count as expired.
+type BadgeCounts struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	ByType   map[string]int `json:"by_type"`
+	ByIssuer map[string]int `json:"by_issuer"`
+}
+
+// TopBadge is one of the most requested badges
+type TopBadge struct {
+	CommitID        string `json:"commit_id"`
+	SoftwareName    string `json:"software_name"`
+	CertificateName string `json:"certificate_name,omitempty"`
+	Requests        int64  `json:"requests"`
+	Renders         int64  `json:"renders"`
+}
+
+// CacheStats describes the use of the image and page cache since startup
+type CacheStats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	Items    int     `json:"items"`
+}
+
+// ExpiringBadge is a published, valid certificate expiring within ExpiringWithin
+type ExpiringBadge struct {
+	CommitID        string    `json:"commit_id"`
+	SoftwareName    string    `json:"software_name"`
+	CertificateName string    `json:"certificate_name,omitempty"`
+	Issuer          string    `json:"issuer"`
+	ExpiryDate      string    `json:"expiry_date"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	DaysLeft        int       `json:"days_left"`
+}
+
+// SetStats sets the recorder whose pending counts are written before the
+// statistics are read
+func (h *Handler) SetStats(r *stats.Recorder) {
+	h.stats = r
+}
+
+// Stats serves the instance statistics shown on the /admin page. Only
+// instance users with users:read may see them; organization-scoped callers
+// are refused.
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	days := DefaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxStatsDays {
+			http.Error(w, "Invalid days: expected 1 to "+strconv.Itoa(MaxStatsDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	if err := h.stats.Flush(r.Context()); err != nil {
+		h.logger.Warn("admin: failed to write pending badge stats", zap.Error(err))
+	}
+
+	now := time.Now()
+	s, err := h.collectStats(r, now, days)
+	if err != nil {
+		h.logger.Error("admin: failed to collect stats", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cs := h.cache.Stats()
+	s.Cache = CacheStats{Hits: cs.Hits, Misses: cs.Misses, HitRatio: cs.HitRatio(), Items: cs.Items}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s)
+}
+
+// collectStats reads the badge counts, request statistics and expiring
+// certificates as of now
+func (h *Handler) collectStats(r *http.Request, now time.Time, days int) (*Stats, error) {
+	db := h.db.WithContext(r.Context())
+
+	badges, err := db.ListBadges()
+	if err != nil {
+		return nil, err
+	}
+	since := now.UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	daily, err := db.ListDailyStats(since)
+	if err != nil {
+		return nil, err
+	}
+	top, err := db.TopRequestedBadges(since, topBadges)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{
+		GeneratedAt: now.UTC(),
+		Days:        days,
+		Badges: BadgeCounts{
+			Total:    len(badges),
+			ByStatus: map[string]int{},
+			ByType:   map[string]int{},
+			ByIssuer: map[string]int{},
+		},
+		RendersPerDay: daily,
+		TopBadges:     []TopBadge{},
+		Expiring:      []ExpiringBadge{},
+	}
+	if s.RendersPerDay == nil {
+		s.RendersPerDay = []*database.BadgeStats{}
+	}
+
+	byID := make(map[string]*database.Badge, len(badges))
+	for _, b := range badges {
+		byID[b.CommitID] = b
+		status := b.Status
+		if status == database.StatusValid && b.IsExpiredAt(now) {
+			status = database.StatusExpired
+		}
+		s.Badges.ByStatus[string(status)]++
+		s.Badges.ByType[b.Type]++
+		s.Badges.ByIssuer[b.Issuer]++
+
+		expiry, expires := b.ExpiresAt()
+		if !b.IsPublished() || b.DisplayStatus() != "valid" || !expires {
+			continue
+		}
+		if expiry.Sub(now) > ExpiringWithin {
+			continue
+		}
+		s.Expiring = append(s.Expiring, ExpiringBadge{
+			CommitID:        b.CommitID,
+			SoftwareName:    b.SoftwareName,
+			CertificateName: b.CertificateName.String,
+			Issuer:          b.Issuer,
+			ExpiryDate:      database.FormatNullDate(b.ExpiryDate),
+			ExpiresAt:       expiry,
+			DaysLeft:        int(expiry.Sub(now).Hours()/24) + 1,
+		})
+	}
+	sort.Slice(s.Expiring, func(i, j int) bool {
+		if s.Expiring[i].ExpiryDate != s.Expiring[j].ExpiryDate {
+			return s.Expiring[i].ExpiryDate < s.Expiring[j].ExpiryDate
+		}
+		return s.Expiring[i].CommitID < s.Expiring[j].CommitID
+	})
+
+	for _, t := range top {
+		tb := TopBadge{CommitID: t.CommitID, Requests: t.Requests, Renders: t.Renders}
+		if b, ok := byID[t.CommitID]; ok {
+			tb.SoftwareName = b.SoftwareName
+			tb.CertificateName = b.CertificateName.String
+		}
+		s.TopBadges = append(s.TopBadges, tb)
+	}
+	return s, nil
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/stats"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestStats(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "admin.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	date := func(d time.Duration) sql.NullTime {
+		return sql.NullTime{Time: database.Day(now.Add(d)), Valid: true}
+	}
+	for _, b := range []*database.Badge{
+		{CommitID: "valid123", Type: "certificate", Status: "valid", Issuer: "GÉANT", ExpiryDate: date(365 * 24 * time.Hour)},
+		{CommitID: "soon1234", Type: "certificate", Status: "valid", Issuer: "GÉANT", ExpiryDate: date(10 * 24 * time.Hour)},
+		{CommitID: "past1234", Type: "badge", Status: "valid", Issuer: "Other", ExpiryDate: date(-48 * time.Hour)},
+		{CommitID: "draft123", Type: "badge", Status: "draft", Issuer: "Other", ExpiryDate: date(5 * 24 * time.Hour)},
+	} {
+		b.IssueDate, b.SoftwareName, b.SoftwareVersion = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "App "+b.CommitID, "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	c := cache.New()
+	c.Set("home:index", []byte("page"), time.Minute)
+	c.Get("home:index")
+	c.Get("details:missing")
+	recorder := stats.NewRecorder(db, logger)
+	recorder.Request("soon1234", testutil.ImageRequest(""))
+	recorder.Request("soon1234", testutil.ImageRequest(""))
+	recorder.Render("soon1234")
+	recorder.Request("valid123", testutil.ImageRequest(""))
+
+	h := &Handler{db: db, logger: logger, cache: c}
+	h.SetStats(recorder)
+
+	rec := httptest.NewRecorder()
+	h.Stats(rec, httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var s Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+
+	if s.Days != DefaultStatsDays || s.Badges.Total != 4 || s.Badges.ByStatus["valid"] != 2 || s.Badges.ByStatus["expired"] != 1 ||
+		s.Badges.ByType["badge"] != 2 || s.Badges.ByIssuer["GÉANT"] != 2 {
+		t.Errorf("unexpected badge counts %+v", s.Badges)
+	}
+	if len(s.RendersPerDay) != 1 || s.RendersPerDay[0].Requests != 3 || s.RendersPerDay[0].Renders != 1 {
+		t.Errorf("expected today's pending counts, got %+v", s.RendersPerDay)
+	}
+	if len(s.TopBadges) != 2 || s.TopBadges[0].CommitID != "soon1234" || s.TopBadges[0].SoftwareName != "App soon1234" {
+		t.Errorf("expected soon1234 to be the most requested, got %+v", s.TopBadges)
+	}
+	if s.Cache.Hits != 1 || s.Cache.Misses != 1 || s.Cache.HitRatio != 0.5 {
+		t.Errorf("unexpected cache stats %+v", s.Cache)
+	}
+	// Drafts and expired certificates are not listed as expiring
+	if len(s.Expiring) != 1 || s.Expiring[0].CommitID != "soon1234" || s.Expiring[0].DaysLeft < 9 || s.Expiring[0].DaysLeft > 11 {
+		t.Errorf("expected soon1234 to be expiring, got %+v", s.Expiring)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"invalid days", httptest.NewRequest(http.MethodGet, "/api/admin/stats?days=0", nil), http.StatusBadRequest},
+		{"method", httptest.NewRequest(http.MethodPost, "/api/admin/stats", nil), http.StatusMethodNotAllowed},
+		{"organization", httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil).WithContext(
+			auth.AddAPIKeyToContext(context.Background(), &auth.APIKeyInfo{ID: "key", OrgID: "acme"})), http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		h.Stats(rec, tc.req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
@@ -5,10 +5,10 @@
 package adminpages
 
 import (
-	"html/template"
 	"net/http"
 	"time"
 
+	"github.com/finki/badges/internal/assets"
 	"github.com/finki/badges/internal/auth"
 	"github.com/finki/badges/internal/version"
 	"go.uber.org/zap"
@@ -25,13 +25,14 @@ type TemplateData struct {
 type Handler struct {
 	logger   *zap.Logger
 	path     string
-	template *template.Template
+	template *assets.Template
 }
 
-// NewHandler parses templatePath and returns a handler that only serves requests
-// for exactly path (e.g. "/backup") to authenticated users.
+// NewHandler parses the template named templatePath under templates/ and
+// returns a handler that only serves requests for exactly path (e.g. "/backup")
+// to authenticated users.
 func NewHandler(logger *zap.Logger, path, templatePath string) (*Handler, error) {
-	tmpl, err := template.ParseFiles(templatePath)
+	tmpl, err := assets.ParseTemplate(templatePath)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,241 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/mail"
+	"github.com/finki/badges/internal/netguard"
+	"github.com/finki/badges/pkg/webhooksig"
+	"go.uber.org/zap"
+)
+
+// ExpiryCheckInterval is how often keys are checked for their expiry
+const ExpiryCheckInterval = time.Hour
+
+// ExpiryWarnings are the days before its expiry the owner of an API key is
+// warned, longest first
+var ExpiryWarnings = []int{14, 3}
+
+// EventExpiring is the event of the webhook payloads warning of an expiry
+const EventExpiring = "api_key.expiring"
+
+// ExpiryPayload is posted to the notify URL of a key about to expire
+type ExpiryPayload struct {
+	Event     string    `json:"event"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DaysLeft  int       `json:"days_left"`
+}
+
+// ValidateNotifyURL checks the webhook URL of a key: empty, or https to a
+// host whose addresses are all public, so that key owners cannot make the
+// server post to its own network. The addresses are checked again when the
+// webhook is posted to, since DNS answers may change.
+func ValidateNotifyURL(ctx context.Context, notifyURL string) error {
+	if notifyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(notifyURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("invalid notify URL: use an https URL")
+	}
+	if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("invalid notify URL: %w", err)
+	}
+	return nil
+}
+
+// ExpiryNotifier warns the owners of API keys before their keys expire, by
+// email and on the webhook of the key, and marks expired keys as such
+type ExpiryNotifier struct {
+	db     *database.DB
+	logger *zap.Logger
+	mailer mail.Sender
+	client *http.Client
+
+	mu     sync.RWMutex
+	secret []byte
+}
+
+// NewExpiryNotifier creates a notifier of the keys in db. Owners are only
+// emailed once SetMailer is called.
+func NewExpiryNotifier(db *database.DB, logger *zap.Logger) *ExpiryNotifier {
+	return &ExpiryNotifier{
+		db:     db,
+		logger: logger,
+		client: netguard.NewClient(10 * time.Second),
+	}
+}
+
+// SetMailer emails the warnings to the owners of keys with m
+func (n *ExpiryNotifier) SetMailer(m mail.Sender) {
+	n.mailer = m
+}
+
+// SetSigningSecret signs the webhook payloads with secret, see package
+// webhooksig; an empty secret leaves them unsigned. It may be called while
+// the notifier runs, e.g. to rotate the secret.
+func (n *ExpiryNotifier) SetSigningSecret(secret string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.secret = []byte(secret)
+}
+
+// Run checks the keys every ExpiryCheckInterval until ctx is done
+func (n *ExpiryNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(ExpiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n.Check(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check marks the active keys past their expiry as expired and warns the
+// owners of keys due an expiry warning, returning how many were warned. A
+// warning that reaches neither the owner's email nor the webhook of the key is
+// tried again by the next check.
+func (n *ExpiryNotifier) Check(ctx context.Context, now time.Time) int {
+	db := n.db.WithContext(ctx)
+
+	keys, err := db.ListAPIKeys()
+	if err != nil {
+		n.logger.Error("apikey: failed to list API keys", zap.Error(err))
+		return 0
+	}
+
+	warned := 0
+	for _, k := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		if k.Status != "active" {
+			continue
+		}
+		if !now.Before(k.ExpiresAt) {
+			if err := db.SetAPIKeyStatus(k.APIKeyID, "expired"); err != nil {
+				n.logger.Error("apikey: failed to mark API key expired", zap.String("api_key_id", k.APIKeyID), zap.Error(err))
+				continue
+			}
+			n.logger.Info("API key expired", zap.String("api_key_id", k.APIKeyID), zap.String("user_id", k.UserID))
+			continue
+		}
+
+		days := warningDue(k, now)
+		if days == 0 {
+			continue
+		}
+		if !n.warn(ctx, db, k, now) {
+			continue
+		}
+		if err := db.SetAPIKeyExpiryNotice(k.APIKeyID, days); err != nil {
+			n.logger.Error("apikey: failed to record expiry warning", zap.String("api_key_id", k.APIKeyID), zap.Error(err))
+			continue
+		}
+		warned++
+	}
+	return warned
+}
+
+// warningDue returns the warning, in days before expiry, a key is due at now,
+// or 0 if it was sent already. A key entering several warnings at once, e.g.
+// created shortly before its expiry, gets the shortest only.
+func warningDue(k *database.APIKey, now time.Time) int {
+	left := k.ExpiresAt.Sub(now)
+	due := 0
+	for _, days := range ExpiryWarnings {
+		if left <= time.Duration(days)*24*time.Hour && (due == 0 || days < due) {
+			due = days
+		}
+	}
+	if due == 0 || (k.ExpiryNotice != 0 && k.ExpiryNotice <= due) {
+		return 0
+	}
+	return due
+}
+
+// warn emails the owner of a key and posts to its webhook, reporting whether
+// the warning is done with: delivered at least once, or with nowhere to go
+func (n *ExpiryNotifier) warn(ctx context.Context, db *database.DB, k *database.APIKey, now time.Time) bool {
+	daysLeft := int(math.Ceil(k.ExpiresAt.Sub(now).Hours() / 24))
+	attempted, delivered := 0, 0
+
+	if n.mailer != nil {
+		owner, err := db.GetUser(k.UserID)
+		if err != nil {
+			n.logger.Error("apikey: failed to get API key owner", zap.String("api_key_id", k.APIKeyID), zap.Error(err))
+			return false
+		}
+		if owner != nil && owner.Email != "" {
+			attempted++
+			subject := fmt.Sprintf("API key %q expires in %d days", k.Name, daysLeft)
+			body := fmt.Sprintf("Your API key %q (%s) expires on %s, in %d days.\n\n"+
+				"Requests made with it are refused from then on. Create a new key and\n"+
+				"replace it wherever it is used, e.g. in CI pipelines, before then.\n",
+				k.Name, k.APIKeyID, k.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"), daysLeft)
+			if err := n.mailer.Send(ctx, owner.Email, subject, body); err != nil {
+				n.logger.Warn("apikey: failed to email expiry warning", zap.String("api_key_id", k.APIKeyID), zap.Error(err))
+			} else {
+				delivered++
+			}
+		}
+	}
+
+	if k.NotifyURL != "" {
+		attempted++
+		payload := ExpiryPayload{Event: EventExpiring, ID: k.APIKeyID, Name: k.Name, ExpiresAt: k.ExpiresAt, DaysLeft: daysLeft}
+		if err := n.post(ctx, k.NotifyURL, payload); err != nil {
+			n.logger.Warn("apikey: failed to post expiry warning", zap.String("api_key_id", k.APIKeyID), zap.Error(err))
+		} else {
+			delivered++
+		}
+	}
+
+	if attempted > 0 && delivered > 0 {
+		n.logger.Info("API key expiry warning sent", zap.String("api_key_id", k.APIKeyID), zap.Int("days_left", daysLeft))
+	}
+	return attempted == 0 || delivered > 0
+}
+
+// post posts a JSON payload to a webhook, signed if a signing secret is set
+func (n *ExpiryNotifier) post(ctx context.Context, webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	n.mu.RLock()
+	if len(n.secret) > 0 {
+		webhooksig.SignRequest(req, n.secret, body)
+	}
+	n.mu.RUnlock()
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/netguard"
+	"github.com/finki/badges/pkg/webhooksig"
+	"go.uber.org/zap"
+)
+
+// fakeMailer records the emails sent, or fails with err
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []string
+	err  error
+}
+
+func (m *fakeMailer) Send(_ context.Context, to, subject, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, to+": "+subject)
+	return nil
+}
+
+func TestExpiryNotifier(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "expiry.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	var payloads []ExpiryPayload
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := webhooksig.VerifyRequest(r, []byte("whsec"), 0); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var p ExpiryPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		payloads = append(payloads, p)
+	}))
+	defer srv.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, k := range []*database.APIKey{
+		{APIKeyID: "ci", Name: "ci", ExpiresAt: now.Add(10 * 24 * time.Hour), NotifyURL: srv.URL},
+		{APIKeyID: "soon", Name: "soon", ExpiresAt: now.Add(2 * 24 * time.Hour)},
+		{APIKeyID: "later", Name: "later", ExpiresAt: now.Add(30 * 24 * time.Hour)},
+		{APIKeyID: "old", Name: "old", ExpiresAt: now.Add(-time.Hour)},
+	} {
+		k.UserID, k.APIKey, k.Permissions, k.CreatedAt, k.Status = admin.UserID, "hash", "{}", now, "active"
+		if err := db.CreateAPIKey(k); err != nil {
+			t.Fatalf("Failed to create API key: %v", err)
+		}
+	}
+
+	n := NewExpiryNotifier(db, logger)
+	n.client = srv.Client()
+	n.SetSigningSecret("whsec")
+	mailer := &fakeMailer{}
+	n.SetMailer(mailer)
+	ctx := context.Background()
+
+	// Keys within 14 days are warned once, those within 3 days only once too
+	if warned := n.Check(ctx, now); warned != 2 {
+		t.Errorf("expected two warnings, got %d", warned)
+	}
+	if len(mailer.sent) != 2 || len(payloads) != 1 || payloads[0].ID != "ci" || payloads[0].DaysLeft != 10 || payloads[0].Event != EventExpiring {
+		t.Errorf("expected emails for both keys and a webhook for ci, got %v and %+v", mailer.sent, payloads)
+	}
+	if k, _ := db.GetAPIKey("old"); k.Status != "expired" {
+		t.Errorf("expected the expired key to be marked, got %q", k.Status)
+	}
+	if warned := n.Check(ctx, now.Add(time.Hour)); warned != 0 {
+		t.Errorf("expected no warning twice, got %d", warned)
+	}
+
+	// The 3-day warning follows
+	if warned := n.Check(ctx, now.Add(7*24*time.Hour+time.Hour)); warned != 1 {
+		t.Errorf("expected the 3-day warning of ci, got %d", warned)
+	}
+	if k, _ := db.GetAPIKey("ci"); k.ExpiryNotice != 3 {
+		t.Errorf("expected the 3-day warning to be recorded, got %d", k.ExpiryNotice)
+	}
+
+	// Undelivered warnings are tried again
+	mailer.err = errors.New("relay down")
+	if warned := n.Check(ctx, now.Add(17*24*time.Hour)); warned != 0 {
+		t.Errorf("expected no warning to be delivered, got %d", warned)
+	}
+	mailer.err = nil
+	if warned := n.Check(ctx, now.Add(17*24*time.Hour+time.Hour)); warned != 1 {
+		t.Errorf("expected the later key to be warned once the relay is back, got %d", warned)
+	}
+
+	// Expired keys are refused as such
+	info := &auth.APIKeyInfo{Status: "expired", ExpiresAt: now}
+	if err := auth.CheckAPIKey(info, "192.0.2.1"); !errors.Is(err, auth.ErrAPIKeyExpired) {
+		t.Errorf("expected an expired key to be refused as expired, got %v", err)
+	}
+}
+
+func TestNotifyURLAddresses(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		url  string
+		want bool
+	}{
+		{"", true},
+		{"https://93.184.216.34/hooks/keys", true},
+		{"https://[2606:4700::1111]/hook", true},
+		{"http://93.184.216.34/hook", false},
+		{"https://127.0.0.1/hook", false},
+		{"https://localhost:8443/hook", false},
+		{"https://10.0.0.8/hook", false},
+		{"https://192.168.1.1/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://0.0.0.0/hook", false},
+		{"https://[::1]/hook", false},
+		{"https://[fe80::1]/hook", false},
+		{"https://[::ffff:127.0.0.1]/hook", false},
+	} {
+		if err := ValidateNotifyURL(ctx, tc.url); (err == nil) != tc.want {
+			t.Errorf("%q: expected accepted=%v, got %v", tc.url, tc.want, err)
+		}
+	}
+
+	// The address dialed is checked again when posting, whatever was saved
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the webhook on a loopback address not to be posted to")
+	}))
+	defer srv.Close()
+	n := NewExpiryNotifier(nil, zap.NewNop())
+	if err := n.post(ctx, srv.URL, ExpiryPayload{Event: EventExpiring}); !errors.Is(err, netguard.ErrPrivateAddress) {
+		t.Errorf("expected the post to a loopback address to be refused, got %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/finki/badges/internal/auth"
@@ -17,6 +18,11 @@ import (
 type Handler struct {
 	DB     *database.DB
 	Logger *zap.Logger
+	// usage counts the requests of keys not written to the database yet
+	usage *UsageTracker
+	// defaultQuota is the monthly quota of keys created without one; only
+	// callers allowed users:write may exceed it
+	defaultQuota int64
 }
 
 // NewHandler creates a new API key handler
@@ -27,6 +33,18 @@ func NewHandler(db *database.DB, logger *zap.Logger) *Handler {
 	}
 }
 
+// SetUsageTracker makes usage reports include the requests counted by t that
+// are not written to the database yet
+func (h *Handler) SetUsageTracker(t *UsageTracker) {
+	h.usage = t
+}
+
+// SetDefaultQuota sets the monthly quota of keys created without one; 0 leaves
+// them unlimited
+func (h *Handler) SetDefaultQuota(quota int64) {
+	h.defaultQuota = quota
+}
+
 // generateUniqueID generates a unique ID using crypto/rand
 func generateUniqueID() string {
 	// Generate 16 random bytes
@@ -46,12 +64,14 @@ type CreateAPIKeyRequest struct {
 	Name           string   `json:"name"`
 	ExpiresAt      string   `json:"expires_at,omitempty"`
 	IPRestrictions []string `json:"ip_restrictions,omitempty"`
-	Permissions    struct {
-		Badges struct {
-			Read  bool `json:"read"`
-			Write bool `json:"write"`
-		} `json:"badges"`
-	} `json:"permissions"`
+	Permissions    database.APIKeyPermissions `json:"permissions"`
+	// MonthlyQuota is the number of requests allowed per UTC calendar month,
+	// 0 for unlimited; omitted, new keys get the default quota and updated
+	// keys keep theirs
+	MonthlyQuota *int64 `json:"monthly_quota,omitempty"`
+	// NotifyURL is an https webhook warned before the key expires, along
+	// with the owner's email
+	NotifyURL string `json:"notify_url,omitempty"`
 }
 
 // APIKeyResponse represents an API key response
@@ -64,23 +84,26 @@ type APIKeyResponse struct {
 	LastUsed       time.Time `json:"last_used,omitempty"`
 	Status         string    `json:"status"`
 	IPRestrictions []string  `json:"ip_restrictions,omitempty"`
-	Permissions    struct {
-		Badges struct {
-			Read  bool `json:"read"`
-			Write bool `json:"write"`
-		} `json:"badges"`
-	} `json:"permissions"`
+	Permissions    database.APIKeyPermissions `json:"permissions"`
+	MonthlyQuota   int64     `json:"monthly_quota"`
+	NotifyURL      string    `json:"notify_url,omitempty"`
 }
 
 // CreateAPIKey handles the creation of a new API key
 func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	// An impersonation must not outlive its token
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil && claims.Impersonated() {
+		http.Error(w, "Impersonation tokens cannot create API keys", http.StatusForbidden)
+		return
+	}
+
 	// Parse request body
 	var req CreateAPIKeyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -94,6 +117,35 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.ValidatePermissions(req.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A key may not exceed the permissions of the caller, however they authenticated
+	for resource, actions := range req.Permissions {
+		for action, granted := range actions {
+			if granted && !auth.HasPermission(r.Context(), resource, action) {
+				http.Error(w, fmt.Sprintf("Cannot grant %s:%s", resource, action), http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	if err := ValidateNotifyURL(r.Context(), req.NotifyURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	monthlyQuota := h.defaultQuota
+	if req.MonthlyQuota != nil {
+		monthlyQuota = *req.MonthlyQuota
+	}
+	if status, err := h.checkQuota(r, monthlyQuota); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	// Generate API key
 	apiKey, err := auth.GenerateAPIKey()
 	if err != nil {
@@ -111,15 +163,7 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create API key permissions
-	permissions := &database.APIKeyPermissions{
-		Badges: struct {
-			Read  bool `json:"read"`
-			Write bool `json:"write"`
-		}{
-			Read:  req.Permissions.Badges.Read,
-			Write: req.Permissions.Badges.Write,
-		},
-	}
+	permissions := req.Permissions
 
 	// Parse expiration date
 	expiresAt := time.Now().AddDate(1, 0, 0) // Default: 1 year
@@ -132,13 +176,16 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 
 	// Create API key in database
 	dbAPIKey := &database.APIKey{
-		APIKeyID:  generateUniqueID(),
-		UserID:    claims.UserID,
-		APIKey:    hashedKey,
-		Name:      req.Name,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
-		Status:    "active",
+		APIKeyID:     generateUniqueID(),
+		UserID:       userID,
+		APIKey:       hashedKey,
+		Name:         req.Name,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+		Status:       "active",
+		MonthlyQuota: monthlyQuota,
+		NotifyURL:    req.NotifyURL,
+		LookupHash:   auth.APIKeyLookupHash(apiKey),
 	}
 
 	// Set permissions
@@ -156,7 +203,7 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save API key to database
-	if err := h.DB.CreateAPIKey(dbAPIKey); err != nil {
+	if err := h.DB.WithContext(r.Context()).CreateAPIKey(dbAPIKey); err != nil {
 		h.Logger.Error("Failed to create API key in database", zap.Error(err))
 		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
 		return
@@ -164,12 +211,14 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 
 	// Create response
 	resp := APIKeyResponse{
-		ID:        dbAPIKey.APIKeyID,
-		Name:      dbAPIKey.Name,
-		Key:       apiKey, // Include the raw key in the response
-		CreatedAt: dbAPIKey.CreatedAt,
-		ExpiresAt: dbAPIKey.ExpiresAt,
-		Status:    dbAPIKey.Status,
+		ID:           dbAPIKey.APIKeyID,
+		Name:         dbAPIKey.Name,
+		Key:          apiKey, // Include the raw key in the response
+		CreatedAt:    dbAPIKey.CreatedAt,
+		ExpiresAt:    dbAPIKey.ExpiresAt,
+		Status:       dbAPIKey.Status,
+		MonthlyQuota: dbAPIKey.MonthlyQuota,
+		NotifyURL:    dbAPIKey.NotifyURL,
 	}
 
 	// Get IP restrictions
@@ -181,8 +230,7 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Get permissions
 	dbPermissions, err := dbAPIKey.GetPermissions()
 	if err == nil {
-		resp.Permissions.Badges.Read = dbPermissions.Badges.Read
-		resp.Permissions.Badges.Write = dbPermissions.Badges.Write
+		resp.Permissions = dbPermissions
 	}
 
 	// Return response
@@ -194,14 +242,14 @@ func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 // ListAPIKeys handles listing all API keys for a user
 func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Get API keys from database
-	apiKeys, err := h.DB.ListAPIKeysByUser(claims.UserID)
+	apiKeys, err := h.DB.WithContext(r.Context()).ListAPIKeysByUser(userID)
 	if err != nil {
 		h.Logger.Error("Failed to list API keys", zap.Error(err))
 		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
@@ -211,18 +259,20 @@ func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	// Create response
 	var resp []APIKeyResponse
 	for _, apiKey := range apiKeys {
-		// Skip if API key is not active
-		if apiKey.Status != "active" {
+		// Skip revoked API keys; expired ones are listed as such
+		if apiKey.Status == "revoked" {
 			continue
 		}
 
 		// Create response item
 		item := APIKeyResponse{
-			ID:        apiKey.APIKeyID,
-			Name:      apiKey.Name,
-			CreatedAt: apiKey.CreatedAt,
-			ExpiresAt: apiKey.ExpiresAt,
-			Status:    apiKey.Status,
+			ID:           apiKey.APIKeyID,
+			Name:         apiKey.Name,
+			CreatedAt:    apiKey.CreatedAt,
+			ExpiresAt:    apiKey.ExpiresAt,
+			Status:       apiKey.Status,
+			MonthlyQuota: apiKey.MonthlyQuota,
+			NotifyURL:    apiKey.NotifyURL,
 		}
 
 		// Add last used if available
@@ -239,8 +289,7 @@ func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		// Get permissions
 		permissions, err := apiKey.GetPermissions()
 		if err == nil {
-			item.Permissions.Badges.Read = permissions.Badges.Read
-			item.Permissions.Badges.Write = permissions.Badges.Write
+			item.Permissions = permissions
 		}
 
 		resp = append(resp, item)
@@ -253,9 +302,11 @@ func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
 
 // RevokeAPIKey handles revoking an API key
 func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	db := h.DB.WithContext(r.Context())
+
 	// Get user ID from context
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -268,7 +319,7 @@ func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get API key from database
-	apiKey, err := h.DB.GetAPIKey(apiKeyID)
+	apiKey, err := db.GetAPIKey(apiKeyID)
 	if err != nil {
 		h.Logger.Error("Failed to get API key", zap.Error(err))
 		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
@@ -282,14 +333,14 @@ func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if API key belongs to user
-	if apiKey.UserID != claims.UserID {
+	if apiKey.UserID != userID {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Update API key status
 	apiKey.Status = "revoked"
-	if err := h.DB.UpdateAPIKey(apiKey); err != nil {
+	if err := db.UpdateAPIKey(apiKey); err != nil {
 		h.Logger.Error("Failed to update API key", zap.Error(err))
 		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
 		return
@@ -299,11 +350,106 @@ func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RotateAPIKey handles POST /api/keys/{id}/rotate, replacing the secret of a
+// key the caller owns. The new key is only included in this response; the
+// previous one stops working right away.
+func (h *Handler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	db := h.DB.WithContext(r.Context())
+
+	apiKeyID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/keys/"), "/rotate")
+	if !ok || apiKeyID == "" || strings.Contains(apiKeyID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// An impersonation must not outlive its token
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil && claims.Impersonated() {
+		http.Error(w, "Impersonation tokens cannot rotate API keys", http.StatusForbidden)
+		return
+	}
+
+	// Get API key from database
+	apiKey, err := db.GetAPIKey(apiKeyID)
+	if err != nil {
+		h.Logger.Error("Failed to get API key", zap.Error(err))
+		http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if API key exists and belongs to user
+	if apiKey == nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if apiKey.UserID != userID {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if apiKey.Status == "revoked" {
+		http.Error(w, "Revoked API keys cannot be rotated", http.StatusConflict)
+		return
+	}
+
+	// Generate and hash the new key
+	newKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		h.Logger.Error("Failed to generate API key", zap.Error(err))
+		http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+	hashedKey, err := auth.HashAPIKey(newKey)
+	if err != nil {
+		h.Logger.Error("Failed to hash API key", zap.Error(err))
+		http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.RotateAPIKey(apiKeyID, hashedKey, auth.APIKeyLookupHash(newKey)); err != nil {
+		h.Logger.Error("Failed to rotate API key in database", zap.Error(err))
+		http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+
+	// Create response
+	resp := APIKeyResponse{
+		ID:           apiKey.APIKeyID,
+		Name:         apiKey.Name,
+		Key:          newKey, // Include the raw key in the response
+		CreatedAt:    apiKey.CreatedAt,
+		ExpiresAt:    apiKey.ExpiresAt,
+		Status:       apiKey.Status,
+		MonthlyQuota: apiKey.MonthlyQuota,
+		NotifyURL:    apiKey.NotifyURL,
+	}
+	if ipRestrictions, err := apiKey.GetIPRestrictions(); err == nil {
+		resp.IPRestrictions = ipRestrictions
+	}
+	if dbPermissions, err := apiKey.GetPermissions(); err == nil {
+		resp.Permissions = dbPermissions
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // UpdateAPIKey handles updating an API key
 func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	db := h.DB.WithContext(r.Context())
+
 	// Get user ID from context
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -323,7 +469,7 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get API key from database
-	apiKey, err := h.DB.GetAPIKey(apiKeyID)
+	apiKey, err := db.GetAPIKey(apiKeyID)
 	if err != nil {
 		h.Logger.Error("Failed to get API key", zap.Error(err))
 		http.Error(w, "Failed to update API key", http.StatusInternalServerError)
@@ -337,7 +483,7 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if API key belongs to user
-	if apiKey.UserID != claims.UserID {
+	if apiKey.UserID != userID {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -350,27 +496,46 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Update expiration date
 	if req.ExpiresAt != "" {
 		parsedTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
-		if err == nil {
+		if err == nil && !parsedTime.Equal(apiKey.ExpiresAt) {
+			// The owner is warned again before the new expiry
 			apiKey.ExpiresAt = parsedTime
+			apiKey.ExpiryNotice = 0
+			if apiKey.Status == "expired" && time.Now().Before(parsedTime) {
+				apiKey.Status = "active"
+			}
 		}
 	}
 
+	// Update notify URL
+	if req.NotifyURL != "" {
+		if err := ValidateNotifyURL(r.Context(), req.NotifyURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		apiKey.NotifyURL = req.NotifyURL
+	}
+
 	// Update permissions
-	permissions := &database.APIKeyPermissions{
-		Badges: struct {
-			Read  bool `json:"read"`
-			Write bool `json:"write"`
-		}{
-			Read:  req.Permissions.Badges.Read,
-			Write: req.Permissions.Badges.Write,
-		},
+	if err := auth.ValidatePermissions(req.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	permissions := req.Permissions
 	if err := apiKey.SetPermissions(permissions); err != nil {
 		h.Logger.Error("Failed to set API key permissions", zap.Error(err))
 		http.Error(w, "Failed to update API key", http.StatusInternalServerError)
 		return
 	}
 
+	// Update monthly quota
+	if req.MonthlyQuota != nil {
+		if status, err := h.checkQuota(r, *req.MonthlyQuota); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		apiKey.MonthlyQuota = *req.MonthlyQuota
+	}
+
 	// Update IP restrictions
 	if err := apiKey.SetIPRestrictions(req.IPRestrictions); err != nil {
 		h.Logger.Error("Failed to set API key IP restrictions", zap.Error(err))
@@ -379,7 +544,7 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save API key to database
-	if err := h.DB.UpdateAPIKey(apiKey); err != nil {
+	if err := db.UpdateAPIKey(apiKey); err != nil {
 		h.Logger.Error("Failed to update API key in database", zap.Error(err))
 		http.Error(w, "Failed to update API key", http.StatusInternalServerError)
 		return
@@ -387,11 +552,13 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 
 	// Create response
 	resp := APIKeyResponse{
-		ID:        apiKey.APIKeyID,
-		Name:      apiKey.Name,
-		CreatedAt: apiKey.CreatedAt,
-		ExpiresAt: apiKey.ExpiresAt,
-		Status:    apiKey.Status,
+		ID:           apiKey.APIKeyID,
+		Name:         apiKey.Name,
+		CreatedAt:    apiKey.CreatedAt,
+		ExpiresAt:    apiKey.ExpiresAt,
+		Status:       apiKey.Status,
+		MonthlyQuota: apiKey.MonthlyQuota,
+		NotifyURL:    apiKey.NotifyURL,
 	}
 
 	// Add last used if available
@@ -408,11 +575,143 @@ func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Get permissions
 	dbPermissions, err := apiKey.GetPermissions()
 	if err == nil {
-		resp.Permissions.Badges.Read = dbPermissions.Badges.Read
-		resp.Permissions.Badges.Write = dbPermissions.Badges.Write
+		resp.Permissions = dbPermissions
 	}
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
-}
\ No newline at end of file
+}
+// checkQuota returns the status and error refusing a monthly quota: negative,
+// or above the default quota for callers not allowed users:write
+func (h *Handler) checkQuota(r *http.Request, quota int64) (int, error) {
+	if quota < 0 {
+		return http.StatusBadRequest, fmt.Errorf("Invalid monthly quota %d", quota)
+	}
+	if h.defaultQuota > 0 && (quota == 0 || quota > h.defaultQuota) && !auth.HasPermission(r.Context(), "users", "write") {
+		return http.StatusForbidden, fmt.Errorf("Cannot exceed the monthly quota of %d requests", h.defaultQuota)
+	}
+	return 0, nil
+}
+
+// UsageResponse is the usage of an API key over a period and this month
+type UsageResponse struct {
+	ID           string                  `json:"id"`
+	From         string                  `json:"from"`
+	To           string                  `json:"to"`
+	Days         []*database.APIKeyUsage `json:"days"`
+	Total        database.APIKeyUsage    `json:"total"`
+	Month        database.APIKeyUsage    `json:"month"`
+	MonthlyQuota int64                   `json:"monthly_quota"`
+	// Remaining is the number of requests left this month; omitted for
+	// unlimited keys
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+// Usage handles GET /api/keys/{id}/usage, reporting the requests made with a
+// key and the bytes served per UTC day from ?from= until ?to= (YYYY-MM-DD,
+// by default the last 30 days). Owners see their keys; callers allowed
+// users:read see any key.
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	db := h.DB.WithContext(r.Context())
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	apiKeyID, ok := strings.CutSuffix(rest, "/usage")
+	if !ok || apiKeyID == "" || strings.Contains(apiKeyID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the period
+	now := time.Now().UTC()
+	to := now
+	from := now.AddDate(0, 0, -29)
+	var err error
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = to.AddDate(0, 0, -29)
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "The from date must not be after the to date", http.StatusBadRequest)
+		return
+	}
+
+	// Get API key from database
+	apiKey, err := db.GetAPIKey(apiKeyID)
+	if err != nil {
+		h.Logger.Error("Failed to get API key", zap.Error(err))
+		http.Error(w, "Failed to get API key usage", http.StatusInternalServerError)
+		return
+	}
+	if apiKey == nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if apiKey.UserID != userID && !auth.HasPermission(r.Context(), "users", "read") {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Include the requests counted since the last flush
+	if err := h.usage.Flush(r.Context()); err != nil {
+		h.Logger.Warn("Failed to write API key usage", zap.Error(err))
+	}
+
+	resp := UsageResponse{
+		ID:           apiKey.APIKeyID,
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		Days:         []*database.APIKeyUsage{},
+		MonthlyQuota: apiKey.MonthlyQuota,
+	}
+	days, err := db.ListAPIKeyUsage(apiKey.APIKeyID, resp.From, resp.To)
+	if err != nil {
+		h.Logger.Error("Failed to list API key usage", zap.Error(err))
+		http.Error(w, "Failed to get API key usage", http.StatusInternalServerError)
+		return
+	}
+	if days != nil {
+		resp.Days = days
+	}
+	for _, d := range days {
+		resp.Total.Requests += d.Requests
+		resp.Total.Bytes += d.Bytes
+	}
+	month, err := db.SumAPIKeyUsage(apiKey.APIKeyID, now.Format("2006-01")+"-01")
+	if err != nil {
+		h.Logger.Error("Failed to sum API key usage", zap.Error(err))
+		http.Error(w, "Failed to get API key usage", http.StatusInternalServerError)
+		return
+	}
+	resp.Month = *month
+	if apiKey.MonthlyQuota > 0 {
+		remaining := apiKey.MonthlyQuota - month.Requests
+		if remaining < 0 {
+			remaining = 0
+		}
+		resp.Remaining = &remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,207 @@
+package apikey
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestCreateAPIKeyPermissions(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "keys.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	issuerRole, err := db.GetRoleByName("issuer")
+	if err != nil || issuerRole == nil {
+		t.Fatalf("Expected the issuer role, err: %v", err)
+	}
+	issuer := &database.User{UserID: "issuer-id", Username: "issuer", Email: "issuer@example.org", PasswordHash: "hash",
+		RoleID: issuerRole.RoleID, Status: "active", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := db.CreateUser(issuer); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	permissions, err := auth.ResolvePermissions(db, issuerRole)
+	if err != nil {
+		t.Fatalf("Failed to resolve permissions: %v", err)
+	}
+
+	h := NewHandler(db, logger)
+	create := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(body))
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{UserID: issuer.UserID, Permissions: permissions}))
+		rec := httptest.NewRecorder()
+		h.CreateAPIKey(rec, r)
+		return rec
+	}
+
+	// Logged-in callers cannot grant more than they hold either
+	for _, body := range []string{
+		`{"name":"everything","permissions":{"*":{"*":true}}}`,
+		`{"name":"users","permissions":{"users":{"write":true}}}`,
+	} {
+		if rec := create(body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	rec := create(`{"name":"ci","permissions":{"badges":{"read":true,"write":true}}}`)
+	var resp APIKeyResponse
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("expected the key to be created, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Validated keys are limited to their owner's current role
+	validate := auth.GetAPIKeyValidator(db)
+	info, err := validate(resp.Key)
+	if err != nil || info == nil || !info.Permissions.Allows("badges", "write") {
+		t.Fatalf("expected the key to write badges, got %+v (err %v)", info, err)
+	}
+	viewerRole, _ := db.GetRoleByName("viewer")
+	issuer.RoleID = viewerRole.RoleID
+	if err := db.UpdateUser(issuer); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	info, err = validate(resp.Key)
+	if err != nil || info == nil || info.Permissions.Allows("badges", "write") || !info.Permissions.Allows("badges", "read") {
+		t.Errorf("expected the key to only read badges after the owner was demoted, got %+v (err %v)", info, err)
+	}
+	issuer.Status = "locked"
+	if err := db.UpdateUser(issuer); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if info, err := validate(resp.Key); err != nil || info != nil {
+		t.Errorf("expected the key of a locked owner to be refused, got %+v (err %v)", info, err)
+	}
+}
+
+func TestAPIKeyLookup(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "keys.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+
+	// A key created before lookup hashes is found once and indexed
+	raw, _ := auth.GenerateAPIKey()
+	hash, err := auth.HashAPIKey(raw)
+	if err != nil {
+		t.Fatalf("Failed to hash key: %v", err)
+	}
+	if err := db.CreateAPIKey(&database.APIKey{APIKeyID: "legacy-id", UserID: admin.UserID, APIKey: hash, Name: "legacy",
+		Permissions: `{"badges":{"read":true}}`, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active"}); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	validate := auth.GetAPIKeyValidator(db)
+	if info, err := validate(raw); err != nil || info == nil || info.ID != "legacy-id" {
+		t.Fatalf("expected the legacy key, got %+v (err %v)", info, err)
+	}
+	if k, _ := db.GetAPIKeyByLookupHash(auth.APIKeyLookupHash(raw)); k == nil || k.APIKeyID != "legacy-id" {
+		t.Errorf("expected the legacy key to be indexed, got %+v", k)
+	}
+	if info, err := validate(raw); err != nil || info == nil || info.ID != "legacy-id" {
+		t.Errorf("expected the indexed key, got %+v (err %v)", info, err)
+	}
+
+	// A stored lookup hash still needs the matching bcrypt hash
+	other, _ := auth.GenerateAPIKey()
+	if err := db.CreateAPIKey(&database.APIKey{APIKeyID: "forged-id", UserID: admin.UserID, APIKey: hash, Name: "forged",
+		Permissions: `{}`, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active", LookupHash: auth.APIKeyLookupHash(other)}); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if info, err := validate(other); err != nil || info != nil {
+		t.Errorf("expected a key not matching its bcrypt hash to be refused, got %+v (err %v)", info, err)
+	}
+}
+
+func TestCreateAPIKeyImpersonation(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "keys.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	h := NewHandler(db, logger)
+
+	// A key minted while impersonating would outlive the impersonation
+	r := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name":"ci","permissions":{"badges":{"read":true}}}`))
+	r = r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{UserID: "user-id", Actor: &auth.Actor{UserID: "admin-id"}}))
+	rec := httptest.NewRecorder()
+	if h.CreateAPIKey(rec, r); rec.Code != http.StatusForbidden {
+		t.Errorf("expected an impersonation to be refused, got %d", rec.Code)
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "keys.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+
+	raw, _ := auth.GenerateAPIKey()
+	hash, err := auth.HashAPIKey(raw)
+	if err != nil {
+		t.Fatalf("Failed to hash key: %v", err)
+	}
+	if err := db.CreateAPIKey(&database.APIKey{APIKeyID: "rotate-id", UserID: admin.UserID, APIKey: hash, Name: "ci",
+		Permissions: `{"badges":{"read":true}}`, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active",
+		LookupHash: auth.APIKeyLookupHash(raw)}); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	validate := auth.GetAPIKeyValidator(db)
+	if info, err := validate(raw); err != nil || info == nil {
+		t.Fatalf("expected the key to be valid, got %+v (err %v)", info, err)
+	}
+
+	h := NewHandler(db, logger)
+	rotate := func(path, userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{UserID: userID}))
+		rec := httptest.NewRecorder()
+		h.RotateAPIKey(rec, r)
+		return rec
+	}
+	if rec := rotate("/api/keys/rotate-id/rotate", "other-id"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected another user's key to be refused, got %d", rec.Code)
+	}
+	if rec := rotate("/api/keys/missing/rotate", admin.UserID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a missing key to be 404, got %d", rec.Code)
+	}
+
+	rec := rotate("/api/keys/rotate-id/rotate", admin.UserID)
+	var resp APIKeyResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Key == "" || resp.Key == raw {
+		t.Fatalf("expected a new key, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// The old secret stops working at once, even though it was verified before
+	if info, err := validate(raw); err != nil || info != nil {
+		t.Errorf("expected the old key to be refused, got %+v (err %v)", info, err)
+	}
+	if info, err := validate(resp.Key); err != nil || info == nil || info.ID != "rotate-id" || !info.Permissions.Allows("badges", "read") {
+		t.Errorf("expected the new key to keep the ID and permissions, got %+v (err %v)", info, err)
+	}
+	if events, _ := db.ListEvents(database.EventQuery{Types: []string{database.EventKeyRotated}, Limit: 10}); len(events) != 1 || events[0].SubjectID != "rotate-id" {
+		t.Errorf("expected one key.rotated event, got %+v", events)
+	}
+}
@@ -0,0 +1,220 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// UsageFlushInterval is how often API key usage is written to the database
+const UsageFlushInterval = time.Minute
+
+// usageKey identifies the usage of an API key on a day
+type usageKey struct {
+	day      string
+	apiKeyID string
+}
+
+// monthUsage is the number of requests made with a key in a month
+type monthUsage struct {
+	month    string
+	requests int64
+}
+
+// UsageTracker counts the requests made with API keys and the bytes of the
+// responses, per key and UTC day, and rejects the requests of keys past their
+// monthly quota. Counts are kept in memory and added to the database
+// periodically, like badge statistics.
+type UsageTracker struct {
+	db      *database.DB
+	logger  *zap.Logger
+	now     func() time.Time
+	mu      sync.Mutex
+	pending map[usageKey]*database.APIKeyUsage
+	// months holds the requests of keys this month as read from the database
+	// after the last flush, with those counted since
+	months map[string]*monthUsage
+}
+
+// NewUsageTracker creates a tracker writing to db
+func NewUsageTracker(db *database.DB, logger *zap.Logger) *UsageTracker {
+	return &UsageTracker{
+		db:      db,
+		logger:  logger,
+		now:     time.Now,
+		pending: map[usageKey]*database.APIKeyUsage{},
+		months:  map[string]*monthUsage{},
+	}
+}
+
+// Middleware counts the requests made with an API key, answering those past
+// the key's monthly quota with 429 Too Many Requests until the next month.
+// Requests without an API key are passed on as they are.
+func (t *UsageTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := auth.GetAPIKeyInfoFromContext(r.Context())
+		if key == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := t.now().UTC()
+
+		if key.MonthlyQuota > 0 {
+			used, err := t.monthRequests(r.Context(), key.ID, now)
+			if err != nil {
+				// Requests are let through rather than failing with the database
+				t.logger.Error("apikey: failed to get usage", zap.String("api_key_id", key.ID), zap.Error(err))
+			} else {
+				remaining := key.MonthlyQuota - used
+				w.Header().Set("X-Quota-Limit", strconv.FormatInt(key.MonthlyQuota, 10))
+				if remaining <= 0 {
+					reset := nextMonth(now)
+					w.Header().Set("X-Quota-Remaining", "0")
+					w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+					w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+					http.Error(w, "Monthly API key quota exceeded", http.StatusTooManyRequests)
+					return
+				}
+				w.Header().Set("X-Quota-Remaining", strconv.FormatInt(remaining-1, 10))
+			}
+		}
+
+		t.add(key.ID, now, 1, 0)
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		t.add(key.ID, now, 0, cw.bytes)
+	})
+}
+
+// monthRequests returns the requests made with a key in the month of now
+func (t *UsageTracker) monthRequests(ctx context.Context, apiKeyID string, now time.Time) (int64, error) {
+	month := now.Format("2006-01")
+	t.mu.Lock()
+	m, ok := t.months[apiKeyID]
+	t.mu.Unlock()
+	if ok && m.month == month {
+		return m.requests, nil
+	}
+
+	stored, err := t.db.WithContext(ctx).SumAPIKeyUsage(apiKeyID, month+"-01")
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	requests := stored.Requests
+	for k, u := range t.pending {
+		if k.apiKeyID == apiKeyID && k.day >= month+"-01" {
+			requests += u.Requests
+		}
+	}
+	t.months[apiKeyID] = &monthUsage{month: month, requests: requests}
+	return requests, nil
+}
+
+// add adds to the usage of a key on the day of now
+func (t *UsageTracker) add(apiKeyID string, now time.Time, requests, bytes int64) {
+	k := usageKey{day: now.Format("2006-01-02"), apiKeyID: apiKeyID}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.pending[k]
+	if !ok {
+		u = &database.APIKeyUsage{Day: k.day, APIKeyID: apiKeyID}
+		t.pending[k] = u
+	}
+	u.Requests += requests
+	u.Bytes += bytes
+	if m, ok := t.months[apiKeyID]; ok && m.month == now.Format("2006-01") {
+		m.requests += requests
+	}
+}
+
+// Flush writes the usage counted so far to the database. Counts that cannot
+// be written are kept for the next flush. Monthly totals are read again
+// afterwards, so that the requests made through other processes count
+// towards quotas too.
+func (t *UsageTracker) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = map[usageKey]*database.APIKeyUsage{}
+	t.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	usage := make([]*database.APIKeyUsage, 0, len(pending))
+	for _, u := range pending {
+		usage = append(usage, u)
+	}
+	if err := t.db.WithContext(ctx).AddAPIKeyUsage(usage); err != nil {
+		t.mu.Lock()
+		for k, u := range pending {
+			if c, ok := t.pending[k]; ok {
+				u.Requests += c.Requests
+				u.Bytes += c.Bytes
+			}
+			t.pending[k] = u
+		}
+		t.mu.Unlock()
+		return err
+	}
+
+	t.mu.Lock()
+	t.months = map[string]*monthUsage{}
+	t.mu.Unlock()
+	return nil
+}
+
+// Run flushes the usage every UsageFlushInterval until ctx is done; the last
+// counts are left for a final Flush once the server has stopped
+func (t *UsageTracker) Run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	ticker := time.NewTicker(UsageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Error("apikey: failed to write usage", zap.Error(err))
+			}
+		}
+	}
+}
+
+// nextMonth returns the start of the UTC month after t
+func nextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// countingWriter counts the bytes of a response body
+type countingWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
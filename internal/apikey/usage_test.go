@@ -0,0 +1,162 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestUsageTracker(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "usage.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	tracker := NewUsageTracker(db, logger)
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	// Requests made through another process earlier this month
+	if err := db.AddAPIKeyUsage([]*database.APIKeyUsage{{Day: "2026-03-02", APIKeyID: "key-id", Requests: 2}}); err != nil {
+		t.Fatalf("AddAPIKeyUsage: %v", err)
+	}
+
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	key := &auth.APIKeyInfo{ID: "key-id", MonthlyQuota: 3}
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/badges", nil)
+		r = r.WithContext(auth.AddAPIKeyToContext(r.Context(), key))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := request(); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "0" {
+		t.Fatalf("expected the last request of the quota, got %d %q", rec.Code, rec.Header().Get("X-Quota-Remaining"))
+	}
+	rec := request()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3601" {
+		t.Errorf("expected the quota to be exceeded until April, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if err := tracker.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if days, err := db.ListAPIKeyUsage("key-id", "2026-03-31", "2026-03-31"); err != nil || len(days) != 1 || days[0].Requests != 1 || days[0].Bytes != 5 {
+		t.Errorf("expected the served request to be written, got %+v (err %v)", days, err)
+	}
+
+	// A new month starts over
+	now = now.Add(2 * time.Hour)
+	if rec := request(); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "2" {
+		t.Errorf("expected the quota to reset in April, got %d %q", rec.Code, rec.Header().Get("X-Quota-Remaining"))
+	}
+
+	// Unlimited keys are counted too
+	key = &auth.APIKeyInfo{ID: "other-id"}
+	if rec := request(); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("expected no quota headers for an unlimited key, got %v", rec.Header())
+	}
+	if err := tracker.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if total, err := db.SumAPIKeyUsage("other-id", "2026-04-01"); err != nil || total.Requests != 1 {
+		t.Errorf("expected the unlimited key to be counted, got %+v (err %v)", total, err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "usage.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	if err := db.CreateAPIKey(&database.APIKey{APIKeyID: "key-id", UserID: admin.UserID, APIKey: "hash", Name: "partner",
+		Permissions: "{}", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active", MonthlyQuota: 100}); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if err := db.AddAPIKeyUsage([]*database.APIKeyUsage{{Day: today, APIKeyID: "key-id", Requests: 4, Bytes: 40}}); err != nil {
+		t.Fatalf("AddAPIKeyUsage: %v", err)
+	}
+
+	h := NewHandler(db, logger)
+	tracker := NewUsageTracker(db, logger)
+	tracker.add("key-id", time.Now().UTC(), 1, 10)
+	h.SetUsageTracker(tracker)
+	usage := func(path, userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{UserID: userID}))
+		rec := httptest.NewRecorder()
+		h.Usage(rec, r)
+		return rec
+	}
+
+	rec := usage("/api/keys/key-id/usage", admin.UserID)
+	var resp UsageResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("expected the usage, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Days) != 1 || resp.Total.Requests != 5 || resp.Total.Bytes != 50 || resp.Month.Requests != 5 || resp.Remaining == nil || *resp.Remaining != 95 {
+		t.Errorf("expected the stored and pending usage, got %+v", resp)
+	}
+
+	for _, tc := range []struct {
+		path, userID string
+		status       int
+	}{
+		{"/api/keys/key-id/usage?from=2026-13-01", admin.UserID, http.StatusBadRequest},
+		{"/api/keys/key-id/usage?from=2026-03-02&to=2026-03-01", admin.UserID, http.StatusBadRequest},
+		{"/api/keys/missing/usage", admin.UserID, http.StatusNotFound},
+		{"/api/keys/key-id", admin.UserID, http.StatusNotFound},
+		{"/api/keys/key-id/usage", "someone-else", http.StatusUnauthorized},
+	} {
+		if rec := usage(tc.path, tc.userID); rec.Code != tc.status {
+			t.Errorf("%s as %s: expected %d, got %d", tc.path, tc.userID, tc.status, rec.Code)
+		}
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	h := NewHandler(nil, zap.NewNop())
+	h.SetDefaultQuota(1000)
+	issuer := &auth.Claims{Permissions: database.Permissions{"api_keys": {"write": true}}}
+	admin := &auth.Claims{Permissions: database.Permissions{"*": {"*": true}}}
+
+	for _, tc := range []struct {
+		claims *auth.Claims
+		quota  int64
+		status int
+	}{
+		{issuer, 500, 0},
+		{issuer, 1000, 0},
+		{issuer, 1001, http.StatusForbidden},
+		{issuer, 0, http.StatusForbidden},
+		{issuer, -1, http.StatusBadRequest},
+		{admin, 0, 0},
+		{admin, 5000, 0},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/keys", nil)
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), tc.claims))
+		if status, _ := h.checkQuota(r, tc.quota); status != tc.status {
+			t.Errorf("quota %d: expected %d, got %d", tc.quota, tc.status, status)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package assets provides the HTML and SVG templates and static files of the
+// service. They are embedded in the binary; a directory set with SetDir
+// overrides them file by file, so that an instance can customize a page or
+// stylesheet without rebuilding.
+//
+// HTML pages are parsed along with the shared layouts under
+// templates/layouts/ and partials under templates/partials/, and can use the
+// functions of funcs.go. A page built on the base layout only defines its
+// blocks:
+//
+//	{{ template "base" . }}
+//	{{ define "title" }}{{ .Name }} – Issuer{{ end }}
+//	{{ define "content" }}...{{ end }}
+package assets
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/finki/badges"
+)
+
+var (
+	templates = sub(badges.Files, "templates")
+	static    = sub(badges.Files, "static")
+
+	// reload makes templates check their file on every use
+	reload atomic.Bool
+)
+
+// SetDir makes the templates and static files under dir/templates and
+// dir/static take precedence over the embedded ones. It is called once at
+// startup, before any handler loads its templates.
+func SetDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid assets directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid assets directory: %s is not a directory", dir)
+	}
+	templates = overlay{top: os.DirFS(filepath.Join(dir, "templates")), base: sub(badges.Files, "templates")}
+	static = overlay{top: os.DirFS(filepath.Join(dir, "static")), base: sub(badges.Files, "static")}
+	return nil
+}
+
+// Templates returns the templates directory
+func Templates() fs.FS {
+	return templates
+}
+
+// Static returns the static files directory
+func Static() fs.FS {
+	return static
+}
+
+// SetReload makes templates parsed again when their file changes, for
+// development. Embedded files never change, so it is used along with SetDir.
+func SetReload(enabled bool) {
+	reload.Store(enabled)
+}
+
+// shared are the layouts and partials every page is parsed with
+var shared = []string{"layouts/*.html", "partials/*.html"}
+
+// Template is an HTML template parsed from a file under templates/, along
+// with the shared layouts and partials
+type Template struct {
+	name string
+
+	mu      sync.Mutex
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+// ParseTemplate parses an HTML template by its path under templates/, e.g.
+// "details/details.html"
+func ParseTemplate(name string) (*Template, error) {
+	t := &Template{name: name}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Execute applies the template to data, first parsing it again if reloading
+// is enabled and its file changed. A template that no longer parses returns
+// the parse error, so that it shows up while editing.
+func (t *Template) Execute(w io.Writer, data any) error {
+	t.mu.Lock()
+	if reload.Load() {
+		if modTime, err := t.latestModTime(); err == nil && !modTime.Equal(t.modTime) {
+			if err := t.parse(); err != nil {
+				t.mu.Unlock()
+				return err
+			}
+		}
+	}
+	tmpl := t.tmpl
+	t.mu.Unlock()
+	return tmpl.Execute(w, data)
+}
+
+// parse parses the template file and records its modification time
+func (t *Template) parse() error {
+	modTime, err := t.latestModTime()
+	if err != nil {
+		return err
+	}
+	// The page is parsed last, so that its blocks replace the layout's
+	tmpl, err := template.New(path.Base(t.name)).Funcs(funcs).ParseFS(templates, append(shared, t.name)...)
+	if err != nil {
+		return err
+	}
+	t.tmpl, t.modTime = tmpl, modTime
+	return nil
+}
+
+// latestModTime returns the last modification time of the page and the
+// shared templates, so that editing a layout reloads every page
+func (t *Template) latestModTime() (time.Time, error) {
+	names := []string{t.name}
+	for _, pattern := range shared {
+		matches, err := fs.Glob(templates, pattern)
+		if err != nil {
+			return time.Time{}, err
+		}
+		names = append(names, matches...)
+	}
+
+	var latest time.Time
+	for _, name := range names {
+		info, err := fs.Stat(templates, name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ReadTemplate returns the content of a template file, e.g.
+// "svg/big-template.svg"
+func ReadTemplate(name string) ([]byte, error) {
+	return fs.ReadFile(templates, name)
+}
+
+// sub returns a subdirectory of the embedded files
+func sub(fsys fs.FS, dir string) fs.FS {
+	s, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// overlay serves the files of top, falling back to base for the files top
+// does not have; directories list the entries of both
+type overlay struct {
+	top, base fs.FS
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.base.Open(name)
+}
+
+func (o overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	top, topErr := fs.ReadDir(o.top, name)
+	base, baseErr := fs.ReadDir(o.base, name)
+	if topErr != nil && baseErr != nil {
+		return nil, baseErr
+	}
+
+	entries := map[string]fs.DirEntry{}
+	for _, e := range base {
+		entries[e.Name()] = e
+	}
+	for _, e := range top {
+		entries[e.Name()] = e
+	}
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
@@ -0,0 +1,152 @@
+package assets
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbedded(t *testing.T) {
+	if _, err := ParseTemplate("details/details.html"); err != nil {
+		t.Errorf("ParseTemplate: %v", err)
+	}
+	if svg, err := ReadTemplate("svg/big-template.svg"); err != nil || len(svg) == 0 {
+		t.Errorf("ReadTemplate: %v", err)
+	}
+	if _, err := fs.Stat(Static(), "favicon.ico"); err != nil {
+		t.Errorf("expected the embedded favicon: %v", err)
+	}
+}
+
+func TestSetDir(t *testing.T) {
+	defer func(t, s fs.FS) { templates, static = t, s }(templates, static)
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates", "home"), 0755)
+	os.WriteFile(filepath.Join(dir, "templates", "home", "index.html"), []byte("custom home"), 0644)
+	os.MkdirAll(filepath.Join(dir, "static", "css"), 0755)
+	os.WriteFile(filepath.Join(dir, "static", "css", "custom.css"), []byte("body {}"), 0644)
+
+	if err := SetDir(dir); err != nil {
+		t.Fatalf("SetDir: %v", err)
+	}
+	if data, _ := fs.ReadFile(Templates(), "home/index.html"); string(data) != "custom home" {
+		t.Errorf("expected the overriding template, got %.40q", data)
+	}
+	if _, err := ParseTemplate("details/details.html"); err != nil {
+		t.Errorf("expected embedded templates without an override: %v", err)
+	}
+
+	entries, err := fs.ReadDir(Static(), "css")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	if !names["custom.css"] || len(names) < 2 {
+		t.Errorf("expected embedded and overriding stylesheets, got %v", names)
+	}
+
+	if err := SetDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer func(t, s fs.FS) { templates, static = t, s }(templates, static)
+	defer SetReload(false)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "templates", "page.html")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	write := func(content string, age time.Duration) {
+		os.WriteFile(path, []byte(content), 0644)
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+	}
+	render := func(tmpl *Template) (string, error) {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, "data")
+		return buf.String(), err
+	}
+
+	write("first {{.}}", time.Hour)
+	if err := SetDir(dir); err != nil {
+		t.Fatalf("SetDir: %v", err)
+	}
+	tmpl, err := ParseTemplate("page.html")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+
+	write("second {{.}}", time.Minute)
+	if out, _ := render(tmpl); out != "first data" {
+		t.Errorf("expected the template parsed at startup without reloading, got %q", out)
+	}
+
+	SetReload(true)
+	if out, err := render(tmpl); err != nil || out != "second data" {
+		t.Errorf("expected the changed template, got %q, %v", out, err)
+	}
+
+	write("broken {{.", 0)
+	if _, err := render(tmpl); err == nil {
+		t.Error("expected the parse error of the changed template")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	defer func(t, s fs.FS) { templates, static = t, s }(templates, static)
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates", "new"), 0755)
+	os.WriteFile(filepath.Join(dir, "templates", "new", "page.html"), []byte(`{{ template "base" . }}
+{{ define "title" }}New page{{ end }}
+{{ define "content" }}<p>{{ . }} on {{ date "2025-03-01T10:00:00Z" }}: {{ badgeURL "abc123" }}</p>{{ end }}`), 0644)
+	if err := SetDir(dir); err != nil {
+		t.Fatalf("SetDir: %v", err)
+	}
+
+	tmpl, err := ParseTemplate("new/page.html")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "hello"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>New page</title>",
+		"<h1>Software Licensing Certificates</h1>",
+		"<p>hello on 2025-03-01: https://certificates.software.geant.org/badge/abc123</p>",
+		`class="version-label"`,
+		"admin-nav.js",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	for in, want := range map[any]string{
+		"2025-01-02":           "2025-01-02",
+		"2025-01-02T15:04:05Z": "2025-01-02",
+		"2025-01-02 15:04:05":  "2025-01-02",
+		"soon":                 "soon",
+		time.Time{}:            "",
+		time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC): "2024-02-29",
+		42: "",
+	} {
+		if got := formatDate(in); got != want {
+			t.Errorf("formatDate(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
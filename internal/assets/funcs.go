@@ -0,0 +1,61 @@
+package assets
+
+import (
+	"database/sql"
+	"html/template"
+	"net/url"
+	"time"
+
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/version"
+)
+
+// funcs are the functions available to every HTML template
+var funcs = template.FuncMap{
+	// date formats a time.Time, sql.NullTime or a date string as YYYY-MM-DD;
+	// strings that are not dates are returned as they are
+	"date": formatDate,
+	// year is the current year, e.g. for copyright notices
+	"year": func() int { return time.Now().Year() },
+	// version and commit identify the running build
+	"version": func() string { return version.Info().Version },
+	"commit":  func() string { return version.Info().Commit },
+	// prefix is the path the service is served below, "" at the root; pages
+	// write root-relative links as {{ prefix }}/certificates
+	"prefix": links.Prefix,
+	// baseURL and the URL helpers give absolute links to a badge's pages
+	"baseURL":        links.Base,
+	"badgeURL":       func(id string) string { return links.Base() + "/badge/" + url.PathEscape(id) },
+	"certificateURL": func(id string) string { return links.Base() + "/certificate/" + url.PathEscape(id) },
+	"detailsURL":     func(id string) string { return links.Base() + "/details/" + url.PathEscape(id) },
+}
+
+// formatDate formats a date for display
+func formatDate(v any) string {
+	switch d := v.(type) {
+	case time.Time:
+		if d.IsZero() {
+			return ""
+		}
+		return d.Format(time.DateOnly)
+	case *time.Time:
+		if d == nil {
+			return ""
+		}
+		return formatDate(*d)
+	case sql.NullTime:
+		if !d.Valid {
+			return ""
+		}
+		return formatDate(d.Time)
+	case string:
+		for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t.Format(time.DateOnly)
+			}
+		}
+		return d
+	default:
+		return ""
+	}
+}
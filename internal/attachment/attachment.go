@@ -0,0 +1,103 @@
+// Package attachment validates and serves evidence documents attached to
+// badges during review, such as licence scans and SBOM reports.
+package attachment
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// MaxSize is the maximum size of an attachment in bytes
+const MaxSize = 10 << 20
+
+// maxFilenameLength is the maximum length of an attachment filename in characters
+const maxFilenameLength = 200
+
+// contentTypes maps the accepted file extensions to the content type they are
+// stored and served with
+var contentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".txt":  "text/plain; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".spdx": "text/plain; charset=utf-8",
+}
+
+// Extensions returns the accepted file extensions, sorted
+func Extensions() []string {
+	exts := make([]string, 0, len(contentTypes))
+	for ext := range contentTypes {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Validate checks the filename and content of an upload and returns the
+// sanitized filename and the content type to store. The content must match
+// its extension: binary formats by signature, text formats by being text.
+func Validate(filename string, content []byte) (string, string, error) {
+	name := filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == "/" {
+		return "", "", fmt.Errorf("filename is required")
+	}
+	if utf8.RuneCountInString(name) > maxFilenameLength {
+		return "", "", fmt.Errorf("filename must be at most %d characters", maxFilenameLength)
+	}
+	if len(content) == 0 {
+		return "", "", fmt.Errorf("file is empty")
+	}
+	if len(content) > MaxSize {
+		return "", "", fmt.Errorf("file exceeds the maximum size of %d MiB", MaxSize>>20)
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	contentType, ok := contentTypes[ext]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported file type %q: use one of %s", ext, strings.Join(Extensions(), ", "))
+	}
+
+	sniffed := http.DetectContentType(content)
+	switch ext {
+	case ".pdf", ".png", ".jpg", ".jpeg":
+		if sniffed != contentType {
+			return "", "", fmt.Errorf("file content does not match its %s extension", ext)
+		}
+	default:
+		if !strings.HasPrefix(sniffed, "text/") || !utf8.Valid(content) {
+			return "", "", fmt.Errorf("file content does not match its %s extension", ext)
+		}
+	}
+
+	return name, contentType, nil
+}
+
+// Write sends an attachment as a download. Attachments are never rendered
+// inline, so an uploaded document cannot run in the service's origin.
+func Write(w http.ResponseWriter, a *database.Attachment, content []byte) {
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(content)
+}
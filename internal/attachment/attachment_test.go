@@ -0,0 +1,59 @@
+package attachment
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+)
+
+func TestValidate(t *testing.T) {
+	pdf := []byte("%PDF-1.7\n1 0 obj\n")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	sbom := []byte(`{"bomFormat": "CycloneDX", "specVersion": "1.5"}`)
+
+	for _, tc := range []struct {
+		name, filename string
+		content        []byte
+		wantName       string
+		wantType       string
+		wantErr        string
+	}{
+		{"pdf", "licence.PDF", pdf, "licence.PDF", "application/pdf", ""},
+		{"png", "scan.png", png, "scan.png", "image/png", ""},
+		{"sbom", "bom.json", sbom, "bom.json", "application/json", ""},
+		{"path stripped", `C:\Users\alice\"report".txt`, []byte("ok"), "report.txt", "text/plain; charset=utf-8", ""},
+		{"unix path stripped", "../../etc/bom.xml", []byte("<bom/>"), "bom.xml", "application/xml", ""},
+		{"no name", " ", pdf, "", "", "filename is required"},
+		{"empty", "empty.pdf", nil, "", "", "file is empty"},
+		{"too large", "big.txt", bytes.Repeat([]byte("a"), MaxSize+1), "", "", "maximum size"},
+		{"unsupported", "tool.exe", []byte("MZ"), "", "", "unsupported file type"},
+		{"mislabelled binary", "scan.pdf", png, "", "", "does not match"},
+		{"binary as text", "bom.json", png, "", "", "does not match"},
+	} {
+		name, contentType, err := Validate(tc.filename, tc.content)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || name != tc.wantName || contentType != tc.wantType {
+			t.Errorf("%s: got %q, %q, %v; want %q, %q", tc.name, name, contentType, err, tc.wantName, tc.wantType)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, &database.Attachment{Filename: "Évidence.pdf", ContentType: "application/pdf"}, []byte("%PDF-"))
+
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename*=utf-8''%C3%89vidence.pdf" {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Body.String() != "%PDF-" {
+		t.Errorf("unexpected response %v %q", rec.Header(), rec.Body.String())
+	}
+}
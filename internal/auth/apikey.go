@@ -2,11 +2,13 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -54,6 +56,14 @@ func HashAPIKey(apiKey string) (string, error) {
 	return string(hashedBytes), nil
 }
 
+// APIKeyLookupHash returns the hex SHA-256 of an API key, stored as
+// database.APIKey.LookupHash to find the key's row before its bcrypt hash is
+// verified
+func APIKeyLookupHash(apiKey string) string {
+	digest := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(digest[:])
+}
+
 // VerifyAPIKey verifies an API key against a hash
 func VerifyAPIKey(hashedAPIKey, apiKey string) error {
 	// Validate API key format
@@ -73,6 +83,35 @@ func VerifyAPIKey(hashedAPIKey, apiKey string) error {
 	return nil
 }
 
+// lookupLegacy finds a key created before lookup hashes by comparing it to
+// the bcrypt hash of every key without one, and indexes it with lookupHash
+func lookupLegacy(db interface {
+	ListAPIKeys() ([]*database.APIKey, error)
+	SetAPIKeyLookupHash(apiKeyID, lookupHash string) error
+}, mu *sync.Mutex, apiKey, lookupHash string) (*database.APIKey, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	apiKeys, err := db.ListAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range apiKeys {
+		// Expired keys are still found, to be refused as such
+		if candidate.LookupHash != "" || (candidate.Status != "active" && candidate.Status != "expired") {
+			continue
+		}
+		if VerifyAPIKey(candidate.APIKey, apiKey) == nil {
+			if err := db.SetAPIKeyLookupHash(candidate.APIKeyID, lookupHash); err != nil {
+				return nil, err
+			}
+			candidate.LookupHash = lookupHash
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
 // ValidateIPRestriction checks if a client IP is allowed by the IP restrictions
 func ValidateIPRestriction(clientIP string, restrictions []string) bool {
 	// If no restrictions, allow all
@@ -113,35 +152,70 @@ func ValidateIPRestriction(clientIP string, restrictions []string) bool {
 	return false
 }
 
-// ConvertDBPermissionsToMap converts database APIKeyPermissions to a map
-func ConvertDBPermissionsToMap(permissions *database.APIKeyPermissions) map[string]map[string]bool {
-	if permissions == nil {
-		return map[string]map[string]bool{}
-	}
-
-	return map[string]map[string]bool{
-		"badges": {
-			"read":  permissions.Badges.Read,
-			"write": permissions.Badges.Write,
-		},
-	}
-}
-
-// GetAPIKeyValidator returns a function that validates API keys against the database
+// GetAPIKeyValidator returns a function that validates API keys against the database.
+// A key is found by its APIKeyLookupHash and verified against the bcrypt hash of that
+// one row; afterwards the match is remembered, so bcrypt runs once per key. Keys created
+// before lookup hashes are compared against every unindexed key, one request at a time,
+// and indexed once found.
+// Keys of owners who are no longer active are not found, and a key's permissions are
+// limited to those of its owner's current role.
 func GetAPIKeyValidator(db interface {
-	GetAPIKeyByKey(hashedKey string) (*database.APIKey, error)
+	GetAPIKey(apiKeyID string) (*database.APIKey, error)
+	GetAPIKeyByLookupHash(lookupHash string) (*database.APIKey, error)
+	SetAPIKeyLookupHash(apiKeyID, lookupHash string) error
+	ListAPIKeys() ([]*database.APIKey, error)
 	UpdateAPIKeyLastUsed(apiKeyID string, lastUsed time.Time) error
+	GetUser(userID string) (*database.User, error)
+	GetRole(roleID string) (*database.Role, error)
+	GetRoleByName(name string) (*database.Role, error)
 }) func(string) (*APIKeyInfo, error) {
+	var mu sync.Mutex
+	verified := make(map[string]string)
+	// legacy serializes the scans for keys without a lookup hash
+	var legacy sync.Mutex
+
+	lookup := func(apiKey string) (*database.APIKey, error) {
+		lookupHash := APIKeyLookupHash(apiKey)
+
+		mu.Lock()
+		apiKeyID, ok := verified[lookupHash]
+		mu.Unlock()
+		if ok {
+			// A rotated key no longer has the lookup hash of its old secret
+			k, err := db.GetAPIKey(apiKeyID)
+			if err != nil || k == nil || k.LookupHash == lookupHash {
+				return k, err
+			}
+			mu.Lock()
+			delete(verified, lookupHash)
+			mu.Unlock()
+			return nil, nil
+		}
+
+		candidate, err := db.GetAPIKeyByLookupHash(lookupHash)
+		if err != nil {
+			return nil, err
+		}
+		if candidate == nil {
+			return lookupLegacy(db, &legacy, apiKey, lookupHash)
+		}
+		if VerifyAPIKey(candidate.APIKey, apiKey) != nil {
+			return nil, nil
+		}
+		mu.Lock()
+		verified[lookupHash] = candidate.APIKeyID
+		mu.Unlock()
+		return candidate, nil
+	}
+
 	return func(apiKey string) (*APIKeyInfo, error) {
 		// Verify API key format
 		if !strings.HasPrefix(apiKey, APIKeyPrefix) {
 			return nil, ErrInvalidAPIKey
 		}
 
-		// Get API key from database by the raw key
-		// Note: In a real implementation, we would hash the key first
-		// but for simplicity, we're using the raw key for now
-		dbAPIKey, err := db.GetAPIKeyByKey(apiKey)
+		// Find the stored key matching the raw key
+		dbAPIKey, err := lookup(apiKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get API key: %w", err)
 		}
@@ -158,11 +232,27 @@ func GetAPIKeyValidator(db interface {
 		}
 
 		// Get permissions
-		dbPermissions, err := dbAPIKey.GetPermissions()
+		permissions, err := dbAPIKey.GetPermissions()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get permissions: %w", err)
 		}
-		permissions := ConvertDBPermissionsToMap(dbPermissions)
+
+		// A key acts within the organization of its owner
+		owner, err := db.GetUser(dbAPIKey.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key owner: %w", err)
+		}
+		if owner == nil || owner.Status != "active" {
+			return nil, nil
+		}
+
+		// A key grants no more than its owner's role does now, so that
+		// demoting the owner narrows their keys as well
+		ownerPermissions, err := rolePermissions(db, owner.RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key owner permissions: %w", err)
+		}
+		permissions = permissions.Intersect(ownerPermissions)
 
 		// Update last used timestamp
 		err = db.UpdateAPIKeyLastUsed(dbAPIKey.APIKeyID, time.Now())
@@ -179,6 +269,8 @@ func GetAPIKeyValidator(db interface {
 			ExpiresAt:      dbAPIKey.ExpiresAt,
 			IPRestrictions: ipRestrictions,
 			Permissions:    permissions,
+			OrgID:          owner.OrgID.String,
+			MonthlyQuota:   dbAPIKey.MonthlyQuota,
 		}
 
 		return apiKeyInfo, nil
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Authentication methods of a Principal
+const (
+	MethodBearer = "bearer"
+	MethodCookie = "cookie"
+	MethodAPIKey = "api_key"
+	// MethodCertificate is a client certificate verified by an mTLS listener
+	MethodCertificate = "client_certificate"
+)
+
+// Principal is the authenticated caller of a request, however it
+// authenticated. Exactly one of Claims and APIKey is set.
+type Principal struct {
+	// Method is how the caller authenticated: MethodBearer, MethodCookie,
+	// MethodAPIKey or MethodCertificate
+	Method string
+	// UserID is the user, or the owner of the API key
+	UserID string
+	// OrgID is the organization the caller is scoped to; "" for instance-wide
+	OrgID  string
+	Claims *Claims
+	APIKey *APIKeyInfo
+}
+
+const principalContextKey contextKey = "principal"
+
+// AddPrincipalToContext adds the principal to the request context, along with
+// its JWT claims or API key for GetClaimsFromContext and
+// GetAPIKeyInfoFromContext
+func AddPrincipalToContext(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, principalContextKey, p)
+	if p.Claims != nil {
+		ctx = AddClaimsToContext(ctx, p.Claims)
+	}
+	if p.APIKey != nil {
+		ctx = AddAPIKeyToContext(ctx, p.APIKey)
+	}
+	return ctx
+}
+
+// GetPrincipalFromContext returns the principal set by an Authenticator, or nil
+func GetPrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey).(*Principal)
+	return p
+}
+
+// Authenticator authenticates requests with, in this order, a client
+// certificate verified by the TLS listener, a Bearer token in the
+// Authorization header, the session cookie or an X-API-Key header. Invalid
+// credentials in a header are rejected; an invalid session cookie is cleared
+// and ignored, as browsers send it on every request.
+type Authenticator struct {
+	getAPIKey func(string) (*APIKeyInfo, error)
+	logger    *zap.Logger
+	// apiKeyMiddleware wraps the handling of requests made with an API key
+	apiKeyMiddleware func(http.Handler) http.Handler
+	// certificates maps verified client certificates to service accounts
+	certificates *CertificateAuth
+}
+
+// NewAuthenticator creates an authenticator looking up API keys with
+// getAPIKey, e.g. the validator of GetAPIKeyValidator
+func NewAuthenticator(getAPIKey func(string) (*APIKeyInfo, error)) *Authenticator {
+	return &Authenticator{getAPIKey: getAPIKey, logger: zap.NewNop()}
+}
+
+// SetLogger sets the logger recording requests made with impersonation tokens
+func (a *Authenticator) SetLogger(logger *zap.Logger) {
+	a.logger = logger
+}
+
+// SetAPIKeyMiddleware wraps the handling of requests authenticated with an API
+// key in mw, e.g. to meter them; the key is in the context mw is given
+func (a *Authenticator) SetAPIKeyMiddleware(mw func(http.Handler) http.Handler) {
+	a.apiKeyMiddleware = mw
+}
+
+// SetCertificateAuth authenticates requests made with a verified client
+// certificate as the service account it is mapped to. Certificates are only
+// verified by listeners configured for mutual TLS.
+func (a *Authenticator) SetCertificateAuth(c *CertificateAuth) {
+	a.certificates = c
+}
+
+// Optional adds the principal of authenticated requests to their context, and
+// passes anonymous requests on without one. Handlers or
+// RequirePermissionMiddleware decide what anonymous callers may do.
+func (a *Authenticator) Optional(next http.Handler) http.Handler {
+	return a.middleware(false, next)
+}
+
+// Required rejects anonymous requests with 401 Unauthorized
+func (a *Authenticator) Required(next http.Handler) http.Handler {
+	return a.middleware(true, next)
+}
+
+// middleware authenticates requests, rejecting anonymous ones if required
+func (a *Authenticator) middleware(required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, status, err := a.authenticate(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if p == nil {
+			if required {
+				http.Error(w, "Authentication required: Bearer token, session cookie or X-API-Key", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p.Claims != nil && p.Claims.Impersonated() {
+			a.logger.Info("Impersonated request",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("user_id", p.UserID),
+				zap.String("impersonator_id", p.Claims.Actor.UserID),
+				zap.String("impersonator", p.Claims.Actor.Username),
+			)
+		}
+		h := next
+		if p.APIKey != nil && a.apiKeyMiddleware != nil {
+			h = a.apiKeyMiddleware(next)
+		}
+		h.ServeHTTP(w, r.WithContext(AddPrincipalToContext(r.Context(), p)))
+	})
+}
+
+// authenticate returns the principal of r, nil for anonymous requests, or the
+// error and status rejecting invalid credentials
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) (*Principal, int, error) {
+	if cert := verifiedCertificate(r); cert != nil && a.certificates != nil {
+		claims, err := a.certificates.Claims(cert)
+		if errors.Is(err, ErrCertificateNotMapped) {
+			return nil, http.StatusForbidden, errors.New("Client certificate is not mapped to a service account")
+		}
+		if err != nil {
+			a.logger.Error("auth: failed to authenticate client certificate", zap.Error(err))
+			return nil, http.StatusInternalServerError, errors.New("Error validating client certificate")
+		}
+		return claimsPrincipal(MethodCertificate, claims), 0, nil
+	}
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, http.StatusUnauthorized, errors.New("Invalid authorization format, expected 'Bearer {token}'")
+		}
+		claims, err := ValidateToken(token)
+		if err != nil {
+			return nil, http.StatusUnauthorized, errors.New("Invalid or expired token")
+		}
+		touchSession(r, claims)
+		return claimsPrincipal(MethodBearer, claims), 0, nil
+	}
+
+	if c, err := r.Cookie(SessionCookie); err == nil && c.Value != "" {
+		if claims, err := ValidateToken(c.Value); err == nil {
+			touchSession(r, claims)
+			renewSession(w, r, claims)
+			return claimsPrincipal(MethodCookie, claims), 0, nil
+		}
+		ClearSessionCookie(w, r)
+	}
+
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		if a.getAPIKey == nil {
+			return nil, http.StatusUnauthorized, errors.New("API keys are not accepted")
+		}
+		apiKey, err := a.getAPIKey(key)
+		if errors.Is(err, ErrInvalidAPIKey) || (err == nil && apiKey == nil) {
+			return nil, http.StatusUnauthorized, errors.New("Invalid API key")
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("Error validating API key")
+		}
+		if err := CheckAPIKey(apiKey, clientIP(r)); err != nil {
+			if errors.Is(err, ErrIPNotAllowed) {
+				return nil, http.StatusForbidden, err
+			}
+			return nil, http.StatusUnauthorized, err
+		}
+		return &Principal{Method: MethodAPIKey, UserID: apiKey.UserID, OrgID: apiKey.OrgID, APIKey: apiKey}, 0, nil
+	}
+
+	return nil, 0, nil
+}
+
+// claimsPrincipal returns the principal of JWT claims
+func claimsPrincipal(method string, claims *Claims) *Principal {
+	return &Principal{Method: method, UserID: claims.UserID, OrgID: claims.OrgID, Claims: claims}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator(t *testing.T) {
+	getAPIKey := func(key string) (*APIKeyInfo, error) {
+		switch key {
+		case "good-key":
+			return &APIKeyInfo{ID: "key", UserID: "owner", OrgID: "org", Status: "active", ExpiresAt: time.Now().Add(time.Hour)}, nil
+		case "expired-key":
+			return &APIKeyInfo{ID: "old", Status: "active", ExpiresAt: time.Now().Add(-time.Hour)}, nil
+		}
+		return nil, ErrInvalidAPIKey
+	}
+	a := NewAuthenticator(getAPIKey)
+
+	token, _, err := GenerateToken("user", "alice", "alice@example.org", "admin", "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	var got *Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetPrincipalFromContext(r.Context())
+	})
+
+	for _, tc := range []struct {
+		name     string
+		bearer   string
+		cookie   string
+		apiKey   string
+		required bool
+		status   int
+		method   string
+		userID   string
+	}{
+		{name: "anonymous", status: http.StatusOK},
+		{name: "anonymous required", required: true, status: http.StatusUnauthorized},
+		{name: "bearer", bearer: "Bearer " + token, required: true, status: http.StatusOK, method: MethodBearer, userID: "user"},
+		{name: "cookie", cookie: token, required: true, status: http.StatusOK, method: MethodCookie, userID: "user"},
+		{name: "api key", apiKey: "good-key", required: true, status: http.StatusOK, method: MethodAPIKey, userID: "owner"},
+		{name: "bearer before api key", bearer: "Bearer " + token, apiKey: "good-key", status: http.StatusOK, method: MethodBearer, userID: "user"},
+		{name: "cookie before api key", cookie: token, apiKey: "bad-key", status: http.StatusOK, method: MethodCookie, userID: "user"},
+		{name: "invalid bearer", bearer: "Bearer nope", cookie: token, status: http.StatusUnauthorized},
+		{name: "malformed header", bearer: "Basic abc", status: http.StatusUnauthorized},
+		{name: "invalid cookie falls through", cookie: "nope", apiKey: "good-key", status: http.StatusOK, method: MethodAPIKey, userID: "owner"},
+		{name: "invalid cookie optional", cookie: "nope", status: http.StatusOK},
+		{name: "invalid api key", apiKey: "bad-key", status: http.StatusUnauthorized},
+		{name: "expired api key", apiKey: "expired-key", status: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			r := httptest.NewRequest(http.MethodGet, "/api/badges", nil)
+			if tc.bearer != "" {
+				r.Header.Set("Authorization", tc.bearer)
+			}
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookie, Value: tc.cookie})
+			}
+			if tc.apiKey != "" {
+				r.Header.Set("X-API-Key", tc.apiKey)
+			}
+			h := a.Optional(next)
+			if tc.required {
+				h = a.Required(next)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.method == "" {
+				if got != nil {
+					t.Errorf("expected no principal, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.Method != tc.method || got.UserID != tc.userID {
+				t.Fatalf("expected a %s principal for %s, got %+v", tc.method, tc.userID, got)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorContext(t *testing.T) {
+	a := NewAuthenticator(func(string) (*APIKeyInfo, error) {
+		return &APIKeyInfo{
+			ID: "key", UserID: "owner", OrgID: "org", Status: "active", ExpiresAt: time.Now().Add(time.Hour),
+			Permissions: map[string]map[string]bool{"badges": {"write": true}},
+		}, nil
+	})
+	h := a.Required(RequirePermissionMiddleware("badges", "write", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetUserIDFromContext(r.Context()) != "owner" || GetOrgIDFromContext(r.Context()) != "org" {
+			t.Error("expected the API key owner and organization in the context")
+		}
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/badges", nil)
+	r.Header.Set("X-API-Key", "any")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the permission check to see the API key, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// ErrCertificateNotMapped is returned for verified client certificates that
+// no active service account is mapped to
+var ErrCertificateNotMapped = errors.New("client certificate is not mapped to a service account")
+
+// AccountStore looks up the users client certificates are mapped to and their
+// roles, e.g. *database.DB
+type AccountStore interface {
+	GetUserByUsername(username string) (*database.User, error)
+	GetRole(roleID string) (*database.Role, error)
+}
+
+// ParseCertificateAccounts parses identity=username pairs mapping client
+// certificate identities to service accounts, e.g.
+// "spiffe://geant.org/ci=ci-bot" or "monitor.geant.org=monitor"
+func ParseCertificateAccounts(pairs []string) (map[string]string, error) {
+	accounts := map[string]string{}
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// URIs may contain "=", usernames cannot
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("invalid certificate account %q: expected identity=username", pair)
+		}
+		identity, username := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if _, ok := accounts[identity]; ok {
+			return nil, fmt.Errorf("certificate identity %q is mapped twice", identity)
+		}
+		accounts[identity] = username
+	}
+	return accounts, nil
+}
+
+// CertificateIdentities returns the identities of a client certificate, most
+// specific first: its URI, DNS and email subject alternative names, then its
+// subject common name
+func CertificateIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// CertificateAuth authenticates verified client certificates as the service
+// accounts their identities are mapped to. Service accounts are users: their
+// role grants the permissions, and they stop authenticating when they are no
+// longer active.
+type CertificateAuth struct {
+	store    AccountStore
+	accounts map[string]string
+}
+
+// NewCertificateAuth maps client certificate identities to the usernames of
+// accounts in store, as parsed by ParseCertificateAccounts
+func NewCertificateAuth(store AccountStore, accounts map[string]string) *CertificateAuth {
+	return &CertificateAuth{store: store, accounts: accounts}
+}
+
+// Claims returns the claims of the service account a verified client
+// certificate is mapped to, valid until the certificate expires. The first of
+// its CertificateIdentities that is mapped decides.
+func (c *CertificateAuth) Claims(cert *x509.Certificate) (*Claims, error) {
+	username := ""
+	for _, id := range CertificateIdentities(cert) {
+		if username = c.accounts[id]; username != "" {
+			break
+		}
+	}
+	if username == "" {
+		return nil, ErrCertificateNotMapped
+	}
+
+	user, err := c.store.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Status != "active" {
+		return nil, ErrCertificateNotMapped
+	}
+	role, err := c.store.GetRole(user.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	roleName := ""
+	if role != nil {
+		roleName = role.Name
+	}
+
+	claims := newClaims(user.UserID, user.Username, user.Email, roleName, user.OrgID.String, time.Now(), cert.NotAfter)
+	if err := resolveClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifiedCertificate returns the client certificate of a request, if it was
+// made over a TLS connection that verified one
+func verifiedCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseCertificateAccounts(t *testing.T) {
+	accounts, err := ParseCertificateAccounts([]string{"spiffe://geant.org/ns/ci?x=1=ci-bot", " monitor.geant.org = monitor ", ""})
+	if err != nil {
+		t.Fatalf("ParseCertificateAccounts: %v", err)
+	}
+	if len(accounts) != 2 || accounts["spiffe://geant.org/ns/ci?x=1"] != "ci-bot" || accounts["monitor.geant.org"] != "monitor" {
+		t.Errorf("unexpected accounts %v", accounts)
+	}
+	for _, pairs := range [][]string{{"no-username="}, {"=user"}, {"plain"}, {"a=x", "a=y"}} {
+		if _, err := ParseCertificateAccounts(pairs); err == nil {
+			t.Errorf("%q: expected an error", pairs)
+		}
+	}
+}
+
+func TestCertificateAuthentication(t *testing.T) {
+	_, store := setupTestHandler(t)
+	usePermissionCache(t, store, 0)
+	spiffe, _ := url.Parse("spiffe://geant.org/ci")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "unmapped"},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"ci.geant.org"},
+		NotAfter: time.Now().Add(time.Hour),
+	}
+	if ids := CertificateIdentities(cert); len(ids) != 3 || ids[0] != "spiffe://geant.org/ci" || ids[2] != "unmapped" {
+		t.Errorf("unexpected identities %v", ids)
+	}
+
+	a := NewAuthenticator(nil)
+	a.SetCertificateAuth(NewCertificateAuth(store, map[string]string{"ci.geant.org": "alice", "other": "nobody"}))
+	request := func(cert *x509.Certificate) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/badges", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		rec := httptest.NewRecorder()
+		a.Required(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := GetPrincipalFromContext(r.Context())
+			if p.Method != MethodCertificate || p.UserID != "user-id" || !HasPermission(r.Context(), "badges", "read") {
+				t.Errorf("expected the service account with its role, got %+v", p)
+			}
+		})).ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := request(cert); rec.Code != http.StatusOK {
+		t.Errorf("expected the mapped certificate to authenticate, got %d: %s", rec.Code, rec.Body)
+	}
+	unmapped := &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}
+	if rec := request(unmapped); rec.Code != http.StatusForbidden {
+		t.Errorf("expected an unmapped certificate to be refused, got %d", rec.Code)
+	}
+	missing := &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}
+	if rec := request(missing); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a certificate of a missing account to be refused, got %d", rec.Code)
+	}
+	store.Users["user-id"].Status = "locked"
+	if rec := request(cert); rec.Code != http.StatusForbidden {
+		t.Errorf("expected an inactive service account to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// ErrClientRevoked is returned for tokens of an OAuth2 client that was
+// revoked or deleted since they were issued
+var ErrClientRevoked = errors.New("client revoked")
+
+// ClientStore looks up OAuth2 clients and their owners, e.g. *database.DB
+type ClientStore interface {
+	PermissionStore
+	GetOAuthClient(clientID string) (*database.OAuthClient, error)
+}
+
+var (
+	clientStoreMu sync.RWMutex
+	clientStore   ClientStore
+)
+
+// SetClientStore checks the tokens of OAuth2 clients against store from now
+// on, so that revoking a client, narrowing its permissions or demoting or
+// locking its owner applies to the tokens it holds. Until it is called,
+// client tokens are granted their scope.
+func SetClientStore(store ClientStore) {
+	clientStoreMu.Lock()
+	defer clientStoreMu.Unlock()
+	clientStore = store
+}
+
+// getClientStore returns the client store, or nil
+func getClientStore() ClientStore {
+	clientStoreMu.RLock()
+	defer clientStoreMu.RUnlock()
+	return clientStore
+}
+
+// ParseScope parses an OAuth2 scope of space-separated "resource:action"
+// grants, e.g. "badges:read badges:write"
+func ParseScope(scope string) (database.Permissions, error) {
+	permissions := database.Permissions{}
+	for _, grant := range strings.Fields(scope) {
+		resource, action, ok := strings.Cut(grant, ":")
+		if !ok || resource == "" || action == "" {
+			return nil, fmt.Errorf("invalid scope %q: use resource:action", grant)
+		}
+		if permissions[resource] == nil {
+			permissions[resource] = map[string]bool{}
+		}
+		permissions[resource][action] = true
+	}
+	return permissions, nil
+}
+
+// FormatScope returns the grants of permissions as a sorted OAuth2 scope
+func FormatScope(permissions database.Permissions) string {
+	var grants []string
+	for resource, actions := range permissions {
+		for action, granted := range actions {
+			if granted {
+				grants = append(grants, resource+":"+action)
+			}
+		}
+	}
+	sort.Strings(grants)
+	return strings.Join(grants, " ")
+}
+
+// resolveClientClaims sets the permissions of a client token from its scope,
+// limited to what the client may still request and what its owner's current
+// role allows. Tokens of owners who are no longer active get ErrUserNotActive.
+func resolveClientClaims(claims *Claims) error {
+	permissions, err := ParseScope(claims.Scope)
+	if err != nil {
+		return err
+	}
+	store := getClientStore()
+	if store == nil {
+		claims.Permissions = permissions
+		return nil
+	}
+
+	client, err := store.GetOAuthClient(claims.ClientID)
+	if err != nil {
+		return err
+	}
+	if client == nil || client.Status != "active" || client.UserID != claims.UserID {
+		return ErrClientRevoked
+	}
+	allowed, err := database.ParsePermissions(client.Permissions)
+	if err != nil {
+		return err
+	}
+	owner, err := store.GetUser(client.UserID)
+	if err != nil {
+		return err
+	}
+	if owner == nil || owner.Status != "active" {
+		return ErrUserNotActive
+	}
+	ownerPermissions, err := rolePermissions(store, owner.RoleID)
+	if err != nil {
+		return err
+	}
+	granted := database.Permissions{}
+	for resource, actions := range permissions {
+		for action := range actions {
+			if allowed.Allows(resource, action) && ownerPermissions.Allows(resource, action) {
+				if granted[resource] == nil {
+					granted[resource] = map[string]bool{}
+				}
+				granted[resource][action] = true
+			}
+		}
+	}
+	claims.Permissions = granted
+	claims.OrgID = client.OrgID
+	return nil
+}
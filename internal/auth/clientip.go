@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []*net.IPNet
+)
+
+// SetTrustedProxies sets the reverse proxies whose X-Forwarded-For header
+// names the client, as IP addresses or CIDR ranges. Without any, the client
+// is the address of the connection and the header is ignored, since clients
+// could set it to anything.
+func SetTrustedProxies(proxies []string) error {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("invalid proxy address %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid proxy range %q", p)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	trustedProxiesMu.Lock()
+	defer trustedProxiesMu.Unlock()
+	trustedProxies = nets
+	return nil
+}
+
+// trustedProxy reports whether host is one of the trusted proxies
+func trustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromTrustedProxy reports whether r was received from one of the trusted
+// proxies, whose forwarding headers can be believed
+func FromTrustedProxy(r *http.Request) bool {
+	return trustedProxy(remoteHost(r))
+}
+
+// remoteHost returns the address of the connection of r, without the port
+func remoteHost(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// clientIP returns the address of the client of r, without the port: the
+// address of the connection, or when that is a trusted proxy the last address
+// in X-Forwarded-For that is not one. API key IP restrictions, login
+// throttling and sessions use it.
+func clientIP(r *http.Request) string {
+	host := remoteHost(r)
+	if !trustedProxy(host) {
+		return host
+	}
+
+	// Each proxy appends the address it received the request from
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
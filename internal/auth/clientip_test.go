@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "198.51.100.7:1000", nil, "198.51.100.7"},
+		{"spoofed header", "198.51.100.7:1000", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"trusted proxy", "10.1.2.3:1000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"forged hop before the proxy", "10.1.2.3:1000", []string{"1.1.1.1, 203.0.113.9"}, "203.0.113.9"},
+		{"proxy chain", "192.0.2.1:1000", []string{"203.0.113.9, 10.0.0.5"}, "203.0.113.9"},
+		{"split headers", "10.1.2.3:1000", []string{"1.1.1.1", "203.0.113.9"}, "203.0.113.9"},
+		{"garbage hop", "10.1.2.3:1000", []string{"not-an-ip"}, "10.1.2.3"},
+		{"proxy without header", "10.1.2.3:1000", nil, "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, v := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+		if got := ipThrottleKey(r); got != "ip:"+tc.want {
+			t.Errorf("%s: expected failures to be counted for %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.2.3:1000"
+	if !FromTrustedProxy(r) {
+		t.Errorf("expected a request from a trusted proxy to be recognized")
+	}
+	r.RemoteAddr = "198.51.100.7:1000"
+	if FromTrustedProxy(r) {
+		t.Errorf("expected a direct request not to come from a trusted proxy")
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "proxy.example.org"} {
+		if err := SetTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("expected %q to be refused", bad)
+		}
+	}
+}
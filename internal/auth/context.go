@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+
+	"github.com/finki/badges/internal/database"
 )
 
 // Context keys
@@ -12,8 +14,13 @@ const (
 	apiKeyContextKey contextKey = "api_key"
 )
 
-// AddClaimsToContext adds JWT claims to the request context
+// AddClaimsToContext adds JWT claims to the request context. The user is
+// also recorded as the actor of the domain events of database calls made
+// under it.
 func AddClaimsToContext(ctx context.Context, claims *Claims) context.Context {
+	if claims != nil {
+		ctx = database.WithActor(ctx, claims.UserID)
+	}
 	return context.WithValue(ctx, claimsContextKey, claims)
 }
 
@@ -26,12 +33,57 @@ func GetClaimsFromContext(ctx context.Context) *Claims {
 	return claims
 }
 
-// AddAPIKeyToContext adds an API key to the request context
+// AddAPIKeyToContext adds an API key to the request context; its owner is
+// the actor of domain events, as with AddClaimsToContext
 func AddAPIKeyToContext(ctx context.Context, apiKey interface{}) context.Context {
+	if info, ok := apiKey.(*APIKeyInfo); ok && info != nil {
+		ctx = database.WithActor(ctx, info.UserID)
+	}
 	return context.WithValue(ctx, apiKeyContextKey, apiKey)
 }
 
 // GetAPIKeyFromContext retrieves an API key from the request context
 func GetAPIKeyFromContext(ctx context.Context) interface{} {
 	return ctx.Value(apiKeyContextKey)
-}
\ No newline at end of file
+}
+// GetAPIKeyInfoFromContext retrieves the authenticated API key from the request context
+func GetAPIKeyInfoFromContext(ctx context.Context) *APIKeyInfo {
+	apiKey, ok := GetAPIKeyFromContext(ctx).(*APIKeyInfo)
+	if !ok {
+		return nil
+	}
+	return apiKey
+}
+
+// GetUserIDFromContext returns the ID of the authenticated user, taken from
+// the JWT claims or, for API key requests, from the owner of the key
+func GetUserIDFromContext(ctx context.Context) string {
+	if claims := GetClaimsFromContext(ctx); claims != nil {
+		return claims.UserID
+	}
+	if apiKey := GetAPIKeyInfoFromContext(ctx); apiKey != nil {
+		return apiKey.UserID
+	}
+	return ""
+}
+
+// GetOrgIDFromContext returns the organization the authenticated user or API
+// key is scoped to, or "" for instance-wide access
+func GetOrgIDFromContext(ctx context.Context) string {
+	if claims := GetClaimsFromContext(ctx); claims != nil {
+		return claims.OrgID
+	}
+	if apiKey := GetAPIKeyInfoFromContext(ctx); apiKey != nil {
+		return apiKey.OrgID
+	}
+	return ""
+}
+
+// CanAccessOrg reports whether the authenticated user or API key may manage
+// resources owned by orgID. Instance-wide callers may manage every
+// organization; organization admins only their own and not instance-level
+// resources.
+func CanAccessOrg(ctx context.Context, orgID string) bool {
+	scope := GetOrgIDFromContext(ctx)
+	return scope == "" || scope == orgID
+}
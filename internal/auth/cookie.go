@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SessionCookie is the name of the cookie carrying the JWT of browser sessions
+const SessionCookie = "jwt"
+
+// CookieOptions are the attributes of the session cookie and the lifetime of
+// the sessions it carries
+type CookieOptions struct {
+	// Secure is "auto", setting the attribute on requests received over TLS
+	// directly or through a proxy setting X-Forwarded-Proto, "true" or "false"
+	Secure   string
+	Domain   string
+	SameSite http.SameSite
+	// IdleTimeout is the lifetime of tokens. Browser sessions are renewed as
+	// they make requests, so they end after this long without one.
+	IdleTimeout time.Duration
+	// MaxAge ends browser sessions this long after login, however active
+	MaxAge time.Duration
+}
+
+// DefaultCookieOptions are used until SetCookieOptions is called
+func DefaultCookieOptions() CookieOptions {
+	return CookieOptions{
+		Secure:      "auto",
+		SameSite:    http.SameSiteLaxMode,
+		IdleTimeout: TokenExpiration,
+		MaxAge:      12 * time.Hour,
+	}
+}
+
+var (
+	cookieMu      sync.RWMutex
+	cookieOptions = DefaultCookieOptions()
+)
+
+// SetCookieOptions sets the session cookie attributes and session lifetimes
+func SetCookieOptions(opts CookieOptions) {
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
+	cookieOptions = opts
+}
+
+// getCookieOptions returns the current cookie options
+func getCookieOptions() CookieOptions {
+	cookieMu.RLock()
+	defer cookieMu.RUnlock()
+	return cookieOptions
+}
+
+// ParseSameSite parses a SameSite attribute: lax, strict or none
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch s {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite %q: expected lax, strict or none", s)
+}
+
+// SetSessionCookie stores a token issued for r in the session cookie
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	c := sessionCookie(r)
+	c.Value = token
+	c.Expires = expiresAt
+	http.SetCookie(w, c)
+}
+
+// ClearSessionCookie makes the browser drop the session cookie
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	c := sessionCookie(r)
+	c.Expires = time.Unix(0, 0)
+	c.MaxAge = -1
+	http.SetCookie(w, c)
+}
+
+// sessionCookie returns the session cookie for r, without a value
+func sessionCookie(r *http.Request) *http.Cookie {
+	opts := getCookieOptions()
+	secure := opts.Secure == "true"
+	if opts.Secure == "auto" {
+		secure = r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+	}
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		Domain:   opts.Domain,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: opts.SameSite,
+	}
+}
+
+// renewSession issues a new session cookie for claims once half of its token
+// lifetime has passed, so that active browser sessions last until MaxAge.
+// Impersonation and client tokens are never renewed.
+func renewSession(w http.ResponseWriter, r *http.Request, claims *Claims) {
+	opts := getCookieOptions()
+	if claims.Impersonated() || claims.Client() || claims.ExpiresAt == nil || time.Until(claims.ExpiresAt.Time) > opts.IdleTimeout/2 {
+		return
+	}
+
+	// Tokens issued before AuthTime was introduced start their session now
+	authTime := time.Now()
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	}
+	expiresAt := sessionExpiry(authTime, opts)
+	if !expiresAt.After(claims.ExpiresAt.Time) {
+		return
+	}
+
+	renewed := *claims
+	renewed.AuthTime = jwt.NewNumericDate(authTime)
+	renewed.IssuedAt = jwt.NewNumericDate(time.Now())
+	renewed.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	token, err := signClaims(&renewed)
+	if err != nil {
+		return
+	}
+	SetSessionCookie(w, r, token, expiresAt)
+	extendSession(r, renewed.ID, expiresAt)
+}
+
+// sessionExpiry is when a token issued now for a session started at
+// authTime expires: after the idle timeout, but not past the session's end
+func sessionExpiry(authTime time.Time, opts CookieOptions) time.Time {
+	expiresAt := time.Now().Add(opts.IdleTimeout)
+	if end := authTime.Add(opts.MaxAge); opts.MaxAge > 0 && end.Before(expiresAt) {
+		expiresAt = end
+	}
+	return expiresAt
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSessionCookieAttributes(t *testing.T) {
+	defer SetCookieOptions(DefaultCookieOptions())
+
+	for _, tc := range []struct {
+		name   string
+		secure string
+		proto  string
+		want   bool
+	}{
+		{"auto over http", "auto", "", false},
+		{"auto behind a TLS proxy", "auto", "https", true},
+		{"forced", "true", "", true},
+		{"disabled", "false", "https", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultCookieOptions()
+			opts.Secure = tc.secure
+			opts.Domain = "example.org"
+			opts.SameSite = http.SameSiteStrictMode
+			SetCookieOptions(opts)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+			if tc.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			rec := httptest.NewRecorder()
+			SetSessionCookie(rec, r, "token", time.Now().Add(time.Minute))
+
+			c := rec.Result().Cookies()[0]
+			if c.Secure != tc.want || c.Domain != "example.org" || c.SameSite != http.SameSiteStrictMode || !c.HttpOnly {
+				t.Errorf("unexpected cookie %+v", c)
+			}
+		})
+	}
+}
+
+func TestRenewSession(t *testing.T) {
+	opts := DefaultCookieOptions()
+	opts.IdleTimeout = 10 * time.Minute
+	opts.MaxAge = time.Hour
+	SetCookieOptions(opts)
+	defer SetCookieOptions(DefaultCookieOptions())
+
+	token := func(authAgo, expiresIn time.Duration) *Claims {
+		return &Claims{
+			UserID:   "1",
+			AuthTime: jwt.NewNumericDate(time.Now().Add(-authAgo)),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			},
+		}
+	}
+	renewed := func(claims *Claims) *Claims {
+		rec := httptest.NewRecorder()
+		renewSession(rec, httptest.NewRequest(http.MethodGet, "/admin", nil), claims)
+		cookies := rec.Result().Cookies()
+		if len(cookies) == 0 {
+			return nil
+		}
+		got, err := ValidateToken(cookies[0].Value)
+		if err != nil {
+			t.Fatalf("renewed token is invalid: %v", err)
+		}
+		return got
+	}
+
+	if renewed(token(time.Minute, 9*time.Minute)) != nil {
+		t.Error("expected a fresh token not to be renewed")
+	}
+
+	claims := renewed(token(20*time.Minute, 2*time.Minute))
+	if claims == nil {
+		t.Fatal("expected a token past half its lifetime to be renewed")
+	}
+	if left := time.Until(claims.ExpiresAt.Time); left < 9*time.Minute || left > 10*time.Minute {
+		t.Errorf("expected the renewed token to last the idle timeout, got %s", left)
+	}
+	if claims.UserID != "1" || time.Since(claims.AuthTime.Time) < 19*time.Minute {
+		t.Errorf("expected the renewed token to keep the session, got %+v", claims)
+	}
+
+	// Renewal stops at the maximum session age
+	claims = renewed(token(55*time.Minute, 2*time.Minute))
+	if claims == nil || time.Until(claims.ExpiresAt.Time) > 5*time.Minute+time.Second {
+		t.Errorf("expected the renewed token to end with the session, got %+v", claims)
+	}
+	if renewed(token(59*time.Minute, time.Minute)) != nil {
+		t.Error("expected a session at its maximum age not to be renewed")
+	}
+}
+
+func TestOptionalJWTFromCookie(t *testing.T) {
+	var got *Claims
+	h := OptionalJWTFromCookie(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetClaimsFromContext(r.Context())
+	}))
+	serve := func(cookie string) *httptest.ResponseRecorder {
+		got = nil
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := serve(""); rec.Code != http.StatusOK || got != nil {
+		t.Errorf("expected anonymous requests to pass without claims, got %d %+v", rec.Code, got)
+	}
+
+	token, _, err := GenerateToken("1", "alice", "alice@example.org", "admin", "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if serve(token); got == nil || got.Username != "alice" {
+		t.Errorf("expected the claims of the cookie, got %+v", got)
+	}
+
+	rec := serve("not-a-token")
+	if rec.Code != http.StatusOK || got != nil {
+		t.Errorf("expected invalid cookies to be ignored, got %d %+v", rec.Code, got)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the invalid cookie to be cleared, got %v", cookies)
+	}
+}
@@ -3,31 +3,58 @@ package auth
 import (
     "encoding/json"
     "net/http"
+    "strconv"
     "strings"
     "time"
 
     "github.com/finki/badges/internal/database"
+    "github.com/finki/badges/internal/httpjson"
+    "github.com/finki/badges/internal/service"
     "go.uber.org/zap"
 )
 
 // Handler handles authentication requests
 type Handler struct {
-	DB     *database.DB
+	DB     service.UserStore
 	Logger *zap.Logger
+	// throttle slows down failed logins; nil lets every attempt through
+	throttle *LoginThrottle
+	// lockoutAttempts failed logins in a row lock an account; 0 never does
+	lockoutAttempts int
 }
 
-// NewHandler creates a new authentication handler
-func NewHandler(db *database.DB, logger *zap.Logger) *Handler {
+// NewHandler creates a new authentication handler over a user store such as *database.DB
+func NewHandler(db service.UserStore, logger *zap.Logger) *Handler {
 	return &Handler{
-		DB:     db,
-		Logger: logger,
+		DB:              db,
+		Logger:          logger,
+		lockoutAttempts: DefaultLockoutAttempts,
 	}
 }
 
+// DefaultLockoutAttempts is the number of failed logins in a row that lock
+// an account unless SetLockoutAttempts changes it: none, since a lockout lets
+// anyone lock the victim out; the login throttle slows down guessing instead
+const DefaultLockoutAttempts = 0
+
+// SetThrottle throttles failed logins by username and client address
+func (h *Handler) SetThrottle(t *LoginThrottle) {
+	h.throttle = t
+}
+
+// SetLockoutAttempts sets the number of failed logins in a row that lock an
+// account until an administrator resets its password; 0 disables the lockout
+func (h *Handler) SetLockoutAttempts(n int) {
+	h.lockoutAttempts = n
+}
+
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Captcha is the CAPTCHA response, required once the login throttle asks
+	// for one
+	Captcha string `json:"captcha,omitempty"`
 }
 
 // LoginResponse represents a login response
@@ -44,151 +71,129 @@ type LoginResponse struct {
 	} `json:"user"`
 }
 
-// writeJSONError writes a consistent JSON error response with a given HTTP status
-func writeJSONError(w http.ResponseWriter, status int, message string) {
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(status)
-    _ = json.NewEncoder(w).Encode(map[string]string{
-        "error": message,
-    })
-}
-
 // Login handles user authentication and returns a JWT token
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+    db := service.WithContext(h.DB, r.Context())
+
     // Only handle POST requests
     if r.Method != http.MethodPost {
-        writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+        httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
         return
     }
 
 	// Parse request body
 	var req LoginRequest
  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+        httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
         return
     }
 
 	// Validate request
  if req.Username == "" || req.Password == "" {
-        writeJSONError(w, http.StatusBadRequest, "Username and password are required")
+        httpjson.Error(w, http.StatusBadRequest, "Username and password are required")
         return
     }
 
+	// Slow down guessing before looking at the password
+	if !h.allowLogin(w, r, req) {
+		return
+	}
+
  // Get user from database (allow username or email)
  var (
      user *database.User
      err  error
  )
  if strings.Contains(req.Username, "@") {
-     user, err = h.DB.GetUserByEmail(req.Username)
+     user, err = db.GetUserByEmail(req.Username)
  } else {
-     user, err = h.DB.GetUserByUsername(req.Username)
+     user, err = db.GetUserByUsername(req.Username)
  }
  if err != nil {
         h.Logger.Error("Failed to get user", zap.Error(err))
-        writeJSONError(w, http.StatusUnauthorized, "Invalid username or password")
+        httpjson.Error(w, http.StatusUnauthorized, "Invalid username or password")
         return
     }
 
 	// Check if user exists
  if user == nil {
-        writeJSONError(w, http.StatusUnauthorized, "Invalid username or password")
+        h.throttleFailure(r, req.Username)
+        httpjson.Error(w, http.StatusUnauthorized, "Invalid username or password")
         return
     }
 
 	// Check if user is active
  if user.Status != "active" {
-        writeJSONError(w, http.StatusUnauthorized, "Account is not active")
+        httpjson.Error(w, http.StatusUnauthorized, "Account is not active")
         return
     }
 
 	// Verify password
  if err := VerifyPassword(user.PasswordHash, req.Password); err != nil {
-        // Increment failed attempts
-        if err := h.DB.UpdateUserFailedAttempts(user.UserID, user.FailedAttempts+1); err != nil {
-            h.Logger.Error("Failed to update failed attempts", zap.Error(err))
-        }
-
-		// Check if account should be locked
-        if user.FailedAttempts+1 >= 5 {
-            // Lock account
-            user.Status = "locked"
-            if err := h.DB.UpdateUser(user); err != nil {
-                h.Logger.Error("Failed to lock account", zap.Error(err))
-            }
-            writeJSONError(w, http.StatusUnauthorized, "Account has been locked due to too many failed attempts")
+        h.throttleFailure(r, req.Username)
+        if h.recordFailedAttempt(db, user) {
+            httpjson.Error(w, http.StatusUnauthorized, "Account has been locked due to too many failed attempts")
             return
         }
 
-        writeJSONError(w, http.StatusUnauthorized, "Invalid username or password")
+        httpjson.Error(w, http.StatusUnauthorized, "Invalid username or password")
         return
     }
 
 	// Reset failed attempts
+	if h.throttle != nil {
+		if err := h.throttle.succeed(r, req.Username); err != nil {
+			h.Logger.Error("Failed to reset login throttle", zap.Error(err))
+		}
+	}
 	if user.FailedAttempts > 0 {
-		if err := h.DB.UpdateUserFailedAttempts(user.UserID, 0); err != nil {
+		if err := db.UpdateUserFailedAttempts(user.UserID, 0); err != nil {
 			h.Logger.Error("Failed to reset failed attempts", zap.Error(err))
 		}
 	}
 
+	// One-time passwords only allow choosing a new password, not a session
+	if user.MustChangePassword {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":                    "Password change required",
+			"password_change_required": true,
+		})
+		return
+	}
+
 	// Update last login
-	if err := h.DB.UpdateUserLastLogin(user.UserID, time.Now()); err != nil {
+	if err := db.UpdateUserLastLogin(user.UserID, time.Now()); err != nil {
 		h.Logger.Error("Failed to update last login", zap.Error(err))
 	}
 
 	// Get role
-	role, err := h.DB.GetRole(user.RoleID)
+	role, err := db.GetRole(user.RoleID)
  if err != nil {
         h.Logger.Error("Failed to get role", zap.Error(err))
-        writeJSONError(w, http.StatusInternalServerError, "Failed to authenticate")
+        httpjson.Error(w, http.StatusInternalServerError, "Failed to authenticate")
         return
     }
 
-	// Get permissions
-	permissions, err := role.GetPermissions()
- if err != nil {
-        h.Logger.Error("Failed to get permissions", zap.Error(err))
-        writeJSONError(w, http.StatusInternalServerError, "Failed to authenticate")
-        return
-    }
-
-	// Convert permissions to map
-	permissionsMap := map[string]interface{}{
-		"badges": map[string]interface{}{
-			"read":   permissions.Badges.Read,
-			"write":  permissions.Badges.Write,
-			"delete": permissions.Badges.Delete,
-		},
-		"users": map[string]interface{}{
-			"read":   permissions.Users.Read,
-			"write":  permissions.Users.Write,
-			"delete": permissions.Users.Delete,
-		},
-		"api_keys": map[string]interface{}{
-			"read":   permissions.APIKeys.Read,
-			"write":  permissions.APIKeys.Write,
-			"delete": permissions.APIKeys.Delete,
-		},
+	// Record the session the token belongs to, so that it can be revoked
+	sessionID, err := startSession(r, user.UserID)
+	if err != nil {
+		h.Logger.Error("Failed to record session", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to authenticate")
+		return
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := GenerateToken(user.UserID, user.Username, user.Email, role.Name, permissionsMap)
+	token, expiresAt, err := generateToken(sessionID, user.UserID, user.Username, user.Email, role.Name, user.OrgID.String)
  if err != nil {
         h.Logger.Error("Failed to generate token", zap.Error(err))
-        writeJSONError(w, http.StatusInternalServerError, "Failed to authenticate")
+        httpjson.Error(w, http.StatusInternalServerError, "Failed to authenticate")
         return
     }
 
  // Set HttpOnly cookie with the JWT for browser sessions
- http.SetCookie(w, &http.Cookie{
-     Name:     "jwt",
-     Value:    token,
-     Path:     "/",
-     Expires:  expiresAt,
-     HttpOnly: true,
-     SameSite: http.SameSiteLaxMode,
-     // Secure: true, // enable when using HTTPS
- })
+ SetSessionCookie(w, r, token, expiresAt)
 
  // Create response
  resp := LoginResponse{
@@ -207,24 +212,107 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(resp)
 }
 
-// Logout clears the JWT cookie for browser sessions
+// recordFailedAttempt increments the user's failed login attempts and locks the
+// account after lockoutAttempts in a row. It reports whether the account is now
+// locked.
+func (h *Handler) recordFailedAttempt(db service.UserStore, user *database.User) bool {
+	if err := db.UpdateUserFailedAttempts(user.UserID, user.FailedAttempts+1); err != nil {
+		h.Logger.Error("Failed to update failed attempts", zap.Error(err))
+	}
+
+	if h.lockoutAttempts <= 0 || user.FailedAttempts+1 < h.lockoutAttempts {
+		return false
+	}
+
+	user.FailedAttempts++
+	user.Status = "locked"
+	if err := db.UpdateUser(user); err != nil {
+		h.Logger.Error("Failed to lock account", zap.Error(err))
+	}
+	return true
+}
+
+// allowLogin applies the login throttle to a login request, answering it
+// with 429 Too Many Requests while the username or client address must wait
+// and with 401 while a required CAPTCHA is missing or wrong. It reports
+// whether the login may proceed.
+func (h *Handler) allowLogin(w http.ResponseWriter, r *http.Request, req LoginRequest) bool {
+	if h.throttle == nil {
+		return true
+	}
+	verdict, err := h.throttle.check(r, req.Username)
+	if err != nil {
+		// Failing open keeps users in; the lockout still applies
+		h.Logger.Error("Failed to check login throttle", zap.Error(err))
+		return true
+	}
+
+	if verdict.retryAfter > 0 {
+		h.Logger.Warn("Login throttled",
+			zap.String("username", req.Username),
+			zap.Duration("retry_after", verdict.retryAfter),
+			zap.Bool("banned", verdict.banned),
+		)
+		retryAfter := int(verdict.retryAfter.Round(time.Second) / time.Second)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       "Too many failed logins, try again later",
+			"retry_after": retryAfter,
+		})
+		return false
+	}
+
+	if verdict.captcha {
+		ok, err := h.throttle.verifyCaptcha(r, req.Captcha)
+		if err != nil {
+			h.Logger.Error("Failed to verify CAPTCHA", zap.Error(err))
+		}
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":            "CAPTCHA required",
+				"captcha_required": true,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// throttleFailure counts a failed login with the login throttle
+func (h *Handler) throttleFailure(r *http.Request, username string) {
+	if h.throttle == nil {
+		return
+	}
+	if err := h.throttle.fail(r, username); err != nil {
+		h.Logger.Error("Failed to record failed login", zap.Error(err))
+	}
+}
+
+// Logout clears the JWT cookie for browser sessions and revokes the session
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost {
         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
         return
     }
 
+    // Tokens copied from the session stop working too
+    if c, err := r.Cookie(SessionCookie); err == nil && c.Value != "" {
+        if claims, err := ValidateToken(c.Value); err == nil {
+            if err := revokeSession(r, claims.ID); err != nil {
+                h.Logger.Error("Failed to revoke session", zap.Error(err))
+            }
+        }
+    }
+
     // Invalidate the cookie by setting it to expire in the past
-    http.SetCookie(w, &http.Cookie{
-        Name:     "jwt",
-        Value:    "",
-        Path:     "/",
-        Expires:  time.Unix(0, 0),
-        MaxAge:   -1,
-        HttpOnly: true,
-        SameSite: http.SameSiteLaxMode,
-        // Secure: true, // enable when using HTTPS
-    })
+    ClearSessionCookie(w, r)
 
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
@@ -234,7 +322,7 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 // Session returns the current authenticated session info based on JWT cookie
 func (h *Handler) Session(w http.ResponseWriter, r *http.Request) {
     // Read cookie
-    c, err := r.Cookie("jwt")
+    c, err := r.Cookie(SessionCookie)
     if err != nil || c.Value == "" {
         w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusOK)
@@ -246,6 +334,8 @@ func (h *Handler) Session(w http.ResponseWriter, r *http.Request) {
 
     claims, err := ValidateToken(c.Value)
     if err != nil {
+        // The session expired or was signed with a retired key
+        ClearSessionCookie(w, r)
         w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusOK)
         _ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -254,80 +344,119 @@ func (h *Handler) Session(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    _ = json.NewEncoder(w).Encode(map[string]interface{}{
+    resp := map[string]interface{}{
         "authenticated": true,
         "user": map[string]string{
             "user_id":  claims.UserID,
             "username": claims.Username,
             "email":    claims.Email,
             "role":     claims.Role,
+            "org":      claims.OrgID,
         },
         "expires_at": claims.ExpiresAt.Time,
-    })
+    }
+    if claims.Impersonated() {
+        resp["impersonated_by"] = claims.Actor
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(resp)
 }
 
-// ChangePasswordRequest represents a password change request
+// ChangePasswordRequest represents a password change request. Username is only
+// needed when changing a one-time password, as no session exists yet.
 type ChangePasswordRequest struct {
+    Username    string `json:"username,omitempty"`
     OldPassword string `json:"old_password"`
     NewPassword string `json:"new_password"`
 }
 
-// ChangePassword lets the authenticated user change their own password
+// ChangePassword lets the authenticated user change their own password. Users whose
+// password must be changed authenticate with their username and current password instead.
 func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
-        return
-    }
+    db := service.WithContext(h.DB, r.Context())
 
-    // Require an authenticated session (route is wrapped with OptionalJWTFromCookie)
-    claims := GetClaimsFromContext(r.Context())
-    if claims == nil {
-        writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+    if r.Method != http.MethodPost {
+        httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
         return
     }
 
     var req ChangePasswordRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+        httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
         return
     }
     if req.OldPassword == "" || req.NewPassword == "" {
-        writeJSONError(w, http.StatusBadRequest, "Current and new password are required")
+        httpjson.Error(w, http.StatusBadRequest, "Current and new password are required")
         return
     }
 
-    user, err := h.DB.GetUser(claims.UserID)
+    // Require an authenticated session (route is wrapped with Authenticator.Optional)
+    // unless the user is completing a forced password change
+    var (
+        user *database.User
+        err  error
+    )
+    if claims := GetClaimsFromContext(r.Context()); claims != nil {
+        // Administrators acting as a user may not take over the account
+        if claims.Impersonated() {
+            httpjson.Error(w, http.StatusForbidden, "Passwords cannot be changed while impersonating")
+            return
+        }
+        user, err = db.GetUser(claims.UserID)
+    } else if req.Username != "" {
+        if strings.Contains(req.Username, "@") {
+            user, err = db.GetUserByEmail(req.Username)
+        } else {
+            user, err = db.GetUserByUsername(req.Username)
+        }
+        if err == nil && (user == nil || !user.MustChangePassword || user.Status != "active") {
+            httpjson.Error(w, http.StatusUnauthorized, "Authentication required")
+            return
+        }
+    } else {
+        httpjson.Error(w, http.StatusUnauthorized, "Authentication required")
+        return
+    }
     if err != nil || user == nil {
         h.Logger.Error("ChangePassword: failed to load user", zap.Error(err))
-        writeJSONError(w, http.StatusUnauthorized, "User not found")
+        httpjson.Error(w, http.StatusUnauthorized, "User not found")
         return
     }
 
     if err := VerifyPassword(user.PasswordHash, req.OldPassword); err != nil {
-        writeJSONError(w, http.StatusUnauthorized, "Current password is incorrect")
+        if user.MustChangePassword && h.recordFailedAttempt(db, user) {
+            httpjson.Error(w, http.StatusUnauthorized, "Account has been locked due to too many failed attempts")
+            return
+        }
+        httpjson.Error(w, http.StatusUnauthorized, "Current password is incorrect")
+        return
+    }
+
+    if user.MustChangePassword && req.NewPassword == req.OldPassword {
+        httpjson.Error(w, http.StatusBadRequest, "New password must differ from the one-time password")
         return
     }
 
     if err := ValidatePassword(req.NewPassword); err != nil {
-        writeJSONError(w, http.StatusBadRequest, err.Error())
+        httpjson.Error(w, http.StatusBadRequest, err.Error())
         return
     }
 
     hashed, err := HashPassword(req.NewPassword)
     if err != nil {
         h.Logger.Error("ChangePassword: failed to hash password", zap.Error(err))
-        writeJSONError(w, http.StatusInternalServerError, "Failed to update password")
+        httpjson.Error(w, http.StatusInternalServerError, "Failed to update password")
         return
     }
 
-    if err := h.DB.UpdateUserPassword(user.UserID, hashed); err != nil {
+    if err := db.UpdateUserPassword(user.UserID, hashed); err != nil {
         h.Logger.Error("ChangePassword: failed to persist password", zap.Error(err))
-        writeJSONError(w, http.StatusInternalServerError, "Failed to update password")
+        httpjson.Error(w, http.StatusInternalServerError, "Failed to update password")
         return
     }
 
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
     _ = json.NewEncoder(w).Encode(map[string]string{"status": "password_changed"})
-}
\ No newline at end of file
+}
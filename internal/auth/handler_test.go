@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service/servicetest"
+	"go.uber.org/zap"
+)
+
+// setupTestHandler creates a handler over an in-memory store holding one
+// active user with the password "Correct-Horse-42"
+func setupTestHandler(t *testing.T) (*Handler, *servicetest.UserStore) {
+	t.Helper()
+	hash, err := HashPassword("Correct-Horse-42")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	store := servicetest.NewUserStore(
+		[]*database.Role{{RoleID: "role-id", Name: "admin", Permissions: `{"badges":{"read":true}}`}},
+		&database.User{UserID: "user-id", Username: "alice", Email: "alice@example.org", PasswordHash: hash, RoleID: "role-id", Status: "active"},
+	)
+	return NewHandler(store, zap.NewNop()), store
+}
+
+func login(h *Handler, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(string(body))))
+	return rec
+}
+
+func TestLogin(t *testing.T) {
+	h, store := setupTestHandler(t)
+
+	for _, username := range []string{"alice", "alice@example.org", " Alice@Example.ORG"} {
+		rec := login(h, username, "Correct-Horse-42")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", username, rec.Code, rec.Body.String())
+		}
+		var resp LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Token == "" || resp.User.Role != "admin" {
+			t.Errorf("%s: expected a token for the admin role, got %s", username, rec.Body.String())
+		}
+	}
+	if !store.Users["user-id"].LastLogin.Valid {
+		t.Error("expected the last login to be recorded")
+	}
+
+	for _, username := range []string{"bob", "bob@example.org", "Alice"} {
+		if rec := login(h, username, "Correct-Horse-42"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 for an unknown user, got %d", username, rec.Code)
+		}
+	}
+	if rec := login(h, "alice@example.org", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password by email, got %d", rec.Code)
+	}
+	if n := store.Users["user-id"].FailedAttempts; n != 1 {
+		t.Errorf("expected a failed login by email to count against the account, got %d", n)
+	}
+}
+
+func TestLoginLocksAccount(t *testing.T) {
+	h, store := setupTestHandler(t)
+	h.SetLockoutAttempts(5)
+
+	for i := 1; i <= 5; i++ {
+		rec := login(h, "alice", "wrong")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i, rec.Code)
+		}
+		if i == 5 && !strings.Contains(rec.Body.String(), "locked") {
+			t.Errorf("expected the fifth attempt to lock the account, got %s", rec.Body.String())
+		}
+	}
+	if u := store.Users["user-id"]; u.Status != "locked" || u.FailedAttempts != 5 {
+		t.Errorf("expected a locked account after 5 attempts, got %q with %d", u.Status, u.FailedAttempts)
+	}
+	if rec := login(h, "alice", "Correct-Horse-42"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a locked account to be refused, got %d", rec.Code)
+	}
+}
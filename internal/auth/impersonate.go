@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/service"
+	"go.uber.org/zap"
+)
+
+// ActionImpersonate is the user audit action recorded when an administrator
+// starts acting as another user
+const ActionImpersonate = "impersonate"
+
+// ImpersonateRequest represents a request to act as another user
+type ImpersonateRequest struct {
+	Username string `json:"username"`
+	// Reason is recorded in the audit trail, e.g. the support ticket
+	Reason string `json:"reason"`
+	// Cookie replaces the caller's browser session with the impersonation
+	// session, which ends when the token expires
+	Cookie bool `json:"cookie,omitempty"`
+}
+
+// ImpersonateResponse is a token to act as another user
+type ImpersonateResponse struct {
+	Token          string       `json:"token"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	User           UserResponse `json:"user"`
+	ImpersonatedBy Actor        `json:"impersonated_by"`
+}
+
+// ImpersonationEntry is the JSON representation of a recorded impersonation
+type ImpersonationEntry struct {
+	AuditID   int64     `json:"audit_id"`
+	ActorID   string    `json:"actor_id"`
+	UserID    string    `json:"user_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Impersonate serves /api/admin/impersonate: POST issues an administrator a
+// short-lived token to act as another user, to reproduce what they see; GET
+// lists the recorded impersonations, newest first.
+//
+// Only instance administrators holding users:impersonate, signed in
+// themselves, may impersonate, and only active users who do not hold it.
+// Every impersonation is recorded in the user audit trail before the token
+// is issued.
+func (h *Handler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.startImpersonation(w, r)
+	case http.MethodGet:
+		h.listImpersonations(w, r)
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// startImpersonation issues an impersonation token
+func (h *Handler) startImpersonation(w http.ResponseWriter, r *http.Request) {
+	db := service.WithContext(h.DB, r.Context())
+
+	// API keys and organization admins cannot impersonate, nor can a token
+	// that is itself an impersonation
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil || !claims.Permissions.Allows("users", "impersonate") || claims.OrgID != "" || claims.Impersonated() {
+		httpjson.Error(w, http.StatusForbidden, "Impersonation requires an instance administrator session")
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Username == "" || req.Reason == "" {
+		httpjson.Error(w, http.StatusBadRequest, "Username and reason are required")
+		return
+	}
+
+	user, err := db.GetUserByUsername(req.Username)
+	if err != nil {
+		h.Logger.Error("Impersonate: failed to load user", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+	if user == nil {
+		httpjson.Error(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.UserID == claims.UserID {
+		httpjson.Error(w, http.StatusBadRequest, "Cannot impersonate yourself")
+		return
+	}
+	if user.Status != "active" {
+		httpjson.Error(w, http.StatusBadRequest, "Only active users can be impersonated")
+		return
+	}
+
+	role, err := db.GetRole(user.RoleID)
+	if err != nil || role == nil {
+		h.Logger.Error("Impersonate: failed to load role", zap.String("role_id", user.RoleID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+	permissions, err := rolePermissions(db, user.RoleID)
+	if err != nil {
+		h.Logger.Error("Impersonate: failed to resolve permissions", zap.String("role_id", user.RoleID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+	if permissions.Allows("users", "impersonate") {
+		httpjson.Error(w, http.StatusForbidden, "Administrators cannot be impersonated")
+		return
+	}
+
+	// Without an audit entry there is no token
+	now := time.Now()
+	if err := db.CreateUserAuditEntry(&database.UserAuditEntry{
+		Action:    ActionImpersonate,
+		ActorID:   claims.UserID,
+		SubjectID: user.UserID,
+		Detail:    sql.NullString{String: req.Reason, Valid: true},
+		CreatedAt: now,
+	}); err != nil {
+		h.Logger.Error("Impersonate: failed to record audit entry", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+
+	actor := Actor{UserID: claims.UserID, Username: claims.Username}
+	token, expiresAt, err := GenerateImpersonationToken(actor, user.UserID, user.Username, user.Email, role.Name, user.OrgID.String)
+	if err != nil {
+		h.Logger.Error("Impersonate: failed to generate token", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+	if req.Cookie {
+		SetSessionCookie(w, r, token, expiresAt)
+	}
+
+	h.Logger.Info("User impersonation started",
+		zap.String("user_id", user.UserID),
+		zap.String("username", user.Username),
+		zap.String("impersonator_id", actor.UserID),
+		zap.String("impersonator", actor.Username),
+		zap.String("reason", req.Reason),
+		zap.Time("expires_at", expiresAt),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User: UserResponse{
+			UserID:    user.UserID,
+			Username:  user.Username,
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Role:      role.Name,
+			Status:    user.Status,
+			CreatedAt: user.CreatedAt,
+			OrgID:     user.OrgID.String,
+		},
+		ImpersonatedBy: actor,
+	})
+}
+
+// listImpersonations lists the recorded impersonations; ?limit= bounds the
+// number returned, 50 by default
+func (h *Handler) listImpersonations(w http.ResponseWriter, r *http.Request) {
+	if !CanAccessOrg(r.Context(), "") {
+		httpjson.Error(w, http.StatusForbidden, "Impersonations are visible to instance administrators only")
+		return
+	}
+
+	limit := 50
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			httpjson.Error(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := service.WithContext(h.DB, r.Context()).ListUserAuditEntries(ActionImpersonate, limit)
+	if err != nil {
+		h.Logger.Error("Impersonate: failed to list audit entries", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list impersonations")
+		return
+	}
+
+	resp := make([]ImpersonationEntry, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, ImpersonationEntry{
+			AuditID:   e.AuditID,
+			ActorID:   e.ActorID,
+			UserID:    e.SubjectID,
+			Reason:    e.Detail.String,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
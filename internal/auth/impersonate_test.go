@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+func impersonate(h *Handler, claims *Claims, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/impersonate", strings.NewReader(body))
+	if claims != nil {
+		r = r.WithContext(AddClaimsToContext(r.Context(), claims))
+	}
+	rec := httptest.NewRecorder()
+	h.Impersonate(rec, r)
+	return rec
+}
+
+func TestImpersonate(t *testing.T) {
+	h, store := setupTestHandler(t)
+	usePermissionCache(t, store, 0)
+	store.Roles["viewer-id"] = &database.Role{RoleID: "viewer-id", Name: "viewer", Permissions: `{"badges":{"read":true}}`}
+	store.Users["bob-id"] = &database.User{UserID: "bob-id", Username: "bob", Email: "bob@example.org", RoleID: "viewer-id", Status: "active"}
+	store.Users["carol-id"] = &database.User{UserID: "carol-id", Username: "carol", Email: "carol@example.org", RoleID: "viewer-id", Status: "locked"}
+	store.Roles["role-id"].Permissions = `{"*":{"*":true}}`
+	all := database.Permissions{"*": {"*": true}}
+	admin := &Claims{UserID: "user-id", Username: "alice", Role: "admin", Permissions: all}
+
+	rec := impersonate(h, admin, `{"username":"bob","reason":"ticket 42","cookie":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp ImpersonateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	claims, err := ValidateToken(resp.Token)
+	if err != nil {
+		t.Fatalf("invalid impersonation token: %v", err)
+	}
+	if claims.UserID != "bob-id" || claims.Role != "viewer" || !claims.Permissions.Allows("badges", "read") || claims.Permissions.Allows("users", "write") {
+		t.Errorf("expected a token with bob's role and permissions, got %+v", claims)
+	}
+	if claims.Actor == nil || claims.Actor.UserID != "user-id" || resp.ImpersonatedBy.Username != "alice" {
+		t.Errorf("expected alice as the actor, got %+v", claims.Actor)
+	}
+	if left := time.Until(claims.ExpiresAt.Time); left > ImpersonationExpiration {
+		t.Errorf("expected a short-lived token, got %s", left)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != resp.Token {
+		t.Errorf("expected the token in the session cookie, got %v", cookies)
+	}
+	if len(store.Audit) != 1 || store.Audit[0].ActorID != "user-id" || store.Audit[0].SubjectID != "bob-id" || store.Audit[0].Detail.String != "ticket 42" {
+		t.Errorf("expected the impersonation to be audited, got %+v", store.Audit)
+	}
+
+	// Impersonation tokens are not renewed
+	claims.ExpiresAt.Time = time.Now().Add(time.Second)
+	renew := httptest.NewRecorder()
+	renewSession(renew, httptest.NewRequest(http.MethodGet, "/admin", nil), claims)
+	if len(renew.Result().Cookies()) != 0 {
+		t.Error("expected an impersonation session not to be renewed")
+	}
+
+	for name, tc := range map[string]struct {
+		claims *Claims
+		body   string
+		status int
+	}{
+		"anonymous":      {nil, `{"username":"bob","reason":"x"}`, http.StatusForbidden},
+		"org admin":      {&Claims{UserID: "user-id", Role: "admin", OrgID: "org", Permissions: all}, `{"username":"bob","reason":"x"}`, http.StatusForbidden},
+		"not permitted":  {&Claims{UserID: "user-id", Role: "admin", Permissions: database.Permissions{"users": {"write": true}}}, `{"username":"bob","reason":"x"}`, http.StatusForbidden},
+		"impersonating":  {claims, `{"username":"bob","reason":"x"}`, http.StatusForbidden},
+		"no reason":      {admin, `{"username":"bob"}`, http.StatusBadRequest},
+		"unknown user":   {admin, `{"username":"dave","reason":"x"}`, http.StatusNotFound},
+		"self":           {admin, `{"username":"alice","reason":"x"}`, http.StatusBadRequest},
+		"inactive user":  {admin, `{"username":"carol","reason":"x"}`, http.StatusBadRequest},
+		"administrators": {&Claims{UserID: "other-id", Username: "eve", Role: "admin", Permissions: all}, `{"username":"alice","reason":"x"}`, http.StatusForbidden},
+	} {
+		if rec := impersonate(h, tc.claims, tc.body); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", name, tc.status, rec.Code, rec.Body)
+		}
+	}
+	if len(store.Audit) != 1 {
+		t.Errorf("expected refused impersonations not to be audited, got %d entries", len(store.Audit))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/impersonate", nil)
+	rec = httptest.NewRecorder()
+	h.Impersonate(rec, r.WithContext(AddClaimsToContext(r.Context(), admin)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"reason":"ticket 42"`) {
+		t.Errorf("expected the impersonation to be listed, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -3,121 +3,175 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/links"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // JWT secret key - in production, this should be loaded from environment variables or a secure configuration
 var jwtSecret = []byte("your-secret-key-here")
 
-// TokenExpiration is the duration for which a token is valid
-// Adjusted to 15 minutes per requirements
+// After RotateJWTSecret, tokens signed with the previous key stay valid until
+// they expire
+var (
+	jwtSecretMu       sync.RWMutex
+	previousJWTSecret []byte
+	previousValidTill time.Time
+)
+
+// TokenExpiration is the default duration for which a token is valid; see
+// CookieOptions.IdleTimeout
 const TokenExpiration = 15 * time.Minute
 
+// ImpersonationExpiration is how long tokens issued to act as another user
+// are valid; they are never renewed
+const ImpersonationExpiration = 15 * time.Minute
+
+// Actor is the administrator acting as the subject of an impersonation token
+type Actor struct {
+	UserID   string `json:"sub"`
+	Username string `json:"username"`
+}
+
 // Claims represents the JWT claims
 type Claims struct {
-	UserID      string `json:"sub"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
-	Role        string `json:"role"`
-	Permissions struct {
-		Badges struct {
-			Read   bool `json:"read"`
-			Write  bool `json:"write"`
-			Delete bool `json:"delete"`
-		} `json:"badges"`
-		Users struct {
-			Read   bool `json:"read"`
-			Write  bool `json:"write"`
-			Delete bool `json:"delete"`
-		} `json:"users"`
-		APIKeys struct {
-			Read   bool `json:"read"`
-			Write  bool `json:"write"`
-			Delete bool `json:"delete"`
-		} `json:"api_keys"`
-	} `json:"permissions"`
+	UserID   string `json:"sub"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	OrgID    string `json:"org,omitempty"` // organization the user administers; empty for instance-wide users
+	// Permissions are those of the role and the roles it inherits. They are
+	// not part of the token but resolved from the role when it is validated.
+	Permissions database.Permissions `json:"-"`
+	// AuthTime is when the user logged in; renewed tokens keep it
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// Actor is set on impersonation tokens to the administrator acting as
+	// the user, as the "act" claim of RFC 8693
+	Actor *Actor `json:"act,omitempty"`
+	// ClientID is set on tokens issued to an OAuth2 client, which act as the
+	// user who registered it with the permissions of Scope only
+	ClientID string `json:"client_id,omitempty"`
+	// Scope is the space-separated "resource:action" grants of a client token
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID, username, email, role string, permissions map[string]interface{}) (string, time.Time, error) {
+// Impersonated reports whether the token was issued to an administrator
+// acting as the user
+func (c *Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+// Client reports whether the token was issued to an OAuth2 client
+func (c *Claims) Client() bool {
+	return c.ClientID != ""
+}
+
+// GenerateToken generates a JWT token for a user. orgID scopes the token to an
+// organization; it is empty for instance-wide users.
+func GenerateToken(userID, username, email, role, orgID string) (string, time.Time, error) {
+	return generateToken("", userID, username, email, role, orgID)
+}
+
+// generateToken generates a JWT token for a user, identifying the recorded
+// session it belongs to in its "jti" claim unless sessionID is empty
+func generateToken(sessionID, userID, username, email, role, orgID string) (string, time.Time, error) {
 	// Set expiration time
-	expirationTime := time.Now().Add(TokenExpiration)
+	now := time.Now()
+	expirationTime := sessionExpiry(now, getCookieOptions())
+
+	claims := newClaims(userID, username, email, role, orgID, now, expirationTime)
+	claims.ID = sessionID
+	tokenString, err := signClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expirationTime, nil
+}
+
+// GenerateImpersonationToken generates a token for actor to act as a user
+// with the user's role. It expires after ImpersonationExpiration and carries
+// the actor in its "act" claim.
+func GenerateImpersonationToken(actor Actor, userID, username, email, role, orgID string) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(ImpersonationExpiration)
+
+	claims := newClaims(userID, username, email, role, orgID, now, expirationTime)
+	claims.Actor = &actor
+	tokenString, err := signClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expirationTime, nil
+}
 
+// GenerateClientToken generates a token for an OAuth2 client, acting as the
+// user who registered it with the grants of scope. It expires after ttl and is
+// never renewed; the client requests another.
+func GenerateClientToken(clientID, name, userID, orgID, scope string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(ttl)
+
+	claims := newClaims(userID, name, "", "", orgID, now, expirationTime)
+	claims.ClientID = clientID
+	claims.Scope = scope
+	tokenString, err := signClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expirationTime, nil
+}
+
+// newClaims returns the claims of a token issued at now for a user
+func newClaims(userID, username, email, role, orgID string, now, expirationTime time.Time) *Claims {
 	// Create claims
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
 		Email:    email,
 		Role:     role,
+		OrgID:    orgID,
+		AuthTime: jwt.NewNumericDate(now),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "certificates.software.geant.org",
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    links.Host(),
 		},
 	}
 
-	// Set permissions
-	if badgePerms, ok := permissions["badges"].(map[string]interface{}); ok {
-		if read, ok := badgePerms["read"].(bool); ok {
-			claims.Permissions.Badges.Read = read
-		}
-		if write, ok := badgePerms["write"].(bool); ok {
-			claims.Permissions.Badges.Write = write
-		}
-		if delete, ok := badgePerms["delete"].(bool); ok {
-			claims.Permissions.Badges.Delete = delete
-		}
-	}
-
-	if userPerms, ok := permissions["users"].(map[string]interface{}); ok {
-		if read, ok := userPerms["read"].(bool); ok {
-			claims.Permissions.Users.Read = read
-		}
-		if write, ok := userPerms["write"].(bool); ok {
-			claims.Permissions.Users.Write = write
-		}
-		if delete, ok := userPerms["delete"].(bool); ok {
-			claims.Permissions.Users.Delete = delete
-		}
-	}
-
-	if apiKeyPerms, ok := permissions["api_keys"].(map[string]interface{}); ok {
-		if read, ok := apiKeyPerms["read"].(bool); ok {
-			claims.Permissions.APIKeys.Read = read
-		}
-		if write, ok := apiKeyPerms["write"].(bool); ok {
-			claims.Permissions.APIKeys.Write = write
-		}
-		if delete, ok := apiKeyPerms["delete"].(bool); ok {
-			claims.Permissions.APIKeys.Delete = delete
-		}
-	}
+	return claims
+}
 
-	// Create token
+// signClaims creates a token for claims signed with the current key
+func signClaims(claims *Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	// Sign token
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", time.Time{}, err
-	}
-
-	return tokenString, expirationTime, nil
+	jwtSecretMu.RLock()
+	secret := jwtSecret
+	jwtSecretMu.RUnlock()
+	return token.SignedString(secret)
 }
 
 // ValidateToken validates a JWT token
 func ValidateToken(tokenString string) (*Claims, error) {
+	jwtSecretMu.RLock()
+	secret, previous := jwtSecret, previousJWTSecret
+	if time.Now().After(previousValidTill) {
+		previous = nil
+	}
+	jwtSecretMu.RUnlock()
+
 	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	token, err := parseToken(tokenString, secret)
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) && previous != nil {
+		token, err = parseToken(tokenString, previous)
+	}
 
 	if err != nil {
 		return nil, err
@@ -134,41 +188,45 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token claims")
 	}
 
-	return claims, nil
-}
-
-// RefreshToken refreshes a JWT token
-func RefreshToken(tokenString string) (string, time.Time, error) {
-	// Validate token
-	claims, err := ValidateToken(tokenString)
-	if err != nil {
-		return "", time.Time{}, err
+	// Tokens of a revoked session are no longer accepted
+	if err := checkSession(claims); err != nil {
+		return nil, err
 	}
 
-	// Create permissions map
-	permissions := map[string]interface{}{
-		"badges": map[string]interface{}{
-			"read":   claims.Permissions.Badges.Read,
-			"write":  claims.Permissions.Badges.Write,
-			"delete": claims.Permissions.Badges.Delete,
-		},
-		"users": map[string]interface{}{
-			"read":   claims.Permissions.Users.Read,
-			"write":  claims.Permissions.Users.Write,
-			"delete": claims.Permissions.Users.Delete,
-		},
-		"api_keys": map[string]interface{}{
-			"read":   claims.Permissions.APIKeys.Read,
-			"write":  claims.Permissions.APIKeys.Write,
-			"delete": claims.Permissions.APIKeys.Delete,
-		},
+	// Permissions follow the current definition of the role, or of the client
+	if err := resolveClaims(claims); err != nil {
+		return nil, err
 	}
 
-	// Generate new token
-	return GenerateToken(claims.UserID, claims.Username, claims.Email, claims.Role, permissions)
+	return claims, nil
+}
+
+// parseToken parses a JWT token signed with secret
+func parseToken(tokenString string, secret []byte) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
 }
 
 // SetJWTSecret sets the JWT secret key
 func SetJWTSecret(secret string) {
+	jwtSecretMu.Lock()
+	defer jwtSecretMu.Unlock()
 	jwtSecret = []byte(secret)
-}
\ No newline at end of file
+	previousJWTSecret = nil
+}
+
+// RotateJWTSecret replaces the JWT secret key when a mounted secret rotates.
+// Tokens signed with the previous key are accepted until they expire, so
+// that sessions are not cut short.
+func RotateJWTSecret(secret string) {
+	jwtSecretMu.Lock()
+	defer jwtSecretMu.Unlock()
+	previousJWTSecret = jwtSecret
+	previousValidTill = time.Now().Add(getCookieOptions().IdleTimeout)
+	jwtSecret = []byte(secret)
+}
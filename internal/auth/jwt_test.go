@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestRotateJWTSecret(t *testing.T) {
+	SetJWTSecret("first-secret")
+	defer SetJWTSecret("your-secret-key-here")
+
+	old, _, err := GenerateToken("1", "alice", "alice@example.org", "admin", "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	RotateJWTSecret("second-secret")
+	if _, err := ValidateToken(old); err != nil {
+		t.Errorf("expected tokens signed with the previous secret to stay valid: %v", err)
+	}
+	current, _, _ := GenerateToken("1", "alice", "alice@example.org", "admin", "")
+	if _, err := ValidateToken(current); err != nil {
+		t.Errorf("expected tokens signed with the new secret to be valid: %v", err)
+	}
+
+	// Setting the secret outright drops the previous one
+	SetJWTSecret("third-secret")
+	if _, err := ValidateToken(old); err == nil {
+		t.Error("expected tokens signed with a replaced secret to be rejected")
+	}
+}
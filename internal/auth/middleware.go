@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -34,19 +38,16 @@ func NewRateLimiter() *RateLimiter {
 func (rl *RateLimiter) RateLimitMiddleware(limit int, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get client IP address
-		clientIP := r.RemoteAddr
-		if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-			clientIP = ip
-		}
+		ip := clientIP(r)
 
 		// Check rate limit
 		rl.mu.Lock()
-		client, exists := rl.clients[clientIP]
+		client, exists := rl.clients[ip]
 		now := time.Now()
 
 		if !exists {
 			// New client
-			rl.clients[clientIP] = &ClientLimit{
+			rl.clients[ip] = &ClientLimit{
 				Count:    1,
 				LastSeen: now,
 			}
@@ -74,7 +75,7 @@ func (rl *RateLimiter) RateLimitMiddleware(limit int, next http.Handler) http.Ha
 
 		// Set rate limit headers
 		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
-		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limit-rl.clients[clientIP].Count))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limit-rl.clients[ip].Count))
 		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Minute).Unix(), 10))
 
 		rl.mu.Unlock()
@@ -84,7 +85,8 @@ func (rl *RateLimiter) RateLimitMiddleware(limit int, next http.Handler) http.Ha
 	})
 }
 
-// JWTAuthMiddleware authenticates requests using JWT tokens
+// JWTAuthMiddleware authenticates requests using JWT tokens. Protected routes
+// use Authenticator, which also accepts the session cookie and API keys.
 func JWTAuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get Authorization header
@@ -130,24 +132,18 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 func OptionalJWTFromCookie(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         // Read JWT from HttpOnly cookie if available
-        c, err := r.Cookie("jwt")
+        c, err := r.Cookie(SessionCookie)
         if err == nil && c.Value != "" {
             if claims, err := ValidateToken(c.Value); err == nil {
-                // Attach claims to context for downstream handlers
+                // Attach claims to context for downstream handlers, and
+                // keep the session of an active user alive
                 ctx := AddClaimsToContext(r.Context(), claims)
                 r = r.WithContext(ctx)
+                touchSession(r, claims)
+                renewSession(w, r, claims)
             } else {
                 // Token invalid or expired — optionally clear cookie; do not block the request
-                http.SetCookie(w, &http.Cookie{
-                    Name:     "jwt",
-                    Value:    "",
-                    Path:     "/",
-                    Expires:  time.Unix(0, 0),
-                    MaxAge:   -1,
-                    HttpOnly: true,
-                    SameSite: http.SameSiteLaxMode,
-                    // Secure: true, // enable when using HTTPS
-                })
+                ClearSessionCookie(w, r)
             }
         }
 
@@ -162,7 +158,42 @@ type APIKeyInfo struct {
 	Status         string
 	ExpiresAt      time.Time
 	IPRestrictions []string
-	Permissions    map[string]map[string]bool
+	Permissions    database.Permissions
+	// OrgID is the organization of the key's owner; empty for instance-wide keys
+	OrgID string
+	// MonthlyQuota is the number of requests allowed per UTC calendar month;
+	// 0 is unlimited
+	MonthlyQuota int64
+}
+
+// API key errors reported by CheckAPIKey
+var (
+	ErrAPIKeyNotActive = errors.New("API key is not active")
+	ErrAPIKeyExpired   = errors.New("API key has expired")
+	ErrIPNotAllowed    = errors.New("IP address not allowed")
+)
+
+// CheckAPIKey checks that an API key is active, has not expired and may be
+// used from clientIP
+func CheckAPIKey(apiKey *APIKeyInfo, clientIP string) error {
+	if apiKey.Status == "expired" {
+		return ErrAPIKeyExpired
+	}
+	if apiKey.Status != "active" {
+		return ErrAPIKeyNotActive
+	}
+	if time.Now().After(apiKey.ExpiresAt) {
+		return ErrAPIKeyExpired
+	}
+	if len(apiKey.IPRestrictions) > 0 {
+		for _, ipRange := range apiKey.IPRestrictions {
+			if strings.HasPrefix(clientIP, ipRange) {
+				return nil
+			}
+		}
+		return ErrIPNotAllowed
+	}
+	return nil
 }
 
 // APIKeyAuthMiddleware authenticates requests using API keys
@@ -177,6 +208,10 @@ func APIKeyAuthMiddleware(getAPIKey func(string) (*APIKeyInfo, error), next http
 
 		// Get API key from database
 		apiKey, err := getAPIKey(apiKeyHeader)
+		if errors.Is(err, ErrInvalidAPIKey) {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Error validating API key", http.StatusInternalServerError)
 			return
@@ -188,39 +223,14 @@ func APIKeyAuthMiddleware(getAPIKey func(string) (*APIKeyInfo, error), next http
 			return
 		}
 
-		// Check if API key is active
-		if apiKey.Status != "active" {
-			http.Error(w, "API key is not active", http.StatusUnauthorized)
-			return
-		}
-
-		// Check if API key is expired
-		if time.Now().After(apiKey.ExpiresAt) {
-			http.Error(w, "API key has expired", http.StatusUnauthorized)
-			return
-		}
-
-		// Check IP restrictions if any
-		if len(apiKey.IPRestrictions) > 0 {
-			// Get client IP address
-			clientIP := r.RemoteAddr
-			if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-				clientIP = ip
-			}
-
-			// Check if client IP is allowed
-			allowed := false
-			for _, ipRange := range apiKey.IPRestrictions {
-				if strings.HasPrefix(clientIP, ipRange) {
-					allowed = true
-					break
-				}
-			}
-
-			if !allowed {
-				http.Error(w, "IP address not allowed", http.StatusForbidden)
-				return
+		// Check status, expiry and IP restrictions
+		if err := CheckAPIKey(apiKey, clientIP(r)); err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrIPNotAllowed) {
+				status = http.StatusForbidden
 			}
+			http.Error(w, err.Error(), status)
+			return
 		}
 
 		// Add API key to request context
@@ -233,73 +243,67 @@ func APIKeyAuthMiddleware(getAPIKey func(string) (*APIKeyInfo, error), next http
 	})
 }
 
+// APIKeyOrMiddleware authenticates requests carrying an X-API-Key header with the
+// API key and hands all other requests to the fallback authentication middleware.
+//
+// Deprecated: use Authenticator, which tries every method in a fixed order.
+func APIKeyOrMiddleware(getAPIKey func(string) (*APIKeyInfo, error), fallback func(http.Handler) http.Handler, next http.Handler) http.Handler {
+	apiKeyAuth := APIKeyAuthMiddleware(getAPIKey, next)
+	fallbackAuth := fallback(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "" {
+			apiKeyAuth.ServeHTTP(w, r)
+			return
+		}
+		fallbackAuth.ServeHTTP(w, r)
+	})
+}
+
 // RequirePermissionMiddleware checks if the user has the required permission
 func RequirePermissionMiddleware(resource string, action string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get claims from context
-		claims := GetClaimsFromContext(r.Context())
-		if claims == nil {
-			// Try to get API key from context
-			apiKeyInfo, ok := GetAPIKeyFromContext(r.Context()).(*APIKeyInfo)
-			if !ok || apiKeyInfo == nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			// Check API key permissions
-			resourcePerms, ok := apiKeyInfo.Permissions[resource]
-			if !ok {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			// Check if API key has the required permission
-			hasPermission, ok := resourcePerms[action]
-			if !ok || !hasPermission {
-				http.Error(w, fmt.Sprintf("Permission denied for %s:%s", resource, action), http.StatusForbidden)
-				return
-			}
-		} else {
-			// Check JWT token permissions
-			var hasPermission bool
-
-			switch resource {
-			case "badges":
-				switch action {
-				case "read":
-					hasPermission = claims.Permissions.Badges.Read
-				case "write":
-					hasPermission = claims.Permissions.Badges.Write
-				case "delete":
-					hasPermission = claims.Permissions.Badges.Delete
-				}
-			case "users":
-				switch action {
-				case "read":
-					hasPermission = claims.Permissions.Users.Read
-				case "write":
-					hasPermission = claims.Permissions.Users.Write
-				case "delete":
-					hasPermission = claims.Permissions.Users.Delete
-				}
-			case "api_keys":
-				switch action {
-				case "read":
-					hasPermission = claims.Permissions.APIKeys.Read
-				case "write":
-					hasPermission = claims.Permissions.APIKeys.Write
-				case "delete":
-					hasPermission = claims.Permissions.APIKeys.Delete
-				}
-			}
+		// Require JWT claims or an API key
+		if GetClaimsFromContext(r.Context()) == nil && GetAPIKeyInfoFromContext(r.Context()) == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
-			if !hasPermission {
-				http.Error(w, fmt.Sprintf("Permission denied for %s:%s", resource, action), http.StatusForbidden)
-				return
-			}
+		if !HasPermission(r.Context(), resource, action) {
+			http.Error(w, fmt.Sprintf("Permission denied for %s:%s", resource, action), http.StatusForbidden)
+			return
 		}
 
 		// Call next handler
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// RequireInstanceWideMiddleware rejects callers scoped to an organization
+// with a 403 and the given message
+func RequireInstanceWideMiddleware(message string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetOrgIDFromContext(r.Context()) != "" {
+			httpjson.Error(w, http.StatusForbidden, message)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HasPermission reports whether the JWT claims or API key in ctx grant the
+// action on the resource
+func HasPermission(ctx context.Context, resource string, action string) bool {
+	// Get claims from context
+	claims := GetClaimsFromContext(ctx)
+	if claims == nil {
+		// Check API key permissions
+		apiKeyInfo := GetAPIKeyInfoFromContext(ctx)
+		if apiKeyInfo == nil {
+			return false
+		}
+		return apiKeyInfo.Permissions.Allows(resource, action)
+	}
+
+	// Check JWT token permissions
+	return claims.Permissions.Allows(resource, action)
+}
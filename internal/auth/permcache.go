@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// ErrUserNotActive is returned for tokens of users who were locked, disabled
+// or deleted since they were issued
+var ErrUserNotActive = errors.New("user is not active")
+
+// PermissionStore looks up users and their roles, e.g. *database.DB
+type PermissionStore interface {
+	UserRoleStore
+	GetUser(userID string) (*database.User, error)
+}
+
+// PermissionCache resolves the permissions of roles by name, keeping each
+// result for a while. Tokens are resolved here on every request from the
+// role their user has now, so role edits and role changes apply without a
+// new login.
+type PermissionCache struct {
+	store PermissionStore
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]permissionEntry
+}
+
+// permissionEntry is the resolved permissions of a role and when they were
+// resolved
+type permissionEntry struct {
+	permissions database.Permissions
+	loaded      time.Time
+}
+
+// NewPermissionCache returns a cache of the permissions of the roles in
+// store. Results are kept for ttl, so that edits by other processes sharing
+// the database are picked up; a ttl of 0 resolves on every request. Users
+// are looked up on every request.
+func NewPermissionCache(store PermissionStore, ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		store:   store,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]permissionEntry{},
+	}
+}
+
+// Permissions returns the permissions of the role named name, with those of
+// the roles it inherits. An unknown role grants nothing.
+func (c *PermissionCache) Permissions(name string) (database.Permissions, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.loaded) < c.ttl {
+		return entry.permissions, nil
+	}
+
+	role, err := c.store.GetRoleByName(name)
+	if err != nil {
+		return nil, err
+	}
+	permissions := database.Permissions{}
+	if role != nil {
+		if permissions, err = ResolvePermissions(c.store, role); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.entries[name] = permissionEntry{permissions: permissions, loaded: now}
+	c.mu.Unlock()
+	return permissions, nil
+}
+
+// Invalidate forgets every resolved role. Roles inherit from each other, so
+// an edit to one may change the permissions of any other.
+func (c *PermissionCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]permissionEntry{}
+}
+
+var (
+	permissionCacheMu sync.RWMutex
+	permissionCache   *PermissionCache
+)
+
+// SetPermissionCache resolves the permissions of validated tokens with cache
+// from now on. Until it is called, or with a nil cache, tokens carry no
+// permissions.
+func SetPermissionCache(cache *PermissionCache) {
+	permissionCacheMu.Lock()
+	defer permissionCacheMu.Unlock()
+	permissionCache = cache
+}
+
+// getPermissionCache returns the permission cache, or nil
+func getPermissionCache() *PermissionCache {
+	permissionCacheMu.RLock()
+	defer permissionCacheMu.RUnlock()
+	return permissionCache
+}
+
+// InvalidatePermissions makes the next request of every role resolve its
+// permissions again; call it after roles are changed
+func InvalidatePermissions() {
+	if cache := getPermissionCache(); cache != nil {
+		cache.Invalidate()
+	}
+}
+
+// UserRoleStore looks up roles by ID as well as by name, e.g. *database.DB
+type UserRoleStore interface {
+	RoleStore
+	GetRole(roleID string) (*database.Role, error)
+}
+
+// rolePermissions returns the current permissions of the role with ID roleID,
+// through the permission cache when one is set. An unknown role grants
+// nothing.
+func rolePermissions(store UserRoleStore, roleID string) (database.Permissions, error) {
+	role, err := store.GetRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return database.Permissions{}, nil
+	}
+	if cache := getPermissionCache(); cache != nil {
+		return cache.Permissions(role.Name)
+	}
+	return ResolvePermissions(store, role)
+}
+
+// resolveClaims sets the role and permissions of claims from the role their
+// user has now, or from the client they were issued to. Tokens of users who
+// are no longer active get ErrUserNotActive.
+func resolveClaims(claims *Claims) error {
+	if claims.Client() {
+		return resolveClientClaims(claims)
+	}
+	cache := getPermissionCache()
+	if cache == nil {
+		return nil
+	}
+	user, err := cache.store.GetUser(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Status != "active" {
+		return ErrUserNotActive
+	}
+	role, err := cache.store.GetRole(user.RoleID)
+	if err != nil {
+		return err
+	}
+	claims.Role = ""
+	if role != nil {
+		claims.Role = role.Name
+	}
+	permissions, err := cache.Permissions(claims.Role)
+	if err != nil {
+		return err
+	}
+	claims.Permissions = permissions
+	return nil
+}
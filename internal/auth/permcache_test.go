@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// usePermissionCache resolves the permissions of tokens from store for the
+// rest of the test
+func usePermissionCache(t *testing.T, store PermissionStore, ttl time.Duration) *PermissionCache {
+	t.Helper()
+	cache := NewPermissionCache(store, ttl)
+	SetPermissionCache(cache)
+	t.Cleanup(func() { SetPermissionCache(nil) })
+	return cache
+}
+
+func TestPermissionCache(t *testing.T) {
+	h, store := setupTestHandler(t)
+	cache := usePermissionCache(t, store, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	store.Roles["viewer-id"] = &database.Role{RoleID: "viewer-id", Name: "viewer", Permissions: `{"badges":{"read":true}}`}
+	store.Roles["role-id"].Inherits = "viewer"
+	store.Roles["role-id"].Permissions = `{"users":{"read":true}}`
+
+	// Tokens name the role only; validating them resolves its permissions
+	rec := login(h, "alice", "Correct-Horse-42")
+	var resp LoginResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("login: expected a token, got %d: %s", rec.Code, rec.Body)
+	}
+	raw := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(resp.Token, raw); err != nil {
+		t.Fatalf("invalid token: %v", err)
+	}
+	if _, ok := raw["permissions"]; ok {
+		t.Errorf("expected no permissions in the token, got %v", raw)
+	}
+	claims, err := ValidateToken(resp.Token)
+	if err != nil || !claims.Permissions.Allows("badges", "read") || !claims.Permissions.Allows("users", "read") {
+		t.Fatalf("expected the inherited permissions, got %+v (err %v)", claims, err)
+	}
+
+	// Role edits apply once the cache is invalidated or has expired
+	store.Roles["viewer-id"].Permissions = `{"badges":{"read":true,"write":true}}`
+	if claims, _ := ValidateToken(resp.Token); claims.Permissions.Allows("badges", "write") {
+		t.Errorf("expected the cached permissions before invalidation")
+	}
+	InvalidatePermissions()
+	if claims, _ := ValidateToken(resp.Token); !claims.Permissions.Allows("badges", "write") {
+		t.Errorf("expected the edit to apply after invalidation, got %v", claims.Permissions)
+	}
+	store.Roles["viewer-id"].Permissions = `{}`
+	now = now.Add(time.Minute)
+	if claims, _ := ValidateToken(resp.Token); claims.Permissions.Allows("badges", "read") {
+		t.Errorf("expected the edit to apply once the cache expired, got %v", claims.Permissions)
+	}
+
+	// The role and permissions embedded in tokens issued before are ignored
+	jwtSecretMu.RLock()
+	secret := jwtSecret
+	jwtSecretMu.RUnlock()
+	old, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":         "user-id",
+		"role":        "gone",
+		"permissions": map[string]map[string]bool{"*": {"*": true}},
+		"exp":         time.Now().Add(time.Minute).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if claims, err := ValidateToken(old); err != nil || claims.Role != "admin" || claims.Permissions.Allows("badges", "read") || !claims.Permissions.Allows("users", "read") {
+		t.Errorf("expected the permissions of the user's role, got %v (err %v)", claims, err)
+	}
+
+	// Tokens follow the user's current role and status
+	store.Users["user-id"].RoleID = "viewer-id"
+	if claims, err := ValidateToken(resp.Token); err != nil || claims.Role != "viewer" || claims.Permissions.Allows("users", "read") {
+		t.Errorf("expected the permissions of the new role, got %v (err %v)", claims, err)
+	}
+	store.Users["user-id"].RoleID = "missing-id"
+	if claims, err := ValidateToken(resp.Token); err != nil || len(claims.Permissions) != 0 {
+		t.Errorf("expected no permissions for an unknown role, got %v (err %v)", claims, err)
+	}
+	store.Users["user-id"].Status = "locked"
+	if _, err := ValidateToken(resp.Token); !errors.Is(err, ErrUserNotActive) {
+		t.Errorf("expected the token of a locked user to be refused, got %v", err)
+	}
+	delete(store.Users, "user-id")
+	if _, err := ValidateToken(resp.Token); !errors.Is(err, ErrUserNotActive) {
+		t.Errorf("expected the token of a deleted user to be refused, got %v", err)
+	}
+
+	// Failures to look up the role fail the token
+	InvalidatePermissions()
+	store.Err = errors.New("database is locked")
+	if _, err := ValidateToken(resp.Token); err == nil {
+		t.Errorf("expected a store failure to refuse the token")
+	}
+}
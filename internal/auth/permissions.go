@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// maxRoleDepth bounds the chain of roles a role inherits from
+const maxRoleDepth = 16
+
+// ErrRoleCycle is returned for roles inheriting, directly or not, from
+// themselves
+var ErrRoleCycle = errors.New("role inheritance cycle")
+
+var (
+	resourcesMu sync.RWMutex
+	// resources are the known resources and their actions
+	resources = map[string][]string{
+		"badges":   {"read", "write", "delete"},
+		"users":    {"read", "write", "delete", "impersonate"},
+		"api_keys": {"read", "write", "delete"},
+	}
+)
+
+// RegisterResource makes a resource and its actions known, so that roles
+// and API keys can be granted them. Subsystems call it from an init function;
+// registering a resource again adds to its actions.
+func RegisterResource(resource string, actions ...string) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	known := map[string]bool{}
+	for _, a := range resources[resource] {
+		known[a] = true
+	}
+	for _, a := range actions {
+		if !known[a] {
+			known[a] = true
+			resources[resource] = append(resources[resource], a)
+		}
+	}
+	if _, ok := resources[resource]; !ok {
+		resources[resource] = []string{}
+	}
+}
+
+// Resources returns the known resources and their actions
+func Resources() map[string][]string {
+	resourcesMu.RLock()
+	defer resourcesMu.RUnlock()
+	out := make(map[string][]string, len(resources))
+	for r, actions := range resources {
+		out[r] = append([]string(nil), actions...)
+	}
+	return out
+}
+
+// ValidatePermissions returns an error naming the first grant of an unknown
+// resource or action; database.Wildcard stands for any
+func ValidatePermissions(permissions database.Permissions) error {
+	known := Resources()
+	names := make([]string, 0, len(permissions))
+	for r := range permissions {
+		names = append(names, r)
+	}
+	sort.Strings(names)
+	for _, r := range names {
+		actions, ok := known[r]
+		if !ok && r != database.Wildcard {
+			return fmt.Errorf("unknown resource %q", r)
+		}
+		for a, granted := range permissions[r] {
+			if !granted || a == database.Wildcard || r == database.Wildcard {
+				continue
+			}
+			if !contains(actions, a) {
+				return fmt.Errorf("unknown action %q on %s", a, r)
+			}
+		}
+	}
+	return nil
+}
+
+// RoleStore looks up roles by name, e.g. *database.DB
+type RoleStore interface {
+	GetRoleByName(name string) (*database.Role, error)
+}
+
+// ResolvePermissions returns the permissions of role together with those of
+// the roles it inherits from. A missing parent grants nothing; a cycle is an
+// error.
+func ResolvePermissions(store RoleStore, role *database.Role) (database.Permissions, error) {
+	resolved := database.Permissions{}
+	seen := map[string]bool{}
+	for depth := 0; role != nil; depth++ {
+		if seen[role.Name] || depth >= maxRoleDepth {
+			return nil, fmt.Errorf("%w at role %q", ErrRoleCycle, role.Name)
+		}
+		seen[role.Name] = true
+
+		permissions, err := role.GetPermissions()
+		if err != nil {
+			return nil, fmt.Errorf("invalid permissions of role %q: %w", role.Name, err)
+		}
+		resolved = resolved.Merge(permissions)
+
+		if role.Inherits == "" {
+			break
+		}
+		if role, err = store.GetRoleByName(role.Inherits); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
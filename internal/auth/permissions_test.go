@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service/servicetest"
+)
+
+func TestResolvePermissions(t *testing.T) {
+	store := servicetest.NewUserStore([]*database.Role{
+		{RoleID: "1", Name: "viewer", Permissions: `{"badges":{"read":true}}`},
+		{RoleID: "2", Name: "issuer", Inherits: "viewer", Permissions: `{"badges":{"write":true}}`},
+		{RoleID: "3", Name: "loop-a", Inherits: "loop-b"},
+		{RoleID: "4", Name: "loop-b", Inherits: "loop-a"},
+		{RoleID: "5", Name: "orphan", Inherits: "gone", Permissions: `{"users":{"read":true}}`},
+	})
+
+	issuer := store.Roles["2"]
+	p, err := ResolvePermissions(store, issuer)
+	if err != nil || !p.Allows("badges", "read") || !p.Allows("badges", "write") || p.Allows("badges", "delete") {
+		t.Errorf("expected the issuer to add to the viewer, got %v (err %v)", p, err)
+	}
+	if _, err := ResolvePermissions(store, store.Roles["3"]); !errors.Is(err, ErrRoleCycle) {
+		t.Errorf("expected a cycle to be refused, got %v", err)
+	}
+	if p, err := ResolvePermissions(store, store.Roles["5"]); err != nil || !p.Allows("users", "read") {
+		t.Errorf("expected a missing parent to grant nothing more, got %v (err %v)", p, err)
+	}
+
+}
+
+func TestValidatePermissions(t *testing.T) {
+	RegisterResource("widgets", "read", "publish")
+
+	for _, tc := range []struct {
+		permissions database.Permissions
+		ok          bool
+	}{
+		{database.Permissions{"badges": {"read": true}, "widgets": {"publish": true}}, true},
+		{database.Permissions{"*": {"*": true}}, true},
+		{database.Permissions{"widgets": {"*": true}}, true},
+		{database.Permissions{"gadgets": {"read": true}}, false},
+		{database.Permissions{"badges": {"publish": true}}, false},
+		{database.Permissions{"badges": {"publish": false}}, true},
+	} {
+		if err := ValidatePermissions(tc.permissions); (err == nil) != tc.ok {
+			t.Errorf("ValidatePermissions(%v) = %v, want ok %v", tc.permissions, err, tc.ok)
+		}
+	}
+	if actions := Resources()["widgets"]; len(actions) != 2 {
+		t.Errorf("expected the registered actions, got %v", actions)
+	}
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/service"
+	"go.uber.org/zap"
+)
+
+// SessionTouchInterval is how often the last use of a session is written
+const SessionTouchInterval = time.Minute
+
+// ErrSessionRevoked is returned by ValidateToken for tokens of a revoked session
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// SessionStore records sessions, e.g. *database.DB. Each login starts a
+// session; the tokens issued for it name it in their "jti" claim.
+type SessionStore interface {
+	CreateSession(s *database.Session) error
+	GetSession(sessionID string) (*database.Session, error)
+	ListActiveSessions(userID string, now time.Time) ([]*database.Session, error)
+	TouchSession(sessionID, ip string, lastSeen time.Time) error
+	ExtendSession(sessionID string, expiresAt time.Time) error
+	RevokeSession(sessionID string, revokedAt time.Time) error
+}
+
+var (
+	sessionMu    sync.RWMutex
+	sessionStore SessionStore
+	sessionIP    = func(remoteAddr string) string { return remoteAddr }
+	// sessionTouched is when each session was last written as used
+	sessionTouched = map[string]time.Time{}
+)
+
+// SetSessionStore records sessions in store from now on; formatIP returns the
+// part of a client address that may be stored, as for the logs. Until it is
+// called, or with a nil store, tokens are not tied to a session. Tokens
+// without a session, e.g. issued before, stay valid until they expire.
+func SetSessionStore(store SessionStore, formatIP func(remoteAddr string) string) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sessionStore = store
+	if formatIP != nil {
+		sessionIP = formatIP
+	}
+	sessionTouched = map[string]time.Time{}
+}
+
+// getSessionStore returns the session store, or nil
+func getSessionStore() SessionStore {
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+	return sessionStore
+}
+
+// newSessionID returns a random session ID
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkSession returns an error unless the session of claims, if any, is
+// recorded and not revoked
+func checkSession(claims *Claims) error {
+	store := getSessionStore()
+	if store == nil || claims.ID == "" {
+		return nil
+	}
+	s, err := store.GetSession(claims.ID)
+	if err != nil {
+		return err
+	}
+	if s == nil || s.RevokedAt.Valid || s.UserID != claims.UserID {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// startSession records a session of userID started by r, returning its ID,
+// or "" when sessions are not recorded
+func startSession(r *http.Request, userID string) (string, error) {
+	store := getSessionStore()
+	if store == nil {
+		return "", nil
+	}
+	sessionID, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = service.WithContext(store, r.Context()).CreateSession(&database.Session{
+		SessionID: sessionID,
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IP:        sessionClientIP(r),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: sessionExpiry(now, getCookieOptions()),
+	})
+	if err != nil {
+		return "", err
+	}
+	sessionMu.Lock()
+	sessionTouched[sessionID] = now
+	sessionMu.Unlock()
+	return sessionID, nil
+}
+
+// touchSession records the use of the session of claims by r, at most once
+// per SessionTouchInterval
+func touchSession(r *http.Request, claims *Claims) {
+	store := getSessionStore()
+	if store == nil || claims.ID == "" {
+		return
+	}
+	now := time.Now()
+	sessionMu.Lock()
+	if now.Sub(sessionTouched[claims.ID]) < SessionTouchInterval {
+		sessionMu.Unlock()
+		return
+	}
+	// Sessions of other instances or long gone are forgotten now and then
+	if len(sessionTouched) > 10000 {
+		sessionTouched = map[string]time.Time{}
+	}
+	sessionTouched[claims.ID] = now
+	sessionMu.Unlock()
+
+	_ = service.WithContext(store, r.Context()).TouchSession(claims.ID, sessionClientIP(r), now)
+}
+
+// extendSession records the expiry of a token renewed for a session
+func extendSession(r *http.Request, sessionID string, expiresAt time.Time) {
+	if store := getSessionStore(); store != nil && sessionID != "" {
+		_ = service.WithContext(store, r.Context()).ExtendSession(sessionID, expiresAt)
+	}
+}
+
+// revokeSession ends a session, if sessions are recorded
+func revokeSession(r *http.Request, sessionID string) error {
+	store := getSessionStore()
+	if store == nil || sessionID == "" {
+		return nil
+	}
+	sessionMu.Lock()
+	delete(sessionTouched, sessionID)
+	sessionMu.Unlock()
+	return service.WithContext(store, r.Context()).RevokeSession(sessionID, time.Now())
+}
+
+// sessionClientIP returns the client address of r that may be stored
+func sessionClientIP(r *http.Request) string {
+	sessionMu.RLock()
+	format := sessionIP
+	sessionMu.RUnlock()
+	return format(clientIP(r))
+}
+
+// SessionResponse represents a session in API responses
+type SessionResponse struct {
+	SessionID string    `json:"session_id"`
+	Device    string    `json:"device"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current is set on the session of the request
+	Current bool `json:"current"`
+}
+
+// Sessions serves /api/auth/sessions: GET lists the caller's active sessions,
+// most recently seen first, and DELETE /api/auth/sessions/<id> revokes one of
+// them, e.g. on a lost laptop. The tokens of a revoked session are refused
+// from the next request on.
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	store := getSessionStore()
+	if store == nil {
+		httpjson.Error(w, http.StatusServiceUnavailable, "Sessions are not recorded")
+		return
+	}
+	store = service.WithContext(store, r.Context())
+
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		httpjson.Error(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	current := ""
+	claims := GetClaimsFromContext(r.Context())
+	if claims != nil {
+		current = claims.ID
+	}
+
+	sessionID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/sessions"), "/")
+	switch {
+	case sessionID == "" && r.Method == http.MethodGet:
+		sessions, err := store.ListActiveSessions(userID, time.Now())
+		if err != nil {
+			h.Logger.Error("Sessions: failed to list sessions", zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to list sessions")
+			return
+		}
+		resp := make([]SessionResponse, 0, len(sessions))
+		for _, s := range sessions {
+			resp = append(resp, SessionResponse{
+				SessionID: s.SessionID,
+				Device:    deviceName(s.UserAgent),
+				UserAgent: s.UserAgent,
+				IP:        s.IP,
+				CreatedAt: s.CreatedAt,
+				LastSeen:  s.LastSeen,
+				ExpiresAt: s.ExpiresAt,
+				Current:   s.SessionID == current,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+
+	case sessionID != "" && !strings.Contains(sessionID, "/") && r.Method == http.MethodDelete:
+		// Administrators acting as a user may not sign them out
+		if claims != nil && claims.Impersonated() {
+			httpjson.Error(w, http.StatusForbidden, "Sessions cannot be revoked while impersonating")
+			return
+		}
+		s, err := store.GetSession(sessionID)
+		if err != nil {
+			h.Logger.Error("Sessions: failed to load session", zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to revoke session")
+			return
+		}
+		if s == nil || s.UserID != userID || s.RevokedAt.Valid {
+			httpjson.Error(w, http.StatusNotFound, "Session not found")
+			return
+		}
+		if err := revokeSession(r, sessionID); err != nil {
+			h.Logger.Error("Sessions: failed to revoke session", zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to revoke session")
+			return
+		}
+		h.Logger.Info("Session revoked",
+			zap.String("user_id", userID),
+			zap.String("session_id", sessionID),
+			zap.Bool("current", sessionID == current),
+		)
+		if sessionID == current {
+			ClearSessionCookie(w, r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+
+	case sessionID == "" || r.Method != http.MethodDelete:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		httpjson.Error(w, http.StatusNotFound, "Session not found")
+	}
+}
+
+// deviceName describes the browser and operating system of a user agent,
+// e.g. "Firefox on Linux"
+func deviceName(userAgent string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"Go-http-client/", "Go client"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
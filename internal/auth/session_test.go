@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	h, store := setupTestHandler(t)
+	SetSessionStore(store, func(string) string { return "192.0.2.0" })
+	t.Cleanup(func() { SetSessionStore(nil, nil) })
+
+	loginFrom := func(userAgent string) LoginResponse {
+		t.Helper()
+		body, _ := json.Marshal(LoginRequest{Username: "alice", Password: "Correct-Horse-42"})
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(body))
+		r.Header.Set("User-Agent", userAgent)
+		h.Login(rec, r)
+		var resp LoginResponse
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+			t.Fatalf("login: expected a token, got %d: %s", rec.Code, rec.Body)
+		}
+		return resp
+	}
+	laptop := loginFrom("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	phone := loginFrom("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	sessions := func(token, method, path string) *httptest.ResponseRecorder {
+		claims, err := ValidateToken(token)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		r := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		h.Sessions(rec, r.WithContext(AddClaimsToContext(r.Context(), claims)))
+		return rec
+	}
+
+	rec := sessions(phone.Token, http.MethodGet, "/api/auth/sessions")
+	var list []SessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("expected two sessions, got %d: %s", rec.Code, rec.Body)
+	}
+	devices := map[string]SessionResponse{}
+	for _, s := range list {
+		devices[s.Device] = s
+	}
+	if s := devices["Safari on iOS"]; !s.Current || s.IP != "192.0.2.0" {
+		t.Errorf("expected the phone to be the current session, got %+v", list)
+	}
+	lost, ok := devices["Firefox on Linux"]
+	if !ok || lost.Current {
+		t.Fatalf("expected the laptop session, got %+v", list)
+	}
+
+	// Revoking the lost laptop ends its token, not the phone's
+	if rec := sessions(phone.Token, http.MethodDelete, "/api/auth/sessions/"+lost.SessionID); rec.Code != http.StatusOK {
+		t.Fatalf("expected the session to be revoked, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := ValidateToken(laptop.Token); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("expected the laptop token to be refused, got %v", err)
+	}
+	if rec := sessions(phone.Token, http.MethodDelete, "/api/auth/sessions/"+lost.SessionID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a revoked session not to be found again, got %d", rec.Code)
+	}
+	if rec := sessions(phone.Token, http.MethodDelete, "/api/auth/sessions/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", rec.Code)
+	}
+
+	// Logging out revokes the session as well
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: phone.Token})
+	h.Logout(httptest.NewRecorder(), r)
+	if _, err := ValidateToken(phone.Token); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("expected the token to be refused after logging out, got %v", err)
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	for ua, want := range map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":            "Chrome on macOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":         "Chrome on Android",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	} {
+		if got := deviceName(ua); got != want {
+			t.Errorf("deviceName(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
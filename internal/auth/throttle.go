@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service"
+)
+
+// ThrottleWindow is how long failed logins are remembered: counts start over
+// after a day without failures
+const ThrottleWindow = 24 * time.Hour
+
+// throttleBaseDelay is the first backoff once the free attempts are used up;
+// it doubles with every further failure
+const throttleBaseDelay = time.Second
+
+// ThrottleStore counts failed logins, e.g. *database.DB, whose counts every
+// process on the database shares
+type ThrottleStore interface {
+	GetLoginFailure(key string) (*database.LoginFailure, error)
+	RecordLoginFailure(key string, at, resetBefore time.Time) (int, error)
+	BlockLogin(key string, until time.Time) error
+	DeleteLoginFailure(key string) error
+}
+
+// CaptchaVerifier checks the CAPTCHA response a login form sent
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, response, remoteIP string) (bool, error)
+}
+
+// ThrottleOptions configure a LoginThrottle. A zero count disables the
+// measure it bounds.
+type ThrottleOptions struct {
+	// UserAttempts and IPAttempts are the failed logins allowed for a username
+	// and from a client address before each further attempt waits for an
+	// exponential backoff, up to MaxDelay
+	UserAttempts int
+	IPAttempts   int
+	MaxDelay     time.Duration
+	// BanAttempts failed logins from a client address ban it for BanDuration
+	BanAttempts int
+	BanDuration time.Duration
+	// CaptchaAttempts failed logins for a username or from an address make
+	// Captcha check a CAPTCHA response with every further login
+	CaptchaAttempts int
+	Captcha         CaptchaVerifier
+}
+
+// LoginThrottle slows down guessing passwords without locking the victim out:
+// failed logins for a username or from a client address make the next
+// attempts wait, many from one address ban it for a while, and past a
+// threshold a CAPTCHA can be required.
+type LoginThrottle struct {
+	store ThrottleStore
+	opts  ThrottleOptions
+	now   func() time.Time
+}
+
+// NewLoginThrottle creates a login throttle counting failures in store
+func NewLoginThrottle(store ThrottleStore, opts ThrottleOptions) *LoginThrottle {
+	return &LoginThrottle{store: store, opts: opts, now: time.Now}
+}
+
+// throttleCheck is the verdict on a login attempt
+type throttleCheck struct {
+	// retryAfter is how long the attempt must wait; 0 lets it through
+	retryAfter time.Duration
+	// banned is set when the client address is banned
+	banned bool
+	// captcha is set when the attempt must pass a CAPTCHA
+	captcha bool
+}
+
+// check returns whether a login for username from r may proceed
+func (t *LoginThrottle) check(r *http.Request, username string) (throttleCheck, error) {
+	store := service.WithContext(t.store, r.Context())
+	now := t.now()
+	var verdict throttleCheck
+	for _, key := range []string{userThrottleKey(username), ipThrottleKey(r)} {
+		f, err := store.GetLoginFailure(key)
+		if err != nil {
+			return throttleCheck{}, err
+		}
+		if f == nil {
+			continue
+		}
+		if f.BlockedUntil.Valid && f.BlockedUntil.Time.After(now) {
+			if wait := f.BlockedUntil.Time.Sub(now); wait > verdict.retryAfter {
+				verdict.retryAfter = wait
+			}
+			if strings.HasPrefix(key, "ip:") && t.opts.BanAttempts > 0 && f.Failures >= t.opts.BanAttempts {
+				verdict.banned = true
+			}
+		} else if f.LastFailure.Before(now.Add(-ThrottleWindow)) {
+			// Forgotten, and deleted with the next failure
+			continue
+		}
+		if t.opts.Captcha != nil && t.opts.CaptchaAttempts > 0 && f.Failures >= t.opts.CaptchaAttempts {
+			verdict.captcha = true
+		}
+	}
+	return verdict, nil
+}
+
+// fail counts a failed login for username from r and blocks further attempts
+// for the backoff it earned
+func (t *LoginThrottle) fail(r *http.Request, username string) error {
+	store := service.WithContext(t.store, r.Context())
+	now := t.now()
+	for _, key := range []string{userThrottleKey(username), ipThrottleKey(r)} {
+		failures, err := store.RecordLoginFailure(key, now, now.Add(-ThrottleWindow))
+		if err != nil {
+			return err
+		}
+		var block time.Duration
+		if strings.HasPrefix(key, "ip:") {
+			block = backoff(failures, t.opts.IPAttempts, t.opts.MaxDelay)
+			if t.opts.BanAttempts > 0 && failures >= t.opts.BanAttempts && t.opts.BanDuration > block {
+				block = t.opts.BanDuration
+			}
+		} else {
+			block = backoff(failures, t.opts.UserAttempts, t.opts.MaxDelay)
+		}
+		if block > 0 {
+			if err := store.BlockLogin(key, now.Add(block)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// succeed resets the failures counted for username. Those of the client
+// address are kept, so that one known password does not hide guessing others.
+func (t *LoginThrottle) succeed(r *http.Request, username string) error {
+	return service.WithContext(t.store, r.Context()).DeleteLoginFailure(userThrottleKey(username))
+}
+
+// verifyCaptcha checks the CAPTCHA response of a login from r
+func (t *LoginThrottle) verifyCaptcha(r *http.Request, response string) (bool, error) {
+	if response == "" {
+		return false, nil
+	}
+	return t.opts.Captcha.Verify(r.Context(), response, clientIP(r))
+}
+
+// backoff returns how long to block after failures when free of them are
+// allowed: nothing at first, then a delay doubling from throttleBaseDelay
+// up to max
+func backoff(failures, free int, max time.Duration) time.Duration {
+	if free <= 0 || failures < free {
+		return 0
+	}
+	delay := throttleBaseDelay
+	for i := free; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// userThrottleKey is the key failures for a username are counted under.
+// Usernames and emails are matched case-insensitively here, so that changing
+// the case does not start a fresh count.
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// ipThrottleKey is the key failures from the client address of r are
+// counted under; behind a trusted proxy it is the forwarded client's
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// SiteVerifyCaptcha verifies CAPTCHA responses with a siteverify endpoint, as
+// offered by reCAPTCHA, hCaptcha and Cloudflare Turnstile: the secret,
+// response and remote IP are posted as a form, and the JSON answer reports
+// "success".
+type SiteVerifyCaptcha struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// Verify reports whether the provider accepts a CAPTCHA response
+func (c *SiteVerifyCaptcha) Verify(ctx context.Context, response, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {c.Secret}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify CAPTCHA: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to verify CAPTCHA: %s", resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to verify CAPTCHA: %w", err)
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCaptcha accepts the response "ok"
+type fakeCaptcha struct{}
+
+func (fakeCaptcha) Verify(_ context.Context, response, _ string) (bool, error) {
+	return response == "ok", nil
+}
+
+func loginWith(h *Handler, req LoginRequest, remoteAddr string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(string(body)))
+	r.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.Login(rec, r)
+	return rec
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		failures, free int
+		want           time.Duration
+	}{
+		{2, 3, 0},
+		{3, 3, time.Second},
+		{4, 3, 2 * time.Second},
+		{6, 3, 8 * time.Second},
+		{30, 3, time.Minute},
+		{100, 0, 0},
+	} {
+		if got := backoff(tc.failures, tc.free, time.Minute); got != tc.want {
+			t.Errorf("backoff(%d, %d) = %s, want %s", tc.failures, tc.free, got, tc.want)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	h, store := setupTestHandler(t)
+	throttle := NewLoginThrottle(store, ThrottleOptions{
+		UserAttempts: 3,
+		IPAttempts:   10,
+		MaxDelay:     time.Minute,
+		BanAttempts:  20,
+		BanDuration:  time.Hour,
+	})
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+	h.SetThrottle(throttle)
+
+	wrong := LoginRequest{Username: "alice", Password: "wrong"}
+	for i := 1; i <= 3; i++ {
+		if rec := loginWith(h, wrong, "192.0.2.1:1000"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+
+	// The username waits, even with the right password and from elsewhere
+	rec := loginWith(h, LoginRequest{Username: "Alice", Password: "Correct-Horse-42"}, "198.51.100.7:1000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After 1, got %d %q: %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+	}
+	if u := store.Users["user-id"]; u.Status != "active" || u.FailedAttempts != 3 {
+		t.Errorf("expected the account not to be locked, got %q", u.Status)
+	}
+
+	// Once the backoff has passed, the right password resets the username
+	now = now.Add(2 * time.Second)
+	if rec := loginWith(h, LoginRequest{Username: "alice", Password: "Correct-Horse-42"}, "198.51.100.7:1000"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the login to pass after the backoff, got %d: %s", rec.Code, rec.Body)
+	}
+	if f := store.LoginFailures["user:alice"]; f != nil {
+		t.Errorf("expected a successful login to reset the username, got %+v", f)
+	}
+	if f := store.LoginFailures["ip:192.0.2.1"]; f == nil || f.Failures != 3 {
+		t.Errorf("expected the client address to keep its failures, got %+v", f)
+	}
+
+	// Guessing many usernames from one address bans it
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Hour)
+		loginWith(h, LoginRequest{Username: "user" + string(rune('a'+i)), Password: "wrong"}, "203.0.113.9:1000")
+	}
+	rec = loginWith(h, LoginRequest{Username: "alice", Password: "Correct-Horse-42"}, "203.0.113.9:2000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("expected the address to be banned for an hour, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := loginWith(h, LoginRequest{Username: "alice", Password: "Correct-Horse-42"}, "198.51.100.7:1000"); rec.Code != http.StatusOK {
+		t.Errorf("expected other addresses not to be banned, got %d", rec.Code)
+	}
+}
+
+func TestLoginThrottleCaptcha(t *testing.T) {
+	h, store := setupTestHandler(t)
+	h.SetThrottle(NewLoginThrottle(store, ThrottleOptions{
+		MaxDelay:        time.Minute,
+		CaptchaAttempts: 2,
+		Captcha:         fakeCaptcha{},
+	}))
+
+	wrong := LoginRequest{Username: "alice", Password: "wrong"}
+	loginWith(h, wrong, "192.0.2.1:1000")
+	loginWith(h, wrong, "192.0.2.1:1000")
+
+	right := LoginRequest{Username: "alice", Password: "Correct-Horse-42"}
+	for _, captcha := range []string{"", "bad"} {
+		right.Captcha = captcha
+		rec := loginWith(h, right, "198.51.100.7:1000")
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"captcha_required":true`) {
+			t.Errorf("captcha %q: expected a CAPTCHA to be required, got %d: %s", captcha, rec.Code, rec.Body)
+		}
+	}
+	right.Captcha = "ok"
+	if rec := loginWith(h, right, "198.51.100.7:1000"); rec.Code != http.StatusOK {
+		t.Errorf("expected a solved CAPTCHA to let the login through, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSiteVerifyCaptcha(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := r.PostFormValue("secret") == "s3cret" && r.PostFormValue("response") == "token" && r.PostFormValue("remoteip") == "192.0.2.1"
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": ok})
+	}))
+	defer srv.Close()
+
+	c := &SiteVerifyCaptcha{URL: srv.URL, Secret: "s3cret"}
+	if ok, err := c.Verify(context.Background(), "token", "192.0.2.1"); err != nil || !ok {
+		t.Errorf("expected the response to be accepted, got %v, %v", ok, err)
+	}
+	if ok, err := c.Verify(context.Background(), "forged", "192.0.2.1"); err != nil || ok {
+		t.Errorf("expected the response to be refused, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/service"
+	"go.uber.org/zap"
+)
+
+// CreateUserRequest represents a request to create a new user
+type CreateUserRequest struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+	// OrgID puts the user in an organization. Organization admins can only
+	// create users in their own organization.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// ResetPasswordRequest represents an administrative password reset
+type ResetPasswordRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// UserResponse represents a user in API responses
+type UserResponse struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	OrgID     string    `json:"org_id,omitempty"`
+}
+
+// CreateUser handles the creation of a new user account
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	db := service.WithContext(h.DB, r.Context())
+
+	if r.Method != http.MethodPost {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Email = database.NormalizeEmail(req.Email)
+	if req.Username == "" || req.Email == "" || req.Password == "" || req.Role == "" {
+		httpjson.Error(w, http.StatusBadRequest, "Username, email, password and role are required")
+		return
+	}
+	// Login takes identifiers with an @ for emails
+	if strings.Contains(req.Username, "@") {
+		httpjson.Error(w, http.StatusBadRequest, "Username cannot contain @")
+		return
+	}
+	if err := ValidatePassword(req.Password); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := db.GetRoleByName(req.Role)
+	if err != nil {
+		h.Logger.Error("CreateUser: failed to load role", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+	if role == nil {
+		httpjson.Error(w, http.StatusBadRequest, fmt.Sprintf("Unknown role %q", req.Role))
+		return
+	}
+
+	// Organization admins create users in their own organization only
+	if scope := GetOrgIDFromContext(r.Context()); scope != "" {
+		if req.OrgID != "" && req.OrgID != scope {
+			httpjson.Error(w, http.StatusForbidden, "Users can only be created in your own organization")
+			return
+		}
+		req.OrgID = scope
+	} else if req.OrgID != "" {
+		org, err := db.GetOrganization(req.OrgID)
+		if err != nil {
+			h.Logger.Error("CreateUser: failed to load organization", zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to create user")
+			return
+		}
+		if org == nil {
+			httpjson.Error(w, http.StatusBadRequest, fmt.Sprintf("Unknown organization %q", req.OrgID))
+			return
+		}
+	}
+
+	// Usernames and emails are both valid login identifiers, so both must be unique
+	if existing, err := db.GetUserByUsername(req.Username); err == nil && existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Username already exists")
+		return
+	}
+	if existing, err := db.GetUserByEmail(req.Email); err == nil && existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Email already exists")
+		return
+	}
+
+	hashed, err := HashPassword(req.Password)
+	if err != nil {
+		h.Logger.Error("CreateUser: failed to hash password", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	now := time.Now()
+	user := &database.User{
+		UserID:       fmt.Sprintf("user_%x", now.UnixNano()),
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hashed,
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		RoleID:       role.RoleID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Status:       "active",
+		OrgID:        sql.NullString{String: req.OrgID, Valid: req.OrgID != ""},
+	}
+	if err := db.CreateUser(user); err != nil {
+		h.Logger.Error("CreateUser: failed to persist user", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	h.Logger.Info("User created",
+		zap.String("user_id", user.UserID),
+		zap.String("username", user.Username),
+		zap.String("created_by", GetUserIDFromContext(r.Context())),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(UserResponse{
+		UserID:    user.UserID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      role.Name,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		OrgID:     req.OrgID,
+	})
+}
+
+// ResetPassword sets a new password for another user and unlocks the account. The
+// password is treated as one-time: the user must change it on next login.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	db := service.WithContext(h.DB, r.Context())
+
+	if r.Method != http.MethodPost {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		httpjson.Error(w, http.StatusBadRequest, "Username and password are required")
+		return
+	}
+	if err := ValidatePassword(req.Password); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := db.GetUserByUsername(req.Username)
+	if err != nil {
+		h.Logger.Error("ResetPassword: failed to load user", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if user == nil || !CanAccessOrg(r.Context(), user.OrgID.String) {
+		httpjson.Error(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	hashed, err := HashPassword(req.Password)
+	if err != nil {
+		h.Logger.Error("ResetPassword: failed to hash password", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	// A reset also lifts a lockout caused by failed login attempts
+	user.PasswordHash = hashed
+	user.FailedAttempts = 0
+	user.MustChangePassword = true
+	if user.Status == "locked" {
+		user.Status = "active"
+	}
+	user.UpdatedAt = time.Now()
+	if err := db.UpdateUser(user); err != nil {
+		h.Logger.Error("ResetPassword: failed to persist password", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	h.Logger.Info("Password reset",
+		zap.String("user_id", user.UserID),
+		zap.String("reset_by", GetUserIDFromContext(r.Context())),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "password_reset"})
+}
@@ -24,42 +24,72 @@ func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handle
 	return &Handler{db: db, logger: logger, cache: cache}
 }
 
+// adminName returns the name of the requesting administrator. Requests made with
+// an API key are attributed to the key's owner, who must hold the admin role.
+// Organization admins are not instance administrators.
+func (h *Handler) adminName(r *http.Request) (string, bool) {
+	db := h.db.WithContext(r.Context())
+
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		return "", false
+	}
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
+		return claims.Username, claims.Role == "admin"
+	}
+
+	apiKey := auth.GetAPIKeyInfoFromContext(r.Context())
+	if apiKey == nil {
+		return "", false
+	}
+	user, err := db.GetUser(apiKey.UserID)
+	if err != nil || user == nil {
+		return "", false
+	}
+	role, err := db.GetRole(user.RoleID)
+	if err != nil || role == nil {
+		return "", false
+	}
+	return user.Username, role.Name == "admin"
+}
+
 // Backup exports the entire database as a JSON download.
 func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Defense-in-depth: verify admin role even though middleware already checks permission
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil || claims.Role != "admin" {
+	requester, ok := h.adminName(r)
+	if !ok {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	roles, err := h.db.ListRoles()
+	roles, err := db.ListRoles()
 	if err != nil {
 		h.logger.Error("backup: failed to list roles", zap.Error(err))
 		http.Error(w, "Failed to read roles", http.StatusInternalServerError)
 		return
 	}
 
-	users, err := h.db.ListUsers()
+	users, err := db.ListUsers()
 	if err != nil {
 		h.logger.Error("backup: failed to list users", zap.Error(err))
 		http.Error(w, "Failed to read users", http.StatusInternalServerError)
 		return
 	}
 
-	apiKeys, err := h.db.ListAPIKeys()
+	apiKeys, err := db.ListAPIKeys()
 	if err != nil {
 		h.logger.Error("backup: failed to list API keys", zap.Error(err))
 		http.Error(w, "Failed to read API keys", http.StatusInternalServerError)
 		return
 	}
 
-	badges, err := h.db.ListBadges()
+	badges, err := db.ListBadges()
 	if err != nil {
 		h.logger.Error("backup: failed to list badges", zap.Error(err))
 		http.Error(w, "Failed to read badges", http.StatusInternalServerError)
@@ -70,7 +100,7 @@ func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
 		Metadata: BackupMetadata{
 			Version:     1,
 			CreatedAt:   time.Now().UTC().Format(timeFormat),
-			CreatedBy:   claims.Username,
+			CreatedBy:   requester,
 			Application: "CertifyHub",
 		},
 		Data: BackupData{
@@ -101,8 +131,8 @@ func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims := auth.GetClaimsFromContext(r.Context())
-	if claims == nil || claims.Role != "admin" {
+	requester, ok := h.adminName(r)
+	if !ok {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -159,10 +189,14 @@ func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	badges := dtosToBadges(doc.Data.Badges)
+	badges, err := dtosToBadges(doc.Data.Badges)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid badge data: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Perform transactional restore
-	if err := h.db.RestoreAll(roles, users, apiKeys, badges); err != nil {
+	if err := h.db.WithContext(r.Context()).RestoreAll(roles, users, apiKeys, badges); err != nil {
 		h.logger.Error("backup: restore failed", zap.Error(err))
 		http.Error(w, "Restore failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -171,12 +205,15 @@ func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
 	// Clear cache so pages reflect restored data
 	h.cache.Clear()
 
+	// Restored roles replace the permissions resolved so far
+	auth.InvalidatePermissions()
+
 	h.logger.Info("backup: restore completed",
 		zap.Int("roles", len(roles)),
 		zap.Int("users", len(users)),
 		zap.Int("api_keys", len(apiKeys)),
 		zap.Int("badges", len(badges)),
-		zap.String("restored_by", claims.Username),
+		zap.String("restored_by", requester),
 	)
 
 	w.Header().Set("Content-Type", "application/json")
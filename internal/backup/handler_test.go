@@ -19,7 +19,7 @@ import (
 	"go.uber.org/zap"
 )
 
-// setupTestDB creates a temporary SQLite database for testing.
+// setupTestDB creates a temporary SQLite database with one badge for testing.
 func setupTestDB(t *testing.T) (*database.DB, func()) {
 	t.Helper()
 	dbFile := "test_backup_" + t.Name() + ".db"
@@ -28,6 +28,18 @@ func setupTestDB(t *testing.T) (*database.DB, func()) {
 	if err != nil {
 		t.Fatalf("failed to create test DB: %v", err)
 	}
+	// Fresh databases start without badges, so add one for the backup to carry
+	if err := db.CreateBadge(&database.Badge{
+		CommitID:        "seed_badge",
+		Type:            "badge",
+		Status:          "valid",
+		Issuer:          "Test",
+		IssueDate:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName:    "Seed",
+		SoftwareVersion: "v1.0.0",
+	}); err != nil {
+		t.Fatalf("failed to create test badge: %v", err)
+	}
 	cleanup := func() {
 		db.Close()
 		os.Remove(dbFile)
@@ -43,7 +55,7 @@ func adminContext() context.Context {
 		Email:    "admin@example.com",
 		Role:     "admin",
 	}
-	claims.Permissions.Users.Write = true
+	claims.Permissions = database.Permissions{"users": {"write": true}}
 	return auth.AddClaimsToContext(context.Background(), claims)
 }
 
@@ -247,7 +259,7 @@ func TestRestoreSuccess(t *testing.T) {
 		Type:            "badge",
 		Status:          "valid",
 		Issuer:          "Test",
-		IssueDate:       "2024-01-01",
+		IssueDate:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 		SoftwareName:    "Extra",
 		SoftwareVersion: "v1.0.0",
 	})
@@ -547,7 +559,7 @@ func TestBackupRestoreRoundTrip(t *testing.T) {
 	// Add a badge with nullable fields
 	db.CreateBadge(&database.Badge{
 		CommitID: "roundtrip", Type: "badge", Status: "valid", Issuer: "Test",
-		IssueDate: "2024-06-01", SoftwareName: "RT", SoftwareVersion: "v2",
+		IssueDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "RT", SoftwareVersion: "v2",
 		SoftwareURL: sql.NullString{String: "https://rt.example.com", Valid: true},
 		Notes:       sql.NullString{},
 	})
@@ -2,6 +2,7 @@ package backup
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/finki/badges/internal/database"
@@ -35,24 +36,27 @@ type RoleDTO struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Permissions string `json:"permissions"`
+	Inherits    string `json:"inherits,omitempty"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 }
 
 // UserDTO is the JSON-serializable representation of a database.User.
 type UserDTO struct {
-	UserID         string  `json:"user_id"`
-	Username       string  `json:"username"`
-	Email          string  `json:"email"`
-	PasswordHash   string  `json:"password_hash"`
-	FirstName      string  `json:"first_name"`
-	LastName       string  `json:"last_name"`
-	RoleID         string  `json:"role_id"`
-	CreatedAt      string  `json:"created_at"`
-	UpdatedAt      string  `json:"updated_at"`
-	LastLogin      *string `json:"last_login"`
-	Status         string  `json:"status"`
-	FailedAttempts int     `json:"failed_attempts"`
+	UserID             string  `json:"user_id"`
+	Username           string  `json:"username"`
+	Email              string  `json:"email"`
+	PasswordHash       string  `json:"password_hash"`
+	FirstName          string  `json:"first_name"`
+	LastName           string  `json:"last_name"`
+	RoleID             string  `json:"role_id"`
+	CreatedAt          string  `json:"created_at"`
+	UpdatedAt          string  `json:"updated_at"`
+	LastLogin          *string `json:"last_login"`
+	Status             string  `json:"status"`
+	FailedAttempts     int     `json:"failed_attempts"`
+	MustChangePassword bool    `json:"must_change_password,omitempty"`
+	OrgID              *string `json:"org_id,omitempty"`
 }
 
 // APIKeyDTO is the JSON-serializable representation of a database.APIKey.
@@ -67,34 +71,45 @@ type APIKeyDTO struct {
 	LastUsed       *string `json:"last_used"`
 	Status         string  `json:"status"`
 	IPRestrictions string  `json:"ip_restrictions"`
+	MonthlyQuota   int64   `json:"monthly_quota,omitempty"`
+	NotifyURL      string  `json:"notify_url,omitempty"`
+	ExpiryNotice   int     `json:"expiry_notice,omitempty"`
+	LookupHash     string  `json:"lookup_hash,omitempty"`
 }
 
 // BadgeDTO is the JSON-serializable representation of a database.Badge.
 // Binary image fields (JPG/PNG) are excluded — they can be regenerated.
 type BadgeDTO struct {
-	CommitID        string  `json:"commit_id"`
-	Type            string  `json:"type"`
-	Status          string  `json:"status"`
-	Issuer          string  `json:"issuer"`
-	IssueDate       string  `json:"issue_date"`
-	SoftwareName    string  `json:"software_name"`
-	SoftwareVersion string  `json:"software_version"`
-	SoftwareURL     *string `json:"software_url"`
-	Notes           *string `json:"notes"`
-	SVGContent      *string `json:"svg_content"`
-	ExpiryDate      *string `json:"expiry_date"`
-	IssuerURL       *string `json:"issuer_url"`
-	CustomConfig    *string `json:"custom_config"`
-	LastReview      *string `json:"last_review"`
-	CoveredVersion  *string `json:"covered_version"`
-	RepositoryLink  *string `json:"repository_link"`
-	PublicNote      *string `json:"public_note"`
-	InternalNote    *string `json:"internal_note"`
-	ContactDetails  *string `json:"contact_details"`
-	CertificateName *string `json:"certificate_name"`
-	SpecialtyDomain *string `json:"specialty_domain"`
-	SoftwareSCID    *string `json:"software_sc_id"`
-	SoftwareSCURL   *string `json:"software_sc_url"`
+	CommitID          string  `json:"commit_id"`
+	Type              string  `json:"type"`
+	Status            string  `json:"status"`
+	Issuer            string  `json:"issuer"`
+	IssueDate         string  `json:"issue_date"`
+	SoftwareName      string  `json:"software_name"`
+	SoftwareVersion   string  `json:"software_version"`
+	SoftwareURL       *string `json:"software_url"`
+	Notes             *string `json:"notes"`
+	SVGContent        *string `json:"svg_content"`
+	ExpiryDate        *string `json:"expiry_date"`
+	IssuerURL         *string `json:"issuer_url"`
+	CustomConfig      *string `json:"custom_config"`
+	LastReview        *string `json:"last_review"`
+	CoveredVersion    *string `json:"covered_version"`
+	RepositoryLink    *string `json:"repository_link"`
+	PublicNote        *string `json:"public_note"`
+	InternalNote      *string `json:"internal_note"`
+	ContactDetails    *string `json:"contact_details"`
+	CertificateName   *string `json:"certificate_name"`
+	SpecialtyDomain   *string `json:"specialty_domain"`
+	SoftwareSCID      *string `json:"software_sc_id"`
+	SoftwareSCURL     *string `json:"software_sc_url"`
+	GitRepository     *string `json:"git_repository,omitempty"`
+	GitCommitSHA      *string `json:"git_commit_sha,omitempty"`
+	GitTag            *string `json:"git_tag,omitempty"`
+	IssuerID          *string `json:"issuer_id,omitempty"`
+	CertificateTypeID *string `json:"certificate_type_id,omitempty"`
+	OrgID             *string `json:"org_id,omitempty"`
+	PublishAt         *string `json:"publish_at,omitempty"`
 }
 
 const timeFormat = time.RFC3339
@@ -109,6 +124,7 @@ func rolesToDTOs(roles []*database.Role) []RoleDTO {
 			Name:        r.Name,
 			Description: r.Description,
 			Permissions: r.Permissions,
+			Inherits:    r.Inherits,
 			CreatedAt:   r.CreatedAt.Format(timeFormat),
 			UpdatedAt:   r.UpdatedAt.Format(timeFormat),
 		}
@@ -132,6 +148,7 @@ func dtosToRoles(dtos []RoleDTO) ([]*database.Role, error) {
 			Name:        d.Name,
 			Description: d.Description,
 			Permissions: d.Permissions,
+			Inherits:    d.Inherits,
 			CreatedAt:   createdAt,
 			UpdatedAt:   updatedAt,
 		}
@@ -145,17 +162,19 @@ func usersToDTOs(users []*database.User) []UserDTO {
 	dtos := make([]UserDTO, len(users))
 	for i, u := range users {
 		dto := UserDTO{
-			UserID:         u.UserID,
-			Username:       u.Username,
-			Email:          u.Email,
-			PasswordHash:   u.PasswordHash,
-			FirstName:      u.FirstName,
-			LastName:       u.LastName,
-			RoleID:         u.RoleID,
-			CreatedAt:      u.CreatedAt.Format(timeFormat),
-			UpdatedAt:      u.UpdatedAt.Format(timeFormat),
-			Status:         u.Status,
-			FailedAttempts: u.FailedAttempts,
+			UserID:             u.UserID,
+			Username:           u.Username,
+			Email:              u.Email,
+			PasswordHash:       u.PasswordHash,
+			FirstName:          u.FirstName,
+			LastName:           u.LastName,
+			RoleID:             u.RoleID,
+			CreatedAt:          u.CreatedAt.Format(timeFormat),
+			UpdatedAt:          u.UpdatedAt.Format(timeFormat),
+			Status:             u.Status,
+			FailedAttempts:     u.FailedAttempts,
+			MustChangePassword: u.MustChangePassword,
+			OrgID:              nullStringToPtr(u.OrgID),
 		}
 		if u.LastLogin.Valid {
 			s := u.LastLogin.Time.Format(timeFormat)
@@ -178,17 +197,19 @@ func dtosToUsers(dtos []UserDTO) ([]*database.User, error) {
 			return nil, err
 		}
 		u := &database.User{
-			UserID:         d.UserID,
-			Username:       d.Username,
-			Email:          d.Email,
-			PasswordHash:   d.PasswordHash,
-			FirstName:      d.FirstName,
-			LastName:       d.LastName,
-			RoleID:         d.RoleID,
-			CreatedAt:      createdAt,
-			UpdatedAt:      updatedAt,
-			Status:         d.Status,
-			FailedAttempts: d.FailedAttempts,
+			UserID:             d.UserID,
+			Username:           d.Username,
+			Email:              d.Email,
+			PasswordHash:       d.PasswordHash,
+			FirstName:          d.FirstName,
+			LastName:           d.LastName,
+			RoleID:             d.RoleID,
+			CreatedAt:          createdAt,
+			UpdatedAt:          updatedAt,
+			Status:             d.Status,
+			FailedAttempts:     d.FailedAttempts,
+			MustChangePassword: d.MustChangePassword,
+			OrgID:              ptrToNullString(d.OrgID),
 		}
 		if d.LastLogin != nil {
 			t, err := time.Parse(timeFormat, *d.LastLogin)
@@ -217,6 +238,10 @@ func apiKeysToDTOs(keys []*database.APIKey) []APIKeyDTO {
 			ExpiresAt:      k.ExpiresAt.Format(timeFormat),
 			Status:         k.Status,
 			IPRestrictions: k.IPRestrictions,
+			MonthlyQuota:   k.MonthlyQuota,
+			NotifyURL:      k.NotifyURL,
+			ExpiryNotice:   k.ExpiryNotice,
+			LookupHash:     k.LookupHash,
 		}
 		if k.LastUsed.Valid {
 			s := k.LastUsed.Time.Format(timeFormat)
@@ -248,6 +273,10 @@ func dtosToAPIKeys(dtos []APIKeyDTO) ([]*database.APIKey, error) {
 			ExpiresAt:      expiresAt,
 			Status:         d.Status,
 			IPRestrictions: d.IPRestrictions,
+			MonthlyQuota:   d.MonthlyQuota,
+			NotifyURL:      d.NotifyURL,
+			ExpiryNotice:   d.ExpiryNotice,
+			LookupHash:     d.LookupHash,
 		}
 		if d.LastUsed != nil {
 			t, err := time.Parse(timeFormat, *d.LastUsed)
@@ -277,66 +306,127 @@ func ptrToNullString(p *string) sql.NullString {
 	return sql.NullString{String: *p, Valid: true}
 }
 
+// nullDateToPtr formats an optional badge date as YYYY-MM-DD
+func nullDateToPtr(d sql.NullTime) *string {
+	if !d.Valid {
+		return nil
+	}
+	s := database.FormatDate(d.Time)
+	return &s
+}
+
+// ptrToNullDate parses an optional badge date. Backups of older versions may
+// hold dates in other layouts, which are accepted like on startup.
+func ptrToNullDate(p *string) (sql.NullTime, error) {
+	if p == nil || *p == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := database.ParseLegacyDate(*p)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
 func badgesToDTOs(badges []*database.Badge) []BadgeDTO {
 	dtos := make([]BadgeDTO, len(badges))
 	for i, b := range badges {
 		dtos[i] = BadgeDTO{
-			CommitID:        b.CommitID,
-			Type:            b.Type,
-			Status:          b.Status,
-			Issuer:          b.Issuer,
-			IssueDate:       b.IssueDate,
-			SoftwareName:    b.SoftwareName,
-			SoftwareVersion: b.SoftwareVersion,
-			SoftwareURL:     nullStringToPtr(b.SoftwareURL),
-			Notes:           nullStringToPtr(b.Notes),
-			SVGContent:      nullStringToPtr(b.SVGContent),
-			ExpiryDate:      nullStringToPtr(b.ExpiryDate),
-			IssuerURL:       nullStringToPtr(b.IssuerURL),
-			CustomConfig:    nullStringToPtr(b.CustomConfig),
-			LastReview:      nullStringToPtr(b.LastReview),
-			CoveredVersion:  nullStringToPtr(b.CoveredVersion),
-			RepositoryLink:  nullStringToPtr(b.RepositoryLink),
-			PublicNote:      nullStringToPtr(b.PublicNote),
-			InternalNote:    nullStringToPtr(b.InternalNote),
-			ContactDetails:  nullStringToPtr(b.ContactDetails),
-			CertificateName: nullStringToPtr(b.CertificateName),
-			SpecialtyDomain: nullStringToPtr(b.SpecialtyDomain),
-			SoftwareSCID:    nullStringToPtr(b.SoftwareSCID),
-			SoftwareSCURL:   nullStringToPtr(b.SoftwareSCURL),
+			CommitID:          b.CommitID,
+			Type:              b.Type,
+			Status:            string(b.Status),
+			Issuer:            b.Issuer,
+			IssueDate:         database.FormatDate(b.IssueDate),
+			SoftwareName:      b.SoftwareName,
+			SoftwareVersion:   b.SoftwareVersion,
+			SoftwareURL:       nullStringToPtr(b.SoftwareURL),
+			Notes:             nullStringToPtr(b.Notes),
+			SVGContent:        nullStringToPtr(b.SVGContent),
+			ExpiryDate:        nullDateToPtr(b.ExpiryDate),
+			IssuerURL:         nullStringToPtr(b.IssuerURL),
+			CustomConfig:      nullStringToPtr(b.CustomConfig),
+			LastReview:        nullDateToPtr(b.LastReview),
+			CoveredVersion:    nullStringToPtr(b.CoveredVersion),
+			RepositoryLink:    nullStringToPtr(b.RepositoryLink),
+			PublicNote:        nullStringToPtr(b.PublicNote),
+			InternalNote:      nullStringToPtr(b.InternalNote),
+			ContactDetails:    nullStringToPtr(b.ContactDetails),
+			CertificateName:   nullStringToPtr(b.CertificateName),
+			SpecialtyDomain:   nullStringToPtr(b.SpecialtyDomain),
+			SoftwareSCID:      nullStringToPtr(b.SoftwareSCID),
+			SoftwareSCURL:     nullStringToPtr(b.SoftwareSCURL),
+			GitRepository:     nullStringToPtr(b.GitRepository),
+			GitCommitSHA:      nullStringToPtr(b.GitCommitSHA),
+			GitTag:            nullStringToPtr(b.GitTag),
+			IssuerID:          nullStringToPtr(b.IssuerID),
+			CertificateTypeID: nullStringToPtr(b.CertificateTypeID),
+			OrgID:             nullStringToPtr(b.OrgID),
+		}
+		if b.PublishAt.Valid {
+			s := b.PublishAt.Time.Format(timeFormat)
+			dtos[i].PublishAt = &s
 		}
 	}
 	return dtos
 }
 
-func dtosToBadges(dtos []BadgeDTO) []*database.Badge {
+func dtosToBadges(dtos []BadgeDTO) ([]*database.Badge, error) {
 	badges := make([]*database.Badge, len(dtos))
 	for i, d := range dtos {
+		issued, err := database.ParseLegacyDate(d.IssueDate)
+		if err != nil {
+			return nil, fmt.Errorf("badge %s: issue_date: %w", d.CommitID, err)
+		}
+		expiry, err := ptrToNullDate(d.ExpiryDate)
+		if err != nil {
+			return nil, fmt.Errorf("badge %s: expiry_date: %w", d.CommitID, err)
+		}
+		lastReview, err := ptrToNullDate(d.LastReview)
+		if err != nil {
+			return nil, fmt.Errorf("badge %s: last_review: %w", d.CommitID, err)
+		}
+		status, err := database.ParseStatus(d.Status)
+		if err != nil {
+			return nil, fmt.Errorf("badge %s: status: %w", d.CommitID, err)
+		}
 		badges[i] = &database.Badge{
-			CommitID:        d.CommitID,
-			Type:            d.Type,
-			Status:          d.Status,
-			Issuer:          d.Issuer,
-			IssueDate:       d.IssueDate,
-			SoftwareName:    d.SoftwareName,
-			SoftwareVersion: d.SoftwareVersion,
-			SoftwareURL:     ptrToNullString(d.SoftwareURL),
-			Notes:           ptrToNullString(d.Notes),
-			SVGContent:      ptrToNullString(d.SVGContent),
-			ExpiryDate:      ptrToNullString(d.ExpiryDate),
-			IssuerURL:       ptrToNullString(d.IssuerURL),
-			CustomConfig:    ptrToNullString(d.CustomConfig),
-			LastReview:      ptrToNullString(d.LastReview),
-			CoveredVersion:  ptrToNullString(d.CoveredVersion),
-			RepositoryLink:  ptrToNullString(d.RepositoryLink),
-			PublicNote:      ptrToNullString(d.PublicNote),
-			InternalNote:    ptrToNullString(d.InternalNote),
-			ContactDetails:  ptrToNullString(d.ContactDetails),
-			CertificateName: ptrToNullString(d.CertificateName),
-			SpecialtyDomain: ptrToNullString(d.SpecialtyDomain),
-			SoftwareSCID:    ptrToNullString(d.SoftwareSCID),
-			SoftwareSCURL:   ptrToNullString(d.SoftwareSCURL),
+			CommitID:          d.CommitID,
+			Type:              d.Type,
+			Status:            status,
+			Issuer:            d.Issuer,
+			IssueDate:         issued,
+			SoftwareName:      d.SoftwareName,
+			SoftwareVersion:   d.SoftwareVersion,
+			SoftwareURL:       ptrToNullString(d.SoftwareURL),
+			Notes:             ptrToNullString(d.Notes),
+			SVGContent:        ptrToNullString(d.SVGContent),
+			ExpiryDate:        expiry,
+			IssuerURL:         ptrToNullString(d.IssuerURL),
+			CustomConfig:      ptrToNullString(d.CustomConfig),
+			LastReview:        lastReview,
+			CoveredVersion:    ptrToNullString(d.CoveredVersion),
+			RepositoryLink:    ptrToNullString(d.RepositoryLink),
+			PublicNote:        ptrToNullString(d.PublicNote),
+			InternalNote:      ptrToNullString(d.InternalNote),
+			ContactDetails:    ptrToNullString(d.ContactDetails),
+			CertificateName:   ptrToNullString(d.CertificateName),
+			SpecialtyDomain:   ptrToNullString(d.SpecialtyDomain),
+			SoftwareSCID:      ptrToNullString(d.SoftwareSCID),
+			SoftwareSCURL:     ptrToNullString(d.SoftwareSCURL),
+			GitRepository:     ptrToNullString(d.GitRepository),
+			GitCommitSHA:      ptrToNullString(d.GitCommitSHA),
+			GitTag:            ptrToNullString(d.GitTag),
+			IssuerID:          ptrToNullString(d.IssuerID),
+			CertificateTypeID: ptrToNullString(d.CertificateTypeID),
+			OrgID:             ptrToNullString(d.OrgID),
+		}
+		if d.PublishAt != nil {
+			t, err := time.Parse(timeFormat, *d.PublishAt)
+			if err != nil {
+				return nil, err
+			}
+			badges[i].PublishAt = sql.NullTime{Time: t, Valid: true}
 		}
 	}
-	return badges
+	return badges, nil
 }
@@ -0,0 +1,243 @@
+package badge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/overrides"
+	"github.com/finki/badges/internal/service"
+	"github.com/finki/badges/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxCompositeBadges caps the number of badges in one composite strip
+	MaxCompositeBadges = 10
+	// compositeGap is the space between badges in a composite strip
+	compositeGap = 4
+	// compositeCacheTTL keeps rendered raster strips; the per-badge SVG
+	// fragments are cached under the badge's own keys and invalidated with it
+	compositeCacheTTL = time.Minute
+)
+
+var (
+	// rootWidth reads the width of a generated badge from its root element
+	rootWidth = regexp.MustCompile(`^<svg [^>]*?width="(\d+)"`)
+	// badgeIDs matches the IDs, references, classes and animation names of a
+	// generated badge, which must be unique per badge in a composite strip
+	badgeIDs = regexp.MustCompile(`(id="|#|class="|\.|@keyframes |animation: )badge-`)
+)
+
+// ServeComposite serves /badge/composite?ids=a,b,c: the small badges of
+// several certificates side by side in a single image. Badge query
+// parameters such as theme or show apply to every badge.
+func (h *Handler) ServeComposite(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseCompositeIDs(r.URL.Query().Get("ids"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = utils.NegotiateFormat(r.Header.Get("Accept"))
+		httpcache.Vary(w, "Accept")
+	}
+	if !utils.IsFormat(format) {
+		http.Error(w, "Invalid format. Supported formats: svg, png, jpg, webp, avif", http.StatusBadRequest)
+		return
+	}
+	quality, err := utils.ParseQuality(r.URL.Query().Get("quality"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := utils.ParseSize(r.URL.Query().Get("width"), r.URL.Query().Get("height"), r.URL.Query().Get("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preview := overrides.Preview(r)
+	noCache := overrides.NoCache(r)
+	cacheKey := fmt.Sprintf("composite:%s:%s:%s:%s", strings.Join(ids, ","), format, size, overrides.CacheQuery(r, renderParams...))
+	if format != "svg" && !noCache {
+		if cachedData, found := h.cache.Get(cacheKey); found {
+			h.serveImage(w, r, cachedData, format, h.cacheControl(r, "composite", ""))
+			return
+		}
+	}
+
+	parts := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		part, status, err := h.compositePart(id, r, noCache)
+		if err != nil {
+			if status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			}
+			if status == http.StatusInternalServerError {
+				h.logger.Error("Failed to render composite badge", zap.Error(err), zap.String("commit_id", id))
+				err = fmt.Errorf("Failed to generate image")
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		parts = append(parts, part)
+	}
+
+	svgData, err := composeBadges(parts, compositeGap)
+	if err != nil {
+		h.logger.Error("Failed to compose badges", zap.Error(err))
+		http.Error(w, "Failed to generate image", http.StatusInternalServerError)
+		return
+	}
+	if format == "svg" {
+		h.serveImage(w, r, svgData, format, h.cacheControl(r, "composite", ""))
+		return
+	}
+
+	release, err := service.AcquireRender(r.Context())
+	if err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many renders in progress", http.StatusServiceUnavailable)
+		return
+	}
+	var imageData []byte
+	switch format {
+	case "png":
+		imageData, err = utils.SVGToPNG(r.Context(), svgData, size)
+	case "jpg":
+		imageData, err = utils.SVGToJPG(r.Context(), svgData, size)
+	case "webp":
+		imageData, err = utils.SVGToWebP(r.Context(), svgData, size, quality)
+	case "avif":
+		imageData, err = utils.SVGToAVIF(r.Context(), svgData, size, quality)
+	}
+	release()
+	if err != nil {
+		h.logger.Error("Failed to generate image", zap.Error(err), zap.String("format", format))
+		http.Error(w, "Failed to generate image", http.StatusInternalServerError)
+		return
+	}
+
+	if !preview {
+		h.cache.Set(cacheKey, imageData, compositeCacheTTL)
+	}
+	h.serveImage(w, r, imageData, format, h.cacheControl(r, "composite", ""))
+}
+
+// compositePart returns the SVG of one badge of a composite strip, from the
+// cache when possible, with the HTTP status to report on errors
+func (h *Handler) compositePart(commitID string, r *http.Request, noCache bool) ([]byte, int, error) {
+	// Keyed under the badge so that updating the badge invalidates it
+	cacheKey := fmt.Sprintf("badge:%s:composite:%s", commitID, overrides.CacheQuery(r, renderParams...))
+	if !noCache {
+		if cachedData, found := h.cache.Get(cacheKey); found {
+			return cachedData, http.StatusOK, nil
+		}
+	}
+
+	svgData, err := h.images.Render(r.Context(), service.ImageRequest{
+		CommitID:  commitID,
+		Format:    "svg",
+		Renderer:  h.badgeGenerator,
+		Configure: func(badge *database.Badge) error { return h.applyQueryParams(badge, r) },
+	})
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		// Aliases cannot be redirected within a strip, so render the badge instead
+		if canonical, _ := h.images.Resolve(r.Context(), commitID); canonical != "" && canonical != commitID {
+			return h.compositePart(canonical, r, noCache)
+		}
+		return nil, http.StatusNotFound, fmt.Errorf("Badge not found: %s", commitID)
+	case errors.Is(err, service.ErrInvalidConfig):
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid query parameters")
+	case err != nil:
+		if cachedData, found := h.cache.GetStale(cacheKey); found {
+			return cachedData, http.StatusOK, nil
+		}
+		if errors.Is(err, service.ErrBusy) {
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("Too many renders in progress")
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if !overrides.Preview(r) {
+		h.cache.Set(cacheKey, svgData, 5*time.Minute)
+	}
+	return svgData, http.StatusOK, nil
+}
+
+// parseCompositeIDs splits and validates the ids parameter
+func parseCompositeIDs(param string) ([]string, error) {
+	var ids []string
+	for _, id := range strings.Split(param, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if !commitid.Valid(id) {
+			return nil, fmt.Errorf("Invalid commit ID: %s", id)
+		}
+		ids = append(ids, id)
+	}
+	switch {
+	case len(ids) == 0:
+		return nil, fmt.Errorf("Missing ids: expected a comma-separated list of commit IDs")
+	case len(ids) > MaxCompositeBadges:
+		return nil, fmt.Errorf("Too many ids: at most %d badges can be combined", MaxCompositeBadges)
+	}
+	return ids, nil
+}
+
+// composeBadges lays out generated badges left to right, gap pixels apart, in
+// a single SVG. Each badge is nested as its own svg element with its IDs and
+// classes made unique.
+func composeBadges(parts [][]byte, gap int) ([]byte, error) {
+	var body bytes.Buffer
+	var labels []string
+	x := 0
+	for i, part := range parts {
+		m := rootWidth.FindSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("badge %d has no width", i)
+		}
+		width, _ := strconv.Atoi(string(m[1]))
+		if i > 0 {
+			x += gap
+		}
+
+		part = badgeIDs.ReplaceAll(part, []byte(fmt.Sprintf("${1}b%d-badge-", i)))
+		part = bytes.Replace(part, []byte("<svg "), []byte(fmt.Sprintf(`<svg x="%d" `, x)), 1)
+		body.WriteString("\n  ")
+		body.Write(part)
+
+		if label := ariaLabel(part); label != "" {
+			labels = append(labels, label)
+		}
+		x += width
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="20" role="img" aria-label="%s">`, x, strings.Join(labels, ", "))
+	buf.Write(body.Bytes())
+	buf.WriteString("\n</svg>")
+	return buf.Bytes(), nil
+}
+
+// ariaLabel returns the already escaped aria-label of a generated badge
+func ariaLabel(svg []byte) string {
+	_, rest, ok := bytes.Cut(svg, []byte(`aria-label="`))
+	if !ok {
+		return ""
+	}
+	label, _, _ := bytes.Cut(rest, []byte(`"`))
+	return string(label)
+}
@@ -0,0 +1,91 @@
+package badge
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestServeComposite(t *testing.T) {
+	logger := zap.NewNop()
+	dbFile := "test_composite.db"
+	defer os.Remove(dbFile)
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for _, b := range []*database.Badge{
+		{CommitID: "deps123", CertificateName: sql.NullString{String: "Verified Dependencies", Valid: true}},
+		{CommitID: "lic1234", CertificateName: sql.NullString{String: "Licence Assurance", Valid: true}},
+	} {
+		b.Type, b.Status, b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = "badge", "valid", "Test Issuer", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), "TestApp", "v1.0.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+	handler := NewHandler(db, logger, cache.New())
+
+	for _, tc := range []struct {
+		url    string
+		status int
+	}{
+		{"/badge/composite?ids=deps123,lic1234&format=svg", http.StatusOK},
+		{"/badge/composite?format=svg", http.StatusBadRequest},
+		{"/badge/composite?ids=deps123,bad!id&format=svg", http.StatusBadRequest},
+		{"/badge/composite?ids=a1b2c3,b2c3d4,c3d4e5,d4e5f6,e5f6g7,f6g7h8,g7h8i9,h8i9j0,i9j0k1,j0k1l2,k1l2m3&format=svg", http.StatusBadRequest},
+		{"/badge/composite?ids=deps123,missing1&format=svg", http.StatusNotFound},
+		{"/badge/composite?ids=deps123&format=gif", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeComposite(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.url, tc.status, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeComposite(rec, httptest.NewRequest(http.MethodGet, "/badge/composite?ids=deps123,lic1234&format=svg", nil))
+	svg := rec.Body.String()
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Fatalf("Composite SVG is not well-formed: %v", err)
+	}
+	for _, want := range []string{`aria-label="Verified Dependencies, Licence Assurance"`, `id="b0-badge-clip"`, `url(#b1-badge-clip)`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected composite SVG to contain %s", want)
+		}
+	}
+	if strings.Contains(svg, `id="badge-`) {
+		t.Error("Expected every badge ID to be made unique")
+	}
+}
+
+func TestComposeBadges(t *testing.T) {
+	parts := [][]byte{
+		[]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="100" height="20" aria-label="A"><rect id="badge-outer" class="badge-left"/></svg>`),
+		[]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="50" height="20" aria-label="B"><use href="#badge-outer"/></svg>`),
+	}
+	svg, err := composeBadges(parts, 4)
+	if err != nil {
+		t.Fatalf("composeBadges failed: %v", err)
+	}
+	for _, want := range []string{`width="154"`, `<svg x="0" xmlns`, `<svg x="104" xmlns`, `id="b0-badge-outer" class="b0-badge-left"`, `href="#b1-badge-outer"`} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("Expected %s in %s", want, svg)
+		}
+	}
+
+	if _, err := composeBadges([][]byte{[]byte("<svg/>")}, 4); err == nil {
+		t.Error("Expected an error for a badge without width")
+	}
+}
@@ -0,0 +1,61 @@
+package badge
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// FuzzGenerateSVG renders badges with arbitrary names, statuses and custom
+// configs: they may be rejected, but must not panic or inject markup
+func FuzzGenerateSVG(f *testing.F) {
+	f.Add("TestApp", "v1.0.0", "valid", `{"color_left":"#555"}`)
+	f.Add(`"><script>alert(1)</script>`, "&amp;", "expired", `{"color_right":"\"/><script>x</script>"}`)
+	f.Add("نظام إدارة الهوية", "v\x00\x1b", "revoked", `{"logo":"javascript:alert(1)","text_color":"url(https://x)"}`)
+	f.Add("", "", "", `{`)
+
+	f.Fuzz(func(t *testing.T, name, version, status, config string) {
+		b := &database.Badge{
+			CommitID: "abc123", Type: "badge", Status: database.Status(status), Issuer: "Test Issuer",
+			IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: name, SoftwareVersion: version,
+			CertificateName: sql.NullString{String: name, Valid: name != ""},
+			CustomConfig:    sql.NullString{String: config, Valid: true},
+		}
+		svg, err := NewGenerator().GenerateSVG(b)
+		if err != nil {
+			return
+		}
+		checkSVG(t, svg)
+	})
+}
+
+// checkSVG fails unless svg is a single well-formed document without scripts
+func checkSVG(t *testing.T, svg []byte) {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("expected well-formed SVG, got %v in %s", err, svg)
+		}
+		if s, ok := tok.(xml.StartElement); ok {
+			if s.Name.Local == "script" || s.Name.Local == "foreignObject" {
+				t.Fatalf("unexpected <%s> element in %s", s.Name.Local, svg)
+			}
+			for _, a := range s.Attr {
+				if strings.HasPrefix(strings.ToLower(a.Name.Local), "on") {
+					t.Fatalf("unexpected %s attribute in %s", a.Name.Local, svg)
+				}
+			}
+		}
+	}
+}
@@ -3,32 +3,59 @@ package badge
 import (
 	"bytes"
 	"fmt"
-	"html/template"
+	"time"
 
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/svgtmpl"
+	"github.com/finki/badges/internal/textlayout"
+	"github.com/finki/badges/internal/theme"
 )
 
 // Generator is responsible for generating badge SVGs
 type Generator struct {
 	// Default values for badge customization
-	defaultColorLeft  string
-	defaultColorRight string
-	defaultTextColor  string
-	defaultFontSize   int
-	defaultStyle      string
+	defaultColorLeft   string
+	defaultColorRight  string
+	defaultTextColor   string
+	defaultBorderColor string
+	darkPalette        theme.Palette
+	defaultFontSize    int
+	defaultStyle       string
+	fontFamily         string
+	logo               *theme.Logo
+
+	// Per-badge logos, resolved when set
+	logos LogoSource
 }
 
-// NewGenerator creates a new badge generator
+// LogoSource resolves the logo reference of a badge's custom config, e.g.
+// *logo.Resolver
+type LogoSource interface {
+	Resolve(ref string) (*theme.Logo, error)
+}
+
+// NewGenerator creates a new badge generator using the active theme
 func NewGenerator() *Generator {
+	t := theme.Get()
 	return &Generator{
-		defaultColorLeft:  "#333",
-		defaultColorRight: "#4CAF50",
-		defaultTextColor:  "#FFFFFF",
-		defaultFontSize:   12,
-		defaultStyle:      "3d",
+		defaultColorLeft:   t.Badge.ColorLeft,
+		defaultColorRight:  t.Badge.ColorRight,
+		defaultTextColor:   t.Badge.TextColor,
+		defaultBorderColor: t.Badge.BorderColor,
+		darkPalette:        t.Badge.Dark,
+		defaultFontSize:    t.Badge.FontSize,
+		defaultStyle:       t.Badge.Style,
+		fontFamily:         t.Badge.FontFamily,
+		logo:               t.Logo,
 	}
 }
 
+// SetLogoSource makes the generator render the logo set in a badge's custom
+// config in place of the theme logo
+func (g *Generator) SetLogoSource(src LogoSource) {
+	g.logos = src
+}
+
 // GenerateSVG generates an SVG badge
 func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 	// Get custom configuration
@@ -37,18 +64,32 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 		return nil, fmt.Errorf("failed to get custom config: %w", err)
 	}
 
+	// Start from the palette of the color scheme; auto renders the light
+	// palette and switches to the dark one with a media query
+	palette := theme.Palette{
+		ColorLeft:   g.defaultColorLeft,
+		ColorRight:  g.defaultColorRight,
+		TextColor:   g.defaultTextColor,
+		BorderColor: g.defaultBorderColor,
+	}
+	overlayColor, statusColor := lightOverlayColor, lightStatusColor
+	if config.Theme == "dark" {
+		palette = g.darkPalette
+		overlayColor, statusColor = darkOverlayColor, darkStatusColor
+	}
+
 	// Apply default values if not specified
-	colorLeft := g.defaultColorLeft
+	colorLeft := palette.ColorLeft
 	if config.ColorLeft != "" {
 		colorLeft = config.ColorLeft
 	}
 
-	colorRight := g.defaultColorRight
+	colorRight := palette.ColorRight
 	if config.ColorRight != "" {
 		colorRight = config.ColorRight
 	}
 
-	textColor := g.defaultTextColor
+	textColor := palette.TextColor
 	if config.TextColor != "" {
 		textColor = config.TextColor
 	}
@@ -73,13 +114,45 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 		style = config.Style
 	}
 
-	// Prepare data for the template
-	// Use CertificateName if available, otherwise fall back to SoftwareVersion
-	displayValue := badge.SoftwareVersion
-	if badge.CertificateName.Valid {
-		displayValue = badge.CertificateName.String
+	// Explicit colors are kept in both schemes, so only the defaults switch
+	var dark *darkScheme
+	if config.Theme == "auto" {
+		dark = &darkScheme{BorderColor: g.darkPalette.BorderColor}
+		if config.ColorLeft == "" {
+			dark.ColorLeft = g.darkPalette.ColorLeft
+		}
+		if config.ColorRight == "" {
+			dark.ColorRight = g.darkPalette.ColorRight
+		}
+		if config.TextColor == "" && config.TextColorLeft == "" {
+			dark.TextColorLeft = g.darkPalette.TextColor
+		}
+		if config.TextColor == "" && config.TextColorRight == "" {
+			dark.TextColorRight = g.darkPalette.TextColor
+		}
 	}
 
+ // Calculate status flags/label for the greyed-out overlay rendering;
+    // status_preview renders another status to preview the treatments
+    status := badge.Status
+    displayStatus := badge.DisplayStatus()
+    if config.StatusPreview != "" {
+        displayStatus = database.Status(config.StatusPreview)
+    }
+    isRevoked := displayStatus == "revoked"
+    isExpired := displayStatus == "expired"
+    statusLabel := ""
+    if isRevoked {
+        statusLabel = "REVOKED"
+    } else if isExpired {
+        statusLabel = "EXPIRED"
+    }
+
+	// Prepare data for the template
+	// The right segment shows the certificate name (falling back to
+	// SoftwareVersion) unless the show mode picks other content
+	displayValue := rightText(badge, config.Show, displayStatus)
+
 	// Calculate widths - always use empty label as we only show the GEANT logo
 	totalWidth := calculateWidth("", displayValue, fontSize)
 
@@ -88,16 +161,10 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 	leftWidth = 46 // Fixed width for GEANT logo
 	rightWidth = totalWidth - leftWidth
 
- // Calculate status flags/label for overlay rendering
-    status := badge.Status
-    isRevoked := status == "revoked"
-    // Treat either explicit status or computed expiry as expired
-    isExpired := status == "expired" || badge.IsExpired()
-    statusLabel := ""
-    if isRevoked {
-        statusLabel = "REVOKED"
-    } else if isExpired {
-        statusLabel = "EXPIRED"
+    // Animations never apply to expired or revoked badges
+    animation, animationNote := "", ""
+    if config.Animated && !isExpired && !isRevoked {
+        animation, animationNote = animationFor(badge, time.Now())
     }
 
     data := map[string]interface{}{
@@ -106,10 +173,15 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
         "TextColor":      textColor,
         "TextColorLeft":  textColorLeft,
         "TextColorRight": textColorRight,
+        "BorderColor":    palette.BorderColor,
+        "OverlayColor":   overlayColor,
+        "StatusColor":    statusColor,
+        "Dark":           dark,
         "FontSize":       fontSize,
         "Style":          style,
         // Label field removed as we no longer render the software name
         "Value":          displayValue,
+        "RTL":            textlayout.IsRTL(displayValue),
         "Width":          totalWidth,
         "LeftWidth":      leftWidth,
         "RightWidth":     rightWidth,
@@ -119,28 +191,140 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
         "IsExpired":      isExpired,
         "IsRevoked":      isRevoked,
         "StatusLabel":    statusLabel,
+        // Animated variant: "new", "countdown" or none
+        "Animation":      animation,
+        "AnimationNote":  animationNote,
+        "CountdownColor": countdownColor,
+        // Theme
+        "FontFamily":     g.fontFamily,
+        "Logo":           g.resolveLogo(config.LogoURL),
     }
 
-	// Generate SVG using template
-	tmpl := template.New("badge").Funcs(template.FuncMap{
+	// Generate SVG using template; every string is escaped by svgtmpl
+	tmpl := svgtmpl.New("badge", map[string]interface{}{
 		"div": func(a, b int) int { return a / b },
 		"add": func(a, b int) int { return a + b },
 		"sub": func(a, b int) int { return a - b },
 	})
 
-	tmpl, err = tmpl.Parse(badgeSVGTemplate)
+	tmpl, err = tmpl.Parse(svgtmpl.StripComments(badgeSVGTemplate))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse template: %w", err)
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
+	if err := tmpl.Execute(&buf, svgtmpl.Escape(data)); err != nil {
 		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
 	return buf.Bytes(), nil
 }
 
+// resolveLogo returns the badge's own logo, falling back to the theme logo
+// when none is set or it cannot be loaded
+func (g *Generator) resolveLogo(ref string) *theme.Logo {
+	if ref == "" || g.logos == nil {
+		return g.logo
+	}
+	if logo, err := g.logos.Resolve(ref); err == nil {
+		return logo
+	}
+	return g.logo
+}
+
+// Right-segment content modes, set by show in the custom config
+const (
+	ShowName    = "name"
+	ShowVersion = "version"
+	ShowExpiry  = "expiry"
+	ShowStatus  = "status"
+)
+
+// IsShowMode reports whether show is a supported right-segment content mode
+func IsShowMode(show string) bool {
+	return show == ShowName || show == ShowVersion || show == ShowExpiry || show == ShowStatus
+}
+
+// rightText returns the text of the right segment for the show mode, given
+// the status the badge is rendered with
+func rightText(badge *database.Badge, show string, displayStatus database.Status) string {
+	switch show {
+	case ShowVersion:
+		return badge.SoftwareVersion
+	case ShowStatus:
+		return string(displayStatus)
+	case ShowExpiry:
+		switch {
+		case displayStatus == "revoked":
+			return "revoked"
+		case displayStatus == "expired" && badge.ExpiryDate.Valid:
+			return "expired " + database.FormatNullDate(badge.ExpiryDate)
+		case displayStatus == "expired":
+			return "expired"
+		case badge.ExpiryDate.Valid:
+			return "valid until " + database.FormatNullDate(badge.ExpiryDate)
+		}
+		return "issued " + database.FormatDate(badge.IssueDate)
+	}
+	if badge.CertificateName.Valid {
+		return badge.CertificateName.String
+	}
+	return badge.SoftwareVersion
+}
+
+// Animated variants: a badge issued within newBadgeDays pulses, one expiring
+// within countdownDays gets a highlighted keyline
+const (
+	newBadgeDays   = 14
+	countdownDays  = 30
+	countdownColor = "#F59E0B"
+)
+
+// animationFor returns the animated variant that applies to the badge at now
+// and a note describing it; countdown wins over new
+func animationFor(badge *database.Badge, now time.Time) (string, string) {
+	// Dates are days at midnight UTC, so compare whole days in UTC
+	today := database.Day(now)
+	if badge.ExpiryDate.Valid {
+		days := int(badge.ExpiryDate.Time.Sub(today).Hours() / 24)
+		if days >= 0 && days <= countdownDays {
+			if days == 1 {
+				return "countdown", "Expires in 1 day"
+			}
+			return "countdown", fmt.Sprintf("Expires in %d days", days)
+		}
+	}
+	if !badge.IssueDate.IsZero() {
+		if age := today.Sub(badge.IssueDate); age >= 0 && age <= newBadgeDays*24*time.Hour {
+			return "new", "Recently issued"
+		}
+	}
+	return "", ""
+}
+
+// Status overlay colors per color scheme
+const (
+	lightOverlayColor = "#FFFFFF"
+	lightStatusColor  = "#666666"
+	darkOverlayColor  = "#0D1117"
+	darkStatusColor   = "#C9D1D9"
+)
+
+// darkScheme holds the colors a theme=auto badge switches to when the viewer
+// prefers a dark color scheme; empty fields keep an explicitly set color
+type darkScheme struct {
+	ColorLeft      string
+	ColorRight     string
+	TextColorLeft  string
+	TextColorRight string
+	BorderColor    string
+}
+
+// IsTheme reports whether theme is a supported badge color scheme
+func IsTheme(theme string) bool {
+	return theme == "light" || theme == "dark" || theme == "auto"
+}
+
 // calculateWidth calculates the width of the badge based on the text length
 func calculateWidth(label, value string, fontSize int) int {
 	// Special cases for test values - adjusted for new padding calculation
@@ -157,11 +341,11 @@ func calculateWidth(label, value string, fontSize int) int {
 	if label == "" || len(label) <= 2 {
 		// Return fixed width for the left part when using the GEANT logo
 		if value != "" {
-			// For right part, use increased character width to prevent truncation
+			// Measure the value per character, so non-Latin names are sized
+			// by their glyphs rather than their UTF-8 length
 			charWidth := float64(fontSize) * 0.55
-			valueLen := float64(len(value))
 			// Add padding equivalent to 2 characters wide
-			rightWidth := int(valueLen*charWidth) + int(2*charWidth)
+			rightWidth := int(textlayout.Width(value, float64(fontSize), false)) + int(2*charWidth)
 
             // Return fixed left width (46px for the GEANT logo) + right width
             return 46 + rightWidth
@@ -175,21 +359,21 @@ func calculateWidth(label, value string, fontSize int) int {
 	// Increased character width factor to prevent text truncation
 	charWidth := float64(fontSize) * 0.75 // Increased from 0.6 to 0.75
 
-	labelLen := float64(len(label))
-	valueLen := float64(len(value))
+	labelWidth := textlayout.Width(label, float64(fontSize), false)
+	valueWidth := textlayout.Width(value, float64(fontSize), false)
 
 	if label != "" && value != "" {
 		// Both label and value
 		// Add padding equivalent to 4 characters wide (2 on each side)
-		return int((labelLen+valueLen)*charWidth) + int(4*charWidth)
+		return int(labelWidth+valueWidth) + int(4*charWidth)
 	} else if label != "" {
 		// Only label
 		// Add padding equivalent to 2 characters wide
-		return int(labelLen*charWidth) + int(2*charWidth)
+		return int(labelWidth) + int(2*charWidth)
 	} else if value != "" {
 		// Only value
 		// Add padding equivalent to 2 characters wide
-		return int(valueLen*charWidth) + int(2*charWidth)
+		return int(valueWidth) + int(2*charWidth)
 	}
 
 	return 80 // Minimum width
@@ -198,6 +382,33 @@ func calculateWidth(label, value string, fontSize int) int {
 // SVG template for small badges
 const badgeSVGTemplate = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="{{.Width}}" height="20" role="img" aria-label="{{.Value}}">
   <title>{{.Value}}</title>
+  {{- if .AnimationNote}}
+  <desc>{{.AnimationNote}}</desc>
+  {{- end}}
+  {{- if .Animation}}
+  <style>
+    @keyframes badge-pulse { 0%, 100% { opacity: 0 } 50% { opacity: 0.35 } }
+    @keyframes badge-countdown { 0%, 100% { stroke-opacity: 1 } 50% { stroke-opacity: 0.3 } }
+    .badge-pulse { animation: badge-pulse 2s ease-in-out infinite }
+    .badge-countdown { animation: badge-countdown 3s ease-in-out infinite }
+    @media (prefers-reduced-motion: reduce) {
+      .badge-pulse, .badge-countdown { animation: none }
+    }
+  </style>
+  {{- end}}
+  {{with .Dark}}
+  <style>
+    @media (prefers-color-scheme: dark) {
+      {{if .ColorLeft}}.badge-left { fill: {{.ColorLeft}} }{{end}}
+      {{if .ColorRight}}.badge-right { fill: {{.ColorRight}} }{{end}}
+      {{if .TextColorLeft}}.badge-text-left { fill: {{.TextColorLeft}} }{{end}}
+      {{if .TextColorRight}}.badge-text-right { fill: {{.TextColorRight}} }{{end}}
+      .badge-keyline { stroke: {{.BorderColor}} }
+      .badge-overlay { fill: ` + darkOverlayColor + ` }
+      .badge-status { fill: ` + darkStatusColor + ` }
+    }
+  </style>
+  {{end}}
   <defs>
     <rect id="badge-outer" x="0" y="0" width="{{.Width}}" height="20" rx="3" ry="3"/>
     <!-- Inset border rect to keep parallel lines at the corners -->
@@ -209,19 +420,37 @@ const badgeSVGTemplate = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="h
       <stop offset="0" stop-color="#000" stop-opacity="0.05"/>
       <stop offset="1" stop-color="#000" stop-opacity="0.05"/>
     </linearGradient>
+    {{- if or .IsExpired .IsRevoked}}
+    <filter id="badge-grayscale">
+      <feColorMatrix type="saturate" values="0"/>
+    </filter>
+    {{- end}}
   </defs>
+  {{- if or .IsExpired .IsRevoked}}
+
+  <!-- Expired and revoked badges are greyed out, logo included -->
+  <g filter="url(#badge-grayscale)">
+  {{- end}}
 
   <!-- Backgrounds drawn inside a clip that exactly matches the rounded outer shape -->
   <g clip-path="url(#badge-clip)">
-    <rect x="0" y="0" width="{{.LeftWidth}}" height="20" fill="{{.ColorLeft}}"/>
-    <rect x="{{.LeftWidth}}" y="0" width="{{.RightWidth}}" height="20" fill="{{.ColorRight}}"/>
+    <rect class="badge-left" x="0" y="0" width="{{.LeftWidth}}" height="20" fill="{{.ColorLeft}}"/>
+    <rect class="badge-right" x="{{.LeftWidth}}" y="0" width="{{.RightWidth}}" height="20" fill="{{.ColorRight}}"/>
     {{if .HasShadow}}
     <rect x="0" y="0" width="{{.Width}}" height="20" fill="url(#badge-grad)"/>
     {{end}}
+    {{- if eq .Animation "new"}}
+    <!-- Pulse over the value of a recently issued badge; static renders show none -->
+    <rect class="badge-pulse" x="{{.LeftWidth}}" y="0" width="{{.RightWidth}}" height="20" fill="#FFFFFF" opacity="0"/>
+    {{- end}}
   </g>
 
+  {{if .Logo}}
+  <!-- Badge or theme logo, fitted into the left part -->
+  <svg x="3" y="3" width="40" height="14" viewBox="{{.Logo.ViewBox}}" preserveAspectRatio="xMidYMid meet">{{.Logo.Content}}</svg>
+  {{else}}
   <!-- GÉANT logo: icon (circular G) + wordmark lockup, uses left text color -->
-  <g transform="translate(3,4.3) scale(0.381)" fill="{{.TextColorLeft}}">
+  <g class="badge-text-left" transform="translate(3,4.3) scale(0.381)" fill="{{.TextColorLeft}}">
     <!-- Icon: normalised from native viewBox 11.974 6.9998 90.144 97.3198, scaled to height 30 -->
     <g transform="scale(0.308262) translate(-11.974,-6.9998)">
       <path d="M100.7,49.2h-10.4c-3,0-5.3,2.5-5.2,5.5,0,.5,0,1,0,1.6-.2,13.4-11.3,24.3-24.6,24.5-3.8,0-7.5-.8-10.7-2.3-2-.9-4.3-.5-5.8,1l-8.8,8.8c-.1.1-.1.4,0,.5,6.9,5.3,15.6,8.4,25,8.4,22.9,0,41.4-18.5,41.4-41.4s-.2-4.3-.5-6.3c0-.2-.2-.3-.3-.3Z"/>
@@ -240,25 +469,33 @@ const badgeSVGTemplate = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="h
       <path d="M82.6775 25.5C82.0769 25.5 81.6766 25.3 81.3763 25C81.076 24.7 80.8758 24.3 80.8758 23.7V9.3H75.5709C75.0704 9.3 74.7701 9.2 74.4698 8.9C74.1695 8.6 74.0695 8.3 74.0695 7.8C74.0695 7.3 74.1695 7 74.4698 6.7C74.7701 6.5 75.0704 6.3 75.5709 6.3H89.6841C90.1845 6.3 90.4848 6.4 90.7851 6.7C91.0854 6.9 91.1855 7.3 91.1855 7.8C91.1855 8.3 91.0854 8.6 90.7851 8.9C90.4848 9.2 90.1845 9.3 89.6841 9.3H84.3791V23.7C84.3791 24.3 84.279 24.7 83.9787 25C83.6785 25.3 83.2781 25.5 82.6775 25.5Z"/>
     </g>
   </g>
+  {{end}}
 
   <!-- Right-side text -->
-  <g text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="{{.FontSize}}">
-    <text x="{{add .LeftWidth (div .RightWidth 2)}}" y="15" fill="{{.TextColorRight}}">{{.Value}}</text>
+  <g text-anchor="middle" font-family="{{.FontFamily}}" font-size="{{.FontSize}}">
+    <text class="badge-text-right" x="{{add .LeftWidth (div .RightWidth 2)}}" y="15" fill="{{.TextColorRight}}"{{if .RTL}} direction="rtl" unicode-bidi="embed"{{end}}>{{.Value}}</text>
   </g>
 
   {{/* White overlay and status label for expired or revoked (small badge) */}}
   {{if or .IsExpired .IsRevoked}}
+  </g>
   <g id="status-overlay-badge" clip-path="url(#badge-clip)">
-    <rect x="0" y="0" width="{{.Width}}" height="20" fill="#FFFFFF" opacity="0.5"/>
+    <rect class="badge-overlay" x="0" y="0" width="{{.Width}}" height="20" fill="{{.OverlayColor}}" opacity="0.5"/>
     <text x="{{div .Width 2}}" y="12" text-anchor="middle"
           font-family="Arial, Helvetica, sans-serif"
           font-size="9"
           font-weight="900"
-          fill="#666666"
+          fill="{{.StatusColor}}" class="badge-status"
           transform="rotate(-18 {{div .Width 2}} 10)">{{.StatusLabel}}</text>
   </g>
   {{end}}
 
+  {{- if eq .Animation "countdown"}}
+
+  <!-- Inset keyline of a badge close to expiry -->
+  <use class="badge-countdown" xlink:href="#badge-border" fill="none" stroke="{{.CountdownColor}}" stroke-width="1" pointer-events="none"/>
+  {{- end}}
+
   <!-- Outer keyline drawn last to avoid any background bleed at corners -->
-  <use xlink:href="#badge-outer" fill="none" stroke="#E5E7EB" stroke-width="1" vector-effect="non-scaling-stroke" shape-rendering="crispEdges" pointer-events="none"/>
+  <use class="badge-keyline" xlink:href="#badge-outer" fill="none" stroke="{{.BorderColor}}" stroke-width="1" vector-effect="non-scaling-stroke" shape-rendering="crispEdges" pointer-events="none"/>
 </svg>`
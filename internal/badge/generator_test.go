@@ -1,10 +1,19 @@
 package badge
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/theme"
 )
 
 func TestGenerateSVG(t *testing.T) {
@@ -16,7 +25,7 @@ func TestGenerateSVG(t *testing.T) {
 			Type:            "badge",
 			Status:          "valid",
 			Issuer:          "Test Issuer",
-			IssueDate:       "2023-01-01",
+			IssueDate:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 			SoftwareName:    "TestApp",
 			SoftwareVersion: "v1.0.0",
 			// CertificateName is not set, so it should fall back to SoftwareVersion
@@ -58,7 +67,7 @@ func TestGenerateSVG(t *testing.T) {
 			Type:            "badge",
 			Status:          "valid",
 			Issuer:          "Test Issuer",
-			IssueDate:       "2023-01-01",
+			IssueDate:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 			SoftwareName:    "TestApp",
 			SoftwareVersion: "v1.0.0",
 			CertificateName: sql.NullString{String: "Self-Assessed Dependencies", Valid: true},
@@ -160,3 +169,295 @@ func abs(x int) int {
 	}
 	return x
 }
+
+func TestGenerateSVGWithTheme(t *testing.T) {
+	th := theme.Default()
+	th.Badge.ColorRight = "#123456"
+	th.Badge.FontFamily = "Inter,sans-serif"
+	th.Logo = &theme.Logo{ViewBox: "0 0 10 10", Content: `<circle id="theme-logo" r="5" cx="5" cy="5"/>`}
+	theme.Set(th)
+	defer theme.Set(theme.Default())
+
+	svg, err := NewGenerator().GenerateSVG(&database.Badge{
+		CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+
+	svgStr := string(svg)
+	for _, want := range []string{`fill="#123456"`, `font-family="Inter,sans-serif"`, `id="theme-logo"`, `viewBox="0 0 10 10"`} {
+		if !strings.Contains(svgStr, want) {
+			t.Errorf("Expected SVG to contain %s", want)
+		}
+	}
+	if strings.Contains(svgStr, "GÉANT logo") {
+		t.Error("Expected the theme logo to replace the GÉANT logo")
+	}
+}
+
+// geantLogoTransform identifies the built-in GÉANT logo in a rendered badge
+const geantLogoTransform = `transform="translate(3,4.3) scale(0.381)"`
+
+// fakeLogos resolves every reference to a fixed logo, or fails
+type fakeLogos struct{ err error }
+
+func (f fakeLogos) Resolve(ref string) (*theme.Logo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &theme.Logo{ViewBox: "0 0 4 4", Content: `<rect id="logo-badge" width="4" height="4"></rect>`}, nil
+}
+
+func TestGenerateSVGCustomLogo(t *testing.T) {
+	b := &database.Badge{
+		CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+		CustomConfig: sql.NullString{String: `{"logo":"https://logos.example.org/a.svg"}`, Valid: true},
+	}
+
+	g := NewGenerator()
+	g.SetLogoSource(fakeLogos{})
+	svg, err := g.GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if !strings.Contains(string(svg), `id="logo-badge"`) || strings.Contains(string(svg), geantLogoTransform) {
+		t.Error("Expected the badge logo to replace the GÉANT logo")
+	}
+
+	// A logo that cannot be loaded falls back to the theme logo
+	g.SetLogoSource(fakeLogos{err: errors.New("host not allowed")})
+	svg, err = g.GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if strings.Contains(string(svg), `id="logo-badge"`) || !strings.Contains(string(svg), geantLogoTransform) {
+		t.Error("Expected the GÉANT logo when the badge logo fails")
+	}
+}
+
+func TestGenerateSVGEscapesNames(t *testing.T) {
+	name := `"><script>alert(1)</script> & Co`
+	b := &database.Badge{
+		CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: name, SoftwareVersion: "v1.0.0",
+		CertificateName: sql.NullString{String: name, Valid: true},
+	}
+
+	svg, err := NewGenerator().GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if strings.Contains(string(svg), "<script") {
+		t.Errorf("Expected the name to be escaped, got %s", svg)
+	}
+	if !strings.Contains(string(svg), "&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt; &amp; Co") {
+		t.Errorf("Expected the escaped name in %s", svg)
+	}
+	if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+		t.Errorf("Expected well-formed SVG: %v", err)
+	}
+}
+
+func TestAnimationFor(t *testing.T) {
+	now := time.Date(2024, 6, 15, 13, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		issued, expiry string
+		want, note     string
+	}{
+		"issued today":         {"2024-06-15", "", "new", "Recently issued"},
+		"issued two weeks ago": {"2024-06-01", "", "new", "Recently issued"},
+		"issued long ago":      {"2024-01-01", "2025-01-01", "", ""},
+		"expires tomorrow":     {"2024-01-01", "2024-06-16", "countdown", "Expires in 1 day"},
+		"expires in 30 days":   {"2024-01-01", "2024-07-15", "countdown", "Expires in 30 days"},
+		"countdown wins":       {"2024-06-10", "2024-06-20", "countdown", "Expires in 5 days"},
+		"no dates":             {"", "", "", ""},
+	} {
+		b := &database.Badge{}
+		b.IssueDate, _ = database.ParseDate(tc.issued)
+		b.ExpiryDate, _ = database.ParseNullDate(tc.expiry)
+		got, note := animationFor(b, now)
+		if got != tc.want || note != tc.note {
+			t.Errorf("%s: got %q %q, want %q %q", name, got, note, tc.want, tc.note)
+		}
+	}
+}
+
+func TestGenerateSVGAnimated(t *testing.T) {
+	today := database.Day(time.Now().UTC())
+	b := &database.Badge{
+		CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: today, SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+	}
+
+	svg, err := NewGenerator().GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if strings.Contains(string(svg), "@keyframes") {
+		t.Error("Expected no animation without animated in the custom config")
+	}
+
+	b.CustomConfig = sql.NullString{String: `{"animated":true}`, Valid: true}
+	svg, err = NewGenerator().GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	for _, want := range []string{`class="badge-pulse"`, "prefers-reduced-motion", "<desc>Recently issued</desc>"} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("Expected animated SVG to contain %s", want)
+		}
+	}
+
+	b.Status = "revoked"
+	svg, err = NewGenerator().GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if strings.Contains(string(svg), "badge-pulse") {
+		t.Error("Expected a revoked badge not to be animated")
+	}
+}
+
+func TestGenerateSVGStatusTreatment(t *testing.T) {
+	b := &database.Badge{
+		CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+		ExpiryDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+
+	for _, tc := range []struct {
+		status         database.Status
+		preview, label string
+	}{
+		{"valid", "", "EXPIRED"},
+		{"revoked", "", "REVOKED"},
+		{"valid", "valid", ""},
+		{"valid", "revoked", "REVOKED"},
+	} {
+		b.Status = tc.status
+		b.CustomConfig = sql.NullString{}
+		if tc.preview != "" {
+			b.CustomConfig = sql.NullString{String: `{"status_preview":"` + tc.preview + `"}`, Valid: true}
+		}
+		svg, err := NewGenerator().GenerateSVG(b)
+		if err != nil {
+			t.Fatalf("Failed to generate SVG: %v", err)
+		}
+		svgStr := string(svg)
+		greyed := strings.Contains(svgStr, `filter="url(#badge-grayscale)"`)
+		if greyed != (tc.label != "") {
+			t.Errorf("%s/%s: expected greyed out = %v", tc.status, tc.preview, tc.label != "")
+		}
+		if tc.label != "" && !strings.Contains(svgStr, ">"+tc.label+"</text>") {
+			t.Errorf("%s/%s: expected the %s label", tc.status, tc.preview, tc.label)
+		}
+		if tc.label == "" && strings.Contains(svgStr, "status-overlay-badge") {
+			t.Errorf("%s/%s: expected no overlay", tc.status, tc.preview)
+		}
+	}
+}
+
+func TestRightText(t *testing.T) {
+	b := &database.Badge{
+		IssueDate: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), SoftwareVersion: "v1.2.0",
+		CertificateName: sql.NullString{String: "Verified Dependencies", Valid: true},
+		ExpiryDate:      sql.NullTime{Time: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+	noExpiry := *b
+	noExpiry.ExpiryDate = sql.NullTime{}
+
+	for _, tc := range []struct {
+		badge  *database.Badge
+		show   string
+		status database.Status
+		want   string
+	}{
+		{b, "", "valid", "Verified Dependencies"},
+		{b, ShowName, "valid", "Verified Dependencies"},
+		{b, ShowVersion, "valid", "v1.2.0"},
+		{b, ShowStatus, "revoked", "revoked"},
+		{b, ShowExpiry, "valid", "valid until 2026-05-01"},
+		{b, ShowExpiry, "expired", "expired 2026-05-01"},
+		{b, ShowExpiry, "revoked", "revoked"},
+		{&noExpiry, ShowExpiry, "valid", "issued 2025-05-01"},
+	} {
+		if got := rightText(tc.badge, tc.show, tc.status); got != tc.want {
+			t.Errorf("show=%q status=%q: got %q, want %q", tc.show, tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateSVGColorSchemes(t *testing.T) {
+	dark := theme.Default().Badge.Dark
+	render := func(config string) string {
+		b := &database.Badge{
+			CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+			IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+			CustomConfig: sql.NullString{String: config, Valid: true},
+		}
+		svg, err := NewGenerator().GenerateSVG(b)
+		if err != nil {
+			t.Fatalf("Failed to generate SVG: %v", err)
+		}
+		return string(svg)
+	}
+
+	if svg := render(`{}`); strings.Contains(svg, "prefers-color-scheme") || strings.Contains(svg, dark.ColorRight) {
+		t.Error("Expected the default badge to use the light palette only")
+	}
+
+	svg := render(`{"theme":"dark"}`)
+	if !strings.Contains(svg, `fill="`+dark.ColorRight+`"`) || strings.Contains(svg, "prefers-color-scheme") {
+		t.Error("Expected theme=dark to render the dark palette without a media query")
+	}
+
+	svg = render(`{"theme":"auto","color_right":"#123456"}`)
+	if !strings.Contains(svg, "@media (prefers-color-scheme: dark)") || !strings.Contains(svg, ".badge-left { fill: "+dark.ColorLeft+" }") {
+		t.Errorf("Expected theme=auto to switch to the dark palette with a media query:\n%s", svg)
+	}
+	if strings.Contains(svg, ".badge-right {") || !strings.Contains(svg, `fill="#123456"`) {
+		t.Error("Expected an explicit color to be kept in both schemes")
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestGenerateSVGGolden renders non-Latin names and compares them with the SVGs
+// in testdata; run with -update after intended template changes
+func TestGenerateSVGGolden(t *testing.T) {
+	for name, value := range map[string]string{
+		"greek":    "Πιστοποιημένο Λογισμικό",
+		"cyrillic": "Проверенное ПО",
+		"arabic":   "برمجيات موثقة",
+		"hebrew":   "תוכנה מאומתת",
+		"cjk":      "认证软件",
+	} {
+		t.Run(name, func(t *testing.T) {
+			svg, err := NewGenerator().GenerateSVG(&database.Badge{
+				CommitID: "golden1", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+				IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+				CertificateName: sql.NullString{String: value, Valid: true},
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate SVG: %v", err)
+			}
+
+			path := filepath.Join("testdata", name+".golden.svg")
+			if *update {
+				if err := os.WriteFile(path, svg, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(svg, want) {
+				t.Errorf("SVG differs from %s; run go test -update if the change is intended\n%s", path, svg)
+			}
+		})
+	}
+}
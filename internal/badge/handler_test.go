@@ -2,13 +2,21 @@ package badge
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/finki/badges/internal/auth"
 	"github.com/finki/badges/internal/cache"
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/service/servicetest"
+	"github.com/finki/badges/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -36,7 +44,7 @@ func TestBadgeHandler(t *testing.T) {
 		Type:            "badge",
 		Status:          "valid",
 		Issuer:          "Test Issuer",
-		IssueDate:       "2023-01-01",
+		IssueDate:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 		SoftwareName:    "TestApp",
 		SoftwareVersion: "v1.0.0",
 		Notes:           sql.NullString{String: "Test notes", Valid: true},
@@ -84,6 +92,18 @@ func TestBadgeHandler(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedType:   "text/plain; charset=utf-8",
 		},
+		{
+			name:           "Oversized raster",
+			url:            "/badge/test123?format=png&width=100000",
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "text/plain; charset=utf-8",
+		},
+		{
+			name:           "Scale with width",
+			url:            "/badge/test123?format=png&scale=2&width=200",
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "text/plain; charset=utf-8",
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,4 +139,199 @@ func TestBadgeHandler(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestBadgeHandlerWithStore(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{
+		CommitID:        "mock1234",
+		Type:            "badge",
+		Status:          "valid",
+		Issuer:          "Test Issuer",
+		IssueDate:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName:    "MockApp",
+		SoftwareVersion: "v1.0.0",
+		CustomConfig:    sql.NullString{String: `{"public_overrides":"color_left"}`, Valid: true},
+	})
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg&color_left=%23123456", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "v1.0.0") || !strings.Contains(rr.Body.String(), "#123456") {
+		t.Errorf("expected the configured badge, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Aliases and other cases redirect to the canonical URL
+	store.Aliases["old-name"] = "mock1234"
+	for _, id := range []string{"old-name", "MOCK1234"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/"+id+"?format=png", nil))
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/badge/mock1234?format=png" {
+			t.Errorf("%s: expected a redirect, got %d %s", id, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	// Vanity URLs render the newest published certificate of the project
+	scID := sql.NullString{String: "proj.1", Valid: true}
+	name := sql.NullString{String: "Verified Dependencies", Valid: true}
+	store.Badges["old12345"] = &database.Badge{CommitID: "old12345", Status: "valid", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "VanityApp", SoftwareVersion: "v1.0.0", SoftwareSCID: scID, CertificateName: name}
+	store.Badges["new12345"] = &database.Badge{CommitID: "new12345", Status: "valid", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "VanityApp", SoftwareVersion: "v2.0.0", SoftwareSCID: scID, CertificateName: name,
+		CustomConfig: sql.NullString{String: `{"color_left":"#654321"}`, Valid: true}}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/proj.1/verified-dependencies", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "#654321") {
+		t.Errorf("expected the reissued badge, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/proj.1/unknown-certificate", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown vanity URL to be 404, got %d", rr.Code)
+	}
+
+	// Store failures are reported without leaking the error
+	store.Err = errors.New("connection refused")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg", nil))
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "refused") {
+		t.Errorf("expected an internal server error, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBadgeHandlerCaching(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "mock1234", Type: "badge", Status: "valid",
+		Issuer: "Test Issuer", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "MockApp", SoftwareVersion: "v1.0.0"})
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+	policies, err := httpcache.ParsePolicies("badge:valid=public, max-age=3600;*:preview=no-store")
+	if err != nil {
+		t.Fatalf("ParsePolicies: %v", err)
+	}
+	handler.SetCachePolicies(policies)
+
+	// Cached responses keep the policy of the badge status
+	var etag string
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg", nil))
+		etag = rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" || rr.Header().Get("Cache-Control") != "public, max-age=3600" {
+			t.Errorf("request %d: expected the valid policy and an ETag, got %d %v", i, rr.Code, rr.Header())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/badge/mock1234?format=svg", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected 304 for a matching ETag, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg&status_preview=revoked", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected status previews not to be stored, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestBadgeHandlerCacheKey(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "mock1234", Type: "badge", Status: "valid",
+		Issuer: "Test Issuer", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "MockApp", SoftwareVersion: "v1.0.0"})
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+
+	// Parameter order and parameters that do not change the image share an entry
+	for _, query := range []string{"theme=dark&style=flat", "style=flat&utm_source=readme&theme=dark"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg&"+query, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Vary") != "" {
+			t.Errorf("%s: expected 200 without Vary, got %d %v", query, rr.Code, rr.Header())
+		}
+	}
+	// The image and its status
+	if stats := handler.cache.Stats(); stats.Items != 2 || stats.Hits == 0 {
+		t.Errorf("expected the second request to hit the first one's entry, got %+v", stats)
+	}
+
+	// Only signed-in users bypass the cache with no_cache
+	hits := handler.cache.Stats().Hits
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/badge/mock1234?format=svg&theme=dark&style=flat&no_cache=true", nil))
+	// The image and its status
+	if stats := handler.cache.Stats(); stats.Hits != hits+2 {
+		t.Errorf("expected anonymous no_cache to be ignored, got %+v", stats)
+	}
+	req := httptest.NewRequest("GET", "/badge/mock1234?format=svg&theme=dark&style=flat&no_cache=true", nil)
+	req = req.WithContext(auth.AddClaimsToContext(req.Context(), &auth.Claims{UserID: "user-id"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if stats := handler.cache.Stats(); stats.Hits != hits+2 {
+		t.Errorf("expected a signed-in user's no_cache to bypass the cache, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234", nil))
+	if rr.Header().Get("Vary") != "Accept" {
+		t.Errorf("expected Vary: Accept for a negotiated format, got %v", rr.Header())
+	}
+}
+
+func TestBadgeHandlerDegraded(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "mock1234", Type: "badge", Status: "valid",
+		Issuer: "Test Issuer", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "MockApp", SoftwareVersion: "v1.0.0"})
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	image := rr.Body.String()
+
+	// While the store fails, the last render is served once it has expired
+	key := fmt.Sprintf("badge:mock1234:svg:%s:", utils.Size{})
+	handler.cache.Set(key, []byte(image), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	store.Err = errors.New("database is locked")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=svg", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != image || rr.Header().Get("Cache-Control") != httpcache.Stale ||
+		rr.Header().Get("Warning") == "" {
+		t.Errorf("expected the stale image, got %d %v", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/badge/mock1234?format=png", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 without a cached image, got %d", rr.Code)
+	}
+}
+
+func TestBadgeHandlerOverrides(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "mock1234", Type: "badge", Status: "valid",
+		Issuer: "Test Issuer", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "MockApp", SoftwareVersion: "v1.0.0"})
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+	const path = "/badge/mock1234?format=svg&color_left=%23123456&theme=dark"
+
+	// The public policy ignores colors but keeps presentation parameters
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "#123456") {
+		t.Errorf("expected the color override to be ignored, got %d: %s", rr.Code, rr.Body.String())
+	}
+	public := rr.Body.String()
+
+	// Writers preview every parameter, bypassing the cache shared with
+	// anonymous requests
+	claims := &auth.Claims{UserID: "user-id", Username: "admin"}
+	claims.Permissions = database.Permissions{"badges": {"write": true}}
+	req := httptest.NewRequest("GET", path, nil)
+	req = req.WithContext(auth.AddClaimsToContext(req.Context(), claims))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "#123456") || rr.Header().Get("Cache-Control") != httpcache.Private {
+		t.Errorf("expected a private preview with the color, got %d %v", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Body.String() != public {
+		t.Error("expected the preview not to replace the cached public render")
+	}
+}
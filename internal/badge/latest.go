@@ -0,0 +1,51 @@
+package badge
+
+import (
+	"net/http"
+
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// ServeLatest serves /badge/latest?software=<software_sc_id>&type=<certificate
+// name>: a redirect to the badge of the most recently issued valid
+// certificate of the project, so that embeds follow each review cycle.
+// Without type any certificate of the project qualifies. The other query
+// parameters are passed on to the badge.
+func (h *Handler) ServeLatest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	scID := query.Get("software")
+	if !commitid.SoftwareIDPattern.MatchString(scID) {
+		http.Error(w, "Invalid software ID", http.StatusBadRequest)
+		return
+	}
+	certType := query.Get("type")
+	slug := database.Slugify(certType)
+	if certType != "" && slug == "" {
+		http.Error(w, "Invalid certificate type", http.StatusBadRequest)
+		return
+	}
+
+	commitID, err := h.images.ResolveLatest(r.Context(), scID, slug)
+	if err != nil {
+		h.logger.Error("Failed to find latest certificate", zap.Error(err), zap.String("software_sc_id", scID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if commitID == "" {
+		http.Error(w, "No valid certificate found", http.StatusNotFound)
+		return
+	}
+
+	query.Del("software")
+	query.Del("type")
+	target := "/badge/" + commitID
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	// The target changes with each review cycle, so the redirect must not be cached
+	w.Header().Set("Cache-Control", "no-cache")
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,49 @@
+package badge
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service/servicetest"
+	"go.uber.org/zap"
+)
+
+func TestServeLatest(t *testing.T) {
+	scID := sql.NullString{String: "eduteams", Valid: true}
+	deps := sql.NullString{String: "Verified Dependencies", Valid: true}
+	licence := sql.NullString{String: "Software Licence Assurance", Valid: true}
+	store := servicetest.NewBadgeStore(
+		&database.Badge{CommitID: "deps2023", Status: "valid", IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: deps},
+		&database.Badge{CommitID: "deps2024", Status: "valid", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: deps},
+		&database.Badge{CommitID: "deps2025", Status: "revoked", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: deps},
+		&database.Badge{CommitID: "lic20250", Status: "draft", IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: licence},
+		&database.Badge{CommitID: "lic20230", Status: "valid", IssueDate: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: licence,
+			ExpiryDate: sql.NullTime{Time: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Valid: true}},
+	)
+	handler := NewHandler(store, zap.NewNop(), cache.New())
+
+	for _, tc := range []struct {
+		url      string
+		status   int
+		location string
+	}{
+		{"/badge/latest?software=eduteams&type=Verified+Dependencies&format=png", http.StatusFound, "/badge/deps2024?format=png"},
+		{"/badge/latest?software=eduteams&type=verified-dependencies", http.StatusFound, "/badge/deps2024"},
+		{"/badge/latest?software=eduteams", http.StatusFound, "/badge/deps2024"},
+		{"/badge/latest?software=eduteams&type=Software+Licence+Assurance", http.StatusNotFound, ""},
+		{"/badge/latest?software=unknown", http.StatusNotFound, ""},
+		{"/badge/latest?software=bad%20id", http.StatusBadRequest, ""},
+		{"/badge/latest?software=eduteams&type=%21%21", http.StatusBadRequest, ""},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeLatest(rr, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rr.Code != tc.status || rr.Header().Get("Location") != tc.location {
+			t.Errorf("%s: expected %d %q, got %d %q", tc.url, tc.status, tc.location, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
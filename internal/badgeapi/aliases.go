@@ -0,0 +1,129 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// Alias is the JSON representation of an alternate ID of a badge
+type Alias struct {
+	Alias     string    `json:"alias"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AliasRequest is the body of POST /api/badges/{commit_id}/aliases
+type AliasRequest struct {
+	Alias string `json:"alias"`
+}
+
+// listAliases returns the aliases of a badge
+func (h *Handler) listAliases(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	aliases, err := h.db.WithContext(r.Context()).ListAliases(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to list aliases", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list aliases")
+		return
+	}
+
+	resp := make([]Alias, 0, len(aliases))
+	for _, a := range aliases {
+		resp = append(resp, aliasToJSON(a))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// addAlias registers an alternate ID for a badge. The alias must be a valid
+// commit ID that refers to no badge yet, regardless of case.
+func (h *Handler) addAlias(w http.ResponseWriter, r *http.Request, commitID string) {
+	var req AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Alias = strings.TrimSpace(req.Alias)
+	if !commitid.Valid(req.Alias) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid alias")
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	alias := &database.Alias{
+		Alias:     req.Alias,
+		CommitID:  commitID,
+		CreatedBy: auth.GetUserIDFromContext(r.Context()),
+		CreatedAt: time.Now(),
+	}
+	err := h.db.WithContext(r.Context()).WithTx(func(tx *database.DB) error {
+		// Also finds badges whose commit ID is the alias
+		resolved, err := tx.ResolveBadgeID(alias.Alias)
+		if err != nil {
+			return err
+		}
+		if resolved != "" {
+			return newError(http.StatusConflict, "Alias is already in use")
+		}
+		return tx.CreateAlias(alias)
+	})
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		writeError(w, apiErr)
+		return
+	}
+	if err != nil {
+		h.logger.Error("badgeapi: failed to create alias", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create alias")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, aliasToJSON(alias))
+}
+
+// deleteAlias removes an alias of a badge; its URLs stop redirecting
+func (h *Handler) deleteAlias(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	deleted, err := h.db.WithContext(r.Context()).DeleteAlias(commitID, path.Base(r.URL.Path))
+	if err != nil {
+		h.logger.Error("badgeapi: failed to delete alias", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete alias")
+		return
+	}
+	if !deleted {
+		httpjson.Error(w, http.StatusNotFound, "Alias not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// aliasToJSON converts a database alias to its API representation
+func aliasToJSON(a *database.Alias) Alias {
+	return Alias{
+		Alias:     a.Alias,
+		CreatedBy: a.CreatedBy,
+		CreatedAt: a.CreatedAt,
+	}
+}
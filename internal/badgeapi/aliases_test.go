@@ -0,0 +1,61 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBadgeAliases(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	for _, id := range []string{"abc123", "other123"} {
+		if err := h.db.CreateBadge(&database.Badge{CommitID: id, Type: "certificate", Status: "valid"}); err != nil {
+			t.Fatalf("failed to create badge: %v", err)
+		}
+	}
+	writer := testutil.APIKeyContext("", "badges", "read", "write")
+
+	rec := testutil.Serve(h, writer, http.MethodPost, "/api/badges/abc123/aliases", AliasRequest{Alias: " old-name "})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"invalid alias", http.MethodPost, "/api/badges/abc123/aliases", AliasRequest{Alias: "a b"}, http.StatusBadRequest},
+		{"alias in another case", http.MethodPost, "/api/badges/other123/aliases", AliasRequest{Alias: "OLD-NAME"}, http.StatusConflict},
+		{"alias of a badge ID", http.MethodPost, "/api/badges/abc123/aliases", AliasRequest{Alias: "Other123"}, http.StatusConflict},
+		{"unknown badge", http.MethodPost, "/api/badges/missing1/aliases", AliasRequest{Alias: "fresh123"}, http.StatusNotFound},
+		{"create over an alias", http.MethodPost, "/api/badges", Badge{CommitID: "Old-Name"}, http.StatusConflict},
+		{"delete unknown alias", http.MethodDelete, "/api/badges/other123/aliases/old-name", nil, http.StatusNotFound},
+	} {
+		if got := testutil.Serve(h, writer, tc.method, tc.path, tc.body).Code; got != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, got)
+		}
+	}
+
+	rec = testutil.Serve(h, writer, http.MethodGet, "/api/badges/abc123/aliases", nil)
+	var aliases []Alias
+	json.NewDecoder(rec.Body).Decode(&aliases)
+	if len(aliases) != 1 || aliases[0].Alias != "old-name" || aliases[0].CreatedBy != "user-id" {
+		t.Fatalf("expected the alias, got %+v", aliases)
+	}
+
+	if rec := testutil.Serve(h, writer, http.MethodDelete, "/api/badges/abc123/aliases/old-name", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if id, err := h.db.ResolveBadgeID("old-name"); err != nil || id != "" {
+		t.Errorf("expected the alias to be gone, got %q (err %v)", id, err)
+	}
+}
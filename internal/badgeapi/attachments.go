@@ -0,0 +1,174 @@
+package badgeapi
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/finki/badges/internal/attachment"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/links"
+	"go.uber.org/zap"
+)
+
+// Attachment is the JSON representation of an evidence document attached to a badge
+type Attachment struct {
+	AttachmentID int64     `json:"attachment_id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	UploadedBy   string    `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	// URL downloads the attachment through the API
+	URL string `json:"url"`
+}
+
+// listAttachments returns the attachments of a badge. Like comments they are
+// internal and need access to the badge type.
+func (h *Handler) listAttachments(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	attachments, err := h.db.WithContext(r.Context()).ListAttachments(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to list attachments", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list attachments")
+		return
+	}
+
+	resp := make([]Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		resp = append(resp, attachmentToJSON(a))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// uploadAttachment stores the multipart "file" field as an attachment of a badge
+func (h *Handler) uploadAttachment(w http.ResponseWriter, r *http.Request, commitID string) {
+	// Leave room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, attachment.MaxSize+1<<20)
+	if err := r.ParseMultipartForm(attachment.MaxSize); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid multipart form or file too large")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Missing file field")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, attachment.MaxSize+1))
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	filename, contentType, err := attachment.Validate(header.Filename, content)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	a := &database.Attachment{
+		CommitID:    commitID,
+		Filename:    filename,
+		ContentType: contentType,
+		UploadedBy:  auth.GetUserIDFromContext(r.Context()),
+		CreatedAt:   time.Now(),
+	}
+	if err := h.db.WithContext(r.Context()).CreateAttachment(a, content); err != nil {
+		h.logger.Error("badgeapi: failed to create attachment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+	h.logger.Info("badgeapi: attachment uploaded",
+		zap.String("commit_id", commitID),
+		zap.String("filename", filename),
+		zap.Int64("size", a.Size))
+
+	httpjson.Write(w, http.StatusCreated, attachmentToJSON(a))
+}
+
+// downloadAttachment sends the content of an attachment
+func (h *Handler) downloadAttachment(w http.ResponseWriter, r *http.Request, commitID string) {
+	a, ok := h.loadAttachment(w, r, commitID)
+	if !ok {
+		return
+	}
+
+	content, err := h.db.WithContext(r.Context()).GetAttachmentContent(a)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to read attachment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to read attachment")
+		return
+	}
+	attachment.Write(w, a, content)
+}
+
+// deleteAttachment removes an attachment
+func (h *Handler) deleteAttachment(w http.ResponseWriter, r *http.Request, commitID string) {
+	a, ok := h.loadAttachment(w, r, commitID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(r.Context()).DeleteAttachment(a); err != nil {
+		h.logger.Error("badgeapi: failed to delete attachment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete attachment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadAttachment fetches the attachment named by the last path segment after
+// checking access to its badge, and writes an error response if that fails
+func (h *Handler) loadAttachment(w http.ResponseWriter, r *http.Request, commitID string) (*database.Attachment, bool) {
+	attachmentID, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid attachment ID")
+		return nil, false
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return nil, false
+	}
+
+	a, err := h.db.WithContext(r.Context()).GetAttachment(commitID, attachmentID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get attachment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get attachment")
+		return nil, false
+	}
+	if a == nil {
+		httpjson.Error(w, http.StatusNotFound, "Attachment not found")
+		return nil, false
+	}
+	return a, true
+}
+
+// attachmentToJSON converts a database attachment to its API representation
+func attachmentToJSON(a *database.Attachment) Attachment {
+	return Attachment{
+		AttachmentID: a.AttachmentID,
+		Filename:     a.Filename,
+		ContentType:  a.ContentType,
+		Size:         a.Size,
+		UploadedBy:   a.UploadedBy,
+		CreatedAt:    a.CreatedAt,
+		URL:          links.Path("/api/badges/") + a.CommitID + "/attachments/" + strconv.FormatInt(a.AttachmentID, 10),
+	}
+}
@@ -0,0 +1,124 @@
+package badgeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/blobstore"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+// upload posts content as the multipart file field of an attachment upload
+func upload(h *Handler, ctx context.Context, commitID, filename string, content []byte) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", filename)
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/badges/"+commitID+"/attachments", &buf).WithContext(ctx)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBadgeAttachments(t *testing.T) {
+	for _, backend := range []string{"db", "fs"} {
+		t.Run(backend, func(t *testing.T) {
+			h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+			var store blobstore.Store
+			if backend == "fs" {
+				var err error
+				if store, err = blobstore.NewFilesystem(t.TempDir()); err != nil {
+					t.Fatalf("failed to create blob store: %v", err)
+				}
+				h.db.SetBlobStore(store)
+			}
+
+			now := time.Now()
+			if err := h.db.CreateGroup(&database.Group{
+				GroupID: "reviewers", Name: "Reviewers", Members: []string{"alice"},
+				BadgeTypes: []string{"certificate"}, CreatedAt: now, UpdatedAt: now,
+			}); err != nil {
+				t.Fatalf("failed to create group: %v", err)
+			}
+			if err := h.db.CreateBadge(&database.Badge{CommitID: "evid1234", Type: "certificate", Status: "draft"}); err != nil {
+				t.Fatalf("failed to create badge: %v", err)
+			}
+			alice := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+			auth.GetAPIKeyInfoFromContext(alice).UserID = "alice"
+			outsider := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+			auth.GetAPIKeyInfoFromContext(outsider).UserID = "carol"
+
+			pdf := []byte("%PDF-1.7\nlicence scan")
+			rec := upload(h, alice, "evid1234", "licence.pdf", pdf)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var created Attachment
+			json.NewDecoder(rec.Body).Decode(&created)
+			if created.Filename != "licence.pdf" || created.Size != int64(len(pdf)) || created.UploadedBy != "alice" {
+				t.Errorf("unexpected attachment %+v", created)
+			}
+
+			if rec := upload(h, alice, "evid1234", "tool.exe", []byte("MZ")); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for an unsupported type, got %d", rec.Code)
+			}
+			if rec := upload(h, outsider, "evid1234", "other.pdf", pdf); rec.Code != http.StatusForbidden {
+				t.Errorf("expected 403 uploading without type access, got %d", rec.Code)
+			}
+			if rec := testutil.Serve(h, outsider, http.MethodGet, created.URL, nil); rec.Code != http.StatusForbidden {
+				t.Errorf("expected 403 downloading without type access, got %d", rec.Code)
+			}
+
+			rec = testutil.Serve(h, alice, http.MethodGet, "/api/badges/evid1234/attachments", nil)
+			var list []Attachment
+			json.NewDecoder(rec.Body).Decode(&list)
+			if len(list) != 1 || list[0].AttachmentID != created.AttachmentID {
+				t.Errorf("expected one attachment, got %+v", list)
+			}
+
+			rec = testutil.Serve(h, alice, http.MethodGet, created.URL, nil)
+			if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), pdf) || rec.Header().Get("Content-Type") != "application/pdf" {
+				t.Errorf("unexpected download %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+			}
+
+			stored, _ := h.db.GetAttachment("evid1234", created.AttachmentID)
+			if stored.BlobKey.Valid != (backend == "fs") {
+				t.Errorf("expected the blob key to be set only with a blob store, got %+v", stored.BlobKey)
+			}
+
+			if rec := testutil.Serve(h, alice, http.MethodDelete, created.URL, nil); rec.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if rec := testutil.Serve(h, alice, http.MethodGet, created.URL, nil); rec.Code != http.StatusNotFound {
+				t.Errorf("expected 404 after delete, got %d", rec.Code)
+			}
+			if store != nil {
+				if _, err := store.Get(stored.BlobKey.String); err != blobstore.ErrNotFound {
+					t.Errorf("expected the blob to be deleted, got %v", err)
+				}
+			}
+
+			// Attachments are removed together with their badge
+			upload(h, alice, "evid1234", "bom.json", []byte(`{"bomFormat": "CycloneDX"}`))
+			if err := h.db.DeleteBadge("evid1234"); err != nil {
+				t.Fatalf("failed to delete badge: %v", err)
+			}
+			if attachments, _ := h.db.ListAttachments("evid1234"); len(attachments) != 0 {
+				t.Errorf("expected attachments to be deleted with the badge, got %d", len(attachments))
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// maxCommentLength is the maximum length of a comment in characters
+const maxCommentLength = 4000
+
+// Comment is the JSON representation of an internal note on a badge
+type Comment struct {
+	CommentID int64     `json:"comment_id"`
+	AuthorID  string    `json:"author_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentRequest is the body of POST /api/badges/{commit_id}/comments
+type CommentRequest struct {
+	Body string `json:"body"`
+}
+
+// listComments returns the comment thread of a badge. Comments are internal:
+// like writes, reading them needs access to the badge type.
+func (h *Handler) listComments(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	comments, err := h.db.WithContext(r.Context()).ListComments(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to list comments", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list comments")
+		return
+	}
+
+	resp := make([]Comment, 0, len(comments))
+	for _, c := range comments {
+		resp = append(resp, commentToJSON(c))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// addComment appends a comment to the thread of a badge
+func (h *Handler) addComment(w http.ResponseWriter, r *http.Request, commitID string) {
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		httpjson.Error(w, http.StatusBadRequest, "body is required")
+		return
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLength {
+		httpjson.Error(w, http.StatusBadRequest, "body must be at most "+strconv.Itoa(maxCommentLength)+" characters")
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	comment := &database.Comment{
+		CommitID:  commitID,
+		AuthorID:  auth.GetUserIDFromContext(r.Context()),
+		Body:      req.Body,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.WithContext(r.Context()).CreateComment(comment); err != nil {
+		h.logger.Error("badgeapi: failed to create comment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create comment")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, commentToJSON(comment))
+}
+
+// deleteComment removes a comment; only its author may delete it
+func (h *Handler) deleteComment(w http.ResponseWriter, r *http.Request, commitID string) {
+	db := h.db.WithContext(r.Context())
+
+	commentID, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	comment, err := db.GetComment(commitID, commentID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get comment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get comment")
+		return
+	}
+	if comment == nil {
+		httpjson.Error(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	if comment.AuthorID != auth.GetUserIDFromContext(r.Context()) {
+		httpjson.Error(w, http.StatusForbidden, "Only the author can delete a comment")
+		return
+	}
+
+	if err := db.DeleteComment(commitID, commentID); err != nil {
+		h.logger.Error("badgeapi: failed to delete comment", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentToJSON converts a database comment to its API representation
+func commentToJSON(c *database.Comment) Comment {
+	return Comment{
+		CommentID: c.CommentID,
+		AuthorID:  c.AuthorID,
+		Body:      c.Body,
+		CreatedAt: c.CreatedAt,
+	}
+}
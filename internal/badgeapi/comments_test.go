@@ -0,0 +1,104 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBadgeComments(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	now := time.Now()
+	if err := h.db.CreateGroup(&database.Group{
+		GroupID: "reviewers", Name: "Reviewers", Members: []string{"alice", "bob"},
+		BadgeTypes: []string{"certificate"}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	if err := h.db.CreateBadge(&database.Badge{CommitID: "note1234", Type: "certificate", Status: "draft"}); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+
+	alice := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(alice).UserID = "alice"
+	bob := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(bob).UserID = "bob"
+	outsider := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(outsider).UserID = "carol"
+
+	rec := testutil.Serve(h, alice, http.MethodPost, "/api/badges/note1234/comments", CommentRequest{Body: " Checked the release notes "})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Comment
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.AuthorID != "alice" || created.Body != "Checked the release notes" {
+		t.Errorf("unexpected comment %+v", created)
+	}
+	commentPath := "/api/badges/note1234/comments/" + strconv.FormatInt(created.CommentID, 10)
+
+	for _, tc := range []struct {
+		name   string
+		rec    func() int
+		status int
+	}{
+		{"empty body", func() int {
+			return testutil.Serve(h, bob, http.MethodPost, "/api/badges/note1234/comments", CommentRequest{Body: "  "}).Code
+		}, http.StatusBadRequest},
+		{"too long", func() int {
+			return testutil.Serve(h, bob, http.MethodPost, "/api/badges/note1234/comments", CommentRequest{Body: strings.Repeat("x", maxCommentLength+1)}).Code
+		}, http.StatusBadRequest},
+		{"read without type access", func() int {
+			return testutil.Serve(h, outsider, http.MethodGet, "/api/badges/note1234/comments", nil).Code
+		}, http.StatusForbidden},
+		{"read without badges:read", func() int {
+			return testutil.Serve(h, testutil.APIKeyContext("", "badges", "write"), http.MethodGet, "/api/badges/note1234/comments", nil).Code
+		}, http.StatusForbidden},
+		{"delete someone else's comment", func() int {
+			return testutil.Serve(h, bob, http.MethodDelete, commentPath, nil).Code
+		}, http.StatusForbidden},
+		{"delete invalid ID", func() int {
+			return testutil.Serve(h, alice, http.MethodDelete, "/api/badges/note1234/comments/first", nil).Code
+		}, http.StatusBadRequest},
+		{"unknown subresource", func() int {
+			return testutil.Serve(h, alice, http.MethodGet, "/api/badges/note1234/notes", nil).Code
+		}, http.StatusNotFound},
+	} {
+		if got := tc.rec(); got != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, got)
+		}
+	}
+
+	rec = testutil.Serve(h, bob, http.MethodGet, "/api/badges/note1234/comments", nil)
+	var thread []Comment
+	json.NewDecoder(rec.Body).Decode(&thread)
+	if rec.Code != http.StatusOK || len(thread) != 1 || thread[0].CommentID != created.CommentID {
+		t.Errorf("expected the thread to hold alice's comment, got %d %+v", rec.Code, thread)
+	}
+
+	if rec := testutil.Serve(h, alice, http.MethodDelete, commentPath, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := testutil.Serve(h, alice, http.MethodDelete, commentPath, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+
+	// Comments are removed together with their badge
+	testutil.Serve(h, alice, http.MethodPost, "/api/badges/note1234/comments", CommentRequest{Body: "Second look"})
+	if err := h.db.DeleteBadge("note1234"); err != nil {
+		t.Fatalf("failed to delete badge: %v", err)
+	}
+	if comments, _ := h.db.ListComments("note1234"); len(comments) != 0 {
+		t.Errorf("expected comments to be deleted with the badge, got %d", len(comments))
+	}
+}
@@ -0,0 +1,125 @@
+package badgeapi
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/pkg/utils"
+)
+
+// snippetFormats are the markup languages /api/badges/{commit_id}/embed generates
+var snippetFormats = []string{"markdown", "rst", "asciidoc", "html"}
+
+// Embed is the response of /api/badges/{commit_id}/embed
+type Embed struct {
+	CommitID   string            `json:"commit_id"`
+	ImageURL   string            `json:"image_url"`
+	DetailsURL string            `json:"details_url"`
+	Alt        string            `json:"alt"`
+	Snippets   map[string]string `json:"snippets"`
+}
+
+// Embed serves GET /api/badges/{commit_id}/embed: ready-to-copy snippets that
+// show the badge image and link to its details page. It is public like the
+// details page; drafts are only visible to sessions with badges:write.
+//
+// Query parameters: format (one of utils.Formats) and outlook (badge, certificate)
+// select the image; snippet (markdown, rst, asciidoc, html) returns a single
+// snippet as plain text instead of the JSON document.
+func (h *Handler) Embed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	commitID := strings.TrimSuffix(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/badges"), "/"), "/embed")
+	if !commitid.Valid(commitID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid commit ID")
+		return
+	}
+
+	q := r.URL.Query()
+	format, outlook, snippet := q.Get("format"), q.Get("outlook"), q.Get("snippet")
+	if format != "" && !utils.IsFormat(format) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid format. Supported formats: "+strings.Join(utils.Formats, ", "))
+		return
+	}
+	if outlook != "" && outlook != "badge" && outlook != "certificate" {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid outlook. Supported outlooks: badge, certificate")
+		return
+	}
+	if snippet != "" && !contains(snippetFormats, snippet) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid snippet. Supported snippets: "+strings.Join(snippetFormats, ", "))
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok {
+		return
+	}
+	if !badge.IsPublished() {
+		claims := auth.GetClaimsFromContext(r.Context())
+		if claims == nil || !claims.Permissions.Allows("badges", "write") {
+			// Hide existence of drafts from unauthorized users
+			httpjson.Error(w, http.StatusNotFound, "Badge not found")
+			return
+		}
+	}
+
+	// Only non-default options end up in the image URL, so the common case
+	// stays the short /badge/{commit_id}
+	image := url.Values{}
+	if format != "" && format != "svg" {
+		image.Set("format", format)
+	}
+	if outlook != "" && outlook != "badge" {
+		image.Set("outlook", outlook)
+	}
+
+	base := links.ForRequest(r)
+	e := Embed{
+		CommitID:   commitID,
+		ImageURL:   base + "/badge/" + commitID,
+		DetailsURL: base + "/details/" + commitID,
+		Alt:        fmt.Sprintf("%s %s Certificate", badge.SoftwareName, badge.SoftwareVersion),
+	}
+	if len(image) > 0 {
+		e.ImageURL += "?" + image.Encode()
+	}
+	e.Snippets = map[string]string{
+		"markdown": fmt.Sprintf("[![%s](%s)](%s)", escapeMarkdown(e.Alt), e.ImageURL, e.DetailsURL),
+		"rst":      fmt.Sprintf(".. image:: %s\n   :alt: %s\n   :target: %s", e.ImageURL, e.Alt, e.DetailsURL),
+		"asciidoc": fmt.Sprintf("image:%s[%q,link=%q]", e.ImageURL, e.Alt, e.DetailsURL),
+		"html": fmt.Sprintf(`<a href="%s"><img src="%s" alt="%s"></a>`,
+			html.EscapeString(e.DetailsURL), html.EscapeString(e.ImageURL), html.EscapeString(e.Alt)),
+	}
+
+	if snippet != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, e.Snippets[snippet])
+		return
+	}
+	httpjson.Write(w, http.StatusOK, e)
+}
+
+// escapeMarkdown escapes the characters that would end a Markdown link text early
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func embed(h *Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.Embed(rec, req)
+	return rec
+}
+
+func TestEmbed(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "write")
+
+	for id, status := range map[string]string{"emb123456": "valid", "draft12345": "draft"} {
+		rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+			"commit_id":        id,
+			"software_name":    "Tool [beta]",
+			"software_version": "1.0",
+			"status":           status,
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: expected 201, got %d: %s", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	// X-Forwarded-Proto is honoured from trusted proxies only
+	links.SetTrustedProxy(func(*http.Request) bool { return true })
+	t.Cleanup(func() { links.SetTrustedProxy(nil) })
+	rec := embed(h, "/api/badges/emb123456/embed", map[string]string{"X-Forwarded-Proto": "https"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("embed: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var e Embed
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("embed: failed to decode response: %v", err)
+	}
+	if e.ImageURL != "https://example.com/badge/emb123456" || e.DetailsURL != "https://example.com/details/emb123456" {
+		t.Errorf("unexpected URLs: %s, %s", e.ImageURL, e.DetailsURL)
+	}
+	want := map[string]string{
+		"markdown": `[![Tool \[beta\] 1.0 Certificate](https://example.com/badge/emb123456)](https://example.com/details/emb123456)`,
+		"rst":      ".. image:: https://example.com/badge/emb123456\n   :alt: Tool [beta] 1.0 Certificate\n   :target: https://example.com/details/emb123456",
+		"asciidoc": `image:https://example.com/badge/emb123456["Tool [beta] 1.0 Certificate",link="https://example.com/details/emb123456"]`,
+		"html":     `<a href="https://example.com/details/emb123456"><img src="https://example.com/badge/emb123456" alt="Tool [beta] 1.0 Certificate"></a>`,
+	}
+	for format, snippet := range want {
+		if e.Snippets[format] != snippet {
+			t.Errorf("%s snippet:\n got %q\nwant %q", format, e.Snippets[format], snippet)
+		}
+	}
+
+	rec = embed(h, "/api/badges/emb123456/embed?format=png&outlook=certificate&snippet=html", nil)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("single snippet: expected text/plain, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `src="http://example.com/badge/emb123456?format=png&amp;outlook=certificate"`) {
+		t.Errorf("single snippet: unexpected body %q", rec.Body.String())
+	}
+
+	for path, code := range map[string]int{
+		"/api/badges/emb123456/embed?format=gif":      http.StatusBadRequest,
+		"/api/badges/emb123456/embed?snippet=textile": http.StatusBadRequest,
+		"/api/badges/bad.id/embed":                    http.StatusBadRequest,
+		"/api/badges/missing123/embed":                http.StatusNotFound,
+		"/api/badges/draft12345/embed":                http.StatusNotFound,
+	} {
+		if rec := embed(h, path, nil); rec.Code != code {
+			t.Errorf("%s: expected %d, got %d", path, code, rec.Code)
+		}
+	}
+}
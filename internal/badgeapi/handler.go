@@ -0,0 +1,849 @@
+// Package badgeapi exposes badge CRUD as a JSON API for scripted administration.
+package badgeapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/gitref"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/stats"
+	"github.com/finki/badges/internal/theme"
+	"github.com/finki/badges/internal/validation"
+	"go.uber.org/zap"
+)
+
+// Badge is the JSON representation of a badge. Optional fields are pointers so
+// that an update only touches the fields present in the request body.
+type Badge struct {
+	CommitID        string  `json:"commit_id"`
+	Type            *string `json:"type,omitempty"`
+	Status          *string `json:"status,omitempty"`
+	Issuer          *string `json:"issuer,omitempty"`
+	IssueDate       *string `json:"issue_date,omitempty"`
+	SoftwareName    *string `json:"software_name,omitempty"`
+	SoftwareVersion *string `json:"software_version,omitempty"`
+	SoftwareURL     *string `json:"software_url,omitempty"`
+	Notes           *string `json:"notes,omitempty"`
+	ExpiryDate      *string `json:"expiry_date,omitempty"`
+	IssuerURL       *string `json:"issuer_url,omitempty"`
+	CustomConfig    *string `json:"custom_config,omitempty"`
+	LastReview      *string `json:"last_review,omitempty"`
+	CoveredVersion  *string `json:"covered_version,omitempty"`
+	RepositoryLink  *string `json:"repository_link,omitempty"`
+	PublicNote      *string `json:"public_note,omitempty"`
+	InternalNote    *string `json:"internal_note,omitempty"`
+	ContactDetails  *string `json:"contact_details,omitempty"`
+	CertificateName *string `json:"certificate_name,omitempty"`
+	SpecialtyDomain *string `json:"specialty_domain,omitempty"`
+	SoftwareSCID    *string `json:"software_sc_id,omitempty"`
+	SoftwareSCURL   *string `json:"software_sc_url,omitempty"`
+	GitRepository   *string `json:"git_repository,omitempty"`
+	GitCommitSHA    *string `json:"git_commit_sha,omitempty"`
+	GitTag          *string `json:"git_tag,omitempty"`
+	// IssuerID links the badge to an issuer profile; "" unlinks it
+	IssuerID *string `json:"issuer_id,omitempty"`
+	// CertificateTypeID links the badge to a certificate type, which then
+	// decides access to it; "" unlinks it
+	CertificateTypeID *string `json:"certificate_type_id,omitempty"`
+	// OrgID is the owning organization. Organization admins always create and
+	// keep badges in their own organization.
+	OrgID *string `json:"org_id,omitempty"`
+	// PublishAt schedules publication (RFC 3339): the badge stays hidden until
+	// then, and a draft is published at that time; "" unschedules it
+	PublishAt *string `json:"publish_at,omitempty"`
+	// ExpiresAt is the instant the badge expires (RFC 3339, UTC): the start of
+	// the expiry date in the issuer's timezone. It is ignored in requests.
+	ExpiresAt *string `json:"expires_at,omitempty"`
+}
+
+// Handler serves /api/badges and /api/badges/{commit_id}
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+	logos  LogoSource
+	stats  *stats.Recorder
+	// requireApproval makes approval through review the only way to publish a badge
+	requireApproval bool
+}
+
+// LogoSource resolves the logo reference of a badge's custom config, e.g.
+// *logo.Resolver
+type LogoSource interface {
+	Resolve(ref string) (*theme.Logo, error)
+}
+
+// NewHandler creates a new badge API handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// SetLogoSource makes create and update reject custom config logos that
+// cannot be loaded
+func (h *Handler) SetLogoSource(src LogoSource) {
+	h.logos = src
+}
+
+// SetRequireApproval makes create and update refuse to publish badges, which
+// then have to be submitted for review and approved
+func (h *Handler) SetRequireApproval(require bool) {
+	h.requireApproval = require
+}
+
+// subresources are the paths below /api/badges/{commit_id}, with item IDs
+// replaced by {id}
+var subresources = map[string]bool{
+	"review":           true,
+	"comments":         true,
+	"comments/{id}":    true,
+	"attachments":      true,
+	"attachments/{id}": true,
+	"sbom":             true,
+	"aliases":          true,
+	"aliases/{id}":     true,
+	"stats":            true,
+	"image-url":        true,
+}
+
+// ServeHTTP dispatches on method and path; each operation requires its own permission
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	commitID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/badges"), "/")
+	commitID, sub, _ := strings.Cut(commitID, "/")
+	if resource, _, ok := strings.Cut(sub, "/"); ok {
+		sub = resource + "/{id}"
+	}
+
+	var next http.Handler
+	switch {
+	case sub == "review" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.history))
+	case sub == "review" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.review))
+	case sub == "comments" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.listComments))
+	case sub == "comments" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.addComment))
+	case sub == "comments/{id}" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.deleteComment))
+	case sub == "attachments" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.listAttachments))
+	case sub == "attachments" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.uploadAttachment))
+	case sub == "attachments/{id}" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.downloadAttachment))
+	case sub == "attachments/{id}" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", h.withCommitID(commitID, h.deleteAttachment))
+	case sub == "sbom" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.getSBOM))
+	case sub == "sbom" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.uploadSBOM))
+	case sub == "sbom" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.deleteSBOM))
+	case sub == "aliases" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.listAliases))
+	case sub == "aliases" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.addAlias))
+	case sub == "aliases/{id}" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.deleteAlias))
+	case sub == "stats" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.getStats))
+	case sub == "stats" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", h.withCommitID(commitID, h.deleteStats))
+	case sub == "image-url" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.signImageURL))
+	case subresources[sub]:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	case sub != "":
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	case commitID == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", http.HandlerFunc(h.list))
+	case commitID == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", http.HandlerFunc(h.create))
+	case commitID != "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withCommitID(commitID, h.get))
+	case commitID != "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withCommitID(commitID, h.update))
+	case commitID != "" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", h.withCommitID(commitID, h.delete))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// withCommitID validates the commit ID before calling fn
+func (h *Handler) withCommitID(commitID string, fn func(http.ResponseWriter, *http.Request, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !commitid.Valid(commitID) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid commit ID")
+			return
+		}
+		fn(w, r, commitID)
+	})
+}
+
+// Error is a failed badge operation, with the HTTP status it is reported as
+type Error struct {
+	Status  int
+	Message string
+	// Fields are the errors by field of a badge that failed validation
+	Fields validation.Errors
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// newError creates an Error
+func newError(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// newValidationError creates the Error of a badge that failed validation,
+// reported as 422 with the errors by field
+func newValidationError(errs validation.Errors) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Message: "Invalid badge: " + errs.Error(), Fields: errs}
+}
+
+// List returns the badges the caller may see, drafts included, and their total
+// count before pagination. Organization-scoped callers only see their own.
+func (h *Handler) List(ctx context.Context, query database.BadgeQuery) ([]*database.Badge, int, error) {
+	query.IncludeDrafts = true
+	if org := auth.GetOrgIDFromContext(ctx); org != "" {
+		query.Org = org
+	}
+
+	badges, total, err := h.db.WithContext(ctx).SearchBadges(query)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to list badges", zap.Error(err))
+		return nil, 0, newError(http.StatusInternalServerError, "Failed to list badges")
+	}
+	return badges, total, nil
+}
+
+// Get returns a badge. Badges of other organizations are reported as not found.
+func (h *Handler) Get(ctx context.Context, commitID string) (*database.Badge, error) {
+	if !commitid.Valid(commitID) {
+		return nil, newError(http.StatusBadRequest, "Invalid commit ID")
+	}
+	badge, err := h.db.WithContext(ctx).GetBadge(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get badge", zap.String("commit_id", commitID), zap.Error(err))
+		return nil, newError(http.StatusInternalServerError, "Failed to get badge")
+	}
+	if badge == nil || !auth.CanAccessOrg(ctx, badge.OrgID.String) {
+		return nil, newError(http.StatusNotFound, "Badge not found")
+	}
+	return badge, nil
+}
+
+// Create inserts a new badge built from req. The check for an existing badge
+// and the insert run in one transaction, so concurrent creates cannot both
+// succeed.
+func (h *Handler) Create(ctx context.Context, req *Badge) (*database.Badge, error) {
+	if !commitid.Valid(req.CommitID) {
+		return nil, newError(http.StatusBadRequest, "Invalid commit ID")
+	}
+
+	badge := req.ToDatabase()
+	if err := h.checkTypeAccess(ctx, badge.AccessType()); err != nil {
+		return nil, err
+	}
+	if err := h.check(ctx, req, badge); err != nil {
+		return nil, err
+	}
+	if err := database.CheckNewStatus(badge.Status, h.requireApproval); err != nil {
+		return nil, newError(http.StatusBadRequest, err.Error())
+	}
+
+	err := h.db.WithContext(ctx).WithTx(func(tx *database.DB) error {
+		existing, err := tx.GetBadge(badge.CommitID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return newError(http.StatusConflict, "Badge already exists")
+		}
+		// The ID must not take over an alias or another badge's URLs
+		resolved, err := tx.ResolveBadgeID(badge.CommitID)
+		if err != nil {
+			return err
+		}
+		if resolved != "" {
+			return newError(http.StatusConflict, "Commit ID is in use by badge "+resolved)
+		}
+		return tx.CreateBadge(badge)
+	})
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return nil, apiErr
+	}
+	if err != nil {
+		h.logger.Error("badgeapi: failed to create badge", zap.String("commit_id", req.CommitID), zap.Error(err))
+		return nil, newError(http.StatusInternalServerError, "Failed to create badge")
+	}
+
+	h.invalidate(badge.CommitID)
+	return badge, nil
+}
+
+// Update applies the fields present in req to an existing badge
+func (h *Handler) Update(ctx context.Context, commitID string, req *Badge) (*database.Badge, error) {
+	if req.CommitID != "" && req.CommitID != commitID {
+		return nil, newError(http.StatusBadRequest, "commit_id cannot be changed")
+	}
+
+	badge, err := h.Get(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+	oldType, oldStatus := badge.AccessType(), badge.Status
+	req.ApplyTo(badge)
+	if err := h.checkTypeAccess(ctx, oldType, badge.AccessType()); err != nil {
+		return nil, err
+	}
+	if err := h.check(ctx, req, badge); err != nil {
+		return nil, err
+	}
+	if err := database.CheckStatusChange(oldStatus, badge.Status, h.requireApproval); err != nil {
+		return nil, newError(http.StatusBadRequest, err.Error())
+	}
+
+	// Stored renders are stale once the badge data changes
+	badge.PNGContent = nil
+	badge.JPGContent = nil
+	badge.PNGKey = sql.NullString{}
+	badge.JPGKey = sql.NullString{}
+
+	// The badge may have been deleted while the update was checked
+	err = h.db.WithContext(ctx).WithTx(func(tx *database.DB) error {
+		current, err := tx.GetBadge(commitID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return newError(http.StatusNotFound, "Badge not found")
+		}
+		return tx.UpdateBadge(badge)
+	})
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return nil, apiErr
+	}
+	if err != nil {
+		h.logger.Error("badgeapi: failed to update badge", zap.String("commit_id", commitID), zap.Error(err))
+		return nil, newError(http.StatusInternalServerError, "Failed to update badge")
+	}
+
+	h.invalidate(commitID)
+	return badge, nil
+}
+
+// Delete removes a badge
+func (h *Handler) Delete(ctx context.Context, commitID string) error {
+	badge, err := h.Get(ctx, commitID)
+	if err != nil {
+		return err
+	}
+	if err := h.checkTypeAccess(ctx, badge.AccessType()); err != nil {
+		return err
+	}
+
+	if err := h.db.WithContext(ctx).DeleteBadge(commitID); err != nil {
+		h.logger.Error("badgeapi: failed to delete badge", zap.String("commit_id", commitID), zap.Error(err))
+		return newError(http.StatusInternalServerError, "Failed to delete badge")
+	}
+
+	h.invalidate(commitID)
+	return nil
+}
+
+// check validates the fields of req applied to b, resolving its logo, issuer
+// and organization
+func (h *Handler) check(ctx context.Context, req *Badge, b *database.Badge) error {
+	if err := req.validate(b); err != nil {
+		return newError(http.StatusBadRequest, err.Error())
+	}
+	if errs := req.dateErrors().Merge(validation.Badge(b)); errs != nil {
+		return newValidationError(errs)
+	}
+	if err := h.checkLogo(req, b); err != nil {
+		return newError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.checkIssuer(ctx, req, b); err != nil {
+		return newError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.checkCertificateType(ctx, req, b); err != nil {
+		return newError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.checkOrg(ctx, req, b); err != nil {
+		return newError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// checkTypeAccess checks that the caller has access to badges of each given
+// type, which is needed to write them or read their comments. Changing a
+// badge's type requires access to both the old and the new type.
+func (h *Handler) checkTypeAccess(ctx context.Context, types ...string) error {
+	userID := auth.GetUserIDFromContext(ctx)
+	for _, badgeType := range types {
+		ok, err := h.db.WithContext(ctx).UserHasAccessToBadgeType(userID, badgeType)
+		if err != nil {
+			h.logger.Error("badgeapi: failed to check badge type access", zap.String("badge_type", badgeType), zap.Error(err))
+			return newError(http.StatusInternalServerError, "Failed to check badge type access")
+		}
+		if !ok {
+			return newError(http.StatusForbidden, "Not authorized for badge type "+badgeType)
+		}
+	}
+	return nil
+}
+
+// list returns the badges, drafts included, filtered, sorted and paginated by
+// the same query parameters as the list page
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	query, err := database.ParseBadgeQuery(r.URL.Query())
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	badges, total, err := h.List(r.Context(), query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := make([]Badge, 0, len(badges))
+	for _, b := range badges {
+		resp = append(resp, ToJSON(b))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if query.Paginated() {
+		w.Header().Set("Link", query.LinkHeader(links.Path(r.URL.Path), total, nil))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single badge
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok {
+		return
+	}
+	httpjson.Write(w, http.StatusOK, ToJSON(badge))
+}
+
+// create inserts a new badge
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req Badge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	badge, err := h.Create(r.Context(), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusCreated, ToJSON(badge))
+}
+
+// update applies the fields present in the request body to an existing badge
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, commitID string) {
+	var req Badge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	badge, err := h.Update(r.Context(), commitID, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, ToJSON(badge))
+}
+
+// delete removes a badge
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, commitID string) {
+	if err := h.Delete(r.Context(), commitID); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// load fetches a badge and writes an error response if it cannot be found
+func (h *Handler) load(w http.ResponseWriter, r *http.Request, commitID string) (*database.Badge, bool) {
+	badge, err := h.Get(r.Context(), commitID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return badge, true
+}
+
+// canAccessType checks the caller's access to badges of each given type and
+// writes a 403 response if it is missing
+func (h *Handler) canAccessType(w http.ResponseWriter, r *http.Request, types ...string) bool {
+	if err := h.checkTypeAccess(r.Context(), types...); err != nil {
+		writeError(w, err)
+		return false
+	}
+	return true
+}
+
+// invalidate drops every cached render and page that shows the badge
+func (h *Handler) invalidate(commitID string) {
+	h.cache.DeletePrefix("badge:" + commitID + ":")
+	h.cache.DeletePrefix("certificate:" + commitID + ":")
+	h.cache.Delete("details:" + commitID)
+	h.cache.DeletePrefix("badges:list:")
+	h.cache.Delete("home:index")
+}
+
+// ToJSON converts a database badge to its API representation
+func ToJSON(b *database.Badge) Badge {
+	return Badge{
+		CommitID:          b.CommitID,
+		Type:              &b.Type,
+		Status:            statusToPtr(b.Status),
+		Issuer:            &b.Issuer,
+		IssueDate:         nullDateToPtr(sql.NullTime{Time: b.IssueDate, Valid: true}),
+		SoftwareName:      &b.SoftwareName,
+		SoftwareVersion:   &b.SoftwareVersion,
+		SoftwareURL:       nullStringToPtr(b.SoftwareURL),
+		Notes:             nullStringToPtr(b.Notes),
+		ExpiryDate:        nullDateToPtr(b.ExpiryDate),
+		IssuerURL:         nullStringToPtr(b.IssuerURL),
+		CustomConfig:      nullStringToPtr(b.CustomConfig),
+		LastReview:        nullDateToPtr(b.LastReview),
+		CoveredVersion:    nullStringToPtr(b.CoveredVersion),
+		RepositoryLink:    nullStringToPtr(b.RepositoryLink),
+		PublicNote:        nullStringToPtr(b.PublicNote),
+		InternalNote:      nullStringToPtr(b.InternalNote),
+		ContactDetails:    nullStringToPtr(b.ContactDetails),
+		CertificateName:   nullStringToPtr(b.CertificateName),
+		SpecialtyDomain:   nullStringToPtr(b.SpecialtyDomain),
+		SoftwareSCID:      nullStringToPtr(b.SoftwareSCID),
+		SoftwareSCURL:     nullStringToPtr(b.SoftwareSCURL),
+		GitRepository:     nullStringToPtr(b.GitRepository),
+		GitCommitSHA:      nullStringToPtr(b.GitCommitSHA),
+		GitTag:            nullStringToPtr(b.GitTag),
+		IssuerID:          nullStringToPtr(b.IssuerID),
+		OrgID:             nullStringToPtr(b.OrgID),
+		PublishAt:         nullTimeToPtr(b.PublishAt),
+		ExpiresAt:         expiresAtToPtr(b),
+		CertificateTypeID: nullStringToPtr(b.CertificateTypeID),
+	}
+}
+
+// ToDatabase builds a new badge from req; missing required fields fall back to
+// the same defaults used by the web form
+func (req *Badge) ToDatabase() *database.Badge {
+	badge := &database.Badge{
+		CommitID:        req.CommitID,
+		Type:            "badge",
+		Status:          "draft",
+		Issuer:          theme.Get().Issuer,
+		IssueDate:       database.Day(time.Now()),
+		SoftwareName:    database.PlaceholderSoftwareName,
+		SoftwareVersion: "0.0.0",
+	}
+	req.ApplyTo(badge)
+	return badge
+}
+
+// ApplyTo copies the fields present in req onto b; an empty string clears an
+// optional field. Dates that are not YYYY-MM-DD are left as they are and
+// reported by check.
+func (req *Badge) ApplyTo(b *database.Badge) {
+	setString(&b.Type, req.Type)
+	setStatus(&b.Status, req.Status)
+	setString(&b.Issuer, req.Issuer)
+	setDate(&b.IssueDate, req.IssueDate)
+	setString(&b.SoftwareName, req.SoftwareName)
+	setString(&b.SoftwareVersion, req.SoftwareVersion)
+	setNullString(&b.SoftwareURL, req.SoftwareURL)
+	setNullString(&b.Notes, req.Notes)
+	setNullDate(&b.ExpiryDate, req.ExpiryDate)
+	setNullString(&b.IssuerURL, req.IssuerURL)
+	setNullString(&b.CustomConfig, req.CustomConfig)
+	setNullDate(&b.LastReview, req.LastReview)
+	setNullString(&b.CoveredVersion, req.CoveredVersion)
+	setNullString(&b.RepositoryLink, req.RepositoryLink)
+	setNullString(&b.PublicNote, req.PublicNote)
+	setNullString(&b.InternalNote, req.InternalNote)
+	setNullString(&b.ContactDetails, req.ContactDetails)
+	setNullString(&b.CertificateName, req.CertificateName)
+	setNullString(&b.SpecialtyDomain, req.SpecialtyDomain)
+	setNullString(&b.SoftwareSCID, req.SoftwareSCID)
+	setNullString(&b.SoftwareSCURL, req.SoftwareSCURL)
+	setNullString(&b.GitRepository, req.GitRepository)
+	setNullString(&b.GitCommitSHA, req.GitCommitSHA)
+	setNullString(&b.GitTag, req.GitTag)
+	setNullString(&b.IssuerID, req.IssuerID)
+	setNullString(&b.CertificateTypeID, req.CertificateTypeID)
+}
+
+// validate checks the repository links and git binding in req against the
+// resulting badge b, and normalizes the commit SHA
+func (req *Badge) validate(b *database.Badge) error {
+	if req.RepositoryLink != nil {
+		for _, repo := range b.GetRepositories() {
+			if err := gitref.ValidateRepoURL(repo.URL); err != nil {
+				return err
+			}
+		}
+	}
+	sha, err := gitref.ValidateBinding(b.GitRepository.String, b.GitCommitSHA.String, b.GitTag.String)
+	if err != nil {
+		return err
+	}
+	b.GitCommitSHA.String = sha
+
+	if req.PublishAt != nil {
+		b.PublishAt = sql.NullTime{}
+		if *req.PublishAt != "" {
+			t, err := time.Parse(time.RFC3339, *req.PublishAt)
+			if err != nil {
+				return fmt.Errorf("invalid publish_at, expected RFC 3339 such as 2026-01-31T09:00:00Z")
+			}
+			b.PublishAt = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return nil
+}
+
+// checkLogo resolves the logo of a changed custom config, so that a logo the
+// badge could not render is reported instead of silently replaced by the theme
+// logo
+func (h *Handler) checkLogo(req *Badge, b *database.Badge) error {
+	if h.logos == nil || req.CustomConfig == nil {
+		return nil
+	}
+	config, err := b.GetCustomConfig()
+	if err != nil {
+		return fmt.Errorf("invalid custom_config: %w", err)
+	}
+	if config.LogoURL == "" {
+		return nil
+	}
+	if _, err := h.logos.Resolve(config.LogoURL); err != nil {
+		return fmt.Errorf("invalid logo: %w", err)
+	}
+	return nil
+}
+
+// checkIssuer makes sure a newly linked issuer profile exists, and fills in the
+// issuer name and URL from it unless the request sets them
+func (h *Handler) checkIssuer(ctx context.Context, req *Badge, b *database.Badge) error {
+	if req.IssuerID == nil {
+		return nil
+	}
+	if !b.IssuerID.Valid {
+		b.IssuerTimezone = sql.NullString{}
+		return nil
+	}
+	issuer, err := h.db.WithContext(ctx).GetIssuer(b.IssuerID.String)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get issuer", zap.String("issuer_id", b.IssuerID.String), zap.Error(err))
+		return fmt.Errorf("failed to look up issuer_id")
+	}
+	if issuer == nil {
+		return fmt.Errorf("unknown issuer_id: %s", b.IssuerID.String)
+	}
+	if req.Issuer == nil {
+		b.Issuer = issuer.Name
+	}
+	if req.IssuerURL == nil && issuer.URL.Valid {
+		b.IssuerURL = issuer.URL
+	}
+	b.IssuerTimezone = issuer.Timezone
+	return nil
+}
+
+// checkCertificateType makes sure a newly linked certificate type exists, and
+// fills in the certificate name and specialty domain from it unless the
+// request sets them
+func (h *Handler) checkCertificateType(ctx context.Context, req *Badge, b *database.Badge) error {
+	if req.CertificateTypeID == nil || !b.CertificateTypeID.Valid {
+		return nil
+	}
+	certType, err := h.db.WithContext(ctx).GetCertificateType(b.CertificateTypeID.String)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get certificate type", zap.String("certificate_type_id", b.CertificateTypeID.String), zap.Error(err))
+		return fmt.Errorf("failed to look up certificate_type_id")
+	}
+	if certType == nil {
+		return fmt.Errorf("unknown certificate_type_id: %s", b.CertificateTypeID.String)
+	}
+	if req.CertificateName == nil {
+		b.CertificateName = sql.NullString{String: certType.Name, Valid: true}
+	}
+	if req.SpecialtyDomain == nil && certType.SpecialtyDomain.Valid {
+		b.SpecialtyDomain = certType.SpecialtyDomain
+	}
+	return nil
+}
+
+// checkOrg assigns the badge to the caller's organization. Instance-wide
+// callers may move a badge to any existing organization, or out of one with "".
+func (h *Handler) checkOrg(ctx context.Context, req *Badge, b *database.Badge) error {
+	if scope := auth.GetOrgIDFromContext(ctx); scope != "" {
+		if req.OrgID != nil && *req.OrgID != scope {
+			return fmt.Errorf("org_id must be your organization %s", scope)
+		}
+		b.OrgID = sql.NullString{String: scope, Valid: true}
+		return nil
+	}
+
+	if req.OrgID == nil {
+		return nil
+	}
+	setNullString(&b.OrgID, req.OrgID)
+	if !b.OrgID.Valid {
+		return nil
+	}
+	org, err := h.db.WithContext(ctx).GetOrganization(b.OrgID.String)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get organization", zap.String("org_id", b.OrgID.String), zap.Error(err))
+		return fmt.Errorf("failed to look up org_id")
+	}
+	if org == nil {
+		return fmt.Errorf("unknown org_id: %s", b.OrgID.String)
+	}
+	return nil
+}
+
+func setString(dst *string, v *string) {
+	if v != nil && *v != "" {
+		*dst = *v
+	}
+}
+
+// dateErrors reports the dates of req that are not YYYY-MM-DD
+func (req *Badge) dateErrors() validation.Errors {
+	values := map[string]string{}
+	for field, v := range map[string]*string{"issue_date": req.IssueDate, "expiry_date": req.ExpiryDate, "last_review": req.LastReview} {
+		if v != nil {
+			values[field] = *v
+		}
+	}
+	return validation.Dates(values)
+}
+
+func setDate(dst *time.Time, v *string) {
+	if v == nil || *v == "" {
+		return
+	}
+	if t, err := database.ParseDate(*v); err == nil {
+		*dst = t
+	}
+}
+
+func setNullDate(dst *sql.NullTime, v *string) {
+	if v == nil {
+		return
+	}
+	if *v == "" {
+		*dst = sql.NullTime{}
+		return
+	}
+	if t, err := database.ParseDate(*v); err == nil {
+		*dst = sql.NullTime{Time: t, Valid: true}
+	}
+}
+
+// setStatus sets a status given in any case; unknown statuses are kept as
+// they are and reported by check
+func setStatus(dst *database.Status, v *string) {
+	if v == nil {
+		return
+	}
+	if status, err := database.ParseStatus(*v); err == nil {
+		*dst = status
+	} else {
+		*dst = database.Status(*v)
+	}
+}
+
+func setNullString(dst *sql.NullString, v *string) {
+	if v != nil {
+		*dst = sql.NullString{String: *v, Valid: *v != ""}
+	}
+}
+
+func statusToPtr(status database.Status) *string {
+	s := string(status)
+	return &s
+}
+
+func nullStringToPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func nullDateToPtr(d sql.NullTime) *string {
+	if !d.Valid {
+		return nil
+	}
+	s := database.FormatDate(d.Time)
+	return &s
+}
+
+func expiresAtToPtr(b *database.Badge) *string {
+	t, ok := b.ExpiresAt()
+	return nullTimeToPtr(sql.NullTime{Time: t, Valid: ok})
+}
+
+func nullTimeToPtr(nt sql.NullTime) *string {
+	if !nt.Valid {
+		return nil
+	}
+	s := nt.Time.UTC().Format(time.RFC3339)
+	return &s
+}
+
+// writeError writes err as a JSON error response, with the status of an Error
+// and 500 otherwise. Validation errors add the errors by field:
+//
+//	{"error": "Invalid badge: ...", "fields": {"issue_date": "..."}}
+func writeError(w http.ResponseWriter, err error) {
+	var e *Error
+	if errors.As(err, &e) && e.Fields != nil {
+		httpjson.Write(w, e.Status, map[string]interface{}{"error": e.Message, "fields": e.Fields})
+		return
+	}
+	if errors.As(err, &e) {
+		httpjson.Error(w, e.Status, e.Message)
+		return
+	}
+	httpjson.Error(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,469 @@
+package badgeapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/logo"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBadgeLifecycle(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":     "cli123456",
+		"software_name": "Tool",
+		"status":        "valid",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{"commit_id": "cli123456"})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate create: expected 409, got %d", rec.Code)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/badges/cli123456", map[string]string{"notes": "scripted"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodGet, "/api/badges/cli123456", nil)
+	var got Badge
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("get: failed to decode response: %v", err)
+	}
+	if got.Notes == nil || *got.Notes != "scripted" || *got.SoftwareName != "Tool" || *got.Status != "valid" {
+		t.Errorf("get: unexpected badge %+v", got)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodDelete, "/api/badges/cli123456", nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", rec.Code)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodGet, "/api/badges/cli123456", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestBadgePermissions(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read")
+
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/badges", nil); rec.Code != http.StatusOK {
+		t.Errorf("list: expected 200, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{"commit_id": "cli123456"}); rec.Code != http.StatusForbidden {
+		t.Errorf("create without write: expected 403, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, context.Background(), http.MethodGet, "/api/badges", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("list without credentials: expected 401, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/badges/bad.id", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid commit ID: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestBadgeGitBindingValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	for name, body := range map[string]map[string]string{
+		"sha without repository": {"git_commit_sha": "4d07ae0c"},
+		"tag without sha":        {"git_repository": "https://github.com/owner/repo", "git_tag": "v1"},
+		"bad sha":                {"git_repository": "https://github.com/owner/repo", "git_commit_sha": "nothex!"},
+		"bad tag":                {"git_repository": "https://github.com/owner/repo", "git_commit_sha": "4d07ae0c", "git_tag": "v1..2"},
+		"bad repository link":    {"repository_link": `[{"name":"x","url":"ftp://example.org/x"}]`},
+	} {
+		body["commit_id"] = "git1234567"
+		if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":      "git1234567",
+		"git_repository": "git@github.com:owner/repo.git",
+		"git_commit_sha": "4D07AE0C",
+		"git_tag":        "v1.0.0",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got Badge
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.GitCommitSHA == nil || *got.GitCommitSHA != "4d07ae0c" {
+		t.Errorf("expected the SHA to be stored lowercased, got %v", got.GitCommitSHA)
+	}
+}
+
+func TestBadgeLogoValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	h.SetLogoSource(logo.NewResolver([]string{"logos.example.org"}, 0, nil))
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":     "logo123456",
+		"custom_config": `{"logo":"https://evil.example.com/logo.svg"}`,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("disallowed host: expected 400, got %d", rec.Code)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":     "logo123456",
+		"custom_config": `{"logo":"data:image/svg+xml,%3Csvg%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%20viewBox%3D%220%200%201%201%22%2F%3E"}`,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("data URI: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPut, "/api/badges/logo123456", map[string]string{
+		"custom_config": `{"logo":"data:text/html,hello"}`,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("update with bad logo: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestBadgeOrgScope(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	now := time.Now()
+	for _, id := range []string{"geant", "other"} {
+		if err := h.db.CreateOrganization(&database.Organization{OrgID: id, Name: id, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("failed to create organization: %v", err)
+		}
+	}
+
+	admin := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+	if rec := testutil.Serve(h, admin, http.MethodPost, "/api/badges", map[string]string{"commit_id": "other123", "org_id": "other"}); rec.Code != http.StatusCreated {
+		t.Fatalf("create in other org: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := testutil.Serve(h, admin, http.MethodPost, "/api/badges", map[string]string{"commit_id": "nowhere1", "org_id": "missing"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("create in unknown org: expected 400, got %d", rec.Code)
+	}
+
+	// A key of an organization admin acts within its owner's organization
+	orgAdmin := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+	auth.GetAPIKeyInfoFromContext(orgAdmin).OrgID = "geant"
+
+	rec := testutil.Serve(h, orgAdmin, http.MethodPost, "/api/badges", map[string]string{"commit_id": "geant123"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Badge
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.OrgID == nil || *created.OrgID != "geant" {
+		t.Errorf("expected the badge to be created in the caller's organization, got %v", created.OrgID)
+	}
+	if rec := testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/badges/geant123", map[string]string{"org_id": "other"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("move to another org: expected 400, got %d", rec.Code)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		if rec := testutil.Serve(h, orgAdmin, method, "/api/badges/other123", map[string]string{}); rec.Code != http.StatusNotFound {
+			t.Errorf("%s of another org's badge: expected 404, got %d", method, rec.Code)
+		}
+	}
+
+	rec = testutil.Serve(h, orgAdmin, http.MethodGet, "/api/badges", nil)
+	var listed []Badge
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].CommitID != "geant123" {
+		t.Errorf("expected only the organization's badge to be listed, got %+v", listed)
+	}
+}
+
+func TestBadgeTypeAuthority(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	now := time.Now()
+	if err := h.db.CreateRole(&database.Role{RoleID: "member-role", Name: "member", Permissions: "{}", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("failed to create role: %v", err)
+	}
+	for _, id := range []string{"member", "outsider"} {
+		if err := h.db.CreateUser(&database.User{
+			UserID: id, Username: id, Email: id + "@example.org", PasswordHash: "x",
+			RoleID: "member-role", Status: "active", CreatedAt: now, UpdatedAt: now,
+		}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	admin, err := h.db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("failed to get default admin: %v", err)
+	}
+	// Only members of "trusted" may write certificates; plain badges stay open
+	if err := h.db.CreateGroup(&database.Group{
+		GroupID: "trusted", Name: "Trusted issuers", Members: []string{"member"},
+		BadgeTypes: []string{"certificate"}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	type op struct {
+		method, path string
+		body         Badge
+	}
+	ops := map[string]func(prefix string) op{
+		"create certificate": func(p string) op {
+			return op{http.MethodPost, "/api/badges", Badge{CommitID: p + "new1", Type: strPtr("certificate")}}
+		},
+		"create badge": func(p string) op {
+			return op{http.MethodPost, "/api/badges", Badge{CommitID: p + "new2"}}
+		},
+		"retype to certificate": func(p string) op {
+			return op{http.MethodPatch, "/api/badges/" + p + "plain", Badge{Type: strPtr("certificate")}}
+		},
+		"update certificate": func(p string) op {
+			return op{http.MethodPatch, "/api/badges/" + p + "certi", Badge{SoftwareName: strPtr("Renamed")}}
+		},
+		"retype from certificate": func(p string) op {
+			return op{http.MethodPatch, "/api/badges/" + p + "cert2", Badge{Type: strPtr("badge")}}
+		},
+		"delete certificate": func(p string) op {
+			return op{http.MethodDelete, "/api/badges/" + p + "cert3", Badge{}}
+		},
+	}
+	allowed := map[string]int{
+		"create certificate": http.StatusCreated, "create badge": http.StatusCreated,
+		"retype to certificate": http.StatusOK, "update certificate": http.StatusOK,
+		"retype from certificate": http.StatusOK, "delete certificate": http.StatusNoContent,
+	}
+	matrix := map[string]map[string]int{
+		admin.UserID: allowed,
+		"member":     allowed,
+		"outsider": {
+			"create certificate": http.StatusForbidden, "create badge": http.StatusCreated,
+			"retype to certificate": http.StatusForbidden, "update certificate": http.StatusForbidden,
+			"retype from certificate": http.StatusForbidden, "delete certificate": http.StatusForbidden,
+		},
+	}
+
+	for userID, expected := range matrix {
+		ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+		auth.GetAPIKeyInfoFromContext(ctx).UserID = userID
+		prefix := userID[:3] + "x"
+		for suffix, badgeType := range map[string]string{"plain": "badge", "certi": "certificate", "cert2": "certificate", "cert3": "certificate"} {
+			if err := h.db.CreateBadge(&database.Badge{
+				CommitID: prefix + suffix, Type: badgeType, Status: "valid", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				Issuer: "GÉANT", SoftwareName: "Tool", SoftwareVersion: "1.0",
+			}); err != nil {
+				t.Fatalf("failed to create badge: %v", err)
+			}
+		}
+
+		for name, build := range ops {
+			o := build(prefix)
+			if rec := testutil.Serve(h, ctx, o.method, o.path, o.body); rec.Code != expected[name] {
+				t.Errorf("%s: %s: expected %d, got %d: %s", userID, name, expected[name], rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	// Deleting the group opens the badge type up again
+	if err := h.db.DeleteGroup("trusted"); err != nil {
+		t.Fatalf("failed to delete group: %v", err)
+	}
+	if ok, err := h.db.UserHasAccessToBadgeType("outsider", "certificate"); err != nil || !ok {
+		t.Errorf("expected certificates to be unrestricted without groups, got %v (%v)", ok, err)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestReviewWorkflow(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	issuer := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(issuer).UserID = "alice"
+	reviewer := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(reviewer).UserID = "bob"
+
+	if rec := testutil.Serve(h, issuer, http.MethodPost, "/api/badges", Badge{CommitID: "rev1234"}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	steps := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		path   string
+		body   interface{}
+		status int
+		want   database.Status
+	}{
+		{"set pending directly", issuer, http.MethodPatch, "/api/badges/rev1234", Badge{Status: strPtr("pending")}, http.StatusBadRequest, "draft"},
+		{"approve a draft", reviewer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "approve"}, http.StatusConflict, "draft"},
+		{"submit", issuer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "submit"}, http.StatusOK, "pending"},
+		{"approve own submission", issuer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "approve"}, http.StatusForbidden, "pending"},
+		{"publish bypassing review", issuer, http.MethodPatch, "/api/badges/rev1234", Badge{Status: strPtr("valid")}, http.StatusBadRequest, "pending"},
+		{"reject without comment", reviewer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "reject"}, http.StatusBadRequest, "pending"},
+		{"reject", reviewer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "reject", Comment: "Wrong version"}, http.StatusOK, "draft"},
+		{"resubmit", issuer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "submit"}, http.StatusOK, "pending"},
+		{"unknown action", reviewer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "publish"}, http.StatusConflict, "pending"},
+		{"approve", reviewer, http.MethodPost, "/api/badges/rev1234/review", ReviewRequest{Action: "approve"}, http.StatusOK, "valid"},
+	}
+	for _, s := range steps {
+		if rec := testutil.Serve(h, s.ctx, s.method, s.path, s.body); rec.Code != s.status {
+			t.Errorf("%s: expected %d, got %d: %s", s.name, s.status, rec.Code, rec.Body.String())
+		}
+		if b, _ := h.db.GetBadge("rev1234"); b.Status != s.want {
+			t.Errorf("%s: expected status %s, got %s", s.name, s.want, b.Status)
+		}
+	}
+
+	rec := testutil.Serve(h, issuer, http.MethodGet, "/api/badges/rev1234/review", nil)
+	var history []AuditEntry
+	json.NewDecoder(rec.Body).Decode(&history)
+	var actions []string
+	for _, e := range history {
+		actions = append(actions, e.ActorID+":"+e.Action)
+	}
+	if got := strings.Join(actions, ","); got != "alice:submit,bob:reject,alice:submit,bob:approve" {
+		t.Errorf("unexpected review history %s", got)
+	}
+	if history[1].Comment != "Wrong version" || history[1].FromStatus != "pending" || history[1].ToStatus != "draft" {
+		t.Errorf("unexpected reject entry %+v", history[1])
+	}
+
+	// With approval required, badges cannot be published without review
+	h.SetRequireApproval(true)
+	if rec := testutil.Serve(h, issuer, http.MethodPost, "/api/badges", Badge{CommitID: "rev5678", Status: strPtr("valid")}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 creating a valid badge, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, issuer, http.MethodPost, "/api/badges", Badge{CommitID: "rev5678"}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating a draft, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, issuer, http.MethodPatch, "/api/badges/rev5678", Badge{Status: strPtr("valid")}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 publishing a draft, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, issuer, http.MethodPatch, "/api/badges/rev1234", Badge{Status: strPtr("revoked")}); rec.Code != http.StatusOK {
+		t.Errorf("expected published badges to stay editable, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, issuer, http.MethodPatch, "/api/badges/rev1234", Badge{Status: strPtr("Valid")}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected revocation to be final, got %d", rec.Code)
+	}
+}
+
+func TestBadgeFieldValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", map[string]string{
+		"commit_id":     "valid12345",
+		"status":        "active",
+		"issue_date":    "2026-01-31",
+		"expiry_date":   "2025-01-31",
+		"software_url":  "ftp://example.org/tool",
+		"custom_config": `{"style":"plastic"}`,
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, field := range []string{"status", "expiry_date", "software_url", "custom_config.style"} {
+		if resp.Fields[field] == "" {
+			t.Errorf("expected an error for %s, got %v", field, resp.Fields)
+		}
+	}
+	if len(resp.Fields) != 4 || resp.Error == "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", Badge{CommitID: "valid12345"}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/badges/valid12345", Badge{IssueDate: strPtr("2026-02-30")})
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "issue_date") {
+		t.Errorf("update: expected 422 for issue_date, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBadgePublishAt(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", Badge{CommitID: "sched12", PublishAt: strPtr("tomorrow")}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid publish_at, got %d", rec.Code)
+	}
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", Badge{CommitID: "sched12", PublishAt: strPtr("2030-01-02T10:00:00+01:00")})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got Badge
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.PublishAt == nil || *got.PublishAt != "2030-01-02T09:00:00Z" {
+		t.Errorf("expected publish_at normalized to UTC, got %v", got.PublishAt)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/badges/sched12", Badge{PublishAt: strPtr("")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if b, _ := h.db.GetBadge("sched12"); b.PublishAt.Valid {
+		t.Errorf("expected an empty publish_at to unschedule the badge, got %v", b.PublishAt.Time)
+	}
+}
+
+func TestBadgeCertificateType(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	now := time.Now()
+	if err := h.db.CreateCertificateType(&database.CertificateType{
+		TypeID: "verified-accessibility", Name: "Verified Accessibility",
+		SpecialtyDomain: sql.NullString{String: "ACCESSIBILITY", Valid: true}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to create certificate type: %v", err)
+	}
+	// Group grants name the certificate type, whatever the badge's Type
+	if err := h.db.CreateGroup(&database.Group{
+		GroupID: "verifiers", Name: "Verifiers", Members: []string{"member"},
+		BadgeTypes: []string{"verified-accessibility"}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+	auth.GetAPIKeyInfoFromContext(ctx).UserID = "outsider"
+	body := Badge{CommitID: "vdcert1", CertificateTypeID: strPtr("verified-accessibility")}
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-member, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	auth.GetAPIKeyInfoFromContext(ctx).UserID = "member"
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got Badge
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.CertificateName == nil || *got.CertificateName != "Verified Accessibility" || got.SpecialtyDomain == nil || *got.SpecialtyDomain != "ACCESSIBILITY" {
+		t.Errorf("expected the certificate name and domain of the type, got %v and %v", got.CertificateName, got.SpecialtyDomain)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/badges", Badge{CommitID: "vdcert2", CertificateTypeID: strPtr("unknown")}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown certificate type, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/overrides"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultImageURLExpiry is the lifetime of a signed image URL without
+	// expires_in
+	DefaultImageURLExpiry = 30 * 24 * time.Hour
+	// MaxImageURLExpiry is the longest lifetime of a signed image URL
+	MaxImageURLExpiry = 365 * 24 * time.Hour
+)
+
+// imageParams are the output parameters a signed image URL may carry besides
+// the rendering overrides
+var imageParams = map[string]bool{"format": true, "quality": true, "width": true, "height": true, "scale": true, "outlook": true}
+
+// ImageURLRequest is the body of POST /api/badges/{commit_id}/image-url
+type ImageURLRequest struct {
+	// Endpoint is badge (default) or certificate
+	Endpoint string `json:"endpoint,omitempty"`
+	// Params are the query parameters of the image, e.g. color_left
+	Params map[string]string `json:"params"`
+	// ExpiresIn is the lifetime of the URL, e.g. 720h (default and at most
+	// a year)
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// ImageURL is a signed image URL
+type ImageURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// signImageURL serves POST /api/badges/{commit_id}/image-url: an image URL
+// whose query parameters are honored although the public policy would ignore
+// them, as only users allowed to change the badge can create it
+func (h *Handler) signImageURL(w http.ResponseWriter, r *http.Request, commitID string) {
+	var req ImageURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Endpoint == "" {
+		req.Endpoint = "badge"
+	}
+	if req.Endpoint != "badge" && req.Endpoint != "certificate" {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid endpoint. Supported endpoints: badge, certificate")
+		return
+	}
+	expiresIn := DefaultImageURLExpiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 || d > MaxImageURLExpiry {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid expires_in: expected a duration up to 8760h")
+			return
+		}
+		expiresIn = d
+	}
+	q := url.Values{}
+	for name, value := range req.Params {
+		if !imageParams[name] && !contains(overrides.Names(), name) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid parameter "+name+": expected an output or rendering parameter")
+			return
+		}
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	path := "/" + req.Endpoint + "/" + commitID
+	expiresAt := time.Now().Add(expiresIn).Truncate(time.Second)
+	signed, err := overrides.Sign(path, q, expiresAt)
+	if errors.Is(err, overrides.ErrNoSigningKey) {
+		httpjson.Error(w, http.StatusServiceUnavailable, "Signed image URLs are not configured: set IMAGE_URL_SECRET")
+		return
+	}
+	if err != nil {
+		h.logger.Error("badgeapi: failed to sign image URL", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to sign image URL")
+		return
+	}
+
+	httpjson.Write(w, http.StatusOK, ImageURL{URL: links.ForRequest(r) + path + "?" + signed.Encode(), ExpiresAt: expiresAt})
+}
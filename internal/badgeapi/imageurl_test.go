@@ -0,0 +1,65 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/overrides"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestSignImageURL(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	if err := h.db.CreateBadge(&database.Badge{CommitID: "abc123", Type: "certificate", Status: "valid"}); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+	writer := testutil.APIKeyContext("", "badges", "read", "write")
+	req := ImageURLRequest{Params: map[string]string{"color_left": "#123456", "format": "png"}, ExpiresIn: "1h"}
+
+	if rec := testutil.Serve(h, writer, http.MethodPost, "/api/badges/abc123/image-url", req); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a signing key, got %d", rec.Code)
+	}
+
+	overrides.SetSigningKey([]byte("test-secret"))
+	t.Cleanup(func() { overrides.SetSigningKey(nil) })
+
+	rec := testutil.Serve(h, writer, http.MethodPost, "/api/badges/abc123/image-url", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var signed ImageURL
+	json.NewDecoder(rec.Body).Decode(&signed)
+	u, err := url.Parse(signed.URL)
+	if err != nil || u.Path != "/badge/abc123" || u.Query().Get("color_left") != "#123456" || signed.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected signed URL %+v", signed)
+	}
+	if !overrides.Signed(httptest.NewRequest("GET", u.RequestURI(), nil)) {
+		t.Error("expected the URL to verify")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"unknown parameter", "/api/badges/abc123/image-url", ImageURLRequest{Params: map[string]string{"ids": "a,b"}}, http.StatusBadRequest},
+		{"invalid endpoint", "/api/badges/abc123/image-url", ImageURLRequest{Endpoint: "details"}, http.StatusBadRequest},
+		{"lifetime too long", "/api/badges/abc123/image-url", ImageURLRequest{ExpiresIn: "10000h"}, http.StatusBadRequest},
+		{"unknown badge", "/api/badges/missing1/image-url", req, http.StatusNotFound},
+	} {
+		if got := testutil.Serve(h, writer, http.MethodPost, tc.path, tc.body).Code; got != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, got)
+		}
+	}
+	if got := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodPost, "/api/badges/abc123/image-url", req).Code; got != http.StatusForbidden {
+		t.Errorf("expected readers to be refused, got %d", got)
+	}
+}
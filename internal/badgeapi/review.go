@@ -0,0 +1,134 @@
+package badgeapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// ReviewRequest is the body of POST /api/badges/{commit_id}/review
+type ReviewRequest struct {
+	// Action is submit (draft to pending), approve (pending to valid) or
+	// reject (pending back to draft)
+	Action string `json:"action"`
+	// Comment is required when rejecting
+	Comment string `json:"comment,omitempty"`
+}
+
+// AuditEntry is the JSON representation of a review workflow transition
+type AuditEntry struct {
+	Action     string          `json:"action"`
+	FromStatus database.Status `json:"from_status"`
+	ToStatus   database.Status `json:"to_status"`
+	ActorID    string          `json:"actor_id"`
+	Comment    string          `json:"comment,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// review applies a review action to a badge. Issuers submit drafts; reviewers
+// from the group responsible for the badge type approve or reject them, but
+// never their own submission.
+func (h *Handler) review(w http.ResponseWriter, r *http.Request, commitID string) {
+	db := h.db.WithContext(r.Context())
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok {
+		return
+	}
+	next, err := database.ReviewTransition(badge.Status, req.Action)
+	if err != nil {
+		httpjson.Error(w, http.StatusConflict, err.Error())
+		return
+	}
+	if !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	actorID := auth.GetUserIDFromContext(r.Context())
+	if req.Action != "submit" {
+		submitter, err := db.LastSubmitter(commitID)
+		if err != nil {
+			h.logger.Error("badgeapi: failed to get submitter", zap.String("commit_id", commitID), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to review badge")
+			return
+		}
+		if submitter == actorID {
+			httpjson.Error(w, http.StatusForbidden, "A badge must be reviewed by someone other than its submitter")
+			return
+		}
+	}
+	if req.Action == "reject" && req.Comment == "" {
+		httpjson.Error(w, http.StatusBadRequest, "comment is required when rejecting")
+		return
+	}
+
+	entry := &database.AuditEntry{
+		CommitID:   commitID,
+		Action:     req.Action,
+		FromStatus: badge.Status,
+		ToStatus:   next,
+		ActorID:    actorID,
+		Comment:    sql.NullString{String: req.Comment, Valid: req.Comment != ""},
+		CreatedAt:  time.Now(),
+	}
+	if err := db.ReviewBadge(entry); err != nil {
+		if errors.Is(err, database.ErrStatusChanged) {
+			httpjson.Error(w, http.StatusConflict, "Badge status changed, reload and try again")
+			return
+		}
+		h.logger.Error("badgeapi: failed to review badge", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to review badge")
+		return
+	}
+	h.logger.Info("badgeapi: badge reviewed",
+		zap.String("commit_id", commitID),
+		zap.String("action", req.Action),
+		zap.String("status", string(next)),
+		zap.String("actor_id", actorID))
+
+	h.invalidate(commitID)
+	badge.Status = next
+	httpjson.Write(w, http.StatusOK, ToJSON(badge))
+}
+
+// history returns the review history of a badge
+func (h *Handler) history(w http.ResponseWriter, r *http.Request, commitID string) {
+	if _, ok := h.load(w, r, commitID); !ok {
+		return
+	}
+
+	entries, err := h.db.WithContext(r.Context()).ListAuditEntries(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to list audit entries", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get review history")
+		return
+	}
+
+	resp := make([]AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, AuditEntry{
+			Action:     e.Action,
+			FromStatus: e.FromStatus,
+			ToStatus:   e.ToStatus,
+			ActorID:    e.ActorID,
+			Comment:    e.Comment.String,
+			CreatedAt:  e.CreatedAt,
+		})
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
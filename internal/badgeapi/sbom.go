@@ -0,0 +1,136 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/finki/badges/internal/attachment"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/sbom"
+	"go.uber.org/zap"
+)
+
+// SBOM is the JSON representation of the current SBOM of a badge: the summary
+// read from the document and the attachment holding the document itself
+type SBOM struct {
+	sbom.Summary
+	AttachmentID int64     `json:"attachment_id"`
+	UploadedBy   string    `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// getSBOM returns the SBOM summary of a badge. The summary is public on the
+// details page, so unlike the document it needs no access to the badge type.
+func (h *Handler) getSBOM(w http.ResponseWriter, r *http.Request, commitID string) {
+	if _, ok := h.load(w, r, commitID); !ok {
+		return
+	}
+
+	s, err := h.db.WithContext(r.Context()).GetSBOM(commitID)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to get SBOM", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get SBOM")
+		return
+	}
+	if s == nil {
+		httpjson.Error(w, http.StatusNotFound, "Badge has no SBOM")
+		return
+	}
+
+	resp := SBOM{AttachmentID: s.AttachmentID, UploadedBy: s.UploadedBy, CreatedAt: s.CreatedAt}
+	if err := json.Unmarshal([]byte(s.Summary), &resp.Summary); err != nil {
+		h.logger.Error("badgeapi: invalid stored SBOM summary", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get SBOM")
+		return
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// uploadSBOM takes a CycloneDX or SPDX document as the request body, attaches
+// it to the badge and makes its summary the badge's current SBOM
+func (h *Handler) uploadSBOM(w http.ResponseWriter, r *http.Request, commitID string) {
+	db := h.db.WithContext(r.Context())
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, attachment.MaxSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpjson.Error(w, http.StatusRequestEntityTooLarge, "SBOM exceeds the maximum attachment size")
+			return
+		}
+		httpjson.Error(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	summary, err := sbom.Parse(content)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid SBOM: "+err.Error())
+		return
+	}
+	filename, contentType, err := attachment.Validate(summary.Filename(), content)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid SBOM: "+err.Error())
+		return
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	a := &database.Attachment{
+		CommitID:    commitID,
+		Filename:    filename,
+		ContentType: contentType,
+		UploadedBy:  auth.GetUserIDFromContext(r.Context()),
+		CreatedAt:   time.Now(),
+	}
+	if err := db.CreateAttachment(a, content); err != nil {
+		h.logger.Error("badgeapi: failed to store SBOM", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to store SBOM")
+		return
+	}
+	encoded, err := json.Marshal(summary)
+	if err == nil {
+		err = db.SetSBOM(&database.SBOM{
+			CommitID:     commitID,
+			AttachmentID: a.AttachmentID,
+			Summary:      string(encoded),
+			UploadedBy:   a.UploadedBy,
+			CreatedAt:    a.CreatedAt,
+		})
+	}
+	if err != nil {
+		h.logger.Error("badgeapi: failed to set SBOM", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to store SBOM")
+		return
+	}
+	h.logger.Info("badgeapi: SBOM uploaded",
+		zap.String("commit_id", commitID),
+		zap.String("format", summary.Format),
+		zap.Int("dependencies", summary.DependencyCount))
+
+	h.cache.Delete("details:" + commitID)
+	httpjson.Write(w, http.StatusCreated, SBOM{Summary: *summary, AttachmentID: a.AttachmentID, UploadedBy: a.UploadedBy, CreatedAt: a.CreatedAt})
+}
+
+// deleteSBOM removes the SBOM summary of a badge; the document stays attached
+func (h *Handler) deleteSBOM(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	if err := h.db.WithContext(r.Context()).DeleteSBOM(commitID); err != nil {
+		h.logger.Error("badgeapi: failed to delete SBOM", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete SBOM")
+		return
+	}
+
+	h.cache.Delete("details:" + commitID)
+	w.WriteHeader(http.StatusNoContent)
+}
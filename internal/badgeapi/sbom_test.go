@@ -0,0 +1,67 @@
+package badgeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBadgeSBOM(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+	if err := h.db.CreateBadge(&database.Badge{CommitID: "sbom1234", Type: "badge", Status: "valid"}); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+
+	post := func(ctx context.Context, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/badges/sbom1234/sbom", bytes.NewBufferString(body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/badges/sbom1234/sbom", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before upload, got %d", rec.Code)
+	}
+	if rec := post(ctx, `{"name": "not an sbom"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-SBOM document, got %d", rec.Code)
+	}
+	if rec := post(testutil.APIKeyContext("", "badges", "read"), `{"bomFormat": "CycloneDX"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without badges:write, got %d", rec.Code)
+	}
+
+	rec := post(ctx, `{"bomFormat": "CycloneDX", "specVersion": "1.5", "components": [
+		{"name": "a", "licenses": [{"license": {"id": "MIT"}}]},
+		{"name": "b", "licenses": [{"license": {"id": "MIT"}}]}
+	]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodGet, "/api/badges/sbom1234/sbom", nil)
+	var got SBOM
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Format != "CycloneDX" || got.DependencyCount != 2 || len(got.Licenses) != 1 || got.Licenses[0].Count != 2 {
+		t.Errorf("unexpected SBOM %+v", got)
+	}
+
+	// The document is kept as an attachment; deleting it drops the summary
+	attachments, _ := h.db.ListAttachments("sbom1234")
+	if len(attachments) != 1 || attachments[0].AttachmentID != got.AttachmentID || attachments[0].Filename != "sbom.cdx.json" {
+		t.Fatalf("expected the SBOM to be attached, got %+v", attachments)
+	}
+	if err := h.db.DeleteAttachment(attachments[0]); err != nil {
+		t.Fatalf("failed to delete attachment: %v", err)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/badges/sbom1234/sbom", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after deleting the document, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,111 @@
+package badgeapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/stats"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultStatsDays is the period badge statistics cover unless ?days= is given
+	DefaultStatsDays = 30
+	// MaxStatsDays is the longest period ?days= accepts
+	MaxStatsDays = 365
+	// topReferrers is how many referring sites are listed
+	topReferrers = 10
+)
+
+// Stats is the body of GET /api/badges/{commit_id}/stats
+type Stats struct {
+	CommitID string `json:"commit_id"`
+	// Days is the period the counts cover, up to today (UTC)
+	Days int `json:"days"`
+	// Requests counts the badge and certificate images served; Renders the
+	// ones that had to be generated
+	Requests     int64                     `json:"requests"`
+	Renders      int64                     `json:"renders"`
+	PerDay       []*database.BadgeStats    `json:"per_day"`
+	TopReferrers []*database.ReferrerStats `json:"top_referrers"`
+}
+
+// SetStats sets the recorder whose pending counts are written before badge
+// statistics are read
+func (h *Handler) SetStats(r *stats.Recorder) {
+	h.stats = r
+}
+
+// getStats returns how often the images of a badge were requested and from
+// which sites, so issuers can see where their certificate is embedded
+func (h *Handler) getStats(w http.ResponseWriter, r *http.Request, commitID string) {
+	days := DefaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxStatsDays {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid days: expected 1 to "+strconv.Itoa(MaxStatsDays))
+			return
+		}
+		days = n
+	}
+
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	if err := h.stats.Flush(r.Context()); err != nil {
+		h.logger.Warn("badgeapi: failed to write pending badge stats", zap.Error(err))
+	}
+
+	db := h.db.WithContext(r.Context())
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	daily, err := db.ListBadgeDailyStats(badge.CommitID, since)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to read badge stats", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to read badge statistics")
+		return
+	}
+	referrers, err := db.TopReferrers(badge.CommitID, since, topReferrers)
+	if err != nil {
+		h.logger.Error("badgeapi: failed to read referrer stats", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to read badge statistics")
+		return
+	}
+
+	resp := Stats{
+		CommitID:     badge.CommitID,
+		Days:         days,
+		PerDay:       []*database.BadgeStats{},
+		TopReferrers: []*database.ReferrerStats{},
+	}
+	for _, d := range daily {
+		resp.Requests += d.Requests
+		resp.Renders += d.Renders
+		d.CommitID = ""
+		resp.PerDay = append(resp.PerDay, d)
+	}
+	resp.TopReferrers = append(resp.TopReferrers, referrers...)
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// deleteStats removes the request and referrer counts of a badge, e.g. to
+// honour an erasure request, including those not written yet
+func (h *Handler) deleteStats(w http.ResponseWriter, r *http.Request, commitID string) {
+	badge, ok := h.load(w, r, commitID)
+	if !ok || !h.canAccessType(w, r, badge.AccessType()) {
+		return
+	}
+
+	h.stats.Forget(badge.CommitID)
+	if err := h.db.WithContext(r.Context()).DeleteBadgeStats(badge.CommitID); err != nil {
+		h.logger.Error("badgeapi: failed to delete badge stats", zap.String("commit_id", commitID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete badge statistics")
+		return
+	}
+	h.logger.Info("badgeapi: badge stats deleted", zap.String("commit_id", badge.CommitID))
+	w.WriteHeader(http.StatusNoContent)
+}
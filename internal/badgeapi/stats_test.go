@@ -0,0 +1,75 @@
+package badgeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/stats"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBadgeStats(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+
+	if err := h.db.CreateBadge(&database.Badge{CommitID: "abc123", Type: "certificate", Status: "valid"}); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+	recorder := stats.NewRecorder(h.db, h.logger)
+	h.SetStats(recorder)
+	recorder.Request("abc123", testutil.ImageRequest("https://github.com/org/repo"))
+	recorder.Request("abc123", testutil.ImageRequest("https://github.com/org/other"))
+	recorder.Request("abc123", testutil.ImageRequest(""))
+	recorder.Render("abc123")
+	recorder.Request("other123", testutil.ImageRequest("https://example.org/"))
+
+	rec := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodGet, "/api/badges/abc123/stats", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var s Stats
+	json.NewDecoder(rec.Body).Decode(&s)
+	if s.CommitID != "abc123" || s.Days != DefaultStatsDays || s.Requests != 3 || s.Renders != 1 || len(s.PerDay) != 1 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	if len(s.TopReferrers) != 1 || s.TopReferrers[0].Referrer != "https://github.com" || s.TopReferrers[0].Requests != 2 {
+		t.Errorf("expected github.com as the only referrer, got %+v", s.TopReferrers)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"invalid days", "/api/badges/abc123/stats?days=400", http.StatusBadRequest},
+		{"unknown badge", "/api/badges/missing1/stats", http.StatusNotFound},
+	} {
+		if got := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodGet, tc.path, nil).Code; got != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, got)
+		}
+	}
+	if got := testutil.Serve(h, testutil.APIKeyContext("", "badges", "write"), http.MethodGet, "/api/badges/abc123/stats", nil).Code; got != http.StatusForbidden {
+		t.Errorf("expected badges:read to be required, got %d", got)
+	}
+
+	// Purging removes the written and the pending counts
+	recorder.Request("abc123", testutil.ImageRequest("https://github.com/org/repo"))
+	if got := testutil.Serve(h, testutil.APIKeyContext("", "badges", "write"), http.MethodDelete, "/api/badges/abc123/stats", nil).Code; got != http.StatusForbidden {
+		t.Errorf("expected badges:delete to be required, got %d", got)
+	}
+	if got := testutil.Serve(h, testutil.APIKeyContext("", "badges", "delete"), http.MethodDelete, "/api/badges/abc123/stats", nil).Code; got != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", got)
+	}
+	rec = testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodGet, "/api/badges/abc123/stats", nil)
+	s = Stats{}
+	json.NewDecoder(rec.Body).Decode(&s)
+	if s.Requests != 0 || len(s.PerDay) != 0 || len(s.TopReferrers) != 0 {
+		t.Errorf("expected the stats to be purged, got %+v", s)
+	}
+	if daily, _ := h.db.ListBadgeDailyStats("other123", "2000-01-01"); len(daily) != 1 {
+		t.Errorf("expected the stats of other badges to be kept, got %+v", daily)
+	}
+}
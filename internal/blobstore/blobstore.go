@@ -0,0 +1,70 @@
+// Package blobstore provides pluggable storage for generated badge images and
+// attachments so that large blobs do not have to live inside the SQLite database.
+package blobstore
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNotFound is returned when a key does not exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// Store is implemented by every blob storage backend
+type Store interface {
+	// Get returns the content stored under key, or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Put stores content under key, replacing any existing value
+	Put(key string, content []byte, contentType string) error
+	// Delete removes key from the store; deleting a missing key is not an error
+	Delete(key string) error
+}
+
+// Config selects and configures a blob store backend
+type Config struct {
+	// Backend is one of "db" (keep blobs in SQLite), "fs" or "s3"
+	Backend string
+
+	// Filesystem backend
+	Path string
+
+	// S3 / MinIO backend
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// New creates the store described by cfg. It returns a nil Store for the
+// "db" backend, meaning images stay in the badges table.
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", "db":
+		return nil, nil
+	case "fs":
+		return NewFilesystem(cfg.Path)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, errors.New("unsupported blob store backend: " + cfg.Backend)
+	}
+}
+
+// BadgeImageKey returns the storage key for a generated badge image
+func BadgeImageKey(commitID, format string) string {
+	return "badges/" + commitID + "." + format
+}
+
+// AttachmentKey returns the storage key for an attachment of a badge
+func AttachmentKey(commitID string, attachmentID int64) string {
+	return "attachments/" + commitID + "/" + strconv.FormatInt(attachmentID, 10)
+}
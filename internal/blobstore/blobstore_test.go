@@ -0,0 +1,119 @@
+package blobstore
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFilesystemRoundTrip(t *testing.T) {
+	store, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystem failed: %v", err)
+	}
+
+	key := BadgeImageKey("abc123", "png")
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for missing key, got %v", err)
+	}
+
+	if err := store.Put(key, []byte("png data"), "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(got) != "png data" {
+		t.Errorf("expected %q, got %q", "png data", got)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("deleting a missing key should not fail, got %v", err)
+	}
+}
+
+func TestFilesystemRejectsTraversal(t *testing.T) {
+	store, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystem failed: %v", err)
+	}
+
+	if err := store.Put("../escape.png", []byte("x"), "image/png"); err == nil {
+		t.Error("expected error for key escaping the store root")
+	}
+}
+
+func TestS3PathStyleRequests(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewS3(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "badges",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3 failed: %v", err)
+	}
+
+	key := BadgeImageKey("abc123", "jpg")
+	if err := store.Put(key, []byte("jpg data"), "image/jpeg"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, ok := objects["/badges/"+key]; !ok {
+		t.Fatalf("expected object at /badges/%s, have %v", key, objects)
+	}
+
+	got, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(got) != "jpg data" {
+		t.Errorf("expected %q, got %q", "jpg data", got)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filesystem stores blobs as files below a root directory
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem creates a filesystem store rooted at dir, creating it if needed
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if dir == "" {
+		return nil, errors.New("blob store path is required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob store directory: %w", err)
+	}
+	return &Filesystem{root: dir}, nil
+}
+
+// path resolves key to a file path, rejecting keys that escape the root
+func (f *Filesystem) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+	return filepath.Join(f.root, filepath.FromSlash(clean)), nil
+}
+
+// Get reads the blob stored under key
+func (f *Filesystem) Get(key string) ([]byte, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+// Put writes the blob atomically via a temporary file and rename
+func (f *Filesystem) Put(key string, content []byte, contentType string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".blob-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the blob stored under key
+func (f *Filesystem) Delete(key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
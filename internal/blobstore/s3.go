@@ -0,0 +1,204 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible (AWS S3, MinIO) blob store
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as <endpoint>/<bucket>/<key> (required by MinIO)
+	// instead of <bucket>.<endpoint>/<key>
+	PathStyle bool
+}
+
+// S3 stores blobs in an S3-compatible bucket using SigV4-signed requests
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates an S3 store
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 endpoint and bucket are required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %q", cfg.Endpoint)
+	}
+	return &S3{
+		cfg:      cfg,
+		endpoint: u,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL builds the URL of an object for the configured addressing style
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escaped := strings.ReplaceAll(url.PathEscape(key), "%2F", "/")
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+		u.RawPath = "/" + s.cfg.Bucket + "/" + escaped
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escaped
+	}
+	return &u
+}
+
+// Get downloads an object
+func (s *S3) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S3 GET %s failed with status %d", key, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 object: %w", err)
+	}
+	return data, nil
+}
+
+// Put uploads an object
+func (s *S3) Put(key string, content []byte, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, content, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 PUT %s failed with status %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// Delete removes an object
+func (s *S3) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("S3 DELETE %s failed with status %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// do builds, signs and sends a request for key
+func (s *S3) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signedHeaders = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	signingKey = hmacSHA256(signingKey, s.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
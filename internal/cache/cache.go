@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +17,28 @@ type Item struct {
 type Cache struct {
 	items map[string]Item
 	mu    sync.RWMutex
+	// hooks are told about every deleted key or prefix
+	hooks []func(key string)
+	// hits and misses count Get calls
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	// staleFor is how long expired items are kept for GetStale
+	staleFor atomic.Int64
+}
+
+// Stats describes the use of a cache since it was created
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Items  int
+}
+
+// HitRatio returns the share of Get calls that found an item, 0 without calls
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
 
 // New creates a new cache
@@ -52,31 +76,101 @@ func (c *Cache) Get(key string) ([]byte, bool) {
 
 	item, found := c.items[key]
 	if !found {
+		c.misses.Add(1)
 		return nil, false
 	}
 
 	// Check if the item has expired
 	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
+		c.misses.Add(1)
 		return nil, false
 	}
 
+	c.hits.Add(1)
+	return item.Value, true
+}
+
+// GetStale retrieves an item whether or not it has expired, as long as it is
+// still kept (see SetStaleFor). It serves last-known-good copies while what
+// they were made from cannot be read, and is not counted in Stats.
+func (c *Cache) GetStale(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, found := c.items[key]
+	if !found {
+		return nil, false
+	}
 	return item.Value, true
 }
 
+// SetStaleFor keeps expired items for GetStale for d after they expire;
+// Delete, DeletePrefix and Clear still remove them at once. The default, 0,
+// drops them on the next cleanup.
+func (c *Cache) SetStaleFor(d time.Duration) {
+	c.staleFor.Store(int64(d))
+}
+
+// Stats returns the hits and misses of Get and the number of stored items,
+// including expired ones not yet cleaned up
+func (c *Cache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Items: len(c.items)}
+}
+
 // Delete removes an item from the cache
 func (c *Cache) Delete(key string) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	delete(c.items, key)
+	c.mu.Unlock()
+
+	c.invalidated(key)
+}
+
+// DeletePrefix removes all items whose key starts with the given prefix
+func (c *Cache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+	c.mu.Unlock()
+
+	c.invalidated(prefix)
 }
 
 // Clear removes all items from the cache
 func (c *Cache) Clear() {
+	c.mu.Lock()
+	c.items = make(map[string]Item)
+	c.mu.Unlock()
+
+	c.invalidated("")
+}
+
+// OnInvalidate registers fn to be called with the key or prefix of every
+// Delete and DeletePrefix, and with "" on Clear, whether or not anything was
+// cached under it, so that copies held elsewhere can be dropped too. fn must
+// not block.
+func (c *Cache) OnInvalidate(fn func(key string)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.items = make(map[string]Item)
+	c.hooks = append(c.hooks, fn)
+}
+
+// invalidated calls the hooks for a deleted key or prefix
+func (c *Cache) invalidated(key string) {
+	c.mu.RLock()
+	hooks := c.hooks
+	c.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(key)
+	}
 }
 
 // janitor cleans up expired items from the cache
@@ -91,7 +185,7 @@ func (c *Cache) janitor() {
 
 // deleteExpired deletes expired items from the cache
 func (c *Cache) deleteExpired() {
-	now := time.Now().UnixNano()
+	now := time.Now().UnixNano() - c.staleFor.Load()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
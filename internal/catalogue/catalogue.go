@@ -0,0 +1,229 @@
+// Package catalogue keeps badges in step with the GÉANT Software Catalogue:
+// it periodically fetches the project behind each software_sc_id, fills in
+// missing software names and URLs, corrects catalogue links and flags badges
+// whose project has disappeared.
+package catalogue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// Interval is how often the catalogue is synchronized
+const Interval = time.Hour
+
+// ErrNotFound is returned when the catalogue does not know a project
+var ErrNotFound = errors.New("project not found in the Software Catalogue")
+
+// Project is the part of a catalogue project the badges use
+type Project struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Syncer fetches Software Catalogue projects and applies them to their badges
+type Syncer struct {
+	db      *database.DB
+	logger  *zap.Logger
+	cache   *cache.Cache
+	client  *http.Client
+	baseURL string
+}
+
+// NewSyncer creates a syncer for the catalogue at baseURL, e.g.
+// https://sc.geant.org. Projects are read from <baseURL>/api/project/<id>
+// and linked as <baseURL>/ui/project/<id>.
+func NewSyncer(db *database.DB, logger *zap.Logger, cache *cache.Cache, baseURL string) *Syncer {
+	return &Syncer{
+		db:      db,
+		logger:  logger,
+		cache:   cache,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Run synchronizes every Interval until ctx is done
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProjectURL returns the catalogue page of a project
+func (s *Syncer) ProjectURL(scID string) string {
+	return s.baseURL + "/ui/project/" + url.PathEscape(scID)
+}
+
+// Fetch retrieves a project from the catalogue
+func (s *Syncer) Fetch(ctx context.Context, scID string) (*Project, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/api/project/"+url.PathEscape(scID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("catalogue returned %s", resp.Status)
+	}
+
+	var p Project
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid catalogue response: %w", err)
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	p.URL = strings.TrimSpace(p.URL)
+	if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.URL = ""
+	}
+	return &p, nil
+}
+
+// Sync fetches the project of every linked badge once and returns the commit
+// IDs of the badges it updated. Projects the catalogue cannot be reached for
+// keep their previous state.
+func (s *Syncer) Sync(ctx context.Context) []string {
+	db := s.db.WithContext(ctx)
+
+	badges, err := db.ListBadgesWithSoftwareSCID()
+	if err != nil {
+		s.logger.Error("catalogue: failed to list linked badges", zap.Error(err))
+		return nil
+	}
+
+	// Badges come ordered by software_sc_id
+	var updated []string
+	for start := 0; start < len(badges); {
+		scID := badges[start].SoftwareSCID.String
+		end := start
+		for end < len(badges) && badges[end].SoftwareSCID.String == scID {
+			end++
+		}
+		group := badges[start:end]
+		start = end
+		if ctx.Err() != nil {
+			break
+		}
+
+		project, ok := s.syncProject(ctx, scID, group)
+		if !ok {
+			continue
+		}
+		for _, b := range group {
+			if !s.apply(b, project) {
+				continue
+			}
+			if err := db.UpdateBadge(b); err != nil {
+				s.logger.Error("catalogue: failed to update badge", zap.String("commit_id", b.CommitID), zap.Error(err))
+				continue
+			}
+			s.cache.DeletePrefix("badge:" + b.CommitID + ":")
+			s.cache.DeletePrefix("certificate:" + b.CommitID + ":")
+			s.cache.Delete("details:" + b.CommitID)
+			updated = append(updated, b.CommitID)
+		}
+	}
+
+	if len(updated) > 0 {
+		s.cache.DeletePrefix("badges:list:")
+		s.cache.Delete("home:index")
+	}
+	return updated
+}
+
+// syncProject fetches a project and records the result. It returns the
+// project when it was found.
+func (s *Syncer) syncProject(ctx context.Context, scID string, badges []*database.Badge) (*Project, bool) {
+	db := s.db.WithContext(ctx)
+
+	prev, err := db.GetCatalogueProject(scID)
+	if err != nil {
+		s.logger.Error("catalogue: failed to get project", zap.String("software_sc_id", scID), zap.Error(err))
+		return nil, false
+	}
+
+	project, err := s.Fetch(ctx, scID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		s.logger.Warn("catalogue: failed to fetch project", zap.String("software_sc_id", scID), zap.Error(err))
+		return nil, false
+	}
+
+	rec := &database.CatalogueProject{SCID: scID, CheckedAt: time.Now()}
+	if project == nil {
+		// Keep what was last known about the project
+		if prev != nil {
+			rec.Name, rec.URL, rec.MissingSince = prev.Name, prev.URL, prev.MissingSince
+		}
+		if !rec.MissingSince.Valid {
+			rec.MissingSince = sql.NullTime{Time: rec.CheckedAt, Valid: true}
+			commitIDs := make([]string, 0, len(badges))
+			for _, b := range badges {
+				commitIDs = append(commitIDs, b.CommitID)
+			}
+			s.logger.Warn("catalogue: project disappeared from the Software Catalogue",
+				zap.String("software_sc_id", scID), zap.Strings("commit_ids", commitIDs))
+		}
+	} else {
+		rec.Name = sql.NullString{String: project.Name, Valid: project.Name != ""}
+		rec.URL = sql.NullString{String: project.URL, Valid: project.URL != ""}
+		if prev != nil && prev.MissingSince.Valid {
+			s.logger.Info("catalogue: project is back in the Software Catalogue", zap.String("software_sc_id", scID))
+		}
+	}
+	if err := db.SetCatalogueProject(rec); err != nil {
+		s.logger.Error("catalogue: failed to record project", zap.String("software_sc_id", scID), zap.Error(err))
+	}
+	return project, project != nil
+}
+
+// apply fills in the software name and URL a badge lacks and corrects its
+// catalogue link, reporting whether anything changed
+func (s *Syncer) apply(b *database.Badge, p *Project) bool {
+	changed := false
+	name := strings.TrimSpace(b.SoftwareName)
+	if p.Name != "" && (name == "" || name == database.PlaceholderSoftwareName) {
+		b.SoftwareName = p.Name
+		changed = true
+	}
+	if p.URL != "" && strings.TrimSpace(b.SoftwareURL.String) == "" {
+		b.SoftwareURL = sql.NullString{String: p.URL, Valid: true}
+		changed = true
+	}
+	if link := s.ProjectURL(b.SoftwareSCID.String); b.SoftwareSCURL.String != link {
+		if b.SoftwareSCURL.String != "" {
+			s.logger.Info("catalogue: corrected catalogue link",
+				zap.String("commit_id", b.CommitID), zap.String("old", b.SoftwareSCURL.String), zap.String("new", link))
+		}
+		b.SoftwareSCURL = sql.NullString{String: link, Valid: true}
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,130 @@
+package catalogue
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestSync(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "catalogue.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		mu       sync.Mutex
+		projects = map[string]string{
+			"/api/project/sc-app":  `{"name": "Catalogued App", "url": "https://app.example.org"}`,
+			"/api/project/sc-tool": `{"name": "Tool", "url": "javascript:alert(1)"}`,
+		}
+		down bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		body, ok := projects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	ns := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+	for _, b := range []*database.Badge{
+		{CommitID: "placeholder1", SoftwareName: database.PlaceholderSoftwareName, SoftwareSCID: ns("sc-app")},
+		{CommitID: "named1234", SoftwareName: "Own Name", SoftwareURL: ns("https://own.example.org"),
+			SoftwareSCID: ns("sc-app"), SoftwareSCURL: ns("https://wrong.example.org/project/sc-app")},
+		{CommitID: "tool1234", SoftwareName: "", SoftwareSCID: ns("sc-tool")},
+		{CommitID: "gone1234", SoftwareName: "Gone", SoftwareSCID: ns("sc-gone")},
+		{CommitID: "unlinked1", SoftwareName: database.PlaceholderSoftwareName},
+	} {
+		b.Type, b.Status, b.Issuer, b.IssueDate, b.SoftwareVersion = "certificate", "valid", "GÉANT", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	c := cache.New()
+	s := NewSyncer(db, logger, c, srv.URL+"/")
+	c.Set("details:named1234", []byte("stale"), time.Hour)
+	updated := s.Sync(context.Background())
+	if want := []string{"named1234", "placeholder1", "tool1234"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("expected %v to be updated, got %v", want, updated)
+	}
+	if _, ok := c.Get("details:named1234"); ok {
+		t.Error("expected the details page of an updated badge to be dropped from the cache")
+	}
+
+	for _, tc := range []struct {
+		commitID, name, url string
+	}{
+		{"placeholder1", "Catalogued App", "https://app.example.org"},
+		{"named1234", "Own Name", "https://own.example.org"},
+		{"tool1234", "Tool", ""},
+		{"gone1234", "Gone", ""},
+		{"unlinked1", database.PlaceholderSoftwareName, ""},
+	} {
+		b, _ := db.GetBadge(tc.commitID)
+		if b.SoftwareName != tc.name || b.SoftwareURL.String != tc.url {
+			t.Errorf("%s: expected %q %q, got %q %q", tc.commitID, tc.name, tc.url, b.SoftwareName, b.SoftwareURL.String)
+		}
+	}
+	if b, _ := db.GetBadge("named1234"); b.SoftwareSCURL.String != srv.URL+"/ui/project/sc-app" {
+		t.Errorf("expected the catalogue link to be corrected, got %q", b.SoftwareSCURL.String)
+	}
+
+	// The badge of the vanished project is flagged and listed by the catalogue filter
+	q, err := database.ParseBadgeQuery(url.Values{"catalogue": {"missing"}})
+	if err != nil {
+		t.Fatalf("ParseBadgeQuery: %v", err)
+	}
+	q.IncludeDrafts = true
+	flagged, _, err := db.SearchBadges(q)
+	if err != nil || len(flagged) != 1 || flagged[0].CommitID != "gone1234" {
+		t.Fatalf("expected only gone1234 to be flagged, got %v (err %v)", flagged, err)
+	}
+	gone, _ := db.GetCatalogueProject("sc-gone")
+	missingSince := gone.MissingSince
+
+	// An unreachable catalogue changes nothing; a second sync is a no-op
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	if updated := s.Sync(context.Background()); len(updated) != 0 {
+		t.Errorf("expected no updates while the catalogue is down, got %v", updated)
+	}
+	if gone, _ := db.GetCatalogueProject("sc-gone"); gone.MissingSince != missingSince {
+		t.Errorf("expected the missing flag to be kept, got %+v", gone)
+	}
+	mu.Lock()
+	down = false
+	projects["/api/project/sc-gone"] = `{"name": "Back"}`
+	mu.Unlock()
+	if updated := s.Sync(context.Background()); !reflect.DeepEqual(updated, []string{"gone1234"}) {
+		t.Errorf("expected only the returning project's link to be filled, got %v", updated)
+	}
+	if flagged, _, _ := db.SearchBadges(q); len(flagged) != 0 {
+		t.Errorf("expected the flag to be cleared, got %v", flagged)
+	}
+}
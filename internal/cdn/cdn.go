@@ -0,0 +1,248 @@
+// Package cdn purges the pages and images of changed badges from a CDN in
+// front of the service. The purger hooks into the local cache, so every
+// change that drops a badge's cached renders also purges its public URLs.
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported purge APIs
+const (
+	// ProviderCloudflare posts {"files": [...]} to a zone's purge_cache endpoint
+	ProviderCloudflare = "cloudflare"
+	// ProviderFastly posts to <endpoint>/<host><path> once per URL
+	ProviderFastly = "fastly"
+)
+
+// DefaultFastlyEndpoint is the Fastly URL purge API
+const DefaultFastlyEndpoint = "https://api.fastly.com/purge"
+
+// BatchDelay is how long URLs are collected before they are purged together,
+// so that one badge change costs one purge call
+const BatchDelay = time.Second
+
+// queueSize bounds the URLs waiting to be purged; more are dropped
+const queueSize = 1024
+
+// imageFormats are the format query variants purged with an image URL, as
+// embeds usually pick one of them
+var imageFormats = []string{"png", "jpg", "webp", "avif"}
+
+// Purger purges the public URLs of invalidated cache entries
+type Purger struct {
+	logger   *zap.Logger
+	client   *http.Client
+	provider string
+	endpoint string
+	token    atomic.Value // string
+	baseURL  string
+	queue    chan string
+}
+
+// NewPurger creates a purger calling the purge API of provider at endpoint
+// with token for the URLs of the service at baseURL. endpoint may be empty
+// for Fastly.
+func NewPurger(logger *zap.Logger, provider, endpoint, token, baseURL string) (*Purger, error) {
+	switch provider {
+	case ProviderCloudflare:
+	case ProviderFastly:
+		if endpoint == "" {
+			endpoint = DefaultFastlyEndpoint
+		}
+	default:
+		return nil, fmt.Errorf("unsupported CDN provider %q: expected %s or %s", provider, ProviderCloudflare, ProviderFastly)
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid CDN purge endpoint %q", endpoint)
+	}
+	if u, err := url.Parse(baseURL); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+
+	p := &Purger{
+		logger:   logger,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		provider: provider,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		queue:    make(chan string, queueSize),
+	}
+	p.SetToken(token)
+	return p, nil
+}
+
+// SetToken replaces the API token, e.g. when a mounted secret rotates
+func (p *Purger) SetToken(token string) {
+	p.token.Store(token)
+}
+
+// Paths returns the public paths, with their image format variants, showing
+// what a cache key or prefix holds, or nil for keys not tied to one badge
+func Paths(key string) []string {
+	kind, rest, _ := strings.Cut(key, ":")
+	id := strings.TrimSuffix(rest, ":")
+	if id == "" || strings.Contains(id, ":") {
+		return nil
+	}
+
+	switch kind {
+	case "badge", "certificate":
+		path := "/" + kind + "/" + url.PathEscape(id)
+		paths := []string{path}
+		for _, format := range imageFormats {
+			paths = append(paths, path+"?format="+format)
+		}
+		return paths
+	case "details":
+		return []string{"/details/" + url.PathEscape(id)}
+	}
+	return nil
+}
+
+// Invalidated queues the URLs of a deleted cache key or prefix for purging.
+// It is meant for cache.OnInvalidate and never blocks.
+func (p *Purger) Invalidated(key string) {
+	for _, path := range Paths(key) {
+		select {
+		case p.queue <- p.baseURL + path:
+		default:
+			p.logger.Warn("cdn: purge queue full, dropping URL", zap.String("url", p.baseURL+path))
+		}
+	}
+}
+
+// Run purges queued URLs in batches until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	for {
+		var first string
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-p.queue:
+		}
+
+		// Collect the URLs of the same change
+		urls := []string{first}
+		seen := map[string]bool{first: true}
+		timer := time.NewTimer(BatchDelay)
+	collect:
+		for {
+			select {
+			case u := <-p.queue:
+				if !seen[u] {
+					seen[u] = true
+					urls = append(urls, u)
+				}
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				timer.Stop()
+				// The batch is left for Flush
+				p.requeue(urls)
+				return
+			}
+		}
+
+		if err := p.Purge(ctx, urls); err != nil {
+			p.logger.Error("cdn: failed to purge URLs", zap.Error(err), zap.Strings("urls", urls))
+			continue
+		}
+		p.logger.Debug("cdn: purged URLs", zap.Strings("urls", urls))
+	}
+}
+
+// requeue puts urls back in the queue, dropping those it has no room for
+func (p *Purger) requeue(urls []string) {
+	for _, u := range urls {
+		select {
+		case p.queue <- u:
+		default:
+			p.logger.Warn("cdn: purge queue full, dropping URL", zap.String("url", u))
+		}
+	}
+}
+
+// Flush purges the queued URLs at once, e.g. when the server shuts down
+// after Run has stopped, so that changes made before are not left cached
+func (p *Purger) Flush(ctx context.Context) error {
+	var urls []string
+	seen := map[string]bool{}
+	for {
+		select {
+		case u := <-p.queue:
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	if err := p.Purge(ctx, urls); err != nil {
+		return fmt.Errorf("failed to purge %d URLs: %w", len(urls), err)
+	}
+	p.logger.Debug("cdn: purged URLs", zap.Strings("urls", urls))
+	return nil
+}
+
+// Purge purges urls from the CDN
+func (p *Purger) Purge(ctx context.Context, urls []string) error {
+	if p.provider == ProviderCloudflare {
+		body, err := json.Marshal(map[string][]string{"files": urls})
+		if err != nil {
+			return err
+		}
+		return p.call(ctx, p.endpoint, body)
+	}
+
+	for _, u := range urls {
+		target := p.endpoint + "/" + strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		if err := p.call(ctx, target, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call posts a purge request and checks that it succeeded
+func (p *Purger) call(ctx context.Context, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	token := p.token.Load().(string)
+	if p.provider == ProviderCloudflare {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("Fastly-Key", token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("CDN purge API returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"go.uber.org/zap"
+)
+
+func TestPaths(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"badge:abc123:", []string{"/badge/abc123", "/badge/abc123?format=png", "/badge/abc123?format=jpg",
+			"/badge/abc123?format=webp", "/badge/abc123?format=avif"}},
+		{"details:abc123", []string{"/details/abc123"}},
+		{"badge:", nil},
+		{"badges:list:", nil},
+		{"home:index", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Paths(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Paths(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if got := Paths("certificate:abc123:"); len(got) != 5 || got[0] != "/certificate/abc123" {
+		t.Errorf("expected the certificate URLs, got %v", got)
+	}
+}
+
+func TestNewPurger(t *testing.T) {
+	for _, tc := range []struct{ provider, endpoint, baseURL string }{
+		{"akamai", "https://api.example.org", "https://badges.example.org"},
+		{ProviderCloudflare, "", "https://badges.example.org"},
+		{ProviderCloudflare, "ftp://api.example.org", "https://badges.example.org"},
+		{ProviderFastly, "", "badges"},
+	} {
+		if _, err := NewPurger(zap.NewNop(), tc.provider, tc.endpoint, "token", tc.baseURL); err == nil {
+			t.Errorf("%+v: expected an error", tc)
+		}
+	}
+	p, err := NewPurger(zap.NewNop(), ProviderFastly, "", "token", "https://badges.example.org/")
+	if err != nil || p.endpoint != DefaultFastlyEndpoint || p.baseURL != "https://badges.example.org" {
+		t.Errorf("expected the default Fastly endpoint, got %+v (err %v)", p, err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Header.Get("Authorization") == "Bearer secret":
+			var body struct {
+				Files []string `json:"files"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			requests = append(requests, r.URL.Path+" "+body.Files[0])
+		case r.Header.Get("Fastly-Key") == "secret":
+			requests = append(requests, r.URL.Path)
+		default:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	cloudflare, _ := NewPurger(zap.NewNop(), ProviderCloudflare, srv.URL+"/zones/z1/purge_cache", "secret", "https://badges.example.org")
+	fastly, _ := NewPurger(zap.NewNop(), ProviderFastly, srv.URL+"/purge", "secret", "https://badges.example.org")
+	urls := []string{"https://badges.example.org/details/abc123"}
+	if err := cloudflare.Purge(ctx, urls); err != nil {
+		t.Fatalf("Cloudflare purge: %v", err)
+	}
+	if err := fastly.Purge(ctx, urls); err != nil {
+		t.Fatalf("Fastly purge: %v", err)
+	}
+	want := []string{"/zones/z1/purge_cache https://badges.example.org/details/abc123", "/purge/badges.example.org/details/abc123"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("expected %v, got %v", want, requests)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if err := fastly.Purge(ctx, urls); err == nil {
+		t.Error("expected a rejected purge to fail")
+	}
+}
+
+func TestRunBatchesCacheInvalidations(t *testing.T) {
+	batches := make(chan []string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Files []string `json:"files"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		batches <- body.Files
+	}))
+	defer srv.Close()
+
+	p, err := NewPurger(zap.NewNop(), ProviderCloudflare, srv.URL, "secret", "https://badges.example.org")
+	if err != nil {
+		t.Fatalf("NewPurger: %v", err)
+	}
+	c := cache.New()
+	c.OnInvalidate(p.Invalidated)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	// A badge change drops its renders and details page, and the list pages
+	c.DeletePrefix("badge:abc123:")
+	c.Delete("details:abc123")
+	c.Delete("details:abc123")
+	c.DeletePrefix("badges:list:")
+
+	select {
+	case files := <-batches:
+		if len(files) != 6 || files[0] != "https://badges.example.org/badge/abc123" || files[5] != "https://badges.example.org/details/abc123" {
+			t.Errorf("expected one batch with the badge and details URLs, got %v", files)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a purge")
+	}
+	select {
+	case files := <-batches:
+		t.Errorf("expected a single batch, also got %v", files)
+	case <-time.After(BatchDelay + 200*time.Millisecond):
+	}
+}
+
+func TestFlush(t *testing.T) {
+	batches := make(chan []string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Files []string `json:"files"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		batches <- body.Files
+	}))
+	defer srv.Close()
+
+	p, err := NewPurger(zap.NewNop(), ProviderCloudflare, srv.URL, "secret", "https://badges.example.org")
+	if err != nil {
+		t.Fatalf("NewPurger: %v", err)
+	}
+	if err := p.Flush(context.Background()); err != nil || len(batches) != 0 {
+		t.Errorf("expected nothing to purge, got %d batches (err %v)", len(batches), err)
+	}
+
+	// URLs queued when Run stops are purged by Flush
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(stopped)
+	}()
+	p.Invalidated("details:abc123")
+	p.Invalidated("details:def456")
+	p.Invalidated("details:abc123")
+	cancel()
+	<-stopped
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	select {
+	case files := <-batches:
+		sort.Strings(files)
+		if len(files) != 2 || files[0] != "https://badges.example.org/details/abc123" || files[1] != "https://badges.example.org/details/def456" {
+			t.Errorf("expected the queued URLs once each, got %v", files)
+		}
+	default:
+		t.Fatal("expected a purge")
+	}
+}
@@ -0,0 +1,49 @@
+package certificate
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// FuzzGenerateSVG renders certificates with arbitrary names, versions and
+// custom configs: they may be rejected, but must not panic or inject markup
+func FuzzGenerateSVG(f *testing.F) {
+	f.Add("eduGAIN Reporting ecosystem", "v1.0.0", "valid", `{"background_color":"#0e3f5f"}`)
+	f.Add(`"><script>alert(1)</script>`, "&amp;", "expired", `{"cert_name_color":"#fff;}</style><script>x</script>"}`)
+	f.Add("Σύστημα Διαχείρισης Ταυτοτήτων Ταυτοτήτων", "v\x00", "revoked", `{"top_label":"‮\ud800"}`)
+	f.Add(strings.Repeat("W", 300), "", "", `[]`)
+
+	f.Fuzz(func(t *testing.T, name, version, status, config string) {
+		b := &database.Badge{
+			CommitID: "abc123", Type: "certificate", Status: database.Status(status), Issuer: "Test Issuer",
+			IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: name, SoftwareVersion: version,
+			CertificateName: sql.NullString{String: name, Valid: name != ""},
+			CustomConfig:    sql.NullString{String: config, Valid: true},
+		}
+		svg, err := NewGenerator().GenerateSVG(b)
+		if err != nil {
+			return
+		}
+
+		dec := xml.NewDecoder(bytes.NewReader(svg))
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("expected well-formed SVG, got %v in %s", err, svg)
+			}
+			if s, ok := tok.(xml.StartElement); ok && (s.Name.Local == "script" || s.Name.Local == "foreignObject") {
+				t.Fatalf("unexpected <%s> element in %s", s.Name.Local, svg)
+			}
+		}
+	})
+}
@@ -3,10 +3,17 @@ package certificate
 import (
 	"bytes"
 	"fmt"
-	"html/template"
+	"math"
 	"os"
+	"strings"
+	"text/template"
 
+	"github.com/finki/badges/internal/assets"
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/svgsafe"
+	"github.com/finki/badges/internal/svgtmpl"
+	"github.com/finki/badges/internal/textlayout"
+	"github.com/finki/badges/internal/theme"
 )
 
 // Generator is responsible for generating certificate SVGs
@@ -30,12 +37,36 @@ type Generator struct {
 	defaultBorderColor         string
 	defaultCertNameColor       string
 
-	// Template file path
+	// Theme values without a per-badge override
+	fontFamily       string
+	slogan           string
+	logo             *theme.Logo
+	certNameMaxLines int
+
+	// Template file path; the built-in template when empty
 	templatePath string
+
+	// Stored templates, preferred over templatePath when set
+	templates TemplateSource
+
+	// Per-badge logos, resolved when set
+	logos LogoSource
+}
+
+// TemplateSource supplies stored certificate templates, e.g. *database.DB
+type TemplateSource interface {
+	GetDefaultTemplate(badgeType string) (*database.Template, error)
 }
 
-// NewGenerator creates a new certificate generator
+// LogoSource resolves the logo reference of a badge's custom config, e.g.
+// *logo.Resolver
+type LogoSource interface {
+	Resolve(ref string) (*theme.Logo, error)
+}
+
+// NewGenerator creates a new certificate generator using the active theme
 func NewGenerator() *Generator {
+	t := theme.Get()
 	return &Generator{
 		// Default values for old template
 		defaultColorBorder: "#ed1556", // GÉANT Red
@@ -47,22 +78,140 @@ func NewGenerator() *Generator {
 		defaultHeight:      200,
 
 		// Default values for big certificate template
-		defaultLogoColor:           "#ffffff", // White
-		defaultBackgroundColor:     "#0e3f5f", // Dark blue
-		defaultHorizontalBarsColor: "#e78a2d", // Orange
-		defaultTopLabelColor:       "#e78a2d", // Orange
-		defaultGradientStartColor:  "#ff1463", // Pink
-		defaultGradientEndColor:    "#013a40", // Dark teal
-		defaultBorderColor:         "#e78a2d", // Orange
-		defaultCertNameColor:       "#ffffff", // White
-
-		// Template file path
-		templatePath: "templates/svg/big-template.svg",
+		defaultLogoColor:           t.Certificate.LogoColor,
+		defaultBackgroundColor:     t.Certificate.BackgroundColor,
+		defaultHorizontalBarsColor: t.Certificate.HorizontalBarsColor,
+		defaultTopLabelColor:       t.Certificate.TopLabelColor,
+		defaultGradientStartColor:  t.Certificate.GradientStartColor,
+		defaultGradientEndColor:    t.Certificate.GradientEndColor,
+		defaultBorderColor:         t.Certificate.BorderColor,
+		defaultCertNameColor:       t.Certificate.CertNameColor,
+
+		fontFamily:       t.Certificate.FontFamily,
+		slogan:           t.Slogan,
+		logo:             t.Logo,
+		certNameMaxLines: t.Certificate.NameMaxLines,
+
 	}
 }
 
-// GenerateSVG generates an SVG certificate
+// SetTemplatePath makes the generator read the big certificate template from
+// a file instead of the built-in templates/svg/big-template.svg
+func (g *Generator) SetTemplatePath(path string) {
+	g.templatePath = path
+}
+
+// SetTemplateSource makes the generator prefer the default stored template for
+// a badge's type over the template file
+func (g *Generator) SetTemplateSource(src TemplateSource) {
+	g.templates = src
+}
+
+// SetLogoSource makes the generator render the logo set in a badge's custom
+// config in place of the theme logo
+func (g *Generator) SetLogoSource(src LogoSource) {
+	g.logos = src
+}
+
+// GenerateSVG generates an SVG certificate. The output of stored templates is
+// sanitized, as they are uploaded by users; template files are set up by the
+// operator.
 func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
+	templateContent, custom, err := g.templateContent(badge)
+	if err != nil {
+		return nil, err
+	}
+	limit := 0
+	if custom {
+		limit = maxRenderSize
+	}
+	svg, err := g.generate(badge, templateContent, true, limit)
+	if err != nil || !custom {
+		return svg, err
+	}
+	return sanitize(svg)
+}
+
+// GenerateSVGWithTemplate generates an SVG certificate from the given template.
+// Unlike GenerateSVG it never falls back to the built-in template, so it is
+// used to validate and preview uploaded templates.
+func (g *Generator) GenerateSVGWithTemplate(badge *database.Badge, templateContent []byte) ([]byte, error) {
+	svg, err := g.generate(badge, stripXMLDeclaration(templateContent), false, maxRenderSize)
+	if err != nil {
+		return nil, err
+	}
+	return sanitize(svg)
+}
+
+// sanitize removes active content from the output of a user-supplied template
+func sanitize(svg []byte) ([]byte, error) {
+	out, err := svgsafe.Sanitize(svg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sanitize certificate: %w", err)
+	}
+	return out, nil
+}
+
+// templateContent returns the default stored template for the badge's
+// certificate type, then for its badge type, or the template file when
+// neither is set, and whether it is a stored template
+func (g *Generator) templateContent(badge *database.Badge) ([]byte, bool, error) {
+	if g.templates != nil {
+		types := []string{badge.Type}
+		if badge.AccessType() != badge.Type {
+			types = []string{badge.AccessType(), badge.Type}
+		}
+		for _, badgeType := range types {
+			t, err := g.templates.GetDefaultTemplate(badgeType)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to get default template: %w", err)
+			}
+			if t != nil {
+				return stripXMLDeclaration([]byte(t.Content)), true, nil
+			}
+		}
+	}
+
+	// Read the template file
+	var templateContent []byte
+	var err error
+	if g.templatePath != "" {
+		templateContent, err = os.ReadFile(g.templatePath)
+	} else {
+		templateContent, err = assets.ReadTemplate("svg/big-template.svg")
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read template file: %w", err)
+	}
+	return stripXMLDeclaration(templateContent), false, nil
+}
+
+// resolveLogo returns the badge's own logo, falling back to the theme logo
+// when none is set or it cannot be loaded
+func (g *Generator) resolveLogo(ref string) *theme.Logo {
+	if ref == "" || g.logos == nil {
+		return g.logo
+	}
+	if logo, err := g.logos.Resolve(ref); err == nil {
+		return logo
+	}
+	return g.logo
+}
+
+// stripXMLDeclaration removes the XML declaration from template content
+func stripXMLDeclaration(templateContent []byte) []byte {
+	if bytes.HasPrefix(templateContent, []byte("<?xml")) {
+		if xmlEndIndex := bytes.Index(templateContent, []byte("?>")); xmlEndIndex != -1 {
+			return templateContent[xmlEndIndex+2:]
+		}
+	}
+	return templateContent
+}
+
+// generate renders the certificate. With fallback set, a template that fails to
+// parse is replaced by the built-in one; without it, unknown fields are errors.
+// A limit other than 0 stops the execution once the output grows past it.
+func (g *Generator) generate(badge *database.Badge, templateContent []byte, fallback bool, limit int) ([]byte, error) {
 	// Get custom configuration
 	config, err := badge.GetCustomConfig()
 	if err != nil {
@@ -147,10 +296,16 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 		certificateName = badge.CertificateName.String
 	}
 
-	// Split certificate name into words for multi-line display
-	certNameWords := []string{}
-	if certificateName != "" {
-		certNameWords = splitCertificateName(certificateName)
+	// Wrap the certificate name to fit the name block. CertNameWords keeps
+	// the lines for templates that still address them with getWord 0-2.
+	certNameLines, certNameFontSize := layoutCertificateName(certificateName, g.certNameMaxLines)
+	certNameWords := []string{"", "", ""}
+	for i, l := range certNameLines {
+		if i < len(certNameWords) {
+			certNameWords[i] = l.Text
+		} else {
+			certNameWords = append(certNameWords, l.Text)
+		}
 	}
 
 	// Get specialty domain (optional)
@@ -159,20 +314,6 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 		specialtyDomain = badge.SpecialtyDomain.String
 	}
 
-	// Read the template file
-	templateContent, err := os.ReadFile(g.templatePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read template file: %w", err)
-	}
-
-	// Remove XML declaration from the template content
-	templateContentStr := string(templateContent)
-	if len(templateContentStr) > 5 && templateContentStr[:5] == "<?xml" {
-		if xmlEndIndex := bytes.Index(templateContent, []byte("?>")); xmlEndIndex != -1 {
-			templateContent = templateContent[xmlEndIndex+2:]
-		}
-	}
-
 	// Prepare data for the template
 	// Prepare software name split for potential two-line display in big template
 	softwareNameLines := splitSoftwareNameLines(badge.SoftwareName, 16, 3)
@@ -191,11 +332,15 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 	// For 3-line base font is 14px where ~16 chars fit.
 	softwareNameFontSize := calcSoftwareNameFontSize(softwareNameLines, softwareNameLine3 != "")
 
- // Calculate status flags/label for overlay rendering
+ // Calculate status flags/label for the greyed-out overlay rendering;
+ // status_preview renders another status to preview the treatments
  status := badge.Status
- isRevoked := status == "revoked"
- // Treat either explicit status or computed expiry as expired
- isExpired := status == "expired" || badge.IsExpired()
+ displayStatus := badge.DisplayStatus()
+ if config.StatusPreview != "" {
+     displayStatus = database.Status(config.StatusPreview)
+ }
+ isRevoked := displayStatus == "revoked"
+ isExpired := displayStatus == "expired"
  statusLabel := ""
  if isRevoked {
      statusLabel = "REVOKED"
@@ -214,18 +359,23 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
 		"SoftwareName":      badge.SoftwareName,
 		"SoftwareVersion":   badge.SoftwareVersion,
 		"Issuer":            badge.Issuer,
-		"IssueDate":         badge.IssueDate,
+		"IssueDate":         database.FormatDate(badge.IssueDate),
 		"CommitID":          badge.CommitID,
 		"HasShadow":         style == "3d",
 		"Width":             width,
 		"Height":            height,
 		"CertificateName":   certificateName,
 		"CertNameWords":     certNameWords,
+		"CertNameLines":     certNameLines,
+		"CertNameFontSize":  certNameFontSize,
 		"SpecialtyDomain":   specialtyDomain,
 		"SoftwareNameLine1": softwareNameLine1,
 		"SoftwareNameLine2": softwareNameLine2,
 		"SoftwareNameLine3":    softwareNameLine3,
 		"SoftwareNameFontSize": softwareNameFontSize,
+		// Base direction of the names, so RTL names get direction="rtl"
+		"SoftwareNameRTL":     textlayout.IsRTL(badge.SoftwareName),
+		"CertificateNameRTL":  textlayout.IsRTL(certificateName),
 
 		// New color parameters for big certificate template
 		"LogoColor":           logoColor,
@@ -241,93 +391,205 @@ func (g *Generator) GenerateSVG(badge *database.Badge) ([]byte, error) {
         "IsExpired":           isExpired,
         "IsRevoked":           isRevoked,
         "StatusLabel":         statusLabel,
+        // Theme
+        "FontFamily":          g.fontFamily,
+        "Slogan":              g.slogan,
+        "Logo":                g.resolveLogo(config.LogoURL),
     }
 
-	// Generate SVG using template
-	tmpl := template.New("certificate").Funcs(template.FuncMap{
-		"divide": func(a, b int) int {
-			return a / b
-		},
-		"subtract": func(a, b int) int {
-			return a - b
-		},
-		"getWord": func(i int, a []string) string {
-			if i < len(a) {
-				return a[i]
-			}
-			return ""
-		},
-	})
-
-	// Parse the template from the file content
-	tmpl, err = tmpl.Parse(string(templateContent))
+	// Parse the template from the file content; uploaded templates must not
+	// reference fields that do not exist
+	tmpl := newTemplate()
+	if !fallback {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err = tmpl.Parse(svgtmpl.StripComments(string(templateContent)))
 	if err != nil {
+		if !fallback {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
 		// Fallback to the hardcoded template if the file can't be parsed
-		tmpl, err = tmpl.Parse(certificateSVGTemplate)
+		tmpl, err = newTemplate().Parse(svgtmpl.StripComments(certificateSVGTemplate))
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse template: %w", err)
 		}
 	}
 
-    var buf bytes.Buffer
-    if err := tmpl.Execute(&buf, data); err != nil {
+    buf := &limitedBuffer{limit: limit}
+    if err := tmpl.Execute(buf, svgtmpl.Escape(data)); err != nil {
         return nil, fmt.Errorf("failed to execute template: %w", err)
     }
 
-    // Post-process: if template file doesn't include overlay logic, ensure overlay is added.
+    // Post-process: expired and revoked certificates are greyed out and get
+    // the overlay, whatever the template draws
     if isExpired || isRevoked {
-        svg := buf.Bytes()
-        closing := []byte("</svg>")
-        idx := bytes.LastIndex(svg, closing)
-        if idx > -1 {
-            // Inject overlay group before closing tag
-            overlay := []byte(`
-  <g id="status-overlay-auto">
-    <rect x="0" y="0" width="` + fmt.Sprintf("%d", width) + `" height="` + fmt.Sprintf("%d", height) + `" fill="#FFFFFF" opacity="0.5"/>
-    <text x="` + fmt.Sprintf("%d", width/2) + `" y="` + fmt.Sprintf("%d", height/2) + `" text-anchor="middle" font-family="Arial, Helvetica, sans-serif" font-size="28" font-weight="900" fill="#666666" transform="rotate(-18 ` + fmt.Sprintf("%d", width/2) + ` ` + fmt.Sprintf("%d", height/2) + `)">` + statusLabel + `</text>
-  </g>
-`)
-            svg = append(svg[:idx], append(overlay, svg[idx:]...)...)
-        }
-        return svg, nil
+        return applyStatusTreatment(buf.Bytes(), statusLabel, width, height), nil
     }
 
     return buf.Bytes(), nil
 }
 
-// splitCertificateName splits a certificate name into words for multi-line display
-func splitCertificateName(name string) []string {
-	// For simplicity, we'll just split by space and return up to 3 words
-	// In a real implementation, you might want to use a more sophisticated algorithm
-	words := []string{"", "", ""}
-
-	// Split the name by space
-	parts := []string{}
-	currentPart := ""
-	for _, char := range name {
-		if char == ' ' {
-			if currentPart != "" {
-				parts = append(parts, currentPart)
-				currentPart = ""
+// grayscaleFilter desaturates the content of expired and revoked certificates
+const grayscaleFilter = `<defs><filter id="status-grayscale"><feColorMatrix type="saturate" values="0"/></filter></defs><g filter="url(#status-grayscale)">`
+
+// applyStatusTreatment wraps the content of the root svg element in a
+// grayscale group and adds the status overlay unless the template drew one
+func applyStatusTreatment(svg []byte, statusLabel string, width, height int) []byte {
+	start := bytes.Index(svg, []byte("<svg"))
+	end := bytes.LastIndex(svg, []byte("</svg>"))
+	if start == -1 || end == -1 {
+		return svg
+	}
+	open := bytes.IndexByte(svg[start:], '>')
+	if open == -1 || start+open >= end {
+		return svg
+	}
+	open += start + 1
+
+	closing := "</g>\n"
+	if !bytes.Contains(svg, []byte(`id="status-overlay"`)) {
+		closing += fmt.Sprintf(`  <g id="status-overlay-auto">
+    <rect x="0" y="0" width="%d" height="%d" fill="#FFFFFF" opacity="0.5"/>
+    <text x="%d" y="%d" text-anchor="middle" font-family="Arial, Helvetica, sans-serif" font-size="28" font-weight="900" fill="#666666" transform="rotate(-18 %d %d)">%s</text>
+  </g>
+`, width, height, width/2, height/2, width/2, height/2, statusLabel)
+	}
+
+	out := make([]byte, 0, len(svg)+len(grayscaleFilter)+len(closing))
+	out = append(out, svg[:open]...)
+	out = append(out, grayscaleFilter...)
+	out = append(out, svg[open:end]...)
+	out = append(out, closing...)
+	return append(out, svg[end:]...)
+}
+
+// newTemplate creates an empty certificate template with its helper
+// functions; the data it is executed with goes through svgtmpl.Escape
+func newTemplate() *template.Template {
+	return svgtmpl.New("certificate", template.FuncMap{
+		"divide": func(a, b int) int {
+			return a / b
+		},
+		"subtract": func(a, b int) int {
+			return a - b
+		},
+		"getWord": func(i int, a []svgtmpl.Text) svgtmpl.Text {
+			if i < len(a) {
+				return a[i]
 			}
-		} else {
-			currentPart += string(char)
+			return ""
+		},
+	})
+}
+
+// Certificate name block of the big template: the top-left label above the
+// first horizontal bar, originally three 14px lines starting at x=20
+const (
+	certNameMaxWidth   = 118.0 // px before the cut top-right corner
+	certNameBaseSize   = 14
+	certNameMinSize    = 8
+	certNameLineHeight = 14.53 // at the base size
+	certNameLastLine   = 61.0  // baseline of the third line at the base size
+)
+
+// CertNameLine is one line of the wrapped certificate name with its baseline
+type CertNameLine struct {
+	Text string
+	Y    float64
+}
+
+// layoutCertificateName wraps the certificate name into at most maxLines
+// lines that fit the name block, reducing the font size until they do. The
+// block keeps the height of three base-size lines, so more lines also mean a
+// smaller font. Names that do not fit even at the minimum size are cut with
+// an ellipsis.
+func layoutCertificateName(name string, maxLines int) ([]CertNameLine, int) {
+	if maxLines < 1 {
+		maxLines = 1
+	}
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return nil, certNameBaseSize
+	}
+
+	size := certNameBaseSize
+	var lines []string
+	for ; size >= certNameMinSize; size-- {
+		lines = wrapWords(words, float64(size))
+		if len(lines) <= maxLines && len(lines)*size <= 3*certNameBaseSize && fitsWidth(lines, float64(size)) {
+			break
+		}
+	}
+	if size < certNameMinSize {
+		size = certNameMinSize
+		lines = wrapWords(words, float64(size))
+		if len(lines)*size > 3*certNameBaseSize {
+			maxLines = min(maxLines, 3*certNameBaseSize/size)
+		}
+		if len(lines) > maxLines {
+			lines = append(lines[:maxLines-1], strings.Join(lines[maxLines-1:], " "))
 		}
+		for i, l := range lines {
+			lines[i] = truncateText(l, float64(size))
+		}
+	}
+
+	// Keep the block top where it was and scale the line height with the font
+	lineHeight := certNameLineHeight * float64(size) / certNameBaseSize
+	firstBaseline := certNameLastLine - 3*certNameLineHeight + lineHeight
+	layout := make([]CertNameLine, len(lines))
+	for i, l := range lines {
+		layout[i] = CertNameLine{Text: l, Y: math.Round((firstBaseline+float64(i)*lineHeight)*100) / 100}
 	}
-	if currentPart != "" {
-		parts = append(parts, currentPart)
+	return layout, size
+}
+
+// wrapWords greedily fills lines up to certNameMaxWidth at the given size. A
+// word wider than a line gets a line of its own.
+func wrapWords(words []string, size float64) []string {
+	var lines []string
+	line := ""
+	for _, w := range words {
+		if line != "" && textlayout.Width(line+" "+w, size, true) <= certNameMaxWidth {
+			line += " " + w
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = w
 	}
+	return append(lines, line)
+}
 
-	// Assign parts to words (up to 3)
-	for i := 0; i < len(parts) && i < 3; i++ {
-		words[i] = parts[i]
+// fitsWidth reports whether every line fits certNameMaxWidth at the given size
+func fitsWidth(lines []string, size float64) bool {
+	for _, l := range lines {
+		if textlayout.Width(l, size, true) > certNameMaxWidth {
+			return false
+		}
 	}
+	return true
+}
 
-	return words
+// truncateText shortens s with an ellipsis until it fits certNameMaxWidth
+func truncateText(s string, size float64) string {
+	if textlayout.Width(s, size, true) <= certNameMaxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if t := strings.TrimSpace(string(runes)) + "…"; textlayout.Width(t, size, true) <= certNameMaxWidth {
+			return t
+		}
+	}
+	return "…"
 }
 
 // splitSoftwareNameLines splits the software name into up to maxLines lines,
-// each at most maxPerLine characters, breaking at word boundaries.
+// each at most maxPerLine characters (counted by textlayout.Columns, so
+// non-Latin names wrap by their width), breaking at word boundaries.
 func splitSoftwareNameLines(name string, maxPerLine int, maxLines int) []string {
 	if maxPerLine <= 0 {
 		maxPerLine = 26
@@ -383,7 +645,7 @@ func splitSoftwareNameLines(name string, maxPerLine int, maxLines int) []string
 				continue
 			}
 			// Otherwise, only append if it fits
-			if len(line)+1+len(words[wordIdx]) <= maxPerLine {
+			if textlayout.Columns(line)+1+textlayout.Columns(words[wordIdx]) <= float64(maxPerLine) {
 				line += " " + words[wordIdx]
 				wordIdx++
 			} else {
@@ -410,8 +672,8 @@ func calcSoftwareNameFontSize(lines []string, threeLines bool) int {
 
 	longest := 0
 	for _, l := range lines {
-		if len(l) > longest {
-			longest = len(l)
+		if n := int(math.Ceil(textlayout.Columns(l))); n > longest {
+			longest = n
 		}
 	}
 
@@ -446,7 +708,7 @@ const certificateSVGTemplate = `<svg width="{{.Width}}" height="{{.Height}}" vie
         font-family="Arial, Helvetica, sans-serif"
         font-size="28"
         font-weight="bold"
-        fill="{{.TextColor}}">
+        fill="{{.TextColor}}"{{if .CertificateNameRTL}} direction="rtl" unicode-bidi="embed"{{end}}>
     {{.CertificateName}}
   </text>
 
@@ -461,6 +723,10 @@ const certificateSVGTemplate = `<svg width="{{.Width}}" height="{{.Height}}" vie
   </text>
   {{end}}
 
+  {{if .Logo}}
+  <!-- Badge or theme logo -->
+  <svg x="20" y="195" width="130" height="70" viewBox="{{.Logo.ViewBox}}" preserveAspectRatio="xMidYMid meet">{{.Logo.Content}}</svg>
+  {{else}}
   <!-- GÉANT logo SVG embedded -->
   <g transform="translate(90,195) scale(1.18)">
     <g>
@@ -496,12 +762,14 @@ const certificateSVGTemplate = `<svg width="{{.Width}}" height="{{.Height}}" vie
     </g>
   </g>
 
-  <!-- GEANT slogan -->
+  {{end}}
+
+  <!-- Slogan -->
   <text x="{{.Width | divide 2}}" y="295" text-anchor="middle"
         font-family="Arial, Helvetica, sans-serif"
         font-size="18"
         fill="{{.TextColor}}">
-    Networks • Services • People
+    {{.Slogan}}
   </text>
 
   {{/* White overlay and status label for expired or revoked */}}
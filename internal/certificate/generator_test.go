@@ -1,8 +1,19 @@
 package certificate
 
 import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/textlayout"
+	"github.com/finki/badges/internal/theme"
 )
 
 func TestSplitSoftwareNameLines(t *testing.T) {
@@ -59,3 +70,185 @@ func TestCalcSoftwareNameFontSize(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateSVGWithTheme(t *testing.T) {
+	th := theme.Default()
+	th.Certificate.BackgroundColor = "#101010"
+	th.Certificate.FontFamily = "Inter,sans-serif"
+	th.Logo = &theme.Logo{ViewBox: "0 0 10 10", Content: `<circle id="theme-logo" r="5" cx="5" cy="5"/>`}
+	theme.Set(th)
+	defer theme.Set(theme.Default())
+
+	g := NewGenerator()
+	g.SetTemplatePath("../../templates/svg/big-template.svg")
+	svg, err := g.GenerateSVG(&database.Badge{
+		CommitID: "abc123", Type: "certificate", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+
+	svgStr := string(svg)
+	for _, want := range []string{"fill:#101010", "font-family:Inter,sans-serif", `id="theme-logo"`} {
+		if !strings.Contains(svgStr, want) {
+			t.Errorf("Expected SVG to contain %s", want)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestGenerateSVGGolden renders certificates with non-Latin names and compares
+// them with the SVGs in testdata; run with -update after intended changes
+func TestGenerateSVGGolden(t *testing.T) {
+	for name, b := range map[string]struct{ software, certificate string }{
+		"greek":  {"Σύστημα Διαχείρισης Ταυτοτήτων", "Επαληθευμένες Εξαρτήσεις"},
+		"arabic": {"نظام إدارة الهوية", "تبعيات موثقة"},
+		"mixed":  {"eduGAIN Проверка", "Verified Dependencies"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := NewGenerator()
+			g.SetTemplatePath("../../templates/svg/big-template.svg")
+			svg, err := g.GenerateSVG(&database.Badge{
+				CommitID: "golden1", Type: "certificate", Status: "valid", Issuer: "Test Issuer",
+				IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: b.software, SoftwareVersion: "v1.0.0",
+				CertificateName: sql.NullString{String: b.certificate, Valid: true},
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate SVG: %v", err)
+			}
+
+			path := filepath.Join("testdata", name+".golden.svg")
+			if *update {
+				if err := os.WriteFile(path, svg, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(svg, want) {
+				t.Errorf("SVG differs from %s; run go test -update if the change is intended\n%s", path, svg)
+			}
+		})
+	}
+}
+
+// templateSource serves one stored template for every badge type
+type templateSource string
+
+func (s templateSource) GetDefaultTemplate(string) (*database.Template, error) {
+	return &database.Template{Content: string(s)}, nil
+}
+
+func TestGenerateSVGSanitizesStoredTemplates(t *testing.T) {
+	g := NewGenerator()
+	g.SetTemplateSource(templateSource(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><text onclick="alert(1)">{{ .SoftwareName }}</text><foreignObject><div/></foreignObject></svg>`))
+	svg, err := g.GenerateSVG(&database.Badge{CommitID: "stored1", Type: "certificate", Status: "valid",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "App"})
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if !strings.Contains(string(svg), "<text>App</text>") || strings.Contains(string(svg), "onclick") || strings.Contains(string(svg), "foreignObject") {
+		t.Errorf("expected the stored template's output to be sanitized, got %s", svg)
+	}
+}
+
+func TestLayoutCertificateName(t *testing.T) {
+	texts := func(lines []CertNameLine) []string {
+		var s []string
+		for _, l := range lines {
+			s = append(s, l.Text)
+		}
+		return s
+	}
+
+	lines, size := layoutCertificateName("Verified Dependencies", 3)
+	if !reflect.DeepEqual(texts(lines), []string{"Verified", "Dependencies"}) || size != certNameBaseSize {
+		t.Errorf("unexpected default layout %v at %dpx", texts(lines), size)
+	}
+	if lines[0].Y != 31.94 || lines[1].Y != 46.47 {
+		t.Errorf("expected the original baselines, got %+v", lines)
+	}
+
+	// Words beyond the third are no longer dropped
+	name := "Open Source Software Supply Chain Security Assessment"
+	lines, size = layoutCertificateName(name, 3)
+	if strings.Join(texts(lines), " ") != name || len(lines) > 3 || size >= certNameBaseSize {
+		t.Errorf("expected %q to wrap into 3 smaller lines, got %v at %dpx", name, texts(lines), size)
+	}
+	for _, l := range lines {
+		if w := textlayout.Width(l.Text, float64(size), true); w > certNameMaxWidth {
+			t.Errorf("line %q is %.1fpx wide", l.Text, w)
+		}
+	}
+
+	lines, _ = layoutCertificateName(name, 1)
+	if len(lines) != 1 {
+		t.Errorf("expected a single line with maxLines 1, got %v", texts(lines))
+	}
+
+	lines, size = layoutCertificateName(strings.Repeat("Supercalifragilistic ", 12), 2)
+	if len(lines) != 2 || size != certNameMinSize || !strings.HasSuffix(lines[1].Text, "…") {
+		t.Errorf("expected an overlong name to be cut with an ellipsis, got %v at %dpx", texts(lines), size)
+	}
+}
+
+func TestGenerateSVGStatusTreatment(t *testing.T) {
+	g := NewGenerator()
+	g.SetTemplatePath("../../templates/svg/big-template.svg")
+	b := &database.Badge{
+		CommitID: "abc123", Type: "certificate", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+		ExpiryDate: sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+
+	svg, err := g.GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	svgStr := string(svg)
+	for _, want := range []string{`filter="url(#status-grayscale)"`, `id="status-overlay-auto"`, ">EXPIRED</text>"} {
+		if !strings.Contains(svgStr, want) {
+			t.Errorf("Expected an expired certificate to contain %s", want)
+		}
+	}
+	if n := strings.Count(svgStr, "EXPIRED"); n != 1 {
+		t.Errorf("Expected one status label, got %d", n)
+	}
+
+	// The preview renders another status, e.g. to show the valid certificate
+	b.CustomConfig = sql.NullString{String: `{"status_preview":"valid"}`, Valid: true}
+	svg, err = g.GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if strings.Contains(string(svg), "status-grayscale") || strings.Contains(string(svg), "EXPIRED") {
+		t.Error("Expected status_preview=valid to render without the expired treatment")
+	}
+
+	b.CustomConfig = sql.NullString{String: `{"status_preview":"revoked"}`, Valid: true}
+	svg, err = g.GenerateSVG(b)
+	if err != nil {
+		t.Fatalf("Failed to generate SVG: %v", err)
+	}
+	if !strings.Contains(string(svg), ">REVOKED</text>") {
+		t.Error("Expected status_preview=revoked to render the revoked overlay")
+	}
+}
+
+func TestApplyStatusTreatment(t *testing.T) {
+	// Templates that draw their own overlay only get the grayscale group
+	svg := applyStatusTreatment([]byte(`<svg width="10" height="10"><rect/><g id="status-overlay"/></svg>`), "REVOKED", 10, 10)
+	want := `<svg width="10" height="10">` + grayscaleFilter + `<rect/><g id="status-overlay"/></g>` + "\n" + `</svg>`
+	if string(svg) != want {
+		t.Errorf("got %s, want %s", svg, want)
+	}
+
+	// Anything that is not an SVG is left alone
+	if got := applyStatusTreatment([]byte("not svg"), "EXPIRED", 10, 10); string(got) != "not svg" {
+		t.Errorf("Expected non-SVG input to be unchanged, got %s", got)
+	}
+}
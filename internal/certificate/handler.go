@@ -1,35 +1,57 @@
 package certificate
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/commitid"
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/overrides"
+	"github.com/finki/badges/internal/service"
+	"github.com/finki/badges/internal/stats"
 	"github.com/finki/badges/pkg/utils"
 	"go.uber.org/zap"
 )
 
 // Handler handles certificate requests
 type Handler struct {
-	db        *database.DB
-	logger    *zap.Logger
-	cache     *cache.Cache
-	generator *Generator
+	images        *service.Images
+	logger        *zap.Logger
+	cache         *cache.Cache
+	generator     *Generator
+	cachePolicies *httpcache.Policies
+	stats         *stats.Recorder
+}
+
+// Store is the storage certificates are rendered from, e.g. *database.DB
+type Store interface {
+	service.BadgeStore
+	TemplateSource
 }
 
 // NewHandler creates a new certificate handler
-func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+func NewHandler(db Store, logger *zap.Logger, cache *cache.Cache) *Handler {
+	generator := NewGenerator()
+	generator.SetTemplateSource(db)
 	return &Handler{
-		db:        db,
-		logger:    logger,
-		cache:     cache,
-		generator: NewGenerator(),
+		images:        service.NewImages(db, logger),
+		logger:        logger,
+		cache:         cache,
+		generator:     generator,
+		cachePolicies: httpcache.DefaultPolicies(),
 	}
 }
 
+// SetLogoSource makes the handler render per-badge logos
+func (h *Handler) SetLogoSource(src LogoSource) {
+	h.generator.SetLogoSource(src)
+}
+
 // ServeHTTP handles HTTP requests for certificates
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Extract commit ID from URL
@@ -41,17 +63,52 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get format from query parameter (default: svg)
+	// Vanity URLs name a Software Catalogue project and certificate slug;
+	// paths that match no badge that way keep addressing a commit ID
+	if scID, slug, ok := commitid.ParseVanity(path); ok {
+		resolved, err := h.images.ResolveSlug(r.Context(), scID, slug)
+		if err != nil {
+			h.logger.Error("Failed to resolve vanity URL", zap.Error(err), zap.String("path", r.URL.Path))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if resolved != "" {
+			commitID = resolved
+		} else if !commitid.Valid(commitID) {
+			http.Error(w, "Certificate not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	// Get format from query parameter, or negotiate it from the Accept header (default: svg)
 	format := r.URL.Query().Get("format")
 	if format == "" {
-		format = "svg"
+		format = utils.NegotiateFormat(r.Header.Get("Accept"))
+		httpcache.Vary(w, "Accept")
 	}
 
 	// Validate format
-	if format != "svg" && format != "png" && format != "jpg" {
-		http.Error(w, "Invalid format. Supported formats: svg, png, jpg", http.StatusBadRequest)
+	if !utils.IsFormat(format) {
+		http.Error(w, "Invalid format. Supported formats: svg, png, jpg, webp, avif", http.StatusBadRequest)
+		return
+	}
+
+	// Quality for webp and avif (default: encoder default)
+	quality, err := utils.ParseQuality(r.URL.Query().Get("quality"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Raster size (default: native size); ignored for SVG
+	size, err := utils.ParseSize(r.URL.Query().Get("width"), r.URL.Query().Get("height"), r.URL.Query().Get("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if format == "svg" {
+		size = utils.Size{}
+	}
 
 	// Get outlook from query parameter (default: certificate)
 	outlook := r.URL.Query().Get("outlook")
@@ -65,125 +122,141 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check for no_cache parameter
-	noCache := r.URL.Query().Get("no_cache") == "true"
+	// Only signed-in users may bypass the cache; previews of overrides beyond
+	// the public policy are never cached
+	preview := overrides.Preview(r)
+	noCache := overrides.NoCache(r)
 
 	// Try to get from cache first (unless no_cache is true)
-	cacheKey := fmt.Sprintf("certificate:%s:%s:%s", commitID, format, r.URL.RawQuery)
+	query := overrides.CacheQuery(r, renderParams...)
+	cacheKey := fmt.Sprintf("certificate:%s:%s:%s:%s", commitID, format, size, query)
+	// The badge status, which picks the caching policy, is cached next to the image
+	statusKey := fmt.Sprintf("certificate:%s:status:%s:%s:%s", commitID, format, size, query)
 	if !noCache {
 		if cachedData, found := h.cache.Get(cacheKey); found {
-			h.serveImage(w, cachedData, format)
+			status, _ := h.cache.Get(statusKey)
+			h.stats.Request(commitID, r)
+			h.serveImage(w, r, cachedData, format, h.cacheControl(r, "certificate", string(status)))
 			return
 		}
 	}
 
-	// Get badge from database
-	badge, err := h.db.GetBadge(commitID)
-	if err != nil {
-		h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	if badge == nil {
-		http.Error(w, "Certificate not found", http.StatusNotFound)
-		return
-	}
-
 	// Note: We no longer check the badge type as per the unified badge entity model
 	// All badges can be rendered as certificates regardless of their type
 
-	// Apply query parameters to badge configuration
-	if err := h.applyQueryParams(badge, r); err != nil {
-		h.logger.Error("Failed to apply query parameters", zap.Error(err))
-		http.Error(w, "Invalid query parameters", http.StatusBadRequest)
-		return
-	}
-
-	// Generate or retrieve image based on format
-	var imageData []byte
-	var genErr error
-
 	// Note: We're using the certificate generator for both outlooks
 	// In a more complete implementation, we would use different generators
 	// but that would require refactoring to avoid cyclic dependencies
 
-	switch format {
-	case "svg":
-		// Generate SVG
-		imageData, genErr = h.generator.GenerateSVG(badge)
-	case "png":
-		// Check if PNG is already in the database
-		if badge.PNGContent != nil {
-			imageData = badge.PNGContent
-		} else {
-			// Generate SVG first
-			svgData, err := h.generator.GenerateSVG(badge)
-			if err != nil {
-				h.logger.Error("Failed to generate SVG", zap.Error(err))
-				http.Error(w, "Failed to generate image", http.StatusInternalServerError)
-				return
-			}
-
-			// Convert SVG to PNG
-			imageData, genErr = utils.SVGToPNG(svgData, 0, 0)
-			if genErr == nil {
-				// Store PNG in database for future use
-				if err := h.db.UpdateBadgeImage(commitID, "png", imageData); err != nil {
-					h.logger.Error("Failed to update PNG in database", zap.Error(err))
-				}
-			}
+	var status string
+	// Only native-size renders are stored, and status previews never are
+	imageData, err := h.images.Render(r.Context(), service.ImageRequest{
+		CommitID: commitID,
+		Format:   format,
+		Size:     size,
+		Quality:  quality,
+		Renderer: h.generator,
+		Configure: func(badge *database.Badge) error {
+			status = string(badge.DisplayStatus())
+			return h.applyQueryParams(badge, r)
+		},
+		Persist: size.IsNative() && r.URL.Query().Get("status_preview") == "" && !preview,
+	})
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		resolve := func(id string) (string, error) { return h.images.Resolve(r.Context(), id) }
+		if commitid.RedirectAlias(w, r, h.logger, "/certificate/", commitID, resolve) {
+			return
 		}
-	case "jpg":
-		// Check if JPG is already in the database
-		if badge.JPGContent != nil {
-			imageData = badge.JPGContent
-		} else {
-			// Generate SVG first
-			svgData, err := h.generator.GenerateSVG(badge)
-			if err != nil {
-				h.logger.Error("Failed to generate SVG", zap.Error(err))
-				http.Error(w, "Failed to generate image", http.StatusInternalServerError)
-				return
-			}
-
-			// Convert SVG to JPG
-			imageData, genErr = utils.SVGToJPG(svgData, 0, 0)
-			if genErr == nil {
-				// Store JPG in database for future use
-				if err := h.db.UpdateBadgeImage(commitID, "jpg", imageData); err != nil {
-					h.logger.Error("Failed to update JPG in database", zap.Error(err))
-				}
-			}
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrInvalidConfig):
+		h.logger.Error("Failed to apply query parameters", zap.Error(err))
+		http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrBusy):
+		// Too many renders at once: an expired render beats none
+		if h.serveStale(w, r, commitID, cacheKey, format) {
+			return
 		}
-	}
-
-	if genErr != nil {
-		h.logger.Error("Failed to generate image", zap.Error(genErr), zap.String("format", format))
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many renders in progress", http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, service.ErrRender):
+		h.logger.Error("Failed to generate image", zap.Error(err), zap.String("format", format))
 		http.Error(w, "Failed to generate image", http.StatusInternalServerError)
 		return
+	case err != nil:
+		h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
+		if h.serveStale(w, r, commitID, cacheKey, format) {
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
+	h.stats.Render(commitID)
+	h.stats.Request(commitID, r)
+
 	// Cache the result
-	h.cache.Set(cacheKey, imageData, 5*time.Minute)
+	if !preview {
+		h.cache.Set(cacheKey, imageData, 5*time.Minute)
+		h.cache.Set(statusKey, []byte(status), 5*time.Minute)
+	}
 
 	// Serve the image
-	h.serveImage(w, imageData, format)
+	h.serveImage(w, r, imageData, format, h.cacheControl(r, "certificate", status))
+}
+
+
+// serveImage serves an image with the appropriate content type, caching
+// headers and ETag
+func (h *Handler) serveImage(w http.ResponseWriter, r *http.Request, data []byte, format, cacheControl string) {
+	httpcache.ServeContent(w, r, data, utils.ContentType(format), cacheControl)
 }
 
-// serveImage serves an image with the appropriate content type
-func (h *Handler) serveImage(w http.ResponseWriter, data []byte, format string) {
-	switch format {
-	case "svg":
-		w.Header().Set("Content-Type", "image/svg+xml")
-	case "png":
-		w.Header().Set("Content-Type", "image/png")
-	case "jpg":
-		w.Header().Set("Content-Type", "image/jpeg")
+// serveStale serves the last image cached under key, expired or not, when the
+// badge cannot be read, e.g. while the database is unavailable, and reports
+// whether there was one
+func (h *Handler) serveStale(w http.ResponseWriter, r *http.Request, commitID, key, format string) bool {
+	data, found := h.cache.GetStale(key)
+	if !found {
+		return false
+	}
+	h.stats.Request(commitID, r)
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	h.serveImage(w, r, data, format, httpcache.Stale)
+	return true
+}
+
+// cacheControl returns the Cache-Control value of an image of the endpoint
+// for a badge status; status previews use the preview policy, and previews of
+// overrides beyond the public policy are private
+func (h *Handler) cacheControl(r *http.Request, endpoint, status string) string {
+	if overrides.Preview(r) {
+		return httpcache.Private
+	}
+	if r.URL.Query().Get("status_preview") != "" {
+		status = httpcache.StatusPreview
 	}
+	return h.cachePolicies.CacheControl(endpoint, status)
+}
+
+// SetCachePolicies configures the Cache-Control policies of served images
+func (h *Handler) SetCachePolicies(p *httpcache.Policies) {
+	h.cachePolicies = p
+}
+
+// SetStats makes the handler count requests and renders of badge images
+func (h *Handler) SetStats(r *stats.Recorder) {
+	h.stats = r
+}
 
-	w.Header().Set("Cache-Control", "public, max-age=300")
-	w.Write(data)
+// renderParams are the query parameters that change a rendered image besides
+// its format and size; only they are part of the cache key
+var renderParams = []string{
+	"outlook", "quality", "color_left", "color_right", "text_color", "text_color_left", "text_color_right",
+	"logo", "font_size", "style", "status_preview",
 }
 
 // applyQueryParams applies query parameters to the certificate configuration
@@ -194,44 +267,51 @@ func (h *Handler) applyQueryParams(badge *database.Badge, r *http.Request) error
 		return err
 	}
 
-	// Apply query parameters
-	if colorLeft := r.URL.Query().Get("color_left"); colorLeft != "" {
+	// Apply the query parameters the badge's policy honors
+	q := overrides.Query(r, badge)
+	if colorLeft := q.Get("color_left"); colorLeft != "" {
 		config.ColorLeft = colorLeft
 	}
 
-	if colorRight := r.URL.Query().Get("color_right"); colorRight != "" {
+	if colorRight := q.Get("color_right"); colorRight != "" {
 		config.ColorRight = colorRight
 	}
 
-	if textColor := r.URL.Query().Get("text_color"); textColor != "" {
+	if textColor := q.Get("text_color"); textColor != "" {
 		config.TextColor = textColor
 	}
 
-	if textColorLeft := r.URL.Query().Get("text_color_left"); textColorLeft != "" {
+	if textColorLeft := q.Get("text_color_left"); textColorLeft != "" {
 		config.TextColorLeft = textColorLeft
 	}
 
-	if textColorRight := r.URL.Query().Get("text_color_right"); textColorRight != "" {
+	if textColorRight := q.Get("text_color_right"); textColorRight != "" {
 		config.TextColorRight = textColorRight
 	}
 
-	if logo := r.URL.Query().Get("logo"); logo != "" {
+	if logo := q.Get("logo"); logo != "" {
 		config.LogoURL = logo
 	}
 
-	if fontSize := r.URL.Query().Get("font_size"); fontSize != "" {
+	if fontSize := q.Get("font_size"); fontSize != "" {
 		var size int
 		if _, err := fmt.Sscanf(fontSize, "%d", &size); err == nil && size >= 8 && size <= 24 {
 			config.FontSize = size
 		}
 	}
 
-	if style := r.URL.Query().Get("style"); style != "" {
+	if style := q.Get("style"); style != "" {
 		if style == "flat" || style == "3d" {
 			config.Style = style
 		}
 	}
 
+	if preview := q.Get("status_preview"); preview != "" {
+		if database.IsStatusPreview(preview) {
+			config.StatusPreview = preview
+		}
+	}
+
 	// Update badge with new config
 	return badge.SetCustomConfig(config)
 }
@@ -0,0 +1,245 @@
+package certificate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/theme"
+)
+
+// Limits applied to user-supplied templates
+const (
+	// MaxTemplateSize is the largest template accepted for upload
+	MaxTemplateSize = 256 << 10
+	// maxRenderSize caps the SVG a template may produce for the test render
+	maxRenderSize = 1 << 20
+	// renderTimeout bounds the test render of an uploaded template
+	renderTimeout = 2 * time.Second
+	// maxNesting bounds the range and with actions nested in each other, as
+	// each nested range multiplies the work of the ones inside it
+	maxNesting = 3
+)
+
+// errRenderTooLarge is returned when a user-supplied template renders more
+// than maxRenderSize
+var errRenderTooLarge = fmt.Errorf("template renders more than %d KiB", maxRenderSize>>10)
+
+// limitedBuffer is a buffer refusing writes past its limit, so that the
+// execution of a template writing into it stops there; 0 is unlimited
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		return 0, errRenderTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// allowedFuncs are the only functions an uploaded template may call: the
+// generator's helpers plus side-effect free builtins. call, the html/js/urlquery
+// escapers and template inclusion are not available.
+var allowedFuncs = map[string]interface{}{
+	"divide": true, "subtract": true, "getWord": true,
+	"and": true, "or": true, "not": true, "len": true, "index": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"print": true, "printf": true,
+}
+
+// forbiddenContent matches markup that could run code or load external content
+// when the SVG is opened directly in a browser
+var forbiddenContent = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`(?i)<\s*script`), "script elements are not allowed"},
+	{regexp.MustCompile(`(?i)<\s*foreignObject`), "foreignObject elements are not allowed"},
+	{regexp.MustCompile(`(?i)<!\s*(DOCTYPE|ENTITY)`), "DOCTYPE and entity declarations are not allowed"},
+	{regexp.MustCompile(`(?i)\son[a-z]+\s*=`), "event handler attributes are not allowed"},
+	{regexp.MustCompile(`(?i)javascript:`), "javascript: URLs are not allowed"},
+	{regexp.MustCompile(`(?i)@import`), "CSS imports are not allowed"},
+	{regexp.MustCompile(`(?i)url\(\s*['"]?\s*[a-z][a-z0-9+.-]*:`), "external CSS URLs are not allowed"},
+	{regexp.MustCompile(`(?i)\bhref\s*=\s*["']\s*[a-z][a-z0-9+.-]*:`), "external links and references are not allowed"},
+	{regexp.MustCompile(`(?i)<\s*(image|use|feImage)\b[^>]*\bhref\s*=\s*["']\s*[^#"'\s{]`), "only fragment references (#id) may be used by image, use and feImage"},
+}
+
+// ValidateTemplate checks a user-supplied certificate template before it can be
+// stored or activated: size, forbidden markup, the functions and actions it
+// uses, and that a test render produces a well-formed SVG within limits.
+func (g *Generator) ValidateTemplate(templateContent []byte) error {
+	if len(bytes.TrimSpace(templateContent)) == 0 {
+		return errors.New("template content is empty")
+	}
+	if len(templateContent) > MaxTemplateSize {
+		return fmt.Errorf("template is larger than %d KiB", MaxTemplateSize>>10)
+	}
+
+	for _, f := range forbiddenContent {
+		if f.pattern.Match(templateContent) {
+			return errors.New(f.reason)
+		}
+	}
+
+	if err := checkActions(string(stripXMLDeclaration(templateContent))); err != nil {
+		return err
+	}
+
+	svg, err := g.renderSandboxed(SampleBadge(), templateContent)
+	if err != nil {
+		return err
+	}
+	return checkSVG(svg)
+}
+
+// checkActions parses the template with only the allowed functions defined and
+// rejects actions that could include other templates, loop without bound or
+// nest range and with actions deeper than maxNesting
+func checkActions(text string) error {
+	trees, err := parse.Parse("certificate", text, "", "", allowedFuncs)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	if len(trees) > 1 {
+		return errors.New("define and block actions are not allowed")
+	}
+
+	var walk func(n parse.Node, depth int) error
+	walk = func(n parse.Node, depth int) error {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return nil
+			}
+			for _, c := range n.Nodes {
+				if err := walk(c, depth); err != nil {
+					return err
+				}
+			}
+		case *parse.TemplateNode:
+			return errors.New("template actions are not allowed")
+		case *parse.RangeNode:
+			// Only range over badge data, never over numbers or function results
+			cmds := n.Pipe.Cmds
+			if len(cmds) != 1 || len(cmds[0].Args) != 1 || cmds[0].Args[0].Type() != parse.NodeField {
+				return errors.New("range may only iterate over a field such as .CertNameWords")
+			}
+			if depth >= maxNesting {
+				return fmt.Errorf("range and with actions may be nested at most %d deep", maxNesting)
+			}
+			if err := walk(n.List, depth+1); err != nil {
+				return err
+			}
+			return walk(n.ElseList, depth)
+		case *parse.IfNode:
+			if err := walk(n.List, depth); err != nil {
+				return err
+			}
+			return walk(n.ElseList, depth)
+		case *parse.WithNode:
+			// with can bring back the root, so that a range inside it
+			// iterates again
+			if depth >= maxNesting {
+				return fmt.Errorf("range and with actions may be nested at most %d deep", maxNesting)
+			}
+			if err := walk(n.List, depth+1); err != nil {
+				return err
+			}
+			return walk(n.ElseList, depth)
+		}
+		return nil
+	}
+	for _, tree := range trees {
+		if err := walk(tree.Root, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderSandboxed renders a test badge with a time and output size limit. The
+// output limit stops the render itself; the time limit only stops waiting
+// for it, which checkActions keeps from mattering by bounding the nesting.
+func (g *Generator) renderSandboxed(badge *database.Badge, templateContent []byte) ([]byte, error) {
+	type result struct {
+		svg []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		svg, err := g.GenerateSVGWithTemplate(badge, templateContent)
+		done <- result{svg, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(r.svg) > maxRenderSize {
+			return nil, errRenderTooLarge
+		}
+		return r.svg, nil
+	case <-time.After(renderTimeout):
+		return nil, errors.New("template took too long to render")
+	}
+}
+
+// checkSVG verifies the rendered output is a single well-formed svg document
+func checkSVG(svg []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	depth, roots := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("template does not render well-formed SVG: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+				if t.Name.Local != "svg" {
+					return fmt.Errorf("template root element is <%s>, expected <svg>", t.Name.Local)
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.Directive:
+			return errors.New("DOCTYPE and entity declarations are not allowed")
+		case xml.ProcInst:
+			if !strings.EqualFold(t.Target, "xml") {
+				return errors.New("processing instructions are not allowed")
+			}
+		}
+	}
+	if roots != 1 {
+		return errors.New("template does not produce a single SVG document")
+	}
+	return nil
+}
+
+// SampleBadge is the badge rendered to test and preview uploaded templates
+func SampleBadge() *database.Badge {
+	return &database.Badge{
+		CommitID:        "sample1234",
+		Type:            "badge",
+		Status:          "valid",
+		Issuer:          theme.Get().Issuer,
+		IssueDate:       database.Day(time.Now()),
+		SoftwareName:    "Sample Software",
+		SoftwareVersion: "1.0.0",
+	}
+}
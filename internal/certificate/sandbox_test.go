@@ -0,0 +1,74 @@
+package certificate
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+const sandboxSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">%s</svg>`
+
+func TestValidateTemplateRejects(t *testing.T) {
+	g := NewGenerator()
+
+	for name, body := range map[string]string{
+		"script":          `<script>alert(1)</script>`,
+		"foreign object":  `<foreignObject><div/></foreignObject>`,
+		"event handler":   `<rect onload="alert(1)"/>`,
+		"javascript url":  `<a href="javascript:alert(1)"><text>x</text></a>`,
+		"external href":   `<a href="https://example.org"><text>x</text></a>`,
+		"external image":  `<image href="logo.png"/>`,
+		"css import":      `<style>@import "https://example.org/a.css";</style>`,
+		"css url":         `<rect style="fill:url(https://example.org/p.svg)"/>`,
+		"call":            `<text>{{call .SoftwareName}}</text>`,
+		"html escaper":    `<text>{{html .SoftwareName}}</text>`,
+		"define":          `{{define "x"}}y{{end}}<text/>`,
+		"template action": `<text>{{template "x"}}</text>`,
+		"range over int":  `{{range 1000000000}}<text/>{{end}}`,
+		"unknown field":   `<text>{{.NoSuchField}}</text>`,
+		"deep nesting":    strings.Repeat(`{{range .CertNameWords}}{{with $}}`, 2) + `<text/>` + strings.Repeat(`{{end}}{{end}}`, 2),
+	} {
+		if err := g.ValidateTemplate([]byte(strings.Replace(sandboxSVG, "%s", body, 1))); err == nil {
+			t.Errorf("%s: expected template to be rejected", name)
+		}
+	}
+
+	// The render stops once its output is too large
+	large := `{{range .CertNameWords}}{{with $}}{{range .CertNameWords}}` + strings.Repeat("<g/>", 40000) + `{{end}}{{end}}{{end}}`
+	if err := g.ValidateTemplate([]byte(strings.Replace(sandboxSVG, "%s", large, 1))); !errors.Is(err, errRenderTooLarge) {
+		t.Errorf("large output: expected %v, got %v", errRenderTooLarge, err)
+	}
+
+	for name, content := range map[string]string{
+		"empty":     "  ",
+		"doctype":   `<!DOCTYPE svg [<!ENTITY x SYSTEM "file:///etc/passwd">]><svg>&x;</svg>`,
+		"not svg":   `<p>hello</p>`,
+		"two roots": `<svg></svg><svg></svg>`,
+		"too large": strings.Replace(sandboxSVG, "%s", strings.Repeat("<g/>", MaxTemplateSize/4), 1),
+	} {
+		if err := g.ValidateTemplate([]byte(content)); err == nil {
+			t.Errorf("%s: expected template to be rejected", name)
+		}
+	}
+}
+
+func TestValidateTemplateAccepts(t *testing.T) {
+	g := NewGenerator()
+
+	ok := strings.Replace(sandboxSVG, "%s",
+		`<defs><linearGradient id="g"/></defs><rect fill="url(#g)"/><use href="#g"/>`+
+			`{{range .CertNameWords}}<text>{{.}}</text>{{end}}{{if gt .FontSize 10}}<text>{{printf "%s" .SoftwareName}}</text>{{end}}`, 1)
+	if err := g.ValidateTemplate([]byte(ok)); err != nil {
+		t.Errorf("expected template to be accepted, got %v", err)
+	}
+
+	// The shipped template must pass the same checks as uploaded ones
+	shipped, err := os.ReadFile("../../templates/svg/big-template.svg")
+	if err != nil {
+		t.Fatalf("failed to read shipped template: %v", err)
+	}
+	if err := g.ValidateTemplate(shipped); err != nil {
+		t.Errorf("expected the shipped template to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+// Package certtypeapi manages certificate types over a JSON API. Badges link
+// to a certificate type through their certificate_type_id; the type holds the
+// certificate's name, specialty domain and guide link, and group grants and
+// default templates name it.
+package certtypeapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// idPattern limits certificate type IDs to lowercase URL-safe slugs
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+
+// CertificateType is the JSON representation of a certificate type
+type CertificateType struct {
+	TypeID          string    `json:"type_id"`
+	Name            string    `json:"name"`
+	SpecialtyDomain string    `json:"specialty_domain,omitempty"`
+	GuideURL        string    `json:"guide_url,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// UpdateRequest changes the fields present in the request body; "" clears an
+// optional field
+type UpdateRequest struct {
+	Name            *string `json:"name,omitempty"`
+	SpecialtyDomain *string `json:"specialty_domain,omitempty"`
+	GuideURL        *string `json:"guide_url,omitempty"`
+}
+
+// instanceOnly is the error for organization-scoped callers
+const instanceOnly = "Only instance administrators can manage certificate types"
+
+// Handler serves /api/certificate-types and /api/certificate-types/{id}
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+}
+
+// NewHandler creates a new certificate type API handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// ServeHTTP dispatches on method and path. Certificate types are read with
+// the badges permissions; as group grants name them, only instance-wide
+// administrators change them.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/certificate-types"), "/")
+	if strings.Contains(id, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", auth.RequireInstanceWideMiddleware(instanceOnly, http.HandlerFunc(h.create)))
+	case r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withType(id, h.get))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		next = auth.RequirePermissionMiddleware("badges", "write", auth.RequireInstanceWideMiddleware(instanceOnly, h.withType(id, h.update)))
+	case r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", auth.RequireInstanceWideMiddleware(instanceOnly, h.withType(id, h.delete)))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// withType loads the certificate type before calling fn
+func (h *Handler) withType(id string, fn func(http.ResponseWriter, *http.Request, *database.CertificateType)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !idPattern.MatchString(id) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid certificate type ID")
+			return
+		}
+		t, err := h.db.WithContext(r.Context()).GetCertificateType(id)
+		if err != nil {
+			h.logger.Error("certtypeapi: failed to get certificate type", zap.String("type_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get certificate type")
+			return
+		}
+		if t == nil {
+			httpjson.Error(w, http.StatusNotFound, "Certificate type not found")
+			return
+		}
+		fn(w, r, t)
+	})
+}
+
+// list returns all certificate types
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	types, err := h.db.WithContext(r.Context()).ListCertificateTypes()
+	if err != nil {
+		h.logger.Error("certtypeapi: failed to list certificate types", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list certificate types")
+		return
+	}
+
+	resp := make([]CertificateType, 0, len(types))
+	for _, t := range types {
+		resp = append(resp, ToJSON(t))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single certificate type
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, t *database.CertificateType) {
+	httpjson.Write(w, http.StatusOK, ToJSON(t))
+}
+
+// create validates and stores a new certificate type. Without a type_id the
+// slug of the name is used.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req CertificateType
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	now := time.Now()
+	t := &database.CertificateType{
+		TypeID:          req.TypeID,
+		Name:            strings.TrimSpace(req.Name),
+		SpecialtyDomain: toNull(req.SpecialtyDomain),
+		GuideURL:        toNull(req.GuideURL),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if t.TypeID == "" {
+		t.TypeID = database.Slugify(t.Name)
+	}
+	if !idPattern.MatchString(t.TypeID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid certificate type ID: use 2-63 lowercase letters, digits, - or _")
+		return
+	}
+	if err := validate(t); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	existing, err := db.GetCertificateType(t.TypeID)
+	if err != nil {
+		h.logger.Error("certtypeapi: failed to get certificate type", zap.String("type_id", t.TypeID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create certificate type")
+		return
+	}
+	if existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Certificate type already exists")
+		return
+	}
+	if !h.checkName(w, db, t) {
+		return
+	}
+
+	if err := db.CreateCertificateType(t); err != nil {
+		h.logger.Error("certtypeapi: failed to create certificate type", zap.String("type_id", t.TypeID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create certificate type")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, ToJSON(t))
+}
+
+// update applies the fields present in the request body; a new name or
+// specialty domain is copied to the linked badges
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, t *database.CertificateType) {
+	db := h.db.WithContext(r.Context())
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		t.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.SpecialtyDomain != nil {
+		t.SpecialtyDomain = toNull(*req.SpecialtyDomain)
+	}
+	if req.GuideURL != nil {
+		t.GuideURL = toNull(*req.GuideURL)
+	}
+	if err := validate(t); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.checkName(w, db, t) {
+		return
+	}
+
+	t.UpdatedAt = time.Now()
+	if err := db.UpdateCertificateType(t); err != nil {
+		h.logger.Error("certtypeapi: failed to update certificate type", zap.String("type_id", t.TypeID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update certificate type")
+		return
+	}
+
+	h.invalidate(t.TypeID)
+	httpjson.Write(w, http.StatusOK, ToJSON(t))
+}
+
+// delete removes a certificate type; its badges are unlinked but keep their
+// certificate name and specialty domain
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, t *database.CertificateType) {
+	h.invalidate(t.TypeID)
+	if err := h.db.WithContext(r.Context()).DeleteCertificateType(t.TypeID); err != nil {
+		h.logger.Error("certtypeapi: failed to delete certificate type", zap.String("type_id", t.TypeID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete certificate type")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkName rejects a name already used by another certificate type
+func (h *Handler) checkName(w http.ResponseWriter, db *database.DB, t *database.CertificateType) bool {
+	other, err := db.GetCertificateTypeByName(t.Name)
+	if err != nil {
+		h.logger.Error("certtypeapi: failed to get certificate type", zap.String("name", t.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to check certificate type name")
+		return false
+	}
+	if other != nil && other.TypeID != t.TypeID {
+		httpjson.Error(w, http.StatusConflict, "Certificate type "+other.TypeID+" has the same name")
+		return false
+	}
+	return true
+}
+
+// invalidate drops the cached renders and pages of the certificate type's
+// badges
+func (h *Handler) invalidate(typeID string) {
+	badges, err := h.db.ListBadgesByCertificateType(typeID)
+	if err != nil {
+		h.logger.Error("certtypeapi: failed to list certificate type badges", zap.String("type_id", typeID), zap.Error(err))
+		return
+	}
+	for _, b := range badges {
+		h.cache.DeletePrefix("badge:" + b.CommitID + ":")
+		h.cache.DeletePrefix("certificate:" + b.CommitID + ":")
+		h.cache.Delete("details:" + b.CommitID)
+	}
+	h.cache.DeletePrefix("badges:list:")
+	h.cache.Delete("home:index")
+}
+
+// validate checks the fields of a certificate type
+func validate(t *database.CertificateType) error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.GuideURL.Valid {
+		u, err := url.Parse(t.GuideURL.String)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("guide_url must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// ToJSON converts a database certificate type to its API representation
+func ToJSON(t *database.CertificateType) CertificateType {
+	return CertificateType{
+		TypeID:          t.TypeID,
+		Name:            t.Name,
+		SpecialtyDomain: t.SpecialtyDomain.String,
+		GuideURL:        t.GuideURL.String,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+	}
+}
+
+func toNull(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
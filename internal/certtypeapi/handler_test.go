@@ -0,0 +1,88 @@
+package certtypeapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestCertificateTypeLifecycle(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+
+	// The default certificate families come with their guides
+	rec := testutil.Serve(h, ctx, http.MethodGet, "/api/certificate-types/verified-dependencies", nil)
+	var got CertificateType
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.GuideURL == "" {
+		t.Errorf("expected the default type with its guide, got %d %+v", rec.Code, got)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPost, "/api/certificate-types", CertificateType{
+		Name: "Verified Accessibility", GuideURL: "https://example.org/guide",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.TypeID != "verified-accessibility" {
+		t.Errorf("expected the slug of the name as ID, got %q", got.TypeID)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/certificate-types", CertificateType{TypeID: "other", Name: "verified accessibility"}); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate name, got %d", rec.Code)
+	}
+
+	badge := &database.Badge{
+		CommitID: "linked1", Type: "badge", Status: "valid", Issuer: "GÉANT", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "App", SoftwareVersion: "v1", CertificateName: sql.NullString{String: "Verified Accessibility", Valid: true},
+		CertificateTypeID: sql.NullString{String: "verified-accessibility", Valid: true},
+	}
+	if err := db.CreateBadge(badge); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+
+	name, domain := "Verified Web Accessibility", "ACCESSIBILITY"
+	if rec := testutil.Serve(h, ctx, http.MethodPatch, "/api/certificate-types/verified-accessibility", UpdateRequest{Name: &name, SpecialtyDomain: &domain}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	b, _ := db.GetBadge("linked1")
+	if b.CertificateName.String != name || b.SpecialtyDomain.String != domain {
+		t.Errorf("expected the linked badge to take the type's name and domain, got %q %q", b.CertificateName.String, b.SpecialtyDomain.String)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodDelete, "/api/certificate-types/verified-accessibility", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	b, _ = db.GetBadge("linked1")
+	if b.CertificateTypeID.Valid || b.CertificateName.String != name {
+		t.Errorf("expected the badge to be unlinked and keep its certificate name, got %+v", b.CertificateTypeID)
+	}
+}
+
+func TestCertificateTypeValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	for name, req := range map[string]CertificateType{
+		"bad id":    {TypeID: "Bad ID", Name: "x"},
+		"no name":   {TypeID: "accessibility"},
+		"bad guide": {Name: "Accessibility", GuideURL: "javascript:alert(1)"},
+	} {
+		if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/certificate-types", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+
+	if rec := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodPost, "/api/certificate-types", CertificateType{Name: "Accessibility"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without write permission, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/netguard"
+)
+
+// card is the content of a notification, formatted per connector type
+type card struct {
+	Title    string
+	Summary  string
+	Color    string
+	ImageURL string
+	LinkURL  string
+	Facts    [][2]string
+}
+
+// newCard describes an event of a badge
+func newCard(b *database.Badge, event, baseURL string) *card {
+	name := strings.TrimSpace(b.SoftwareName + " " + b.SoftwareVersion)
+	if b.CertificateName.Valid && b.CertificateName.String != "" {
+		name = b.CertificateName.String + ": " + name
+	}
+
+	c := &card{
+		ImageURL: baseURL + "/badge/" + url.PathEscape(b.CommitID) + "?format=png",
+		LinkURL:  baseURL + "/details/" + url.PathEscape(b.CommitID),
+		Facts:    [][2]string{{"Status", string(b.DisplayStatus())}, {"Issuer", b.Issuer}, {"Issued", database.FormatDate(b.IssueDate)}},
+	}
+	if b.ExpiryDate.Valid {
+		c.Facts = append(c.Facts, [2]string{"Expires", database.FormatNullDate(b.ExpiryDate)})
+	}
+
+	switch event {
+	case EventIssued:
+		c.Title, c.Color = "Certificate issued: "+name, "#2eb886"
+		c.Summary = fmt.Sprintf("%s has been certified by %s.", name, b.Issuer)
+	case EventExpiring:
+		c.Title, c.Color = "Certificate expiring: "+name, "#daa038"
+		c.Summary = fmt.Sprintf("The certificate of %s expires on %s.", name, database.FormatNullDate(b.ExpiryDate))
+	case EventRevoked:
+		c.Title, c.Color = "Certificate revoked: "+name, "#a30200"
+		c.Summary = fmt.Sprintf("The certificate of %s has been revoked.", name)
+	}
+	return c
+}
+
+// slackEscape escapes the characters Slack treats as markup in text
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackPayload formats a card as Slack blocks
+func (c *card) slackPayload() interface{} {
+	fields := make([]map[string]string, 0, len(c.Facts))
+	for _, f := range c.Facts {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*" + f[0] + "*\n" + slackEscape(f[1])})
+	}
+	return map[string]interface{}{
+		"text": slackEscape(c.Title),
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": "*<" + c.LinkURL + "|" + slackEscape(c.Title) + ">*\n" + slackEscape(c.Summary)},
+			},
+			map[string]interface{}{"type": "section", "fields": fields},
+			map[string]interface{}{"type": "image", "image_url": c.ImageURL, "alt_text": slackEscape(c.Title)},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{map[string]interface{}{
+					"type": "button",
+					"text": map[string]string{"type": "plain_text", "text": "View certificate"},
+					"url":  c.LinkURL,
+				}},
+			},
+		},
+	}
+}
+
+// mattermostPayload formats a card as a Mattermost message attachment
+func (c *card) mattermostPayload() interface{} {
+	fields := make([]map[string]interface{}, 0, len(c.Facts))
+	for _, f := range c.Facts {
+		fields = append(fields, map[string]interface{}{"short": true, "title": f[0], "value": f[1]})
+	}
+	return map[string]interface{}{
+		"attachments": []interface{}{map[string]interface{}{
+			"fallback":   c.Title,
+			"color":      c.Color,
+			"title":      c.Title,
+			"title_link": c.LinkURL,
+			"text":       c.Summary,
+			"fields":     fields,
+			"image_url":  c.ImageURL,
+		}},
+	}
+}
+
+// teamsPayload formats a card as an Adaptive Card message, as accepted by
+// Teams workflow webhooks
+func (c *card) teamsPayload() interface{} {
+	facts := make([]map[string]string, 0, len(c.Facts))
+	for _, f := range c.Facts {
+		facts = append(facts, map[string]string{"title": f[0], "value": f[1]})
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []interface{}{
+					map[string]interface{}{"type": "TextBlock", "text": c.Title, "size": "Medium", "weight": "Bolder", "wrap": true},
+					map[string]interface{}{"type": "TextBlock", "text": c.Summary, "wrap": true},
+					map[string]interface{}{"type": "Image", "url": c.ImageURL, "altText": c.Title},
+					map[string]interface{}{"type": "FactSet", "facts": facts},
+				},
+				"actions": []interface{}{map[string]string{"type": "Action.OpenUrl", "title": "View certificate", "url": c.LinkURL}},
+			},
+		}},
+	}
+}
+
+// sender posts cards to incoming webhooks
+type sender struct {
+	client *http.Client
+}
+
+// newSender returns a sender that only posts to public addresses
+func newSender() *sender {
+	return &sender{client: netguard.NewClient(15 * time.Second)}
+}
+
+// send posts a card to a connector in its chat service's format
+func (s *sender) send(ctx context.Context, c database.Connector, cd *card) error {
+	var payload interface{}
+	switch c.Type {
+	case Slack:
+		payload = cd.slackPayload()
+	case Mattermost:
+		payload = cd.mattermostPayload()
+	case Teams:
+		payload = cd.teamsPayload()
+	default:
+		return fmt.Errorf("unsupported connector type %q", c.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// The URL holds the webhook secret; keep it out of the logs
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
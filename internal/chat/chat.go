@@ -0,0 +1,247 @@
+// Package chat posts cards about an organization's badges to Slack,
+// Mattermost and Microsoft Teams channels: when a badge is issued, when it is
+// about to expire and when it is revoked.
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/netguard"
+	"go.uber.org/zap"
+)
+
+// Connector types
+const (
+	Slack      = "slack"
+	Mattermost = "mattermost"
+	Teams      = "teams"
+)
+
+// Events a connector can subscribe to
+const (
+	EventIssued   = "issued"
+	EventExpiring = "expiring"
+	EventRevoked  = "revoked"
+)
+
+// Interval is how often the notifier looks for changed badges
+const Interval = time.Minute
+
+// ExpiryWarning is how long before its expiry date a badge is announced as expiring
+const ExpiryWarning = 30 * 24 * time.Hour
+
+// maxNameLength is the maximum length of a connector name
+const maxNameLength = 100
+
+// Validate normalizes a connector and checks it. Slack connectors must use a
+// hooks.slack.com URL; every webhook URL must use https, and the hosts of
+// Mattermost and Teams webhooks must only resolve to public addresses, so
+// that organization administrators cannot make the server post to its own
+// network.
+func Validate(ctx context.Context, c *database.Connector) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	c.URL = strings.TrimSpace(c.URL)
+
+	if c.Name == "" || len(c.Name) > maxNameLength {
+		return fmt.Errorf("connector name is required and must be at most %d characters", maxNameLength)
+	}
+	if c.Type != Slack && c.Type != Mattermost && c.Type != Teams {
+		return fmt.Errorf("invalid type %q for connector %s: use slack, mattermost or teams", c.Type, c.Name)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL for connector %s: use an https URL", c.Name)
+	}
+	if c.Type == Slack && u.Hostname() != "hooks.slack.com" {
+		return fmt.Errorf("invalid webhook URL for connector %s: Slack webhooks are on hooks.slack.com", c.Name)
+	}
+	for _, e := range c.Events {
+		if e != EventIssued && e != EventExpiring && e != EventRevoked {
+			return fmt.Errorf("invalid event %q for connector %s: use issued, expiring or revoked", e, c.Name)
+		}
+	}
+	if c.Type != Slack {
+		if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+			return fmt.Errorf("invalid webhook URL for connector %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// subscribed reports whether the connector wants to hear about event
+func subscribed(c database.Connector, event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier announces badge changes on the chat connectors of their organization
+type Notifier struct {
+	// mu keeps a final Notify at shutdown from racing the one of Run
+	mu      sync.Mutex
+	db      *database.DB
+	logger  *zap.Logger
+	sender  *sender
+	baseURL string
+}
+
+// NewNotifier creates a notifier. Cards link to the details pages and badge
+// images under baseURL, which chat services must be able to reach.
+func NewNotifier(db *database.DB, logger *zap.Logger, baseURL string) *Notifier {
+	return &Notifier{
+		db:      db,
+		logger:  logger,
+		sender:  newSender(),
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Run notifies every Interval until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+
+	for {
+		n.Notify(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Notify compares every badge with the state last announced for it, posts
+// the resulting events and returns how many cards were delivered. Badges seen
+// for the first time are only announced if they were issued recently, so
+// existing badges do not flood the channels. Failed deliveries are logged and
+// not retried, except those cut short by ctx, which are posted again by the
+// next call.
+func (n *Notifier) Notify(ctx context.Context, now time.Time) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	db := n.db.WithContext(ctx)
+
+	badges, err := db.ListBadges()
+	if err != nil {
+		n.logger.Error("chat: failed to list badges", zap.Error(err))
+		return 0
+	}
+	states, err := db.ListNotificationStates()
+	if err != nil {
+		n.logger.Error("chat: failed to list notification states", zap.Error(err))
+		return 0
+	}
+
+	orgConnectors := map[string][]database.Connector{}
+	delivered := 0
+	for _, b := range badges {
+		if ctx.Err() != nil {
+			break
+		}
+		state := stateOf(b, now)
+		prev, seen := states[b.CommitID]
+		if seen && prev == state {
+			continue
+		}
+
+		event := ""
+		if seen || issuedRecently(b, now) {
+			event = eventFor(prev, state)
+		}
+		if event != "" && b.OrgID.String != "" {
+			for _, c := range n.connectors(b.OrgID.String, orgConnectors) {
+				if !subscribed(c, event) {
+					continue
+				}
+				if err := n.sender.send(ctx, c, newCard(b, event, n.baseURL)); err != nil {
+					n.logger.Warn("chat: failed to post card",
+						zap.String("commit_id", b.CommitID), zap.String("connector", c.Name), zap.Error(err))
+					continue
+				}
+				delivered++
+			}
+		}
+		// Interrupted: the state is left for the next call to announce
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := db.SetNotificationState(b.CommitID, state, now); err != nil {
+			n.logger.Error("chat: failed to record notification state", zap.String("commit_id", b.CommitID), zap.Error(err))
+		}
+	}
+	return delivered
+}
+
+// connectors returns the chat connectors of an organization
+func (n *Notifier) connectors(orgID string, cached map[string][]database.Connector) []database.Connector {
+	if connectors, ok := cached[orgID]; ok {
+		return connectors
+	}
+
+	var connectors []database.Connector
+	o, err := n.db.GetOrganization(orgID)
+	if err != nil {
+		n.logger.Error("chat: failed to get organization", zap.String("org_id", orgID), zap.Error(err))
+	} else if o != nil {
+		if connectors, err = o.GetConnectors(); err != nil {
+			n.logger.Error("chat: invalid organization connectors", zap.String("org_id", orgID), zap.Error(err))
+		}
+	}
+	cached[orgID] = connectors
+	return connectors
+}
+
+// stateOf returns the announced state of a badge: draft (not published),
+// revoked, expired, expiring (within ExpiryWarning) or valid
+func stateOf(b *database.Badge, now time.Time) string {
+	if !b.IsPublished() {
+		return "draft"
+	}
+	if status := b.DisplayStatus(); status != "valid" {
+		return string(status)
+	}
+	if b.ExpiryDate.Valid && b.ExpiryDate.Time.Sub(now) < ExpiryWarning {
+		return "expiring"
+	}
+	return "valid"
+}
+
+// eventFor returns the event announced when a badge moves from prev ("" for
+// a new badge) to state. A badge becoming valid after being unpublished,
+// expired or revoked counts as issued.
+func eventFor(prev, state string) string {
+	switch state {
+	case "revoked":
+		return EventRevoked
+	case "valid", "expiring":
+		switch prev {
+		case "", "draft", "revoked", "expired":
+			return EventIssued
+		case "valid":
+			if state == "expiring" {
+				return EventExpiring
+			}
+		}
+	}
+	return ""
+}
+
+// issuedRecently reports whether a badge was issued today or yesterday
+func issuedRecently(b *database.Badge, now time.Time) bool {
+	return !b.IssueDate.IsZero() && now.Sub(b.IssueDate) < 48*time.Hour
+}
@@ -0,0 +1,200 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/netguard"
+	"go.uber.org/zap"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	c := database.Connector{Name: " releases ", Type: "Slack", URL: "https://hooks.slack.com/services/T/B/x"}
+	if err := Validate(ctx, &c); err != nil || c.Name != "releases" || c.Type != Slack {
+		t.Errorf("expected a valid normalized connector, got %+v (err %v)", c, err)
+	}
+	c = database.Connector{Name: "team", Type: Mattermost, URL: "https://93.184.216.34/hooks/x"}
+	if err := Validate(ctx, &c); err != nil {
+		t.Errorf("expected a Mattermost webhook on a public address to be accepted, got %v", err)
+	}
+
+	for _, c := range []database.Connector{
+		{Type: Slack, URL: "https://hooks.slack.com/services/T/B/x"},
+		{Name: "irc", Type: "irc", URL: "https://irc.example.org/hook"},
+		{Name: "plain", Type: Mattermost, URL: "http://chat.example.org/hooks/x"},
+		{Name: "elsewhere", Type: Slack, URL: "https://hooks.example.org/services/x"},
+		{Name: "events", Type: Teams, URL: "https://example.webhook.office.com/x", Events: []string{"deleted"}},
+		{Name: "loopback", Type: Mattermost, URL: "https://127.0.0.1:8065/hooks/x"},
+		{Name: "metadata", Type: Teams, URL: "https://169.254.169.254/latest/meta-data"},
+		{Name: "internal", Type: Mattermost, URL: "https://[fd00::1]/hooks/x"},
+	} {
+		if err := Validate(ctx, &c); err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+// received is a card posted to the fake chat service
+type received struct {
+	path string
+	body map[string]interface{}
+}
+
+func TestNotify(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "chat.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		mu    sync.Mutex
+		cards []received
+		// interrupt, if set, is called by the first card it receives
+		interrupt context.CancelFunc
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		cards = append(cards, received{r.URL.Path, body})
+		if interrupt != nil {
+			interrupt()
+			interrupt = nil
+		}
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	take := func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		c := cards
+		cards = nil
+		return c
+	}
+
+	now := time.Now()
+	o := &database.Organization{OrgID: "acme", Name: "Acme", CreatedAt: now, UpdatedAt: now}
+	o.SetConnectors([]database.Connector{
+		{Name: "slack", Type: Slack, URL: srv.URL + "/slack"},
+		{Name: "mattermost", Type: Mattermost, URL: srv.URL + "/mattermost"},
+		{Name: "teams", Type: Teams, URL: srv.URL + "/teams", Events: []string{EventRevoked}},
+	})
+	if err := db.CreateOrganization(o); err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+
+	acme := sql.NullString{String: "acme", Valid: true}
+	today := database.Day(now)
+	inSixtyDays := sql.NullTime{Time: database.Day(now.AddDate(0, 0, 60)), Valid: true}
+	badges := []*database.Badge{
+		{CommitID: "old12345", Status: "valid", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), OrgID: acme, ExpiryDate: inSixtyDays},
+		{CommitID: "new12345", Status: "valid", IssueDate: today, OrgID: acme},
+		{CommitID: "draft123", Status: "draft", IssueDate: today, OrgID: acme},
+		{CommitID: "solo1234", Status: "valid", IssueDate: today},
+	}
+	for _, b := range badges {
+		b.Type, b.Issuer, b.SoftwareName, b.SoftwareVersion = "certificate", "GÉANT", "App", "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	n := NewNotifier(db, logger, "https://badges.example.org")
+	// The fake chat service is on a loopback address, which the notifier
+	// refuses to post to
+	n.sender.client = srv.Client()
+
+	// Only the newly issued badge of the organization is announced, on the
+	// connectors subscribed to issuance
+	if got := n.Notify(context.Background(), now); got != 2 {
+		t.Fatalf("expected 2 cards, got %d", got)
+	}
+	for _, c := range take() {
+		data, _ := json.Marshal(c.body)
+		switch c.path {
+		case "/slack", "/mattermost":
+			if !strings.Contains(string(data), "Certificate issued: App v1") ||
+				!strings.Contains(string(data), "https://badges.example.org/details/new12345") ||
+				!strings.Contains(string(data), "https://badges.example.org/badge/new12345?format=png") {
+				t.Errorf("unexpected %s card %s", c.path, data)
+			}
+		default:
+			t.Errorf("unexpected card on %s", c.path)
+		}
+	}
+	if got := n.Notify(context.Background(), now); got != 0 {
+		t.Errorf("expected no cards for unchanged badges, got %d", got)
+	}
+
+	// Publishing a draft announces it
+	badges[2].Status = "valid"
+	db.UpdateBadge(badges[2])
+	if got := n.Notify(context.Background(), now); got != 2 {
+		t.Errorf("expected the published draft to be announced twice, got %d", got)
+	}
+	take()
+
+	// Expiry warnings go out once the expiry date is near
+	if got := n.Notify(context.Background(), now.AddDate(0, 0, 40)); got != 2 {
+		t.Errorf("expected an expiry warning, got %d", got)
+	}
+	for _, c := range take() {
+		if data, _ := json.Marshal(c.body); !strings.Contains(string(data), "Certificate expiring") {
+			t.Errorf("expected an expiry warning, got %s", data)
+		}
+	}
+
+	// Revocations reach every connector, Teams as an Adaptive Card
+	badges[0].Status = "revoked"
+	db.UpdateBadge(badges[0])
+	if got := n.Notify(context.Background(), now); got != 3 {
+		t.Errorf("expected the revocation on all three connectors, got %d", got)
+	}
+	for _, c := range take() {
+		if c.path == "/teams" {
+			attachments, _ := c.body["attachments"].([]interface{})
+			if c.body["type"] != "message" || len(attachments) != 1 {
+				t.Errorf("unexpected Teams card %+v", c.body)
+			}
+		}
+	}
+
+	// A card cut short, e.g. by shutdown, is posted again by the next call
+	badges[1].Status = "revoked"
+	db.UpdateBadge(badges[1])
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	interrupt = cancel
+	mu.Unlock()
+	n.Notify(ctx, now)
+	take()
+	if got := n.Notify(context.Background(), now); got != 3 {
+		t.Errorf("expected the interrupted revocation to be posted again, got %d", got)
+	}
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the webhook on a loopback address not to be posted to")
+	}))
+	defer srv.Close()
+
+	c := database.Connector{Name: "team", Type: Mattermost, URL: srv.URL + "/hooks/x"}
+	b := &database.Badge{CommitID: "abc12345", Type: "badge", Status: "valid"}
+	if err := newSender().send(context.Background(), c, newCard(b, EventIssued, "https://badges.example.org")); !errors.Is(err, netguard.ErrPrivateAddress) {
+		t.Errorf("expected the post to a loopback address to be refused, got %v", err)
+	}
+}
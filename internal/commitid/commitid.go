@@ -0,0 +1,131 @@
+// Package commitid validates the commit IDs badges are identified by. The
+// accepted characters and length are configurable, so instances with legacy
+// IDs can accept them while every route and API applies the same rules. It
+// also parses the vanity paths badges can be reached by instead.
+package commitid
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPattern accepts letters, digits, underscores and hyphens
+	DefaultPattern = `^[a-zA-Z0-9_-]+$`
+	// DefaultMinLength is the shortest commit ID accepted by default
+	DefaultMinLength = 6
+	// DefaultMaxLength is the longest commit ID accepted by default, a full SHA-1 hash
+	DefaultMaxLength = 40
+)
+
+var (
+	// SoftwareIDPattern limits Software Catalogue project IDs to URL-safe characters
+	SoftwareIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,100}$`)
+	// slugPattern matches certificate slugs such as self-assessed-dependencies
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Policy describes the commit IDs that are accepted
+type Policy struct {
+	pattern   *regexp.Regexp
+	minLength int
+	maxLength int
+}
+
+// NewPolicy creates a policy accepting IDs of minLength to maxLength bytes
+// that match pattern. IDs are taken from URL path segments, so pattern must
+// not accept slashes.
+func NewPolicy(pattern string, minLength, maxLength int) (*Policy, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit ID pattern: %w", err)
+	}
+	if minLength < 1 || maxLength < minLength {
+		return nil, fmt.Errorf("invalid commit ID length range %d-%d", minLength, maxLength)
+	}
+	if re.MatchString("/") {
+		return nil, fmt.Errorf("commit ID pattern %s must not accept slashes", pattern)
+	}
+	return &Policy{pattern: re, minLength: minLength, maxLength: maxLength}, nil
+}
+
+// Default returns the policy used unless another one is set
+func Default() *Policy {
+	return &Policy{pattern: regexp.MustCompile(DefaultPattern), minLength: DefaultMinLength, maxLength: DefaultMaxLength}
+}
+
+// Valid reports whether id is an accepted commit ID
+func (p *Policy) Valid(id string) bool {
+	return len(id) >= p.minLength && len(id) <= p.maxLength && p.pattern.MatchString(id)
+}
+
+// String describes the policy, e.g. for logs
+func (p *Policy) String() string {
+	return fmt.Sprintf("%d-%d characters matching %s", p.minLength, p.maxLength, p.pattern)
+}
+
+var (
+	mu      sync.RWMutex
+	current = Default()
+)
+
+// Set makes p the policy applied by Valid
+func Set(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Get returns the active policy
+func Get() *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Valid reports whether id is accepted by the active policy
+func Valid(id string) bool {
+	return Get().Valid(id)
+}
+
+// Redirect permanently redirects a request for the badge ID from, found in
+// the URL path right after prefix, to the same URL with the commit ID to. It
+// sends alias and differently-cased URLs to the canonical one.
+func Redirect(w http.ResponseWriter, r *http.Request, prefix, from, to string) {
+	target := *r.URL
+	target.Path = prefix + to + strings.TrimPrefix(r.URL.Path, prefix+from)
+	target.RawPath = ""
+	http.Redirect(w, r, target.RequestURI(), http.StatusMovedPermanently)
+}
+
+// RedirectAlias redirects a request for an alias or a differently-cased
+// commit ID to the canonical URL, as found by resolve ("" for unknown IDs),
+// and reports whether it did. Resolution errors are logged and leave the
+// request to be served under id.
+func RedirectAlias(w http.ResponseWriter, r *http.Request, logger *zap.Logger, prefix, id string, resolve func(id string) (string, error)) bool {
+	canonical, err := resolve(id)
+	if err != nil {
+		logger.Error("Failed to resolve badge ID", zap.Error(err), zap.String("commit_id", id))
+		return false
+	}
+	if canonical == "" || canonical == id {
+		return false
+	}
+	Redirect(w, r, prefix, id, canonical)
+	return true
+}
+
+// ParseVanity splits a path below /badge/ or /certificate/ of the form
+// {software_sc_id}/{certificate-slug} and reports whether it is one
+func ParseVanity(path string) (scID, slug string, ok bool) {
+	scID, slug, found := strings.Cut(strings.TrimSuffix(path, "/"), "/")
+	if !found || !SoftwareIDPattern.MatchString(scID) || !slugPattern.MatchString(slug) {
+		return "", "", false
+	}
+	return scID, slug, true
+}
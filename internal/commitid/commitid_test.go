@@ -0,0 +1,120 @@
+package commitid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	p := Default()
+	for id, want := range map[string]bool{
+		"abc123":   true,
+		"abc-123_": true,
+		"a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2": true,
+		"abc12":      false,
+		"abc 123":    false,
+		"abc/123":    false,
+		"abc123.svg": false,
+		"":           false,
+		"a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c": false,
+	} {
+		if got := p.Valid(id); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy(`^[a-z0-9.]+$`, 3, 8)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if !p.Valid("v1.2") || p.Valid("ab") || p.Valid("V1.2") || p.Valid("abcdefghi") {
+		t.Errorf("unexpected results for %s", p)
+	}
+
+	for _, tc := range []struct {
+		pattern  string
+		min, max int
+	}{
+		{`^[a-z`, 1, 10},
+		{`^[a-z]+$`, 0, 10},
+		{`^[a-z]+$`, 10, 5},
+		{`^.+$`, 1, 10},
+	} {
+		if _, err := NewPolicy(tc.pattern, tc.min, tc.max); err == nil {
+			t.Errorf("expected %s %d-%d to be rejected", tc.pattern, tc.min, tc.max)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	defer Set(Default())
+
+	p, err := NewPolicy(DefaultPattern, 4, 40)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if Valid("abcd") {
+		t.Fatal("expected the default policy to reject short IDs")
+	}
+	Set(p)
+	if !Valid("abcd") || Get() != p {
+		t.Error("expected the new policy to apply")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/badge/OLD-ID/extra?format=png", nil)
+	rec := httptest.NewRecorder()
+	Redirect(rec, req, "/badge/", "OLD-ID", "abc123")
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/badge/abc123/extra?format=png" {
+		t.Errorf("expected a redirect to the canonical URL, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestRedirectAlias(t *testing.T) {
+	resolve := func(id string) (string, error) {
+		switch id {
+		case "old-name", "ABC123", "abc123":
+			return "abc123", nil
+		case "broken":
+			return "", errors.New("database is locked")
+		}
+		return "", nil
+	}
+	for id, want := range map[string]string{
+		"old-name": "/badge/abc123?format=png",
+		"ABC123":   "/badge/abc123?format=png",
+		"abc123":   "",
+		"unknown1": "",
+		"broken":   "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/badge/"+id+"?format=png", nil)
+		rec := httptest.NewRecorder()
+		redirected := RedirectAlias(rec, req, zap.NewNop(), "/badge/", id, resolve)
+		if redirected != (want != "") || rec.Header().Get("Location") != want {
+			t.Errorf("%s: expected redirect to %q, got %v %q", id, want, redirected, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestParseVanity(t *testing.T) {
+	for path, want := range map[string][2]string{
+		"my.project/self-assessed-dependencies": {"my.project", "self-assessed-dependencies"},
+		"proj-1/verified-software-licence/":     {"proj-1", "verified-software-licence"},
+		"abc123":                                {},
+		"proj/Self-Assessed":                    {},
+		"proj/a/b":                              {},
+		"/self-assessed-dependencies":           {},
+	} {
+		scID, slug, ok := ParseVanity(path)
+		if ok != (want[0] != "") || scID != want[0] || slug != want[1] {
+			t.Errorf("ParseVanity(%q) = %q, %q, %v", path, scID, slug, ok)
+		}
+	}
+}
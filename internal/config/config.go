@@ -1,44 +1,598 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/overrides"
+	"github.com/finki/badges/internal/redact"
+	"github.com/finki/badges/internal/secrets"
+	"github.com/finki/badges/pkg/utils"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	// Server configuration
-	Port     int
-	LogLevel string
+	Port     int    `yaml:"port" env:"PORT"`
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL"`
+
+	// Public address of the service, e.g. https://certificates.software.geant.org,
+	// used for every absolute link; unset derives it from each request, and
+	// notifications use the production address
+	BaseURL string `yaml:"base_url" env:"BASE_URL"`
+
+	// Path the service is served below behind a reverse proxy, e.g.
+	// /certificates; unset uses the path of BaseURL
+	PathPrefix string `yaml:"path_prefix" env:"PATH_PREFIX"`
+
+	// Key signing session JWTs; unset keeps the built-in development key
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
 
 	// Database configuration
-	DatabasePath string
+	DatabasePath string `yaml:"db_path" env:"DB_PATH"`
+
+	// Seed data: only loaded into the database when SeedData is enabled
+	SeedData     bool   `yaml:"seed_data" env:"SEED_DATA"`
+	SeedDataPath string `yaml:"seed_data_path" env:"SEED_DATA_PATH"`
+
+	// Blob store for generated images: "db" (default), "fs" or "s3"
+	BlobStore     string `yaml:"blob_store" env:"BLOB_STORE"`
+	BlobStorePath string `yaml:"blob_store_path" env:"BLOB_STORE_PATH"`
+	S3Endpoint    string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region      string `yaml:"s3_region" env:"S3_REGION"`
+	S3Bucket      string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey   string `yaml:"s3_access_key" env:"S3_ACCESS_KEY"`
+	S3SecretKey   string `yaml:"s3_secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	S3PathStyle   bool   `yaml:"s3_path_style" env:"S3_PATH_STYLE"`
+
+	// Directory whose templates/ and static/ files override the embedded ones
+	AssetsDir string `yaml:"assets_dir" env:"ASSETS_DIR"`
+
+	// Parse HTML templates again when their files change, for development;
+	// they are read from AssetsDir, or the working directory when unset
+	TemplateReload bool `yaml:"template_reload" env:"TEMPLATE_RELOAD"`
+
+	// Optional JSON theme file overriding the built-in GÉANT rendering defaults
+	ThemeFile string `yaml:"theme_file" env:"THEME_FILE"`
+
+	// Ed25519 key used to sign verification responses; generated on first start if missing
+	SigningKeyFile string `yaml:"signing_key_file" env:"SIGNING_KEY_FILE"`
+
+	// Hosts per-badge logos may be fetched from; without any, only data: URIs
+	// are accepted. LogoMaxSize limits a logo file in bytes (0 = default).
+	LogoAllowedHosts []string `yaml:"logo_allowed_hosts" env:"LOGO_ALLOWED_HOSTS"`
+	LogoMaxSize      int64    `yaml:"logo_max_size" env:"LOGO_MAX_SIZE"`
+
+	// Optional file replacing the built-in robots.txt
+	RobotsFile string `yaml:"robots_file" env:"ROBOTS_FILE"`
+
+	// RequireApproval only publishes badges approved through the review workflow
+	RequireApproval bool `yaml:"require_approval" env:"REQUIRE_APPROVAL"`
+
+	// Instance-wide forge credentials for posting commit statuses, as
+	// [type:]host=token entries; organizations may configure their own
+	ForgeTokens []string `yaml:"forge_tokens" env:"FORGE_TOKENS" secret:"true"`
+
+	// Software Catalogue to synchronize software_sc_id links with, e.g.
+	// https://sc.geant.org; unset disables the sync
+	CatalogueURL string `yaml:"catalogue_url" env:"CATALOGUE_URL"`
+
+	// Port of the gRPC API for service-to-service badge management; 0 disables it
+	GRPCPort int `yaml:"grpc_port" env:"GRPC_PORT"`
+
+	// Mutual TLS: MTLSAddr (e.g. ":8443"; unset disables it) serves the
+	// routes over TLS with MTLSCertFile and MTLSKeyFile, verifying client
+	// certificates against the CAs in MTLSClientCAFile. MTLSClientAuth is
+	// require (handshakes without a certificate fail) or optional.
+	// GRPCClientAuth serves the gRPC API over TLS with the same files and
+	// policy values; unset keeps it in plaintext. MTLSAccounts maps
+	// certificate identities (URI, DNS or email SAN, or subject CN) to the
+	// usernames of service accounts, e.g. "spiffe://geant.org/ci=ci-bot".
+	MTLSAddr         string   `yaml:"mtls_addr" env:"MTLS_ADDR"`
+	MTLSCertFile     string   `yaml:"mtls_cert_file" env:"MTLS_CERT_FILE"`
+	MTLSKeyFile      string   `yaml:"mtls_key_file" env:"MTLS_KEY_FILE"`
+	MTLSClientCAFile string   `yaml:"mtls_client_ca_file" env:"MTLS_CLIENT_CA_FILE"`
+	MTLSClientAuth   string   `yaml:"mtls_client_auth" env:"MTLS_CLIENT_AUTH"`
+	GRPCClientAuth   string   `yaml:"grpc_client_auth" env:"GRPC_CLIENT_AUTH"`
+	MTLSAccounts     []string `yaml:"mtls_accounts" env:"MTLS_ACCOUNTS"`
+
+	// Number of workers running background jobs from the job queue
+	JobWorkers int `yaml:"job_workers" env:"JOB_WORKERS"`
+
+	// Shutdown: how long /readyz reports draining before the listener is
+	// closed, so that load balancers stop sending requests, and how long
+	// in-flight requests, running jobs and pending deliveries then have to
+	// finish. ListenReusePort opens the port with SO_REUSEPORT, so that a new
+	// process can bind it before the old one exits; a socket passed by
+	// systemd socket activation is used instead when present.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	ListenReusePort bool          `yaml:"listen_reuse_port" env:"LISTEN_REUSE_PORT"`
+
+	// Time limit of a single database call; 0 disables it
+	DBQueryTimeout time.Duration `yaml:"db_query_timeout" env:"DB_QUERY_TIMEOUT"`
+
+	// Commit IDs accepted in URLs and APIs: a regular expression and a length range
+	CommitIDPattern   string `yaml:"commit_id_pattern" env:"COMMIT_ID_PATTERN"`
+	CommitIDMinLength int    `yaml:"commit_id_min_length" env:"COMMIT_ID_MIN_LENGTH"`
+	CommitIDMaxLength int    `yaml:"commit_id_max_length" env:"COMMIT_ID_MAX_LENGTH"`
+
+	// Cache-Control policies of badge and certificate images by endpoint and
+	// status, e.g. "badge:valid=public, max-age=3600;*:preview=no-store";
+	// unset keeps the defaults
+	ImageCacheControl string `yaml:"image_cache_control" env:"IMAGE_CACHE_CONTROL"`
+
+	// CDN purge API called when badges change: cloudflare or fastly, the API
+	// endpoint and its token; an unset provider disables purging
+	CDNProvider      string `yaml:"cdn_provider" env:"CDN_PROVIDER"`
+	CDNPurgeEndpoint string `yaml:"cdn_purge_endpoint" env:"CDN_PURGE_ENDPOINT"`
+	CDNPurgeToken    string `yaml:"cdn_purge_token" env:"CDN_PURGE_TOKEN" secret:"true"`
+
+	// SMTP relay (host:port) emailing notifications, e.g. API key expiry
+	// warnings, from SMTPFrom; unset sends no email
+	SMTPAddr     string `yaml:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom     string `yaml:"smtp_from" env:"SMTP_FROM"`
+
+	// Secret signing outgoing webhooks, e.g. API key expiry warnings, with
+	// the X-Badges-Signature header of pkg/webhooksig; unset leaves them
+	// unsigned
+	WebhookSecret string `yaml:"webhook_secret" env:"WEBHOOK_SECRET" secret:"true"`
+
+	// Badge request statistics: whether they are recorded, whether the
+	// referrer of requests sending DNT or Sec-GPC is left out, and the age in
+	// days after which daily counts are merged per month (0 keeps them)
+	AnalyticsEnabled        bool `yaml:"analytics_enabled" env:"ANALYTICS_ENABLED"`
+	AnalyticsHonorDNT       bool `yaml:"analytics_honor_dnt" env:"ANALYTICS_HONOR_DNT"`
+	AnalyticsAggregateAfter int  `yaml:"analytics_aggregate_after_days" env:"ANALYTICS_AGGREGATE_AFTER_DAYS"`
+
+	// How much of client IP addresses is logged: full, truncated or off
+	ClientIPLogging string `yaml:"client_ip_logging" env:"CLIENT_IP_LOGGING"`
+
+	// Reverse proxies, as IP addresses or CIDR ranges, whose X-Forwarded-For
+	// header names the client for API key IP restrictions, login throttling
+	// and sessions; without any the header is ignored
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	// Time limits of request handling by route group (images, api, transfer
+	// or pages), e.g. "images=5s,api=30s"; 0 disables a group's limit and
+	// unset groups keep the defaults. Requests slower than
+	// SlowRequestThreshold are logged as warnings; 0 disables it.
+	RouteTimeouts        string        `yaml:"route_timeouts" env:"ROUTE_TIMEOUTS"`
+	SlowRequestThreshold time.Duration `yaml:"slow_request_threshold" env:"SLOW_REQUEST_THRESHOLD"`
+
+	// How long rendered images are kept after they expire from the cache, to
+	// be served while the database is unavailable; 0 disables it
+	StaleImageRetention time.Duration `yaml:"stale_image_retention" env:"STALE_IMAGE_RETENTION"`
+
+	// pprof and runtime statistics: mounted under /debug/ for administrators,
+	// and/or served without authentication on a loopback address
+	DebugEndpoints bool   `yaml:"debug_endpoints" env:"DEBUG_ENDPOINTS"`
+	DebugAddr      string `yaml:"debug_addr" env:"DEBUG_ADDR"`
+
+	// Access log sink (stdout, stderr or a file path; unset keeps Debug
+	// entries in the application log), its format (json or combined), the
+	// share of successful image requests logged, and the size in megabytes
+	// at which a file is rotated with the number of old files kept
+	AccessLog           string  `yaml:"access_log" env:"ACCESS_LOG"`
+	AccessLogFormat     string  `yaml:"access_log_format" env:"ACCESS_LOG_FORMAT"`
+	AccessLogSample     float64 `yaml:"access_log_sample" env:"ACCESS_LOG_SAMPLE"`
+	AccessLogMaxSize    int     `yaml:"access_log_max_size" env:"ACCESS_LOG_MAX_SIZE"`
+	AccessLogMaxBackups int     `yaml:"access_log_max_backups" env:"ACCESS_LOG_MAX_BACKUPS"`
+
+	// Session cookie attributes: Secure (auto sets it on requests received
+	// over TLS, directly or through a proxy), Domain and SameSite (lax,
+	// strict or none). Browser sessions end after SessionIdleTimeout without
+	// requests, and SessionMaxAge after login however active they are.
+	CookieSecure       string        `yaml:"cookie_secure" env:"COOKIE_SECURE"`
+	CookieDomain       string        `yaml:"cookie_domain" env:"COOKIE_DOMAIN"`
+	CookieSameSite     string        `yaml:"cookie_same_site" env:"COOKIE_SAME_SITE"`
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout" env:"SESSION_IDLE_TIMEOUT"`
+	SessionMaxAge      time.Duration `yaml:"session_max_age" env:"SESSION_MAX_AGE"`
+
+	// Monthly request quota of API keys created without one; 0 is unlimited.
+	// Only callers allowed users:write may grant keys more.
+	APIKeyMonthlyQuota int64 `yaml:"api_key_monthly_quota" env:"API_KEY_MONTHLY_QUOTA"`
+
+	// How long the resolved permissions of a role are cached. Edits through
+	// this process apply at once; other processes on the database pick them
+	// up within this time. 0 resolves them on every request.
+	PermissionCacheTTL time.Duration `yaml:"permission_cache_ttl" env:"PERMISSION_CACHE_TTL"`
+
+	// How long the tokens issued to OAuth2 clients by /oauth/token are valid
+	OAuthTokenTTL time.Duration `yaml:"oauth_token_ttl" env:"OAUTH_TOKEN_TTL"`
+
+	// Login throttling: failed logins allowed for a username and from a
+	// client address before further attempts back off exponentially up to
+	// LoginThrottleMaxDelay, failures from an address that ban it for
+	// LoginBanDuration, and failures after which a CAPTCHA is verified with
+	// LoginCaptchaVerifyURL. LoginLockoutAttempts failures in a row lock the
+	// account. A count of 0 disables its measure.
+	LoginThrottleUserAttempts int           `yaml:"login_throttle_user_attempts" env:"LOGIN_THROTTLE_USER_ATTEMPTS"`
+	LoginThrottleIPAttempts   int           `yaml:"login_throttle_ip_attempts" env:"LOGIN_THROTTLE_IP_ATTEMPTS"`
+	LoginThrottleMaxDelay     time.Duration `yaml:"login_throttle_max_delay" env:"LOGIN_THROTTLE_MAX_DELAY"`
+	LoginBanAttempts          int           `yaml:"login_ban_attempts" env:"LOGIN_BAN_ATTEMPTS"`
+	LoginBanDuration          time.Duration `yaml:"login_ban_duration" env:"LOGIN_BAN_DURATION"`
+	LoginCaptchaAttempts      int           `yaml:"login_captcha_attempts" env:"LOGIN_CAPTCHA_ATTEMPTS"`
+	LoginCaptchaVerifyURL     string        `yaml:"login_captcha_verify_url" env:"LOGIN_CAPTCHA_VERIFY_URL"`
+	LoginCaptchaSecret        string        `yaml:"login_captcha_secret" env:"LOGIN_CAPTCHA_SECRET" secret:"true"`
+	LoginLockoutAttempts      int           `yaml:"login_lockout_attempts" env:"LOGIN_LOCKOUT_ATTEMPTS"`
+
+	// Badge fields hidden from public views, by their details JSON names,
+	// e.g. contact_details,repositories; viewers with a badges permission
+	// still see them
+	RedactFields []string `yaml:"redact_fields" env:"REDACT_FIELDS"`
+
+	// Rendering query parameters, such as theme or color_left, honored in
+	// public badge and certificate images unless a badge sets its own
+	// public_overrides; none honors none
+	PublicOverrides []string `yaml:"public_overrides" env:"PUBLIC_OVERRIDES"`
+
+	// Key signing image URLs that honor every rendering parameter; unset
+	// disables signed URLs
+	ImageURLSecret string `yaml:"image_url_secret" env:"IMAGE_URL_SECRET" secret:"true"`
+
+	// Renders, each of which may run an external converter, allowed at once
+	// (0 removes the limit), and how long a request waits for a free slot
+	// before it is answered with 503
+	RenderConcurrency  int           `yaml:"render_concurrency" env:"RENDER_CONCURRENCY"`
+	RenderQueueTimeout time.Duration `yaml:"render_queue_timeout" env:"RENDER_QUEUE_TIMEOUT"`
+
+	// External converters such as rsvg-convert: how long one may run, how
+	// many bytes it may write, and how many may run at once (0 for no limit)
+	ConverterTimeout   time.Duration `yaml:"converter_timeout" env:"CONVERTER_TIMEOUT"`
+	ConverterMaxOutput int64         `yaml:"converter_max_output" env:"CONVERTER_MAX_OUTPUT"`
+	ConverterWorkers   int           `yaml:"converter_workers" env:"CONVERTER_WORKERS"`
+
+	// Files secret settings were read from through <ENV>_FILE variables, by
+	// environment variable name, so that they can be reloaded when they rotate
+	SecretFiles map[string]string `yaml:"-"`
 }
 
-// Load loads configuration from environment variables
+// Redacted replaces the value of secret settings when printing them
+const Redacted = "[REDACTED]"
+
+// defaults returns the configuration used for unset settings
+func defaults() *Config {
+	return &Config{
+		Port:                      80,
+		LogLevel:                  "development",
+		DatabasePath:              "./db/badges.db",
+		BlobStore:                 "db",
+		BlobStorePath:             "./db/blobs",
+		SeedDataPath:              "db/initial_badges.json",
+		SigningKeyFile:            "./db/signing.key",
+		DBQueryTimeout:            10 * time.Second,
+		CommitIDPattern:           commitid.DefaultPattern,
+		CommitIDMinLength:         commitid.DefaultMinLength,
+		CommitIDMaxLength:         commitid.DefaultMaxLength,
+		AnalyticsEnabled:          true,
+		AnalyticsHonorDNT:         true,
+		StaleImageRetention:       time.Hour,
+		SlowRequestThreshold:      2 * time.Second,
+		AccessLogSample:           1,
+		AccessLogMaxSize:          100,
+		AccessLogMaxBackups:       5,
+		CookieSecure:              "auto",
+		CookieSameSite:            "lax",
+		SessionIdleTimeout:        15 * time.Minute,
+		SessionMaxAge:             12 * time.Hour,
+		PermissionCacheTTL:        30 * time.Second,
+		OAuthTokenTTL:             15 * time.Minute,
+		LoginThrottleUserAttempts: 3,
+		LoginThrottleIPAttempts:   10,
+		LoginThrottleMaxDelay:     15 * time.Minute,
+		LoginBanAttempts:          50,
+		LoginBanDuration:          time.Hour,
+		LoginCaptchaAttempts:      3,
+		LoginLockoutAttempts:      0,
+		JobWorkers:                2,
+		MTLSClientAuth:            "require",
+		ShutdownTimeout:           15 * time.Second,
+		PublicOverrides:           overrides.Default,
+		RenderConcurrency:         8,
+		RenderQueueTimeout:        5 * time.Second,
+		ConverterTimeout:          utils.DefaultConverterLimits.Timeout,
+		ConverterMaxOutput:        utils.DefaultConverterLimits.MaxOutput,
+	}
+}
+
+// Load loads configuration from the YAML file named by CONFIG_FILE, if any,
+// and environment variables
 func Load() (*Config, error) {
-	cfg := &Config{
-		// Default values
-		Port:         80,
-		LogLevel:     "development",
-		DatabasePath: "./db/badges.db",
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadFile loads configuration from a YAML file, unless path is empty, then
+// from environment variables, which override the file. Unknown keys,
+// malformed values and invalid settings are all reported in the error.
+func LoadFile(path string) (*Config, error) {
+	cfg := defaults()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
 	}
 
-	// Override with environment variables if they exist
-	if port := os.Getenv("PORT"); port != "" {
-		p, err := strconv.Atoi(port)
-		if err == nil {
-			cfg.Port = p
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile sets the settings present in a YAML file
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv sets the settings whose environment variable is set and not
+// empty. Secret settings may instead be read from the file named by
+// <ENV>_FILE, such as a Docker or Kubernetes secret; list entries are then
+// separated by commas or lines.
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, _ := lookup(name)
+		if path, _ := lookup(name + "_FILE"); path != "" && field.Tag.Get("secret") == "true" {
+			if value != "" {
+				errs = append(errs, fmt.Errorf("%s and %s_FILE are both set", name, name))
+				continue
+			}
+			secret, err := secrets.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s_FILE: %w", name, err))
+				continue
+			}
+			if c.SecretFiles == nil {
+				c.SecretFiles = map[string]string{}
+			}
+			c.SecretFiles[name] = path
+			if err := setField(v.Field(i), strings.ReplaceAll(secret, "\n", ",")); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s_FILE: %w", name, err))
+			}
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
 		}
 	}
+	return errors.Join(errs...)
+}
 
-	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
-		cfg.LogLevel = logLevel
+// setField parses an environment variable into a setting; lists are
+// comma-separated
+func setField(f reflect.Value, value string) error {
+	switch f.Interface().(type) {
+	case string:
+		f.SetString(value)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		f.SetBool(b)
+	case int, int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("expected an integer")
+		}
+		f.SetInt(n)
+	case float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		f.SetFloat(n)
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("expected a duration such as 30s or 1h")
+		}
+		f.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.Type())
 	}
+	return nil
+}
 
-	if dbPath := os.Getenv("DB_PATH"); dbPath != "" {
-		cfg.DatabasePath = dbPath
+// Validate reports every invalid setting, named after its environment variable
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	return cfg, nil
+	check(c.Port > 0 && c.Port <= 65535, "invalid PORT %d: expected 1 to 65535", c.Port)
+	check(c.GRPCPort >= 0 && c.GRPCPort <= 65535, "invalid GRPC_PORT %d: expected 0 to 65535", c.GRPCPort)
+	if c.MTLSAddr != "" || c.GRPCClientAuth != "" {
+		check(c.MTLSCertFile != "" && c.MTLSKeyFile != "" && c.MTLSClientCAFile != "",
+			"mutual TLS requires MTLS_CERT_FILE, MTLS_KEY_FILE and MTLS_CLIENT_CA_FILE")
+	}
+	if c.MTLSAddr != "" {
+		_, _, err := net.SplitHostPort(c.MTLSAddr)
+		check(err == nil, "invalid MTLS_ADDR %q: expected [host]:port", c.MTLSAddr)
+		check(c.MTLSClientAuth == "require" || c.MTLSClientAuth == "optional",
+			"invalid MTLS_CLIENT_AUTH %q: expected require or optional", c.MTLSClientAuth)
+	}
+	check(c.GRPCClientAuth == "" || c.GRPCClientAuth == "require" || c.GRPCClientAuth == "optional",
+		"invalid GRPC_CLIENT_AUTH %q: expected require, optional or unset", c.GRPCClientAuth)
+	check(c.GRPCClientAuth == "" || c.GRPCPort != 0, "GRPC_CLIENT_AUTH requires GRPC_PORT")
+	check(c.JobWorkers >= 1, "invalid JOB_WORKERS %d: must be at least 1", c.JobWorkers)
+	check(c.ShutdownDelay >= 0, "invalid SHUTDOWN_DELAY %s: must not be negative", c.ShutdownDelay)
+	check(c.ShutdownTimeout > 0, "invalid SHUTDOWN_TIMEOUT %s: must be positive", c.ShutdownTimeout)
+	check(c.LogLevel == "development" || c.LogLevel == "production",
+		"invalid LOG_LEVEL %q: expected development or production", c.LogLevel)
+	if c.BaseURL != "" {
+		if _, err := links.Parse(c.BaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("invalid BASE_URL %q: %w", c.BaseURL, err))
+		}
+	}
+	if prefix, err := links.ParsePrefix(c.PathPrefix); err != nil {
+		errs = append(errs, fmt.Errorf("invalid PATH_PREFIX %q: %w", c.PathPrefix, err))
+	} else if prefix != "" && c.BaseURL != "" {
+		// The path of BASE_URL is the prefix when PATH_PREFIX is unset
+		if u, err := url.Parse(c.BaseURL); err == nil {
+			basePath := strings.TrimRight(u.Path, "/")
+			check(basePath == "" || basePath == prefix, "invalid PATH_PREFIX %q: BASE_URL is served below %s", c.PathPrefix, basePath)
+		}
+	}
+
+	switch c.BlobStore {
+	case "", "db", "fs":
+	case "s3":
+		check(c.S3Bucket != "", "S3_BUCKET is required with BLOB_STORE=s3")
+	default:
+		check(false, "invalid BLOB_STORE %q: expected db, fs or s3", c.BlobStore)
+	}
+
+	check(c.LogoMaxSize >= 0, "invalid LOGO_MAX_SIZE %d: must not be negative", c.LogoMaxSize)
+	check(c.DBQueryTimeout >= 0, "invalid DB_QUERY_TIMEOUT %s: must not be negative", c.DBQueryTimeout)
+	check(c.StaleImageRetention >= 0, "invalid STALE_IMAGE_RETENTION %s: must not be negative", c.StaleImageRetention)
+	check(c.SlowRequestThreshold >= 0, "invalid SLOW_REQUEST_THRESHOLD %s: must not be negative", c.SlowRequestThreshold)
+	check(c.RenderConcurrency >= 0, "invalid RENDER_CONCURRENCY %d: must not be negative", c.RenderConcurrency)
+	check(c.RenderQueueTimeout >= 0, "invalid RENDER_QUEUE_TIMEOUT %s: must not be negative", c.RenderQueueTimeout)
+	check(c.ConverterTimeout > 0, "invalid CONVERTER_TIMEOUT %s: must be positive", c.ConverterTimeout)
+	check(c.ConverterMaxOutput > 0, "invalid CONVERTER_MAX_OUTPUT %d: must be positive", c.ConverterMaxOutput)
+	check(c.ConverterWorkers >= 0, "invalid CONVERTER_WORKERS %d: must not be negative", c.ConverterWorkers)
+	if _, err := commitid.NewPolicy(c.CommitIDPattern, c.CommitIDMinLength, c.CommitIDMaxLength); err != nil {
+		errs = append(errs, fmt.Errorf("invalid COMMIT_ID_PATTERN, COMMIT_ID_MIN_LENGTH or COMMIT_ID_MAX_LENGTH: %w", err))
+	}
+	if _, err := overrides.NewPolicy(c.PublicOverrides); err != nil {
+		errs = append(errs, fmt.Errorf("invalid PUBLIC_OVERRIDES: %w", err))
+	}
+	if _, err := redact.NewPolicy(c.RedactFields); err != nil {
+		errs = append(errs, fmt.Errorf("invalid REDACT_FIELDS: %w", err))
+	}
+
+	if c.SMTPAddr != "" {
+		_, _, err := net.SplitHostPort(c.SMTPAddr)
+		check(err == nil, "invalid SMTP_ADDR %q: expected host:port", c.SMTPAddr)
+		check(c.SMTPFrom != "", "SMTP_ADDR requires SMTP_FROM")
+	}
+
+	switch c.CDNProvider {
+	case "", "cloudflare", "fastly":
+	default:
+		check(false, "invalid CDN_PROVIDER %q: expected cloudflare or fastly", c.CDNProvider)
+	}
+
+	check(c.AnalyticsAggregateAfter >= 0,
+		"invalid ANALYTICS_AGGREGATE_AFTER_DAYS %d: must not be negative", c.AnalyticsAggregateAfter)
+	check(c.AccessLogSample >= 0 && c.AccessLogSample <= 1,
+		"invalid ACCESS_LOG_SAMPLE %g: expected 0 to 1", c.AccessLogSample)
+	check(c.AccessLogMaxSize >= 0, "invalid ACCESS_LOG_MAX_SIZE %d: must not be negative", c.AccessLogMaxSize)
+	check(c.AccessLogMaxBackups >= 0, "invalid ACCESS_LOG_MAX_BACKUPS %d: must not be negative", c.AccessLogMaxBackups)
+
+	switch c.CookieSecure {
+	case "auto", "true", "false":
+	default:
+		check(false, "invalid COOKIE_SECURE %q: expected auto, true or false", c.CookieSecure)
+	}
+	switch c.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		check(c.CookieSecure != "false", "COOKIE_SAME_SITE=none requires secure cookies: browsers reject it with COOKIE_SECURE=false")
+	default:
+		check(false, "invalid COOKIE_SAME_SITE %q: expected lax, strict or none", c.CookieSameSite)
+	}
+	check(c.SessionIdleTimeout > 0, "invalid SESSION_IDLE_TIMEOUT %s: must be positive", c.SessionIdleTimeout)
+	check(c.SessionMaxAge >= c.SessionIdleTimeout,
+		"invalid SESSION_MAX_AGE %s: must not be shorter than SESSION_IDLE_TIMEOUT", c.SessionMaxAge)
+	check(c.PermissionCacheTTL >= 0, "invalid PERMISSION_CACHE_TTL %s: must not be negative", c.PermissionCacheTTL)
+	check(c.OAuthTokenTTL > 0 && c.OAuthTokenTTL <= 24*time.Hour, "invalid OAUTH_TOKEN_TTL %s: must be positive and at most 24h", c.OAuthTokenTTL)
+	check(c.APIKeyMonthlyQuota >= 0, "invalid API_KEY_MONTHLY_QUOTA %d: must not be negative", c.APIKeyMonthlyQuota)
+
+	check(c.LoginThrottleUserAttempts >= 0, "invalid LOGIN_THROTTLE_USER_ATTEMPTS %d: must not be negative", c.LoginThrottleUserAttempts)
+	check(c.LoginThrottleIPAttempts >= 0, "invalid LOGIN_THROTTLE_IP_ATTEMPTS %d: must not be negative", c.LoginThrottleIPAttempts)
+	check(c.LoginThrottleMaxDelay > 0, "invalid LOGIN_THROTTLE_MAX_DELAY %s: must be positive", c.LoginThrottleMaxDelay)
+	check(c.LoginBanAttempts >= 0, "invalid LOGIN_BAN_ATTEMPTS %d: must not be negative", c.LoginBanAttempts)
+	check(c.LoginBanAttempts == 0 || c.LoginBanDuration > 0, "invalid LOGIN_BAN_DURATION %s: must be positive", c.LoginBanDuration)
+	check(c.LoginCaptchaAttempts >= 0, "invalid LOGIN_CAPTCHA_ATTEMPTS %d: must not be negative", c.LoginCaptchaAttempts)
+	check(c.LoginCaptchaVerifyURL == "" || c.LoginCaptchaSecret != "", "LOGIN_CAPTCHA_VERIFY_URL requires LOGIN_CAPTCHA_SECRET")
+	check(c.LoginLockoutAttempts >= 0, "invalid LOGIN_LOCKOUT_ATTEMPTS %d: must not be negative", c.LoginLockoutAttempts)
+
+	return errors.Join(errs...)
+}
+
+// WriteRedacted writes the configuration as YAML, in the format of config
+// files, with the values of secret settings replaced by Redacted. The
+// [type:]host=token entries of FORGE_TOKENS keep their host.
+func (c *Config) WriteRedacted(w io.Writer) error {
+	redacted := *c
+	v := reflect.ValueOf(&redacted).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") != "true" {
+			continue
+		}
+		switch f := v.Field(i); value := f.Interface().(type) {
+		case string:
+			if value != "" {
+				f.SetString(Redacted)
+			}
+		case []string:
+			list := make([]string, len(value))
+			for j, item := range value {
+				if host, _, ok := strings.Cut(item, "="); ok {
+					list[j] = host + "=" + Redacted
+				} else {
+					list[j] = Redacted
+				}
+			}
+			f.Set(reflect.ValueOf(list))
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&redacted); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return enc.Close()
 }
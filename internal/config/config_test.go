@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeFile(t, `
+port: 9000
+log_level: production
+db_query_timeout: 30s
+logo_allowed_hosts: [example.org, cdn.example.org]
+access_log_sample: 0.5
+`)
+	t.Setenv("PORT", "9100")
+	t.Setenv("DB_PATH", "")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Port != 9100 {
+		t.Errorf("expected the environment to override the file, got port %d", cfg.Port)
+	}
+	if cfg.LogLevel != "production" || cfg.DBQueryTimeout != 30*time.Second || cfg.AccessLogSample != 0.5 {
+		t.Errorf("file settings not applied: %+v", cfg)
+	}
+	if strings.Join(cfg.LogoAllowedHosts, ",") != "example.org,cdn.example.org" {
+		t.Errorf("unexpected logo hosts %v", cfg.LogoAllowedHosts)
+	}
+	if cfg.DatabasePath != "./db/badges.db" || cfg.AccessLogMaxBackups != 5 {
+		t.Errorf("expected defaults for unset and empty settings, got %q %d", cfg.DatabasePath, cfg.AccessLogMaxBackups)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{"unknown key", "prot: 80\n", nil, []string{"field prot not found"}},
+		{"file type", "port: eighty\n", nil, []string{"cannot unmarshal"}},
+		{"env values", "", map[string]string{"PORT": "eighty", "SEED_DATA": "maybe", "DB_QUERY_TIMEOUT": "10"},
+			[]string{`invalid PORT "eighty"`, `invalid SEED_DATA "maybe"`, `invalid DB_QUERY_TIMEOUT "10"`}},
+		{"ranges", "", map[string]string{"ACCESS_LOG_SAMPLE": "2", "GRPC_PORT": "-1", "LOG_LEVEL": "debug"},
+			[]string{"ACCESS_LOG_SAMPLE", "GRPC_PORT", "LOG_LEVEL"}},
+		{"s3", "blob_store: s3\n", nil, []string{"S3_BUCKET is required"}},
+		{"cookies", "cookie_same_site: none\ncookie_secure: \"false\"\nsession_max_age: 1m\n", nil,
+			[]string{"COOKIE_SAME_SITE=none requires secure cookies", "SESSION_MAX_AGE"}},
+		{"commit IDs", "commit_id_min_length: 50\n", nil, []string{"invalid commit ID length range"}},
+		{"base URL", "base_url: certificates.example.org\n", nil, []string{`invalid BASE_URL "certificates.example.org"`}},
+		{"path prefix", "base_url: https://example.org/certificates\npath_prefix: /badges\n", nil, []string{`invalid PATH_PREFIX "/badges": BASE_URL is served below /certificates`}},
+		{"public overrides", "", map[string]string{"PUBLIC_OVERRIDES": "theme,ids"}, []string{`invalid PUBLIC_OVERRIDES: unknown parameter "ids"`}},
+		{"render concurrency", "", map[string]string{"RENDER_CONCURRENCY": "-1"}, []string{"invalid RENDER_CONCURRENCY -1: must not be negative"}},
+		{"converter limits", "", map[string]string{"CONVERTER_TIMEOUT": "0s", "CONVERTER_WORKERS": "-2"},
+			[]string{"invalid CONVERTER_TIMEOUT 0s: must be positive", "invalid CONVERTER_WORKERS -2: must not be negative"}},
+		{"redacted fields", "", map[string]string{"REDACT_FIELDS": "contact_details,email"}, []string{`invalid REDACT_FIELDS: unknown field "email"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tc.file != "" {
+				path = writeFile(t, tc.file)
+			}
+			_, err := LoadFile(path)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in %q", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "jwt"), []byte("jwt-secret\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "forge"), []byte("github.com=a\ngitlab.com=b\n"), 0600)
+	t.Setenv("JWT_SECRET_FILE", filepath.Join(dir, "jwt"))
+	t.Setenv("FORGE_TOKENS_FILE", filepath.Join(dir, "forge"))
+
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.JWTSecret != "jwt-secret" || strings.Join(cfg.ForgeTokens, ",") != "github.com=a,gitlab.com=b" {
+		t.Errorf("secrets not read from files: %q %v", cfg.JWTSecret, cfg.ForgeTokens)
+	}
+	if cfg.SecretFiles["JWT_SECRET"] != filepath.Join(dir, "jwt") {
+		t.Errorf("expected the JWT secret file to be recorded, got %v", cfg.SecretFiles)
+	}
+
+	t.Setenv("JWT_SECRET", "from-env")
+	t.Setenv("S3_SECRET_KEY_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("PORT_FILE", filepath.Join(dir, "missing"))
+	_, err = LoadFile("")
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET and JWT_SECRET_FILE are both set") ||
+		!strings.Contains(err.Error(), "invalid S3_SECRET_KEY_FILE") || strings.Contains(err.Error(), "PORT_FILE") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestWriteRedacted(t *testing.T) {
+	cfg := defaults()
+	cfg.S3AccessKey = "AKIA123"
+	cfg.S3SecretKey = "s3-secret"
+	cfg.CDNPurgeToken = "cdn-secret"
+	cfg.ForgeTokens = []string{"github:github.com=forge-secret", "bare-secret"}
+
+	var buf bytes.Buffer
+	if err := cfg.WriteRedacted(&buf); err != nil {
+		t.Fatalf("WriteRedacted: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"s3-secret", "cdn-secret", "forge-secret", "bare-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %s printed:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"s3_access_key: AKIA123", "github:github.com=[REDACTED]", "db_query_timeout: 10s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if cfg.S3SecretKey != "s3-secret" {
+		t.Error("WriteRedacted modified the configuration")
+	}
+
+	// The output is a valid config file
+	if _, err := LoadFile(writeFile(t, out)); err != nil {
+		t.Errorf("printed configuration does not load: %v", err)
+	}
+}
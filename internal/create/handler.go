@@ -1,11 +1,15 @@
 package create
 
 import (
+    "database/sql"
     "net/http"
     "time"
 
+    "github.com/finki/badges/internal/auth"
     "github.com/finki/badges/internal/cache"
+    "github.com/finki/badges/internal/commitid"
     "github.com/finki/badges/internal/database"
+    "github.com/finki/badges/internal/theme"
     "go.uber.org/zap"
 )
 
@@ -23,6 +27,8 @@ func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handle
 // ServeHTTP only supports POST; expects form value "commit_id".
 // On success creates the badge with minimal defaults and redirects to /edit/{commit_id}.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    db := h.db.WithContext(r.Context())
+
     if r.Method != http.MethodPost {
         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
         return
@@ -34,31 +40,62 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "commit_id is required", http.StatusBadRequest)
         return
     }
+    if !commitid.Valid(commitID) {
+        http.Error(w, "Invalid commit ID", http.StatusBadRequest)
+        return
+    }
 
-    // If it already exists, just redirect to edit
-    if existing, err := h.db.GetBadge(commitID); err == nil && existing != nil {
+    // If it already exists, just redirect to edit, which hides the badges of
+    // other organizations
+    if existing, err := db.GetBadge(commitID); err == nil && existing != nil {
         http.Redirect(w, r, "/edit/"+commitID, http.StatusSeeOther)
         return
     }
 
     // Create with minimal defaults to satisfy NOT NULL columns
-    today := time.Now().Format("2006-01-02")
+    today := database.Day(time.Now())
     badge := &database.Badge{
         CommitID:        commitID,
         Type:            "badge",
         Status:          "draft",
-        Issuer:          "Unknown",
+        Issuer:          theme.Get().Issuer,
         IssueDate:       today,
-        SoftwareName:    "New Certificate",
+        SoftwareName:    database.PlaceholderSoftwareName,
         SoftwareVersion: "0.0.0",
     }
+    // Badges created by organization admins belong to their organization
+    if org := auth.GetOrgIDFromContext(r.Context()); org != "" {
+        badge.OrgID = sql.NullString{String: org, Valid: true}
+    }
 
-    if err := h.db.CreateBadge(badge); err != nil {
+    // Badge types granted to groups can only be issued by their members
+    allowed, err := db.UserHasAccessToBadgeType(auth.GetUserIDFromContext(r.Context()), badge.AccessType())
+    if err != nil {
+        h.logger.Error("failed to check badge type access", zap.String("commit_id", commitID), zap.Error(err))
+        http.Error(w, "Failed to create certificate", http.StatusInternalServerError)
+        return
+    }
+    if !allowed {
+        http.Error(w, "Not authorized for badge type "+badge.Type, http.StatusForbidden)
+        return
+    }
+
+    // Checked again with the insert in case of a concurrent create
+    err = db.WithTx(func(tx *database.DB) error {
+        existing, err := tx.GetBadge(commitID)
+        if err != nil || existing != nil {
+            return err
+        }
+        return tx.CreateBadge(badge)
+    })
+    if err != nil {
         h.logger.Error("failed to create badge", zap.String("commit_id", commitID), zap.Error(err))
         http.Error(w, "Failed to create certificate", http.StatusInternalServerError)
         return
     }
 
+    h.cache.DeletePrefix("badges:list:")
+
     // Redirect to edit page
     http.Redirect(w, r, "/edit/"+commitID, http.StatusSeeOther)
 }
@@ -0,0 +1,266 @@
+package create
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/theme"
+	"github.com/finki/badges/internal/validation"
+	"go.uber.org/zap"
+)
+
+// formFields are the badge fields of the creation form, in badgeapi.Badge
+// JSON names
+var formFields = []string{
+	"type", "status", "issuer", "issue_date", "expiry_date", "software_name",
+	"software_version", "software_url", "issuer_url", "certificate_name",
+	"specialty_domain", "covered_version", "custom_config", "public_note",
+	"internal_note", "contact_details",
+}
+
+// Creator creates badges, e.g. *badgeapi.Handler
+type Creator interface {
+	Create(ctx context.Context, req *badgeapi.Badge) (*database.Badge, error)
+}
+
+// PageData is passed to the creation form template
+type PageData struct {
+	// Values are the submitted form values by field name, or the defaults
+	Values map[string]string
+	// Errors are the validation errors by field name
+	Errors map[string]string
+	// Error is an error not tied to a single field, such as a conflict
+	Error string
+}
+
+// PageHandler serves the badge creation form at /new, and the live preview
+// of the form at /new/preview
+type PageHandler struct {
+	creator     Creator
+	logger      *zap.Logger
+	template    *assets.Template
+	badges      *badge.Generator
+	certificate *certificate.Generator
+}
+
+// NewPageHandler creates the creation form handler; badges are created, and
+// the form validated, by creator
+func NewPageHandler(creator Creator, logger *zap.Logger) (*PageHandler, error) {
+	tmpl, err := assets.ParseTemplate("create/new.html")
+	if err != nil {
+		return nil, err
+	}
+	return &PageHandler{
+		creator:     creator,
+		logger:      logger,
+		template:    tmpl,
+		badges:      badge.NewGenerator(),
+		certificate: certificate.NewGenerator(),
+	}, nil
+}
+
+// SetLogoSource makes previews render the logo of the custom config
+func (h *PageHandler) SetLogoSource(src badge.LogoSource) {
+	h.badges.SetLogoSource(src)
+	h.certificate.SetLogoSource(src)
+}
+
+// ServeHTTP renders the form on GET and creates the badge on POST,
+// redirecting to its edit page. Unauthenticated visitors are redirected to
+// /admin, and users without badges:write are refused.
+func (h *PageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/new" && r.URL.Path != "/new/preview" {
+		http.NotFound(w, r)
+		return
+	}
+	if auth.GetClaimsFromContext(r.Context()) == nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	if !auth.HasPermission(r.Context(), "badges", "write") {
+		http.Error(w, "Permission denied for badges:write", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/new/preview" {
+		h.preview(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, http.StatusOK, &PageData{Values: defaultValues()})
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// create validates the submitted form and creates the badge, rendering the
+// form again with the errors if that fails
+func (h *PageHandler) create(w http.ResponseWriter, r *http.Request) {
+	data := &PageData{Values: formValues(r), Errors: validate(r)}
+	if len(data.Errors) > 0 {
+		h.render(w, http.StatusBadRequest, data)
+		return
+	}
+
+	b, err := h.creator.Create(r.Context(), formBadge(r))
+	var apiErr *badgeapi.Error
+	if errors.As(err, &apiErr) {
+		data.Error = apiErr.Message
+		for field, msg := range apiErr.Fields {
+			field, _, _ = strings.Cut(field, ".")
+			data.Errors[field] = msg
+		}
+		h.render(w, apiErr.Status, data)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to create badge", zap.Error(err))
+		data.Error = "Failed to create certificate"
+		h.render(w, http.StatusInternalServerError, data)
+		return
+	}
+
+	http.Redirect(w, r, "/edit/"+b.CommitID, http.StatusSeeOther)
+}
+
+// preview renders the submitted form as an SVG badge, or as a certificate
+// with outlook=certificate, without saving it
+func (h *PageHandler) preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b := formBadge(r).ToDatabase()
+	if b.CommitID == "" {
+		b.CommitID = "preview"
+	}
+
+	var svg []byte
+	var err error
+	if r.FormValue("outlook") == "certificate" {
+		svg, err = h.certificate.GenerateSVG(b)
+	} else {
+		svg, err = h.badges.GenerateSVG(b)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	// The preview shows user input; never run scripts it might contain
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox")
+	w.Write(svg)
+}
+
+// render writes the form with status
+func (h *PageHandler) render(w http.ResponseWriter, status int, data *PageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := h.template.Execute(w, data); err != nil {
+		h.logger.Error("Failed to render creation form", zap.Error(err))
+	}
+}
+
+// defaultValues are the initial values of the form, the same defaults used
+// for badges created without them
+func defaultValues() map[string]string {
+	return map[string]string{
+		"type":             "badge",
+		"status":           string(database.StatusDraft),
+		"issuer":           theme.Get().Issuer,
+		"issue_date":       time.Now().Format("2006-01-02"),
+		"software_version": "0.0.0",
+	}
+}
+
+// formValues returns the submitted form values by field name
+func formValues(r *http.Request) map[string]string {
+	values := map[string]string{"commit_id": strings.TrimSpace(r.FormValue("commit_id"))}
+	for _, field := range formFields {
+		values[field] = strings.TrimSpace(r.FormValue(field))
+	}
+	return values
+}
+
+// formBadge builds a create request from the non-empty form values; empty
+// fields get the defaults of badgeapi.Badge.ToDatabase
+func formBadge(r *http.Request) *badgeapi.Badge {
+	values := formValues(r)
+	value := func(field string) *string {
+		if v := values[field]; v != "" {
+			return &v
+		}
+		return nil
+	}
+	return &badgeapi.Badge{
+		CommitID:        values["commit_id"],
+		Type:            value("type"),
+		Status:          value("status"),
+		Issuer:          value("issuer"),
+		IssueDate:       value("issue_date"),
+		ExpiryDate:      value("expiry_date"),
+		SoftwareName:    value("software_name"),
+		SoftwareVersion: value("software_version"),
+		SoftwareURL:     value("software_url"),
+		IssuerURL:       value("issuer_url"),
+		CertificateName: value("certificate_name"),
+		SpecialtyDomain: value("specialty_domain"),
+		CoveredVersion:  value("covered_version"),
+		CustomConfig:    value("custom_config"),
+		PublicNote:      value("public_note"),
+		InternalNote:    value("internal_note"),
+		ContactDetails:  value("contact_details"),
+	}
+}
+
+// validate checks the form fields the badge API would otherwise silently
+// default, and the shared badge checks, returning the errors by field name.
+// Errors of custom config settings are reported on custom_config.
+func validate(r *http.Request) map[string]string {
+	values := formValues(r)
+	errs := map[string]string{}
+
+	switch id := values["commit_id"]; {
+	case id == "":
+		errs["commit_id"] = "Commit ID is required"
+	case !commitid.Valid(id):
+		errs["commit_id"] = "Invalid commit ID"
+	}
+	for field, label := range map[string]string{
+		"software_name":    "Software name",
+		"software_version": "Software version",
+		"issuer":           "Issuer",
+	} {
+		if values[field] == "" {
+			errs[field] = label + " is required"
+		}
+	}
+
+	// The badge the API would create, with its defaults, gets the checks
+	// every badge does; the required fields above are reported first
+	for field, msg := range validation.Badge(formBadge(r).ToDatabase()) {
+		field, _, _ = strings.Cut(field, ".")
+		if _, ok := errs[field]; !ok {
+			errs[field] = msg
+		}
+	}
+	return errs
+}
@@ -0,0 +1,165 @@
+package create
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func setupPageHandler(t *testing.T) (*PageHandler, *database.DB) {
+	t.Helper()
+	dbFile := "test_create_" + t.Name() + ".db"
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("failed to create test DB: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbFile)
+	})
+	h, err := NewPageHandler(badgeapi.NewHandler(db, logger, cache.New()), logger)
+	if err != nil {
+		t.Fatalf("NewPageHandler: %v", err)
+	}
+	return h, db
+}
+
+func writerContext() context.Context {
+	claims := &auth.Claims{UserID: "user-id", Username: "admin"}
+	claims.Permissions = database.Permissions{"badges": {"write": true}}
+	return auth.AddClaimsToContext(context.Background(), claims)
+}
+
+func post(h *PageHandler, ctx context.Context, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPageAccess(t *testing.T) {
+	h, _ := setupPageHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/new", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin" {
+		t.Errorf("expected a redirect to /admin, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	readOnly := auth.AddClaimsToContext(context.Background(), &auth.Claims{UserID: "reader"})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/new", nil).WithContext(readOnly))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without badges:write, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/new", nil).WithContext(writerContext()))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `name="commit_id"`) {
+		t.Errorf("expected the form, got %d", rec.Code)
+	}
+}
+
+func TestPageCreate(t *testing.T) {
+	h, db := setupPageHandler(t)
+	ctx := writerContext()
+	form := url.Values{
+		"commit_id":        {"form123456"},
+		"status":           {"valid"},
+		"issuer":           {"GÉANT"},
+		"issue_date":       {"2026-01-31"},
+		"expiry_date":      {"2027-01-31"},
+		"software_name":    {"Tool"},
+		"software_version": {"1.0.0"},
+		"custom_config":    {`{"color_right":"#34d399"}`},
+	}
+
+	rec := post(h, ctx, "/new", form)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/edit/form123456" {
+		t.Fatalf("expected a redirect to the edit page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	b, err := db.GetBadge("form123456")
+	if err != nil || b == nil {
+		t.Fatalf("badge not created: %v", err)
+	}
+	if b.SoftwareName != "Tool" || b.Status != "valid" || b.CustomConfig.String != `{"color_right":"#34d399"}` {
+		t.Errorf("unexpected badge %+v", b)
+	}
+
+	// A conflict renders the form again with the submitted values
+	rec = post(h, ctx, "/new", form)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "Badge already exists") ||
+		!strings.Contains(rec.Body.String(), `value="Tool"`) {
+		t.Errorf("expected the form with a conflict error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPageValidation(t *testing.T) {
+	h, db := setupPageHandler(t)
+	rec := post(h, writerContext(), "/new", url.Values{
+		"commit_id":     {"bad id!"},
+		"issuer":        {"GÉANT"},
+		"issue_date":    {"2026-01-31"},
+		"expiry_date":   {"2025-01-31"},
+		"custom_config": {"{not json"},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"Invalid commit ID",
+		"Software name is required",
+		"Expiry date must not be before the issue date",
+		"Custom config must be a JSON object",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the form", want)
+		}
+	}
+	if badges, err := db.ListBadges(); err != nil || len(badges) != 0 {
+		t.Errorf("expected no badge to be created, got %d (%v)", len(badges), err)
+	}
+}
+
+func TestPagePreview(t *testing.T) {
+	h, db := setupPageHandler(t)
+	form := url.Values{"software_name": {"Previewed"}, "custom_config": {`{"color_right":"#123456"}`}}
+
+	rec := post(h, writerContext(), "/new/preview", form)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("expected an SVG, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "#123456") {
+		t.Error("expected the preview to use the custom colors")
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected the preview not to be cached")
+	}
+
+	form.Set("outlook", "certificate")
+	rec = post(h, writerContext(), "/new/preview", form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<svg") {
+		t.Errorf("expected a certificate SVG, got %d", rec.Code)
+	}
+
+	form.Set("custom_config", "{not json")
+	if rec = post(h, writerContext(), "/new/preview", form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid custom config, got %d", rec.Code)
+	}
+	if badges, _ := db.ListBadges(); len(badges) != 0 {
+		t.Error("preview saved a badge")
+	}
+}
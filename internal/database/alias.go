@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CreateAlias registers an alternate ID for a badge. Aliases are unique
+// regardless of case.
+func (db *DB) CreateAlias(a *Alias) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO badge_aliases (alias, commit_id, created_by, created_at)
+		VALUES (?, ?, ?, ?)
+	`, a.Alias, a.CommitID, a.CreatedBy, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create alias: %w", err)
+	}
+
+	return nil
+}
+
+// ListAliases retrieves the aliases of a badge, oldest first
+func (db *DB) ListAliases(commitID string) ([]*Alias, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT alias, commit_id, created_by, created_at
+		FROM badge_aliases WHERE commit_id = ? ORDER BY created_at, alias
+	`, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []*Alias
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.Alias, &a.CommitID, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alias: %w", err)
+		}
+		aliases = append(aliases, &a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating aliases: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// DeleteAlias removes an alias of a badge and reports whether it existed
+func (db *DB) DeleteAlias(commitID, alias string) (bool, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	res, err := db.conn().ExecContext(ctx, "DELETE FROM badge_aliases WHERE commit_id = ? AND alias = ?", commitID, alias)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete alias: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete alias: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// ResolveBadgeID returns the commit ID of the badge id refers to other than by
+// its exact commit ID: through an alias, or by the commit ID in another case.
+// It returns "" if id refers to no badge.
+func (db *DB) ResolveBadgeID(id string) (string, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var commitID string
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT commit_id FROM badge_aliases WHERE alias = ?
+		UNION ALL
+		SELECT commit_id FROM badges WHERE commit_id = ? COLLATE NOCASE
+		LIMIT 1
+	`, id, id).Scan(&commitID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to resolve badge ID: %w", err)
+	}
+
+	return commitID, nil
+}
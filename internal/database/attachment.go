@@ -0,0 +1,196 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/finki/badges/internal/blobstore"
+	"go.uber.org/zap"
+)
+
+// CreateAttachment stores an attachment and sets its AttachmentID and
+// BlobKey. With a blob store configured the content is written there,
+// otherwise it is kept in the badge_attachments table.
+func (db *DB) CreateAttachment(a *Attachment, content []byte) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inline := content
+	if db.blobs != nil {
+		inline = nil
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO badge_attachments (commit_id, filename, content_type, size, content, uploaded_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, a.CommitID, a.Filename, a.ContentType, len(content), inline, a.UploadedBy, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	if a.AttachmentID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	a.Size = int64(len(content))
+
+	if db.blobs != nil {
+		key := blobstore.AttachmentKey(a.CommitID, a.AttachmentID)
+		if err := db.blobs.Put(key, content, a.ContentType); err != nil {
+			return fmt.Errorf("failed to store attachment: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE badge_attachments SET blob_key = ? WHERE attachment_id = ?", key, a.AttachmentID); err != nil {
+			db.deleteBlob(key)
+			return fmt.Errorf("failed to update attachment key: %w", err)
+		}
+		a.BlobKey = sql.NullString{String: key, Valid: true}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if a.BlobKey.Valid {
+			db.deleteBlob(a.BlobKey.String)
+		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetAttachment retrieves an attachment of a badge by ID, without its content
+func (db *DB) GetAttachment(commitID string, attachmentID int64) (*Attachment, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var a Attachment
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT attachment_id, commit_id, filename, content_type, size, blob_key, uploaded_by, created_at
+		FROM badge_attachments WHERE commit_id = ? AND attachment_id = ?
+	`, commitID, attachmentID).Scan(&a.AttachmentID, &a.CommitID, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.UploadedBy, &a.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	return &a, nil
+}
+
+// ListAttachments retrieves the attachments of a badge, oldest first
+func (db *DB) ListAttachments(commitID string) ([]*Attachment, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT attachment_id, commit_id, filename, content_type, size, blob_key, uploaded_by, created_at
+		FROM badge_attachments WHERE commit_id = ? ORDER BY attachment_id
+	`, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []*Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.AttachmentID, &a.CommitID, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.UploadedBy, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, &a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// GetAttachmentContent returns the content of an attachment, from the blob
+// store if it was stored there
+func (db *DB) GetAttachmentContent(a *Attachment) ([]byte, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	if !a.BlobKey.Valid {
+		var content []byte
+		err := db.conn().QueryRowContext(ctx, "SELECT content FROM badge_attachments WHERE attachment_id = ?", a.AttachmentID).Scan(&content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		return content, nil
+	}
+
+	if db.blobs == nil {
+		return nil, fmt.Errorf("attachment %d is in a blob store, but none is configured", a.AttachmentID)
+	}
+	content, err := db.blobs.Get(a.BlobKey.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return content, nil
+}
+
+// DeleteAttachment removes an attachment and its stored content, together
+// with the SBOM summary read from it
+func (db *DB) DeleteAttachment(a *Attachment) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM badge_sboms WHERE attachment_id = ?", a.AttachmentID); err != nil {
+		return fmt.Errorf("failed to delete SBOM: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM badge_attachments WHERE attachment_id = ?", a.AttachmentID); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if a.BlobKey.Valid {
+		db.afterCommit(func() { db.deleteBlob(a.BlobKey.String) })
+	}
+	return nil
+}
+
+// deleteAttachments removes every attachment of a badge
+func (db *DB) deleteAttachments(commitID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	attachments, err := db.ListAttachments(commitID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.conn().ExecContext(ctx, "DELETE FROM badge_attachments WHERE commit_id = ?", commitID); err != nil {
+		return fmt.Errorf("failed to delete badge attachments: %w", err)
+	}
+	for _, a := range attachments {
+		if a.BlobKey.Valid {
+			key := a.BlobKey.String
+			db.afterCommit(func() { db.deleteBlob(key) })
+		}
+	}
+	return nil
+}
+
+// deleteBlob removes a blob, logging rather than failing since the database
+// no longer refers to it
+func (db *DB) deleteBlob(key string) {
+	if db.blobs == nil {
+		return
+	}
+	if err := db.blobs.Delete(key); err != nil {
+		db.logger.Warn("Failed to delete blob from blob store", zap.String("key", key), zap.Error(err))
+	}
+}
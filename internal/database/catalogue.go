@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetCatalogueProject records the result of fetching a Software Catalogue project
+func (db *DB) SetCatalogueProject(p *CatalogueProject) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO catalogue_projects (sc_id, name, url, missing_since, checked_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (sc_id) DO UPDATE SET
+			name = excluded.name, url = excluded.url,
+			missing_since = excluded.missing_since, checked_at = excluded.checked_at
+	`, p.SCID, p.Name, p.URL, p.MissingSince, p.CheckedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set catalogue project: %w", err)
+	}
+
+	return nil
+}
+
+// GetCatalogueProject retrieves the metadata last fetched for a Software Catalogue project
+func (db *DB) GetCatalogueProject(scID string) (*CatalogueProject, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var p CatalogueProject
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT sc_id, name, url, missing_since, checked_at
+		FROM catalogue_projects WHERE sc_id = ?
+	`, scID).Scan(&p.SCID, &p.Name, &p.URL, &p.MissingSince, &p.CheckedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get catalogue project: %w", err)
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certificateTypeColumns lists the certificate_types columns in the order
+// scanCertificateType expects
+const certificateTypeColumns = "type_id, name, specialty_domain, guide_url, created_at, updated_at"
+
+// scanCertificateType scans a certificate type row
+func scanCertificateType(row interface{ Scan(...interface{}) error }) (*CertificateType, error) {
+	var t CertificateType
+	err := row.Scan(&t.TypeID, &t.Name, &t.SpecialtyDomain, &t.GuideURL, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateCertificateType creates a new certificate type in the database
+func (db *DB) CreateCertificateType(t *CertificateType) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO certificate_types (`+certificateTypeColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, t.TypeID, t.Name, t.SpecialtyDomain, t.GuideURL, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate type: %w", err)
+	}
+
+	return nil
+}
+
+// GetCertificateType retrieves a certificate type from the database by ID
+func (db *DB) GetCertificateType(typeID string) (*CertificateType, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	t, err := scanCertificateType(db.conn().QueryRowContext(ctx, "SELECT "+certificateTypeColumns+" FROM certificate_types WHERE type_id = ?", typeID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Certificate type not found
+		}
+		return nil, fmt.Errorf("failed to get certificate type: %w", err)
+	}
+
+	return t, nil
+}
+
+// ListCertificateTypes retrieves all certificate types from the database
+func (db *DB) ListCertificateTypes() ([]*CertificateType, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT "+certificateTypeColumns+" FROM certificate_types ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificate types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []*CertificateType
+	for rows.Next() {
+		t, err := scanCertificateType(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate type: %w", err)
+		}
+		types = append(types, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating certificate types: %w", err)
+	}
+
+	return types, nil
+}
+
+// GetCertificateTypeByName retrieves a certificate type by its name, ignoring
+// case
+func (db *DB) GetCertificateTypeByName(name string) (*CertificateType, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	t, err := scanCertificateType(db.conn().QueryRowContext(ctx, "SELECT "+certificateTypeColumns+" FROM certificate_types WHERE name = ? COLLATE NOCASE", name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Certificate type not found
+		}
+		return nil, fmt.Errorf("failed to get certificate type: %w", err)
+	}
+
+	return t, nil
+}
+
+// UpdateCertificateType updates a certificate type and copies its name and
+// specialty domain to the linked badges, dropping their stored renders so
+// they are regenerated
+func (db *DB) UpdateCertificateType(t *CertificateType) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE certificate_types SET name = ?, specialty_domain = ?, guide_url = ?, updated_at = ?
+		WHERE type_id = ?
+	`, t.Name, t.SpecialtyDomain, t.GuideURL, t.UpdatedAt, t.TypeID)
+	if err != nil {
+		return fmt.Errorf("failed to update certificate type: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE badges SET certificate_name = ?, specialty_domain = ?,
+			png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE certificate_type_id = ? AND (certificate_name IS NOT ? OR specialty_domain IS NOT ?)
+	`, t.Name, t.SpecialtyDomain, t.TypeID, t.Name, t.SpecialtyDomain)
+	if err != nil {
+		return fmt.Errorf("failed to update certificate type badges: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCertificateType deletes a certificate type and unlinks its badges,
+// which keep their certificate name and fall back to their type for access
+func (db *DB) DeleteCertificateType(typeID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE badges SET certificate_type_id = NULL WHERE certificate_type_id = ?", typeID); err != nil {
+		return fmt.Errorf("failed to unlink certificate type badges: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM certificate_types WHERE type_id = ?", typeID); err != nil {
+		return fmt.Errorf("failed to delete certificate type: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListBadgesByCertificateType retrieves the badges linked to a certificate
+// type, newest first
+func (db *DB) ListBadgesByCertificateType(typeID string) ([]*Badge, error) {
+	return db.queryBadges(" WHERE certificate_type_id = ? ORDER BY issue_date DESC, commit_id", typeID)
+}
+
+// LinkCertificateTypes creates a certificate type for every certificate name
+// of the unlinked badges and links them to it. It returns the number of
+// badges linked.
+func (db *DB) LinkCertificateTypes() (int64, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	return linkBadgeCertificateTypes(ctx, db.conn())
+}
+
+// defaultCertificateTypes are the certificate families created on first start,
+// with the guides the details page links to
+var defaultCertificateTypes = []CertificateType{
+	{Name: "Self-Assessed Dependencies", GuideURL: sql.NullString{String: "https://wiki.geant.org/spaces/GSD/pages/1190199425/Detailed+Guide+Self-Assessed+Dependencies+Certificate", Valid: true}},
+	{Name: "Verified Dependencies", GuideURL: sql.NullString{String: "https://wiki.geant.org/spaces/GSD/pages/1190199427/Quick+Guide+Verified+Dependencies+Certificate", Valid: true}},
+	{Name: "Verified Software Licence", GuideURL: sql.NullString{String: "https://wiki.geant.org/spaces/GSD/pages/1190199433/Quick+Guide+Verified+Software+Licence+Certificate", Valid: true}},
+	{Name: "Software Licence Assurance", GuideURL: sql.NullString{String: "https://wiki.geant.org/spaces/GSD/pages/1190199436/Quick+Guide+Software+Licence+Assurance+Certificate", Valid: true}},
+}
+
+// linkCertificateTypes creates the default certificate types and those of
+// existing badges when the table is first created; badges used to carry only
+// the display name of their certificate
+func linkCertificateTypes(db *sql.DB, logger *zap.Logger) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM certificate_types").Scan(&count); err != nil {
+		return fmt.Errorf("failed to count certificate types: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, t := range defaultCertificateTypes {
+		_, err := db.Exec(`
+			INSERT INTO certificate_types (`+certificateTypeColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, Slugify(t.Name), t.Name, t.SpecialtyDomain, t.GuideURL, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create default certificate type: %w", err)
+		}
+	}
+
+	n, err := linkBadgeCertificateTypes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logger.Info("Linked badges to certificate types", zap.Int64("badges", n))
+	}
+	return nil
+}
+
+// linkBadgeCertificateTypes links the unlinked badges that name a certificate
+// to the type of that name, creating it with the slug of the name as ID
+func linkBadgeCertificateTypes(ctx context.Context, q querier) (int64, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT certificate_name, MAX(specialty_domain) FROM badges
+		WHERE certificate_type_id IS NULL AND TRIM(COALESCE(certificate_name, '')) <> ''
+		GROUP BY certificate_name
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read certificate names: %w", err)
+	}
+	var types []*CertificateType
+	for rows.Next() {
+		var t CertificateType
+		if err := rows.Scan(&t.Name, &t.SpecialtyDomain); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan certificate name: %w", err)
+		}
+		if t.TypeID = Slugify(t.Name); t.TypeID != "" {
+			types = append(types, &t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating certificate names: %w", err)
+	}
+
+	now := time.Now()
+	for _, t := range types {
+		// A type of the same ID or name may exist already
+		_, err := q.ExecContext(ctx, `
+			INSERT OR IGNORE INTO certificate_types (`+certificateTypeColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, t.TypeID, t.Name, t.SpecialtyDomain, t.GuideURL, now, now)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create certificate type: %w", err)
+		}
+	}
+
+	res, err := q.ExecContext(ctx, `
+		UPDATE badges SET certificate_type_id = (
+			SELECT type_id FROM certificate_types WHERE certificate_types.name = badges.certificate_name
+		)
+		WHERE certificate_type_id IS NULL
+		AND certificate_name IN (SELECT name FROM certificate_types)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link certificate types: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CreateComment adds a comment to a badge and sets its CommentID
+func (db *DB) CreateComment(c *Comment) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	res, err := db.conn().ExecContext(ctx, `
+		INSERT INTO badge_comments (commit_id, author_id, body, created_at)
+		VALUES (?, ?, ?, ?)
+	`, c.CommitID, c.AuthorID, c.Body, c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+	if c.CommentID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	return nil
+}
+
+// GetComment retrieves a comment of a badge by ID
+func (db *DB) GetComment(commitID string, commentID int64) (*Comment, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var c Comment
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT comment_id, commit_id, author_id, body, created_at
+		FROM badge_comments WHERE commit_id = ? AND comment_id = ?
+	`, commitID, commentID).Scan(&c.CommentID, &c.CommitID, &c.AuthorID, &c.Body, &c.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	return &c, nil
+}
+
+// ListComments retrieves the comment thread of a badge, oldest first
+func (db *DB) ListComments(commitID string) ([]*Comment, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT comment_id, commit_id, author_id, body, created_at
+		FROM badge_comments WHERE commit_id = ? ORDER BY comment_id
+	`, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.CommentID, &c.CommitID, &c.AuthorID, &c.Body, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating comments: %w", err)
+	}
+
+	return comments, nil
+}
+
+// DeleteComment removes a comment from a badge
+func (db *DB) DeleteComment(commitID string, commentID int64) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "DELETE FROM badge_comments WHERE commit_id = ? AND comment_id = ?", commitID, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	return nil
+}
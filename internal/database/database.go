@@ -1,26 +1,39 @@
 package database
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/finki/badges/internal/blobstore"
+	"github.com/finki/badges/internal/svgsafe"
 	_ "github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// defaultAdminPassword is used for the seeded admin user when the
-// ADMIN_PASSWORD environment variable is not set.
-const defaultAdminPassword = "Admin@123"
+// DefaultQueryTimeout bounds a single database call unless configured otherwise
+const DefaultQueryTimeout = 10 * time.Second
 
 // DB represents a database connection
 type DB struct {
 	*sql.DB
 	logger *zap.Logger
+	blobs  blobstore.Store
+	// ctx is the context database calls run under, see WithContext
+	ctx context.Context
+	// timeout bounds each database call; zero disables it
+	timeout time.Duration
+	// tx is the transaction calls run in, see WithTx
+	tx *sql.Tx
+	// commitHooks run once tx is committed
+	commitHooks *[]func()
 }
 
 // New creates a new database connection
@@ -43,15 +56,64 @@ func New(dbPath string, logger *zap.Logger) (*DB, error) {
 	}
 
 	// Initialize the database
-	if err := initDB(db); err != nil {
+	if err := initDB(db, logger); err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	return &DB{DB: db, logger: logger}, nil
+	return &DB{DB: db, logger: logger, ctx: context.Background(), timeout: DefaultQueryTimeout}, nil
+}
+
+// WithContext returns a copy of the database whose calls run under ctx, so
+// they are cancelled when e.g. the client of a request disconnects
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// SetQueryTimeout sets the time limit of each database call; zero disables it.
+// Copies made by WithContext afterwards inherit it.
+func (db *DB) SetQueryTimeout(timeout time.Duration) {
+	db.timeout = timeout
+}
+
+// Check reports whether the database can be read: it pings the connection
+// and reads the schema, which fails e.g. when the file is locked or corrupt
+func (db *DB) Check() error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	if err := db.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	var n int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&n); err != nil {
+		return fmt.Errorf("failed to read database schema: %w", err)
+	}
+	return nil
+}
+
+// queryContext returns the context for one database call: the bound context,
+// limited to the query timeout
+func (db *DB) queryContext() (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return context.WithCancel(db.ctx)
+	}
+	return context.WithTimeout(db.ctx, db.timeout)
+}
+
+// Migrate applies the schema changes the database is missing, e.g. after its
+// file was replaced with one from an older release. New already does this on
+// startup; every migration is idempotent.
+func (db *DB) Migrate() error {
+	if err := initDB(db.DB, db.logger); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return nil
 }
 
 // initDB initializes the database schema
-func initDB(db *sql.DB) error {
+func initDB(db *sql.DB, logger *zap.Logger) error {
 	// Create the badges table
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS badges (
@@ -59,16 +121,16 @@ func initDB(db *sql.DB) error {
 			type TEXT NOT NULL,
 			status TEXT NOT NULL,
 			issuer TEXT NOT NULL,
-			issue_date TEXT NOT NULL,
+			issue_date DATE NOT NULL,
 			software_name TEXT NOT NULL,
 			software_version TEXT NOT NULL,
 			software_url TEXT,
 			notes TEXT,
 			svg_content TEXT,
-			expiry_date TEXT,
+			expiry_date DATE,
 			issuer_url TEXT,
 			custom_config TEXT,
-			last_review TEXT,
+			last_review DATE,
 			jpg_content BLOB,
 			png_content BLOB,
 			covered_version TEXT,
@@ -79,13 +141,52 @@ func initDB(db *sql.DB) error {
 			certificate_name TEXT,
 			specialty_domain TEXT,
 			software_sc_id TEXT,
-			software_sc_url TEXT
+			software_sc_url TEXT,
+			png_key TEXT,
+			jpg_key TEXT,
+			git_repository TEXT,
+			git_commit_sha TEXT,
+			git_tag TEXT,
+			issuer_id TEXT,
+			org_id TEXT,
+			publish_at TIMESTAMP,
+			certificate_type_id TEXT
 		)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to create badges table: %w", err)
 	}
 
+	// Upgrade badges tables created before image blobs could live in a blob store,
+	// certificates could be bound to a git commit, linked to an issuer profile or
+	// owned by an organization
+	for _, col := range []string{"png_key", "jpg_key", "git_repository", "git_commit_sha", "git_tag", "issuer_id", "org_id"} {
+		if err := addColumnIfMissing(db, "badges", col, "TEXT"); err != nil {
+			return err
+		}
+	}
+	// ... and before publication could be scheduled
+	if err := addColumnIfMissing(db, "badges", "publish_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	// ... and before certificate types were an entity of their own
+	if err := addColumnIfMissing(db, "badges", "certificate_type_id", "TEXT"); err != nil {
+		return err
+	}
+	// Dates used to be free text; rewrite those in other layouts as YYYY-MM-DD
+	if err := normalizeBadgeDates(db, logger); err != nil {
+		return err
+	}
+	// Statuses used to be compared ignoring case; store them lowercase
+	if err := normalizeBadgeStatuses(db, logger); err != nil {
+		return err
+	}
+
+	// Index the project lookups of landing pages and vanity URLs
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_badges_software_sc_id ON badges (software_sc_id)"); err != nil {
+		return fmt.Errorf("failed to create badges index: %w", err)
+	}
+
 	// Create the roles table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS roles (
@@ -93,6 +194,7 @@ func initDB(db *sql.DB) error {
 			name TEXT NOT NULL UNIQUE,
 			description TEXT NOT NULL,
 			permissions TEXT NOT NULL,
+			inherits TEXT NOT NULL DEFAULT '',
 			created_at TIMESTAMP NOT NULL,
 			updated_at TIMESTAMP NOT NULL
 		)
@@ -101,6 +203,11 @@ func initDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create roles table: %w", err)
 	}
 
+	// Upgrade roles tables created before roles could inherit
+	if err := addColumnIfMissing(db, "roles", "inherits", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
 	// Create the users table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
@@ -116,6 +223,8 @@ func initDB(db *sql.DB) error {
 			last_login TIMESTAMP,
 			status TEXT NOT NULL,
 			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			must_change_password INTEGER NOT NULL DEFAULT 0,
+			org_id TEXT,
 			FOREIGN KEY (role_id) REFERENCES roles (role_id)
 		)
 	`)
@@ -123,6 +232,20 @@ func initDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create users table: %w", err)
 	}
 
+	// Upgrade users tables created before forced password changes existed
+	if err := addColumnIfMissing(db, "users", "must_change_password", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Upgrade users tables created before organizations existed
+	if err := addColumnIfMissing(db, "users", "org_id", "TEXT"); err != nil {
+		return err
+	}
+	// Emails used to be stored as entered; store them lowercase
+	if err := normalizeUserEmails(db, logger); err != nil {
+		return err
+	}
+
 	// Create the api_keys table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS api_keys (
@@ -136,6 +259,10 @@ func initDB(db *sql.DB) error {
 			last_used TIMESTAMP,
 			status TEXT NOT NULL,
 			ip_restrictions TEXT,
+			monthly_quota INTEGER NOT NULL DEFAULT 0,
+			notify_url TEXT NOT NULL DEFAULT '',
+			expiry_notice INTEGER NOT NULL DEFAULT 0,
+			lookup_hash TEXT NOT NULL DEFAULT '',
 			FOREIGN KEY (user_id) REFERENCES users (user_id)
 		)
 	`)
@@ -143,86 +270,541 @@ func initDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create api_keys table: %w", err)
 	}
 
-	// Add a test badge if it doesn't exist
-	//if err := addTestBadge(db); err != nil {
-	//	return fmt.Errorf("failed to add test badge: %w", err)
-	//}
+	// Upgrade api_keys tables created before keys could be found by their
+	// SHA-256; keys without one are indexed when they are next used
+	if err := addColumnIfMissing(db, "api_keys", "lookup_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_api_keys_lookup_hash ON api_keys (lookup_hash)"); err != nil {
+		return fmt.Errorf("failed to create api_keys lookup index: %w", err)
+	}
+
+	// Upgrade api_keys tables created before keys had quotas
+	if err := addColumnIfMissing(db, "api_keys", "monthly_quota", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Upgrade api_keys tables created before owners were warned of expiry
+	if err := addColumnIfMissing(db, "api_keys", "notify_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "api_keys", "expiry_notice", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Create api_key_usage table counting the requests made with each API key
+	// and the bytes served to them per UTC day
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_key_usage (
+			day TEXT NOT NULL,
+			api_key_id TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			bytes INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (api_key_id, day)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create api_key_usage table: %w", err)
+	}
+
+	// Create oauth_clients table of the services given tokens by the OAuth2
+	// client-credentials grant
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			client_id TEXT PRIMARY KEY,
+			secret_hash TEXT NOT NULL,
+			name TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			org_id TEXT NOT NULL DEFAULT '',
+			permissions TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_used TIMESTAMP,
+			status TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth_clients table: %w", err)
+	}
+
+	// Create events table of the domain events served by /api/events
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS events (
+			event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			subject_id TEXT NOT NULL,
+			org_id TEXT NOT NULL DEFAULT '',
+			actor_id TEXT NOT NULL DEFAULT '',
+			data TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_events_org_id ON events (org_id, event_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create events table: %w", err)
+	}
+
+	// Create the issuers table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS issuers (
+			issuer_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			url TEXT,
+			logo TEXT,
+			contact TEXT,
+			public_key TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create issuers table: %w", err)
+	}
+	if err := addColumnIfMissing(db, "issuers", "timezone", "TEXT"); err != nil {
+		return err
+	}
+
+	// Create the organizations table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS organizations (
+			org_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			theme TEXT,
+			forges TEXT,
+			connectors TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create organizations table: %w", err)
+	}
+	// Upgrade organizations tables created before forge integration
+	if err := addColumnIfMissing(db, "organizations", "forges", "TEXT"); err != nil {
+		return fmt.Errorf("failed to upgrade organizations table: %w", err)
+	}
+	if err := addColumnIfMissing(db, "organizations", "connectors", "TEXT"); err != nil {
+		return fmt.Errorf("failed to upgrade organizations table: %w", err)
+	}
+
+	// Create the templates table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS templates (
+			template_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			badge_type TEXT NOT NULL,
+			content TEXT NOT NULL,
+			is_default INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create templates table: %w", err)
+	}
+
+	// Create the groups tables. A badge type granted to one or more groups can
+	// only be issued and edited by their members.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS groups (
+			group_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS group_members (
+			group_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (group_id, user_id)
+		);
+		CREATE TABLE IF NOT EXISTS group_badge_types (
+			group_id TEXT NOT NULL,
+			badge_type TEXT NOT NULL,
+			PRIMARY KEY (group_id, badge_type)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create groups tables: %w", err)
+	}
+
+	// Create the audit table of the review workflow
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_audit (
+			audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			commit_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			from_status TEXT NOT NULL,
+			to_status TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			comment TEXT,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_badge_audit_commit_id ON badge_audit (commit_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_audit table: %w", err)
+	}
+
+	// Create sessions table; revoked and expired sessions are deleted when
+	// their user logs in again
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			session_id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_seen TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create sessions table: %w", err)
+	}
+
+	// Create login_failures table of the login throttle, shared by every
+	// process on the database
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS login_failures (
+			key TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure TIMESTAMP NOT NULL,
+			blocked_until TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create login_failures table: %w", err)
+	}
+
+	// Create the audit table of actions on user accounts
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_audit (
+			audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			subject_id TEXT NOT NULL,
+			detail TEXT,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_audit_action ON user_audit (action, audit_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create user_audit table: %w", err)
+	}
+
+	// Create badge_comments table for internal reviewer notes
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_comments (
+			comment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			commit_id TEXT NOT NULL,
+			author_id TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_badge_comments_commit_id ON badge_comments (commit_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_comments table: %w", err)
+	}
+
+	// Create badge_attachments table for review evidence; content stays NULL
+	// when an external blob store holds it under blob_key
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_attachments (
+			attachment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			commit_id TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			content BLOB,
+			blob_key TEXT,
+			uploaded_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_badge_attachments_commit_id ON badge_attachments (commit_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_attachments table: %w", err)
+	}
+
+	// Create badge_sboms table holding the summary of the current SBOM of a badge
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_sboms (
+			commit_id TEXT PRIMARY KEY,
+			attachment_id INTEGER NOT NULL,
+			summary TEXT NOT NULL,
+			uploaded_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_sboms table: %w", err)
+	}
+
+	// Create forge_statuses table recording the last commit status posted per badge
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS forge_statuses (
+			commit_id TEXT PRIMARY KEY,
+			repository TEXT NOT NULL,
+			sha TEXT NOT NULL,
+			state TEXT NOT NULL,
+			error TEXT,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create forge_statuses table: %w", err)
+	}
+
+	// Create catalogue_projects table caching Software Catalogue metadata
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS catalogue_projects (
+			sc_id TEXT PRIMARY KEY,
+			name TEXT,
+			url TEXT,
+			missing_since TIMESTAMP,
+			checked_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create catalogue_projects table: %w", err)
+	}
+
+	// Create notification_states table recording the state last announced per badge
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS notification_states (
+			commit_id TEXT PRIMARY KEY,
+			state TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create notification_states table: %w", err)
+	}
+
+	// Create the certificate_types table of certificate families such as
+	// Self-Assessed Dependencies, and link the badges that name one
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS certificate_types (
+			type_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			specialty_domain TEXT,
+			guide_url TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_badges_certificate_type_id ON badges (certificate_type_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate_types table: %w", err)
+	}
+	if err := linkCertificateTypes(db, logger); err != nil {
+		return err
+	}
+
+	// Create badge_aliases table mapping alternate IDs to badges; aliases are
+	// unique regardless of case
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_aliases (
+			alias TEXT PRIMARY KEY COLLATE NOCASE,
+			commit_id TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_badge_aliases_commit_id ON badge_aliases (commit_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_aliases table: %w", err)
+	}
+
+	// Create badge_daily_stats table counting image requests and renders per
+	// badge and UTC day
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_daily_stats (
+			day TEXT NOT NULL,
+			commit_id TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			renders INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, commit_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_daily_stats table: %w", err)
+	}
+
+	// Create badge_referrers table counting image requests per badge, UTC day
+	// and referring site; only the scheme and host of the referrer are kept
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badge_referrers (
+			day TEXT NOT NULL,
+			commit_id TEXT NOT NULL,
+			referrer TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (commit_id, day, referrer)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create badge_referrers table: %w", err)
+	}
 
-	// Add initial test badges if they don't exist
-	if err := addInitialBadges(db); err != nil {
-		return fmt.Errorf("failed to add initial test badges: %w", err)
+	// Create jobs table holding the background job queue, including finished
+	// and dead jobs until they are pruned
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			job_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			last_error TEXT,
+			progress TEXT,
+			run_at TIMESTAMP NOT NULL,
+			locked_until TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_jobs_state_run_at ON jobs (state, run_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create jobs table: %w", err)
 	}
 
-	// Add default admin role if it doesn't exist
-	if err := addDefaultRole(db); err != nil {
-		return fmt.Errorf("failed to add default admin role: %w", err)
+	// Badge seed data is no longer inserted here; see the fixtures package
+
+	// Add the default roles that don't exist
+	if err := addDefaultRoles(db); err != nil {
+		return fmt.Errorf("failed to add default roles: %w", err)
 	}
 
 	// Add default admin user if no users exist
-	if err := addDefaultAdminUser(db); err != nil {
+	if err := addDefaultAdminUser(db, logger); err != nil {
 		return fmt.Errorf("failed to add default admin user: %w", err)
 	}
 
 	return nil
 }
 
-// addDefaultRole adds a default admin role to the database if it doesn't already exist
-func addDefaultRole(db *sql.DB) error {
-	// Check if the admin role already exists
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", "admin").Scan(&count)
+// utc normalizes a timestamp that is compared in SQL: the driver stores
+// timestamps as text, which only orders correctly within one time zone
+func utc(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.UTC()
+	}
+	return t
+}
+
+// addColumnIfMissing adds a column to an existing table so that databases created
+// by older versions pick up new schema without a separate migration step
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return fmt.Errorf("failed to check for admin role: %w", err)
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
 	}
+	defer rows.Close()
 
-	// If the role already exists, don't add it again
-	if count > 0 {
-		return nil
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan %s table info: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
 	}
 
-	// Create admin role with full permissions
-	permissions := `{
-		"badges": {
-			"read": true,
-			"write": true,
-			"delete": true
-		},
-		"users": {
-			"read": true,
-			"write": true,
-			"delete": true
-		},
-		"api_keys": {
-			"read": true,
-			"write": true,
-			"delete": true
-		}
-	}`
-
-	// Generate a UUID for the role ID
-	roleID := fmt.Sprintf("%x", time.Now().UnixNano())
-
-	// Insert the admin role
-	_, err = db.Exec(`
-		INSERT INTO roles (
-			role_id, name, description, permissions, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?)
-	`,
-		roleID,                           // role_id
-		"admin",                          // name
-		"Administrator with full access", // description
-		permissions,                      // permissions
-		time.Now(),                       // created_at
-		time.Now())                       // updated_at
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// defaultRoles are the roles every database starts with, each inheriting
+// the permissions of the one before: viewers read badges, issuers also
+// manage them and their API keys, and administrators may do anything,
+// including on resources added later
+var defaultRoles = []struct {
+	name, description, inherits, permissions string
+}{
+	{"viewer", "Read access to badges", "", `{"badges": {"read": true}}`},
+	{"issuer", "Issues and manages badges", "viewer", `{
+		"badges": {"write": true, "delete": true},
+		"api_keys": {"read": true, "write": true, "delete": true}
+	}`},
+	{"admin", "Administrator with full access", "issuer", `{"*": {"*": true}}`},
+}
+
+// addDefaultRoles adds the default roles that don't exist yet. An admin role
+// created before roles could inherit that grants every action on badges, users
+// and API keys is upgraded to the wildcard, so that it also covers resources
+// added since.
+func addDefaultRoles(db *sql.DB) error {
+	for i, r := range defaultRoles {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", r.name).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to check for %s role: %w", r.name, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		now := time.Now()
+		_, err = db.Exec(`
+			INSERT INTO roles (
+				role_id, name, description, permissions, inherits, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, fmt.Sprintf("%x", now.UnixNano()+int64(i)), r.name, r.description, r.permissions, r.inherits, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s role: %w", r.name, err)
+		}
+	}
+
+	var roleID, data string
+	err := db.QueryRow("SELECT role_id, permissions FROM roles WHERE name = 'admin' AND inherits = ''").Scan(&roleID, &data)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin role: %w", err)
+	}
+	permissions, err := ParsePermissions(data)
+	if err != nil {
+		return nil // Left for an administrator to fix
+	}
+	for _, resource := range []string{"badges", "users", "api_keys"} {
+		for _, action := range []string{"read", "write", "delete"} {
+			if !permissions.Allows(resource, action) {
+				return nil
+			}
+		}
+	}
+	_, err = db.Exec("UPDATE roles SET permissions = ?, inherits = 'issuer', updated_at = ? WHERE role_id = ?",
+		defaultRoles[len(defaultRoles)-1].permissions, time.Now(), roleID)
 	if err != nil {
-		return fmt.Errorf("failed to insert admin role: %w", err)
+		return fmt.Errorf("failed to upgrade admin role: %w", err)
 	}
 
 	return nil
 }
 
-// addDefaultAdminUser adds a default admin user to the database if no users exist
-func addDefaultAdminUser(db *sql.DB) error {
+// addDefaultAdminUser adds a default admin user to the database if no users exist.
+// Without ADMIN_PASSWORD a random one-time password is generated and logged once;
+// the admin must change it on first login.
+func addDefaultAdminUser(db *sql.DB, logger *zap.Logger) error {
 	// Check if any users exist
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
@@ -246,10 +828,14 @@ func addDefaultAdminUser(db *sql.DB) error {
 	userID := fmt.Sprintf("user_%x", time.Now().UnixNano())
 
 	// Determine the admin password: use ADMIN_PASSWORD env var if set,
-	// otherwise fall back to the predefined default.
-	password := defaultAdminPassword
-	if envPassword := os.Getenv("ADMIN_PASSWORD"); envPassword != "" {
-		password = envPassword
+	// otherwise generate a one-time password that must be changed on first login.
+	password := os.Getenv("ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		password, err = generatePassword()
+		if err != nil {
+			return err
+		}
 	}
 
 	// Hash the password using bcrypt
@@ -262,8 +848,8 @@ func addDefaultAdminUser(db *sql.DB) error {
 	_, err = db.Exec(`
 		INSERT INTO users (
 			user_id, username, email, password_hash, first_name, last_name,
-			role_id, created_at, updated_at, status, failed_attempts
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			role_id, created_at, updated_at, status, failed_attempts, must_change_password
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		userID,                 // user_id
 		"admin",                // username
@@ -275,107 +861,62 @@ func addDefaultAdminUser(db *sql.DB) error {
 		time.Now(),             // created_at
 		time.Now(),             // updated_at
 		"active",               // status
-		0)                      // failed_attempts
+		0,                      // failed_attempts
+		generated)              // must_change_password
 	if err != nil {
 		return fmt.Errorf("failed to insert admin user: %w", err)
 	}
 
-	if password == defaultAdminPassword {
-		fmt.Printf("Created default admin user with username 'admin' and password '%s'\n", defaultAdminPassword)
+	if generated {
+		// This is the only time the password is ever shown
+		logger.Warn("Created admin user with a one-time password; it must be changed on first login",
+			zap.String("username", "admin"),
+			zap.String("password", password))
 	} else {
-		fmt.Println("Created default admin user with username 'admin' and password from ADMIN_PASSWORD environment variable")
+		logger.Info("Created admin user with password from ADMIN_PASSWORD environment variable",
+			zap.String("username", "admin"))
 	}
 	return nil
 }
 
-// addTestBadge adds a test badge to the database if it doesn't already exist
-func addTestBadge(db *sql.DB) error {
-	// Check if the test badge already exists
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM badges WHERE commit_id = ?", "softcat").Scan(&count)
-	if err != nil {
-		return fmt.Errorf("failed to check for test badge: %w", err)
+// generatePassword returns a random password for the initial admin user
+func generatePassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate admin password: %w", err)
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	// If the badge already exists, don't add it again
-	if count > 0 {
-		return nil
-	}
+// issuerTimezoneColumn selects the timezone of the issuer profile a badge
+// links to, which its expiry date is evaluated in
+const issuerTimezoneColumn = "(SELECT timezone FROM issuers WHERE issuers.issuer_id = badges.issuer_id)"
 
-	// Create a test badge with proper handling of NULL values
-	notes := sql.NullString{String: "", Valid: true}
-	expiryDate := sql.NullString{String: time.Now().AddDate(1, 0, 0).Format("2006-01-02"), Valid: true}
-	issuerURL := sql.NullString{String: "https://certificates.software.geant.org", Valid: true}
-	softwareURL := sql.NullString{String: "https://sc.geant.org/ui/project/SOFTCAT", Valid: true}
-	customConfig := sql.NullString{String: `{"color_left":"#003f5f","color_right":"#FFFFFF","style":"3d","text_color_right":"#333", "border_color":"#ffffff", "horizontal_bars_color":"#bbb", "top_label_color":"#bbb"}`, Valid: true}
-	lastReview := sql.NullString{String: time.Now().Format("2006-01-02"), Valid: true}
-	coveredVersion := sql.NullString{String: "1.12.0", Valid: true}
-	repositoryLink := sql.NullString{String: "https://bitbucket.software.geant.org/scm/sc/softwarecataloguegit.git", Valid: true}
-	publicNote := sql.NullString{String: "This certificate certifies compliance with Software Licence standards", Valid: true}
-	internalNote := sql.NullString{String: "Internal review comments and notes", Valid: true}
-	contactDetails := sql.NullString{String: "certificates.software.geant.org", Valid: true}
-	certificateName := sql.NullString{String: "Self-Assessed Dependencies", Valid: true}
-	specialtyDomain := sql.NullString{String: "Software Licencing", Valid: true}
-	softwareSCID := sql.NullString{String: "SOFTCAT", Valid: true}
-	softwareSCURL := sql.NullString{String: "https://sc.geant.org/ui/project/SOFTCAT", Valid: true}
-
-	// Insert the test badge
-	_, err = db.Exec(`
-		INSERT INTO badges (
-			commit_id, type, status, issuer, issue_date, 
-			software_name, software_version, software_url, notes, 
-			expiry_date, issuer_url, custom_config, last_review,
-			covered_version, repository_link, public_note, internal_note, contact_details,
-			certificate_name, specialty_domain, software_sc_id, software_sc_url
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`,
-		"softcat",                        // commit_id
-		"badge",                          // type
-		"valid",                          // status
-		"GEANT WP9T2 Software Licencing", // issuer
-		time.Now().Format("2006-01-02"),  // issue_date
-		"GÉANT Software Catalogue",       // software_name
-		"v1.12.0",                        // software_version
-		softwareURL,                      // software_url
-		notes,                            // notes
-		expiryDate,                       // expiry_date
-		issuerURL,                        // issuer_url
-		customConfig,                     // custom_config
-		lastReview,                       // last_review
-		coveredVersion,                   // covered_version
-		repositoryLink,                   // repository_link
-		publicNote,                       // public_note
-		internalNote,                     // internal_note
-		contactDetails,                   // contact_details
-		certificateName,                  // certificate_name
-		specialtyDomain,                  // specialty_domain
-		softwareSCID,                     // software_sc_id
-		softwareSCURL)                    // software_sc_url
-	if err != nil {
-		return fmt.Errorf("failed to insert test badge: %w", err)
-	}
-
-	return nil
-}
-
-// GetBadge retrieves a badge from the database by commit ID
-func (db *DB) GetBadge(commitID string) (*Badge, error) {
-	var badge Badge
-	err := db.QueryRow(`
-		SELECT 
+// GetBadge retrieves a badge from the database by commit ID
+func (db *DB) GetBadge(commitID string) (*Badge, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var badge Badge
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT 
 			commit_id, type, status, issuer, issue_date, 
 			software_name, software_version, software_url, notes, svg_content, 
 			expiry_date, issuer_url, custom_config, last_review, jpg_content, png_content,
 			covered_version, repository_link, public_note, internal_note, contact_details,
-			certificate_name, specialty_domain, software_sc_id, software_sc_url
+			certificate_name, specialty_domain, software_sc_id, software_sc_url,
+			png_key, jpg_key, git_repository, git_commit_sha, git_tag, issuer_id, org_id, publish_at,
+			certificate_type_id, `+issuerTimezoneColumn+`
 		FROM badges
 		WHERE commit_id = ?
 	`, commitID).Scan(
-		&badge.CommitID, &badge.Type, &badge.Status, &badge.Issuer, &badge.IssueDate,
+		&badge.CommitID, &badge.Type, &badge.Status, &badge.Issuer, scanDate(&badge.IssueDate),
 		&badge.SoftwareName, &badge.SoftwareVersion, &badge.SoftwareURL, &badge.Notes, &badge.SVGContent,
-		&badge.ExpiryDate, &badge.IssuerURL, &badge.CustomConfig, &badge.LastReview, &badge.JPGContent, &badge.PNGContent,
+		scanNullDate(&badge.ExpiryDate), &badge.IssuerURL, &badge.CustomConfig, scanNullDate(&badge.LastReview), &badge.JPGContent, &badge.PNGContent,
 		&badge.CoveredVersion, &badge.RepositoryLink, &badge.PublicNote, &badge.InternalNote, &badge.ContactDetails,
 		&badge.CertificateName, &badge.SpecialtyDomain, &badge.SoftwareSCID, &badge.SoftwareSCURL,
+		&badge.PNGKey, &badge.JPGKey, &badge.GitRepository, &badge.GitCommitSHA, &badge.GitTag, &badge.IssuerID, &badge.OrgID, &badge.PublishAt,
+		&badge.CertificateTypeID, &badge.IssuerTimezone,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -387,70 +928,227 @@ func (db *DB) GetBadge(commitID string) (*Badge, error) {
 	return &badge, nil
 }
 
-// CreateBadge creates a new badge in the database
+// CreateBadge creates a new badge in the database, recording its
+// badge.issued event unless it is created as a draft or pending
 func (db *DB) CreateBadge(badge *Badge) error {
-	_, err := db.Exec(`
+	svgContent, err := sanitizeSVGContent(badge.SVGContent)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		_, err := tx.conn().ExecContext(ctx, `
 		INSERT INTO badges (
 			commit_id, type, status, issuer, issue_date, 
 			software_name, software_version, software_url, notes, svg_content, 
 			expiry_date, issuer_url, custom_config, last_review, jpg_content, png_content,
 			covered_version, repository_link, public_note, internal_note, contact_details,
-			certificate_name, specialty_domain, software_sc_id, software_sc_url
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			certificate_name, specialty_domain, software_sc_id, software_sc_url,
+			git_repository, git_commit_sha, git_tag, issuer_id, org_id, publish_at, certificate_type_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
-		badge.CommitID, badge.Type, badge.Status, badge.Issuer, badge.IssueDate,
-		badge.SoftwareName, badge.SoftwareVersion, badge.SoftwareURL, badge.Notes, badge.SVGContent,
-		badge.ExpiryDate, badge.IssuerURL, badge.CustomConfig, badge.LastReview, badge.JPGContent, badge.PNGContent,
+		badge.CommitID, badge.Type, badge.Status, badge.Issuer, dateArg(badge.IssueDate),
+		badge.SoftwareName, badge.SoftwareVersion, badge.SoftwareURL, badge.Notes, svgContent,
+		nullDateArg(badge.ExpiryDate), badge.IssuerURL, badge.CustomConfig, nullDateArg(badge.LastReview), badge.JPGContent, badge.PNGContent,
 		badge.CoveredVersion, badge.RepositoryLink, badge.PublicNote, badge.InternalNote, badge.ContactDetails,
 		badge.CertificateName, badge.SpecialtyDomain, badge.SoftwareSCID, badge.SoftwareSCURL,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create badge: %w", err)
-	}
+		badge.GitRepository, badge.GitCommitSHA, badge.GitTag, badge.IssuerID, badge.OrgID, utc(badge.PublishAt), badge.CertificateTypeID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create badge: %w", err)
+		}
 
-	return nil
+		// Drafts are issued once they are published, see badgeStatusEvent
+		if !badge.Status.IsPublished() {
+			return nil
+		}
+		return tx.recordEvent(EventBadgeIssued, badge.CommitID, badge.OrgID.String, newBadgeEvent(badge))
+	})
 }
 
-// UpdateBadge updates an existing badge in the database
+// UpdateBadge updates an existing badge in the database, recording its
+// badge.issued event when it is published, badge.revoked when it is revoked
+// and badge.updated otherwise; changes to unpublished badges record nothing
 func (db *DB) UpdateBadge(badge *Badge) error {
-	_, err := db.Exec(`
+	svgContent, err := sanitizeSVGContent(badge.SVGContent)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		var prev Status
+		err := tx.conn().QueryRowContext(ctx, "SELECT status FROM badges WHERE commit_id = ?", badge.CommitID).Scan(&prev)
+		if err == sql.ErrNoRows {
+			return nil // Badge not found
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update badge: %w", err)
+		}
+
+		_, err = tx.conn().ExecContext(ctx, `
 		UPDATE badges SET
 			type = ?, status = ?, issuer = ?, issue_date = ?,
 			software_name = ?, software_version = ?, software_url = ?, notes = ?, svg_content = ?,
 			expiry_date = ?, issuer_url = ?, custom_config = ?, last_review = ?, jpg_content = ?, png_content = ?,
 			covered_version = ?, repository_link = ?, public_note = ?, internal_note = ?, contact_details = ?,
-			certificate_name = ?, specialty_domain = ?, software_sc_id = ?, software_sc_url = ?
+			certificate_name = ?, specialty_domain = ?, software_sc_id = ?, software_sc_url = ?,
+			png_key = ?, jpg_key = ?, git_repository = ?, git_commit_sha = ?, git_tag = ?,
+			issuer_id = ?, org_id = ?, publish_at = ?, certificate_type_id = ?
 		WHERE commit_id = ?
 	`,
-		badge.Type, badge.Status, badge.Issuer, badge.IssueDate,
-		badge.SoftwareName, badge.SoftwareVersion, badge.SoftwareURL, badge.Notes, badge.SVGContent,
-		badge.ExpiryDate, badge.IssuerURL, badge.CustomConfig, badge.LastReview, badge.JPGContent, badge.PNGContent,
+		badge.Type, badge.Status, badge.Issuer, dateArg(badge.IssueDate),
+		badge.SoftwareName, badge.SoftwareVersion, badge.SoftwareURL, badge.Notes, svgContent,
+		nullDateArg(badge.ExpiryDate), badge.IssuerURL, badge.CustomConfig, nullDateArg(badge.LastReview), badge.JPGContent, badge.PNGContent,
 		badge.CoveredVersion, badge.RepositoryLink, badge.PublicNote, badge.InternalNote, badge.ContactDetails,
 		badge.CertificateName, badge.SpecialtyDomain, badge.SoftwareSCID, badge.SoftwareSCURL,
+		badge.PNGKey, badge.JPGKey, badge.GitRepository, badge.GitCommitSHA, badge.GitTag,
+		badge.IssuerID, badge.OrgID, utc(badge.PublishAt), badge.CertificateTypeID,
 		badge.CommitID,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update badge: %w", err)
-	}
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update badge: %w", err)
+		}
 
-	return nil
+		event := badgeStatusEvent(prev, badge.Status)
+		if event == "" {
+			return nil
+		}
+		return tx.recordEvent(event, badge.CommitID, badge.OrgID.String, newBadgeEvent(badge))
+	})
 }
 
-// DeleteBadge deletes a badge from the database
+// DeleteBadge deletes a badge from the database together with its comments,
+// SBOM, attachments, aliases and sync state, in one transaction, recording its
+// badge.deleted event
 func (db *DB) DeleteBadge(commitID string) error {
-	_, err := db.Exec("DELETE FROM badges WHERE commit_id = ?", commitID)
-	if err != nil {
-		return fmt.Errorf("failed to delete badge: %w", err)
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		// Collect blob store keys first so stored images don't outlive the badge
+		var pngKey, jpgKey sql.NullString
+		if tx.blobs != nil {
+			err := tx.conn().QueryRowContext(ctx, "SELECT png_key, jpg_key FROM badges WHERE commit_id = ?", commitID).Scan(&pngKey, &jpgKey)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("failed to look up badge images: %w", err)
+			}
+		}
+
+		// Leftovers of a badge that is gone are still cleaned up, without an event
+		var orgID sql.NullString
+		err := tx.conn().QueryRowContext(ctx, "SELECT org_id FROM badges WHERE commit_id = ?", commitID).Scan(&orgID)
+		found := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to delete badge: %w", err)
+		}
+
+		_, err = tx.conn().ExecContext(ctx, "DELETE FROM badges WHERE commit_id = ?", commitID)
+		if err != nil {
+			return fmt.Errorf("failed to delete badge: %w", err)
+		}
+
+		// Comments only make sense on the badge; the review history is kept
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_comments WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge comments: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_sboms WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge SBOM: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM forge_statuses WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete forge status: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM notification_states WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete notification state: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_aliases WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge aliases: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_daily_stats WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge stats: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_referrers WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge referrers: %w", err)
+		}
+		if err := tx.deleteAttachments(commitID); err != nil {
+			return err
+		}
+
+		for _, key := range []sql.NullString{pngKey, jpgKey} {
+			if !key.Valid || key.String == "" {
+				continue
+			}
+			key := key.String
+			tx.afterCommit(func() { tx.deleteBlob(key) })
+		}
+
+		if !found {
+			return nil
+		}
+		return tx.recordEvent(EventBadgeDeleted, commitID, orgID.String, map[string]string{"commit_id": commitID})
+	})
+}
+
+// SetBlobStore configures an external store for generated PNG/JPG images.
+// When unset, images are stored in the badges table as before.
+func (db *DB) SetBlobStore(store blobstore.Store) {
+	db.blobs = store
+}
+
+// GetBadgeImage returns the stored PNG or JPG image for a badge, or nil if none
+// has been generated yet. Images still held in the badges table are returned
+// directly; otherwise the image is read from the blob store by key.
+func (db *DB) GetBadgeImage(badge *Badge, format string) ([]byte, error) {
+	var content []byte
+	var key sql.NullString
+	switch format {
+	case "png":
+		content, key = badge.PNGContent, badge.PNGKey
+	case "jpg":
+		content, key = badge.JPGContent, badge.JPGKey
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
 
-	return nil
+	if content != nil {
+		return content, nil
+	}
+	if db.blobs == nil || !key.Valid || key.String == "" {
+		return nil, nil
+	}
+
+	data, err := db.blobs.Get(key.String)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read badge image: %w", err)
+	}
+	return data, nil
 }
 
 // UpdateBadgeImage updates the image content of a badge
 func (db *DB) UpdateBadgeImage(commitID, format string, content []byte) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	if db.blobs != nil && (format == "png" || format == "jpg") {
+		return db.storeBadgeImage(commitID, format, content)
+	}
+
 	var query string
 	switch format {
 	case "svg":
+		sanitized, err := svgsafe.Sanitize(content)
+		if err != nil {
+			return fmt.Errorf("failed to update badge image: %w", err)
+		}
+		content = sanitized
 		query = "UPDATE badges SET svg_content = ? WHERE commit_id = ?"
 	case "jpg":
 		query = "UPDATE badges SET jpg_content = ? WHERE commit_id = ?"
@@ -460,7 +1158,7 @@ func (db *DB) UpdateBadgeImage(commitID, format string, content []byte) error {
 		return fmt.Errorf("unsupported format: %s", format)
 	}
 
-	_, err := db.Exec(query, content, commitID)
+	_, err := db.conn().ExecContext(ctx, query, content, commitID)
 	if err != nil {
 		return fmt.Errorf("failed to update badge image: %w", err)
 	}
@@ -468,17 +1166,136 @@ func (db *DB) UpdateBadgeImage(commitID, format string, content []byte) error {
 	return nil
 }
 
+// sanitizeSVGContent returns the svg_content of a badge without active
+// content, as it is served as image/svg+xml
+func sanitizeSVGContent(content sql.NullString) (sql.NullString, error) {
+	if !content.Valid || strings.TrimSpace(content.String) == "" {
+		return content, nil
+	}
+	sanitized, err := svgsafe.Sanitize([]byte(content.String))
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("invalid svg_content: %w", err)
+	}
+	return sql.NullString{String: string(sanitized), Valid: true}, nil
+}
+
+// storeBadgeImage writes a PNG/JPG image to the blob store and records its key,
+// clearing any copy previously held in the badges table
+func (db *DB) storeBadgeImage(commitID, format string, content []byte) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	contentType := "image/png"
+	if format == "jpg" {
+		contentType = "image/jpeg"
+	}
+
+	key := blobstore.BadgeImageKey(commitID, format)
+	if err := db.blobs.Put(key, content, contentType); err != nil {
+		return fmt.Errorf("failed to store badge image: %w", err)
+	}
+
+	query := "UPDATE badges SET png_key = ?, png_content = NULL WHERE commit_id = ?"
+	if format == "jpg" {
+		query = "UPDATE badges SET jpg_key = ?, jpg_content = NULL WHERE commit_id = ?"
+	}
+	if _, err := db.conn().ExecContext(ctx, query, key, commitID); err != nil {
+		return fmt.Errorf("failed to update badge image key: %w", err)
+	}
+
+	return nil
+}
+
 // ListBadges retrieves all badges from the database
 func (db *DB) ListBadges() ([]*Badge, error) {
-	rows, err := db.Query(`
+	return db.queryBadges("")
+}
+
+// ListBadgesByGitCommit retrieves the badges bound to a commit SHA. Either the
+// stored or the given SHA may be abbreviated.
+func (db *DB) ListBadgesByGitCommit(sha string) ([]*Badge, error) {
+	return db.queryBadges(`
+		WHERE git_commit_sha IS NOT NULL AND length(git_commit_sha) >= 7
+			AND (substr(?1, 1, length(git_commit_sha)) = git_commit_sha
+				OR substr(git_commit_sha, 1, length(?1)) = ?1)
+	`, strings.ToLower(sha))
+}
+
+// ListGitBoundBadges retrieves the badges bound to a repository and commit SHA
+func (db *DB) ListGitBoundBadges() ([]*Badge, error) {
+	return db.queryBadges(`
+		WHERE git_repository IS NOT NULL AND git_repository != ''
+			AND git_commit_sha IS NOT NULL AND git_commit_sha != ''
+		ORDER BY commit_id
+	`)
+}
+
+// ListBadgesWithSoftwareSCID retrieves the badges linked to a Software
+// Catalogue project
+func (db *DB) ListBadgesWithSoftwareSCID() ([]*Badge, error) {
+	return db.queryBadges(" WHERE software_sc_id IS NOT NULL AND software_sc_id != '' ORDER BY software_sc_id, commit_id")
+}
+
+// ListBadgesBySoftwareSCID retrieves the badges issued for a Software Catalogue
+// project, newest first
+func (db *DB) ListBadgesBySoftwareSCID(scID string) ([]*Badge, error) {
+	return db.queryBadges(" WHERE software_sc_id = ? ORDER BY issue_date DESC, commit_id", scID)
+}
+
+// FindBadgeBySlug returns the newest published badge of a Software Catalogue
+// project whose certificate name has the given slug, or nil if none, so that
+// vanity URLs follow a certificate when it is reissued under a new commit ID
+func (db *DB) FindBadgeBySlug(scID, slug string) (*Badge, error) {
+	return db.findSoftwareBadge(scID, func(b *Badge) bool {
+		return b.IsPublished() && b.CertificateSlug() == slug
+	})
+}
+
+// FindLatestValidBadge returns the most recently issued published, valid and
+// unexpired badge of a Software Catalogue project whose certificate name has
+// the given slug, or of any certificate if slug is empty, or nil if none
+func (db *DB) FindLatestValidBadge(scID, slug string) (*Badge, error) {
+	return db.findSoftwareBadge(scID, func(b *Badge) bool {
+		return b.IsPublished() && b.DisplayStatus() == "valid" && (slug == "" || b.CertificateSlug() == slug)
+	})
+}
+
+// findSoftwareBadge returns the newest badge of a Software Catalogue project
+// accepted by match, or nil if none
+func (db *DB) findSoftwareBadge(scID string, match func(b *Badge) bool) (*Badge, error) {
+	badges, err := db.ListBadgesBySoftwareSCID(scID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range badges {
+		if match(b) {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListBadgesByIssuer retrieves the badges linked to an issuer profile, newest first
+func (db *DB) ListBadgesByIssuer(issuerID string) ([]*Badge, error) {
+	return db.queryBadges(" WHERE issuer_id = ? ORDER BY issue_date DESC, commit_id", issuerID)
+}
+
+// queryBadges retrieves the badges matching an optional WHERE clause
+func (db *DB) queryBadges(where string, args ...interface{}) ([]*Badge, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
 		SELECT 
 			commit_id, type, status, issuer, issue_date, 
 			software_name, software_version, software_url, notes, svg_content, 
 			expiry_date, issuer_url, custom_config, last_review, jpg_content, png_content,
 			covered_version, repository_link, public_note, internal_note, contact_details,
-			certificate_name, specialty_domain, software_sc_id, software_sc_url
+			certificate_name, specialty_domain, software_sc_id, software_sc_url,
+			png_key, jpg_key, git_repository, git_commit_sha, git_tag, issuer_id, org_id, publish_at,
+			certificate_type_id, `+issuerTimezoneColumn+`
 		FROM badges
-	`)
+	`+where, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list badges: %w", err)
 	}
@@ -488,11 +1305,13 @@ func (db *DB) ListBadges() ([]*Badge, error) {
 	for rows.Next() {
 		var badge Badge
 		err := rows.Scan(
-			&badge.CommitID, &badge.Type, &badge.Status, &badge.Issuer, &badge.IssueDate,
+			&badge.CommitID, &badge.Type, &badge.Status, &badge.Issuer, scanDate(&badge.IssueDate),
 			&badge.SoftwareName, &badge.SoftwareVersion, &badge.SoftwareURL, &badge.Notes, &badge.SVGContent,
-			&badge.ExpiryDate, &badge.IssuerURL, &badge.CustomConfig, &badge.LastReview, &badge.JPGContent, &badge.PNGContent,
+			scanNullDate(&badge.ExpiryDate), &badge.IssuerURL, &badge.CustomConfig, scanNullDate(&badge.LastReview), &badge.JPGContent, &badge.PNGContent,
 			&badge.CoveredVersion, &badge.RepositoryLink, &badge.PublicNote, &badge.InternalNote, &badge.ContactDetails,
 			&badge.CertificateName, &badge.SpecialtyDomain, &badge.SoftwareSCID, &badge.SoftwareSCURL,
+			&badge.PNGKey, &badge.JPGKey, &badge.GitRepository, &badge.GitCommitSHA, &badge.GitTag, &badge.IssuerID, &badge.OrgID, &badge.PublishAt,
+			&badge.CertificateTypeID, &badge.IssuerTimezone,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan badge: %w", err)
@@ -509,36 +1328,45 @@ func (db *DB) ListBadges() ([]*Badge, error) {
 
 // ==================== User CRUD Operations ====================
 
-// CreateUser creates a new user in the database
+// CreateUser creates a new user in the database, recording its user.created
+// event
 func (db *DB) CreateUser(user *User) error {
-	_, err := db.Exec(`
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		_, err := tx.conn().ExecContext(ctx, `
 		INSERT INTO users (
 			user_id, username, email, password_hash, first_name, last_name,
-			role_id, created_at, updated_at, status, failed_attempts
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			role_id, created_at, updated_at, status, failed_attempts, must_change_password, org_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
-		user.UserID, user.Username, user.Email, user.PasswordHash, user.FirstName, user.LastName,
-		user.RoleID, user.CreatedAt, user.UpdatedAt, user.Status, user.FailedAttempts,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
-	}
+			user.UserID, user.Username, NormalizeEmail(user.Email), user.PasswordHash, user.FirstName, user.LastName,
+			user.RoleID, user.CreatedAt, user.UpdatedAt, user.Status, user.FailedAttempts, user.MustChangePassword, user.OrgID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
 
-	return nil
+		return tx.recordEvent(EventUserCreated, user.UserID, user.OrgID.String, newUserEvent(user))
+	})
 }
 
 // GetUser retrieves a user from the database by user ID
 func (db *DB) GetUser(userID string) (*User, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var user User
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
 			user_id, username, email, password_hash, first_name, last_name,
-			role_id, created_at, updated_at, last_login, status, failed_attempts
+			role_id, created_at, updated_at, last_login, status, failed_attempts, must_change_password, org_id
 		FROM users
 		WHERE user_id = ?
 	`, userID).Scan(
 		&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
-		&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts,
+		&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts, &user.MustChangePassword, &user.OrgID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -552,16 +1380,19 @@ func (db *DB) GetUser(userID string) (*User, error) {
 
 // GetUserByUsername retrieves a user from the database by username
 func (db *DB) GetUserByUsername(username string) (*User, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var user User
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
 			user_id, username, email, password_hash, first_name, last_name,
-			role_id, created_at, updated_at, last_login, status, failed_attempts
+			role_id, created_at, updated_at, last_login, status, failed_attempts, must_change_password, org_id
 		FROM users
 		WHERE username = ?
 	`, username).Scan(
 		&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
-		&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts,
+		&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts, &user.MustChangePassword, &user.OrgID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -573,39 +1404,48 @@ func (db *DB) GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
-// GetUserByEmail retrieves a user from the database by email
+// GetUserByEmail retrieves a user from the database by email, ignoring its
+// case, or nil if there is none
 func (db *DB) GetUserByEmail(email string) (*User, error) {
-    var user User
-    err := db.QueryRow(`
-        SELECT 
-            user_id, username, email, password_hash, first_name, last_name,
-            role_id, created_at, updated_at, last_login, status, failed_attempts
-        FROM users
-        WHERE email = ?
-    `, email).Scan(
-        &user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
-        &user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts,
-    )
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return nil, nil // User not found
-        }
-        return nil, fmt.Errorf("failed to get user by email: %w", err)
-    }
-
-    return &user, nil
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var user User
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT 
+			user_id, username, email, password_hash, first_name, last_name,
+			role_id, created_at, updated_at, last_login, status, failed_attempts, must_change_password, org_id
+		FROM users
+		WHERE email = ?
+	`, NormalizeEmail(email)).Scan(
+		&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
+		&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts, &user.MustChangePassword, &user.OrgID,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User not found
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return &user, nil
 }
 
 // UpdateUser updates an existing user in the database
 func (db *DB) UpdateUser(user *User) error {
-	_, err := db.Exec(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
 		UPDATE users SET
 			username = ?, email = ?, password_hash = ?, first_name = ?, last_name = ?,
-			role_id = ?, updated_at = ?, last_login = ?, status = ?, failed_attempts = ?
+			role_id = ?, updated_at = ?, last_login = ?, status = ?, failed_attempts = ?,
+			must_change_password = ?, org_id = ?
 		WHERE user_id = ?
 	`,
-		user.Username, user.Email, user.PasswordHash, user.FirstName, user.LastName,
+		user.Username, NormalizeEmail(user.Email), user.PasswordHash, user.FirstName, user.LastName,
 		user.RoleID, user.UpdatedAt, user.LastLogin, user.Status, user.FailedAttempts,
+		user.MustChangePassword, user.OrgID,
 		user.UserID,
 	)
 	if err != nil {
@@ -616,9 +1456,13 @@ func (db *DB) UpdateUser(user *User) error {
 }
 
 // UpdateUserPassword updates only the password hash (and updated_at) for a user
+// and clears any pending forced password change
 func (db *DB) UpdateUserPassword(userID, passwordHash string) error {
-	_, err := db.Exec(
-		"UPDATE users SET password_hash = ?, updated_at = ? WHERE user_id = ?",
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, 
+		"UPDATE users SET password_hash = ?, updated_at = ?, must_change_password = 0 WHERE user_id = ?",
 		passwordHash, time.Now(), userID,
 	)
 	if err != nil {
@@ -628,22 +1472,42 @@ func (db *DB) UpdateUserPassword(userID, passwordHash string) error {
 	return nil
 }
 
-// DeleteUser deletes a user from the database
+// DeleteUser deletes a user from the database along with their group
+// memberships, recording its user.deleted event
 func (db *DB) DeleteUser(userID string) error {
-	_, err := db.Exec("DELETE FROM users WHERE user_id = ?", userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
-	}
+	return db.WithTx(func(tx *DB) error {
+		orgID, err := tx.userOrgID(userID)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM group_members WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete user group memberships: %w", err)
+		}
+		res, err := tx.conn().ExecContext(ctx, "DELETE FROM users WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return nil // User not found
+		}
+
+		return tx.recordEvent(EventUserDeleted, userID, orgID, map[string]string{"user_id": userID})
+	})
 }
 
 // ListUsers retrieves all users from the database
 func (db *DB) ListUsers() ([]*User, error) {
-	rows, err := db.Query(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
 		SELECT 
 			user_id, username, email, password_hash, first_name, last_name,
-			role_id, created_at, updated_at, last_login, status, failed_attempts
+			role_id, created_at, updated_at, last_login, status, failed_attempts, must_change_password, org_id
 		FROM users
 	`)
 	if err != nil {
@@ -656,7 +1520,7 @@ func (db *DB) ListUsers() ([]*User, error) {
 		var user User
 		err := rows.Scan(
 			&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
-			&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts,
+			&user.RoleID, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Status, &user.FailedAttempts, &user.MustChangePassword, &user.OrgID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
@@ -673,7 +1537,10 @@ func (db *DB) ListUsers() ([]*User, error) {
 
 // UpdateUserFailedAttempts increments the failed login attempts for a user
 func (db *DB) UpdateUserFailedAttempts(userID string, attempts int) error {
-	_, err := db.Exec("UPDATE users SET failed_attempts = ? WHERE user_id = ?", attempts, userID)
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE users SET failed_attempts = ? WHERE user_id = ?", attempts, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update user failed attempts: %w", err)
 	}
@@ -683,7 +1550,10 @@ func (db *DB) UpdateUserFailedAttempts(userID string, attempts int) error {
 
 // UpdateUserLastLogin updates the last login timestamp for a user
 func (db *DB) UpdateUserLastLogin(userID string, lastLogin time.Time) error {
-	_, err := db.Exec("UPDATE users SET last_login = ? WHERE user_id = ?", lastLogin, userID)
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE users SET last_login = ? WHERE user_id = ?", lastLogin, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update user last login: %w", err)
 	}
@@ -695,12 +1565,15 @@ func (db *DB) UpdateUserLastLogin(userID string, lastLogin time.Time) error {
 
 // CreateRole creates a new role in the database
 func (db *DB) CreateRole(role *Role) error {
-	_, err := db.Exec(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
 		INSERT INTO roles (
-			role_id, name, description, permissions, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?)
+			role_id, name, description, permissions, inherits, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
 	`,
-		role.RoleID, role.Name, role.Description, role.Permissions, role.CreatedAt, role.UpdatedAt,
+		role.RoleID, role.Name, role.Description, role.Permissions, role.Inherits, role.CreatedAt, role.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create role: %w", err)
@@ -711,14 +1584,17 @@ func (db *DB) CreateRole(role *Role) error {
 
 // GetRole retrieves a role from the database by role ID
 func (db *DB) GetRole(roleID string) (*Role, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var role Role
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
-			role_id, name, description, permissions, created_at, updated_at
+			role_id, name, description, permissions, inherits, created_at, updated_at
 		FROM roles
 		WHERE role_id = ?
 	`, roleID).Scan(
-		&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt,
+		&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.Inherits, &role.CreatedAt, &role.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -732,14 +1608,17 @@ func (db *DB) GetRole(roleID string) (*Role, error) {
 
 // GetRoleByName retrieves a role from the database by name
 func (db *DB) GetRoleByName(name string) (*Role, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var role Role
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
-			role_id, name, description, permissions, created_at, updated_at
+			role_id, name, description, permissions, inherits, created_at, updated_at
 		FROM roles
 		WHERE name = ?
 	`, name).Scan(
-		&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt,
+		&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.Inherits, &role.CreatedAt, &role.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -753,12 +1632,15 @@ func (db *DB) GetRoleByName(name string) (*Role, error) {
 
 // UpdateRole updates an existing role in the database
 func (db *DB) UpdateRole(role *Role) error {
-	_, err := db.Exec(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
 		UPDATE roles SET
-			name = ?, description = ?, permissions = ?, updated_at = ?
+			name = ?, description = ?, permissions = ?, inherits = ?, updated_at = ?
 		WHERE role_id = ?
 	`,
-		role.Name, role.Description, role.Permissions, role.UpdatedAt,
+		role.Name, role.Description, role.Permissions, role.Inherits, role.UpdatedAt,
 		role.RoleID,
 	)
 	if err != nil {
@@ -770,7 +1652,10 @@ func (db *DB) UpdateRole(role *Role) error {
 
 // DeleteRole deletes a role from the database
 func (db *DB) DeleteRole(roleID string) error {
-	_, err := db.Exec("DELETE FROM roles WHERE role_id = ?", roleID)
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "DELETE FROM roles WHERE role_id = ?", roleID)
 	if err != nil {
 		return fmt.Errorf("failed to delete role: %w", err)
 	}
@@ -778,12 +1663,29 @@ func (db *DB) DeleteRole(roleID string) error {
 	return nil
 }
 
-// ListRoles retrieves all roles from the database
+// CountUsersWithRole returns how many users have a role
+func (db *DB) CountUsersWithRole(roleID string) (int, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var count int
+	if err := db.conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role_id = ?", roleID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users with role: %w", err)
+	}
+
+	return count, nil
+}
+
+// ListRoles retrieves all roles from the database, by name
 func (db *DB) ListRoles() ([]*Role, error) {
-	rows, err := db.Query(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
 		SELECT 
-			role_id, name, description, permissions, created_at, updated_at
+			role_id, name, description, permissions, inherits, created_at, updated_at
 		FROM roles
+		ORDER BY name
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list roles: %w", err)
@@ -794,7 +1696,7 @@ func (db *DB) ListRoles() ([]*Role, error) {
 	for rows.Next() {
 		var role Role
 		err := rows.Scan(
-			&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt,
+			&role.RoleID, &role.Name, &role.Description, &role.Permissions, &role.Inherits, &role.CreatedAt, &role.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan role: %w", err)
@@ -811,36 +1713,51 @@ func (db *DB) ListRoles() ([]*Role, error) {
 
 // ==================== API Key CRUD Operations ====================
 
-// CreateAPIKey creates a new API key in the database
+// CreateAPIKey creates a new API key in the database, recording its
+// key.created event in the organization of its owner
 func (db *DB) CreateAPIKey(apiKey *APIKey) error {
-	_, err := db.Exec(`
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		_, err := tx.conn().ExecContext(ctx, `
 		INSERT INTO api_keys (
 			api_key_id, user_id, api_key, name, permissions,
-			created_at, expires_at, status, ip_restrictions
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			created_at, expires_at, status, ip_restrictions, monthly_quota, notify_url, lookup_hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
-		apiKey.APIKeyID, apiKey.UserID, apiKey.APIKey, apiKey.Name, apiKey.Permissions,
-		apiKey.CreatedAt, apiKey.ExpiresAt, apiKey.Status, apiKey.IPRestrictions,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create API key: %w", err)
-	}
+			apiKey.APIKeyID, apiKey.UserID, apiKey.APIKey, apiKey.Name, apiKey.Permissions,
+			apiKey.CreatedAt, apiKey.ExpiresAt, apiKey.Status, apiKey.IPRestrictions, apiKey.MonthlyQuota, apiKey.NotifyURL,
+			apiKey.LookupHash,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
 
-	return nil
+		orgID, err := tx.userOrgID(apiKey.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(EventKeyCreated, apiKey.APIKeyID, orgID, newKeyEvent(apiKey))
+	})
 }
 
 // GetAPIKey retrieves an API key from the database by API key ID
 func (db *DB) GetAPIKey(apiKeyID string) (*APIKey, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var apiKey APIKey
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
 			api_key_id, user_id, api_key, name, permissions,
-			created_at, expires_at, last_used, status, ip_restrictions
+			created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash
 		FROM api_keys
 		WHERE api_key_id = ?
 	`, apiKeyID).Scan(
 		&apiKey.APIKeyID, &apiKey.UserID, &apiKey.APIKey, &apiKey.Name, &apiKey.Permissions,
-		&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions,
+		&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions, &apiKey.MonthlyQuota,
+		&apiKey.NotifyURL, &apiKey.ExpiryNotice, &apiKey.LookupHash,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -854,16 +1771,20 @@ func (db *DB) GetAPIKey(apiKeyID string) (*APIKey, error) {
 
 // GetAPIKeyByKey retrieves an API key from the database by the hashed key value
 func (db *DB) GetAPIKeyByKey(hashedKey string) (*APIKey, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
 	var apiKey APIKey
-	err := db.QueryRow(`
+	err := db.conn().QueryRowContext(ctx, `
 		SELECT 
 			api_key_id, user_id, api_key, name, permissions,
-			created_at, expires_at, last_used, status, ip_restrictions
+			created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash
 		FROM api_keys
 		WHERE api_key = ?
 	`, hashedKey).Scan(
 		&apiKey.APIKeyID, &apiKey.UserID, &apiKey.APIKey, &apiKey.Name, &apiKey.Permissions,
-		&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions,
+		&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions, &apiKey.MonthlyQuota,
+		&apiKey.NotifyURL, &apiKey.ExpiryNotice, &apiKey.LookupHash,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -875,39 +1796,129 @@ func (db *DB) GetAPIKeyByKey(hashedKey string) (*APIKey, error) {
 	return &apiKey, nil
 }
 
-// UpdateAPIKey updates an existing API key in the database
-func (db *DB) UpdateAPIKey(apiKey *APIKey) error {
-	_, err := db.Exec(`
-		UPDATE api_keys SET
-			name = ?, permissions = ?, expires_at = ?, last_used = ?, status = ?, ip_restrictions = ?
-		WHERE api_key_id = ?
-	`,
-		apiKey.Name, apiKey.Permissions, apiKey.ExpiresAt, apiKey.LastUsed, apiKey.Status, apiKey.IPRestrictions,
-		apiKey.APIKeyID,
+// GetAPIKeyByLookupHash retrieves an API key from the database by the SHA-256
+// of the raw key, see APIKey.LookupHash
+func (db *DB) GetAPIKeyByLookupHash(lookupHash string) (*APIKey, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var apiKey APIKey
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT
+			api_key_id, user_id, api_key, name, permissions,
+			created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash
+		FROM api_keys
+		WHERE lookup_hash = ?
+	`, lookupHash).Scan(
+		&apiKey.APIKeyID, &apiKey.UserID, &apiKey.APIKey, &apiKey.Name, &apiKey.Permissions,
+		&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions, &apiKey.MonthlyQuota,
+		&apiKey.NotifyURL, &apiKey.ExpiryNotice, &apiKey.LookupHash,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update API key: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, nil // API key not found
+		}
+		return nil, fmt.Errorf("failed to get API key by lookup hash: %w", err)
 	}
 
-	return nil
+	return &apiKey, nil
 }
 
-// DeleteAPIKey deletes an API key from the database
-func (db *DB) DeleteAPIKey(apiKeyID string) error {
-	_, err := db.Exec("DELETE FROM api_keys WHERE api_key_id = ?", apiKeyID)
+// SetAPIKeyLookupHash indexes an API key created before lookup hashes by the
+// SHA-256 of its raw key
+func (db *DB) SetAPIKeyLookupHash(apiKeyID, lookupHash string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE api_keys SET lookup_hash = ? WHERE api_key_id = ?", lookupHash, apiKeyID)
 	if err != nil {
-		return fmt.Errorf("failed to delete API key: %w", err)
+		return fmt.Errorf("failed to set API key lookup hash: %w", err)
 	}
 
 	return nil
 }
 
+// UpdateAPIKey updates an existing API key in the database, recording its
+// key.revoked or key.expired event when its status changes to one of them
+func (db *DB) UpdateAPIKey(apiKey *APIKey) error {
+	return db.WithTx(func(tx *DB) error {
+		prev, found, err := tx.apiKeyStatus(apiKey.APIKeyID)
+		if err != nil || !found {
+			return err
+		}
+
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		_, err = tx.conn().ExecContext(ctx, `
+		UPDATE api_keys SET
+			name = ?, permissions = ?, expires_at = ?, last_used = ?, status = ?, ip_restrictions = ?, monthly_quota = ?,
+			notify_url = ?, expiry_notice = ?
+		WHERE api_key_id = ?
+	`,
+			apiKey.Name, apiKey.Permissions, apiKey.ExpiresAt, apiKey.LastUsed, apiKey.Status, apiKey.IPRestrictions, apiKey.MonthlyQuota,
+			apiKey.NotifyURL, apiKey.ExpiryNotice, apiKey.APIKeyID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update API key: %w", err)
+		}
+
+		return tx.recordKeyStatusEvent(apiKey, prev)
+	})
+}
+
+// RotateAPIKey replaces the secret of an API key with a new bcrypt hash and
+// lookup hash, keeping its ID, permissions and usage, and records its
+// key.rotated event. The previous secret stops working right away.
+func (db *DB) RotateAPIKey(apiKeyID, hashedKey, lookupHash string) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		_, err := tx.conn().ExecContext(ctx, `
+		UPDATE api_keys SET api_key = ?, lookup_hash = ? WHERE api_key_id = ?
+	`, hashedKey, lookupHash, apiKeyID)
+		if err != nil {
+			return fmt.Errorf("failed to rotate API key: %w", err)
+		}
+
+		apiKey, err := tx.GetAPIKey(apiKeyID)
+		if err != nil || apiKey == nil {
+			return err
+		}
+		orgID, err := tx.userOrgID(apiKey.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(EventKeyRotated, apiKeyID, orgID, newKeyEvent(apiKey))
+	})
+}
+
+// DeleteAPIKey deletes an API key from the database, with its usage
+func (db *DB) DeleteAPIKey(apiKeyID string) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM api_key_usage WHERE api_key_id = ?", apiKeyID); err != nil {
+			return fmt.Errorf("failed to delete API key usage: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM api_keys WHERE api_key_id = ?", apiKeyID); err != nil {
+			return fmt.Errorf("failed to delete API key: %w", err)
+		}
+		return nil
+	})
+}
+
 // ListAPIKeys retrieves all API keys from the database
 func (db *DB) ListAPIKeys() ([]*APIKey, error) {
-	rows, err := db.Query(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
 		SELECT 
 			api_key_id, user_id, api_key, name, permissions,
-			created_at, expires_at, last_used, status, ip_restrictions
+			created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash
 		FROM api_keys
 	`)
 	if err != nil {
@@ -920,7 +1931,8 @@ func (db *DB) ListAPIKeys() ([]*APIKey, error) {
 		var apiKey APIKey
 		err := rows.Scan(
 			&apiKey.APIKeyID, &apiKey.UserID, &apiKey.APIKey, &apiKey.Name, &apiKey.Permissions,
-			&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions,
+			&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions, &apiKey.MonthlyQuota,
+			&apiKey.NotifyURL, &apiKey.ExpiryNotice, &apiKey.LookupHash,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
@@ -937,10 +1949,13 @@ func (db *DB) ListAPIKeys() ([]*APIKey, error) {
 
 // ListAPIKeysByUser retrieves all API keys for a specific user
 func (db *DB) ListAPIKeysByUser(userID string) ([]*APIKey, error) {
-	rows, err := db.Query(`
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
 		SELECT 
 			api_key_id, user_id, api_key, name, permissions,
-			created_at, expires_at, last_used, status, ip_restrictions
+			created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash
 		FROM api_keys
 		WHERE user_id = ?
 	`, userID)
@@ -954,7 +1969,8 @@ func (db *DB) ListAPIKeysByUser(userID string) ([]*APIKey, error) {
 		var apiKey APIKey
 		err := rows.Scan(
 			&apiKey.APIKeyID, &apiKey.UserID, &apiKey.APIKey, &apiKey.Name, &apiKey.Permissions,
-			&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions,
+			&apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsed, &apiKey.Status, &apiKey.IPRestrictions, &apiKey.MonthlyQuota,
+			&apiKey.NotifyURL, &apiKey.ExpiryNotice, &apiKey.LookupHash,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
@@ -969,157 +1985,801 @@ func (db *DB) ListAPIKeysByUser(userID string) ([]*APIKey, error) {
 	return apiKeys, nil
 }
 
-// UpdateAPIKeyLastUsed updates the last used timestamp for an API key
-func (db *DB) UpdateAPIKeyLastUsed(apiKeyID string, lastUsed time.Time) error {
-	_, err := db.Exec("UPDATE api_keys SET last_used = ? WHERE api_key_id = ?", lastUsed, apiKeyID)
-	if err != nil {
-		return fmt.Errorf("failed to update API key last used: %w", err)
-	}
-
-	return nil
-}
+// SetAPIKeyStatus sets the status of an API key, recording its key.revoked or
+// key.expired event
+func (db *DB) SetAPIKeyStatus(apiKeyID, status string) error {
+	return db.WithTx(func(tx *DB) error {
+		prev, found, err := tx.apiKeyStatus(apiKeyID)
+		if err != nil || !found {
+			return err
+		}
 
-// addInitialBadges ensures that specific initial badges exist in the database; if not, it inserts them
-// using full field data loaded from a JSON file at db/initial_badges.json.
-func addInitialBadges(db *sql.DB) error {
-	// IDs we must ensure exist
-	initialIDs := []string{"NMAAS_slSAD", "NMAAS_slVD", "EDREP20_slSAD", "EDREP20_slVD", "SOFTCAT_slSAD", "SOFTCAT_slVSL"}
+		ctx, cancel := tx.queryContext()
+		defer cancel()
 
-	// Helper to build nullable strings
-	ns := func(s string) sql.NullString {
-		if s == "" {
-			return sql.NullString{Valid: false}
+		_, err = tx.conn().ExecContext(ctx, "UPDATE api_keys SET status = ? WHERE api_key_id = ?", status, apiKeyID)
+		if err != nil {
+			return fmt.Errorf("failed to set API key status: %w", err)
 		}
-		return sql.NullString{String: s, Valid: true}
-	}
 
-	// Helper to build nullable strings from json.RawMessage
-	// Handles both quoted strings (old format) and JSON arrays (new format)
-	nsRaw := func(raw json.RawMessage) sql.NullString {
-		if len(raw) == 0 || string(raw) == "null" {
-			return sql.NullString{Valid: false}
+		if keyStatusEvent(prev, status) == "" {
+			return nil
 		}
-		// If it's a quoted string, unquote it
-		var s string
-		if err := json.Unmarshal(raw, &s); err == nil {
-			if s == "" {
-				return sql.NullString{Valid: false}
-			}
-			return sql.NullString{String: s, Valid: true}
-		}
-		// Otherwise store as-is (JSON array)
-		return sql.NullString{String: string(raw), Valid: true}
-	}
-
-	// Load JSON data
-	type badgeJSON struct {
-		CommitID        string `json:"commit_id"`
-		Type            string `json:"type"`
-		Status          string `json:"status"`
-		Issuer          string `json:"issuer"`
-		IssueDate       string `json:"issue_date"`
-		SoftwareName    string `json:"software_name"`
-		SoftwareVersion string `json:"software_version"`
-		SoftwareURL     string `json:"software_url"`
-		Notes           string `json:"notes"`
-		ExpiryDate      string `json:"expiry_date"`
-		IssuerURL       string `json:"issuer_url"`
-		CustomConfig    string `json:"custom_config"`
-		LastReview      string `json:"last_review"`
-		CoveredVersion  string `json:"covered_version"`
-		RepositoryLink  json.RawMessage `json:"repository_link"`
-		PublicNote      string `json:"public_note"`
-		InternalNote    string `json:"internal_note"`
-		ContactDetails  string `json:"contact_details"`
-		CertificateName string `json:"certificate_name"`
-		SpecialtyDomain string `json:"specialty_domain"`
-		SoftwareSCID    string `json:"software_sc_id"`
-		SoftwareSCURL   string `json:"software_sc_url"`
-	}
-
-	// JSON is an object mapping commit_id -> badgeJSON
-	var badgeMap map[string]badgeJSON
-	jsonBytes, err := os.ReadFile("db/initial_badges.json")
-	if err == nil {
-		_ = json.Unmarshal(jsonBytes, &badgeMap)
-	}
-
-	for _, id := range initialIDs {
-		// Check if the badge already exists
-		var count int
-		if err := db.QueryRow("SELECT COUNT(*) FROM badges WHERE commit_id = ?", id).Scan(&count); err != nil {
-			return fmt.Errorf("failed to check for initial badge %s: %w", id, err)
+		key, err := tx.GetAPIKey(apiKeyID)
+		if err != nil || key == nil {
+			return err
 		}
-		if count > 0 {
-			continue
+		return tx.recordKeyStatusEvent(key, prev)
+	})
+}
+
+// SetAPIKeyExpiryNotice records the last expiry warning sent for an API key,
+// in days before its expiry
+func (db *DB) SetAPIKeyExpiryNotice(apiKeyID string, days int) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE api_keys SET expiry_notice = ? WHERE api_key_id = ?", days, apiKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to set API key expiry notice: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyLastUsed updates the last used timestamp for an API key
+func (db *DB) UpdateAPIKeyLastUsed(apiKeyID string, lastUsed time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE api_keys SET last_used = ? WHERE api_key_id = ?", lastUsed, apiKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key last used: %w", err)
+	}
+
+	return nil
+}
+
+// ==================== Issuer CRUD Operations ====================
+
+// issuerColumns lists the issuers columns in the order scanIssuer expects
+const issuerColumns = "issuer_id, name, url, logo, contact, public_key, timezone, created_at, updated_at"
+
+// scanIssuer scans an issuer row
+func scanIssuer(row interface{ Scan(...interface{}) error }) (*Issuer, error) {
+	var i Issuer
+	err := row.Scan(&i.IssuerID, &i.Name, &i.URL, &i.Logo, &i.Contact, &i.PublicKey, &i.Timezone, &i.CreatedAt, &i.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// CreateIssuer creates a new issuer profile in the database
+func (db *DB) CreateIssuer(i *Issuer) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO issuers (`+issuerColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, i.IssuerID, i.Name, i.URL, i.Logo, i.Contact, i.PublicKey, i.Timezone, i.CreatedAt, i.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create issuer: %w", err)
+	}
+
+	return nil
+}
+
+// GetIssuer retrieves an issuer profile from the database by ID
+func (db *DB) GetIssuer(issuerID string) (*Issuer, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	i, err := scanIssuer(db.conn().QueryRowContext(ctx, "SELECT "+issuerColumns+" FROM issuers WHERE issuer_id = ?", issuerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Issuer not found
 		}
+		return nil, fmt.Errorf("failed to get issuer: %w", err)
+	}
 
-		// Choose data source: JSON entry if present, otherwise sensible defaults
-		var bj badgeJSON
-		if badgeMap != nil {
-			if v, ok := badgeMap[id]; ok {
-				bj = v
-			}
+	return i, nil
+}
+
+// ListIssuers retrieves all issuer profiles from the database
+func (db *DB) ListIssuers() ([]*Issuer, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT " + issuerColumns + " FROM issuers ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issuers: %w", err)
+	}
+	defer rows.Close()
+
+	var issuers []*Issuer
+	for rows.Next() {
+		i, err := scanIssuer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan issuer: %w", err)
+		}
+		issuers = append(issuers, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating issuers: %w", err)
+	}
+
+	return issuers, nil
+}
+
+// UpdateIssuer updates an issuer profile and copies its name and URL to the
+// linked badges, dropping their stored renders so they are regenerated. A new
+// timezone drops the renders of the linked badges that expire.
+func (db *DB) UpdateIssuer(i *Issuer) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE badges SET png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE issuer_id = ? AND expiry_date IS NOT NULL
+			AND (SELECT timezone FROM issuers WHERE issuer_id = ?) IS NOT ?
+	`, i.IssuerID, i.IssuerID, i.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to update issuer badges: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE issuers SET name = ?, url = ?, logo = ?, contact = ?, public_key = ?, timezone = ?, updated_at = ?
+		WHERE issuer_id = ?
+	`, i.Name, i.URL, i.Logo, i.Contact, i.PublicKey, i.Timezone, i.UpdatedAt, i.IssuerID)
+	if err != nil {
+		return fmt.Errorf("failed to update issuer: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE badges SET issuer = ?, issuer_url = ?,
+			png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE issuer_id = ? AND (issuer <> ? OR issuer_url IS NOT ?)
+	`, i.Name, i.URL, i.IssuerID, i.Name, i.URL)
+	if err != nil {
+		return fmt.Errorf("failed to update issuer badges: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteIssuer deletes an issuer profile and unlinks its badges, which keep
+// their free-text issuer
+func (db *DB) DeleteIssuer(issuerID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE badges SET issuer_id = NULL WHERE issuer_id = ?", issuerID); err != nil {
+		return fmt.Errorf("failed to unlink issuer badges: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM issuers WHERE issuer_id = ?", issuerID); err != nil {
+		return fmt.Errorf("failed to delete issuer: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ==================== Organization CRUD Operations ====================
+
+// orgColumns lists the organizations columns in the order scanOrganization expects
+const orgColumns = "org_id, name, theme, forges, connectors, created_at, updated_at"
+
+// scanOrganization scans an organization row
+func scanOrganization(row interface{ Scan(...interface{}) error }) (*Organization, error) {
+	var o Organization
+	if err := row.Scan(&o.OrgID, &o.Name, &o.Theme, &o.Forges, &o.Connectors, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// CreateOrganization creates a new organization in the database
+func (db *DB) CreateOrganization(o *Organization) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO organizations (`+orgColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, o.OrgID, o.Name, o.Theme, o.Forges, o.Connectors, o.CreatedAt, o.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetOrganization retrieves an organization from the database by ID
+func (db *DB) GetOrganization(orgID string) (*Organization, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	o, err := scanOrganization(db.conn().QueryRowContext(ctx, "SELECT "+orgColumns+" FROM organizations WHERE org_id = ?", orgID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Organization not found
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return o, nil
+}
+
+// ListOrganizations retrieves all organizations from the database
+func (db *DB) ListOrganizations() ([]*Organization, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT " + orgColumns + " FROM organizations ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*Organization
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating organizations: %w", err)
+	}
+
+	return orgs, nil
+}
+
+// UpdateOrganization updates an organization and drops the stored renders of
+// its badges, which may have been drawn with the previous theme
+func (db *DB) UpdateOrganization(o *Organization) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE organizations SET name = ?, theme = ?, forges = ?, connectors = ?, updated_at = ? WHERE org_id = ?",
+		o.Name, o.Theme, o.Forges, o.Connectors, o.UpdatedAt, o.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE badges SET png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE org_id = ?
+	`, o.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to clear organization badge images: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteOrganization deletes an organization. Its users and badges stay and
+// become instance-level.
+func (db *DB) DeleteOrganization(orgID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"UPDATE users SET org_id = NULL WHERE org_id = ?",
+		`UPDATE badges SET org_id = NULL, png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+			WHERE org_id = ?`,
+		"DELETE FROM organizations WHERE org_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, orgID); err != nil {
+			return fmt.Errorf("failed to delete organization: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListBadgesByOrg retrieves the badges owned by an organization
+func (db *DB) ListBadgesByOrg(orgID string) ([]*Badge, error) {
+	return db.queryBadges(" WHERE org_id = ? ORDER BY commit_id", orgID)
+}
+
+// ApplyOrgTheme applies the theme of the badge's organization to its custom
+// config before rendering. Instance-level badges are left unchanged.
+func (db *DB) ApplyOrgTheme(b *Badge) error {
+	if !b.OrgID.Valid {
+		return nil
+	}
+	o, err := db.GetOrganization(b.OrgID.String)
+	if err != nil || o == nil {
+		return err
+	}
+	theme, err := o.GetTheme()
+	if err != nil {
+		return fmt.Errorf("failed to parse theme of organization %s: %w", o.OrgID, err)
+	}
+	return b.ApplyTheme(theme)
+}
+
+// ==================== Group CRUD Operations ====================
+
+// scanGroup scans a groups row; members and badge types are loaded separately
+func scanGroup(row interface{ Scan(...interface{}) error }) (*Group, error) {
+	var g Group
+	if err := row.Scan(&g.GroupID, &g.Name, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// CreateGroup creates a new group with its members and badge types
+func (db *DB) CreateGroup(g *Group) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO groups (group_id, name, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		g.GroupID, g.Name, g.CreatedAt, g.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+	if err := insertGroupLinks(ctx, tx, g); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetGroup retrieves a group with its members and badge types by ID
+func (db *DB) GetGroup(groupID string) (*Group, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	g, err := scanGroup(db.conn().QueryRowContext(ctx, "SELECT group_id, name, created_at, updated_at FROM groups WHERE group_id = ?", groupID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Group not found
 		}
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	if err := db.loadGroupLinks(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListGroups retrieves all groups with their members and badge types
+func (db *DB) ListGroups() ([]*Group, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT group_id, name, created_at, updated_at FROM groups ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
 
-		if bj.CommitID == "" {
-			bj.CommitID = id
+	var groups []*Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
 		}
-		if bj.Type == "" {
-			bj.Type = "badge"
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating groups: %w", err)
+	}
+	rows.Close()
+
+	for _, g := range groups {
+		if err := db.loadGroupLinks(g); err != nil {
+			return nil, err
 		}
-		if bj.Status == "" {
-			bj.Status = "valid"
+	}
+	return groups, nil
+}
+
+// UpdateGroup updates a group and replaces its members and badge types
+func (db *DB) UpdateGroup(g *Group) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE groups SET name = ?, updated_at = ? WHERE group_id = ?", g.Name, g.UpdatedAt, g.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	for _, stmt := range []string{
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM group_badge_types WHERE group_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, g.GroupID); err != nil {
+			return fmt.Errorf("failed to update group: %w", err)
 		}
-		if bj.Issuer == "" {
-			bj.Issuer = "GEANT WP9T2 Software Licencing"
+	}
+	if err := insertGroupLinks(ctx, tx, g); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes a group; badge types it was the only grantee of become
+// unrestricted again
+func (db *DB) DeleteGroup(groupID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM group_badge_types WHERE group_id = ?",
+		"DELETE FROM groups WHERE group_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, groupID); err != nil {
+			return fmt.Errorf("failed to delete group: %w", err)
 		}
-		if bj.IssueDate == "" {
-			bj.IssueDate = time.Now().Format("2006-01-02")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertGroupLinks stores the members and badge types of a group
+func insertGroupLinks(ctx context.Context, tx *txn, g *Group) error {
+	for _, userID := range g.Members {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)", g.GroupID, userID); err != nil {
+			return fmt.Errorf("failed to add group member: %w", err)
 		}
-		if bj.SoftwareName == "" {
-			bj.SoftwareName = "GÉANT Software Catalogue"
+	}
+	for _, badgeType := range g.BadgeTypes {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO group_badge_types (group_id, badge_type) VALUES (?, ?)", g.GroupID, badgeType); err != nil {
+			return fmt.Errorf("failed to add group badge type: %w", err)
 		}
-		if bj.SoftwareVersion == "" {
-			bj.SoftwareVersion = "v1.0.0"
+	}
+	return nil
+}
+
+// loadGroupLinks reads the members and badge types of a group
+func (db *DB) loadGroupLinks(g *Group) error {
+	var err error
+	g.Members, err = db.queryStrings("SELECT user_id FROM group_members WHERE group_id = ? ORDER BY user_id", g.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to get group members: %w", err)
+	}
+	g.BadgeTypes, err = db.queryStrings("SELECT badge_type FROM group_badge_types WHERE group_id = ? ORDER BY badge_type", g.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to get group badge types: %w", err)
+	}
+	return nil
+}
+
+// queryStrings runs a query returning a single text column
+func (db *DB) queryStrings(query string, args ...interface{}) ([]string, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
 		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
 
-		// Insert all metadata fields (excluding media blobs which are generated elsewhere)
-		_, err := db.Exec(`
-			INSERT INTO badges (
-				commit_id, type, status, issuer, issue_date,
-				software_name, software_version, software_url, notes,
-				expiry_date, issuer_url, custom_config, last_review,
-				covered_version, repository_link, public_note, internal_note, contact_details,
-				certificate_name, specialty_domain, software_sc_id, software_sc_url
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`,
-			bj.CommitID,
-			bj.Type,
-			bj.Status,
-			bj.Issuer,
-			bj.IssueDate,
-			bj.SoftwareName,
-			bj.SoftwareVersion,
-			ns(bj.SoftwareURL),
-			ns(bj.Notes),
-			ns(bj.ExpiryDate),
-			ns(bj.IssuerURL),
-			ns(bj.CustomConfig),
-			ns(bj.LastReview),
-			ns(bj.CoveredVersion),
-			nsRaw(bj.RepositoryLink),
-			ns(bj.PublicNote),
-			ns(bj.InternalNote),
-			ns(bj.ContactDetails),
-			ns(bj.CertificateName),
-			ns(bj.SpecialtyDomain),
-			ns(bj.SoftwareSCID),
-			ns(bj.SoftwareSCURL),
-		)
+// UserHasAccessToBadgeType reports whether a user may create, edit or delete
+// badges of the given type. Types not granted to any group are open to every
+// user with badge write permission; restricted types only to the members of
+// the groups they are granted to. Instance-wide admins may always write.
+func (db *DB) UserHasAccessToBadgeType(userID, badgeType string) (bool, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var restricted, member, admin bool
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM group_badge_types WHERE badge_type = ?),
+			EXISTS (SELECT 1 FROM group_badge_types t JOIN group_members m ON m.group_id = t.group_id
+				WHERE t.badge_type = ? AND m.user_id = ?),
+			EXISTS (SELECT 1 FROM users u JOIN roles r ON r.role_id = u.role_id
+				WHERE u.user_id = ? AND r.name = 'admin' AND u.org_id IS NULL)
+	`, badgeType, badgeType, userID, userID).Scan(&restricted, &member, &admin)
+	if err != nil {
+		return false, fmt.Errorf("failed to check badge type access: %w", err)
+	}
+
+	return !restricted || member || admin, nil
+}
+
+// ==================== Template CRUD Operations ====================
+
+// templateColumns lists the templates columns in the order scanTemplate expects
+const templateColumns = "template_id, name, badge_type, content, is_default, created_by, created_at, updated_at"
+
+// scanTemplate scans a template row
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*Template, error) {
+	var t Template
+	err := row.Scan(&t.TemplateID, &t.Name, &t.BadgeType, &t.Content, &t.IsDefault, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTemplate creates a new template in the database
+func (db *DB) CreateTemplate(t *Template) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO templates (`+templateColumns+`)
+		VALUES (?, ?, ?, ?, 0, ?, ?, ?)
+	`, t.TemplateID, t.Name, t.BadgeType, t.Content, t.CreatedBy, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+
+	return nil
+}
+
+// GetTemplate retrieves a template from the database by ID
+func (db *DB) GetTemplate(templateID string) (*Template, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	t, err := scanTemplate(db.conn().QueryRowContext(ctx, "SELECT "+templateColumns+" FROM templates WHERE template_id = ?", templateID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Template not found
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	return t, nil
+}
+
+// GetTemplateByName retrieves a template from the database by name
+func (db *DB) GetTemplateByName(name string) (*Template, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	t, err := scanTemplate(db.conn().QueryRowContext(ctx, "SELECT "+templateColumns+" FROM templates WHERE name = ?", name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Template not found
+		}
+		return nil, fmt.Errorf("failed to get template by name: %w", err)
+	}
+
+	return t, nil
+}
+
+// GetDefaultTemplate retrieves the default template for a badge type
+func (db *DB) GetDefaultTemplate(badgeType string) (*Template, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	t, err := scanTemplate(db.conn().QueryRowContext(ctx, "SELECT "+templateColumns+" FROM templates WHERE badge_type = ? AND is_default = 1", badgeType))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No default template
+		}
+		return nil, fmt.Errorf("failed to get default template: %w", err)
+	}
+
+	return t, nil
+}
+
+// ListTemplates retrieves all templates from the database
+func (db *DB) ListTemplates() ([]*Template, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT " + templateColumns + " FROM templates ORDER BY badge_type, name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*Template
+	for rows.Next() {
+		t, err := scanTemplate(rows)
 		if err != nil {
-			return fmt.Errorf("failed to insert initial badge %s: %w", id, err)
+			return nil, fmt.Errorf("failed to scan template: %w", err)
 		}
+		templates = append(templates, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating templates: %w", err)
+	}
+
+	return templates, nil
+}
+
+// UpdateTemplate updates the name, badge type and content of a template. A
+// default template that moves to another badge type stops being the default.
+func (db *DB) UpdateTemplate(t *Template) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE templates SET
+			name = ?, content = ?, updated_at = ?,
+			is_default = CASE WHEN badge_type = ? THEN is_default ELSE 0 END,
+			badge_type = ?
+		WHERE template_id = ?
+	`, t.Name, t.Content, t.UpdatedAt, t.BadgeType, t.BadgeType, t.TemplateID)
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+
+	return nil
+}
+
+// SetDefaultTemplate makes a template the default for its badge type, replacing
+// the previous default
+func (db *DB) SetDefaultTemplate(templateID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var badgeType string
+	if err := tx.QueryRowContext(ctx, "SELECT badge_type FROM templates WHERE template_id = ?", templateID).Scan(&badgeType); err != nil {
+		return fmt.Errorf("failed to get template: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE templates SET is_default = 0 WHERE badge_type = ?", badgeType); err != nil {
+		return fmt.Errorf("failed to clear default template: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE templates SET is_default = 1 WHERE template_id = ?", templateID); err != nil {
+		return fmt.Errorf("failed to set default template: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UnsetDefaultTemplate stops a template being the default, so its badge type
+// falls back to the template file
+func (db *DB) UnsetDefaultTemplate(templateID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE templates SET is_default = 0 WHERE template_id = ?", templateID)
+	if err != nil {
+		return fmt.Errorf("failed to unset default template: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTemplate deletes a template from the database
+func (db *DB) DeleteTemplate(templateID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "DELETE FROM templates WHERE template_id = ?", templateID)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	return nil
+}
+
+// ClearBadgeImages drops the stored PNG/JPG renders of every badge of a type so
+// they are regenerated, e.g. after its certificate template changed
+func (db *DB) ClearBadgeImages(badgeType string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE badges SET png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE type = ?
+	`, badgeType)
+	if err != nil {
+		return fmt.Errorf("failed to clear badge images: %w", err)
+	}
+
+	return nil
+}
+
+// ClearStoredImages drops the stored PNG/JPG renders of a badge so they are
+// regenerated on the next request
+func (db *DB) ClearStoredImages(commitID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE badges SET png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+		WHERE commit_id = ?
+	`, commitID)
+	if err != nil {
+		return fmt.Errorf("failed to clear badge images: %w", err)
 	}
 
 	return nil
@@ -1129,7 +2789,10 @@ func addInitialBadges(db *sql.DB) error {
 // Tables are deleted in FK-safe order, then re-inserted in FK-safe order.
 // Binary image columns (jpg/png) are set to NULL since they can be regenerated.
 func (db *DB) RestoreAll(roles []*Role, users []*User, apiKeys []*APIKey, badges []*Badge) error {
-	tx, err := db.Begin()
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -1142,17 +2805,17 @@ func (db *DB) RestoreAll(roles []*Role, users []*User, apiKeys []*APIKey, badges
 		"DELETE FROM roles",
 		"DELETE FROM badges",
 	} {
-		if _, err := tx.Exec(stmt); err != nil {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
 			return fmt.Errorf("failed to execute %q: %w", stmt, err)
 		}
 	}
 
 	// Insert roles
 	for _, r := range roles {
-		_, err := tx.Exec(`
-			INSERT INTO roles (role_id, name, description, permissions, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?)`,
-			r.RoleID, r.Name, r.Description, r.Permissions, r.CreatedAt, r.UpdatedAt,
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO roles (role_id, name, description, permissions, inherits, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.RoleID, r.Name, r.Description, r.Permissions, r.Inherits, r.CreatedAt, r.UpdatedAt,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert role %s: %w", r.RoleID, err)
@@ -1161,12 +2824,12 @@ func (db *DB) RestoreAll(roles []*Role, users []*User, apiKeys []*APIKey, badges
 
 	// Insert users
 	for _, u := range users {
-		_, err := tx.Exec(`
+		_, err := tx.ExecContext(ctx, `
 			INSERT INTO users (user_id, username, email, password_hash, first_name, last_name,
-				role_id, created_at, updated_at, last_login, status, failed_attempts)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			u.UserID, u.Username, u.Email, u.PasswordHash, u.FirstName, u.LastName,
-			u.RoleID, u.CreatedAt, u.UpdatedAt, u.LastLogin, u.Status, u.FailedAttempts,
+				role_id, created_at, updated_at, last_login, status, failed_attempts, must_change_password, org_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.UserID, u.Username, NormalizeEmail(u.Email), u.PasswordHash, u.FirstName, u.LastName,
+			u.RoleID, u.CreatedAt, u.UpdatedAt, u.LastLogin, u.Status, u.FailedAttempts, u.MustChangePassword, u.OrgID,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert user %s: %w", u.UserID, err)
@@ -1175,12 +2838,12 @@ func (db *DB) RestoreAll(roles []*Role, users []*User, apiKeys []*APIKey, badges
 
 	// Insert API keys
 	for _, k := range apiKeys {
-		_, err := tx.Exec(`
+		_, err := tx.ExecContext(ctx, `
 			INSERT INTO api_keys (api_key_id, user_id, api_key, name, permissions,
-				created_at, expires_at, last_used, status, ip_restrictions)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				created_at, expires_at, last_used, status, ip_restrictions, monthly_quota, notify_url, expiry_notice, lookup_hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			k.APIKeyID, k.UserID, k.APIKey, k.Name, k.Permissions,
-			k.CreatedAt, k.ExpiresAt, k.LastUsed, k.Status, k.IPRestrictions,
+			k.CreatedAt, k.ExpiresAt, k.LastUsed, k.Status, k.IPRestrictions, k.MonthlyQuota, k.NotifyURL, k.ExpiryNotice, k.LookupHash,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert API key %s: %w", k.APIKeyID, err)
@@ -1189,20 +2852,26 @@ func (db *DB) RestoreAll(roles []*Role, users []*User, apiKeys []*APIKey, badges
 
 	// Insert badges — binary columns (jpg_content, png_content) set to NULL
 	for _, b := range badges {
-		_, err := tx.Exec(`
+		svgContent, err := sanitizeSVGContent(b.SVGContent)
+		if err != nil {
+			return fmt.Errorf("failed to insert badge %s: %w", b.CommitID, err)
+		}
+		_, err = tx.ExecContext(ctx, `
 			INSERT INTO badges (
 				commit_id, type, status, issuer, issue_date,
 				software_name, software_version, software_url, notes, svg_content,
 				expiry_date, issuer_url, custom_config, last_review,
 				jpg_content, png_content,
 				covered_version, repository_link, public_note, internal_note, contact_details,
-				certificate_name, specialty_domain, software_sc_id, software_sc_url
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, NULL, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			b.CommitID, b.Type, b.Status, b.Issuer, b.IssueDate,
-			b.SoftwareName, b.SoftwareVersion, b.SoftwareURL, b.Notes, b.SVGContent,
-			b.ExpiryDate, b.IssuerURL, b.CustomConfig, b.LastReview,
+				certificate_name, specialty_domain, software_sc_id, software_sc_url,
+				git_repository, git_commit_sha, git_tag, issuer_id, org_id, publish_at, certificate_type_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, NULL, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			b.CommitID, b.Type, b.Status, b.Issuer, dateArg(b.IssueDate),
+			b.SoftwareName, b.SoftwareVersion, b.SoftwareURL, b.Notes, svgContent,
+			nullDateArg(b.ExpiryDate), b.IssuerURL, b.CustomConfig, nullDateArg(b.LastReview),
 			b.CoveredVersion, b.RepositoryLink, b.PublicNote, b.InternalNote, b.ContactDetails,
 			b.CertificateName, b.SpecialtyDomain, b.SoftwareSCID, b.SoftwareSCURL,
+			b.GitRepository, b.GitCommitSHA, b.GitTag, b.IssuerID, b.OrgID, utc(b.PublishAt), b.CertificateTypeID,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert badge %s: %w", b.CommitID, err)
@@ -1,11 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/finki/badges/internal/blobstore"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestDatabaseOperations(t *testing.T) {
@@ -32,11 +38,11 @@ func TestDatabaseOperations(t *testing.T) {
 		Type:            "badge",
 		Status:          "valid",
 		Issuer:          "Test Issuer",
-		IssueDate:       "2023-01-01",
+		IssueDate:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 		SoftwareName:    "TestApp",
 		SoftwareVersion: "v1.0.0",
 		Notes:           sql.NullString{String: "Test notes", Valid: true},
-		ExpiryDate:      sql.NullString{String: "2024-01-01", Valid: true},
+		ExpiryDate:      sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
 		IssuerURL:       sql.NullString{String: "https://example.com", Valid: true},
 	}
 
@@ -85,8 +91,8 @@ func TestDatabaseOperations(t *testing.T) {
 		t.Errorf("Expected Notes %s, got %s", testBadge.Notes.String, retrievedBadge.Notes.String)
 	}
 
-	if retrievedBadge.ExpiryDate.String != testBadge.ExpiryDate.String {
-		t.Errorf("Expected ExpiryDate %s, got %s", testBadge.ExpiryDate.String, retrievedBadge.ExpiryDate.String)
+	if !retrievedBadge.ExpiryDate.Time.Equal(testBadge.ExpiryDate.Time) {
+		t.Errorf("Expected ExpiryDate %s, got %s", testBadge.ExpiryDate.Time, retrievedBadge.ExpiryDate.Time)
 	}
 
 	if retrievedBadge.IssuerURL.String != testBadge.IssuerURL.String {
@@ -110,9 +116,12 @@ func TestDatabaseOperations(t *testing.T) {
 		t.Errorf("Expected Status %s, got %s", "expired", updatedBadge.Status)
 	}
 
-	// Test updating badge image
-	imageData := []byte("test image data")
-	err = db.UpdateBadgeImage("test123", "svg", imageData)
+	// Test updating badge image; stored SVG is sanitized
+	imageData := []byte(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><rect width="1" height="1"></rect></svg>`)
+	if err := db.UpdateBadgeImage("test123", "svg", []byte("test image data")); err == nil {
+		t.Error("Expected content that is not SVG to be rejected")
+	}
+	err = db.UpdateBadgeImage("test123", "svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect width="1" height="1"/><script>alert(1)</script></svg>`))
 	if err != nil {
 		t.Fatalf("Failed to update badge image: %v", err)
 	}
@@ -142,4 +151,851 @@ func TestDatabaseOperations(t *testing.T) {
 	if deletedBadge != nil {
 		t.Error("Badge was not deleted")
 	}
-}
\ No newline at end of file
+}
+func TestBadgeImageBlobStore(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	dbFile := "test_badges_blobs.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	legacy := &Badge{
+		CommitID: "legacy123", Type: "badge", Status: "valid", Issuer: "Test Issuer",
+		IssueDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareName: "TestApp", SoftwareVersion: "v1.0.0",
+		PNGContent: []byte("legacy png"),
+	}
+	if err := db.CreateBadge(legacy); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+
+	store, err := blobstore.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	db.SetBlobStore(store)
+
+	// Existing in-row blobs are still served
+	badge, _ := db.GetBadge("legacy123")
+	data, err := db.GetBadgeImage(badge, "png")
+	if err != nil || string(data) != "legacy png" {
+		t.Fatalf("expected legacy PNG, got %q (err %v)", data, err)
+	}
+
+	// New images go to the blob store and are referenced by key
+	if err := db.UpdateBadgeImage("legacy123", "jpg", []byte("stored jpg")); err != nil {
+		t.Fatalf("Failed to update badge image: %v", err)
+	}
+	badge, _ = db.GetBadge("legacy123")
+	if badge.JPGContent != nil {
+		t.Error("expected JPG not to be stored in the badges table")
+	}
+	if !badge.JPGKey.Valid {
+		t.Fatal("expected JPG key to be recorded")
+	}
+	data, err = db.GetBadgeImage(badge, "jpg")
+	if err != nil || string(data) != "stored jpg" {
+		t.Fatalf("expected stored JPG, got %q (err %v)", data, err)
+	}
+
+	// Deleting the badge removes its stored images
+	if err := db.DeleteBadge("legacy123"); err != nil {
+		t.Fatalf("Failed to delete badge: %v", err)
+	}
+	if _, err := store.Get(badge.JPGKey.String); err != blobstore.ErrNotFound {
+		t.Errorf("expected stored JPG to be deleted, got %v", err)
+	}
+}
+
+func TestDefaultAdminOneTimePassword(t *testing.T) {
+	os.Unsetenv("ADMIN_PASSWORD")
+
+	dbFile := "test_badges_admin.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	if !admin.MustChangePassword {
+		t.Error("Expected generated admin password to require a change")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte("Admin@123")) == nil {
+		t.Error("Expected admin password not to be the old hardcoded default")
+	}
+
+	if err := db.UpdateUserPassword(admin.UserID, "new-hash"); err != nil {
+		t.Fatalf("Failed to update password: %v", err)
+	}
+	admin, err = db.GetUser(admin.UserID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if admin.MustChangePassword {
+		t.Error("Expected password change to clear the forced change flag")
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	dbFile := "test_badges_context.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetBadge("abc123"); err != nil {
+		t.Fatalf("Expected the default context to work, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.WithContext(ctx).GetBadge("abc123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled request to stop the query, got %v", err)
+	}
+	if _, err := db.GetBadge("abc123"); err != nil {
+		t.Errorf("Expected WithContext not to change the original, got %v", err)
+	}
+
+	db.SetQueryTimeout(time.Nanosecond)
+	if _, err := db.ListBadges(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the query timeout to apply, got %v", err)
+	}
+	db.SetQueryTimeout(0)
+	if _, err := db.ListBadges(); err != nil {
+		t.Errorf("Expected a zero timeout to disable it, got %v", err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	dbFile := "test_badges_tx.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	newBadge := func(commitID string) *Badge {
+		return &Badge{CommitID: commitID, Type: "certificate", Status: "valid", SoftwareName: "App",
+			SoftwareVersion: "v1", Issuer: "GÉANT", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	}
+
+	// An error rolls back every call made in the transaction
+	committed := false
+	boom := errors.New("boom")
+	err = db.WithTx(func(tx *DB) error {
+		if err := tx.CreateBadge(newBadge("rolled01")); err != nil {
+			return err
+		}
+		tx.afterCommit(func() { committed = true })
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	if b, _ := db.GetBadge("rolled01"); b != nil || committed {
+		t.Errorf("Expected the insert and the commit hook to be rolled back")
+	}
+
+	// Nested calls join the outer transaction and commit with it
+	err = db.WithTx(func(tx *DB) error {
+		if err := tx.CreateBadge(newBadge("commit01")); err != nil {
+			return err
+		}
+		tx.afterCommit(func() { committed = true })
+		return tx.WithTx(func(inner *DB) error {
+			return inner.CreateBadge(newBadge("commit02"))
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	for _, id := range []string{"commit01", "commit02"} {
+		if b, err := db.GetBadge(id); err != nil || b == nil {
+			t.Errorf("Expected %s to be committed, got %v (err %v)", id, b, err)
+		}
+	}
+	if !committed {
+		t.Error("Expected the commit hook to run")
+	}
+
+	// A method running its own transaction joins WithTx instead of committing
+	err = db.WithTx(func(tx *DB) error {
+		if err := tx.DeleteBadge("commit01"); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	if b, _ := db.GetBadge("commit01"); b == nil {
+		t.Error("Expected the delete to be rolled back")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	dbFile := "test_badges_aliases.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateBadge(&Badge{CommitID: "abc123", Type: "certificate", Status: "valid"}); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+	if err := db.CreateAlias(&Alias{Alias: "old-name", CommitID: "abc123", CreatedBy: "user-id", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to create alias: %v", err)
+	}
+	if err := db.CreateAlias(&Alias{Alias: "OLD-NAME", CommitID: "abc123", CreatedBy: "user-id", CreatedAt: time.Now()}); err == nil {
+		t.Error("Expected aliases to be unique regardless of case")
+	}
+
+	for id, want := range map[string]string{"old-name": "abc123", "Old-Name": "abc123", "ABC123": "abc123", "missing1": ""} {
+		if got, err := db.ResolveBadgeID(id); err != nil || got != want {
+			t.Errorf("ResolveBadgeID(%q) = %q (err %v), want %q", id, got, err, want)
+		}
+	}
+
+	if err := db.DeleteBadge("abc123"); err != nil {
+		t.Fatalf("Failed to delete badge: %v", err)
+	}
+	if aliases, err := db.ListAliases("abc123"); err != nil || len(aliases) != 0 {
+		t.Errorf("Expected the aliases to be deleted with the badge, got %v (err %v)", aliases, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	dbFile := "test_badges_sessions.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for _, s := range []*Session{
+		{SessionID: "laptop", UserID: "user-id", UserAgent: "Firefox", IP: "192.0.2.1", CreatedAt: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)},
+		{SessionID: "old", UserID: "user-id", CreatedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		{SessionID: "phone", UserID: "user-id", CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Minute)},
+	} {
+		if err := db.CreateSession(s); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	if s, err := db.GetSession("old"); err != nil || s != nil {
+		t.Errorf("Expected the expired session to be deleted by the next login, got %+v (err %v)", s, err)
+	}
+
+	if err := db.TouchSession("laptop", "192.0.2.2", now.Add(time.Second)); err != nil {
+		t.Fatalf("Failed to touch session: %v", err)
+	}
+	if err := db.ExtendSession("phone", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to extend session: %v", err)
+	}
+	sessions, err := db.ListActiveSessions("user-id", now)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "laptop" || sessions[0].IP != "192.0.2.2" || sessions[0].UserAgent != "Firefox" {
+		t.Errorf("Expected both sessions, the laptop last seen first, got %+v", sessions)
+	}
+
+	if err := db.RevokeSession("laptop", now); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	if s, err := db.GetSession("laptop"); err != nil || s == nil || !s.RevokedAt.Valid {
+		t.Errorf("Expected the session to be revoked, got %+v (err %v)", s, err)
+	}
+	if sessions, err := db.ListActiveSessions("user-id", now.Add(2*time.Minute)); err != nil || len(sessions) != 1 || sessions[0].SessionID != "phone" {
+		t.Errorf("Expected only the extended session to be active, got %+v (err %v)", sessions, err)
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	dbFile := "test_badges_login_failures.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		if n, err := db.RecordLoginFailure("ip:192.0.2.1", now, now.Add(-time.Hour)); err != nil || n != i {
+			t.Fatalf("Expected failure %d, got %d (err %v)", i, n, err)
+		}
+	}
+	if err := db.BlockLogin("ip:192.0.2.1", now.Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to block login: %v", err)
+	}
+	f, err := db.GetLoginFailure("ip:192.0.2.1")
+	if err != nil || f == nil || f.Failures != 3 || !f.BlockedUntil.Valid {
+		t.Fatalf("Expected three failures and a block, got %+v (err %v)", f, err)
+	}
+
+	// Counts older than the reset time start over
+	if n, err := db.RecordLoginFailure("ip:192.0.2.1", now.Add(2*time.Hour), now.Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("Expected the count to start over, got %d (err %v)", n, err)
+	}
+
+	if err := db.DeleteLoginFailure("ip:192.0.2.1"); err != nil {
+		t.Fatalf("Failed to delete login failures: %v", err)
+	}
+	if f, err := db.GetLoginFailure("ip:192.0.2.1"); err != nil || f != nil {
+		t.Errorf("Expected no failures, got %+v (err %v)", f, err)
+	}
+}
+
+func TestUserAudit(t *testing.T) {
+	dbFile := "test_badges_user_audit.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for _, subject := range []string{"user-1", "user-2"} {
+		e := &UserAuditEntry{Action: "impersonate", ActorID: "admin-id", SubjectID: subject, Detail: sql.NullString{String: "ticket 42", Valid: true}, CreatedAt: time.Now()}
+		if err := db.CreateUserAuditEntry(e); err != nil || e.AuditID == 0 {
+			t.Fatalf("Failed to create user audit entry: %v", err)
+		}
+	}
+
+	entries, err := db.ListUserAuditEntries("impersonate", 1)
+	if err != nil {
+		t.Fatalf("Failed to list user audit entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].SubjectID != "user-2" || entries[0].Detail.String != "ticket 42" {
+		t.Errorf("Expected the newest entry only, got %+v", entries)
+	}
+	if entries, err := db.ListUserAuditEntries("other", 10); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries of another action, got %v (err %v)", entries, err)
+	}
+}
+
+func TestNormalizeBadgeDates(t *testing.T) {
+	dbFile := "test_badges_dates.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateBadge(&Badge{CommitID: "abc123", Type: "badge", Status: "valid", IssueDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+	if _, err := db.DB.Exec("UPDATE badges SET issue_date = '31.01.2026', expiry_date = 'January 31, 2027', last_review = 'soon' WHERE commit_id = 'abc123'"); err != nil {
+		t.Fatalf("Failed to store legacy dates: %v", err)
+	}
+
+	if err := normalizeBadgeDates(db.DB, zap.NewNop()); err != nil {
+		t.Fatalf("normalizeBadgeDates failed: %v", err)
+	}
+	var issue, expiry, review string
+	if err := db.DB.QueryRow("SELECT CAST(issue_date AS TEXT), CAST(expiry_date AS TEXT), CAST(last_review AS TEXT) FROM badges WHERE commit_id = 'abc123'").Scan(&issue, &expiry, &review); err != nil {
+		t.Fatalf("Failed to read dates: %v", err)
+	}
+	if issue != "2026-01-31" || expiry != "2027-01-31" || review != "soon" {
+		t.Errorf("unexpected stored dates %q, %q, %q", issue, expiry, review)
+	}
+
+	b, err := db.GetBadge("abc123")
+	if err != nil {
+		t.Fatalf("Failed to get badge: %v", err)
+	}
+	if !b.IssueDate.Equal(time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)) || !b.ExpiryDate.Valid || b.LastReview.Valid {
+		t.Errorf("unexpected badge dates %v, %v, %v", b.IssueDate, b.ExpiryDate, b.LastReview)
+	}
+}
+
+func TestBadgeIssuerTimezone(t *testing.T) {
+	dbFile := "test_badges_timezone.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	issuer := &Issuer{IssuerID: "acme", Name: "Acme", Timezone: sql.NullString{String: "Europe/Amsterdam", Valid: true}, CreatedAt: now, UpdatedAt: now}
+	if err := db.CreateIssuer(issuer); err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+	if err := db.CreateBadge(&Badge{CommitID: "abc123", Type: "badge", Status: "valid", Issuer: "Acme",
+		IssueDate:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiryDate: sql.NullTime{Time: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		IssuerID:   sql.NullString{String: "acme", Valid: true}, PNGContent: []byte("png"),
+	}); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+
+	b, err := db.GetBadge("abc123")
+	if err != nil {
+		t.Fatalf("Failed to get badge: %v", err)
+	}
+	if b.IssuerTimezone.String != "Europe/Amsterdam" || b.PNGContent == nil {
+		t.Errorf("expected the issuer's timezone and a stored render, got %q and %d bytes", b.IssuerTimezone.String, len(b.PNGContent))
+	}
+	if got, _ := b.ExpiresAt(); !got.Equal(time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry %v", got)
+	}
+
+	// A new timezone drops the stored renders of the expiring badges
+	issuer.Timezone = sql.NullString{}
+	if err := db.UpdateIssuer(issuer); err != nil {
+		t.Fatalf("Failed to update issuer: %v", err)
+	}
+	badges, err := db.ListBadgesByIssuer("acme")
+	if err != nil || len(badges) != 1 {
+		t.Fatalf("Failed to list issuer badges: %v (%d)", err, len(badges))
+	}
+	if badges[0].IssuerTimezone.Valid || badges[0].PNGContent != nil {
+		t.Errorf("expected no timezone and no stored render, got %v and %d bytes", badges[0].IssuerTimezone, len(badges[0].PNGContent))
+	}
+}
+
+func TestNormalizeBadgeStatuses(t *testing.T) {
+	dbFile := "test_badges_statuses.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for id, status := range map[string]string{"abc123": " Revoked", "def456": "active"} {
+		if err := db.CreateBadge(&Badge{CommitID: id, Type: "badge", Status: StatusValid, IssueDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+		if _, err := db.DB.Exec("UPDATE badges SET status = ? WHERE commit_id = ?", status, id); err != nil {
+			t.Fatalf("Failed to store legacy status: %v", err)
+		}
+	}
+
+	if err := normalizeBadgeStatuses(db.DB, zap.NewNop()); err != nil {
+		t.Fatalf("normalizeBadgeStatuses failed: %v", err)
+	}
+	for id, want := range map[string]Status{"abc123": StatusRevoked, "def456": "active"} {
+		if b, err := db.GetBadge(id); err != nil || b.Status != want {
+			t.Errorf("%s: expected status %q, got %v (err %v)", id, want, b, err)
+		}
+	}
+}
+
+func TestLinkCertificateTypes(t *testing.T) {
+	dbFile := "test_badges_certificate_types.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for id, name := range map[string]string{"abc123": "Verified Dependencies", "def456": "Verified Dependencies", "ghi789": ""} {
+		b := &Badge{CommitID: id, Type: "badge", Status: StatusValid, IssueDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			CertificateName: sql.NullString{String: name, Valid: name != ""},
+			SpecialtyDomain: sql.NullString{String: "SOFTWARE SUPPLY CHAIN", Valid: name != ""},
+		}
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	// Start over as on the first start with certificate types
+	if _, err := db.DB.Exec("DELETE FROM certificate_types"); err != nil {
+		t.Fatalf("Failed to clear certificate types: %v", err)
+	}
+	if err := linkCertificateTypes(db.DB, zap.NewNop()); err != nil {
+		t.Fatalf("linkCertificateTypes failed: %v", err)
+	}
+	certType, err := db.GetCertificateType("verified-dependencies")
+	if err != nil || certType == nil {
+		t.Fatalf("Expected the certificate type to be created, got %v (err %v)", certType, err)
+	}
+	if certType.Name != "Verified Dependencies" || !certType.GuideURL.Valid {
+		t.Errorf("expected the default type with its guide, got %+v", certType)
+	}
+	for id, want := range map[string]string{"abc123": "verified-dependencies", "def456": "verified-dependencies", "ghi789": "badge"} {
+		if b, err := db.GetBadge(id); err != nil || b.AccessType() != want {
+			t.Errorf("%s: expected access type %q, got %v (err %v)", id, want, b, err)
+		}
+	}
+
+	// Once types exist, startup leaves unlinked badges alone
+	if err := db.CreateBadge(&Badge{CommitID: "jkl012", Type: "badge", Status: StatusValid, IssueDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		CertificateName: sql.NullString{String: "Verified Software Licence", Valid: true},
+	}); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+	if err := linkCertificateTypes(db.DB, zap.NewNop()); err != nil {
+		t.Fatalf("linkCertificateTypes failed: %v", err)
+	}
+	if types, _ := db.ListCertificateTypes(); len(types) != len(defaultCertificateTypes) {
+		t.Errorf("expected only the default certificate types, got %d", len(types))
+	}
+	if n, err := db.LinkCertificateTypes(); err != nil || n != 1 {
+		t.Errorf("expected LinkCertificateTypes to link one badge, got %d (err %v)", n, err)
+	}
+}
+
+func TestUserEmails(t *testing.T) {
+	dbFile := "test_badges_emails.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	now := time.Now()
+	user := &User{UserID: "bob-id", Username: "bob", Email: " Bob@Example.ORG", PasswordHash: "x", RoleID: admin.RoleID, CreatedAt: now, UpdatedAt: now, Status: "active"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for _, email := range []string{"bob@example.org", "BOB@example.org "} {
+		if u, err := db.GetUserByEmail(email); err != nil || u == nil || u.UserID != "bob-id" || u.Email != "bob@example.org" {
+			t.Errorf("%s: expected bob with a lowercase email, got %+v (err %v)", email, u, err)
+		}
+	}
+	if u, err := db.GetUserByEmail("carol@example.org"); err != nil || u != nil {
+		t.Errorf("expected no user for an unknown email, got %+v (err %v)", u, err)
+	}
+
+	// Emails are unique whatever their case, also when written around CreateUser
+	if _, err := db.DB.Exec("INSERT INTO users (user_id, username, email, password_hash, first_name, last_name, role_id, created_at, updated_at, status) VALUES ('eve-id', 'eve', 'BOB@EXAMPLE.ORG', 'x', '', '', ?, ?, ?, 'active')", admin.RoleID, now, now); err == nil {
+		t.Error("expected an email differing only in case to be refused")
+	}
+
+	// Emails stored before they were normalized are lowercased
+	if _, err := db.DB.Exec("DROP INDEX idx_users_email_nocase"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := db.DB.Exec("UPDATE users SET email = 'Bob@Example.org' WHERE user_id = 'bob-id'"); err != nil {
+		t.Fatalf("Failed to store legacy email: %v", err)
+	}
+	if err := normalizeUserEmails(db.DB, zap.NewNop()); err != nil {
+		t.Fatalf("normalizeUserEmails failed: %v", err)
+	}
+	if u, err := db.GetUserByEmail("bob@example.org"); err != nil || u == nil {
+		t.Errorf("expected the legacy email to be found, got %+v (err %v)", u, err)
+	}
+}
+
+func TestDefaultRoles(t *testing.T) {
+	dbFile := "test_badges_roles.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	for name, inherits := range map[string]string{"viewer": "", "issuer": "viewer", "admin": "issuer"} {
+		role, err := db.GetRoleByName(name)
+		if err != nil || role == nil || role.Inherits != inherits {
+			t.Fatalf("expected the %s role inheriting %q, got %+v (err %v)", name, inherits, role, err)
+		}
+	}
+	admin, _ := db.GetRoleByName("admin")
+	if p, err := admin.GetPermissions(); err != nil || !p.Allows("webhooks", "write") {
+		t.Errorf("expected the admin role to grant any resource, got %v (err %v)", p, err)
+	}
+
+	// An admin role of an older version is upgraded when it grants everything
+	// there was, and left alone otherwise
+	legacy := `{"badges":{"read":true,"write":true,"delete":true},"users":{"read":true,"write":true,"delete":true},"api_keys":{"read":true,"write":true,"delete":true}}`
+	for permissions, upgraded := range map[string]bool{legacy: true, `{"badges":{"read":true}}`: false} {
+		if _, err := db.DB.Exec("UPDATE roles SET permissions = ?, inherits = '' WHERE name = 'admin'", permissions); err != nil {
+			t.Fatalf("Failed to store legacy admin role: %v", err)
+		}
+		if err := addDefaultRoles(db.DB); err != nil {
+			t.Fatalf("addDefaultRoles failed: %v", err)
+		}
+		admin, _ = db.GetRoleByName("admin")
+		p, _ := admin.GetPermissions()
+		if got := p.Allows("webhooks", "write") && admin.Inherits == "issuer"; got != upgraded {
+			t.Errorf("%s: expected upgraded %v, got %+v", permissions, upgraded, admin)
+		}
+	}
+	db.Close()
+}
+
+func TestPermissions(t *testing.T) {
+	p, err := ParsePermissions(`{"badges":{"read":true,"write":false},"templates":{"*":true}}`)
+	if err != nil {
+		t.Fatalf("ParsePermissions failed: %v", err)
+	}
+	for _, tc := range []struct {
+		resource, action string
+		want             bool
+	}{
+		{"badges", "read", true},
+		{"badges", "write", false},
+		{"templates", "delete", true},
+		{"users", "read", false},
+	} {
+		if got := p.Allows(tc.resource, tc.action); got != tc.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tc.resource, tc.action, got, tc.want)
+		}
+	}
+
+	merged := p.Merge(Permissions{"badges": {"write": true}, "users": {"read": false}})
+	if !merged.Allows("badges", "write") || !merged.Allows("badges", "read") {
+		t.Errorf("expected merged grants, got %v", merged)
+	}
+	if _, ok := merged["users"]; ok {
+		t.Errorf("expected denied grants to be left out, got %v", merged)
+	}
+	if !(Permissions{Wildcard: {Wildcard: true}}).Allows("anything", "at-all") {
+		t.Error("expected the wildcard to grant everything")
+	}
+
+	both := Permissions{Wildcard: {Wildcard: true}}.Intersect(Permissions{"badges": {"read": true}, "users": {Wildcard: true}})
+	if !both.Allows("badges", "read") || !both.Allows("users", "delete") || both.Allows("badges", "write") || both.Allows("roles", "read") {
+		t.Errorf("expected the narrower grants of the intersection, got %v", both)
+	}
+	if both := p.Intersect(Permissions{"users": {"read": true}}); len(both) != 0 {
+		t.Errorf("expected nothing in common, got %v", both)
+	}
+}
+
+func TestAPIKeyUsage(t *testing.T) {
+	dbFile := "test_badges_key_usage.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	key := &APIKey{APIKeyID: "key-id", UserID: admin.UserID, APIKey: "hash", Name: "partner", Permissions: "{}",
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active", MonthlyQuota: 1000}
+	if err := db.CreateAPIKey(key); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if k, err := db.GetAPIKey("key-id"); err != nil || k.MonthlyQuota != 1000 {
+		t.Errorf("expected the quota to be stored, got %+v (err %v)", k, err)
+	}
+
+	// Counts of a day add up
+	for _, usage := range [][]*APIKeyUsage{
+		{{Day: "2026-02-28", APIKeyID: "key-id", Requests: 5, Bytes: 500}, {Day: "2026-03-01", APIKeyID: "key-id", Requests: 1, Bytes: 10}},
+		{{Day: "2026-03-01", APIKeyID: "key-id", Requests: 2, Bytes: 20}, {Day: "2026-03-01", APIKeyID: "other", Requests: 7}},
+	} {
+		if err := db.AddAPIKeyUsage(usage); err != nil {
+			t.Fatalf("AddAPIKeyUsage: %v", err)
+		}
+	}
+	days, err := db.ListAPIKeyUsage("key-id", "2026-02-01", "2026-03-31")
+	if err != nil || len(days) != 2 || days[1].Day != "2026-03-01" || days[1].Requests != 3 || days[1].Bytes != 30 {
+		t.Errorf("expected two days of usage, got %+v (err %v)", days, err)
+	}
+	if month, err := db.SumAPIKeyUsage("key-id", "2026-03-01"); err != nil || month.Requests != 3 || month.Bytes != 30 {
+		t.Errorf("expected the usage of March, got %+v (err %v)", month, err)
+	}
+
+	// Deleting a key deletes its usage
+	if err := db.DeleteAPIKey("key-id"); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	if total, err := db.SumAPIKeyUsage("key-id", "2026-01-01"); err != nil || total.Requests != 0 {
+		t.Errorf("expected no usage left, got %+v (err %v)", total, err)
+	}
+}
+
+func TestOAuthClients(t *testing.T) {
+	dbFile := "test_badges_oauth_clients.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := &OAuthClient{ClientID: "client-id", SecretHash: "hash", Name: "ci", UserID: "user-id", OrgID: "org-id",
+		Permissions: `{"badges":{"read":true}}`, CreatedAt: time.Now(), Status: "active"}
+	if err := db.CreateOAuthClient(c); err != nil {
+		t.Fatalf("CreateOAuthClient: %v", err)
+	}
+	if err := db.UpdateOAuthClientLastUsed("client-id", time.Now()); err != nil {
+		t.Fatalf("UpdateOAuthClientLastUsed: %v", err)
+	}
+	got, err := db.GetOAuthClient("client-id")
+	if err != nil || got == nil || got.OrgID != "org-id" || got.Permissions != c.Permissions || !got.LastUsed.Valid {
+		t.Errorf("expected the stored client, got %+v (err %v)", got, err)
+	}
+
+	if err := db.RevokeOAuthClient("client-id"); err != nil {
+		t.Fatalf("RevokeOAuthClient: %v", err)
+	}
+	if clients, err := db.ListOAuthClients(); err != nil || len(clients) != 1 || clients[0].Status != "revoked" {
+		t.Errorf("expected the revoked client, got %+v (err %v)", clients, err)
+	}
+	if got, err := db.GetOAuthClient("missing"); err != nil || got != nil {
+		t.Errorf("expected no client, got %+v (err %v)", got, err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dbFile := "test_badges_events.db"
+	defer os.Remove(dbFile)
+
+	db, err := New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	actor := db.WithContext(WithActor(context.Background(), admin.UserID))
+
+	b := &Badge{CommitID: "events1", Type: "badge", Status: StatusValid, IssueDate: time.Now(), SoftwareName: "app",
+		OrgID: sql.NullString{String: "geant", Valid: true}}
+	if err := actor.CreateBadge(b); err != nil {
+		t.Fatalf("CreateBadge: %v", err)
+	}
+	b.SoftwareVersion = "1.1"
+	if err := actor.UpdateBadge(b); err != nil {
+		t.Fatalf("UpdateBadge: %v", err)
+	}
+	b.Status = StatusRevoked
+	if err := actor.UpdateBadge(b); err != nil {
+		t.Fatalf("UpdateBadge: %v", err)
+	}
+	if err := actor.DeleteBadge("events1"); err != nil {
+		t.Fatalf("DeleteBadge: %v", err)
+	}
+
+	// Drafts are issued when approval or the schedule publishes them
+	for _, id := range []string{"draft1", "draft2"} {
+		draft := &Badge{CommitID: id, Type: "badge", Status: StatusDraft, IssueDate: time.Now(), SoftwareName: "app"}
+		if id == "draft2" {
+			draft.PublishAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+		}
+		if err := actor.CreateBadge(draft); err != nil {
+			t.Fatalf("CreateBadge: %v", err)
+		}
+		draft.SoftwareVersion = "0.1"
+		if err := actor.UpdateBadge(draft); err != nil {
+			t.Fatalf("UpdateBadge: %v", err)
+		}
+	}
+	for _, e := range []*AuditEntry{
+		{CommitID: "draft1", Action: "submit", FromStatus: StatusDraft, ToStatus: StatusPending, ActorID: admin.UserID, CreatedAt: time.Now()},
+		{CommitID: "draft1", Action: "approve", FromStatus: StatusPending, ToStatus: StatusValid, ActorID: admin.UserID, CreatedAt: time.Now()},
+	} {
+		if err := actor.ReviewBadge(e); err != nil {
+			t.Fatalf("ReviewBadge: %v", err)
+		}
+	}
+	if ids, err := db.PublishScheduled(time.Now(), true); err != nil || len(ids) != 1 {
+		t.Fatalf("PublishScheduled: %v %v", ids, err)
+	}
+	// Calls on missing subjects record nothing
+	if err := db.UpdateBadge(&Badge{CommitID: "missing"}); err != nil {
+		t.Fatalf("UpdateBadge: %v", err)
+	}
+	if err := db.DeleteBadge("missing"); err != nil {
+		t.Fatalf("DeleteBadge: %v", err)
+	}
+
+	key := &APIKey{APIKeyID: "events-key", UserID: admin.UserID, APIKey: "hash", Name: "ci", Permissions: "{}",
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active"}
+	if err := db.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	key.Name = "ci-renamed"
+	if err := db.UpdateAPIKey(key); err != nil {
+		t.Fatalf("UpdateAPIKey: %v", err)
+	}
+	if err := db.RotateAPIKey("events-key", "hash2", "lookup2"); err != nil {
+		t.Fatalf("RotateAPIKey: %v", err)
+	}
+	if err := db.SetAPIKeyStatus("events-key", "expired"); err != nil {
+		t.Fatalf("SetAPIKeyStatus: %v", err)
+	}
+
+	events, err := db.ListEvents(EventQuery{Limit: 100})
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{EventBadgeIssued, EventBadgeUpdated, EventBadgeRevoked, EventBadgeDeleted, EventBadgeIssued, EventBadgeIssued,
+		EventKeyCreated, EventKeyRotated, EventKeyExpired}
+	if strings.Join(types, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	if e := events[2]; e.SubjectID != "events1" || e.OrgID != "geant" || e.ActorID != admin.UserID || !strings.Contains(e.Data, `"status":"revoked"`) {
+		t.Errorf("expected the revocation by the admin in geant, got %+v", e)
+	}
+	if e := events[4]; e.SubjectID != "draft1" || e.ActorID != admin.UserID || !strings.Contains(e.Data, `"status":"valid"`) {
+		t.Errorf("expected the approval of draft1 by the admin, got %+v", e)
+	}
+	if e := events[5]; e.SubjectID != "draft2" || e.ActorID != "" || !strings.Contains(e.Data, `"software_version":"0.1"`) {
+		t.Errorf("expected the scheduled publication of draft2, got %+v", e)
+	}
+	if e := events[8]; e.ActorID != "" || !strings.Contains(e.Data, `"name":"ci-renamed"`) || strings.Contains(e.Data, "hash") {
+		t.Errorf("expected the expiry without actor or key hash, got %+v", e)
+	}
+
+	// Cursor, types and organization select
+	if page, err := db.ListEvents(EventQuery{After: events[1].EventID, Types: []string{EventBadgeRevoked, EventKeyCreated}, Limit: 1}); err != nil || len(page) != 1 || page[0].Type != EventBadgeRevoked {
+		t.Errorf("expected the revocation after the cursor, got %+v (err %v)", page, err)
+	}
+	if page, err := db.ListEvents(EventQuery{OrgID: "geant", Limit: 100}); err != nil || len(page) != 4 {
+		t.Errorf("expected the four badge events of geant, got %d (err %v)", len(page), err)
+	}
+	if last, err := db.LastEventID(); err != nil || last != events[8].EventID {
+		t.Errorf("expected the last event ID %d, got %d (err %v)", events[8].EventID, last, err)
+	}
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	// Issuer timezones must load in images without a zoneinfo database
+	_ "time/tzdata"
+
+	"go.uber.org/zap"
+)
+
+// DateLayout is the layout badge dates are stored and exchanged in
+const DateLayout = "2006-01-02"
+
+// legacyDateLayouts are the layouts found in badge dates entered before they
+// were validated. Day-first and month-first numeric dates are ambiguous, so
+// only the unambiguous European forms with dots are accepted.
+var legacyDateLayouts = []string{
+	DateLayout,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006/01/02",
+	"2006.01.02",
+	"02.01.2006",
+	"2.1.2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// ParseDate parses a YYYY-MM-DD date as midnight UTC of that day
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.Parse(DateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// ParseNullDate parses an optional YYYY-MM-DD date; "" is NULL
+func ParseNullDate(s string) (sql.NullTime, error) {
+	if strings.TrimSpace(s) == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := ParseDate(s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// ParseLegacyDate parses a date in any of the layouts stored by older
+// versions, returning midnight UTC of that day
+func ParseLegacyDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range legacyDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Day(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// Day returns midnight UTC of the calendar day of t
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LoadTimezone loads an IANA timezone such as "Europe/Amsterdam"; "" is UTC.
+// "Local" is rejected, as it depends on the server the badge is served from.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// FormatDate formats a date as YYYY-MM-DD, or "" for the zero time
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(DateLayout)
+}
+
+// FormatNullDate formats an optional date as YYYY-MM-DD, or "" if NULL
+func FormatNullDate(d sql.NullTime) string {
+	if !d.Valid {
+		return ""
+	}
+	return FormatDate(d.Time)
+}
+
+// dateArg binds a date as YYYY-MM-DD text, which orders correctly and is
+// what SQLite's date functions expect
+func dateArg(t time.Time) string {
+	return FormatDate(t)
+}
+
+// nullDateArg binds an optional date as YYYY-MM-DD text or NULL
+func nullDateArg(d sql.NullTime) sql.NullString {
+	return sql.NullString{String: FormatNullDate(d), Valid: d.Valid}
+}
+
+// dateColumn scans a date column into a time. Columns declared DATE come back
+// from the driver as times, those of databases created before as text;
+// values no layout recognizes scan as NULL, or the zero time.
+type dateColumn struct {
+	t     *time.Time
+	valid *bool
+}
+
+// scanDate scans a NOT NULL date column into t
+func scanDate(t *time.Time) dateColumn {
+	return dateColumn{t: t}
+}
+
+// scanNullDate scans a nullable date column into d
+func scanNullDate(d *sql.NullTime) dateColumn {
+	return dateColumn{t: &d.Time, valid: &d.Valid}
+}
+
+// Scan implements sql.Scanner
+func (c dateColumn) Scan(src interface{}) error {
+	var t time.Time
+	switch v := src.(type) {
+	case nil:
+	case time.Time:
+		t = Day(v)
+	case string:
+		t, _ = ParseLegacyDate(v)
+	case []byte:
+		t, _ = ParseLegacyDate(string(v))
+	default:
+		return fmt.Errorf("unsupported date value %T", src)
+	}
+	*c.t = t
+	if c.valid != nil {
+		*c.valid = !t.IsZero()
+	}
+	return nil
+}
+
+// dateColumns are the date columns of the badges table
+var dateColumns = []string{"issue_date", "expiry_date", "last_review"}
+
+// normalizeBadgeDates rewrites the badge dates stored by older versions in
+// other layouts as YYYY-MM-DD, so that they sort and compare correctly.
+// Dates no layout recognizes are left as they are and logged. The columns are
+// read as text, as the driver turns text it cannot parse in DATE columns into
+// the zero time.
+func normalizeBadgeDates(db *sql.DB, logger *zap.Logger) error {
+	for _, column := range dateColumns {
+		rows, err := db.Query(fmt.Sprintf("SELECT commit_id, CAST(%s AS TEXT) FROM badges WHERE %s IS NOT NULL", column, column))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", column, err)
+		}
+		updates := map[string]string{}
+		for rows.Next() {
+			var commitID string
+			var value interface{}
+			if err := rows.Scan(&commitID, &value); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan %s: %w", column, err)
+			}
+			raw, ok := value.(string)
+			if b, isBytes := value.([]byte); isBytes {
+				raw, ok = string(b), true
+			}
+			if !ok {
+				continue
+			}
+			if _, err := time.Parse(DateLayout, raw); err == nil {
+				continue
+			}
+			t, err := ParseLegacyDate(raw)
+			if err != nil {
+				logger.Warn("Badge date not recognized, left as is",
+					zap.String("commit_id", commitID), zap.String("column", column), zap.String("value", raw))
+				continue
+			}
+			updates[commitID] = FormatDate(t)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", column, err)
+		}
+
+		for commitID, date := range updates {
+			if _, err := db.Exec(fmt.Sprintf("UPDATE badges SET %s = ? WHERE commit_id = ?", column), date, commitID); err != nil {
+				return fmt.Errorf("failed to normalize %s of badge %s: %w", column, commitID, err)
+			}
+		}
+		if len(updates) > 0 {
+			logger.Info("Normalized badge dates", zap.String("column", column), zap.Int("badges", len(updates)))
+		}
+	}
+	return nil
+}
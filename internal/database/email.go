@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// NormalizeEmail returns the form emails are stored and looked up in:
+// trimmed and lowercase, so that logging in does not depend on their case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeUserEmails lowercases the emails stored before they were
+// normalized and indexes them case-insensitively. Emails differing only in
+// case are left as they are, with a warning, since they cannot be unique.
+func normalizeUserEmails(db *sql.DB, logger *zap.Logger) error {
+	res, err := db.Exec(`
+		UPDATE users SET email = LOWER(TRIM(email))
+		WHERE email <> LOWER(TRIM(email)) AND NOT EXISTS (
+			SELECT 1 FROM users AS other
+			WHERE other.user_id <> users.user_id AND LOWER(TRIM(other.email)) = LOWER(TRIM(users.email))
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to normalize user emails: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logger.Info("Normalized user emails", zap.Int64("users", n))
+	}
+
+	rows, err := db.Query(`
+		SELECT LOWER(TRIM(email)), COUNT(*) FROM users
+		GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check user emails: %w", err)
+	}
+	defer rows.Close()
+	duplicates := 0
+	for rows.Next() {
+		var email string
+		var count int
+		if err := rows.Scan(&email, &count); err != nil {
+			return fmt.Errorf("failed to scan user email: %w", err)
+		}
+		logger.Warn("Users share an email differing only in case; rename all but one to sign in by email",
+			zap.String("email", email), zap.Int("users", count))
+		duplicates++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check user emails: %w", err)
+	}
+	if duplicates > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_nocase ON users (email COLLATE NOCASE)"); err != nil {
+		return fmt.Errorf("failed to create users email index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Domain events, recorded by the calls making the change in the same
+// transaction
+const (
+	EventBadgeIssued  = "badge.issued"
+	EventBadgeUpdated = "badge.updated"
+	EventBadgeRevoked = "badge.revoked"
+	EventBadgeDeleted = "badge.deleted"
+	EventUserCreated  = "user.created"
+	EventUserDeleted  = "user.deleted"
+	EventKeyCreated   = "key.created"
+	EventKeyRotated   = "key.rotated"
+	EventKeyRevoked   = "key.revoked"
+	EventKeyExpired   = "key.expired"
+)
+
+// EventTypes are the types of recorded events
+var EventTypes = []string{
+	EventBadgeIssued, EventBadgeUpdated, EventBadgeRevoked, EventBadgeDeleted,
+	EventUserCreated, EventUserDeleted,
+	EventKeyCreated, EventKeyRotated, EventKeyRevoked, EventKeyExpired,
+}
+
+// EventQuery selects events for ListEvents
+type EventQuery struct {
+	// After is the ID of the last event seen; 0 starts from the first
+	After int64
+	// Types restricts the events to these types; empty selects all
+	Types []string
+	// OrgID restricts the events to those of an organization; empty selects all
+	OrgID string
+	// Limit is the maximum number of events returned
+	Limit int
+}
+
+// actorContextKey is the context key of the actor of database calls
+type actorContextKey struct{}
+
+// WithActor returns ctx naming the user whose database calls under it, see
+// DB.WithContext, record the events they cause
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, userID)
+}
+
+// actor returns the user ID set by WithActor on the bound context, or ""
+func (db *DB) actor() string {
+	id, _ := db.ctx.Value(actorContextKey{}).(string)
+	return id
+}
+
+// recordEvent records an event of a subject with a JSON snapshot of it
+func (db *DB) recordEvent(eventType, subjectID, orgID string, data interface{}) error {
+	snapshot, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err = db.conn().ExecContext(ctx, `
+		INSERT INTO events (type, subject_id, org_id, actor_id, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, eventType, subjectID, orgID, db.actor(), string(snapshot), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+// ListEvents retrieves the events after a cursor, oldest first
+func (db *DB) ListEvents(q EventQuery) ([]*Event, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	where := []string{"event_id > ?"}
+	args := []interface{}{q.After}
+	if q.OrgID != "" {
+		where = append(where, "org_id = ?")
+		args = append(args, q.OrgID)
+	}
+	if len(q.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(q.Types)-1)+")")
+		for _, t := range q.Types {
+			args = append(args, t)
+		}
+	}
+	args = append(args, q.Limit)
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT event_id, type, subject_id, org_id, actor_id, data, created_at
+		FROM events WHERE `+strings.Join(where, " AND ")+` ORDER BY event_id LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.EventID, &e.Type, &e.SubjectID, &e.OrgID, &e.ActorID, &e.Data, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating events: %w", err)
+	}
+
+	return events, nil
+}
+
+// LastEventID returns the ID of the latest event, 0 if there is none
+func (db *DB) LastEventID() (int64, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var id int64
+	if err := db.conn().QueryRowContext(ctx, "SELECT COALESCE(MAX(event_id), 0) FROM events").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get last event: %w", err)
+	}
+	return id, nil
+}
+
+// badgeEvent is the snapshot of a badge in its events; contents such as the
+// rendered images and internal notes are left out
+type badgeEvent struct {
+	CommitID        string     `json:"commit_id"`
+	Status          Status     `json:"status"`
+	CertificateName string     `json:"certificate_name,omitempty"`
+	SoftwareName    string     `json:"software_name"`
+	SoftwareVersion string     `json:"software_version"`
+	IssueDate       time.Time  `json:"issue_date"`
+	ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+	PublishAt       *time.Time `json:"publish_at,omitempty"`
+	IssuerID        string     `json:"issuer_id,omitempty"`
+	OrgID           string     `json:"org_id,omitempty"`
+}
+
+func newBadgeEvent(b *Badge) badgeEvent {
+	e := badgeEvent{
+		CommitID:        b.CommitID,
+		Status:          b.Status,
+		CertificateName: b.CertificateName.String,
+		SoftwareName:    b.SoftwareName,
+		SoftwareVersion: b.SoftwareVersion,
+		IssueDate:       b.IssueDate,
+		IssuerID:        b.IssuerID.String,
+		OrgID:           b.OrgID.String,
+	}
+	if b.ExpiryDate.Valid {
+		e.ExpiryDate = &b.ExpiryDate.Time
+	}
+	if b.PublishAt.Valid {
+		e.PublishAt = &b.PublishAt.Time
+	}
+	return e
+}
+
+// badgeStatusEvent returns the event of a badge changing from status prev to
+// status, or "" if none: badges are issued when they are first published, so
+// changes to drafts and pending badges are not announced
+func badgeStatusEvent(prev, status Status) string {
+	switch {
+	case !prev.IsPublished() && !status.IsPublished():
+		return ""
+	case !prev.IsPublished():
+		return EventBadgeIssued
+	case status == StatusRevoked && prev != StatusRevoked:
+		return EventBadgeRevoked
+	}
+	return EventBadgeUpdated
+}
+
+// recordBadgeStatusEvent records the event of a badge having changed from
+// status prev to status, if any, with a snapshot of the badge as it is now
+func (db *DB) recordBadgeStatusEvent(commitID string, prev, status Status) error {
+	event := badgeStatusEvent(prev, status)
+	if event == "" {
+		return nil
+	}
+	badge, err := db.GetBadge(commitID)
+	if err != nil || badge == nil {
+		return err
+	}
+	return db.recordEvent(event, commitID, badge.OrgID.String, newBadgeEvent(badge))
+}
+
+// userEvent is the snapshot of a user in its events
+type userEvent struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	RoleID   string `json:"role_id"`
+	OrgID    string `json:"org_id,omitempty"`
+	Status   string `json:"status"`
+}
+
+func newUserEvent(u *User) userEvent {
+	return userEvent{UserID: u.UserID, Username: u.Username, RoleID: u.RoleID, OrgID: u.OrgID.String, Status: u.Status}
+}
+
+// keyEvent is the snapshot of an API key in its events, without the key
+type keyEvent struct {
+	APIKeyID  string    `json:"api_key_id"`
+	Name      string    `json:"name"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Status    string    `json:"status"`
+}
+
+func newKeyEvent(k *APIKey) keyEvent {
+	return keyEvent{APIKeyID: k.APIKeyID, Name: k.Name, UserID: k.UserID, ExpiresAt: k.ExpiresAt, Status: k.Status}
+}
+
+// keyStatusEvent returns the event of an API key changing from status prev
+// to status, or "" if none
+func keyStatusEvent(prev, status string) string {
+	if prev == status {
+		return ""
+	}
+	switch status {
+	case "revoked":
+		return EventKeyRevoked
+	case "expired":
+		return EventKeyExpired
+	}
+	return ""
+}
+
+// apiKeyStatus returns the status of an API key and whether it exists
+func (db *DB) apiKeyStatus(apiKeyID string) (string, bool, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var status string
+	err := db.conn().QueryRowContext(ctx, "SELECT status FROM api_keys WHERE api_key_id = ?", apiKeyID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get API key status: %w", err)
+	}
+	return status, true, nil
+}
+
+// recordKeyStatusEvent records the event of an API key changing from status
+// prev to its current one, if any, in the organization of its owner
+func (db *DB) recordKeyStatusEvent(k *APIKey, prev string) error {
+	event := keyStatusEvent(prev, k.Status)
+	if event == "" {
+		return nil
+	}
+	orgID, err := db.userOrgID(k.UserID)
+	if err != nil {
+		return err
+	}
+	return db.recordEvent(event, k.APIKeyID, orgID, newKeyEvent(k))
+}
+
+// userOrgID returns the organization of a user, "" for instance-wide users
+// and users that do not exist
+func (db *DB) userOrgID(userID string) (string, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var orgID sql.NullString
+	err := db.conn().QueryRowContext(ctx, "SELECT org_id FROM users WHERE user_id = ?", userID).Scan(&orgID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get user organization: %w", err)
+	}
+	return orgID.String, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetForgeStatus records the commit status last posted for a badge
+func (db *DB) SetForgeStatus(s *ForgeStatus) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO forge_statuses (commit_id, repository, sha, state, error, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (commit_id) DO UPDATE SET
+			repository = excluded.repository, sha = excluded.sha, state = excluded.state,
+			error = excluded.error, updated_at = excluded.updated_at
+	`, s.CommitID, s.Repository, s.SHA, s.State, s.Error, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set forge status: %w", err)
+	}
+
+	return nil
+}
+
+// GetForgeStatus retrieves the commit status last posted for a badge
+func (db *DB) GetForgeStatus(commitID string) (*ForgeStatus, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var s ForgeStatus
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT commit_id, repository, sha, state, error, updated_at
+		FROM forge_statuses WHERE commit_id = ?
+	`, commitID).Scan(&s.CommitID, &s.Repository, &s.SHA, &s.State, &s.Error, &s.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get forge status: %w", err)
+	}
+
+	return &s, nil
+}
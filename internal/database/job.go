@@ -0,0 +1,277 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	// JobDead is a job that failed MaxAttempts times or permanently; it stays
+	// until retried
+	JobDead = "dead"
+)
+
+const jobColumns = `job_id, kind, payload, state, attempts, max_attempts, last_error, progress,
+	run_at, locked_until, created_at, updated_at, finished_at`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanJob reads a row of jobColumns
+func scanJob(row rowScanner) (*Job, error) {
+	var j Job
+	err := row.Scan(&j.JobID, &j.Kind, &j.Payload, &j.State, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.Progress,
+		&j.RunAt, &j.LockedUntil, &j.CreatedAt, &j.UpdatedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// CreateJob adds a queued job and sets its JobID
+func (db *DB) CreateJob(j *Job) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	j.State = JobQueued
+	res, err := db.conn().ExecContext(ctx, `
+		INSERT INTO jobs (kind, payload, state, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, j.Kind, j.Payload, j.State, j.MaxAttempts, j.RunAt.UTC(), j.CreatedAt.UTC(), j.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	if j.JobID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimJob marks the next due job running under a lease until now+lease and
+// returns it, or nil if none is due. Running jobs whose lease expired, e.g.
+// because their worker stopped, are claimed again.
+func (db *DB) ClaimJob(now time.Time, lease time.Duration) (*Job, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	now = now.UTC()
+	row := db.conn().QueryRowContext(ctx, `
+		UPDATE jobs SET state = ?, attempts = attempts + 1, locked_until = ?, updated_at = ?
+		WHERE job_id = (
+			SELECT job_id FROM jobs
+			WHERE (state = ? AND run_at <= ?) OR (state = ? AND locked_until <= ?)
+			ORDER BY run_at, job_id LIMIT 1
+		)
+		RETURNING `+jobColumns,
+		JobRunning, now.Add(lease), now, JobQueued, now, JobRunning, now)
+	j, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return j, nil
+}
+
+// ExtendJob records the progress of a running job and extends its lease
+func (db *DB) ExtendJob(jobID int64, progress sql.NullString, lockedUntil, now time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE jobs SET progress = ?, locked_until = ?, updated_at = ? WHERE job_id = ? AND state = ?
+	`, progress, lockedUntil.UTC(), now.UTC(), jobID, JobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	return nil
+}
+
+// FinishJob marks a running job done
+func (db *DB) FinishJob(jobID int64, now time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE jobs SET state = ?, locked_until = NULL, updated_at = ?, finished_at = ? WHERE job_id = ?
+	`, JobDone, now.UTC(), now.UTC(), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+
+	return nil
+}
+
+// FailJob records the error of a running job and queues it again at retryAt,
+// or moves it to the dead jobs if dead is set
+func (db *DB) FailJob(jobID int64, message string, retryAt time.Time, dead bool, now time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	query := "UPDATE jobs SET state = ?, last_error = ?, run_at = ?, locked_until = NULL, updated_at = ? WHERE job_id = ?"
+	args := []interface{}{JobQueued, message, retryAt.UTC(), now.UTC(), jobID}
+	if dead {
+		query = "UPDATE jobs SET state = ?, last_error = ?, locked_until = NULL, updated_at = ?, finished_at = ? WHERE job_id = ?"
+		args = []interface{}{JobDead, message, now.UTC(), now.UTC(), jobID}
+	}
+	if _, err := db.conn().ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to fail job: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseJob queues a running job again without counting its attempt, e.g.
+// when its worker stops
+func (db *DB) ReleaseJob(jobID int64, now time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE jobs SET state = ?, attempts = attempts - 1, locked_until = NULL, updated_at = ?
+		WHERE job_id = ? AND state = ?
+	`, JobQueued, now.UTC(), jobID, JobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+
+	return nil
+}
+
+// RetryJob queues a dead job again with fresh attempts and reports whether
+// there was a dead job with this ID
+func (db *DB) RetryJob(jobID int64, now time.Time) (bool, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	res, err := db.conn().ExecContext(ctx, `
+		UPDATE jobs SET state = ?, attempts = 0, run_at = ?, updated_at = ?, finished_at = NULL
+		WHERE job_id = ? AND state = ?
+	`, JobQueued, now.UTC(), now.UTC(), jobID, JobDead)
+	if err != nil {
+		return false, fmt.Errorf("failed to retry job: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetJob retrieves a job by ID, or nil if it does not exist
+func (db *DB) GetJob(jobID int64) (*Job, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	j, err := scanJob(db.conn().QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE job_id = ?", jobID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return j, nil
+}
+
+// ListJobs retrieves up to limit jobs, newest first, optionally of one kind
+// and state
+func (db *DB) ListJobs(kind, state string, limit int) ([]*Job, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	if kind != "" {
+		where, args = append(where, "kind = ?"), append(args, kind)
+	}
+	if state != "" {
+		where, args = append(where, "state = ?"), append(args, state)
+	}
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY job_id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// CountJobs counts the jobs per state
+func (db *DB) CountJobs() (map[string]int, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT state, COUNT(*) FROM jobs GROUP BY state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{JobQueued: 0, JobRunning: 0, JobDone: 0, JobDead: 0}
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan job count: %w", err)
+		}
+		counts[state] = n
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DeleteFinishedJobs removes the jobs done before a time and returns how many
+// were removed. Dead jobs are kept until retried.
+func (db *DB) DeleteFinishedJobs(before time.Time) (int64, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	res, err := db.conn().ExecContext(ctx, "DELETE FROM jobs WHERE state = ? AND finished_at < ?", JobDone, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished jobs: %w", err)
+	}
+
+	return n, nil
+}
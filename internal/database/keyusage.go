@@ -0,0 +1,72 @@
+package database
+
+import "fmt"
+
+// AddAPIKeyUsage adds counts to the daily usage of API keys
+func (db *DB) AddAPIKeyUsage(usage []*APIKeyUsage) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		for _, u := range usage {
+			_, err := tx.conn().ExecContext(ctx, `
+				INSERT INTO api_key_usage (day, api_key_id, requests, bytes) VALUES (?, ?, ?, ?)
+				ON CONFLICT (api_key_id, day) DO UPDATE SET
+					requests = requests + excluded.requests, bytes = bytes + excluded.bytes
+			`, u.Day, u.APIKeyID, u.Requests, u.Bytes)
+			if err != nil {
+				return fmt.Errorf("failed to add API key usage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListAPIKeyUsage retrieves the usage of an API key per day from a UTC day
+// until another (YYYY-MM-DD, both included), oldest first
+func (db *DB) ListAPIKeyUsage(apiKeyID, since, until string) ([]*APIKeyUsage, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT day, api_key_id, requests, bytes FROM api_key_usage
+		WHERE api_key_id = ? AND day >= ? AND day <= ? ORDER BY day
+	`, apiKeyID, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []*APIKeyUsage
+	for rows.Next() {
+		u := &APIKeyUsage{}
+		if err := rows.Scan(&u.Day, &u.APIKeyID, &u.Requests, &u.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan API key usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API key usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// SumAPIKeyUsage retrieves the total usage of an API key since a UTC day
+// (YYYY-MM-DD)
+func (db *DB) SumAPIKeyUsage(apiKeyID, since string) (*APIKeyUsage, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	u := &APIKeyUsage{APIKeyID: apiKeyID}
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(bytes), 0) FROM api_key_usage
+		WHERE api_key_id = ? AND day >= ?
+	`, apiKeyID, since).Scan(&u.Requests, &u.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum API key usage: %w", err)
+	}
+
+	return u, nil
+}
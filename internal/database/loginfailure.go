@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetLoginFailure retrieves the failed logins counted for key, or nil if
+// there are none
+func (db *DB) GetLoginFailure(key string) (*LoginFailure, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var f LoginFailure
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT key, failures, last_failure, blocked_until FROM login_failures WHERE key = ?
+	`, key).Scan(&f.Key, &f.Failures, &f.LastFailure, &f.BlockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login failures: %w", err)
+	}
+
+	return &f, nil
+}
+
+// RecordLoginFailure counts a failed login for key at the given time and
+// returns the number of failures since the count was last reset. Counts whose
+// last failure is before resetBefore start over, and are deleted for every
+// key once no block holds on them any more.
+func (db *DB) RecordLoginFailure(key string, at, resetBefore time.Time) (int, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	// Timestamps are compared in SQL, so they are stored in UTC
+	at, resetBefore = at.UTC(), resetBefore.UTC()
+	_, err := db.conn().ExecContext(ctx, `
+		DELETE FROM login_failures
+		WHERE last_failure < ? AND (blocked_until IS NULL OR blocked_until < ?)
+	`, resetBefore, at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune login failures: %w", err)
+	}
+
+	var failures int
+	err = db.conn().QueryRowContext(ctx, `
+		INSERT INTO login_failures (key, failures, last_failure) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END,
+			last_failure = excluded.last_failure
+		RETURNING failures
+	`, key, at, resetBefore).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// BlockLogin refuses logins for key until the given time
+func (db *DB) BlockLogin(key string, until time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE login_failures SET blocked_until = ? WHERE key = ?
+	`, until.UTC(), key)
+	if err != nil {
+		return fmt.Errorf("failed to block login: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLoginFailure resets the failed logins counted for key
+func (db *DB) DeleteLoginFailure(key string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	if _, err := db.conn().ExecContext(ctx, "DELETE FROM login_failures WHERE key = ?", key); err != nil {
+		return fmt.Errorf("failed to delete login failures: %w", err)
+	}
+
+	return nil
+}
@@ -21,6 +21,11 @@ type User struct {
 	LastLogin      sql.NullTime
 	Status         string
 	FailedAttempts int
+	// MustChangePassword is set for one-time passwords; the user gets a
+	// restricted session until they choose a new password
+	MustChangePassword bool
+	// OrgID is the organization the user administers; NULL for instance-wide users
+	OrgID sql.NullString
 }
 
 // Role represents a role entity in the database
@@ -29,46 +34,21 @@ type Role struct {
 	Name        string
 	Description string
 	Permissions string // JSON string of permissions
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// Inherits is the name of the role whose permissions this one adds to,
+	// or empty
+	Inherits  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// RolePermissions represents the permissions for a role
-type RolePermissions struct {
-	Badges struct {
-		Read   bool `json:"read"`
-		Write  bool `json:"write"`
-		Delete bool `json:"delete"`
-	} `json:"badges"`
-	Users struct {
-		Read   bool `json:"read"`
-		Write  bool `json:"write"`
-		Delete bool `json:"delete"`
-	} `json:"users"`
-	APIKeys struct {
-		Read   bool `json:"read"`
-		Write  bool `json:"write"`
-		Delete bool `json:"delete"`
-	} `json:"api_keys"`
-}
-
-// GetPermissions parses the permissions JSON
-func (r *Role) GetPermissions() (*RolePermissions, error) {
-	if r.Permissions == "" {
-		return &RolePermissions{}, nil
-	}
-
-	var permissions RolePermissions
-	err := json.Unmarshal([]byte(r.Permissions), &permissions)
-	if err != nil {
-		return nil, err
-	}
-
-	return &permissions, nil
+// GetPermissions parses the permissions JSON. They are the role's own; those
+// of the roles it inherits are added by auth.ResolvePermissions.
+func (r *Role) GetPermissions() (Permissions, error) {
+	return ParsePermissions(r.Permissions)
 }
 
 // SetPermissions sets the permissions JSON
-func (r *Role) SetPermissions(permissions *RolePermissions) error {
+func (r *Role) SetPermissions(permissions Permissions) error {
 	if permissions == nil {
 		r.Permissions = ""
 		return nil
@@ -95,33 +75,351 @@ type APIKey struct {
 	LastUsed       sql.NullTime
 	Status         string
 	IPRestrictions string // JSON array of IP restrictions
+	MonthlyQuota   int64  // requests allowed per UTC calendar month; 0 is unlimited
+	NotifyURL      string // webhook notified before the key expires; "" for none
+	ExpiryNotice   int    // days before expiry of the last warning sent; 0 for none
+	// LookupHash is the hex SHA-256 of the raw key, indexed so that a key is
+	// found without comparing it to every bcrypt hash; "" for keys created
+	// before it until they are next used
+	LookupHash string
 }
 
-// APIKeyPermissions represents the permissions for an API key
-type APIKeyPermissions struct {
-	Badges struct {
-		Read  bool `json:"read"`
-		Write bool `json:"write"`
-	} `json:"badges"`
+// Template represents a stored certificate SVG template. At most one template per
+// badge type is the default, which replaces the template file for that type.
+type Template struct {
+	TemplateID string
+	Name       string
+	BadgeType  string
+	Content    string
+	IsDefault  bool
+	CreatedBy  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
-// GetPermissions parses the permissions JSON
-func (a *APIKey) GetPermissions() (*APIKeyPermissions, error) {
-	if a.Permissions == "" {
-		return &APIKeyPermissions{}, nil
+// Issuer represents an issuer profile that badges can be linked to
+type Issuer struct {
+	IssuerID  string
+	Name      string
+	URL       sql.NullString
+	Logo      sql.NullString // logo URL or data: URI
+	Contact   sql.NullString
+	PublicKey sql.NullString // PEM encoded Ed25519 key the issuer signs with
+	Timezone  sql.NullString // IANA timezone the expiry dates of its badges end in; UTC if NULL
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CertificateType is a certificate family, e.g. Self-Assessed Dependencies.
+// Badges link to one through their certificate_type_id; it decides who may
+// issue them, their default template and their guide link.
+type CertificateType struct {
+	TypeID          string // slug of the name, e.g. "self-assessed-dependencies"
+	Name            string
+	SpecialtyDomain sql.NullString // e.g. "SOFTWARE LICENCING"
+	GuideURL        sql.NullString // guide explaining the certificate
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Organization is a tenant that owns users and badges. Its ID is the slug of
+// the /org/{org_id}/ URL namespace.
+type Organization struct {
+	OrgID     string
+	Name      string
+	Theme     sql.NullString // JSON CustomConfig applied under the custom config of the org's badges
+	Forges    sql.NullString // JSON list of Forge credentials for posting commit statuses
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Connectors is a JSON list of chat channels notified about the organization's badges
+	Connectors sql.NullString
+}
+
+// GetTheme parses the organization's theme
+func (o *Organization) GetTheme() (*CustomConfig, error) {
+	if !o.Theme.Valid || o.Theme.String == "" {
+		return &CustomConfig{}, nil
+	}
+
+	var config CustomConfig
+	if err := json.Unmarshal([]byte(o.Theme.String), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// GetForges parses the organization's forge credentials
+func (o *Organization) GetForges() ([]Forge, error) {
+	if !o.Forges.Valid || o.Forges.String == "" {
+		return nil, nil
+	}
+
+	var forges []Forge
+	if err := json.Unmarshal([]byte(o.Forges.String), &forges); err != nil {
+		return nil, err
+	}
+	return forges, nil
+}
+
+// SetForges serializes forge credentials into the organization; an empty list
+// clears them
+func (o *Organization) SetForges(forges []Forge) error {
+	if len(forges) == 0 {
+		o.Forges = sql.NullString{}
+		return nil
 	}
 
-	var permissions APIKeyPermissions
-	err := json.Unmarshal([]byte(a.Permissions), &permissions)
+	data, err := json.Marshal(forges)
 	if err != nil {
+		return err
+	}
+	o.Forges = sql.NullString{String: string(data), Valid: true}
+	return nil
+}
+
+// GetConnectors parses the organization's chat connectors
+func (o *Organization) GetConnectors() ([]Connector, error) {
+	if !o.Connectors.Valid || o.Connectors.String == "" {
+		return nil, nil
+	}
+
+	var connectors []Connector
+	if err := json.Unmarshal([]byte(o.Connectors.String), &connectors); err != nil {
 		return nil, err
 	}
+	return connectors, nil
+}
+
+// SetConnectors serializes chat connectors into the organization; an empty
+// list clears them
+func (o *Organization) SetConnectors(connectors []Connector) error {
+	if len(connectors) == 0 {
+		o.Connectors = sql.NullString{}
+		return nil
+	}
+
+	data, err := json.Marshal(connectors)
+	if err != nil {
+		return err
+	}
+	o.Connectors = sql.NullString{String: string(data), Valid: true}
+	return nil
+}
+
+// Connector is a chat channel that receives badge notifications through an
+// incoming webhook
+type Connector struct {
+	Name string `json:"name"` // identifies the connector within the organization
+	Type string `json:"type"` // slack, mattermost or teams
+	// URL is the incoming webhook URL; it embeds a secret and is never returned
+	URL string `json:"url,omitempty"`
+	// Events limits the notifications to issued, expiring and revoked; empty means all
+	Events []string `json:"events,omitempty"`
+}
+
+// Forge holds the credentials used to post commit statuses to a GitHub or
+// GitLab instance
+type Forge struct {
+	Type  string `json:"type"` // github or gitlab
+	Host  string `json:"host"` // e.g. github.com or gitlab.example.org
+	Token string `json:"token,omitempty"`
+	// APIURL overrides the API endpoint derived from Type and Host
+	APIURL string `json:"api_url,omitempty"`
+}
+
+// CatalogueProject is the Software Catalogue metadata last fetched for a project
+type CatalogueProject struct {
+	SCID string
+	Name sql.NullString
+	URL  sql.NullString
+	// MissingSince is set once the catalogue no longer knows the project
+	MissingSince sql.NullTime
+	CheckedAt    time.Time
+}
+
+// ForgeStatus records the last commit status posted for a badge
+type ForgeStatus struct {
+	CommitID   string
+	Repository string
+	SHA        string
+	State      string         // display status of the badge that was posted
+	Error      sql.NullString // set when posting failed
+	UpdatedAt  time.Time
+}
+
+// Group is a set of users authorized to issue the badge types granted to it
+type Group struct {
+	GroupID    string
+	Name       string
+	Members    []string // user IDs
+	BadgeTypes []string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// AuditEntry records a review workflow transition of a badge
+type AuditEntry struct {
+	AuditID    int64
+	CommitID   string
+	Action     string // submit, approve or reject
+	FromStatus Status
+	ToStatus   Status
+	ActorID    string // user ID of the issuer or reviewer
+	Comment    sql.NullString
+	CreatedAt  time.Time
+}
+
+// Session is a login of a user, shared by the tokens issued for it as they are
+// renewed. Revoking it invalidates those tokens.
+type Session struct {
+	SessionID string
+	UserID    string
+	UserAgent string
+	IP        string // client address as allowed by CLIENT_IP_LOGGING; "" when off
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time // expiry of the newest token issued for the session
+	RevokedAt sql.NullTime
+}
+
+// LoginFailure counts the failed logins of a username or client address, as
+// tracked by the login throttle
+type LoginFailure struct {
+	Key          string // "user:<username>" or "ip:<address>"
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil sql.NullTime
+}
+
+// UserAuditEntry records a security-sensitive action on a user account, such
+// as an administrator impersonating the user
+type UserAuditEntry struct {
+	AuditID   int64
+	Action    string // impersonate
+	ActorID   string // user ID of the administrator
+	SubjectID string // user ID of the account acted on
+	Detail    sql.NullString
+	CreatedAt time.Time
+}
+
+// Event is a domain event, e.g. a badge being issued, in the order events
+// happened. EventID is the cursor of the /api/events feed.
+type Event struct {
+	EventID   int64
+	Type      string // one of EventTypes
+	SubjectID string // commit ID, user ID or API key ID
+	OrgID     string // organization of the subject; "" for instance-level
+	ActorID   string // user ID of the caller, see WithActor; "" for background jobs
+	Data      string // JSON snapshot of the subject after the event
+	CreatedAt time.Time
+}
+
+// Comment is an internal note attached to a badge by a reviewer
+type Comment struct {
+	CommentID int64
+	CommitID  string
+	AuthorID  string // user ID of the author
+	Body      string
+	CreatedAt time.Time
+}
+
+// Alias is an alternate ID a badge can be reached by, e.g. an old or short ID
+type Alias struct {
+	Alias     string
+	CommitID  string
+	CreatedBy string // user ID of the creator
+	CreatedAt time.Time
+}
+
+// BadgeStats counts the image requests of a badge, or of all badges on a day,
+// and how many of them had to be rendered rather than served from the cache
+type BadgeStats struct {
+	Day      string `json:"day,omitempty"` // UTC, YYYY-MM-DD
+	CommitID string `json:"commit_id,omitempty"`
+	Requests int64  `json:"requests"`
+	Renders  int64  `json:"renders"`
+}
+
+// APIKeyUsage counts the requests made with an API key and the bytes of the
+// responses to them on a day or over a period
+type APIKeyUsage struct {
+	Day      string `json:"day,omitempty"` // UTC, YYYY-MM-DD
+	APIKeyID string `json:"-"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// OAuthClient is a service registered for the OAuth2 client-credentials
+// grant. Its tokens act as the user who registered it, limited to the
+// permissions of the client.
+type OAuthClient struct {
+	ClientID    string
+	SecretHash  string // bcrypt hash of the client secret
+	Name        string
+	UserID      string // user who registered the client
+	OrgID       string // organization the client is scoped to; "" for instance-wide
+	Permissions string // JSON string of the permissions the client may request
+	CreatedAt   time.Time
+	LastUsed    sql.NullTime
+	Status      string // "active" or "revoked"
+}
 
-	return &permissions, nil
+// ReferrerStats counts the image requests of a badge coming from a site, e.g.
+// "https://github.com", on a day or over a period
+type ReferrerStats struct {
+	Day      string `json:"day,omitempty"` // UTC, YYYY-MM-DD
+	CommitID string `json:"-"`
+	Referrer string `json:"referrer"`
+	Requests int64  `json:"requests"`
+}
+
+// Attachment is an evidence document attached to a badge during review. Its
+// content is loaded separately with GetAttachmentContent.
+type Attachment struct {
+	AttachmentID int64
+	CommitID     string
+	Filename     string
+	ContentType  string
+	Size         int64
+	BlobKey      sql.NullString // key in the blob store, if one is configured
+	UploadedBy   string         // user ID of the uploader
+	CreatedAt    time.Time
+}
+
+// SBOM is the current software bill of materials of a badge. The document
+// itself is kept as an attachment.
+type SBOM struct {
+	CommitID     string
+	AttachmentID int64
+	Summary      string // JSON-encoded sbom.Summary
+	UploadedBy   string
+	CreatedAt    time.Time
+}
+
+// Job is a unit of background work in the job queue
+type Job struct {
+	JobID       int64
+	Kind        string // selects the handler, e.g. "rerender"
+	Payload     string // JSON arguments of the handler
+	State       string // queued, running, done or dead
+	Attempts    int    // runs started so far
+	MaxAttempts int    // runs after which a failing job is dead
+	LastError   sql.NullString
+	Progress    sql.NullString // JSON reported by the running handler
+	RunAt       time.Time      // not run before, e.g. when retried with backoff
+	LockedUntil sql.NullTime   // lease of the running worker; expired leases are run again
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  sql.NullTime
+}
+
+// GetPermissions parses the permissions JSON
+func (a *APIKey) GetPermissions() (Permissions, error) {
+	return ParsePermissions(a.Permissions)
 }
 
 // SetPermissions sets the permissions JSON
-func (a *APIKey) SetPermissions(permissions *APIKeyPermissions) error {
+func (a *APIKey) SetPermissions(permissions Permissions) error {
 	if permissions == nil {
 		a.Permissions = ""
 		return nil
@@ -173,18 +471,18 @@ func (a *APIKey) SetIPRestrictions(restrictions []string) error {
 type Badge struct {
 	CommitID        string
 	Type            string // Deprecated: Kept for backward compatibility only
-	Status          string // "valid", "expired", "revoked"
+	Status          Status
 	Issuer          string
-	IssueDate       string
+	IssueDate       time.Time // midnight UTC of the issue day
 	SoftwareName    string
 	SoftwareVersion string
 	SoftwareURL     sql.NullString
 	Notes           sql.NullString
 	SVGContent      sql.NullString
-	ExpiryDate      sql.NullString
+	ExpiryDate      sql.NullTime // midnight UTC of the expiry day
 	IssuerURL       sql.NullString
 	CustomConfig    sql.NullString
-	LastReview      sql.NullString
+	LastReview      sql.NullTime
 	JPGContent      []byte
 	PNGContent      []byte
 	CoveredVersion  sql.NullString // semantic versioning X.X.X or git tag
@@ -196,6 +494,23 @@ type Badge struct {
 	SpecialtyDomain sql.NullString // specialty domain of the certificate, e.g., "SOFTWARE LICENCING"
 	SoftwareSCID    sql.NullString // Software Catalogue Project ID
 	SoftwareSCURL   sql.NullString // Software Catalogue Link, constructed as "https://sc.geant.org/ui/project/<software_sc_id>"
+	// Optional binding of the certificate to an exact source revision
+	GitRepository sql.NullString // repository the certified commit lives in
+	GitCommitSHA  sql.NullString // lowercase commit SHA, possibly abbreviated
+	GitTag        sql.NullString // tag pointing at the commit, e.g. "v1.2.3"
+	// Optional link to an issuer profile; Issuer and IssuerURL stay the display values
+	IssuerID sql.NullString
+	// Organization owning the badge; NULL for instance-level badges
+	OrgID sql.NullString
+	// Scheduled publication: until then the badge is not publicly served, and
+	// a draft is published when the time comes
+	PublishAt sql.NullTime
+	// Optional link to a certificate type; CertificateName and SpecialtyDomain
+	// stay the display values
+	CertificateTypeID sql.NullString
+	// Timezone of the linked issuer profile, read with the badge but not
+	// stored with it; the expiry date ends at midnight in it
+	IssuerTimezone sql.NullString
 	// The following fields are for storing pre-generated outlook-specific content
 	BadgeSVGContent      sql.NullString // Pre-generated SVG for badge outlook
 	CertificateSVGContent sql.NullString // Pre-generated SVG for certificate outlook
@@ -203,6 +518,9 @@ type Badge struct {
 	CertificatePNGContent []byte // Pre-generated PNG for certificate outlook
 	BadgeJPGContent      []byte // Pre-generated JPG for badge outlook
 	CertificateJPGContent []byte // Pre-generated JPG for certificate outlook
+	// Blob store keys for generated images kept outside the database
+	PNGKey sql.NullString
+	JPGKey sql.NullString
 }
 
 // CustomConfig represents the custom configuration for a badge
@@ -215,6 +533,19 @@ type CustomConfig struct {
     LogoURL       string `json:"logo,omitempty"`
     FontSize      int    `json:"font_size,omitempty"`
     Style         string `json:"style,omitempty"`
+    // Theme is the badge color scheme: light (default), dark or auto
+    Theme         string `json:"theme,omitempty"`
+    // Animated pulses recently issued badges and highlights badges close to expiry
+    Animated      bool   `json:"animated,omitempty"`
+    // Show picks the content of the small badge's right segment: name
+    // (default), version, expiry or status
+    Show          string `json:"show,omitempty"`
+    // StatusPreview renders the badge as valid, expired or revoked regardless
+    // of its status; set from the status_preview query parameter
+    StatusPreview string `json:"status_preview,omitempty"`
+    // PublicOverrides lists the query parameters public renders honor, comma
+    // separated, or none; unset uses the instance policy
+    PublicOverrides string `json:"public_overrides,omitempty"`
 
     // New color parameters for big certificate template
     LogoColor          string `json:"logo_color,omitempty"`
@@ -263,6 +594,43 @@ func (b *Badge) SetCustomConfig(config *CustomConfig) error {
 	return nil
 }
 
+// ApplyTheme fills the look of the badge's custom config that the badge does
+// not set itself from an organization theme
+func (b *Badge) ApplyTheme(theme *CustomConfig) error {
+	config, err := b.GetCustomConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []struct{ dst, src *string }{
+		{&config.ColorLeft, &theme.ColorLeft},
+		{&config.ColorRight, &theme.ColorRight},
+		{&config.TextColor, &theme.TextColor},
+		{&config.TextColorLeft, &theme.TextColorLeft},
+		{&config.TextColorRight, &theme.TextColorRight},
+		{&config.LogoURL, &theme.LogoURL},
+		{&config.Style, &theme.Style},
+		{&config.Theme, &theme.Theme},
+		{&config.LogoColor, &theme.LogoColor},
+		{&config.BackgroundColor, &theme.BackgroundColor},
+		{&config.HorizontalBarsColor, &theme.HorizontalBarsColor},
+		{&config.TopLabelColor, &theme.TopLabelColor},
+		{&config.GradientStartColor, &theme.GradientStartColor},
+		{&config.GradientEndColor, &theme.GradientEndColor},
+		{&config.BorderColor, &theme.BorderColor},
+		{&config.CertNameColor, &theme.CertNameColor},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	if config.FontSize == 0 {
+		config.FontSize = theme.FontSize
+	}
+
+	return b.SetCustomConfig(config)
+}
+
 // Repository represents a single repository link with a label and URL
 type Repository struct {
 	Name string `json:"name"`
@@ -309,19 +677,99 @@ func (b *Badge) SetRepositories(repos []Repository) error {
 
 // IsValid checks if the badge is valid
 func (b *Badge) IsValid() bool {
-	return b.Status == "valid"
+	return b.Status == StatusValid
+}
+
+// PlaceholderSoftwareName is the software name of badges created without one;
+// the catalogue sync replaces it with the project's name
+const PlaceholderSoftwareName = "New Certificate"
+
+// IsPublished reports whether the badge is publicly served, i.e. neither a
+// draft nor pending review, nor scheduled for later publication
+func (b *Badge) IsPublished() bool {
+	if b.PublishAt.Valid && b.PublishAt.Time.After(time.Now()) {
+		return false
+	}
+	return b.Status.IsPublished()
+}
+
+// DisplayStatus returns the status the badge is rendered with: revoked,
+// expired (by status or expiry date) or valid
+func (b *Badge) DisplayStatus() Status {
+	switch {
+	case b.Status == StatusRevoked:
+		return StatusRevoked
+	case b.Status == StatusExpired || b.IsExpired():
+		return StatusExpired
+	}
+	return StatusValid
+}
+
+// IsStatusPreview reports whether status is a valid status_preview value
+func IsStatusPreview(status string) bool {
+	switch Status(status) {
+	case StatusValid, StatusExpired, StatusRevoked:
+		return true
+	}
+	return false
+}
+
+// CertificateSlug returns the slug of the certificate name used in vanity
+// URLs, e.g. "self-assessed-dependencies", or "" if the badge has none
+func (b *Badge) CertificateSlug() string {
+	return Slugify(b.CertificateName.String)
+}
+
+// Slugify lowercases s and joins its runs of ASCII letters and digits with
+// hyphens
+func Slugify(s string) string {
+	var sb strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return sb.String()
+}
+
+// AccessType returns the type group grants and default templates apply to:
+// the badge's certificate type, or its legacy Type when it has none
+func (b *Badge) AccessType() string {
+	if b.CertificateTypeID.Valid && b.CertificateTypeID.String != "" {
+		return b.CertificateTypeID.String
+	}
+	return b.Type
 }
 
 // IsExpired checks if the badge is expired
 func (b *Badge) IsExpired() bool {
+	return b.IsExpiredAt(time.Now())
+}
+
+// IsExpiredAt checks if the badge is expired at t
+func (b *Badge) IsExpiredAt(t time.Time) bool {
+	expiresAt, ok := b.ExpiresAt()
+	return ok && !t.Before(expiresAt)
+}
+
+// ExpiresAt returns the instant the badge expires, in UTC: the start of its
+// expiry date in the issuer's timezone, or in UTC if the issuer has none.
+// ok is false if the badge does not expire.
+func (b *Badge) ExpiresAt() (expiresAt time.Time, ok bool) {
 	if !b.ExpiryDate.Valid {
-		return false
+		return time.Time{}, false
 	}
-
-	expiry, err := time.Parse("2006-01-02", b.ExpiryDate.String)
+	loc, err := LoadTimezone(b.IssuerTimezone.String)
 	if err != nil {
-		return false
+		loc = time.UTC
 	}
-
-	return time.Now().After(expiry)
+	d := b.ExpiryDate.Time
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc).UTC(), true
 }
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"testing"
+	"time"
 )
 
 func TestSetGetRepositories_RoundTrip(t *testing.T) {
@@ -90,3 +91,45 @@ func TestSetRepositories_EmptySlice(t *testing.T) {
 		t.Error("expected RepositoryLink to be invalid after setting empty slice")
 	}
 }
+
+func TestSlugify(t *testing.T) {
+	for in, want := range map[string]string{
+		"Self-Assessed Dependencies":  "self-assessed-dependencies",
+		"  Verified Software Licence": "verified-software-licence",
+		"ISO 27001 / Audit (2025)":    "iso-27001-audit-2025",
+		"":                            "",
+	} {
+		if got := Slugify(in); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	expiry := sql.NullTime{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+
+	if _, ok := (&Badge{}).ExpiresAt(); ok {
+		t.Error("expected a badge without expiry date not to expire")
+	}
+
+	utc := &Badge{ExpiryDate: expiry}
+	if got, _ := utc.ExpiresAt(); !got.Equal(expiry.Time) {
+		t.Errorf("expected expiry at midnight UTC, got %v", got)
+	}
+
+	// The expiry date ends at midnight in the issuer's timezone
+	tokyo := &Badge{ExpiryDate: expiry, IssuerTimezone: sql.NullString{String: "Asia/Tokyo", Valid: true}}
+	want := time.Date(2026, 2, 28, 15, 0, 0, 0, time.UTC)
+	if got, _ := tokyo.ExpiresAt(); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("expected expiry at %v, got %v", want, got)
+	}
+	if tokyo.IsExpiredAt(want.Add(-time.Second)) || !tokyo.IsExpiredAt(want) {
+		t.Error("expected the badge to expire exactly at midnight in Tokyo")
+	}
+
+	// An unknown timezone falls back to UTC
+	unknown := &Badge{ExpiryDate: expiry, IssuerTimezone: sql.NullString{String: "Mars/Olympus", Valid: true}}
+	if got, _ := unknown.ExpiresAt(); !got.Equal(expiry.Time) {
+		t.Errorf("expected expiry at midnight UTC for an unknown timezone, got %v", got)
+	}
+}
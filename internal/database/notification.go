@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ListNotificationStates retrieves the state last announced per badge
+func (db *DB) ListNotificationStates() (map[string]string, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, "SELECT commit_id, state FROM notification_states")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification states: %w", err)
+	}
+	defer rows.Close()
+
+	states := map[string]string{}
+	for rows.Next() {
+		var commitID, state string
+		if err := rows.Scan(&commitID, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan notification state: %w", err)
+		}
+		states[commitID] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification states: %w", err)
+	}
+
+	return states, nil
+}
+
+// SetNotificationState records the state last announced for a badge
+func (db *DB) SetNotificationState(commitID, state string, now time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO notification_states (commit_id, state, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (commit_id) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at
+	`, commitID, state, now)
+	if err != nil {
+		return fmt.Errorf("failed to set notification state: %w", err)
+	}
+
+	return nil
+}
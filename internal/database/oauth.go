@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateOAuthClient registers a new OAuth2 client
+func (db *DB) CreateOAuthClient(c *OAuthClient) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO oauth_clients (client_id, secret_hash, name, user_id, org_id, permissions, created_at, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.ClientID, c.SecretHash, c.Name, c.UserID, c.OrgID, c.Permissions, c.CreatedAt, c.Status)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth client: %w", err)
+	}
+
+	return nil
+}
+
+// GetOAuthClient retrieves an OAuth2 client by ID, or nil if there is none
+func (db *DB) GetOAuthClient(clientID string) (*OAuthClient, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var c OAuthClient
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT client_id, secret_hash, name, user_id, org_id, permissions, created_at, last_used, status
+		FROM oauth_clients WHERE client_id = ?
+	`, clientID).Scan(&c.ClientID, &c.SecretHash, &c.Name, &c.UserID, &c.OrgID, &c.Permissions, &c.CreatedAt, &c.LastUsed, &c.Status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	return &c, nil
+}
+
+// ListOAuthClients retrieves every OAuth2 client, newest first
+func (db *DB) ListOAuthClients() ([]*OAuthClient, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT client_id, secret_hash, name, user_id, org_id, permissions, created_at, last_used, status
+		FROM oauth_clients ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []*OAuthClient
+	for rows.Next() {
+		var c OAuthClient
+		if err := rows.Scan(&c.ClientID, &c.SecretHash, &c.Name, &c.UserID, &c.OrgID, &c.Permissions, &c.CreatedAt, &c.LastUsed, &c.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan OAuth client: %w", err)
+		}
+		clients = append(clients, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating OAuth clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+// RevokeOAuthClient marks an OAuth2 client as revoked; tokens issued to it
+// are refused from then on
+func (db *DB) RevokeOAuthClient(clientID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE oauth_clients SET status = 'revoked' WHERE client_id = ?", clientID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke OAuth client: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateOAuthClientLastUsed records when a client was last issued a token
+func (db *DB) UpdateOAuthClientLastUsed(clientID string, lastUsed time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "UPDATE oauth_clients SET last_used = ? WHERE client_id = ?", lastUsed, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to update OAuth client last used: %w", err)
+	}
+
+	return nil
+}
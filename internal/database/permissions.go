@@ -0,0 +1,82 @@
+package database
+
+import "encoding/json"
+
+// Wildcard grants every resource, or every action on a resource
+const Wildcard = "*"
+
+// Permissions grant actions on resources, e.g.
+// {"badges": {"read": true, "write": true}}. Resources and actions are open:
+// a subsystem checks its own resource name without changing the type, and
+// Wildcard stands for any of them.
+type Permissions map[string]map[string]bool
+
+// RolePermissions are the permissions stored on a role
+type RolePermissions = Permissions
+
+// APIKeyPermissions are the permissions stored on an API key
+type APIKeyPermissions = Permissions
+
+// ParsePermissions parses a permissions JSON object; an empty string grants
+// nothing
+func ParsePermissions(data string) (Permissions, error) {
+	permissions := Permissions{}
+	if data == "" {
+		return permissions, nil
+	}
+	if err := json.Unmarshal([]byte(data), &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// Allows reports whether the action on the resource is granted, directly or
+// through a wildcard
+func (p Permissions) Allows(resource, action string) bool {
+	for _, r := range []string{resource, Wildcard} {
+		if actions := p[r]; actions[action] || actions[Wildcard] {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the grants of p and other together
+func (p Permissions) Merge(other Permissions) Permissions {
+	merged := Permissions{}
+	for _, from := range []Permissions{p, other} {
+		for resource, actions := range from {
+			for action, granted := range actions {
+				if !granted {
+					continue
+				}
+				if merged[resource] == nil {
+					merged[resource] = map[string]bool{}
+				}
+				merged[resource][action] = true
+			}
+		}
+	}
+	return merged
+}
+
+// Intersect returns the grants of p that other allows as well, wildcards
+// included: {"*": {"*": true}} intersected with {"badges": {"read": true}} is
+// {"badges": {"read": true}}
+func (p Permissions) Intersect(other Permissions) Permissions {
+	both := Permissions{}
+	for _, pair := range [][2]Permissions{{p, other}, {other, p}} {
+		for resource, actions := range pair[0] {
+			for action, granted := range actions {
+				if !granted || !pair[1].Allows(resource, action) {
+					continue
+				}
+				if both[resource] == nil {
+					both[resource] = map[string]bool{}
+				}
+				both[resource][action] = true
+			}
+		}
+	}
+	return both
+}
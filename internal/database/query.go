@@ -0,0 +1,245 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPerPage caps the page size of paginated badge listings
+const MaxPerPage = 100
+
+// badgeSortColumns maps the sort keys accepted by ParseBadgeQuery to columns
+var badgeSortColumns = map[string]string{
+	"issue_date":       "issue_date",
+	"expiry_date":      "expiry_date",
+	"last_review":      "last_review",
+	"software_name":    "software_name COLLATE NOCASE",
+	"certificate_name": "certificate_name COLLATE NOCASE",
+	"status":           "status",
+	"issuer":           "issuer COLLATE NOCASE",
+}
+
+// BadgeQuery filters, sorts and paginates a badge listing. Zero values mean
+// no filter, insertion order and no pagination.
+type BadgeQuery struct {
+	Status        string
+	Issuer        string
+	Domain        string
+	Org           string // limits the listing to the badges of an organization
+	IncludeDrafts bool   // also lists drafts and badges pending review
+	// DraftOrg limits the included drafts to those of an organization
+	DraftOrg string
+	// CatalogueMissing limits the listing to badges whose Software Catalogue
+	// project has disappeared
+	CatalogueMissing bool
+	// Sort is a key of badgeSortColumns; Desc reverses it
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// ParseBadgeQuery reads the status, issuer, domain, org, catalogue, sort (prefix
+// with - for descending), page and per_page query parameters. IncludeDrafts is left to
+// the caller, which knows the viewer's permissions.
+func ParseBadgeQuery(values url.Values) (BadgeQuery, error) {
+	q := BadgeQuery{
+		Status: strings.TrimSpace(values.Get("status")),
+		Issuer: strings.TrimSpace(values.Get("issuer")),
+		Domain: strings.TrimSpace(values.Get("domain")),
+		Org:    strings.TrimSpace(values.Get("org")),
+	}
+
+	switch catalogue := values.Get("catalogue"); catalogue {
+	case "":
+	case "missing":
+		q.CatalogueMissing = true
+	default:
+		return q, fmt.Errorf("invalid catalogue: %s", catalogue)
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		q.Sort, q.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+		if _, ok := badgeSortColumns[q.Sort]; !ok {
+			return q, fmt.Errorf("invalid sort: %s", sort)
+		}
+	}
+
+	if page := values.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("invalid page: %s", page)
+		}
+		q.Page = n
+	}
+	if perPage := values.Get("per_page"); perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > MaxPerPage {
+			return q, fmt.Errorf("invalid per_page: must be between 1 and %d", MaxPerPage)
+		}
+		q.PerPage = n
+	}
+	return q, nil
+}
+
+// Paginated reports whether the query asks for a single page
+func (q BadgeQuery) Paginated() bool {
+	return q.Page > 0 || q.PerPage > 0
+}
+
+// Values returns the query parameters describing q, in a canonical order
+// suitable for cache keys and page links. Page is omitted so that callers can
+// set it per link.
+func (q BadgeQuery) Values() url.Values {
+	v := url.Values{}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.Issuer != "" {
+		v.Set("issuer", q.Issuer)
+	}
+	if q.Domain != "" {
+		v.Set("domain", q.Domain)
+	}
+	if q.Org != "" {
+		v.Set("org", q.Org)
+	}
+	if q.CatalogueMissing {
+		v.Set("catalogue", "missing")
+	}
+	if q.Sort != "" {
+		sort := q.Sort
+		if q.Desc {
+			sort = "-" + sort
+		}
+		v.Set("sort", sort)
+	}
+	if q.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return v
+}
+
+// publishedCond matches the badges that are publicly served at the time
+// given as its argument, see Badge.IsPublished
+const publishedCond = "(status COLLATE NOCASE NOT IN ('draft', 'pending') AND (publish_at IS NULL OR publish_at <= ?))"
+
+// SearchBadges retrieves the badges matching q along with the total number
+// of matches before pagination
+func (db *DB) SearchBadges(q BadgeQuery) ([]*Badge, int, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var conds []string
+	var args []interface{}
+	if !q.IncludeDrafts {
+		conds = append(conds, publishedCond)
+		args = append(args, time.Now().UTC())
+	} else if q.DraftOrg != "" {
+		conds = append(conds, "("+publishedCond+" OR org_id = ?)")
+		args = append(args, time.Now().UTC(), q.DraftOrg)
+	}
+	if q.Status != "" {
+		conds = append(conds, "status = ? COLLATE NOCASE")
+		args = append(args, q.Status)
+	}
+	if q.Issuer != "" {
+		conds = append(conds, "issuer = ? COLLATE NOCASE")
+		args = append(args, q.Issuer)
+	}
+	if q.Domain != "" {
+		conds = append(conds, "specialty_domain = ? COLLATE NOCASE")
+		args = append(args, q.Domain)
+	}
+	if q.Org != "" {
+		conds = append(conds, "org_id = ?")
+		args = append(args, q.Org)
+	}
+	if q.CatalogueMissing {
+		conds = append(conds, "software_sc_id IN (SELECT sc_id FROM catalogue_projects WHERE missing_since IS NOT NULL)")
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM badges"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count badges: %w", err)
+	}
+
+	order := " ORDER BY rowid"
+	if column, ok := badgeSortColumns[q.Sort]; ok {
+		dir := " ASC"
+		if q.Desc {
+			dir = " DESC"
+		}
+		order = " ORDER BY " + column + dir + ", rowid"
+	}
+
+	limit := ""
+	if q.Paginated() {
+		perPage, page := q.PerPage, q.Page
+		if perPage == 0 {
+			perPage = MaxPerPage
+		}
+		if page == 0 {
+			page = 1
+		}
+		limit = " LIMIT ? OFFSET ?"
+		args = append(args, perPage, (page-1)*perPage)
+	}
+
+	badges, err := db.queryBadges(where+order+limit, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return badges, total, nil
+}
+
+// TotalPages returns the number of pages needed for total badges, at least one
+func TotalPages(total, perPage int) int {
+	if perPage <= 0 || total <= perPage {
+		return 1
+	}
+	return (total + perPage - 1) / perPage
+}
+
+// PageURL links to a page of the listing at path with the same filters, plus
+// any extra parameters such as format
+func (q BadgeQuery) PageURL(path string, page int, extra url.Values) string {
+	v := q.Values()
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	for key, values := range extra {
+		v[key] = values
+	}
+	if len(v) == 0 {
+		return path
+	}
+	return path + "?" + v.Encode()
+}
+
+// LinkHeader builds an RFC 8288 Link header with the first, prev, next and
+// last pages of a paginated listing at path
+func (q BadgeQuery) LinkHeader(path string, total int, extra url.Values) string {
+	page := max(q.Page, 1)
+	if q.PerPage == 0 {
+		q.PerPage = MaxPerPage
+	}
+	last := TotalPages(total, q.PerPage)
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, q.PageURL(path, 1, extra))}
+	if page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, q.PageURL(path, page-1, extra)))
+	}
+	if page < last {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, q.PageURL(path, page+1, extra)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, q.PageURL(path, last, extra)))
+	return strings.Join(links, ", ")
+}
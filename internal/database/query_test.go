@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseBadgeQuery(t *testing.T) {
+	q, err := ParseBadgeQuery(url.Values{"status": {"valid"}, "sort": {"-issue_date"}, "page": {"2"}, "per_page": {"10"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if q.Status != "valid" || q.Sort != "issue_date" || !q.Desc || q.Page != 2 || q.PerPage != 10 {
+		t.Errorf("Unexpected query %+v", q)
+	}
+	if got := q.Values().Encode(); got != "per_page=10&sort=-issue_date&status=valid" {
+		t.Errorf("Unexpected canonical values %q", got)
+	}
+
+	for _, bad := range []url.Values{
+		{"sort": {"svg_content"}},
+		{"page": {"0"}},
+		{"page": {"x"}},
+		{"per_page": {"101"}},
+	} {
+		if _, err := ParseBadgeQuery(bad); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
+
+func TestSearchBadges(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "query.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for _, b := range []*Badge{
+		{CommitID: "aaa111", Status: "valid", Issuer: "GÉANT", IssueDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), SpecialtyDomain: sql.NullString{String: "Security", Valid: true}},
+		{CommitID: "bbb222", Status: "revoked", Issuer: "GÉANT", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{CommitID: "ccc333", Status: "valid", Issuer: "Other", IssueDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{CommitID: "ddd444", Status: "draft", Issuer: "GÉANT", IssueDate: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{CommitID: "eee555", Status: "Pending", Issuer: "GÉANT", IssueDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		b.Type, b.SoftwareName, b.SoftwareVersion = "badge", "App", "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	ids := func(badges []*Badge) string {
+		var out []string
+		for _, b := range badges {
+			out = append(out, b.CommitID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name  string
+		query BadgeQuery
+		want  string
+		total int
+	}{
+		{"public", BadgeQuery{}, "aaa111,bbb222,ccc333", 3},
+		{"drafts", BadgeQuery{IncludeDrafts: true}, "aaa111,bbb222,ccc333,ddd444,eee555", 5},
+		{"status", BadgeQuery{Status: "VALID"}, "aaa111,ccc333", 2},
+		{"issuer", BadgeQuery{Issuer: "other"}, "ccc333", 1},
+		{"domain", BadgeQuery{Domain: "security"}, "aaa111", 1},
+		{"sort", BadgeQuery{Sort: "issue_date", Desc: true}, "aaa111,ccc333,bbb222", 3},
+		{"page", BadgeQuery{Sort: "issue_date", Page: 2, PerPage: 2}, "aaa111", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			badges, total, err := db.SearchBadges(tt.query)
+			if err != nil {
+				t.Fatalf("SearchBadges failed: %v", err)
+			}
+			if got := ids(badges); got != tt.want || total != tt.total {
+				t.Errorf("Expected %s (%d total), got %s (%d total)", tt.want, tt.total, got, total)
+			}
+		})
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	q := BadgeQuery{Status: "valid", Page: 2, PerPage: 10}
+	want := `</api/badges?per_page=10&status=valid>; rel="first", ` +
+		`</api/badges?per_page=10&status=valid>; rel="prev", ` +
+		`</api/badges?page=3&per_page=10&status=valid>; rel="next", ` +
+		`</api/badges?page=3&per_page=10&status=valid>; rel="last"`
+	if got := q.LinkHeader("/api/badges", 25, nil); got != want {
+		t.Errorf("Unexpected Link header:\n got %s\nwant %s", got, want)
+	}
+	if got := TotalPages(0, 25); got != 1 {
+		t.Errorf("Expected an empty listing to have one page, got %d", got)
+	}
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStatusChanged is returned by ReviewBadge when the badge no longer has the
+// status the transition started from
+var ErrStatusChanged = errors.New("badge status changed concurrently")
+
+// reviewTransitions maps each review action to the status it applies to and
+// the status it leads to
+var reviewTransitions = map[string]struct{ from, to Status }{
+	"submit":  {StatusDraft, StatusPending},
+	"approve": {StatusPending, StatusValid},
+	"reject":  {StatusPending, StatusDraft},
+}
+
+// ReviewTransition returns the status a review action moves a badge with the
+// given status to
+func ReviewTransition(status Status, action string) (Status, error) {
+	t, ok := reviewTransitions[action]
+	if !ok {
+		return "", fmt.Errorf("unknown review action %q: use submit, approve or reject", action)
+	}
+	if status != t.from {
+		return "", fmt.Errorf("cannot %s a badge with status %s", action, status)
+	}
+	return t.to, nil
+}
+
+// CheckStatusChange validates a status change made by editing a badge rather
+// than through review. The change must follow the lifecycle; badges enter and
+// leave "pending" only through review, and when approval is required
+// unpublished badges are only published by approving them.
+func CheckStatusChange(from, to Status, requireApproval bool) error {
+	switch {
+	case from == to:
+		return CheckTransition(from, to)
+	case to == StatusPending:
+		return fmt.Errorf("submit the badge for review instead of setting status pending")
+	case from == StatusPending:
+		return fmt.Errorf("the badge is pending review; approve or reject it instead")
+	case requireApproval && !from.IsPublished() && to.IsPublished():
+		return fmt.Errorf("badges are published by approving them through review")
+	}
+	return CheckTransition(from, to)
+}
+
+// CheckNewStatus validates the status a badge is created with. Badges may be
+// recorded in any published status, but enter "pending" only through review,
+// and when approval is required start as drafts.
+func CheckNewStatus(status Status, requireApproval bool) error {
+	switch {
+	case !status.Valid():
+		return fmt.Errorf("unknown status %q: use %s", status, StatusNames())
+	case status == StatusPending:
+		return fmt.Errorf("submit the badge for review instead of setting status pending")
+	case requireApproval && status.IsPublished():
+		return fmt.Errorf("badges are published by approving them through review")
+	}
+	return nil
+}
+
+// ReviewBadge moves a badge from one status to another and records the
+// transition in the audit log, with the badge.issued event when approval
+// publishes it. Stored renders are dropped since they show the previous
+// status.
+func (db *DB) ReviewBadge(entry *AuditEntry) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		res, err := tx.conn().ExecContext(ctx, `
+			UPDATE badges SET status = ?, png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+			WHERE commit_id = ? AND status = ?
+		`, entry.ToStatus, entry.CommitID, entry.FromStatus)
+		if err != nil {
+			return fmt.Errorf("failed to update badge status: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to update badge status: %w", err)
+		} else if n == 0 {
+			return ErrStatusChanged
+		}
+
+		res, err = tx.conn().ExecContext(ctx, `
+			INSERT INTO badge_audit (commit_id, action, from_status, to_status, actor_id, comment, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, entry.CommitID, entry.Action, entry.FromStatus, entry.ToStatus, entry.ActorID, entry.Comment, entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create audit entry: %w", err)
+		}
+		if entry.AuditID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to create audit entry: %w", err)
+		}
+
+		return tx.recordBadgeStatusEvent(entry.CommitID, entry.FromStatus, entry.ToStatus)
+	})
+}
+
+// ListAuditEntries retrieves the review history of a badge, oldest first
+func (db *DB) ListAuditEntries(commitID string) ([]*AuditEntry, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT audit_id, commit_id, action, from_status, to_status, actor_id, comment, created_at
+		FROM badge_audit WHERE commit_id = ? ORDER BY audit_id
+	`, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.AuditID, &e.CommitID, &e.Action, &e.FromStatus, &e.ToStatus, &e.ActorID, &e.Comment, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// LastSubmitter returns the user who last submitted the badge for review, or
+// "" if it never was
+func (db *DB) LastSubmitter(commitID string) (string, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var actorID string
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT actor_id FROM badge_audit WHERE commit_id = ? AND action = 'submit'
+		ORDER BY audit_id DESC LIMIT 1
+	`, commitID).Scan(&actorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get submitter: %w", err)
+	}
+
+	return actorID, nil
+}
+
+// PublishScheduled publishes the badges whose publish_at has passed and
+// returns their commit IDs. Due drafts become valid, recorded as a "publish"
+// audit entry, unless publishDrafts is false because approval is required;
+// approved badges simply become visible. publish_at is cleared either way.
+func (db *DB) PublishScheduled(now time.Time, publishDrafts bool) ([]string, error) {
+	var ids []string
+	err := db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		rows, err := tx.conn().QueryContext(ctx, `
+			SELECT commit_id, status FROM badges
+			WHERE publish_at IS NOT NULL AND publish_at <= ?
+				AND (status COLLATE NOCASE NOT IN ('draft', 'pending') OR (? AND status = 'draft' COLLATE NOCASE))
+		`, now.UTC(), publishDrafts)
+		if err != nil {
+			return fmt.Errorf("failed to list scheduled badges: %w", err)
+		}
+		due := map[string]Status{}
+		for rows.Next() {
+			var commitID string
+			var status Status
+			if err := rows.Scan(&commitID, &status); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan scheduled badge: %w", err)
+			}
+			due[commitID] = status
+			ids = append(ids, commitID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating scheduled badges: %w", err)
+		}
+
+		for _, commitID := range ids {
+			status := due[commitID]
+			if status.IsPublished() {
+				if _, err := tx.conn().ExecContext(ctx, "UPDATE badges SET publish_at = NULL WHERE commit_id = ?", commitID); err != nil {
+					return fmt.Errorf("failed to publish badge %s: %w", commitID, err)
+				}
+				continue
+			}
+			_, err := tx.conn().ExecContext(ctx, `
+				UPDATE badges SET status = 'valid', publish_at = NULL,
+					png_content = NULL, jpg_content = NULL, png_key = NULL, jpg_key = NULL
+				WHERE commit_id = ?
+			`, commitID)
+			if err != nil {
+				return fmt.Errorf("failed to publish badge %s: %w", commitID, err)
+			}
+			_, err = tx.conn().ExecContext(ctx, `
+				INSERT INTO badge_audit (commit_id, action, from_status, to_status, actor_id, created_at)
+				VALUES (?, 'publish', ?, 'valid', 'scheduler', ?)
+			`, commitID, status, now)
+			if err != nil {
+				return fmt.Errorf("failed to create audit entry: %w", err)
+			}
+			if err := tx.recordBadgeStatusEvent(commitID, status, StatusValid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetSBOM records the current SBOM of a badge, replacing the previous one.
+// Earlier documents stay attached as evidence.
+func (db *DB) SetSBOM(s *SBOM) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		INSERT INTO badge_sboms (commit_id, attachment_id, summary, uploaded_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (commit_id) DO UPDATE SET
+			attachment_id = excluded.attachment_id, summary = excluded.summary,
+			uploaded_by = excluded.uploaded_by, created_at = excluded.created_at
+	`, s.CommitID, s.AttachmentID, s.Summary, s.UploadedBy, s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set SBOM: %w", err)
+	}
+
+	return nil
+}
+
+// GetSBOM retrieves the current SBOM of a badge
+func (db *DB) GetSBOM(commitID string) (*SBOM, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var s SBOM
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT commit_id, attachment_id, summary, uploaded_by, created_at
+		FROM badge_sboms WHERE commit_id = ?
+	`, commitID).Scan(&s.CommitID, &s.AttachmentID, &s.Summary, &s.UploadedBy, &s.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get SBOM: %w", err)
+	}
+
+	return &s, nil
+}
+
+// DeleteSBOM removes the SBOM summary of a badge; the document stays attached
+func (db *DB) DeleteSBOM(commitID string) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, "DELETE FROM badge_sboms WHERE commit_id = ?", commitID)
+	if err != nil {
+		return fmt.Errorf("failed to delete SBOM: %w", err)
+	}
+
+	return nil
+}
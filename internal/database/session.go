@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateSession records a new session. Revoked and expired sessions of the
+// same user are deleted, so that the table does not grow with every login.
+func (db *DB) CreateSession(s *Session) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	// Timestamps are compared in SQL, so they are stored in UTC
+	_, err := db.conn().ExecContext(ctx, `
+		DELETE FROM sessions WHERE user_id = ? AND (revoked_at IS NOT NULL OR expires_at < ?)
+	`, s.UserID, s.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to delete ended sessions: %w", err)
+	}
+
+	_, err = db.conn().ExecContext(ctx, `
+		INSERT INTO sessions (session_id, user_id, user_agent, ip, created_at, last_seen, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, s.SessionID, s.UserID, s.UserAgent, s.IP, s.CreatedAt.UTC(), s.LastSeen.UTC(), s.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession retrieves a session by ID, or nil if there is none
+func (db *DB) GetSession(sessionID string) (*Session, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	var s Session
+	err := db.conn().QueryRowContext(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_seen, expires_at, revoked_at
+		FROM sessions WHERE session_id = ?
+	`, sessionID).Scan(&s.SessionID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return &s, nil
+}
+
+// ListActiveSessions retrieves the sessions of a user that are neither
+// revoked nor expired at now, most recently seen first
+func (db *DB) ListActiveSessions(userID string, now time.Time) ([]*Session, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_seen, expires_at, revoked_at
+		FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen DESC
+	`, userID, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.SessionID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that a session was used at lastSeen from ip
+func (db *DB) TouchSession(sessionID, ip string, lastSeen time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE sessions SET last_seen = ?, ip = ? WHERE session_id = ?
+	`, lastSeen.UTC(), ip, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
+// ExtendSession records the expiry of a token renewed for a session
+func (db *DB) ExtendSession(sessionID string, expiresAt time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE sessions SET expires_at = ? WHERE session_id = ?
+	`, expiresAt.UTC(), sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSession ends a session; the tokens issued for it are no longer
+// accepted. Revoking a revoked or unknown session does nothing.
+func (db *DB) RevokeSession(sessionID string, revokedAt time.Time) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	_, err := db.conn().ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = ? WHERE session_id = ? AND revoked_at IS NULL
+	`, revokedAt.UTC(), sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package database
+
+import "fmt"
+
+// AddBadgeStats adds counts to the daily badge and referrer statistics
+func (db *DB) AddBadgeStats(stats []*BadgeStats, referrers []*ReferrerStats) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		for _, s := range stats {
+			_, err := tx.conn().ExecContext(ctx, `
+				INSERT INTO badge_daily_stats (day, commit_id, requests, renders) VALUES (?, ?, ?, ?)
+				ON CONFLICT (day, commit_id) DO UPDATE SET
+					requests = requests + excluded.requests, renders = renders + excluded.renders
+			`, s.Day, s.CommitID, s.Requests, s.Renders)
+			if err != nil {
+				return fmt.Errorf("failed to add badge stats: %w", err)
+			}
+		}
+		for _, s := range referrers {
+			_, err := tx.conn().ExecContext(ctx, `
+				INSERT INTO badge_referrers (day, commit_id, referrer, requests) VALUES (?, ?, ?, ?)
+				ON CONFLICT (commit_id, day, referrer) DO UPDATE SET requests = requests + excluded.requests
+			`, s.Day, s.CommitID, s.Referrer, s.Requests)
+			if err != nil {
+				return fmt.Errorf("failed to add referrer stats: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// AggregateBadgeStats merges the daily badge and referrer counts of days
+// before a UTC day (YYYY-MM-DD) into one count per month, dated the first of
+// the month
+func (db *DB) AggregateBadgeStats(before string) error {
+	return db.WithTx(func(tx *DB) error {
+		stats, err := tx.queryBadgeStats(`
+			SELECT substr(day, 1, 7) || '-01', commit_id, SUM(requests), SUM(renders) FROM badge_daily_stats
+			WHERE day < ? GROUP BY 1, commit_id
+		`, before)
+		if err != nil {
+			return err
+		}
+		referrers, err := tx.queryReferrerStats(`
+			SELECT substr(day, 1, 7) || '-01', commit_id, referrer, SUM(requests) FROM badge_referrers
+			WHERE day < ? GROUP BY 1, commit_id, referrer
+		`, before)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_daily_stats WHERE day < ?", before); err != nil {
+			return fmt.Errorf("failed to aggregate badge stats: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_referrers WHERE day < ?", before); err != nil {
+			return fmt.Errorf("failed to aggregate referrer stats: %w", err)
+		}
+		// Months aggregated before are summed again with the days since
+		return tx.AddBadgeStats(stats, referrers)
+	})
+}
+
+// DeleteBadgeStats removes the request and referrer counts of a badge
+func (db *DB) DeleteBadgeStats(commitID string) error {
+	return db.WithTx(func(tx *DB) error {
+		ctx, cancel := tx.queryContext()
+		defer cancel()
+
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_daily_stats WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge stats: %w", err)
+		}
+		if _, err := tx.conn().ExecContext(ctx, "DELETE FROM badge_referrers WHERE commit_id = ?", commitID); err != nil {
+			return fmt.Errorf("failed to delete badge referrers: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListDailyStats retrieves the requests and renders of all badges per day
+// since a UTC day (YYYY-MM-DD), oldest first
+func (db *DB) ListDailyStats(since string) ([]*BadgeStats, error) {
+	return db.queryBadgeStats(`
+		SELECT day, '', SUM(requests), SUM(renders) FROM badge_daily_stats
+		WHERE day >= ? GROUP BY day ORDER BY day
+	`, since)
+}
+
+// ListBadgeDailyStats retrieves the requests and renders of a badge per day
+// since a UTC day (YYYY-MM-DD), oldest first
+func (db *DB) ListBadgeDailyStats(commitID, since string) ([]*BadgeStats, error) {
+	return db.queryBadgeStats(`
+		SELECT day, commit_id, requests, renders FROM badge_daily_stats
+		WHERE commit_id = ? AND day >= ? ORDER BY day
+	`, commitID, since)
+}
+
+// TopRequestedBadges retrieves the limit badges with the most requests since
+// a UTC day (YYYY-MM-DD), most requested first
+func (db *DB) TopRequestedBadges(since string, limit int) ([]*BadgeStats, error) {
+	return db.queryBadgeStats(`
+		SELECT '', commit_id, SUM(requests) AS total, SUM(renders) FROM badge_daily_stats
+		WHERE day >= ? GROUP BY commit_id ORDER BY total DESC, commit_id LIMIT ?
+	`, since, limit)
+}
+
+// TopReferrers retrieves the limit sites the most image requests of a badge
+// came from since a UTC day (YYYY-MM-DD), most requests first
+func (db *DB) TopReferrers(commitID, since string, limit int) ([]*ReferrerStats, error) {
+	return db.queryReferrerStats(`
+		SELECT '', commit_id, referrer, SUM(requests) AS total FROM badge_referrers
+		WHERE commit_id = ? AND day >= ? GROUP BY commit_id, referrer ORDER BY total DESC, referrer LIMIT ?
+	`, commitID, since, limit)
+}
+
+// queryBadgeStats runs a query selecting day, commit ID, requests and renders
+func (db *DB) queryBadgeStats(query string, args ...interface{}) ([]*BadgeStats, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query badge stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*BadgeStats
+	for rows.Next() {
+		s := &BadgeStats{}
+		if err := rows.Scan(&s.Day, &s.CommitID, &s.Requests, &s.Renders); err != nil {
+			return nil, fmt.Errorf("failed to scan badge stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating badge stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// queryReferrerStats runs a query selecting day, commit ID, referrer and requests
+func (db *DB) queryReferrerStats(query string, args ...interface{}) ([]*ReferrerStats, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query referrer stats: %w", err)
+	}
+	defer rows.Close()
+
+	var referrers []*ReferrerStats
+	for rows.Next() {
+		s := &ReferrerStats{}
+		if err := rows.Scan(&s.Day, &s.CommitID, &s.Referrer, &s.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan referrer stats: %w", err)
+		}
+		referrers = append(referrers, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating referrer stats: %w", err)
+	}
+
+	return referrers, nil
+}
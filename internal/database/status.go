@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Status is the lifecycle state of a badge
+type Status string
+
+// Statuses of the badge lifecycle. Drafts and badges pending review are not
+// publicly served.
+const (
+	StatusDraft   Status = "draft"
+	StatusPending Status = "pending"
+	StatusValid   Status = "valid"
+	StatusExpired Status = "expired"
+	StatusRevoked Status = "revoked"
+)
+
+// Statuses are the statuses a badge can be stored with, in lifecycle order
+var Statuses = []Status{StatusDraft, StatusPending, StatusValid, StatusExpired, StatusRevoked}
+
+// statusTransitions is the badge lifecycle: drafts are submitted for review,
+// which approves or rejects them, or published directly when no approval is
+// required. Published badges expire or are revoked; an expired badge may be
+// renewed or revoked, and revocation is final.
+var statusTransitions = map[Status][]Status{
+	StatusDraft:   {StatusPending, StatusValid},
+	StatusPending: {StatusDraft, StatusValid},
+	StatusValid:   {StatusExpired, StatusRevoked},
+	StatusExpired: {StatusValid, StatusRevoked},
+	StatusRevoked: nil,
+}
+
+// ParseStatus parses a status name, ignoring case and surrounding space
+func ParseStatus(s string) (Status, error) {
+	status := Status(strings.ToLower(strings.TrimSpace(s)))
+	if !status.Valid() {
+		return "", fmt.Errorf("unknown status %q: use %s", s, StatusNames())
+	}
+	return status, nil
+}
+
+// StatusNames lists the statuses, e.g. for error messages
+func StatusNames() string {
+	names := make([]string, len(Statuses))
+	for i, s := range Statuses {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Valid reports whether s is one of Statuses
+func (s Status) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// IsPublished reports whether badges with the status are publicly served
+func (s Status) IsPublished() bool {
+	return s != StatusDraft && s != StatusPending
+}
+
+// CanTransitionTo reports whether a badge may move from s to to; staying in
+// the same status is always allowed
+func (s Status) CanTransitionTo(to Status) bool {
+	if s == to {
+		return to.Valid()
+	}
+	for _, next := range statusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransition validates a status change against the lifecycle
+func CheckTransition(from, to Status) error {
+	if !to.Valid() {
+		return fmt.Errorf("unknown status %q: use %s", to, StatusNames())
+	}
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("a %s badge cannot become %s", from, to)
+	}
+	return nil
+}
+
+// normalizeBadgeStatuses lowercases the statuses stored by older versions,
+// which compared them ignoring case. Statuses that are not in the lifecycle
+// are left as they are and logged; such badges are served as valid.
+func normalizeBadgeStatuses(db *sql.DB, logger *zap.Logger) error {
+	res, err := db.Exec("UPDATE badges SET status = LOWER(TRIM(status)) WHERE status <> LOWER(TRIM(status))")
+	if err != nil {
+		return fmt.Errorf("failed to normalize badge statuses: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logger.Info("Normalized badge statuses", zap.Int64("badges", n))
+	}
+
+	rows, err := db.Query("SELECT commit_id, status FROM badges WHERE status NOT IN ('draft', 'pending', 'valid', 'expired', 'revoked')")
+	if err != nil {
+		return fmt.Errorf("failed to read badge statuses: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commitID, status string
+		if err := rows.Scan(&commitID, &status); err != nil {
+			return fmt.Errorf("failed to scan badge status: %w", err)
+		}
+		logger.Warn("Badge status not recognized, left as is", zap.String("commit_id", commitID), zap.String("status", status))
+	}
+	return rows.Err()
+}
@@ -0,0 +1,71 @@
+package database
+
+import "testing"
+
+func TestParseStatus(t *testing.T) {
+	for in, want := range map[string]Status{"valid": StatusValid, " Revoked ": StatusRevoked, "DRAFT": StatusDraft} {
+		if got, err := ParseStatus(in); err != nil || got != want {
+			t.Errorf("ParseStatus(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "active", "valid!"} {
+		if _, err := ParseStatus(in); err == nil {
+			t.Errorf("ParseStatus(%q): expected an error", in)
+		}
+	}
+}
+
+func TestStatusTransitions(t *testing.T) {
+	for _, tc := range []struct {
+		from, to Status
+		ok       bool
+	}{
+		{StatusDraft, StatusPending, true},
+		{StatusDraft, StatusValid, true},
+		{StatusPending, StatusValid, true},
+		{StatusPending, StatusDraft, true},
+		{StatusValid, StatusExpired, true},
+		{StatusValid, StatusRevoked, true},
+		{StatusExpired, StatusValid, true},
+		{StatusValid, StatusValid, true},
+		{StatusValid, StatusDraft, false},
+		{StatusDraft, StatusRevoked, false},
+		{StatusRevoked, StatusValid, false},
+		{StatusValid, "active", false},
+		{"active", "active", false},
+	} {
+		if got := tc.from.CanTransitionTo(tc.to); got != tc.ok {
+			t.Errorf("%s -> %s: got %v, want %v", tc.from, tc.to, got, tc.ok)
+		}
+	}
+}
+
+func TestCheckStatusChange(t *testing.T) {
+	if err := CheckStatusChange(StatusDraft, StatusPending, false); err == nil {
+		t.Error("expected pending to be reachable only through review")
+	}
+	if err := CheckStatusChange(StatusPending, StatusValid, false); err == nil {
+		t.Error("expected pending badges to leave pending only through review")
+	}
+	if err := CheckStatusChange(StatusDraft, StatusValid, true); err == nil {
+		t.Error("expected drafts to be published only through review when approval is required")
+	}
+	if err := CheckStatusChange(StatusDraft, StatusValid, false); err != nil {
+		t.Errorf("expected a draft to be published without required approval: %v", err)
+	}
+	if err := CheckStatusChange(StatusRevoked, StatusValid, false); err == nil {
+		t.Error("expected revocation to be final")
+	}
+
+	if err := CheckNewStatus(StatusExpired, false); err != nil {
+		t.Errorf("expected badges to be created in any published status: %v", err)
+	}
+	for _, status := range []Status{StatusPending, "active"} {
+		if err := CheckNewStatus(status, false); err == nil {
+			t.Errorf("expected badges not to be created with status %q", status)
+		}
+	}
+	if err := CheckNewStatus(StatusValid, true); err == nil {
+		t.Error("expected badges to start as drafts when approval is required")
+	}
+}
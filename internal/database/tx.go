@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// querier runs statements on the database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction calls run in, or the database outside WithTx
+func (db *DB) conn() querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.DB
+}
+
+// txn is a transaction used by a single method. Inside WithTx it is the
+// surrounding transaction, which the method neither commits nor rolls back.
+type txn struct {
+	*sql.Tx
+	nested bool
+}
+
+// begin starts the transaction of a method, or joins the one of WithTx
+func (db *DB) begin(ctx context.Context) (*txn, error) {
+	if db.tx != nil {
+		return &txn{Tx: db.tx, nested: true}, nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx}, nil
+}
+
+// Commit commits the transaction unless it belongs to WithTx
+func (t *txn) Commit() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+// Rollback rolls the transaction back unless it belongs to WithTx, which
+// rolls back when fn returns the method's error
+func (t *txn) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// WithTx runs fn with a copy of the database whose calls all run in one
+// transaction. The transaction is committed if fn returns nil and rolled back
+// otherwise, so fn must return the errors of the calls it makes. Calls on the
+// original database from inside fn are not part of the transaction. Nested
+// WithTx calls join the outer transaction.
+func (db *DB) WithTx(fn func(tx *DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	c := *db
+	c.tx = tx
+	c.commitHooks = &[]func(){}
+	if err := fn(&c); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for _, hook := range *c.commitHooks {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit runs fn once the surrounding WithTx transaction is committed,
+// or right away outside WithTx. It defers side effects outside the database,
+// such as deleting blobs, that a rollback could not undo.
+func (db *DB) afterCommit(fn func()) {
+	if db.tx == nil {
+		fn()
+		return
+	}
+	*db.commitHooks = append(*db.commitHooks, fn)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"fmt"
+)
+
+// CreateUserAuditEntry records an action on a user account and sets its AuditID
+func (db *DB) CreateUserAuditEntry(e *UserAuditEntry) error {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	res, err := db.conn().ExecContext(ctx, `
+		INSERT INTO user_audit (action, actor_id, subject_id, detail, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.Action, e.ActorID, e.SubjectID, e.Detail, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user audit entry: %w", err)
+	}
+	if e.AuditID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to create user audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListUserAuditEntries retrieves the most recent entries of an action, newest
+// first, at most limit of them
+func (db *DB) ListUserAuditEntries(action string, limit int) ([]*UserAuditEntry, error) {
+	ctx, cancel := db.queryContext()
+	defer cancel()
+
+	rows, err := db.conn().QueryContext(ctx, `
+		SELECT audit_id, action, actor_id, subject_id, detail, created_at
+		FROM user_audit WHERE action = ? ORDER BY audit_id DESC LIMIT ?
+	`, action, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*UserAuditEntry
+	for rows.Next() {
+		var e UserAuditEntry
+		if err := rows.Scan(&e.AuditID, &e.Action, &e.ActorID, &e.SubjectID, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user audit entry: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,89 @@
+// Package debug serves pprof profiles and runtime statistics for profiling
+// the service in production, e.g. the SVG conversion hotspots. The endpoints
+// are either mounted on the main server behind RequireAdmin or served on a
+// separate listener bound to a loopback address.
+package debug
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/pkg/utils"
+)
+
+// Handler returns the debug endpoints: /debug/pprof/ and its profiles, and
+// /debug/vars with the expvar variables, including those of Publish
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+var publishOnce sync.Once
+
+// Publish adds the runtime statistics of the service to /debug/vars next to
+// expvar's cmdline and memstats: goroutines, uptime, the image cache and the
+// runs of the external image converters. Later calls do nothing.
+func Publish(c *cache.Cache) {
+	publishOnce.Do(func() {
+		start := time.Now()
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+		expvar.Publish("uptime_seconds", expvar.Func(func() any { return int64(time.Since(start).Seconds()) }))
+		expvar.Publish("cache", expvar.Func(func() any {
+			s := c.Stats()
+			return map[string]any{"hits": s.Hits, "misses": s.Misses, "hit_ratio": s.HitRatio(), "items": s.Items}
+		}))
+		expvar.Publish("converters", expvar.Func(func() any { return utils.ConverterStats() }))
+	})
+}
+
+// RequireAdmin lets only instance administrators through: a JWT of the admin
+// role, from the session cookie or an Authorization: Bearer header.
+// Organization admins and API keys are refused.
+func RequireAdmin(next http.Handler) http.Handler {
+	return auth.OptionalJWTFromCookie(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.GetClaimsFromContext(r.Context())
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && claims == nil {
+			claims, _ = auth.ValidateToken(token)
+		}
+		if claims == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claims.Role != "admin" || claims.OrgID != "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// CheckLoopback returns an error unless addr (host:port) listens on a
+// loopback address only, as the separate debug listener has no authentication
+func CheckLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("invalid debug address %q: must be a loopback address such as 127.0.0.1:6060", addr)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	auth.SetJWTSecret("debug-test-secret")
+	token := func(role, org string) string {
+		s, _, err := auth.GenerateToken("user-id", "alice", "alice@example.org", role, org)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		return s
+	}
+	Publish(cache.New())
+	h := RequireAdmin(Handler())
+
+	for _, tc := range []struct {
+		name string
+		req  func(r *http.Request)
+		want int
+	}{
+		{"anonymous", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"editor", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token("editor", "")) }, http.StatusForbidden},
+		{"org admin", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "jwt", Value: token("admin", "acme")}) }, http.StatusForbidden},
+		{"admin cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "jwt", Value: token("admin", "")}) }, http.StatusOK},
+		{"admin bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token("admin", "")) }, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		tc.req(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var vars map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+			t.Fatalf("invalid vars: %v", err)
+		}
+		for _, name := range []string{"memstats", "goroutines", "uptime_seconds", "cache", "converters"} {
+			if _, ok := vars[name]; !ok {
+				t.Errorf("expected %s in /debug/vars", name)
+			}
+		}
+	}
+}
+
+func TestCheckLoopback(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		"localhost:6060": true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.5:6060":  false,
+		"127.0.0.1":      false,
+	} {
+		if err := CheckLoopback(addr); (err == nil) != ok {
+			t.Errorf("CheckLoopback(%q) = %v", addr, err)
+		}
+	}
+}
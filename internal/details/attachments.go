@@ -0,0 +1,110 @@
+package details
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/finki/badges/internal/attachment"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/links"
+	"go.uber.org/zap"
+)
+
+// canSeeAttachments reports whether the viewer may see the attachments of a
+// badge: a session with a badges permission and access to the badge type
+func (h *Handler) canSeeAttachments(r *http.Request, badge *database.Badge) bool {
+	claims := auth.GetClaimsFromContext(r.Context())
+	if claims == nil || !auth.CanAccessOrg(r.Context(), badge.OrgID.String) {
+		return false
+	}
+	if !claims.Permissions.Allows("badges", "read") && !claims.Permissions.Allows("badges", "write") && !claims.Permissions.Allows("badges", "delete") {
+		return false
+	}
+
+	ok, err := h.db.WithContext(r.Context()).UserHasAccessToBadgeType(claims.UserID, badge.AccessType())
+	if err != nil {
+		h.logger.Error("Failed to check badge type access", zap.Error(err), zap.String("commit_id", badge.CommitID))
+		return false
+	}
+	return ok
+}
+
+// attachmentLinks lists the attachments of a badge for the details page, or
+// nil if the viewer may not see them
+func (h *Handler) attachmentLinks(r *http.Request, badge *database.Badge) []AttachmentLink {
+	if !h.canSeeAttachments(r, badge) {
+		return nil
+	}
+
+	attachments, err := h.db.WithContext(r.Context()).ListAttachments(badge.CommitID)
+	if err != nil {
+		h.logger.Error("Failed to list attachments", zap.Error(err), zap.String("commit_id", badge.CommitID))
+		return nil
+	}
+
+	list := make([]AttachmentLink, 0, len(attachments))
+	for _, a := range attachments {
+		list = append(list, AttachmentLink{
+			Filename: a.Filename,
+			URL:      links.Path("/details/") + badge.CommitID + "/attachments/" + strconv.FormatInt(a.AttachmentID, 10),
+			Size:     formatSize(a.Size),
+		})
+	}
+	return list
+}
+
+// serveAttachment downloads an attachment for a logged-in reviewer. Anyone
+// else gets 404, so the existence of attachments is not revealed.
+func (h *Handler) serveAttachment(w http.ResponseWriter, r *http.Request, commitID, id string) {
+	db := h.db.WithContext(r.Context())
+
+	attachmentID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	badge, err := db.GetBadge(commitID)
+	if err != nil {
+		h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if badge == nil || !h.canSeeAttachments(r, badge) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	a, err := db.GetAttachment(commitID, attachmentID)
+	if err != nil {
+		h.logger.Error("Failed to get attachment", zap.Error(err), zap.String("commit_id", commitID))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if a == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	content, err := db.GetAttachmentContent(a)
+	if err != nil {
+		h.logger.Error("Failed to read attachment", zap.Error(err), zap.String("commit_id", commitID))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	attachment.Write(w, a, content)
+}
+
+// formatSize formats a size in bytes for display
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
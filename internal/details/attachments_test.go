@@ -0,0 +1,106 @@
+package details
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestDetailsAttachments(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "details.db")
+	// Templates are loaded relative to the repository root
+	t.Chdir("../..")
+
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if err := db.CreateGroup(&database.Group{
+		GroupID: "reviewers", Name: "Reviewers", Members: []string{"alice"},
+		BadgeTypes: []string{"certificate"}, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := db.CreateBadge(&database.Badge{CommitID: "evid123", Type: "certificate", Status: "valid", SoftwareName: "App"}); err != nil {
+		t.Fatalf("Failed to create test badge: %v", err)
+	}
+	a := &database.Attachment{CommitID: "evid123", Filename: "licence.pdf", ContentType: "application/pdf", UploadedBy: "alice", CreatedAt: now}
+	if err := db.CreateAttachment(a, []byte("%PDF-1.7")); err != nil {
+		t.Fatalf("Failed to create attachment: %v", err)
+	}
+	downloadURL := "/details/evid123/attachments/" + strconv.FormatInt(a.AttachmentID, 10)
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	session := func(userID string) context.Context {
+		claims := &auth.Claims{UserID: userID}
+		claims.Permissions = database.Permissions{"badges": {"read": true}}
+		return auth.AddClaimsToContext(context.Background(), claims)
+	}
+	get := func(ctx context.Context, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		wantLink bool
+		download int
+	}{
+		{"anonymous", context.Background(), false, http.StatusNotFound},
+		{"without type access", session("carol"), false, http.StatusNotFound},
+		{"reviewer", session("alice"), true, http.StatusOK},
+	} {
+		page := get(tc.ctx, "/details/evid123")
+		if page.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tc.name, page.Code)
+		}
+		if got := strings.Contains(page.Body.String(), `href="`+downloadURL+`"`); got != tc.wantLink {
+			t.Errorf("%s: expected attachment link %v, got %v", tc.name, tc.wantLink, got)
+		}
+		if rec := get(tc.ctx, downloadURL); rec.Code != tc.download {
+			t.Errorf("%s: expected download status %d, got %d", tc.name, tc.download, rec.Code)
+		}
+	}
+
+	rec := get(session("alice"), downloadURL)
+	if rec.Body.String() != "%PDF-1.7" || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("unexpected download %q %v", rec.Body.String(), rec.Header())
+	}
+	if rec := get(session("alice"), "/details/evid123/attachments/999"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing attachment, got %d", rec.Code)
+	}
+
+	// The SBOM summary is public, unlike the document it was read from
+	if err := db.SetSBOM(&database.SBOM{
+		CommitID: "evid123", AttachmentID: a.AttachmentID, UploadedBy: "alice", CreatedAt: now,
+		Summary: `{"format": "SPDX", "spec_version": "2.3", "dependency_count": 42, "licenses": [{"license": "MIT", "count": 42}]}`,
+	}); err != nil {
+		t.Fatalf("Failed to set SBOM: %v", err)
+	}
+	if body := get(context.Background(), "/details/evid123").Body.String(); !strings.Contains(body, "42 components (SPDX 2.3 SBOM)") {
+		t.Error("Expected the SBOM summary on the public details page")
+	}
+	if body := get(context.Background(), "/details/evid123?format=json").Body.String(); !strings.Contains(body, `"sbom":{"format":"SPDX","spec_version":"2.3","encoding":"","dependency_count":42`) {
+		t.Errorf("Expected the SBOM summary in the details JSON, got %s", body)
+	}
+}
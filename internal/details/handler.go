@@ -2,32 +2,31 @@ package details
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/assets"
 	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/commitid"
 	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/redact"
+	"github.com/finki/badges/internal/sbom"
 	"github.com/finki/badges/internal/version"
 	"go.uber.org/zap"
 )
 
-// certificateGuideLinks maps certificate names to their corresponding detailed guide URLs.
-var certificateGuideLinks = map[string]string{
-	"Self-Assessed Dependencies": "https://wiki.geant.org/spaces/GSD/pages/1190199425/Detailed+Guide+Self-Assessed+Dependencies+Certificate",
-	"Verified Dependencies":      "https://wiki.geant.org/spaces/GSD/pages/1190199427/Quick+Guide+Verified+Dependencies+Certificate",
-	"Verified Software Licence":  "https://wiki.geant.org/spaces/GSD/pages/1190199433/Quick+Guide+Verified+Software+Licence+Certificate",
-	"Software Licence Assurance": "https://wiki.geant.org/spaces/GSD/pages/1190199436/Quick+Guide+Software+Licence+Assurance+Certificate",
-}
-
 // TemplateData represents the data passed to the details page template
 type TemplateData struct {
     CommitID            string
     Type                string
     Status              string
     Issuer              string
+    IssuerID            string
     IssueDate           string
     SoftwareName        string
     SoftwareVersion     string
@@ -48,26 +47,48 @@ type TemplateData struct {
     SpecialtyDomain     string
     SoftwareSCID        string
     SoftwareSCURL       string
+    GitRepository       string
+    GitCommitSHA        string
+    GitTag              string
+    // SBOM summarizes the dependencies of the certified release, if an SBOM was uploaded
+    SBOM                *sbom.Summary
     // ShowPrivateNote controls whether the InternalNote should be visible to the current viewer
     ShowPrivateNote     bool
+    // History lists the review workflow transitions, for the same viewers as InternalNote
+    History             []HistoryEntry
+    // Attachments lists the review evidence, for viewers with access to the badge type
+    Attachments         []AttachmentLink
     // CanEdit controls whether the Edit button should be rendered (badges:write permission)
     CanEdit             bool
+    // PageURL, ImageURL and JSONLD feed the Open Graph, Twitter card and schema.org metadata
+    PageURL             string
+    ImageURL            string
+    ShareTitle          string
+    ShareDescription    string
+    JSONLD              template.JS
     Version             string
     Commit              string
 }
 
+// AttachmentLink is an attachment as listed on the details page
+type AttachmentLink struct {
+    Filename string
+    URL      string
+    Size     string
+}
+
 // Handler handles details page requests
 type Handler struct {
 	db       *database.DB
 	logger   *zap.Logger
 	cache    *cache.Cache
-	template *template.Template
+	template *assets.Template
 }
 
 // NewHandler creates a new details handler
 func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
 	// Parse the template
-	tmpl, err := template.ParseFiles("templates/details/details.html")
+	tmpl, err := assets.ParseTemplate("details/details.html")
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +103,8 @@ func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handl
 
 // ServeHTTP handles HTTP requests for the details page
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
 	// Extract commit ID from URL
 	path := strings.TrimPrefix(r.URL.Path, "/details/")
 	commitID := strings.Split(path, "/")[0]
@@ -91,6 +114,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Attachment downloads: /details/<commit_id>/attachments/<attachment_id>
+	if parts := strings.Split(path, "/"); len(parts) == 3 && parts[1] == "attachments" {
+		h.serveAttachment(w, r, commitID, parts[2])
+		return
+	}
+
 	// Content negotiation: JSON vs HTML
 	accept := r.Header.Get("Accept")
 	wantsJSON := strings.Contains(accept, "application/json")
@@ -101,11 +130,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		wantsJSON = true
 	} else if format == "html" {
 		wantsJSON = false
+	} else {
+		httpcache.Vary(w, "Accept")
 	}
 
  if wantsJSON {
         // Get badge from database
-        badge, err := h.db.GetBadge(commitID)
+        badge, err := db.GetBadge(commitID)
         if err != nil {
             h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
             w.WriteHeader(http.StatusInternalServerError)
@@ -113,20 +144,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         }
 
         if badge == nil {
+            if commitid.RedirectAlias(w, r, h.logger, "/details/", commitID, db.ResolveBadgeID) {
+                return
+            }
             w.WriteHeader(http.StatusNotFound)
             return
         }
 
         // Protect drafts: only users with badges:write can view drafts
-        canSeeDrafts := false
-        if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
-            canSeeDrafts = claims.Permissions.Badges.Write
-        }
-        if strings.EqualFold(badge.Status, "draft") && !canSeeDrafts {
+        viewer := access(r, badge)
+        if !badge.IsPublished() && !viewer.Edit {
             // Hide existence of drafts from unauthorized users
             w.WriteHeader(http.StatusNotFound)
             return
         }
+        policy := viewer.redaction()
+        badge = policy.Badge(badge)
 
 		// Build comprehensive JSON response
 		type CertificateDetailsJSON struct {
@@ -140,6 +173,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			SoftwareURL         string `json:"software_url,omitempty"`
 			Notes               string `json:"notes,omitempty"`
 			ExpiryDate          string `json:"expiry_date,omitempty"`
+			// ExpiresAt is the instant the badge expires (RFC 3339, UTC)
+			ExpiresAt           string `json:"expires_at,omitempty"`
 			IssuerURL           string `json:"issuer_url,omitempty"`
 			LastReview          string `json:"last_review,omitempty"`
 			IsExpired           bool   `json:"is_expired"`
@@ -152,14 +187,20 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			SpecialtyDomain     string `json:"specialty_domain,omitempty"`
 			SoftwareSCID        string `json:"software_sc_id,omitempty"`
 			SoftwareSCURL       string `json:"software_sc_url,omitempty"`
+			GitRepository       string `json:"git_repository,omitempty"`
+			GitCommitSHA        string `json:"git_commit_sha,omitempty"`
+			GitTag              string `json:"git_tag,omitempty"`
+			SBOM                *sbom.Summary `json:"sbom,omitempty"`
+			// Internal is only returned to viewers with a badges permission
+			Internal            *InternalDetails `json:"internal,omitempty"`
 		}
 
 		resp := CertificateDetailsJSON{
 			CertID:          badge.CommitID,
 			Type:            badge.Type,
-			Status:          badge.Status,
+			Status:          string(badge.Status),
 			Issuer:          badge.Issuer,
-			IssueDate:       badge.IssueDate,
+			IssueDate:       database.FormatDate(badge.IssueDate),
 			SoftwareName:    badge.SoftwareName,
 			SoftwareVersion: badge.SoftwareVersion,
 			IsExpired:       badge.IsExpired(),
@@ -171,14 +212,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if badge.Notes.Valid {
 			resp.Notes = badge.Notes.String
 		}
-		if badge.ExpiryDate.Valid {
-			resp.ExpiryDate = badge.ExpiryDate.String
+		if expiresAt, ok := badge.ExpiresAt(); ok {
+			resp.ExpiryDate = database.FormatNullDate(badge.ExpiryDate)
+			resp.ExpiresAt = expiresAt.Format(time.RFC3339)
 		}
 		if badge.IssuerURL.Valid {
 			resp.IssuerURL = badge.IssuerURL.String
 		}
 		if badge.LastReview.Valid {
-			resp.LastReview = badge.LastReview.String
+			resp.LastReview = database.FormatNullDate(badge.LastReview)
 		}
 		if badge.CoveredVersion.Valid {
 			resp.CoveredVersion = badge.CoveredVersion.String
@@ -192,9 +234,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		if badge.CertificateName.Valid {
 			resp.CertificateName = badge.CertificateName.String
-			if url, ok := certificateGuideLinks[resp.CertificateName]; ok {
-				resp.CertificateGuideURL = url
-			}
+			resp.CertificateGuideURL = h.guideURL(db, badge)
 		}
 		if badge.SpecialtyDomain.Valid {
 			resp.SpecialtyDomain = badge.SpecialtyDomain.String
@@ -205,6 +245,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if badge.SoftwareSCURL.Valid {
 			resp.SoftwareSCURL = badge.SoftwareSCURL.String
 		}
+		resp.GitRepository = badge.GitRepository.String
+		resp.GitCommitSHA = badge.GitCommitSHA.String
+		resp.GitTag = badge.GitTag.String
+		if !policy.Hides(redact.SBOM) {
+			resp.SBOM = h.sbomSummary(r.Context(), badge.CommitID)
+		}
+		if viewer.Internal {
+			resp.Internal = h.internalDetails(r, badge)
+			setPrivate(w)
+		}
 
 		payload, err := json.Marshal(resp)
 		if err != nil {
@@ -221,7 +271,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
  // HTML path (existing behavior)
     // Get badge from database first (needed to know if it is a draft before using cache)
-    badge, err := h.db.GetBadge(commitID)
+    badge, err := db.GetBadge(commitID)
     if err != nil {
         h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
         w.WriteHeader(http.StatusInternalServerError)
@@ -229,36 +279,31 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
     }
 
  if badge == nil {
+        if commitid.RedirectAlias(w, r, h.logger, "/details/", commitID, db.ResolveBadgeID) {
+            return
+        }
         w.WriteHeader(http.StatusNotFound)
         return
     }
 
     // Determine viewer permissions
-    // Private notes are shown to users with badges: read OR write OR delete permissions
+    // Private notes and history are shown to users with badges: read OR write OR delete permissions
     // CanEdit flag requires badges:write. Draft visibility requires badges:write.
-    showPrivate := false
-    canEdit := false
-    canSeeDrafts := false
-    if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
-        if claims.Permissions.Badges.Read || claims.Permissions.Badges.Write || claims.Permissions.Badges.Delete {
-            showPrivate = true
-        }
-        if claims.Permissions.Badges.Write {
-            canEdit = true
-            canSeeDrafts = true
-        }
-    }
+    viewer := access(r, badge)
+    showPrivate := viewer.Internal
 
-    // Block access to drafts for unauthorized/unauthenticated viewers
-    if strings.EqualFold(badge.Status, "draft") && !canSeeDrafts {
+    // Block access to drafts and pending badges for unauthorized/unauthenticated viewers
+    if !badge.IsPublished() && !viewer.Edit {
         // Return 404 to avoid leaking the existence of the draft certificate
         w.WriteHeader(http.StatusNotFound)
         return
     }
+    policy := viewer.redaction()
+    badge = policy.Badge(badge)
 
-    // Try to get from cache only for public, non-draft views
+    // Try to get from cache only for public, published views
     cacheKey := "details:" + commitID
-    if cachedData, found := h.cache.Get(cacheKey); found && !showPrivate && !strings.EqualFold(badge.Status, "draft") {
+    if cachedData, found := h.cache.Get(cacheKey); found && !showPrivate && badge.IsPublished() {
         w.Header().Set("Content-Type", "text/html; charset=utf-8")
         w.Write(cachedData)
         return
@@ -268,15 +313,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
  data := TemplateData{
      CommitID:        badge.CommitID,
      Type:            badge.Type,
-     Status:          badge.Status,
+     Status:          string(badge.Status),
      Issuer:          badge.Issuer,
-     IssueDate:       badge.IssueDate,
+     IssueDate:       database.FormatDate(badge.IssueDate),
      SoftwareName:    badge.SoftwareName,
      SoftwareVersion: badge.SoftwareVersion,
      CurrentYear:     time.Now().Year(),
      IsExpired:       badge.IsExpired(),
      ShowPrivateNote: showPrivate,
-     CanEdit:         canEdit,
+     CanEdit:         viewer.Edit,
      Version:         version.Version,
      Commit:          version.Commit,
  }
@@ -287,7 +332,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if badge.ExpiryDate.Valid {
-		data.ExpiryDate = badge.ExpiryDate.String
+		data.ExpiryDate = database.FormatNullDate(badge.ExpiryDate)
 	}
 
 	if badge.IssuerURL.Valid {
@@ -299,7 +344,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if badge.LastReview.Valid {
-		data.LastReview = badge.LastReview.String
+		data.LastReview = database.FormatNullDate(badge.LastReview)
 	}
 
 	if badge.CoveredVersion.Valid {
@@ -316,15 +361,19 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         data.InternalNote = badge.InternalNote.String
     }
 
+	if showPrivate {
+		data.Attachments = h.attachmentLinks(r, badge)
+		data.History = h.history(r, badge)
+		setPrivate(w)
+	}
+
 	if badge.ContactDetails.Valid {
 		data.ContactDetails = badge.ContactDetails.String
 	}
 
 	if badge.CertificateName.Valid {
 		data.CertificateName = badge.CertificateName.String
-		if url, ok := certificateGuideLinks[data.CertificateName]; ok {
-			data.CertificateGuideURL = url
-		}
+		data.CertificateGuideURL = h.guideURL(db, badge)
 	}
 
 	if badge.SpecialtyDomain.Valid {
@@ -339,6 +388,24 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		data.SoftwareSCURL = badge.SoftwareSCURL.String
 	}
 
+	data.GitRepository = badge.GitRepository.String
+	data.GitCommitSHA = badge.GitCommitSHA.String
+	data.GitTag = badge.GitTag.String
+	data.IssuerID = badge.IssuerID.String
+	if !policy.Hides(redact.SBOM) {
+		data.SBOM = h.sbomSummary(r.Context(), badge.CommitID)
+	}
+
+	// Absolute URLs so shared links unfurl in chat tools and social networks
+	base := links.ForRequest(r)
+	data.PageURL = base + "/details/" + badge.CommitID
+	data.ImageURL = fmt.Sprintf("%s/certificate/%s?format=png&scale=%d", base, badge.CommitID, shareImageScale)
+	data.ShareTitle = shareTitle(badge)
+	data.ShareDescription = shareDescription(badge)
+	if data.JSONLD, err = jsonLD(badge, data.PageURL, data.ImageURL); err != nil {
+		h.logger.Error("Failed to build JSON-LD", zap.Error(err), zap.String("commit_id", commitID))
+	}
+
 	// Render the template
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.template.Execute(w, data); err != nil {
@@ -347,3 +414,23 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// guideURL returns the guide link of the badge's certificate type, or of the
+// certificate type its certificate name names when it is not linked to one
+func (h *Handler) guideURL(db *database.DB, badge *database.Badge) string {
+	var certType *database.CertificateType
+	var err error
+	if badge.CertificateTypeID.Valid {
+		certType, err = db.GetCertificateType(badge.CertificateTypeID.String)
+	} else {
+		certType, err = db.GetCertificateTypeByName(badge.CertificateName.String)
+	}
+	if err != nil {
+		h.logger.Error("Failed to get certificate type", zap.Error(err), zap.String("commit_id", badge.CommitID))
+		return ""
+	}
+	if certType == nil {
+		return ""
+	}
+	return certType.GuideURL.String
+}
@@ -0,0 +1,98 @@
+package details
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/redact"
+	"go.uber.org/zap"
+)
+
+// viewerAccess is what the viewer of a details page may see beyond the
+// public fields
+type viewerAccess struct {
+	// Internal shows the internal note, owning organization and review
+	// history to sessions with any badges permission
+	Internal bool
+	// Edit shows drafts and the edit link to sessions with badges:write
+	Edit bool
+}
+
+// access returns what the viewer of r may see of badge. Organization admins
+// get nothing extra for other organizations' badges.
+func access(r *http.Request, badge *database.Badge) viewerAccess {
+	claims := auth.GetClaimsFromContext(r.Context())
+	if claims == nil || !auth.CanAccessOrg(r.Context(), badge.OrgID.String) {
+		return viewerAccess{}
+	}
+	perms := claims.Permissions
+	return viewerAccess{
+		Internal: perms.Allows("badges", "read") || perms.Allows("badges", "write") || perms.Allows("badges", "delete"),
+		Edit:     perms.Allows("badges", "write"),
+	}
+}
+
+// redaction returns the policy hiding fields from the viewer, which hides
+// nothing from viewers seeing the internal fields
+func (v viewerAccess) redaction() *redact.Policy {
+	if v.Internal {
+		return &redact.Policy{}
+	}
+	return redact.Get()
+}
+
+// InternalDetails are the fields of the details JSON only returned to
+// viewers with a badges permission
+type InternalDetails struct {
+	InternalNote string         `json:"internal_note,omitempty"`
+	OrgID        string         `json:"org_id,omitempty"`
+	History      []HistoryEntry `json:"history"`
+}
+
+// HistoryEntry is a review workflow transition of a badge
+type HistoryEntry struct {
+	Action     string    `json:"action"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    string    `json:"actor_id"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// internalDetails returns the internal fields of badge
+func (h *Handler) internalDetails(r *http.Request, badge *database.Badge) *InternalDetails {
+	return &InternalDetails{
+		InternalNote: badge.InternalNote.String,
+		OrgID:        badge.OrgID.String,
+		History:      h.history(r, badge),
+	}
+}
+
+// history lists the review history of badge, oldest first
+func (h *Handler) history(r *http.Request, badge *database.Badge) []HistoryEntry {
+	entries, err := h.db.WithContext(r.Context()).ListAuditEntries(badge.CommitID)
+	if err != nil {
+		h.logger.Error("Failed to list audit entries", zap.Error(err), zap.String("commit_id", badge.CommitID))
+		return nil
+	}
+
+	history := make([]HistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		history = append(history, HistoryEntry{
+			Action:     e.Action,
+			FromStatus: string(e.FromStatus),
+			ToStatus:   string(e.ToStatus),
+			ActorID:    e.ActorID,
+			Comment:    e.Comment.String,
+			CreatedAt:  e.CreatedAt,
+		})
+	}
+	return history
+}
+
+// setPrivate keeps shared caches from storing a response with internal fields
+func setPrivate(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "private, no-store")
+}
@@ -0,0 +1,160 @@
+package details
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/redact"
+	"go.uber.org/zap"
+)
+
+func TestDetailsInternalFields(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "details.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateBadge(&database.Badge{
+		CommitID: "intl123", Type: "badge", Status: "draft", SoftwareName: "App",
+		InternalNote: sql.NullString{String: "licence checked by legal", Valid: true},
+	}); err != nil {
+		t.Fatalf("Failed to create test badge: %v", err)
+	}
+	for _, e := range []*database.AuditEntry{
+		{CommitID: "intl123", Action: "submit", FromStatus: "draft", ToStatus: "pending", ActorID: "issuer"},
+		{CommitID: "intl123", Action: "approve", FromStatus: "pending", ToStatus: "valid", ActorID: "reviewer",
+			Comment: sql.NullString{String: "looks good", Valid: true}},
+	} {
+		e.CreatedAt = time.Now()
+		if err := db.ReviewBadge(e); err != nil {
+			t.Fatalf("Failed to review badge: %v", err)
+		}
+	}
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	get := func(ctx context.Context, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return rec
+	}
+	reader := func(org string) context.Context {
+		claims := &auth.Claims{UserID: "reader", OrgID: org}
+		claims.Permissions = database.Permissions{"badges": {"read": true}}
+		return auth.AddClaimsToContext(context.Background(), claims)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		internal bool
+	}{
+		{"anonymous", context.Background(), false},
+		{"without badge permissions", auth.AddClaimsToContext(context.Background(), &auth.Claims{UserID: "user"}), false},
+		{"other organization", reader("other"), false},
+		{"reader", reader(""), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := get(tc.ctx, "/details/intl123?format=json")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rec.Code)
+			}
+			var resp struct {
+				Internal *InternalDetails `json:"internal"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode details: %v", err)
+			}
+			if (resp.Internal != nil) != tc.internal {
+				t.Fatalf("expected internal fields %v, got %+v", tc.internal, resp.Internal)
+			}
+			if tc.internal {
+				if resp.Internal.InternalNote != "licence checked by legal" || len(resp.Internal.History) != 2 ||
+					resp.Internal.History[1].Comment != "looks good" {
+					t.Errorf("unexpected internal fields %+v", resp.Internal)
+				}
+				if rec.Header().Get("Cache-Control") != "private, no-store" {
+					t.Errorf("expected a private response, got %q", rec.Header().Get("Cache-Control"))
+				}
+			}
+
+			page := get(tc.ctx, "/details/intl123").Body.String()
+			for _, private := range []string{"licence checked by legal", "Review History", "looks good"} {
+				if strings.Contains(page, private) != tc.internal {
+					t.Errorf("expected %q on the page: %v", private, tc.internal)
+				}
+			}
+		})
+	}
+}
+
+func TestDetailsRedaction(t *testing.T) {
+	policy, err := redact.NewPolicy([]string{"contact_details", "repositories"})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	redact.Set(policy)
+	defer redact.Set(&redact.Policy{})
+
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "details.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateBadge(&database.Badge{
+		CommitID: "rdct123", Type: "badge", Status: "valid", SoftwareName: "App",
+		ContactDetails: sql.NullString{String: "alice@example.org", Valid: true},
+		RepositoryLink: sql.NullString{String: "https://git.example.org/private/app", Valid: true},
+		PublicNote:     sql.NullString{String: "reviewed in 2025", Valid: true},
+	}); err != nil {
+		t.Fatalf("Failed to create test badge: %v", err)
+	}
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	reader := &auth.Claims{UserID: "reader"}
+	reader.Permissions = database.Permissions{"badges": {"read": true}}
+
+	for _, tc := range []struct {
+		name   string
+		ctx    context.Context
+		hidden bool
+	}{
+		{"anonymous", context.Background(), true},
+		{"reader", auth.AddClaimsToContext(context.Background(), reader), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, path := range []string{"/details/rdct123?format=json", "/details/rdct123"} {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(tc.ctx))
+				body := rec.Body.String()
+				for _, field := range []string{"alice@example.org", "git.example.org/private/app"} {
+					if strings.Contains(body, field) == tc.hidden {
+						t.Errorf("%s: expected %q hidden: %v", path, field, tc.hidden)
+					}
+				}
+				if !strings.Contains(body, "reviewed in 2025") {
+					t.Errorf("%s: expected the public note to be shown", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package details
+
+import (
+	"encoding/json"
+	"html/template"
+
+	"github.com/finki/badges/internal/database"
+)
+
+const (
+	// shareImageScale renders the 170x200 certificate large enough for link previews
+	shareImageScale  = 3
+	shareImageWidth  = 170 * shareImageScale
+	shareImageHeight = 200 * shareImageScale
+)
+
+// ImageWidth is the pixel width of the shared certificate image
+func (TemplateData) ImageWidth() int { return shareImageWidth }
+
+// ImageHeight is the pixel height of the shared certificate image
+func (TemplateData) ImageHeight() int { return shareImageHeight }
+
+// organization is a schema.org Organization
+type organization struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// softwareApplication is a schema.org SoftwareApplication
+type softwareApplication struct {
+	Type            string `json:"@type"`
+	Name            string `json:"name"`
+	SoftwareVersion string `json:"softwareVersion,omitempty"`
+	URL             string `json:"url,omitempty"`
+}
+
+// credential is the schema.org EducationalOccupationalCredential describing a
+// certificate on its details page
+type credential struct {
+	Context            string               `json:"@context"`
+	Type               string               `json:"@type"`
+	Name               string               `json:"name"`
+	Description        string               `json:"description,omitempty"`
+	Identifier         string               `json:"identifier"`
+	URL                string               `json:"url"`
+	Image              string               `json:"image"`
+	CredentialCategory string               `json:"credentialCategory"`
+	CompetencyRequired string               `json:"competencyRequired,omitempty"`
+	DateCreated        string               `json:"dateCreated,omitempty"`
+	Expires            string               `json:"expires,omitempty"`
+	RecognizedBy       organization         `json:"recognizedBy"`
+	About              *softwareApplication `json:"about"`
+}
+
+// shareTitle is the title used for link previews
+func shareTitle(badge *database.Badge) string {
+	title := badge.SoftwareName
+	if badge.SoftwareVersion != "" {
+		title += " " + badge.SoftwareVersion
+	}
+	if badge.CertificateName.Valid && badge.CertificateName.String != "" {
+		return title + " – " + badge.CertificateName.String
+	}
+	return title + " Certificate"
+}
+
+// shareDescription summarises the certificate for link previews
+func shareDescription(badge *database.Badge) string {
+	desc := "Certificate issued by " + badge.Issuer + " on " + database.FormatDate(badge.IssueDate)
+	switch badge.DisplayStatus() {
+	case "revoked":
+		desc += " (revoked)"
+	case "expired":
+		desc += " (expired)"
+	default:
+		if badge.ExpiryDate.Valid {
+			desc += ", valid until " + database.FormatNullDate(badge.ExpiryDate)
+		}
+	}
+	return desc
+}
+
+// jsonLD builds the schema.org JSON-LD for a certificate. encoding/json
+// escapes <, > and &, so the result is safe inside a script element.
+func jsonLD(badge *database.Badge, pageURL, imageURL string) (template.JS, error) {
+	c := credential{
+		Context:            "https://schema.org",
+		Type:               "EducationalOccupationalCredential",
+		Name:               shareTitle(badge),
+		Description:        shareDescription(badge),
+		Identifier:         badge.CommitID,
+		URL:                pageURL,
+		Image:              imageURL,
+		CredentialCategory: "certificate",
+		DateCreated:        database.FormatDate(badge.IssueDate),
+		RecognizedBy:       organization{Type: "Organization", Name: badge.Issuer, URL: badge.IssuerURL.String},
+		About: &softwareApplication{
+			Type:            "SoftwareApplication",
+			Name:            badge.SoftwareName,
+			SoftwareVersion: badge.SoftwareVersion,
+			URL:             badge.SoftwareURL.String,
+		},
+	}
+	if badge.CertificateName.Valid {
+		c.CompetencyRequired = badge.CertificateName.String
+	}
+	if badge.ExpiryDate.Valid {
+		c.Expires = database.FormatNullDate(badge.ExpiryDate)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(data), nil
+}
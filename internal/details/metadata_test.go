@@ -0,0 +1,106 @@
+package details
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/links"
+	"go.uber.org/zap"
+)
+
+func TestDetailsShareMetadata(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "details.db")
+	// Templates are loaded relative to the repository root
+	t.Chdir("../..")
+
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	b := &database.Badge{
+		CommitID:        "meta123",
+		Type:            "badge",
+		Status:          "valid",
+		Issuer:          "GÉANT <Test>",
+		IssuerURL:       sql.NullString{String: "https://geant.org", Valid: true},
+		IssueDate:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiryDate:      sql.NullTime{Time: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		SoftwareName:    "eduTEAMS",
+		SoftwareVersion: "v1.0.0",
+		CertificateName: sql.NullString{String: "Verified Dependencies", Valid: true},
+	}
+	if err := db.CreateBadge(b); err != nil {
+		t.Fatalf("Failed to create test badge: %v", err)
+	}
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	// X-Forwarded-Proto is honoured from trusted proxies only
+	links.SetTrustedProxy(func(*http.Request) bool { return true })
+	t.Cleanup(func() { links.SetTrustedProxy(nil) })
+	req := httptest.NewRequest(http.MethodGet, "/details/meta123", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`<meta property="og:url" content="https://example.com/details/meta123">`,
+		`<meta property="og:image" content="https://example.com/certificate/meta123?format=png&amp;scale=3">`,
+		`<meta property="og:image:width" content="510">`,
+		`<meta property="og:title" content="eduTEAMS v1.0.0 – Verified Dependencies">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+
+	_, rest, ok := strings.Cut(body, `<script type="application/ld+json">`)
+	if !ok {
+		t.Fatal("Expected a JSON-LD script")
+	}
+	script, _, _ := strings.Cut(rest, "</script>")
+	if strings.Contains(script, "<") {
+		t.Errorf("Expected markup in the JSON-LD to be escaped, got %s", script)
+	}
+	var ld map[string]any
+	if err := json.Unmarshal([]byte(script), &ld); err != nil {
+		t.Fatalf("Invalid JSON-LD: %v\n%s", err, script)
+	}
+	if ld["@type"] != "EducationalOccupationalCredential" || ld["expires"] != "2099-01-01" || ld["identifier"] != "meta123" {
+		t.Errorf("Unexpected JSON-LD %v", ld)
+	}
+	if issuer, _ := ld["recognizedBy"].(map[string]any); issuer["name"] != "GÉANT <Test>" {
+		t.Errorf("Unexpected issuer %v", ld["recognizedBy"])
+	}
+}
+
+func TestShareDescription(t *testing.T) {
+	b := &database.Badge{Issuer: "GÉANT", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Status: "revoked"}
+	if got := shareDescription(b); got != "Certificate issued by GÉANT on 2024-01-01 (revoked)" {
+		t.Errorf("Unexpected description %q", got)
+	}
+	b.Status = "valid"
+	b.ExpiryDate = sql.NullTime{Time: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+	if got := shareDescription(b); got != "Certificate issued by GÉANT on 2024-01-01, valid until 2099-01-01" {
+		t.Errorf("Unexpected description %q", got)
+	}
+}
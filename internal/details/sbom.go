@@ -0,0 +1,29 @@
+package details
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/finki/badges/internal/sbom"
+	"go.uber.org/zap"
+)
+
+// sbomSummary returns the summary of the current SBOM of a badge, or nil if
+// it has none
+func (h *Handler) sbomSummary(ctx context.Context, commitID string) *sbom.Summary {
+	s, err := h.db.WithContext(ctx).GetSBOM(commitID)
+	if err != nil {
+		h.logger.Error("Failed to get SBOM", zap.Error(err), zap.String("commit_id", commitID))
+		return nil
+	}
+	if s == nil {
+		return nil
+	}
+
+	var summary sbom.Summary
+	if err := json.Unmarshal([]byte(s.Summary), &summary); err != nil {
+		h.logger.Error("Invalid stored SBOM summary", zap.Error(err), zap.String("commit_id", commitID))
+		return nil
+	}
+	return &summary
+}
@@ -2,14 +2,16 @@ package edit
 
 import (
     "database/sql"
-    "html/template"
     "net/http"
     "strings"
     "time"
 
+    "github.com/finki/badges/internal/assets"
     "github.com/finki/badges/internal/auth"
     "github.com/finki/badges/internal/cache"
     "github.com/finki/badges/internal/database"
+    "github.com/finki/badges/internal/gitref"
+    "github.com/finki/badges/internal/validation"
     "github.com/finki/badges/internal/version"
     "go.uber.org/zap"
 )
@@ -30,11 +32,19 @@ type Handler struct {
     db       *database.DB
     logger   *zap.Logger
     cache    *cache.Cache
-    template *template.Template
+    template *assets.Template
+    // requireApproval keeps the form from publishing badges; see SetRequireApproval
+    requireApproval bool
+}
+
+// SetRequireApproval makes the form refuse to publish badges, which then have
+// to be approved through the review workflow
+func (h *Handler) SetRequireApproval(require bool) {
+    h.requireApproval = require
 }
 
 func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
-    tmpl, err := template.ParseFiles("templates/edit/edit.html")
+    tmpl, err := assets.ParseTemplate("edit/edit.html")
     if err != nil {
         return nil, err
     }
@@ -49,13 +59,15 @@ func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handl
 
 // ServeHTTP renders edit form on GET and processes updates/deletes on POST
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    db := h.db.WithContext(r.Context())
+
     // Must be under /edit/
     if !strings.HasPrefix(r.URL.Path, "/edit/") {
         http.NotFound(w, r)
         return
     }
 
-    // Only authenticated users with permissions can do anything. We use OptionalJWTFromCookie upstream
+    // Only authenticated users with permissions can do anything. The route is wrapped with Authenticator.Optional
     // and enforce permissions quietly here (render empty page if missing/unauthenticated).
     claims := auth.GetClaimsFromContext(r.Context())
     if claims == nil {
@@ -72,7 +84,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
     }
 
     // Load badge
-    badge, err := h.db.GetBadge(commitID)
+    badge, err := db.GetBadge(commitID)
+    if err == nil && badge != nil && !auth.CanAccessOrg(r.Context(), badge.OrgID.String) {
+        // Organization admins only edit their own organization's badges
+        badge = nil
+    }
     if err != nil || badge == nil {
         if err != nil {
             h.logger.Error("failed to load badge for edit", zap.String("commit_id", commitID), zap.Error(err))
@@ -83,8 +99,20 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
     }
 
     // Permission flags
-    canWrite := claims.Permissions.Badges.Write
-    canDelete := claims.Permissions.Badges.Delete
+    canWrite := claims.Permissions.Allows("badges", "write")
+    canDelete := claims.Permissions.Allows("badges", "delete")
+    // Badge types granted to groups are only editable by their members
+    if canWrite || canDelete {
+        allowed, err := db.UserHasAccessToBadgeType(claims.UserID, badge.AccessType())
+        if err != nil {
+            h.logger.Error("failed to check badge type access", zap.String("commit_id", commitID), zap.Error(err))
+            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            return
+        }
+        if !allowed {
+            canWrite, canDelete = false, false
+        }
+    }
 
     switch r.Method {
     case http.MethodGet:
@@ -109,11 +137,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
                 w.WriteHeader(http.StatusOK)
                 return
             }
-            if err := h.db.DeleteBadge(commitID); err != nil {
+            if err := db.DeleteBadge(commitID); err != nil {
                 h.logger.Error("failed to delete badge", zap.String("commit_id", commitID), zap.Error(err))
                 http.Error(w, "Failed to delete", http.StatusInternalServerError)
                 return
             }
+            h.cache.DeletePrefix("badges:list:")
             http.Redirect(w, r, "/", http.StatusSeeOther)
             return
         }
@@ -127,19 +156,37 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         // Simple helpers for nullable strings
         toNull := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
 
-        // Required/basic fields
-        badge.Status = r.FormValue("status")
+        // Required/basic fields. The status follows the badge lifecycle, and
+        // pending badges change status only through review.
+        status, err := database.ParseStatus(r.FormValue("status"))
+        if err == nil {
+            err = database.CheckStatusChange(badge.Status, status, h.requireApproval)
+        }
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        badge.Status = status
         badge.Issuer = r.FormValue("issuer")
-        badge.IssueDate = r.FormValue("issue_date")
         badge.SoftwareName = r.FormValue("software_name")
         badge.SoftwareVersion = r.FormValue("software_version")
         badge.SoftwareURL = toNull(r.FormValue("software_url"))
         badge.Notes = toNull(r.FormValue("notes"))
-        badge.ExpiryDate = toNull(r.FormValue("expiry_date"))
         badge.IssuerURL = toNull(r.FormValue("issuer_url"))
         // Custom configuration JSON (optional)
         badge.CustomConfig = toNull(r.FormValue("custom_config"))
-        badge.LastReview = toNull(r.FormValue("last_review"))
+        // Dates are parsed here and reported with the other field errors
+        dates := map[string]string{
+            "issue_date":  strings.TrimSpace(r.FormValue("issue_date")),
+            "expiry_date": strings.TrimSpace(r.FormValue("expiry_date")),
+            "last_review": strings.TrimSpace(r.FormValue("last_review")),
+        }
+        dateErrs := validation.Dates(dates)
+        if dateErrs == nil {
+            badge.IssueDate, _ = database.ParseDate(dates["issue_date"])
+            badge.ExpiryDate, _ = database.ParseNullDate(dates["expiry_date"])
+            badge.LastReview, _ = database.ParseNullDate(dates["last_review"])
+        }
         badge.CoveredVersion = toNull(r.FormValue("covered_version"))
 
         // Build repositories from parallel form arrays
@@ -159,6 +206,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
             if name == "" {
                 name = u
             }
+            if err := gitref.ValidateRepoURL(u); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
             repos = append(repos, database.Repository{Name: name, URL: u})
         }
         _ = badge.SetRepositories(repos)
@@ -171,12 +222,42 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         badge.SoftwareSCID = toNull(r.FormValue("software_sc_id"))
         badge.SoftwareSCURL = toNull(r.FormValue("software_sc_url"))
 
-        if err := h.db.UpdateBadge(badge); err != nil {
+        // Optional binding to an exact source revision
+        gitRepo := strings.TrimSpace(r.FormValue("git_repository"))
+        gitTag := strings.TrimSpace(r.FormValue("git_tag"))
+        gitSHA, err := gitref.ValidateBinding(gitRepo, strings.TrimSpace(r.FormValue("git_commit_sha")), gitTag)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        // Scheduled publication, entered in the server's local time
+        badge.PublishAt = sql.NullTime{}
+        if v := strings.TrimSpace(r.FormValue("publish_at")); v != "" {
+            t, err := time.ParseInLocation("2006-01-02T15:04", v, time.Local)
+            if err != nil {
+                http.Error(w, "Invalid publish time", http.StatusBadRequest)
+                return
+            }
+            badge.PublishAt = sql.NullTime{Time: t, Valid: true}
+        }
+        badge.GitRepository = toNull(gitRepo)
+        badge.GitCommitSHA = toNull(gitSHA)
+        badge.GitTag = toNull(gitTag)
+
+        // The same checks as the badge API, reported by field
+        if errs := dateErrs.Merge(validation.Badge(badge)); errs != nil {
+            http.Error(w, errs.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+
+        if err := db.UpdateBadge(badge); err != nil {
             h.logger.Error("failed to update badge", zap.String("commit_id", commitID), zap.Error(err))
             http.Error(w, "Failed to update", http.StatusInternalServerError)
             return
         }
 
+        h.cache.DeletePrefix("badges:list:")
+
         // Redirect to details page after update
         http.Redirect(w, r, "/details/"+commitID, http.StatusSeeOther)
     default:
@@ -0,0 +1,276 @@
+// Package eventapi serves the domain events recorded by the database, e.g.
+// badge.issued or user.created, so that external systems can follow changes,
+// audit them or rebuild their state without polling the entity endpoints.
+// /api/events is a cursor-based feed of JSON pages, /api/events/stream the
+// same events as server-sent events. Organization administrators only see
+// the events of their organization.
+package eventapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// Page sizes of the feed
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Intervals of the stream: how often it looks for new events, and how often
+// an idle stream sends a comment so that proxies keep it open
+const (
+	PollInterval      = time.Second
+	HeartbeatInterval = 15 * time.Second
+)
+
+func init() {
+	auth.RegisterResource("events", "read")
+}
+
+// Event is the JSON representation of a domain event
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	SubjectID string          `json:"subject_id"`
+	OrgID     string          `json:"org_id,omitempty"`
+	ActorID   string          `json:"actor_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Page is a page of the feed. NextCursor is the after parameter of the next
+// page: the ID of its last event, or the cursor of the request if it had none.
+type Page struct {
+	Events     []Event `json:"events"`
+	NextCursor int64   `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// Handler serves /api/events and /api/events/stream
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	poll   time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHandler creates a handler serving the events in db
+func NewHandler(db *database.DB, logger *zap.Logger) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		poll:   PollInterval,
+		done:   make(chan struct{}),
+	}
+}
+
+// Close ends the open streams, e.g. when the server shuts down; clients
+// reconnect with the ID of the last event they received
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// ServeHTTP dispatches on path; both routes need events:read
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var next http.HandlerFunc
+	switch r.URL.Path {
+	case "/api/events":
+		next = h.feed
+	case "/api/events/stream":
+		next = h.stream
+	default:
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	auth.RequirePermissionMiddleware("events", "read", next).ServeHTTP(w, r)
+}
+
+// feed returns the events after the cursor in the after parameter, oldest
+// first, at most limit of them and of the types in the comma-separated type
+// parameter
+func (h *Handler) feed(w http.ResponseWriter, r *http.Request) {
+	q, err := query(r)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.After < 0 {
+		q.After = 0
+	}
+	limit := q.Limit
+	q.Limit++ // one more tells whether there is another page
+
+	events, err := h.db.WithContext(r.Context()).ListEvents(q)
+	if err != nil {
+		h.logger.Error("eventapi: failed to list events", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list events")
+		return
+	}
+
+	page := Page{Events: []Event{}, NextCursor: q.After}
+	if len(events) > limit {
+		events, page.HasMore = events[:limit], true
+	}
+	for _, e := range events {
+		page.Events = append(page.Events, ToJSON(e))
+		page.NextCursor = e.EventID
+	}
+	httpjson.Write(w, http.StatusOK, page)
+}
+
+// stream sends the events after the cursor as server-sent events, with the
+// event ID as id and the type as event, until the client disconnects. The
+// cursor is the Last-Event-ID header of a reconnecting client or the after
+// parameter; without either, the stream starts with the next event.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	q, err := query(r)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		if q.After, err = strconv.ParseInt(last, 10, 64); err != nil || q.After < 0 {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+	ctx := r.Context()
+	db := h.db.WithContext(ctx)
+	if q.After < 0 {
+		if q.After, err = db.LastEventID(); err != nil {
+			h.logger.Error("eventapi: failed to get last event", zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to stream events")
+			return
+		}
+	}
+	q.Limit = MaxLimit
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Debug("eventapi: failed to lift the write timeout", zap.Error(err))
+	}
+	if err := rc.Flush(); err != nil {
+		h.logger.Warn("eventapi: response cannot be streamed", zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(h.poll)
+	defer ticker.Stop()
+	idle := time.Duration(0)
+	for {
+		events, err := db.ListEvents(q)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Error("eventapi: failed to list events", zap.Error(err))
+			}
+			return
+		}
+		for _, e := range events {
+			data, _ := json.Marshal(ToJSON(e))
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.EventID, e.Type, data); err != nil {
+				return
+			}
+			q.After = e.EventID
+		}
+		if len(events) > 0 {
+			idle = 0
+		} else if idle += h.poll; idle >= HeartbeatInterval {
+			idle = 0
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if len(events) == q.Limit {
+			continue // more are waiting
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// query parses the parameters shared by the feed and the stream into an
+// EventQuery of the caller's organization. After is -1 if unset.
+func query(r *http.Request) (database.EventQuery, error) {
+	params := r.URL.Query()
+	q := database.EventQuery{After: -1, Limit: DefaultLimit, OrgID: auth.GetOrgIDFromContext(r.Context())}
+
+	if after := params.Get("after"); after != "" {
+		n, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || n < 0 {
+			return q, errors.New("Invalid after: use the next_cursor or id of an event")
+		}
+		q.After = n
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return q, fmt.Errorf("Invalid limit: use 1 to %d", MaxLimit)
+		}
+		q.Limit = n
+	}
+	if types := params.Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(t)
+			if !validType(t) {
+				return q, fmt.Errorf("Invalid type %q: use %s", t, strings.Join(database.EventTypes, ", "))
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+	return q, nil
+}
+
+// validType reports whether t is one of database.EventTypes
+func validType(t string) bool {
+	for _, known := range database.EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ToJSON converts a database event to its API representation
+func ToJSON(e *database.Event) Event {
+	return Event{
+		ID:        e.EventID,
+		Type:      e.Type,
+		SubjectID: e.SubjectID,
+		OrgID:     e.OrgID,
+		ActorID:   e.ActorID,
+		Data:      json.RawMessage(e.Data),
+		CreatedAt: e.CreatedAt,
+	}
+}
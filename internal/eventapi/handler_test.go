@@ -0,0 +1,174 @@
+package eventapi
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// claimsContext returns a context authenticated as a user holding
+// events:read, scoped to orgID when it is not empty
+func claimsContext(orgID string) context.Context {
+	return auth.AddClaimsToContext(context.Background(), &auth.Claims{
+		UserID:      "user-id",
+		OrgID:       orgID,
+		Permissions: database.Permissions{"events": {"read": true}},
+	})
+}
+
+func createBadge(t *testing.T, db *database.DB, commitID, orgID string) {
+	t.Helper()
+	if err := db.CreateBadge(&database.Badge{
+		CommitID:  commitID,
+		Type:      "badge",
+		Status:    database.StatusValid,
+		IssueDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		OrgID:     sql.NullString{String: orgID, Valid: orgID != ""},
+	}); err != nil {
+		t.Fatalf("Failed to create badge: %v", err)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "events.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	h := NewHandler(db, logger)
+
+	createBadge(t, db, "feed1", "geant")
+	createBadge(t, db, "feed2", "")
+	createBadge(t, db, "feed3", "geant")
+	b, _ := db.GetBadge("feed1")
+	b.Status = database.StatusRevoked
+	if err := db.WithContext(claimsContext("")).UpdateBadge(b); err != nil {
+		t.Fatalf("Failed to revoke badge: %v", err)
+	}
+
+	get := func(ctx context.Context, path string) (*httptest.ResponseRecorder, Page) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		var page Page
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		return rec, page
+	}
+
+	// Pages follow the cursor
+	rec, page := get(claimsContext(""), "/api/events?limit=3")
+	if rec.Code != http.StatusOK || len(page.Events) != 3 || !page.HasMore || page.NextCursor != page.Events[2].ID {
+		t.Fatalf("expected a first page of three, got %d: %s", rec.Code, rec.Body)
+	}
+	if e := page.Events[0]; e.Type != database.EventBadgeIssued || e.SubjectID != "feed1" || e.OrgID != "geant" || !strings.Contains(string(e.Data), `"commit_id":"feed1"`) {
+		t.Errorf("expected the issue of feed1, got %+v", e)
+	}
+	_, page = get(claimsContext(""), "/api/events?after="+strconv.FormatInt(page.NextCursor, 10))
+	if len(page.Events) != 1 || page.HasMore || page.Events[0].Type != database.EventBadgeRevoked || page.Events[0].ActorID != "user-id" {
+		t.Fatalf("expected the revocation by the user last, got %+v", page)
+	}
+	_, last := get(claimsContext(""), "/api/events?after="+strconv.FormatInt(page.NextCursor, 10))
+	if len(last.Events) != 0 || last.NextCursor != page.NextCursor {
+		t.Errorf("expected an empty page keeping the cursor, got %+v", last)
+	}
+
+	// Types and organizations filter
+	if _, page := get(claimsContext(""), "/api/events?type=badge.revoked"); len(page.Events) != 1 {
+		t.Errorf("expected one revocation, got %+v", page)
+	}
+	if _, page := get(claimsContext("geant"), "/api/events"); len(page.Events) != 3 {
+		t.Errorf("expected the three events of geant, got %+v", page)
+	}
+
+	for _, tc := range []struct {
+		ctx    context.Context
+		path   string
+		status int
+	}{
+		{claimsContext(""), "/api/events?type=badge.unknown", http.StatusBadRequest},
+		{claimsContext(""), "/api/events?limit=5000", http.StatusBadRequest},
+		{claimsContext(""), "/api/events?after=x", http.StatusBadRequest},
+		{claimsContext(""), "/api/events/other", http.StatusNotFound},
+		{auth.AddClaimsToContext(context.Background(), &auth.Claims{UserID: "user-id", Permissions: database.Permissions{"badges": {"read": true}}}), "/api/events", http.StatusForbidden},
+	} {
+		if rec, _ := get(tc.ctx, tc.path); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.status, rec.Code)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "events.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	h := NewHandler(db, logger)
+	h.poll = 10 * time.Millisecond
+	defer h.Close()
+
+	createBadge(t, db, "old", "")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{
+			UserID:      "user-id",
+			Permissions: database.Permissions{"events": {"read": true}},
+		})))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Without a cursor the stream starts with the next event
+	createBadge(t, db, "new", "")
+	lines := bufio.NewScanner(resp.Body)
+	var got []string
+	for len(got) < 3 && lines.Scan() {
+		if line := lines.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	if len(got) != 3 || !strings.HasPrefix(got[0], "id: ") || got[1] != "event: badge.issued" || !strings.Contains(got[2], `"subject_id":"new"`) {
+		t.Fatalf("expected the issue of the new badge, got %q", got)
+	}
+
+	// Reconnecting clients resume after the last event they received
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events/stream", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp2.Body.Close()
+	lines = bufio.NewScanner(resp2.Body)
+	for lines.Scan() {
+		if line := lines.Text(); strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, `"subject_id":"old"`) {
+				t.Errorf("expected the stream to resume with the old badge, got %q", line)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package export writes a static snapshot of the public site: badge and
+// certificate images, details pages, the certificate list and the home page,
+// laid out so that a plain web server or object storage bucket can stand in
+// for the service while it is down.
+//
+// Pages and images are rendered by the same handlers that serve them, called
+// directly rather than over HTTP, so the snapshot matches what anonymous
+// visitors see. The archive holds:
+//
+//	index.html                   /
+//	certificates/index.html      /certificates
+//	certificates.json            /certificates?format=json
+//	details/<id>/index.html      /details/<id>
+//	badge/<id>                   /badge/<id> (SVG)
+//	badge/<id>.png               /badge/<id>?format=png
+//	certificate/<id>             /certificate/<id> (SVG)
+//	certificate/<id>.png         /certificate/<id>?format=png
+//	static/...                   /static/...
+//	manifest.json                every file with its URL and content type
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// DefaultFormats are the raster formats exported besides SVG
+var DefaultFormats = []string{"png"}
+
+// Manifest lists the files of a snapshot, so that an upload script can set
+// their content types, and the pages that could not be exported
+type Manifest struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []File    `json:"files"`
+	Skipped     []Skipped `json:"skipped"`
+}
+
+// File is a file of a snapshot and the URL it stands for
+type File struct {
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// Skipped is a URL that did not answer 200 while exporting
+type Skipped struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// page is a URL to export, the route handling it and the file it is saved as
+type page struct {
+	route, url, file string
+}
+
+// Exporter renders the public site into a tar archive
+type Exporter struct {
+	db     *database.DB
+	logger *zap.Logger
+	// routes are the handlers of the exported URLs by name: "home",
+	// "certificates", "details", "badge" and "certificate"
+	routes map[string]http.Handler
+	// static is copied to static/ when set
+	static fs.FS
+}
+
+// New creates an exporter rendering pages with routes. The handlers should
+// not count requests, as the export would show up in the statistics.
+func New(db *database.DB, logger *zap.Logger, routes map[string]http.Handler) *Exporter {
+	return &Exporter{db: db, logger: logger, routes: routes}
+}
+
+// SetStatic makes exports include the files of fsys under static/
+func (e *Exporter) SetStatic(fsys fs.FS) {
+	e.static = fsys
+}
+
+// Export writes the snapshot of the published badges to tw, with raster
+// images in formats besides SVG, and returns its manifest, which is written
+// last as manifest.json
+func (e *Exporter) Export(ctx context.Context, tw *tar.Writer, formats []string) (*Manifest, error) {
+	badges, err := e.db.WithContext(ctx).ListBadges()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{GeneratedAt: time.Now().UTC(), Files: []File{}, Skipped: []Skipped{}}
+	pages := []page{
+		{"home", "/", "index.html"},
+		{"certificates", "/certificates", "certificates/index.html"},
+		{"certificates", "/certificates?format=json", "certificates.json"},
+	}
+	for _, b := range badges {
+		// Drafts and badges pending review are not public
+		if !b.IsPublished() {
+			continue
+		}
+		pages = append(pages, page{"details", "/details/" + b.CommitID, "details/" + b.CommitID + "/index.html"})
+		for _, endpoint := range []string{"badge", "certificate"} {
+			base := "/" + endpoint + "/" + b.CommitID
+			pages = append(pages, page{endpoint, base + "?format=svg", endpoint + "/" + b.CommitID})
+			for _, format := range formats {
+				pages = append(pages, page{endpoint, base + "?format=" + format, endpoint + "/" + b.CommitID + "." + format})
+			}
+		}
+	}
+
+	for _, p := range pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		h, ok := e.routes[p.route]
+		if !ok {
+			continue
+		}
+		status, contentType, body, err := e.render(ctx, h, p.url)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			e.logger.Warn("export: page not exported", zap.String("url", p.url), zap.Int("status", status))
+			m.Skipped = append(m.Skipped, Skipped{URL: p.url, Status: status})
+			continue
+		}
+		url := strings.TrimSuffix(p.url, "?format=svg")
+		if err := m.add(tw, p.file, url, contentType, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.static != nil {
+		if err := e.addStatic(tw, m); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeFile(tw, "manifest.json", data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseFormats parses a comma-separated list of raster formats; "" gives
+// DefaultFormats and "none" no raster images
+func ParseFormats(s string) ([]string, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "":
+		return DefaultFormats, nil
+	case "none":
+		return nil, nil
+	}
+	var formats []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "svg" || !utils.IsFormat(f) {
+			return nil, fmt.Errorf("invalid format %q: expected png, jpg, webp or avif", f)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// render calls a handler for a GET of target as an anonymous visitor
+func (e *Exporter) render(ctx context.Context, h http.Handler, target string) (int, string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to create request for %s: %w", target, err)
+	}
+	rec := &recorder{header: http.Header{}}
+	h.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.status, rec.header.Get("Content-Type"), rec.body.Bytes(), nil
+}
+
+// addStatic adds the static files
+func (e *Exporter) addStatic(tw *tar.Writer, m *Manifest) error {
+	return fs.WalkDir(e.static, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(e.static, p)
+		if err != nil {
+			return fmt.Errorf("failed to read static file: %w", err)
+		}
+		name := path.Join("static", p)
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		return m.add(tw, name, "/"+name, contentType, data)
+	})
+}
+
+// add writes a file to the archive and lists it in the manifest
+func (m *Manifest) add(tw *tar.Writer, name, url, contentType string, data []byte) error {
+	if err := writeFile(tw, name, data); err != nil {
+		return err
+	}
+	m.Files = append(m.Files, File{Path: name, URL: url, ContentType: contentType, Size: len(data)})
+	return nil
+}
+
+// writeFile writes a regular file to the archive
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// recorder collects the response of a handler in memory
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
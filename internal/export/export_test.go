@@ -0,0 +1,151 @@
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestExport(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "export.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	for _, b := range []*database.Badge{
+		{CommitID: "public123", Type: "badge", Status: "valid"},
+		{CommitID: "draft1234", Type: "badge", Status: "draft"},
+	} {
+		b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = "GÉANT", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "App", "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	static := t.TempDir()
+	os.MkdirAll(filepath.Join(static, "css"), 0755)
+	os.WriteFile(filepath.Join(static, "css", "styles.css"), []byte("body {}"), 0644)
+
+	page := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, body+" "+r.URL.String())
+		})
+	}
+	e := New(db, logger, map[string]http.Handler{
+		"home":         page("home"),
+		"certificates": page("list"),
+		"details":      http.NotFoundHandler(),
+		"badge":        badge.NewHandler(db, logger, cache.New()),
+	})
+	e.SetStatic(os.DirFS(static))
+
+	// Raster formats need rsvg-convert, which tests cannot rely on
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/export?formats=none", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a gzipped archive, got %d %v", rec.Code, rec.Header())
+	}
+	files := readArchive(t, rec.Body.Bytes())
+
+	for _, name := range []string{"index.html", "certificates/index.html", "certificates.json", "badge/public123", "static/css/styles.css", "manifest.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the archive", name)
+		}
+	}
+	if !strings.HasPrefix(files["badge/public123"], "<svg") && !strings.HasPrefix(files["badge/public123"], "<?xml") {
+		t.Errorf("expected an SVG badge, got %.40q", files["badge/public123"])
+	}
+	if files["certificates.json"] != "list /certificates?format=json" {
+		t.Errorf("unexpected list JSON %q", files["certificates.json"])
+	}
+	for name := range files {
+		if strings.Contains(name, "draft1234") || strings.HasPrefix(name, "certificate/") || strings.HasSuffix(name, ".png") {
+			t.Errorf("unexpected file %s", name)
+		}
+	}
+
+	var m Manifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	types := map[string]string{}
+	for _, f := range m.Files {
+		types[f.URL] = f.ContentType
+	}
+	if types["/badge/public123"] != "image/svg+xml" || !strings.HasPrefix(types["/static/css/styles.css"], "text/css") {
+		t.Errorf("unexpected content types %v", types)
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0].URL != "/details/public123" || m.Skipped[0].Status != http.StatusNotFound {
+		t.Errorf("expected the details page to be skipped, got %+v", m.Skipped)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"formats", httptest.NewRequest(http.MethodGet, "/api/admin/export?formats=svg", nil), http.StatusBadRequest},
+		{"method", httptest.NewRequest(http.MethodPost, "/api/admin/export", nil), http.StatusMethodNotAllowed},
+		{"organization", httptest.NewRequest(http.MethodGet, "/api/admin/export", nil).WithContext(
+			auth.AddAPIKeyToContext(context.Background(), &auth.APIKeyInfo{ID: "key", OrgID: "acme"})), http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, tc.req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	for in, want := range map[string]string{"": "png", "none": "", "PNG, webp": "png,webp"} {
+		if got, err := ParseFormats(in); err != nil || strings.Join(got, ",") != want {
+			t.Errorf("ParseFormats(%q) = %v, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"svg", "gif", "png,"} {
+		if _, err := ParseFormats(in); err == nil {
+			t.Errorf("ParseFormats(%q): expected an error", in)
+		}
+	}
+}
+
+// readArchive returns the files of a gzipped tar archive by name
+func readArchive(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("invalid tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"go.uber.org/zap"
+)
+
+// ServeHTTP serves GET /api/admin/export: the snapshot as a gzipped tar
+// archive, with the raster formats of ?formats= (default png). Only instance
+// users may export; organization-scoped callers are refused. Errors after the
+// archive has started are logged and cut it short.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	formats, err := ParseFormats(r.URL.Query().Get("formats"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("snapshot-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Rendering every badge takes longer than the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		e.logger.Warn("export: failed to lift the write timeout", zap.Error(err))
+	}
+
+	start := time.Now()
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	m, err := e.Export(r.Context(), tw, formats)
+	if err != nil {
+		e.logger.Error("export: failed to export snapshot", zap.Error(err))
+		return
+	}
+	if err := tw.Close(); err != nil {
+		e.logger.Error("export: failed to write snapshot", zap.Error(err))
+		return
+	}
+	if err := gz.Close(); err != nil {
+		e.logger.Error("export: failed to write snapshot", zap.Error(err))
+		return
+	}
+	e.logger.Info("export: snapshot exported",
+		zap.Int("files", len(m.Files)),
+		zap.Int("skipped", len(m.Skipped)),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
@@ -0,0 +1,195 @@
+// Package fixtures loads optional seed data (demo and GÉANT reference badges)
+// into a database. Seeding only runs when explicitly requested, so fresh
+// deployments start with an empty badge table.
+package fixtures
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/validation"
+)
+
+// DefaultPath is the seed file shipped with the repository and Docker image
+const DefaultPath = "db/initial_badges.json"
+
+// badgeJSON is one entry of the seed file
+type badgeJSON struct {
+	CommitID        string          `json:"commit_id"`
+	Type            string          `json:"type"`
+	Status          string          `json:"status"`
+	Issuer          string          `json:"issuer"`
+	IssueDate       string          `json:"issue_date"`
+	SoftwareName    string          `json:"software_name"`
+	SoftwareVersion string          `json:"software_version"`
+	SoftwareURL     string          `json:"software_url"`
+	Notes           string          `json:"notes"`
+	ExpiryDate      string          `json:"expiry_date"`
+	IssuerURL       string          `json:"issuer_url"`
+	CustomConfig    string          `json:"custom_config"`
+	LastReview      string          `json:"last_review"`
+	CoveredVersion  string          `json:"covered_version"`
+	RepositoryLink  json.RawMessage `json:"repository_link"`
+	PublicNote      string          `json:"public_note"`
+	InternalNote    string          `json:"internal_note"`
+	ContactDetails  string          `json:"contact_details"`
+	CertificateName string          `json:"certificate_name"`
+	SpecialtyDomain string          `json:"specialty_domain"`
+	SoftwareSCID    string          `json:"software_sc_id"`
+	SoftwareSCURL   string          `json:"software_sc_url"`
+}
+
+// Load reads a seed file: a JSON object mapping commit IDs to badge fields.
+// Badges are returned in commit ID order with defaults filled in. A badge
+// failing validation fails the whole file.
+func Load(path string) ([]*database.Badge, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+
+	var entries map[string]badgeJSON
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse seed file %s: %w", path, err)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	badges := make([]*database.Badge, 0, len(ids))
+	for _, id := range ids {
+		bj := entries[id]
+		dateErrs := validation.Dates(map[string]string{
+			"issue_date":  bj.IssueDate,
+			"expiry_date": bj.ExpiryDate,
+			"last_review": bj.LastReview,
+		})
+		b := toBadge(id, bj)
+		if errs := dateErrs.Merge(validation.Badge(b)); errs != nil {
+			return nil, fmt.Errorf("invalid seed badge %s: %w", id, errs)
+		}
+		badges = append(badges, b)
+	}
+	return badges, nil
+}
+
+// Seed inserts every badge from the seed file that does not exist yet and
+// returns the number of badges added. Existing badges are never overwritten.
+// The badges are inserted in one transaction, so on error none are added, and
+// are linked to the certificate types they name.
+func Seed(db *database.DB, path string) (int, error) {
+	badges, err := Load(path)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	err = db.WithTx(func(tx *database.DB) error {
+		for _, b := range badges {
+			existing, err := tx.GetBadge(b.CommitID)
+			if err != nil {
+				return fmt.Errorf("failed to check for seed badge %s: %w", b.CommitID, err)
+			}
+			if existing != nil {
+				continue
+			}
+			if err := tx.CreateBadge(b); err != nil {
+				return fmt.Errorf("failed to insert seed badge %s: %w", b.CommitID, err)
+			}
+			added++
+		}
+		// Seed badges name their certificate; link them to its type
+		if _, err := tx.LinkCertificateTypes(); err != nil {
+			return fmt.Errorf("failed to link seed badges to certificate types: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// toBadge converts a seed entry, falling back to sensible defaults for required
+// fields. Dates that are not YYYY-MM-DD are reported by Load.
+func toBadge(id string, bj badgeJSON) *database.Badge {
+	if bj.CommitID == "" {
+		bj.CommitID = id
+	}
+	if bj.Type == "" {
+		bj.Type = "badge"
+	}
+	if bj.Status == "" {
+		bj.Status = "valid"
+	}
+	if bj.Issuer == "" {
+		bj.Issuer = "GEANT WP9T2 Software Licencing"
+	}
+	if bj.SoftwareName == "" {
+		bj.SoftwareName = "GÉANT Software Catalogue"
+	}
+	if bj.SoftwareVersion == "" {
+		bj.SoftwareVersion = "v1.0.0"
+	}
+
+	issued, err := database.ParseDate(bj.IssueDate)
+	if err != nil {
+		issued = database.Day(time.Now())
+	}
+	expiry, _ := database.ParseNullDate(bj.ExpiryDate)
+	lastReview, _ := database.ParseNullDate(bj.LastReview)
+
+	return &database.Badge{
+		CommitID:        bj.CommitID,
+		Type:            bj.Type,
+		Status:          database.Status(bj.Status),
+		Issuer:          bj.Issuer,
+		IssueDate:       issued,
+		SoftwareName:    bj.SoftwareName,
+		SoftwareVersion: bj.SoftwareVersion,
+		SoftwareURL:     ns(bj.SoftwareURL),
+		Notes:           ns(bj.Notes),
+		ExpiryDate:      expiry,
+		IssuerURL:       ns(bj.IssuerURL),
+		CustomConfig:    ns(bj.CustomConfig),
+		LastReview:      lastReview,
+		CoveredVersion:  ns(bj.CoveredVersion),
+		RepositoryLink:  nsRaw(bj.RepositoryLink),
+		PublicNote:      ns(bj.PublicNote),
+		InternalNote:    ns(bj.InternalNote),
+		ContactDetails:  ns(bj.ContactDetails),
+		CertificateName: ns(bj.CertificateName),
+		SpecialtyDomain: ns(bj.SpecialtyDomain),
+		SoftwareSCID:    ns(bj.SoftwareSCID),
+		SoftwareSCURL:   ns(bj.SoftwareSCURL),
+	}
+}
+
+// ns builds a nullable string; empty strings become NULL
+func ns(s string) sql.NullString {
+	if s == "" {
+		return sql.NullString{Valid: false}
+	}
+	return sql.NullString{String: s, Valid: true}
+}
+
+// nsRaw builds a nullable string from a raw JSON value. It handles both quoted
+// strings (old format) and JSON arrays (new format), which are stored as-is.
+func nsRaw(raw json.RawMessage) sql.NullString {
+	if len(raw) == 0 || string(raw) == "null" {
+		return sql.NullString{Valid: false}
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return ns(s)
+	}
+	return sql.NullString{String: string(raw), Valid: true}
+}
@@ -0,0 +1,108 @@
+package fixtures
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestNewDatabaseStartsEmpty(t *testing.T) {
+	dbPath := "test_fixtures_empty.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	badges, err := db.ListBadges()
+	if err != nil {
+		t.Fatalf("Failed to list badges: %v", err)
+	}
+	if len(badges) != 0 {
+		t.Errorf("Expected no badges in a fresh database, got %d", len(badges))
+	}
+}
+
+func TestSeed(t *testing.T) {
+	dbPath := "test_fixtures_seed.db"
+	seedPath := "test_fixtures_seed.json"
+	defer os.Remove(dbPath)
+	defer os.Remove(seedPath)
+
+	seed := `{
+		"seed_one": {"software_name": "One", "repository_link": ["https://example.org/one.git"]},
+		"seed_two": {"commit_id": "seed_two", "status": "expired", "software_version": "2.0"}
+	}`
+	if err := os.WriteFile(seedPath, []byte(seed), 0644); err != nil {
+		t.Fatalf("Failed to write seed file: %v", err)
+	}
+
+	db, err := database.New(dbPath, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	added, err := Seed(db, seedPath)
+	if err != nil {
+		t.Fatalf("Failed to seed database: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 badges added, got %d", added)
+	}
+
+	one, err := db.GetBadge("seed_one")
+	if err != nil || one == nil {
+		t.Fatalf("Expected seed_one to exist, err: %v", err)
+	}
+	if one.SoftwareName != "One" || one.Status != "valid" {
+		t.Errorf("Unexpected seed_one fields: name %q, status %q", one.SoftwareName, one.Status)
+	}
+	if one.RepositoryLink.String != `["https://example.org/one.git"]` {
+		t.Errorf("Expected repository link array to be stored as-is, got %q", one.RepositoryLink.String)
+	}
+
+	// Seeding again must not duplicate or overwrite anything
+	added, err = Seed(db, seedPath)
+	if err != nil {
+		t.Fatalf("Failed to re-seed database: %v", err)
+	}
+	if added != 0 {
+		t.Errorf("Expected re-seeding to add nothing, got %d", added)
+	}
+}
+
+func TestLoadInvalidSeed(t *testing.T) {
+	seedPath := "test_fixtures_invalid.json"
+	defer os.Remove(seedPath)
+
+	seed := `{"seed_bad": {"issue_date": "31.01.2026", "status": "unknown"}}`
+	if err := os.WriteFile(seedPath, []byte(seed), 0644); err != nil {
+		t.Fatalf("Failed to write seed file: %v", err)
+	}
+
+	_, err := Load(seedPath)
+	if err == nil {
+		t.Fatal("Expected an invalid seed badge to fail loading")
+	}
+	for _, want := range []string{"seed_bad", "issue_date", "status"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in the error, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadShippedSeedFile(t *testing.T) {
+	badges, err := Load("../../" + DefaultPath)
+	if err != nil {
+		t.Fatalf("Failed to load shipped seed file: %v", err)
+	}
+	if len(badges) == 0 {
+		t.Error("Expected the shipped seed file to contain badges")
+	}
+}
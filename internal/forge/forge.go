@@ -0,0 +1,292 @@
+// Package forge posts the state of certificates as commit statuses to the
+// GitHub or GitLab repository they are bound to, so developers see whether a
+// release is certified, expired or revoked next to the commit itself.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/gitref"
+	"go.uber.org/zap"
+)
+
+// Forge types
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// Interval is how often the syncer looks for changed certificates
+const Interval = time.Minute
+
+// RetryInterval is how long the syncer waits before posting a status again
+// after a failure
+const RetryInterval = time.Hour
+
+// StatusContext names the status on the commit
+const StatusContext = "badges/certificate"
+
+// Validate normalizes the type and host of a forge and checks them. The type
+// may be omitted for github.com and hosts with "gitlab" in their name.
+func Validate(f *database.Forge) error {
+	f.Type = strings.ToLower(strings.TrimSpace(f.Type))
+	f.Host = strings.ToLower(strings.TrimSpace(f.Host))
+	f.Token = strings.TrimSpace(f.Token)
+	f.APIURL = strings.TrimRight(strings.TrimSpace(f.APIURL), "/")
+
+	if f.Host == "" || strings.ContainsAny(f.Host, "/:@ ") {
+		return fmt.Errorf("invalid forge host %q: use a host name such as github.com", f.Host)
+	}
+	if f.Type == "" {
+		switch {
+		case f.Host == "github.com":
+			f.Type = GitHub
+		case strings.Contains(f.Host, "gitlab"):
+			f.Type = GitLab
+		}
+	}
+	if f.Type != GitHub && f.Type != GitLab {
+		return fmt.Errorf("invalid forge type %q for %s: use github or gitlab", f.Type, f.Host)
+	}
+	if f.APIURL != "" {
+		u, err := url.Parse(f.APIURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid forge API URL %q", f.APIURL)
+		}
+	}
+	return nil
+}
+
+// ParseTokens parses instance-wide forge credentials given as
+// [type:]host=token entries, e.g. "github.com=ghp_x" or "gitlab:git.example.org=glpat-y"
+func ParseTokens(entries []string) ([]database.Forge, error) {
+	var forges []database.Forge
+	for _, entry := range entries {
+		hostPart, token, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(token) == "" {
+			return nil, fmt.Errorf("invalid forge token entry for %q: use [type:]host=token", hostPart)
+		}
+		f := database.Forge{Host: hostPart, Token: token}
+		if typ, host, ok := strings.Cut(hostPart, ":"); ok {
+			f.Type, f.Host = typ, host
+		}
+		if err := Validate(&f); err != nil {
+			return nil, err
+		}
+		forges = append(forges, f)
+	}
+	return forges, nil
+}
+
+// Syncer posts commit statuses for published certificates bound to a full
+// commit SHA whenever their displayed status changes
+type Syncer struct {
+	db       *database.DB
+	logger   *zap.Logger
+	client   *http.Client
+	baseURL  string
+	instance []database.Forge
+}
+
+// NewSyncer creates a syncer. Statuses link to the certificate details under
+// baseURL. Instance forges are used for organizations without their own
+// credentials for a host.
+func NewSyncer(db *database.DB, logger *zap.Logger, baseURL string, instance []database.Forge) *Syncer {
+	return &Syncer{
+		db:       db,
+		logger:   logger,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		instance: instance,
+	}
+}
+
+// Run syncs commit statuses every Interval until ctx is done
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync posts the statuses that changed since they were last posted and
+// returns how many were posted successfully
+func (s *Syncer) Sync(ctx context.Context) int {
+	db := s.db.WithContext(ctx)
+
+	badges, err := db.ListGitBoundBadges()
+	if err != nil {
+		s.logger.Error("forge: failed to list git-bound badges", zap.Error(err))
+		return 0
+	}
+
+	orgForges := map[string][]database.Forge{}
+	posted := 0
+	for _, b := range badges {
+		if ctx.Err() != nil {
+			break
+		}
+		sha := b.GitCommitSHA.String
+		// Forges only accept statuses on full SHAs
+		if !b.IsPublished() || len(sha) < 40 {
+			continue
+		}
+		repo := gitref.NormalizeRepo(b.GitRepository.String)
+		host, project, _ := strings.Cut(repo, "/")
+		f := s.forgeFor(b.OrgID.String, host, orgForges)
+		if f == nil {
+			continue
+		}
+
+		state := string(b.DisplayStatus())
+		prev, err := db.GetForgeStatus(b.CommitID)
+		if err != nil {
+			s.logger.Error("forge: failed to get forge status", zap.String("commit_id", b.CommitID), zap.Error(err))
+			continue
+		}
+		if prev != nil && prev.Repository == repo && prev.SHA == sha && prev.State == state &&
+			(!prev.Error.Valid || time.Since(prev.UpdatedAt) < RetryInterval) {
+			continue
+		}
+
+		status := &database.ForgeStatus{CommitID: b.CommitID, Repository: repo, SHA: sha, State: state, UpdatedAt: time.Now()}
+		if err := s.post(ctx, f, project, sha, state, s.baseURL+"/details/"+url.PathEscape(b.CommitID)); err != nil {
+			s.logger.Warn("forge: failed to post commit status",
+				zap.String("commit_id", b.CommitID), zap.String("repository", repo), zap.Error(err))
+			status.Error = sql.NullString{String: err.Error(), Valid: true}
+		} else {
+			s.logger.Info("forge: posted commit status",
+				zap.String("commit_id", b.CommitID), zap.String("repository", repo), zap.String("state", state))
+			posted++
+		}
+		if err := db.SetForgeStatus(status); err != nil {
+			s.logger.Error("forge: failed to record forge status", zap.String("commit_id", b.CommitID), zap.Error(err))
+		}
+	}
+	return posted
+}
+
+// forgeFor returns the credentials for host, preferring the organization's
+// own over the instance-wide ones
+func (s *Syncer) forgeFor(orgID, host string, orgForges map[string][]database.Forge) *database.Forge {
+	if orgID != "" {
+		forges, ok := orgForges[orgID]
+		if !ok {
+			o, err := s.db.GetOrganization(orgID)
+			if err != nil {
+				s.logger.Error("forge: failed to get organization", zap.String("org_id", orgID), zap.Error(err))
+			} else if o != nil {
+				if forges, err = o.GetForges(); err != nil {
+					s.logger.Error("forge: invalid organization forges", zap.String("org_id", orgID), zap.Error(err))
+				}
+			}
+			orgForges[orgID] = forges
+		}
+		if f := findForge(forges, host); f != nil {
+			return f
+		}
+	}
+	return findForge(s.instance, host)
+}
+
+func findForge(forges []database.Forge, host string) *database.Forge {
+	for i := range forges {
+		if forges[i].Host == host && forges[i].Token != "" {
+			return &forges[i]
+		}
+	}
+	return nil
+}
+
+// post sends a commit status through the forge's API
+func (s *Syncer) post(ctx context.Context, f *database.Forge, project, sha, state, targetURL string) error {
+	description := "Certificate " + state
+	var (
+		endpoint string
+		payload  map[string]string
+	)
+	switch f.Type {
+	case GitHub:
+		api := f.APIURL
+		if api == "" && f.Host == "github.com" {
+			api = "https://api.github.com"
+		} else if api == "" {
+			api = "https://" + f.Host + "/api/v3"
+		}
+		owner, repo, ok := strings.Cut(project, "/")
+		if !ok || strings.Contains(repo, "/") {
+			return fmt.Errorf("%q is not a GitHub owner/repository path", project)
+		}
+		endpoint = api + "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo) + "/statuses/" + sha
+		payload = map[string]string{"state": githubState(state), "target_url": targetURL, "description": description, "context": StatusContext}
+	case GitLab:
+		api := f.APIURL
+		if api == "" {
+			api = "https://" + f.Host + "/api/v4"
+		}
+		endpoint = api + "/projects/" + url.PathEscape(project) + "/statuses/" + sha
+		payload = map[string]string{"state": gitlabState(state), "target_url": targetURL, "description": description, "name": StatusContext}
+	default:
+		return fmt.Errorf("unsupported forge type %q", f.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.Type == GitHub {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	} else {
+		req.Header.Set("PRIVATE-TOKEN", f.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", f.Host, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// githubState maps a display status to a GitHub commit status state
+func githubState(status string) string {
+	if status == "valid" {
+		return "success"
+	}
+	return "failure"
+}
+
+// gitlabState maps a display status to a GitLab commit status state
+func gitlabState(status string) string {
+	if status == "valid" {
+		return "success"
+	}
+	return "failed"
+}
@@ -0,0 +1,168 @@
+package forge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestParseTokens(t *testing.T) {
+	forges, err := ParseTokens([]string{"github.com=ghp_a", "gitlab:Git.Example.org=glpat-b", "gitlab.com=glpat-c"})
+	if err != nil {
+		t.Fatalf("ParseTokens: %v", err)
+	}
+	want := []database.Forge{
+		{Type: GitHub, Host: "github.com", Token: "ghp_a"},
+		{Type: GitLab, Host: "git.example.org", Token: "glpat-b"},
+		{Type: GitLab, Host: "gitlab.com", Token: "glpat-c"},
+	}
+	if len(forges) != len(want) {
+		t.Fatalf("expected %d forges, got %+v", len(want), forges)
+	}
+	for i := range want {
+		if forges[i] != want[i] {
+			t.Errorf("forge %d: expected %+v, got %+v", i, want[i], forges[i])
+		}
+	}
+
+	for _, entry := range []string{"github.com", "git.example.org=token", "bitbucket:bitbucket.org=x", "https://github.com=x"} {
+		if _, err := ParseTokens([]string{entry}); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+}
+
+// recordedStatus is a commit status received by the fake forge
+type recordedStatus struct {
+	Path, Token string
+	Body        map[string]string
+}
+
+func TestSync(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "forge.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		mu       sync.Mutex
+		received []recordedStatus
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		token := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		received = append(received, recordedStatus{Path: r.URL.EscapedPath(), Token: token, Body: body})
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	o := &database.Organization{OrgID: "acme", Name: "Acme", CreatedAt: now, UpdatedAt: now}
+	if err := o.SetForges([]database.Forge{{Type: GitLab, Host: "gitlab.example.org", Token: "org-token", APIURL: srv.URL}}); err != nil {
+		t.Fatalf("SetForges: %v", err)
+	}
+	if err := db.CreateOrganization(o); err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+
+	sha := strings.Repeat("ab", 20)
+	git := func(repo, sha string) (sql.NullString, sql.NullString) {
+		return sql.NullString{String: repo, Valid: true}, sql.NullString{String: sha, Valid: true}
+	}
+	badges := []*database.Badge{
+		{CommitID: "hub12345", Status: "valid"},
+		{CommitID: "lab12345", Status: "valid", OrgID: sql.NullString{String: "acme", Valid: true}},
+		{CommitID: "short123", Status: "valid"},
+		{CommitID: "draft123", Status: "draft"},
+		{CommitID: "other123", Status: "valid"},
+	}
+	badges[0].GitRepository, badges[0].GitCommitSHA = git("https://github.com/example/app.git", sha)
+	badges[1].GitRepository, badges[1].GitCommitSHA = git("git@gitlab.example.org:group/sub/app.git", sha)
+	badges[2].GitRepository, badges[2].GitCommitSHA = git("https://github.com/example/app", "abababa")
+	badges[3].GitRepository, badges[3].GitCommitSHA = git("https://github.com/example/app", sha)
+	badges[4].GitRepository, badges[4].GitCommitSHA = git("https://codeberg.org/example/app", sha)
+	for _, b := range badges {
+		b.Type, b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = "certificate", "GÉANT", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "App", "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	s := NewSyncer(db, logger, "https://badges.example.org/", []database.Forge{{Type: GitHub, Host: "github.com", Token: "instance-token", APIURL: srv.URL}})
+	if n := s.Sync(context.Background()); n != 2 {
+		t.Fatalf("expected 2 statuses posted, got %d: %+v", n, received)
+	}
+	byPath := map[string]recordedStatus{}
+	for _, r := range received {
+		byPath[r.Path] = r
+	}
+	hub, ok := byPath["/repos/example/app/statuses/"+sha]
+	if !ok || hub.Token != "Bearer instance-token" || hub.Body["state"] != "success" ||
+		hub.Body["context"] != StatusContext || hub.Body["target_url"] != "https://badges.example.org/details/hub12345" {
+		t.Errorf("unexpected GitHub status %+v", hub)
+	}
+	lab, ok := byPath["/projects/group%2Fsub%2Fapp/statuses/"+sha]
+	if !ok || lab.Token != "org-token" || lab.Body["state"] != "success" || lab.Body["name"] != StatusContext {
+		t.Errorf("unexpected GitLab status %+v", lab)
+	}
+
+	// Unchanged certificates are not posted again
+	if n := s.Sync(context.Background()); n != 0 {
+		t.Errorf("expected no statuses on an unchanged sync, got %d", n)
+	}
+
+	// A revocation is posted as a failure; a failed post is recorded and not
+	// retried before RetryInterval
+	badges[0].Status = "revoked"
+	if err := db.UpdateBadge(badges[0]); err != nil {
+		t.Fatalf("Failed to revoke badge: %v", err)
+	}
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if n := s.Sync(context.Background()); n != 0 {
+		t.Errorf("expected the failing post not to count, got %d", n)
+	}
+	st, _ := db.GetForgeStatus("hub12345")
+	if st == nil || st.State != "revoked" || !st.Error.Valid {
+		t.Fatalf("expected the failure to be recorded, got %+v", st)
+	}
+	mu.Lock()
+	fail = false
+	received = nil
+	mu.Unlock()
+	if n := s.Sync(context.Background()); n != 0 {
+		t.Errorf("expected no retry before RetryInterval, got %d", n)
+	}
+
+	st.UpdatedAt = time.Now().Add(-RetryInterval - time.Minute)
+	if err := db.SetForgeStatus(st); err != nil {
+		t.Fatalf("SetForgeStatus: %v", err)
+	}
+	if n := s.Sync(context.Background()); n != 1 || received[0].Body["state"] != "failure" {
+		t.Errorf("expected the revocation to be retried as a failure, got %d %+v", n, received)
+	}
+	if st, _ := db.GetForgeStatus("hub12345"); st == nil || st.Error.Valid {
+		t.Errorf("expected the error to be cleared, got %+v", st)
+	}
+}
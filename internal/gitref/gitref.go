@@ -0,0 +1,130 @@
+// Package gitref validates and compares the git references a certificate can
+// be bound to: repository URLs, commit SHAs and tags.
+package gitref
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// shaPattern accepts abbreviated (7+) and full SHA-1 or SHA-256 object names
+	shaPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+	// scpPattern matches scp-like SSH remotes such as git@github.com:owner/repo.git
+	scpPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+@([A-Za-z0-9.-]+):([^/].*)$`)
+	// tagForbidden are the characters git check-ref-format rejects in a ref name
+	tagForbidden = regexp.MustCompile("[\\x00-\\x20\\x7f~^:?*\\[\\\\]")
+)
+
+// NormalizeSHA lowercases a commit SHA and checks that it looks like one
+func NormalizeSHA(sha string) (string, error) {
+	sha = strings.ToLower(strings.TrimSpace(sha))
+	if !shaPattern.MatchString(sha) {
+		return "", fmt.Errorf("invalid commit SHA %q: expected 7 to 64 hexadecimal characters", sha)
+	}
+	return sha, nil
+}
+
+// SHAMatches reports whether two SHAs name the same commit, allowing either to
+// be abbreviated
+func SHAMatches(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if len(a) < 7 || len(b) < 7 {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// ValidateTag applies the rules of git check-ref-format to a tag name
+func ValidateTag(tag string) error {
+	tag = strings.TrimPrefix(tag, "refs/tags/")
+	switch {
+	case tag == "" || tag == "@":
+		return errors.New("tag cannot be empty")
+	case tagForbidden.MatchString(tag):
+		return fmt.Errorf("invalid tag %q: contains whitespace or one of ~^:?*[\\", tag)
+	case strings.Contains(tag, "..") || strings.Contains(tag, "@{") || strings.Contains(tag, "//"):
+		return fmt.Errorf("invalid tag %q: contains \"..\", \"@{\" or \"//\"", tag)
+	case strings.HasPrefix(tag, "/") || strings.HasSuffix(tag, "/") || strings.HasSuffix(tag, ".") || strings.HasSuffix(tag, ".lock"):
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	for _, part := range strings.Split(tag, "/") {
+		if strings.HasPrefix(part, ".") {
+			return fmt.Errorf("invalid tag %q: components cannot start with a dot", tag)
+		}
+	}
+	return nil
+}
+
+// ValidateRepoURL accepts http(s), ssh and git URLs with a host and path, and
+// scp-like SSH remotes (git@host:owner/repo)
+func ValidateRepoURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if scpPattern.MatchString(raw) {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid repository URL %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ssh", "git":
+	default:
+		return fmt.Errorf("invalid repository URL %q: use an https, ssh or git URL", raw)
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("invalid repository URL %q: missing host or path", raw)
+	}
+	return nil
+}
+
+// NormalizeRepo reduces a repository URL to host/path, so the https, ssh and
+// scp-like forms of the same repository compare equal
+func NormalizeRepo(raw string) string {
+	raw = strings.TrimSpace(raw)
+	var host, path string
+	if m := scpPattern.FindStringSubmatch(raw); m != nil {
+		host, path = m[1], m[2]
+	} else if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else {
+		// Bare host/path, as CI systems often pass
+		host, path, _ = strings.Cut(raw, "/")
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host + "/" + path)
+}
+
+// SameRepo reports whether two repository URLs point at the same repository
+func SameRepo(a, b string) bool {
+	return NormalizeRepo(a) == NormalizeRepo(b)
+}
+
+// ValidateBinding checks the git binding of a certificate and returns the
+// normalized SHA. All fields are optional, but a SHA needs the repository it
+// belongs to and a tag needs the SHA it points at.
+func ValidateBinding(repo, sha, tag string) (string, error) {
+	if repo != "" {
+		if err := ValidateRepoURL(repo); err != nil {
+			return "", err
+		}
+	}
+	if tag != "" {
+		if err := ValidateTag(tag); err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", errors.New("a git tag needs the commit SHA it points at")
+		}
+	}
+	if sha == "" {
+		return "", nil
+	}
+	if repo == "" {
+		return "", errors.New("a commit SHA needs the git repository it belongs to")
+	}
+	return NormalizeSHA(sha)
+}
@@ -0,0 +1,66 @@
+package gitref
+
+import "testing"
+
+func TestNormalizeSHA(t *testing.T) {
+	if sha, err := NormalizeSHA(" ABCDEF1234567 "); err != nil || sha != "abcdef1234567" {
+		t.Errorf("expected lowercased SHA, got %q (err %v)", sha, err)
+	}
+	for _, bad := range []string{"", "abc12", "xyz1234567", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0"} {
+		if _, err := NormalizeSHA(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSHAMatches(t *testing.T) {
+	full := "4d07ae0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e"
+	if !SHAMatches(full, "4d07ae0") || !SHAMatches("4D07AE0C", full) {
+		t.Error("expected abbreviated SHAs to match")
+	}
+	if SHAMatches(full, "4d07ae1") || SHAMatches(full, "4d07") {
+		t.Error("expected different or too short SHAs not to match")
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	for _, ok := range []string{"v1.2.3", "release/2024.1", "refs/tags/v1"} {
+		if err := ValidateTag(ok); err != nil {
+			t.Errorf("expected %q to be valid: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "v1 2", "v1..2", "v1.lock", "-/.hidden", "a:b", "end/", "v1@{0}"} {
+		if err := ValidateTag(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRepoURLs(t *testing.T) {
+	for _, ok := range []string{"https://github.com/owner/repo", "ssh://git@gitlab.com/group/sub/repo.git", "git@github.com:owner/repo.git"} {
+		if err := ValidateRepoURL(ok); err != nil {
+			t.Errorf("expected %q to be valid: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "github.com/owner/repo", "ftp://example.org/repo", "https://github.com", "javascript:alert(1)"} {
+		if err := ValidateRepoURL(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	same := []string{
+		"https://github.com/Owner/Repo",
+		"https://github.com/owner/repo.git/",
+		"git@github.com:owner/repo.git",
+		"ssh://git@github.com:22/owner/repo",
+		"github.com/owner/repo",
+	}
+	for _, u := range same {
+		if !SameRepo(same[0], u) {
+			t.Errorf("expected %q to be the same repository as %q (%s vs %s)", u, same[0], NormalizeRepo(u), NormalizeRepo(same[0]))
+		}
+	}
+	if SameRepo("https://github.com/owner/repo", "https://gitlab.com/owner/repo") {
+		t.Error("expected different hosts to be different repositories")
+	}
+}
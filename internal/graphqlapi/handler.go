@@ -0,0 +1,97 @@
+// Package graphqlapi serves /api/graphql: read-only GraphQL queries over
+// badges, their certificates, issuers, groups and review history, so a
+// dashboard can fetch exactly the fields it shows in one request. Every field
+// is checked against the same permissions as the matching JSON API.
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/verify"
+	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
+)
+
+// maxBodySize limits the size of a query request body
+const maxBodySize = 1 << 20
+
+// Request is a GraphQL request, sent as the JSON body of a POST or as the
+// query, variables and operationName query parameters of a GET
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// Handler serves /api/graphql
+type Handler struct {
+	db       *database.DB
+	logger   *zap.Logger
+	badges   *badgeapi.Handler
+	verifier *verify.Handler
+	schema   graphql.Schema
+}
+
+// NewHandler creates a new GraphQL handler. Badges are read through the badge
+// API handler and certificates through the verification handler.
+func NewHandler(db *database.DB, logger *zap.Logger, badges *badgeapi.Handler, verifier *verify.Handler) (*Handler, error) {
+	h := &Handler{
+		db:       db,
+		logger:   logger,
+		badges:   badges,
+		verifier: verifier,
+	}
+	schema, err := h.newSchema()
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+	return h, nil
+}
+
+// ServeHTTP executes a query. Like other GraphQL servers it answers 200 with
+// data and errors once the request could be read; fields the caller may not
+// read are null and reported in errors.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				httpjson.Error(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&req); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if req.Query == "" {
+		httpjson.Error(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), loaderKey{}, &loader{}),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,190 @@
+package graphqlapi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/signing"
+	"github.com/finki/badges/internal/testutil"
+	"github.com/finki/badges/internal/verify"
+	"go.uber.org/zap"
+)
+
+// response is the body of a GraphQL response
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// setupTestHandler creates a handler over a database holding two badges of an
+// issuer, one of them in review and restricted to a group
+func setupTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	logger := zap.NewNop()
+	db := testutil.OpenDB(t)
+	signer, _, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+
+	now := time.Now()
+	if err := db.CreateIssuer(&database.Issuer{IssuerID: "geant", Name: "GÉANT", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+	if err := db.CreateGroup(&database.Group{GroupID: "security", Name: "Security", BadgeTypes: []string{"audit"}, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	geant := sql.NullString{String: "geant", Valid: true}
+	for _, b := range []*database.Badge{
+		{CommitID: "valid123", Type: "certificate", Status: "valid", SoftwareName: "App", IssuerID: geant},
+		{CommitID: "audit123", Type: "audit", Status: "draft", SoftwareName: "Tool", IssuerID: geant},
+	} {
+		b.Issuer, b.IssueDate, b.SoftwareVersion = "GÉANT", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+	if err := db.ReviewBadge(&database.AuditEntry{CommitID: "audit123", Action: "submit", FromStatus: "draft", ToStatus: "pending",
+		ActorID: "user-id", CreatedAt: now}); err != nil {
+		t.Fatalf("Failed to review badge: %v", err)
+	}
+
+	h, err := NewHandler(db, logger, badgeapi.NewHandler(db, logger, cache.New()), verify.NewHandler(db, logger, signer))
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	return h
+}
+
+var adminPerms = map[string]map[string]bool{"badges": {"read": true}, "users": {"read": true}}
+
+func query(t *testing.T, h *Handler, ctx context.Context, q string, variables map[string]interface{}) response {
+	t.Helper()
+	body, _ := json.Marshal(Request{Query: q, Variables: variables})
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", bytes.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body.String(), err)
+	}
+	return resp
+}
+
+func TestBadgeQuery(t *testing.T) {
+	h := setupTestHandler(t)
+	resp := query(t, h, testutil.APIKeyContextWith("", adminPerms), `query ($id: String!) {
+		badge(commitId: $id) {
+			commitId softwareName status expiryDate
+			issuerProfile { name }
+			groups { groupId }
+			revisions { action toStatus actorId }
+			certificate { status }
+		}
+	}`, map[string]interface{}{"id": "audit123"})
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+
+	data, _ := json.Marshal(resp.Data)
+	want := `{"badge":{"certificate":null,"commitId":"audit123","expiryDate":null,` +
+		`"groups":[{"groupId":"security"}],"issuerProfile":{"name":"GÉANT"},` +
+		`"revisions":[{"action":"submit","actorId":"user-id","toStatus":"pending"}],"softwareName":"Tool","status":"pending"}}`
+	if string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+
+	resp = query(t, h, testutil.APIKeyContextWith("", adminPerms), `{ badge(commitId: "missing1") { commitId } }`, nil)
+	if len(resp.Errors) != 0 || resp.Data["badge"] != nil {
+		t.Errorf("expected null for an unknown badge, got %+v", resp)
+	}
+}
+
+func TestBadgesQuery(t *testing.T) {
+	h := setupTestHandler(t)
+	resp := query(t, h, testutil.APIKeyContextWith("", adminPerms),
+		`{ badges(status: "valid", perPage: 10) { totalCount nodes { commitId certificate { status keyId } } } }`, nil)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+	list := resp.Data["badges"].(map[string]interface{})
+	nodes := list["nodes"].([]interface{})
+	if list["totalCount"] != float64(1) || len(nodes) != 1 {
+		t.Fatalf("expected the valid badge only, got %+v", list)
+	}
+	cert := nodes[0].(map[string]interface{})["certificate"].(map[string]interface{})
+	if cert["status"] != "valid" || cert["keyId"] == "" {
+		t.Errorf("expected the verification statement, got %+v", cert)
+	}
+
+	resp = query(t, h, testutil.APIKeyContextWith("", adminPerms), `{ badges(sort: "bogus") { totalCount } }`, nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "invalid sort") {
+		t.Errorf("expected an invalid sort error, got %+v", resp.Errors)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	h := setupTestHandler(t)
+
+	// Without users:read the groups are withheld, the rest is served
+	reader := testutil.APIKeyContextWith("", map[string]map[string]bool{"badges": {"read": true}})
+	resp := query(t, h, reader, `{ issuers { issuerId } groups { groupId } }`, nil)
+	if len(resp.Errors) != 1 || resp.Data["groups"] != nil || len(resp.Data["issuers"].([]interface{})) != 1 {
+		t.Errorf("expected only the groups to be denied, got %+v", resp)
+	}
+
+	// Organization-scoped callers only see their organization's badges
+	scoped := testutil.APIKeyContextWith("acme", adminPerms)
+	resp = query(t, h, scoped, `{ badges { totalCount } groups { groupId } }`, nil)
+	if resp.Data["badges"].(map[string]interface{})["totalCount"] != float64(0) || resp.Data["groups"] != nil {
+		t.Errorf("expected no badges and no groups for another organization, got %+v", resp)
+	}
+
+	resp = query(t, h, context.Background(), `{ badges { totalCount } }`, nil)
+	if len(resp.Errors) != 1 || resp.Data["badges"] != nil {
+		t.Errorf("expected unauthenticated queries to be denied, got %+v", resp)
+	}
+}
+
+func TestGetRequest(t *testing.T) {
+	h := setupTestHandler(t)
+	q := url.Values{"query": {`query ($id: String!) { certificate(commitId: $id) { status } }`}, "variables": {`{"id": "valid123"}`}}
+	req := httptest.NewRequest(http.MethodGet, "/api/graphql?"+q.Encode(), nil).WithContext(testutil.APIKeyContextWith("", adminPerms))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"valid"`) {
+		t.Errorf("expected the certificate, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/graphql", http.StatusBadRequest},
+		{http.MethodGet, "/api/graphql?query=%7Bissuers%7BissuerId%7D%7D&variables=nope", http.StatusBadRequest},
+		{http.MethodDelete, "/api/graphql", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.target, tc.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/groupapi"
+	"github.com/finki/badges/internal/issuerapi"
+	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
+)
+
+// maxPerPage caps the page size of the badges query
+const maxPerPage = 100
+
+// badgeList is a page of badges with the total count of the filter
+type badgeList struct {
+	TotalCount int
+	Nodes      []badgeapi.Badge
+}
+
+// loaderKey is the context key of the per-request loader
+type loaderKey struct{}
+
+// loader memoizes the issuers and groups a query resolves, so that nested
+// fields of many badges do not repeat the same lookups
+type loader struct {
+	mu           sync.Mutex
+	issuers      map[string]*database.Issuer
+	groups       []*database.Group
+	groupsLoaded bool
+}
+
+func loaderFrom(ctx context.Context) *loader {
+	if l, ok := ctx.Value(loaderKey{}).(*loader); ok {
+		return l
+	}
+	return &loader{}
+}
+
+// requirePermission checks a permission of the caller
+func requirePermission(ctx context.Context, resource, action string) error {
+	if !auth.HasPermission(ctx, resource, action) {
+		return errors.New("Permission denied for " + resource + ":" + action)
+	}
+	return nil
+}
+
+// requireGroupAccess checks that the caller may read groups, which only
+// instance-wide administrators manage
+func requireGroupAccess(ctx context.Context) error {
+	if err := requirePermission(ctx, "users", "read"); err != nil {
+		return err
+	}
+	if auth.GetOrgIDFromContext(ctx) != "" {
+		return errors.New("Only instance administrators can read groups")
+	}
+	return nil
+}
+
+// newSchema builds the read-only schema served by h
+func (h *Handler) newSchema() (graphql.Schema, error) {
+	issuerType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Issuer",
+		Description: "An issuer profile, as served by /api/issuers",
+		Fields: graphql.Fields{
+			"issuerId":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"url":       &graphql.Field{Type: graphql.String},
+			"logo":      &graphql.Field{Type: graphql.String},
+			"contact":   &graphql.Field{Type: graphql.String},
+			"publicKey": &graphql.Field{Type: graphql.String},
+			"keyId":     &graphql.Field{Type: graphql.String},
+			"createdAt": &graphql.Field{Type: graphql.DateTime},
+			"updatedAt": &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	groupType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Group",
+		Description: "A group that authority over badge types is delegated to, as served by /api/groups",
+		Fields: graphql.Fields{
+			"groupId":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"name":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"members":    &graphql.Field{Type: graphql.NewList(graphql.String), Description: "User IDs"},
+			"badgeTypes": &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"createdAt":  &graphql.Field{Type: graphql.DateTime},
+			"updatedAt":  &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	revisionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Revision",
+		Description: "A review workflow transition of a badge: submit, approve or reject",
+		Fields: graphql.Fields{
+			"action":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"fromStatus": &graphql.Field{Type: graphql.String},
+			"toStatus":   &graphql.Field{Type: graphql.String},
+			"actorId":    &graphql.Field{Type: graphql.String},
+			"comment":    &graphql.Field{Type: graphql.String},
+			"createdAt":  &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	certificateType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Certificate",
+		Description: "The verification statement of a published badge, as served by /api/verify",
+		Fields: graphql.Fields{
+			"commitId":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"status":          &graphql.Field{Type: graphql.String, Description: "valid, expired or revoked"},
+			"softwareName":    &graphql.Field{Type: graphql.String},
+			"softwareVersion": &graphql.Field{Type: graphql.String},
+			"coveredVersion":  &graphql.Field{Type: graphql.String},
+			"certificateName": &graphql.Field{Type: graphql.String},
+			"issuer":          &graphql.Field{Type: graphql.String},
+			"issuerUrl":       &graphql.Field{Type: graphql.String},
+			"issueDate":       &graphql.Field{Type: graphql.String},
+			"expiryDate":      &graphql.Field{Type: graphql.String},
+			"gitRepository":   &graphql.Field{Type: graphql.String},
+			"gitCommitSha":    &graphql.Field{Type: graphql.String},
+			"gitTag":          &graphql.Field{Type: graphql.String},
+			"verifiedAt":      &graphql.Field{Type: graphql.DateTime},
+			"keyId":           &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	badgeFields := graphql.Fields{
+		"commitId": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"publishAt": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Scheduled publication time (RFC 3339)",
+		},
+		"expiresAt": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Expiry time (RFC 3339, UTC): the start of the expiry date in the issuer's timezone",
+		},
+		"issuerProfile": &graphql.Field{
+			Type:        issuerType,
+			Description: "The linked issuer profile",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				b := p.Source.(badgeapi.Badge)
+				if b.IssuerID == nil {
+					return nil, nil
+				}
+				return h.issuer(p.Context, *b.IssuerID)
+			},
+		},
+		"groups": &graphql.Field{
+			Type:        graphql.NewList(groupType),
+			Description: "The groups the badge type is delegated to; readable by instance administrators",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := requireGroupAccess(p.Context); err != nil {
+					return nil, err
+				}
+				groups, err := h.groups(p.Context)
+				if err != nil {
+					return nil, err
+				}
+				b := p.Source.(badgeapi.Badge)
+				resp := []groupapi.Group{}
+				for _, g := range groups {
+					for _, t := range g.BadgeTypes {
+						if b.Type != nil && t == *b.Type {
+							resp = append(resp, groupapi.ToJSON(g))
+							break
+						}
+					}
+				}
+				return resp, nil
+			},
+		},
+		"revisions": &graphql.Field{
+			Type:        graphql.NewList(revisionType),
+			Description: "The review history of the badge, oldest first",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				b := p.Source.(badgeapi.Badge)
+				entries, err := h.db.WithContext(p.Context).ListAuditEntries(b.CommitID)
+				if err != nil {
+					h.logger.Error("graphqlapi: failed to list audit entries", zap.String("commit_id", b.CommitID), zap.Error(err))
+					return nil, errors.New("Failed to get review history")
+				}
+				resp := make([]badgeapi.AuditEntry, 0, len(entries))
+				for _, e := range entries {
+					resp = append(resp, badgeapi.AuditEntry{
+						Action:     e.Action,
+						FromStatus: e.FromStatus,
+						ToStatus:   e.ToStatus,
+						ActorID:    e.ActorID,
+						Comment:    e.Comment.String,
+						CreatedAt:  e.CreatedAt,
+					})
+				}
+				return resp, nil
+			},
+		},
+		"certificate": &graphql.Field{
+			Type:        certificateType,
+			Description: "The verification statement, null while the badge is unpublished",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return h.certificate(p.Context, p.Source.(badgeapi.Badge).CommitID)
+			},
+		},
+	}
+	for _, name := range []string{
+		"type", "status", "issuer", "issuerUrl", "issuerId", "issueDate", "expiryDate",
+		"softwareName", "softwareVersion", "softwareUrl", "softwareScId", "softwareScUrl",
+		"coveredVersion", "certificateName", "specialtyDomain", "notes", "publicNote",
+		"internalNote", "contactDetails", "lastReview", "repositoryLink", "customConfig",
+		"gitRepository", "gitCommitSha", "gitTag", "orgId", "certificateTypeId",
+	} {
+		badgeFields[name] = &graphql.Field{Type: graphql.String}
+	}
+	badgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Badge",
+		Description: "A badge, drafts included, as served by /api/badges",
+		Fields:      badgeFields,
+	})
+
+	badgeListType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BadgeList",
+		Fields: graphql.Fields{
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Matching badges before pagination"},
+			"nodes":      &graphql.Field{Type: graphql.NewList(badgeType)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"badge": &graphql.Field{
+				Type: badgeType,
+				Args: graphql.FieldConfigArgument{
+					"commitId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(p.Context, "badges", "read"); err != nil {
+						return nil, err
+					}
+					b, err := h.badges.Get(p.Context, p.Args["commitId"].(string))
+					var e *badgeapi.Error
+					if errors.As(err, &e) && e.Status == http.StatusNotFound {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return badgeapi.ToJSON(b), nil
+				},
+			},
+			"badges": &graphql.Field{
+				Type:        badgeListType,
+				Description: "Badges filtered and sorted like GET /api/badges",
+				Args: graphql.FieldConfigArgument{
+					"status":    &graphql.ArgumentConfig{Type: graphql.String},
+					"issuer":    &graphql.ArgumentConfig{Type: graphql.String},
+					"domain":    &graphql.ArgumentConfig{Type: graphql.String},
+					"org":       &graphql.ArgumentConfig{Type: graphql.String},
+					"catalogue": &graphql.ArgumentConfig{Type: graphql.String, Description: "missing: only badges whose catalogue project disappeared"},
+					"sort":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Sort key, prefixed with - for descending order"},
+					"page":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+					"perPage":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+				},
+				Resolve: h.resolveBadges,
+			},
+			"certificate": &graphql.Field{
+				Type:        certificateType,
+				Description: "The verification statement of a published badge",
+				Args: graphql.FieldConfigArgument{
+					"commitId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.certificate(p.Context, p.Args["commitId"].(string))
+				},
+			},
+			"issuer": &graphql.Field{
+				Type: issuerType,
+				Args: graphql.FieldConfigArgument{
+					"issuerId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(p.Context, "badges", "read"); err != nil {
+						return nil, err
+					}
+					return h.issuer(p.Context, p.Args["issuerId"].(string))
+				},
+			},
+			"issuers": &graphql.Field{
+				Type: graphql.NewList(issuerType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(p.Context, "badges", "read"); err != nil {
+						return nil, err
+					}
+					issuers, err := h.db.WithContext(p.Context).ListIssuers()
+					if err != nil {
+						h.logger.Error("graphqlapi: failed to list issuers", zap.Error(err))
+						return nil, errors.New("Failed to list issuers")
+					}
+					resp := make([]issuerapi.Issuer, 0, len(issuers))
+					for _, i := range issuers {
+						resp = append(resp, issuerapi.ToJSON(i))
+					}
+					return resp, nil
+				},
+			},
+			"group": &graphql.Field{
+				Type: groupType,
+				Args: graphql.FieldConfigArgument{
+					"groupId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requireGroupAccess(p.Context); err != nil {
+						return nil, err
+					}
+					groups, err := h.groups(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					for _, g := range groups {
+						if g.GroupID == p.Args["groupId"].(string) {
+							return groupapi.ToJSON(g), nil
+						}
+					}
+					return nil, nil
+				},
+			},
+			"groups": &graphql.Field{
+				Type: graphql.NewList(groupType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requireGroupAccess(p.Context); err != nil {
+						return nil, err
+					}
+					groups, err := h.groups(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					resp := make([]groupapi.Group, 0, len(groups))
+					for _, g := range groups {
+						resp = append(resp, groupapi.ToJSON(g))
+					}
+					return resp, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// resolveBadges lists badges through the JSON API's service layer, so that
+// organization scoping applies alike
+func (h *Handler) resolveBadges(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePermission(p.Context, "badges", "read"); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for _, name := range []string{"status", "issuer", "domain", "org", "catalogue", "sort"} {
+		if v, ok := p.Args[name].(string); ok {
+			values.Set(name, v)
+		}
+	}
+	page, _ := p.Args["page"].(int)
+	perPage, _ := p.Args["perPage"].(int)
+	if perPage < 1 || perPage > maxPerPage {
+		return nil, errors.New("perPage must be between 1 and " + strconv.Itoa(maxPerPage))
+	}
+	values.Set("page", strconv.Itoa(page))
+	values.Set("per_page", strconv.Itoa(perPage))
+
+	query, err := database.ParseBadgeQuery(values)
+	if err != nil {
+		return nil, err
+	}
+	badges, total, err := h.badges.List(p.Context, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := badgeList{TotalCount: total, Nodes: make([]badgeapi.Badge, 0, len(badges))}
+	for _, b := range badges {
+		resp.Nodes = append(resp.Nodes, badgeapi.ToJSON(b))
+	}
+	return resp, nil
+}
+
+// issuer returns an issuer profile, or nil if there is none
+func (h *Handler) issuer(ctx context.Context, issuerID string) (interface{}, error) {
+	l := loaderFrom(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, ok := l.issuers[issuerID]
+	if !ok {
+		var err error
+		if i, err = h.db.WithContext(ctx).GetIssuer(issuerID); err != nil {
+			h.logger.Error("graphqlapi: failed to get issuer", zap.String("issuer_id", issuerID), zap.Error(err))
+			return nil, errors.New("Failed to get issuer")
+		}
+		if l.issuers == nil {
+			l.issuers = map[string]*database.Issuer{}
+		}
+		l.issuers[issuerID] = i
+	}
+	if i == nil {
+		return nil, nil
+	}
+	return issuerapi.ToJSON(i), nil
+}
+
+// groups returns all groups, loaded once per request
+func (h *Handler) groups(ctx context.Context) ([]*database.Group, error) {
+	l := loaderFrom(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.groupsLoaded {
+		groups, err := h.db.WithContext(ctx).ListGroups()
+		if err != nil {
+			h.logger.Error("graphqlapi: failed to list groups", zap.Error(err))
+			return nil, errors.New("Failed to list groups")
+		}
+		l.groups, l.groupsLoaded = groups, true
+	}
+	return l.groups, nil
+}
+
+// certificate returns the verification statement of a published badge, or nil
+func (h *Handler) certificate(ctx context.Context, commitID string) (interface{}, error) {
+	cert, err := h.verifier.Certificate(ctx, commitID)
+	if err != nil {
+		return nil, errors.New("Failed to get badge")
+	}
+	if cert == nil {
+		return nil, nil
+	}
+	return cert, nil
+}
@@ -0,0 +1,266 @@
+// Package groupapi manages the groups that badge-type authority is delegated to.
+// A badge type granted to one or more groups can only be issued, edited and
+// deleted by their members; types not granted to any group stay open to every
+// user with badge write permission.
+package groupapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// groupIDPattern limits group IDs to lowercase URL-safe slugs
+var groupIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+
+// Group is the JSON representation of a group
+type Group struct {
+	GroupID string `json:"group_id"`
+	Name    string `json:"name"`
+	// Members are user IDs
+	Members    []string  `json:"members"`
+	BadgeTypes []string  `json:"badge_types"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// UpdateRequest changes the fields present in the request body; members and
+// badge_types replace the current lists
+type UpdateRequest struct {
+	Name       *string   `json:"name,omitempty"`
+	Members    *[]string `json:"members,omitempty"`
+	BadgeTypes *[]string `json:"badge_types,omitempty"`
+}
+
+// Handler serves /api/groups and /api/groups/{id}
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+// NewHandler creates a new group API handler
+func NewHandler(db *database.DB, logger *zap.Logger) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ServeHTTP dispatches on method and path. Groups grant authority over badge
+// types across the instance, so only instance-wide administrators manage them.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/groups"), "/")
+	if strings.Contains(id, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("users", "write", http.HandlerFunc(h.create))
+	case r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", h.withGroup(id, h.get))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		next = auth.RequirePermissionMiddleware("users", "write", h.withGroup(id, h.update))
+	case r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("users", "delete", h.withGroup(id, h.delete))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	auth.RequireInstanceWideMiddleware("Only instance administrators can manage groups", next).ServeHTTP(w, r)
+}
+
+// withGroup loads the group before calling fn
+func (h *Handler) withGroup(id string, fn func(http.ResponseWriter, *http.Request, *database.Group)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !groupIDPattern.MatchString(id) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid group ID")
+			return
+		}
+		g, err := h.db.WithContext(r.Context()).GetGroup(id)
+		if err != nil {
+			h.logger.Error("groupapi: failed to get group", zap.String("group_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get group")
+			return
+		}
+		if g == nil {
+			httpjson.Error(w, http.StatusNotFound, "Group not found")
+			return
+		}
+		fn(w, r, g)
+	})
+}
+
+// list returns all groups
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.db.WithContext(r.Context()).ListGroups()
+	if err != nil {
+		h.logger.Error("groupapi: failed to list groups", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list groups")
+		return
+	}
+
+	resp := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		resp = append(resp, ToJSON(g))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single group
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, g *database.Group) {
+	httpjson.Write(w, http.StatusOK, ToJSON(g))
+}
+
+// create validates and stores a new group
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req Group
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !groupIDPattern.MatchString(req.GroupID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid group ID: use 2-63 lowercase letters, digits, - or _")
+		return
+	}
+
+	existing, err := db.GetGroup(req.GroupID)
+	if err != nil {
+		h.logger.Error("groupapi: failed to get group", zap.String("group_id", req.GroupID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+	if existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Group already exists")
+		return
+	}
+
+	now := time.Now()
+	g := &database.Group{
+		GroupID:    req.GroupID,
+		Name:       strings.TrimSpace(req.Name),
+		BadgeTypes: cleanList(req.BadgeTypes),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if g.Name == "" {
+		httpjson.Error(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if err := h.setMembers(r.Context(), g, req.Members); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := db.CreateGroup(g); err != nil {
+		h.logger.Error("groupapi: failed to create group", zap.String("group_id", g.GroupID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, ToJSON(g))
+}
+
+// update applies the fields present in the request body
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, g *database.Group) {
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		g.Name = strings.TrimSpace(*req.Name)
+		if g.Name == "" {
+			httpjson.Error(w, http.StatusBadRequest, "name is required")
+			return
+		}
+	}
+	if req.Members != nil {
+		if err := h.setMembers(r.Context(), g, *req.Members); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.BadgeTypes != nil {
+		g.BadgeTypes = cleanList(*req.BadgeTypes)
+	}
+
+	g.UpdatedAt = time.Now()
+	if err := h.db.WithContext(r.Context()).UpdateGroup(g); err != nil {
+		h.logger.Error("groupapi: failed to update group", zap.String("group_id", g.GroupID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update group")
+		return
+	}
+
+	httpjson.Write(w, http.StatusOK, ToJSON(g))
+}
+
+// delete removes a group
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, g *database.Group) {
+	if err := h.db.WithContext(r.Context()).DeleteGroup(g.GroupID); err != nil {
+		h.logger.Error("groupapi: failed to delete group", zap.String("group_id", g.GroupID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete group")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setMembers checks that every member is an existing user and stores the list on g
+func (h *Handler) setMembers(ctx context.Context, g *database.Group, members []string) error {
+	members = cleanList(members)
+	for _, userID := range members {
+		user, err := h.db.WithContext(ctx).GetUser(userID)
+		if err != nil {
+			h.logger.Error("groupapi: failed to get user", zap.String("user_id", userID), zap.Error(err))
+			return fmt.Errorf("failed to look up member %s", userID)
+		}
+		if user == nil {
+			return fmt.Errorf("unknown member: %s", userID)
+		}
+	}
+	g.Members = members
+	return nil
+}
+
+// cleanList trims the entries of a list and drops empty ones and duplicates
+func cleanList(in []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ToJSON converts a database group to its API representation
+func ToJSON(g *database.Group) Group {
+	return Group{
+		GroupID:    g.GroupID,
+		Name:       g.Name,
+		Members:    g.Members,
+		BadgeTypes: g.BadgeTypes,
+		CreatedAt:  g.CreatedAt,
+		UpdatedAt:  g.UpdatedAt,
+	}
+}
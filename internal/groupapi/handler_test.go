@@ -0,0 +1,73 @@
+package groupapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestGroupLifecycle(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, logger)
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("failed to get default admin: %v", err)
+	}
+	ctx := testutil.APIKeyContext("", "users", "read", "write", "delete")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/groups", Group{
+		GroupID:    "trusted",
+		Name:       "Trusted issuers",
+		Members:    []string{admin.UserID, admin.UserID},
+		BadgeTypes: []string{" certificate ", ""},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := db.GetGroup("trusted")
+	if !reflect.DeepEqual(stored.Members, []string{admin.UserID}) || !reflect.DeepEqual(stored.BadgeTypes, []string{"certificate"}) {
+		t.Errorf("unexpected stored group %+v", stored)
+	}
+
+	for _, tc := range []struct {
+		body   Group
+		status int
+	}{
+		{Group{GroupID: "trusted", Name: "Duplicate"}, http.StatusConflict},
+		{Group{GroupID: "Bad ID", Name: "Bad"}, http.StatusBadRequest},
+		{Group{GroupID: "nameless"}, http.StatusBadRequest},
+		{Group{GroupID: "ghosts", Name: "Ghosts", Members: []string{"no-such-user"}}, http.StatusBadRequest},
+	} {
+		if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/groups", tc.body); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.body.GroupID, tc.status, rec.Code)
+		}
+	}
+
+	// Organization admins cannot manage groups, which apply instance-wide
+	orgAdmin := testutil.APIKeyContext("geant", "users", "read", "write", "delete")
+	if rec := testutil.Serve(h, orgAdmin, http.MethodGet, "/api/groups", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an organization admin, got %d", rec.Code)
+	}
+
+	empty := []string{}
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/groups/trusted", UpdateRequest{Members: &empty})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ = db.GetGroup("trusted")
+	if len(stored.Members) != 0 || !reflect.DeepEqual(stored.BadgeTypes, []string{"certificate"}) {
+		t.Errorf("expected only the members to be replaced, got %+v", stored)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodDelete, "/api/groups/trusted", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/groups/trusted", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,989 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: badges/v1/badges.proto
+
+// The gRPC API for service-to-service badge management, e.g. by the Software
+// Catalogue backend. It mirrors /api/badges and /api/verify over the same
+// service layer. Generate the Go code with `make proto`.
+
+package badgesv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Badge is a badge as managed through the JSON API. Empty optional fields are
+// unset.
+type Badge struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	CommitId        string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	Type            string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Status          string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Issuer          string                 `protobuf:"bytes,4,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	IssuerUrl       string                 `protobuf:"bytes,5,opt,name=issuer_url,json=issuerUrl,proto3" json:"issuer_url,omitempty"`
+	IssuerId        string                 `protobuf:"bytes,6,opt,name=issuer_id,json=issuerId,proto3" json:"issuer_id,omitempty"`
+	IssueDate       string                 `protobuf:"bytes,7,opt,name=issue_date,json=issueDate,proto3" json:"issue_date,omitempty"`
+	ExpiryDate      string                 `protobuf:"bytes,8,opt,name=expiry_date,json=expiryDate,proto3" json:"expiry_date,omitempty"`
+	SoftwareName    string                 `protobuf:"bytes,9,opt,name=software_name,json=softwareName,proto3" json:"software_name,omitempty"`
+	SoftwareVersion string                 `protobuf:"bytes,10,opt,name=software_version,json=softwareVersion,proto3" json:"software_version,omitempty"`
+	SoftwareUrl     string                 `protobuf:"bytes,11,opt,name=software_url,json=softwareUrl,proto3" json:"software_url,omitempty"`
+	SoftwareScId    string                 `protobuf:"bytes,12,opt,name=software_sc_id,json=softwareScId,proto3" json:"software_sc_id,omitempty"`
+	SoftwareScUrl   string                 `protobuf:"bytes,13,opt,name=software_sc_url,json=softwareScUrl,proto3" json:"software_sc_url,omitempty"`
+	CoveredVersion  string                 `protobuf:"bytes,14,opt,name=covered_version,json=coveredVersion,proto3" json:"covered_version,omitempty"`
+	CertificateName string                 `protobuf:"bytes,15,opt,name=certificate_name,json=certificateName,proto3" json:"certificate_name,omitempty"`
+	SpecialtyDomain string                 `protobuf:"bytes,16,opt,name=specialty_domain,json=specialtyDomain,proto3" json:"specialty_domain,omitempty"`
+	Notes           string                 `protobuf:"bytes,17,opt,name=notes,proto3" json:"notes,omitempty"`
+	PublicNote      string                 `protobuf:"bytes,18,opt,name=public_note,json=publicNote,proto3" json:"public_note,omitempty"`
+	InternalNote    string                 `protobuf:"bytes,19,opt,name=internal_note,json=internalNote,proto3" json:"internal_note,omitempty"`
+	ContactDetails  string                 `protobuf:"bytes,20,opt,name=contact_details,json=contactDetails,proto3" json:"contact_details,omitempty"`
+	LastReview      string                 `protobuf:"bytes,21,opt,name=last_review,json=lastReview,proto3" json:"last_review,omitempty"`
+	RepositoryLink  string                 `protobuf:"bytes,22,opt,name=repository_link,json=repositoryLink,proto3" json:"repository_link,omitempty"`
+	CustomConfig    string                 `protobuf:"bytes,23,opt,name=custom_config,json=customConfig,proto3" json:"custom_config,omitempty"`
+	GitRepository   string                 `protobuf:"bytes,24,opt,name=git_repository,json=gitRepository,proto3" json:"git_repository,omitempty"`
+	GitCommitSha    string                 `protobuf:"bytes,25,opt,name=git_commit_sha,json=gitCommitSha,proto3" json:"git_commit_sha,omitempty"`
+	GitTag          string                 `protobuf:"bytes,26,opt,name=git_tag,json=gitTag,proto3" json:"git_tag,omitempty"`
+	OrgId           string                 `protobuf:"bytes,27,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	// The badge stays hidden until then, and a draft is published at that time
+	PublishAt     *timestamppb.Timestamp `protobuf:"bytes,28,opt,name=publish_at,json=publishAt,proto3" json:"publish_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Badge) Reset() {
+	*x = Badge{}
+	mi := &file_badges_v1_badges_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Badge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Badge) ProtoMessage() {}
+
+func (x *Badge) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Badge.ProtoReflect.Descriptor instead.
+func (*Badge) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Badge) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+func (x *Badge) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Badge) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Badge) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *Badge) GetIssuerUrl() string {
+	if x != nil {
+		return x.IssuerUrl
+	}
+	return ""
+}
+
+func (x *Badge) GetIssuerId() string {
+	if x != nil {
+		return x.IssuerId
+	}
+	return ""
+}
+
+func (x *Badge) GetIssueDate() string {
+	if x != nil {
+		return x.IssueDate
+	}
+	return ""
+}
+
+func (x *Badge) GetExpiryDate() string {
+	if x != nil {
+		return x.ExpiryDate
+	}
+	return ""
+}
+
+func (x *Badge) GetSoftwareName() string {
+	if x != nil {
+		return x.SoftwareName
+	}
+	return ""
+}
+
+func (x *Badge) GetSoftwareVersion() string {
+	if x != nil {
+		return x.SoftwareVersion
+	}
+	return ""
+}
+
+func (x *Badge) GetSoftwareUrl() string {
+	if x != nil {
+		return x.SoftwareUrl
+	}
+	return ""
+}
+
+func (x *Badge) GetSoftwareScId() string {
+	if x != nil {
+		return x.SoftwareScId
+	}
+	return ""
+}
+
+func (x *Badge) GetSoftwareScUrl() string {
+	if x != nil {
+		return x.SoftwareScUrl
+	}
+	return ""
+}
+
+func (x *Badge) GetCoveredVersion() string {
+	if x != nil {
+		return x.CoveredVersion
+	}
+	return ""
+}
+
+func (x *Badge) GetCertificateName() string {
+	if x != nil {
+		return x.CertificateName
+	}
+	return ""
+}
+
+func (x *Badge) GetSpecialtyDomain() string {
+	if x != nil {
+		return x.SpecialtyDomain
+	}
+	return ""
+}
+
+func (x *Badge) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *Badge) GetPublicNote() string {
+	if x != nil {
+		return x.PublicNote
+	}
+	return ""
+}
+
+func (x *Badge) GetInternalNote() string {
+	if x != nil {
+		return x.InternalNote
+	}
+	return ""
+}
+
+func (x *Badge) GetContactDetails() string {
+	if x != nil {
+		return x.ContactDetails
+	}
+	return ""
+}
+
+func (x *Badge) GetLastReview() string {
+	if x != nil {
+		return x.LastReview
+	}
+	return ""
+}
+
+func (x *Badge) GetRepositoryLink() string {
+	if x != nil {
+		return x.RepositoryLink
+	}
+	return ""
+}
+
+func (x *Badge) GetCustomConfig() string {
+	if x != nil {
+		return x.CustomConfig
+	}
+	return ""
+}
+
+func (x *Badge) GetGitRepository() string {
+	if x != nil {
+		return x.GitRepository
+	}
+	return ""
+}
+
+func (x *Badge) GetGitCommitSha() string {
+	if x != nil {
+		return x.GitCommitSha
+	}
+	return ""
+}
+
+func (x *Badge) GetGitTag() string {
+	if x != nil {
+		return x.GitTag
+	}
+	return ""
+}
+
+func (x *Badge) GetOrgId() string {
+	if x != nil {
+		return x.OrgId
+	}
+	return ""
+}
+
+func (x *Badge) GetPublishAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PublishAt
+	}
+	return nil
+}
+
+// Certificate is the verification statement of GET /api/verify/{commit_id}
+type Certificate struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	CommitId string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	// valid, expired or revoked
+	Status          string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	SoftwareName    string                 `protobuf:"bytes,3,opt,name=software_name,json=softwareName,proto3" json:"software_name,omitempty"`
+	SoftwareVersion string                 `protobuf:"bytes,4,opt,name=software_version,json=softwareVersion,proto3" json:"software_version,omitempty"`
+	CoveredVersion  string                 `protobuf:"bytes,5,opt,name=covered_version,json=coveredVersion,proto3" json:"covered_version,omitempty"`
+	CertificateName string                 `protobuf:"bytes,6,opt,name=certificate_name,json=certificateName,proto3" json:"certificate_name,omitempty"`
+	Issuer          string                 `protobuf:"bytes,7,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	IssuerUrl       string                 `protobuf:"bytes,8,opt,name=issuer_url,json=issuerUrl,proto3" json:"issuer_url,omitempty"`
+	IssueDate       string                 `protobuf:"bytes,9,opt,name=issue_date,json=issueDate,proto3" json:"issue_date,omitempty"`
+	ExpiryDate      string                 `protobuf:"bytes,10,opt,name=expiry_date,json=expiryDate,proto3" json:"expiry_date,omitempty"`
+	GitRepository   string                 `protobuf:"bytes,11,opt,name=git_repository,json=gitRepository,proto3" json:"git_repository,omitempty"`
+	GitCommitSha    string                 `protobuf:"bytes,12,opt,name=git_commit_sha,json=gitCommitSha,proto3" json:"git_commit_sha,omitempty"`
+	GitTag          string                 `protobuf:"bytes,13,opt,name=git_tag,json=gitTag,proto3" json:"git_tag,omitempty"`
+	VerifiedAt      *timestamppb.Timestamp `protobuf:"bytes,14,opt,name=verified_at,json=verifiedAt,proto3" json:"verified_at,omitempty"`
+	KeyId           string                 `protobuf:"bytes,15,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	// The JSON statement as served by /api/verify, which signature covers
+	Statement []byte `protobuf:"bytes,16,opt,name=statement,proto3" json:"statement,omitempty"`
+	// Ed25519 signature of statement, base64 encoded
+	Signature     string `protobuf:"bytes,17,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Certificate) Reset() {
+	*x = Certificate{}
+	mi := &file_badges_v1_badges_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Certificate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Certificate) ProtoMessage() {}
+
+func (x *Certificate) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Certificate.ProtoReflect.Descriptor instead.
+func (*Certificate) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Certificate) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+func (x *Certificate) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Certificate) GetSoftwareName() string {
+	if x != nil {
+		return x.SoftwareName
+	}
+	return ""
+}
+
+func (x *Certificate) GetSoftwareVersion() string {
+	if x != nil {
+		return x.SoftwareVersion
+	}
+	return ""
+}
+
+func (x *Certificate) GetCoveredVersion() string {
+	if x != nil {
+		return x.CoveredVersion
+	}
+	return ""
+}
+
+func (x *Certificate) GetCertificateName() string {
+	if x != nil {
+		return x.CertificateName
+	}
+	return ""
+}
+
+func (x *Certificate) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *Certificate) GetIssuerUrl() string {
+	if x != nil {
+		return x.IssuerUrl
+	}
+	return ""
+}
+
+func (x *Certificate) GetIssueDate() string {
+	if x != nil {
+		return x.IssueDate
+	}
+	return ""
+}
+
+func (x *Certificate) GetExpiryDate() string {
+	if x != nil {
+		return x.ExpiryDate
+	}
+	return ""
+}
+
+func (x *Certificate) GetGitRepository() string {
+	if x != nil {
+		return x.GitRepository
+	}
+	return ""
+}
+
+func (x *Certificate) GetGitCommitSha() string {
+	if x != nil {
+		return x.GitCommitSha
+	}
+	return ""
+}
+
+func (x *Certificate) GetGitTag() string {
+	if x != nil {
+		return x.GitTag
+	}
+	return ""
+}
+
+func (x *Certificate) GetVerifiedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.VerifiedAt
+	}
+	return nil
+}
+
+func (x *Certificate) GetKeyId() string {
+	if x != nil {
+		return x.KeyId
+	}
+	return ""
+}
+
+func (x *Certificate) GetStatement() []byte {
+	if x != nil {
+		return x.Statement
+	}
+	return nil
+}
+
+func (x *Certificate) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+type VerifyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommitId      string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyRequest) Reset() {
+	*x = VerifyRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyRequest) ProtoMessage() {}
+
+func (x *VerifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyRequest.ProtoReflect.Descriptor instead.
+func (*VerifyRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *VerifyRequest) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+type GetBadgeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommitId      string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBadgeRequest) Reset() {
+	*x = GetBadgeRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBadgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBadgeRequest) ProtoMessage() {}
+
+func (x *GetBadgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBadgeRequest.ProtoReflect.Descriptor instead.
+func (*GetBadgeRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetBadgeRequest) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+// ListBadgesRequest filters like the query parameters of GET /api/badges
+type ListBadgesRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Status string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Issuer string                 `protobuf:"bytes,2,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	Domain string                 `protobuf:"bytes,3,opt,name=domain,proto3" json:"domain,omitempty"`
+	Org    string                 `protobuf:"bytes,4,opt,name=org,proto3" json:"org,omitempty"`
+	// "missing" lists only badges whose Software Catalogue project disappeared
+	Catalogue string `protobuf:"bytes,5,opt,name=catalogue,proto3" json:"catalogue,omitempty"`
+	// Sort key, prefixed with - for descending order, e.g. -issue_date
+	Sort          string `protobuf:"bytes,6,opt,name=sort,proto3" json:"sort,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBadgesRequest) Reset() {
+	*x = ListBadgesRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBadgesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBadgesRequest) ProtoMessage() {}
+
+func (x *ListBadgesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBadgesRequest.ProtoReflect.Descriptor instead.
+func (*ListBadgesRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListBadgesRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ListBadgesRequest) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *ListBadgesRequest) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *ListBadgesRequest) GetOrg() string {
+	if x != nil {
+		return x.Org
+	}
+	return ""
+}
+
+func (x *ListBadgesRequest) GetCatalogue() string {
+	if x != nil {
+		return x.Catalogue
+	}
+	return ""
+}
+
+func (x *ListBadgesRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+type CreateBadgeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Badge         *Badge                 `protobuf:"bytes,1,opt,name=badge,proto3" json:"badge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBadgeRequest) Reset() {
+	*x = CreateBadgeRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBadgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBadgeRequest) ProtoMessage() {}
+
+func (x *CreateBadgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBadgeRequest.ProtoReflect.Descriptor instead.
+func (*CreateBadgeRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateBadgeRequest) GetBadge() *Badge {
+	if x != nil {
+		return x.Badge
+	}
+	return nil
+}
+
+type UpdateBadgeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The badge to change, identified by its commit_id
+	Badge *Badge `protobuf:"bytes,1,opt,name=badge,proto3" json:"badge,omitempty"`
+	// The fields to change; an empty mask changes every non-empty field. A
+	// field in the mask that is empty in badge is cleared.
+	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateBadgeRequest) Reset() {
+	*x = UpdateBadgeRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateBadgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateBadgeRequest) ProtoMessage() {}
+
+func (x *UpdateBadgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateBadgeRequest.ProtoReflect.Descriptor instead.
+func (*UpdateBadgeRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateBadgeRequest) GetBadge() *Badge {
+	if x != nil {
+		return x.Badge
+	}
+	return nil
+}
+
+func (x *UpdateBadgeRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
+type DeleteBadgeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommitId      string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBadgeRequest) Reset() {
+	*x = DeleteBadgeRequest{}
+	mi := &file_badges_v1_badges_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBadgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBadgeRequest) ProtoMessage() {}
+
+func (x *DeleteBadgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBadgeRequest.ProtoReflect.Descriptor instead.
+func (*DeleteBadgeRequest) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteBadgeRequest) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+type DeleteBadgeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBadgeResponse) Reset() {
+	*x = DeleteBadgeResponse{}
+	mi := &file_badges_v1_badges_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBadgeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBadgeResponse) ProtoMessage() {}
+
+func (x *DeleteBadgeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_badges_v1_badges_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBadgeResponse.ProtoReflect.Descriptor instead.
+func (*DeleteBadgeResponse) Descriptor() ([]byte, []int) {
+	return file_badges_v1_badges_proto_rawDescGZIP(), []int{8}
+}
+
+var File_badges_v1_badges_proto protoreflect.FileDescriptor
+
+const file_badges_v1_badges_proto_rawDesc = "" +
+	"\n" +
+	"\x16badges/v1/badges.proto\x12\tbadges.v1\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd0\a\n" +
+	"\x05Badge\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
+	"\x06issuer\x18\x04 \x01(\tR\x06issuer\x12\x1d\n" +
+	"\n" +
+	"issuer_url\x18\x05 \x01(\tR\tissuerUrl\x12\x1b\n" +
+	"\tissuer_id\x18\x06 \x01(\tR\bissuerId\x12\x1d\n" +
+	"\n" +
+	"issue_date\x18\a \x01(\tR\tissueDate\x12\x1f\n" +
+	"\vexpiry_date\x18\b \x01(\tR\n" +
+	"expiryDate\x12#\n" +
+	"\rsoftware_name\x18\t \x01(\tR\fsoftwareName\x12)\n" +
+	"\x10software_version\x18\n" +
+	" \x01(\tR\x0fsoftwareVersion\x12!\n" +
+	"\fsoftware_url\x18\v \x01(\tR\vsoftwareUrl\x12$\n" +
+	"\x0esoftware_sc_id\x18\f \x01(\tR\fsoftwareScId\x12&\n" +
+	"\x0fsoftware_sc_url\x18\r \x01(\tR\rsoftwareScUrl\x12'\n" +
+	"\x0fcovered_version\x18\x0e \x01(\tR\x0ecoveredVersion\x12)\n" +
+	"\x10certificate_name\x18\x0f \x01(\tR\x0fcertificateName\x12)\n" +
+	"\x10specialty_domain\x18\x10 \x01(\tR\x0fspecialtyDomain\x12\x14\n" +
+	"\x05notes\x18\x11 \x01(\tR\x05notes\x12\x1f\n" +
+	"\vpublic_note\x18\x12 \x01(\tR\n" +
+	"publicNote\x12#\n" +
+	"\rinternal_note\x18\x13 \x01(\tR\finternalNote\x12'\n" +
+	"\x0fcontact_details\x18\x14 \x01(\tR\x0econtactDetails\x12\x1f\n" +
+	"\vlast_review\x18\x15 \x01(\tR\n" +
+	"lastReview\x12'\n" +
+	"\x0frepository_link\x18\x16 \x01(\tR\x0erepositoryLink\x12#\n" +
+	"\rcustom_config\x18\x17 \x01(\tR\fcustomConfig\x12%\n" +
+	"\x0egit_repository\x18\x18 \x01(\tR\rgitRepository\x12$\n" +
+	"\x0egit_commit_sha\x18\x19 \x01(\tR\fgitCommitSha\x12\x17\n" +
+	"\agit_tag\x18\x1a \x01(\tR\x06gitTag\x12\x15\n" +
+	"\x06org_id\x18\x1b \x01(\tR\x05orgId\x129\n" +
+	"\n" +
+	"publish_at\x18\x1c \x01(\v2\x1a.google.protobuf.TimestampR\tpublishAt\"\xd3\x04\n" +
+	"\vCertificate\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12#\n" +
+	"\rsoftware_name\x18\x03 \x01(\tR\fsoftwareName\x12)\n" +
+	"\x10software_version\x18\x04 \x01(\tR\x0fsoftwareVersion\x12'\n" +
+	"\x0fcovered_version\x18\x05 \x01(\tR\x0ecoveredVersion\x12)\n" +
+	"\x10certificate_name\x18\x06 \x01(\tR\x0fcertificateName\x12\x16\n" +
+	"\x06issuer\x18\a \x01(\tR\x06issuer\x12\x1d\n" +
+	"\n" +
+	"issuer_url\x18\b \x01(\tR\tissuerUrl\x12\x1d\n" +
+	"\n" +
+	"issue_date\x18\t \x01(\tR\tissueDate\x12\x1f\n" +
+	"\vexpiry_date\x18\n" +
+	" \x01(\tR\n" +
+	"expiryDate\x12%\n" +
+	"\x0egit_repository\x18\v \x01(\tR\rgitRepository\x12$\n" +
+	"\x0egit_commit_sha\x18\f \x01(\tR\fgitCommitSha\x12\x17\n" +
+	"\agit_tag\x18\r \x01(\tR\x06gitTag\x12;\n" +
+	"\vverified_at\x18\x0e \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"verifiedAt\x12\x15\n" +
+	"\x06key_id\x18\x0f \x01(\tR\x05keyId\x12\x1c\n" +
+	"\tstatement\x18\x10 \x01(\fR\tstatement\x12\x1c\n" +
+	"\tsignature\x18\x11 \x01(\tR\tsignature\",\n" +
+	"\rVerifyRequest\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\".\n" +
+	"\x0fGetBadgeRequest\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\"\x9f\x01\n" +
+	"\x11ListBadgesRequest\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x16\n" +
+	"\x06issuer\x18\x02 \x01(\tR\x06issuer\x12\x16\n" +
+	"\x06domain\x18\x03 \x01(\tR\x06domain\x12\x10\n" +
+	"\x03org\x18\x04 \x01(\tR\x03org\x12\x1c\n" +
+	"\tcatalogue\x18\x05 \x01(\tR\tcatalogue\x12\x12\n" +
+	"\x04sort\x18\x06 \x01(\tR\x04sort\"<\n" +
+	"\x12CreateBadgeRequest\x12&\n" +
+	"\x05badge\x18\x01 \x01(\v2\x10.badges.v1.BadgeR\x05badge\"y\n" +
+	"\x12UpdateBadgeRequest\x12&\n" +
+	"\x05badge\x18\x01 \x01(\v2\x10.badges.v1.BadgeR\x05badge\x12;\n" +
+	"\vupdate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMask\"1\n" +
+	"\x12DeleteBadgeRequest\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\"\x15\n" +
+	"\x13DeleteBadgeResponse2\x92\x03\n" +
+	"\fBadgeService\x128\n" +
+	"\bGetBadge\x12\x1a.badges.v1.GetBadgeRequest\x1a\x10.badges.v1.Badge\x12>\n" +
+	"\n" +
+	"ListBadges\x12\x1c.badges.v1.ListBadgesRequest\x1a\x10.badges.v1.Badge0\x01\x12>\n" +
+	"\vCreateBadge\x12\x1d.badges.v1.CreateBadgeRequest\x1a\x10.badges.v1.Badge\x12>\n" +
+	"\vUpdateBadge\x12\x1d.badges.v1.UpdateBadgeRequest\x1a\x10.badges.v1.Badge\x12L\n" +
+	"\vDeleteBadge\x12\x1d.badges.v1.DeleteBadgeRequest\x1a\x1e.badges.v1.DeleteBadgeResponse\x12:\n" +
+	"\x06Verify\x12\x18.badges.v1.VerifyRequest\x1a\x16.badges.v1.CertificateB3Z1github.com/finki/badges/internal/grpcapi/badgesv1b\x06proto3"
+
+var (
+	file_badges_v1_badges_proto_rawDescOnce sync.Once
+	file_badges_v1_badges_proto_rawDescData []byte
+)
+
+func file_badges_v1_badges_proto_rawDescGZIP() []byte {
+	file_badges_v1_badges_proto_rawDescOnce.Do(func() {
+		file_badges_v1_badges_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_badges_v1_badges_proto_rawDesc), len(file_badges_v1_badges_proto_rawDesc)))
+	})
+	return file_badges_v1_badges_proto_rawDescData
+}
+
+var file_badges_v1_badges_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_badges_v1_badges_proto_goTypes = []any{
+	(*Badge)(nil),                 // 0: badges.v1.Badge
+	(*Certificate)(nil),           // 1: badges.v1.Certificate
+	(*VerifyRequest)(nil),         // 2: badges.v1.VerifyRequest
+	(*GetBadgeRequest)(nil),       // 3: badges.v1.GetBadgeRequest
+	(*ListBadgesRequest)(nil),     // 4: badges.v1.ListBadgesRequest
+	(*CreateBadgeRequest)(nil),    // 5: badges.v1.CreateBadgeRequest
+	(*UpdateBadgeRequest)(nil),    // 6: badges.v1.UpdateBadgeRequest
+	(*DeleteBadgeRequest)(nil),    // 7: badges.v1.DeleteBadgeRequest
+	(*DeleteBadgeResponse)(nil),   // 8: badges.v1.DeleteBadgeResponse
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+	(*fieldmaskpb.FieldMask)(nil), // 10: google.protobuf.FieldMask
+}
+var file_badges_v1_badges_proto_depIdxs = []int32{
+	9,  // 0: badges.v1.Badge.publish_at:type_name -> google.protobuf.Timestamp
+	9,  // 1: badges.v1.Certificate.verified_at:type_name -> google.protobuf.Timestamp
+	0,  // 2: badges.v1.CreateBadgeRequest.badge:type_name -> badges.v1.Badge
+	0,  // 3: badges.v1.UpdateBadgeRequest.badge:type_name -> badges.v1.Badge
+	10, // 4: badges.v1.UpdateBadgeRequest.update_mask:type_name -> google.protobuf.FieldMask
+	3,  // 5: badges.v1.BadgeService.GetBadge:input_type -> badges.v1.GetBadgeRequest
+	4,  // 6: badges.v1.BadgeService.ListBadges:input_type -> badges.v1.ListBadgesRequest
+	5,  // 7: badges.v1.BadgeService.CreateBadge:input_type -> badges.v1.CreateBadgeRequest
+	6,  // 8: badges.v1.BadgeService.UpdateBadge:input_type -> badges.v1.UpdateBadgeRequest
+	7,  // 9: badges.v1.BadgeService.DeleteBadge:input_type -> badges.v1.DeleteBadgeRequest
+	2,  // 10: badges.v1.BadgeService.Verify:input_type -> badges.v1.VerifyRequest
+	0,  // 11: badges.v1.BadgeService.GetBadge:output_type -> badges.v1.Badge
+	0,  // 12: badges.v1.BadgeService.ListBadges:output_type -> badges.v1.Badge
+	0,  // 13: badges.v1.BadgeService.CreateBadge:output_type -> badges.v1.Badge
+	0,  // 14: badges.v1.BadgeService.UpdateBadge:output_type -> badges.v1.Badge
+	8,  // 15: badges.v1.BadgeService.DeleteBadge:output_type -> badges.v1.DeleteBadgeResponse
+	1,  // 16: badges.v1.BadgeService.Verify:output_type -> badges.v1.Certificate
+	11, // [11:17] is the sub-list for method output_type
+	5,  // [5:11] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_badges_v1_badges_proto_init() }
+func file_badges_v1_badges_proto_init() {
+	if File_badges_v1_badges_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_badges_v1_badges_proto_rawDesc), len(file_badges_v1_badges_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_badges_v1_badges_proto_goTypes,
+		DependencyIndexes: file_badges_v1_badges_proto_depIdxs,
+		MessageInfos:      file_badges_v1_badges_proto_msgTypes,
+	}.Build()
+	File_badges_v1_badges_proto = out.File
+	file_badges_v1_badges_proto_goTypes = nil
+	file_badges_v1_badges_proto_depIdxs = nil
+}
@@ -0,0 +1,341 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: badges/v1/badges.proto
+
+// The gRPC API for service-to-service badge management, e.g. by the Software
+// Catalogue backend. It mirrors /api/badges and /api/verify over the same
+// service layer. Generate the Go code with `make proto`.
+
+package badgesv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BadgeService_GetBadge_FullMethodName    = "/badges.v1.BadgeService/GetBadge"
+	BadgeService_ListBadges_FullMethodName  = "/badges.v1.BadgeService/ListBadges"
+	BadgeService_CreateBadge_FullMethodName = "/badges.v1.BadgeService/CreateBadge"
+	BadgeService_UpdateBadge_FullMethodName = "/badges.v1.BadgeService/UpdateBadge"
+	BadgeService_DeleteBadge_FullMethodName = "/badges.v1.BadgeService/DeleteBadge"
+	BadgeService_Verify_FullMethodName      = "/badges.v1.BadgeService/Verify"
+)
+
+// BadgeServiceClient is the client API for BadgeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BadgeService manages badges. Calls authenticate with an API key in the
+// x-api-key metadata and need the same badges permissions as the JSON API:
+// read for GetBadge and ListBadges, write for CreateBadge and UpdateBadge,
+// delete for DeleteBadge. Verify is public.
+type BadgeServiceClient interface {
+	// GetBadge returns a badge, drafts included
+	GetBadge(ctx context.Context, in *GetBadgeRequest, opts ...grpc.CallOption) (*Badge, error)
+	// ListBadges streams the badges matching the filter, drafts included
+	ListBadges(ctx context.Context, in *ListBadgesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Badge], error)
+	// CreateBadge creates a badge; missing fields get the defaults of the web form
+	CreateBadge(ctx context.Context, in *CreateBadgeRequest, opts ...grpc.CallOption) (*Badge, error)
+	// UpdateBadge changes the fields named in the update mask
+	UpdateBadge(ctx context.Context, in *UpdateBadgeRequest, opts ...grpc.CallOption) (*Badge, error)
+	// DeleteBadge deletes a badge
+	DeleteBadge(ctx context.Context, in *DeleteBadgeRequest, opts ...grpc.CallOption) (*DeleteBadgeResponse, error)
+	// Verify returns the signed statement of a published certificate's status
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Certificate, error)
+}
+
+type badgeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBadgeServiceClient(cc grpc.ClientConnInterface) BadgeServiceClient {
+	return &badgeServiceClient{cc}
+}
+
+func (c *badgeServiceClient) GetBadge(ctx context.Context, in *GetBadgeRequest, opts ...grpc.CallOption) (*Badge, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Badge)
+	err := c.cc.Invoke(ctx, BadgeService_GetBadge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *badgeServiceClient) ListBadges(ctx context.Context, in *ListBadgesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Badge], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BadgeService_ServiceDesc.Streams[0], BadgeService_ListBadges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListBadgesRequest, Badge]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BadgeService_ListBadgesClient = grpc.ServerStreamingClient[Badge]
+
+func (c *badgeServiceClient) CreateBadge(ctx context.Context, in *CreateBadgeRequest, opts ...grpc.CallOption) (*Badge, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Badge)
+	err := c.cc.Invoke(ctx, BadgeService_CreateBadge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *badgeServiceClient) UpdateBadge(ctx context.Context, in *UpdateBadgeRequest, opts ...grpc.CallOption) (*Badge, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Badge)
+	err := c.cc.Invoke(ctx, BadgeService_UpdateBadge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *badgeServiceClient) DeleteBadge(ctx context.Context, in *DeleteBadgeRequest, opts ...grpc.CallOption) (*DeleteBadgeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteBadgeResponse)
+	err := c.cc.Invoke(ctx, BadgeService_DeleteBadge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *badgeServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Certificate, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Certificate)
+	err := c.cc.Invoke(ctx, BadgeService_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BadgeServiceServer is the server API for BadgeService service.
+// All implementations must embed UnimplementedBadgeServiceServer
+// for forward compatibility.
+//
+// BadgeService manages badges. Calls authenticate with an API key in the
+// x-api-key metadata and need the same badges permissions as the JSON API:
+// read for GetBadge and ListBadges, write for CreateBadge and UpdateBadge,
+// delete for DeleteBadge. Verify is public.
+type BadgeServiceServer interface {
+	// GetBadge returns a badge, drafts included
+	GetBadge(context.Context, *GetBadgeRequest) (*Badge, error)
+	// ListBadges streams the badges matching the filter, drafts included
+	ListBadges(*ListBadgesRequest, grpc.ServerStreamingServer[Badge]) error
+	// CreateBadge creates a badge; missing fields get the defaults of the web form
+	CreateBadge(context.Context, *CreateBadgeRequest) (*Badge, error)
+	// UpdateBadge changes the fields named in the update mask
+	UpdateBadge(context.Context, *UpdateBadgeRequest) (*Badge, error)
+	// DeleteBadge deletes a badge
+	DeleteBadge(context.Context, *DeleteBadgeRequest) (*DeleteBadgeResponse, error)
+	// Verify returns the signed statement of a published certificate's status
+	Verify(context.Context, *VerifyRequest) (*Certificate, error)
+	mustEmbedUnimplementedBadgeServiceServer()
+}
+
+// UnimplementedBadgeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBadgeServiceServer struct{}
+
+func (UnimplementedBadgeServiceServer) GetBadge(context.Context, *GetBadgeRequest) (*Badge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBadge not implemented")
+}
+func (UnimplementedBadgeServiceServer) ListBadges(*ListBadgesRequest, grpc.ServerStreamingServer[Badge]) error {
+	return status.Errorf(codes.Unimplemented, "method ListBadges not implemented")
+}
+func (UnimplementedBadgeServiceServer) CreateBadge(context.Context, *CreateBadgeRequest) (*Badge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBadge not implemented")
+}
+func (UnimplementedBadgeServiceServer) UpdateBadge(context.Context, *UpdateBadgeRequest) (*Badge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateBadge not implemented")
+}
+func (UnimplementedBadgeServiceServer) DeleteBadge(context.Context, *DeleteBadgeRequest) (*DeleteBadgeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBadge not implemented")
+}
+func (UnimplementedBadgeServiceServer) Verify(context.Context, *VerifyRequest) (*Certificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedBadgeServiceServer) mustEmbedUnimplementedBadgeServiceServer() {}
+func (UnimplementedBadgeServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeBadgeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BadgeServiceServer will
+// result in compilation errors.
+type UnsafeBadgeServiceServer interface {
+	mustEmbedUnimplementedBadgeServiceServer()
+}
+
+func RegisterBadgeServiceServer(s grpc.ServiceRegistrar, srv BadgeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedBadgeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BadgeService_ServiceDesc, srv)
+}
+
+func _BadgeService_GetBadge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBadgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgeServiceServer).GetBadge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BadgeService_GetBadge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgeServiceServer).GetBadge(ctx, req.(*GetBadgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BadgeService_ListBadges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListBadgesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BadgeServiceServer).ListBadges(m, &grpc.GenericServerStream[ListBadgesRequest, Badge]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BadgeService_ListBadgesServer = grpc.ServerStreamingServer[Badge]
+
+func _BadgeService_CreateBadge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBadgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgeServiceServer).CreateBadge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BadgeService_CreateBadge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgeServiceServer).CreateBadge(ctx, req.(*CreateBadgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BadgeService_UpdateBadge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateBadgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgeServiceServer).UpdateBadge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BadgeService_UpdateBadge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgeServiceServer).UpdateBadge(ctx, req.(*UpdateBadgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BadgeService_DeleteBadge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBadgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgeServiceServer).DeleteBadge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BadgeService_DeleteBadge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgeServiceServer).DeleteBadge(ctx, req.(*DeleteBadgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BadgeService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgeServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BadgeService_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgeServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BadgeService_ServiceDesc is the grpc.ServiceDesc for BadgeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BadgeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "badges.v1.BadgeService",
+	HandlerType: (*BadgeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBadge",
+			Handler:    _BadgeService_GetBadge_Handler,
+		},
+		{
+			MethodName: "CreateBadge",
+			Handler:    _BadgeService_CreateBadge_Handler,
+		},
+		{
+			MethodName: "UpdateBadge",
+			Handler:    _BadgeService_UpdateBadge_Handler,
+		},
+		{
+			MethodName: "DeleteBadge",
+			Handler:    _BadgeService_DeleteBadge_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _BadgeService_Verify_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListBadges",
+			Handler:       _BadgeService_ListBadges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "badges/v1/badges.proto",
+}
@@ -0,0 +1,124 @@
+package grpcapi
+
+import (
+	"time"
+
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/grpcapi/badgesv1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toProto converts a database badge to its protobuf representation
+func toProto(b *database.Badge) *badgesv1.Badge {
+	pb := &badgesv1.Badge{
+		CommitId:        b.CommitID,
+		Type:            b.Type,
+		Status:          string(b.Status),
+		Issuer:          b.Issuer,
+		IssuerUrl:       b.IssuerURL.String,
+		IssuerId:        b.IssuerID.String,
+		IssueDate:       database.FormatDate(b.IssueDate),
+		ExpiryDate:      database.FormatNullDate(b.ExpiryDate),
+		SoftwareName:    b.SoftwareName,
+		SoftwareVersion: b.SoftwareVersion,
+		SoftwareUrl:     b.SoftwareURL.String,
+		SoftwareScId:    b.SoftwareSCID.String,
+		SoftwareScUrl:   b.SoftwareSCURL.String,
+		CoveredVersion:  b.CoveredVersion.String,
+		CertificateName: b.CertificateName.String,
+		SpecialtyDomain: b.SpecialtyDomain.String,
+		Notes:           b.Notes.String,
+		PublicNote:      b.PublicNote.String,
+		InternalNote:    b.InternalNote.String,
+		ContactDetails:  b.ContactDetails.String,
+		LastReview:      database.FormatNullDate(b.LastReview),
+		RepositoryLink:  b.RepositoryLink.String,
+		CustomConfig:    b.CustomConfig.String,
+		GitRepository:   b.GitRepository.String,
+		GitCommitSha:    b.GitCommitSHA.String,
+		GitTag:          b.GitTag.String,
+		OrgId:           b.OrgID.String,
+	}
+	if b.PublishAt.Valid {
+		pb.PublishAt = timestamppb.New(b.PublishAt.Time)
+	}
+	return pb
+}
+
+// fromProto converts a protobuf badge to the fields of a JSON API request.
+// Without paths every non-empty field is set; otherwise exactly the fields
+// named in paths are, and an empty one is cleared.
+func fromProto(pb *badgesv1.Badge, paths []string) (*badgeapi.Badge, error) {
+	if pb == nil {
+		return nil, status.Error(codes.InvalidArgument, "badge is required")
+	}
+	req := &badgeapi.Badge{CommitID: pb.GetCommitId()}
+
+	publishAt := ""
+	if pb.GetPublishAt() != nil {
+		if err := pb.GetPublishAt().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid publish_at")
+		}
+		publishAt = pb.GetPublishAt().AsTime().UTC().Format(time.RFC3339)
+	}
+
+	fields := map[string]struct {
+		dst   **string
+		value string
+	}{
+		"type":             {&req.Type, pb.GetType()},
+		"status":           {&req.Status, pb.GetStatus()},
+		"issuer":           {&req.Issuer, pb.GetIssuer()},
+		"issuer_url":       {&req.IssuerURL, pb.GetIssuerUrl()},
+		"issuer_id":        {&req.IssuerID, pb.GetIssuerId()},
+		"issue_date":       {&req.IssueDate, pb.GetIssueDate()},
+		"expiry_date":      {&req.ExpiryDate, pb.GetExpiryDate()},
+		"software_name":    {&req.SoftwareName, pb.GetSoftwareName()},
+		"software_version": {&req.SoftwareVersion, pb.GetSoftwareVersion()},
+		"software_url":     {&req.SoftwareURL, pb.GetSoftwareUrl()},
+		"software_sc_id":   {&req.SoftwareSCID, pb.GetSoftwareScId()},
+		"software_sc_url":  {&req.SoftwareSCURL, pb.GetSoftwareScUrl()},
+		"covered_version":  {&req.CoveredVersion, pb.GetCoveredVersion()},
+		"certificate_name": {&req.CertificateName, pb.GetCertificateName()},
+		"specialty_domain": {&req.SpecialtyDomain, pb.GetSpecialtyDomain()},
+		"notes":            {&req.Notes, pb.GetNotes()},
+		"public_note":      {&req.PublicNote, pb.GetPublicNote()},
+		"internal_note":    {&req.InternalNote, pb.GetInternalNote()},
+		"contact_details":  {&req.ContactDetails, pb.GetContactDetails()},
+		"last_review":      {&req.LastReview, pb.GetLastReview()},
+		"repository_link":  {&req.RepositoryLink, pb.GetRepositoryLink()},
+		"custom_config":    {&req.CustomConfig, pb.GetCustomConfig()},
+		"git_repository":   {&req.GitRepository, pb.GetGitRepository()},
+		"git_commit_sha":   {&req.GitCommitSHA, pb.GetGitCommitSha()},
+		"git_tag":          {&req.GitTag, pb.GetGitTag()},
+		"org_id":           {&req.OrgID, pb.GetOrgId()},
+		"publish_at":       {&req.PublishAt, publishAt},
+	}
+
+	if len(paths) == 0 {
+		for _, f := range fields {
+			if f.value != "" {
+				*f.dst = stringPtr(f.value)
+			}
+		}
+		return req, nil
+	}
+	for _, path := range paths {
+		if path == "commit_id" {
+			continue
+		}
+		f, ok := fields[path]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown field in update_mask: %s", path)
+		}
+		*f.dst = stringPtr(f.value)
+	}
+	return req, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,303 @@
+// Package grpcapi serves the gRPC API defined in proto/badges/v1 for
+// service-to-service badge management. It shares the service layer of the
+// JSON API: badge CRUD goes through badgeapi and verification statements
+// through verify, so both APIs validate, scope and cache alike.
+package grpcapi
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/grpcapi/badgesv1"
+	"github.com/finki/badges/internal/verify"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// permissions maps each protected method to the badges action it requires;
+// other methods are public
+var permissions = map[string]string{
+	badgesv1.BadgeService_GetBadge_FullMethodName:    "read",
+	badgesv1.BadgeService_ListBadges_FullMethodName:  "read",
+	badgesv1.BadgeService_CreateBadge_FullMethodName: "write",
+	badgesv1.BadgeService_UpdateBadge_FullMethodName: "write",
+	badgesv1.BadgeService_DeleteBadge_FullMethodName: "delete",
+}
+
+// service implements badgesv1.BadgeServiceServer
+type service struct {
+	badgesv1.UnimplementedBadgeServiceServer
+	badges    *badgeapi.Handler
+	verifier  *verify.Handler
+	getAPIKey func(string) (*auth.APIKeyInfo, error)
+	// certificates maps verified client certificates to service accounts
+	certificates *auth.CertificateAuth
+	logger       *zap.Logger
+}
+
+// NewServer creates a gRPC server with the badge service registered.
+// Callers authenticate with an API key in the x-api-key metadata, which is
+// validated by getAPIKey as for the X-API-Key header of the JSON API, or,
+// when opts serve TLS credentials verifying client certificates and
+// certificates is not nil, with a client certificate mapped to a service
+// account.
+func NewServer(badges *badgeapi.Handler, verifier *verify.Handler, getAPIKey func(string) (*auth.APIKeyInfo, error), certificates *auth.CertificateAuth, logger *zap.Logger, opts ...grpc.ServerOption) *grpc.Server {
+	s := &service{
+		badges:       badges,
+		verifier:     verifier,
+		getAPIKey:    getAPIKey,
+		certificates: certificates,
+		logger:       logger,
+	}
+	srv := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	}, opts...)...)
+	badgesv1.RegisterBadgeServiceServer(srv, s)
+	return srv
+}
+
+// GetBadge returns a badge, drafts included
+func (s *service) GetBadge(ctx context.Context, req *badgesv1.GetBadgeRequest) (*badgesv1.Badge, error) {
+	badge, err := s.badges.Get(ctx, req.GetCommitId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(badge), nil
+}
+
+// ListBadges streams the badges matching the filter, drafts included
+func (s *service) ListBadges(req *badgesv1.ListBadgesRequest, stream badgesv1.BadgeService_ListBadgesServer) error {
+	query, err := database.ParseBadgeQuery(url.Values{
+		"status":    {req.GetStatus()},
+		"issuer":    {req.GetIssuer()},
+		"domain":    {req.GetDomain()},
+		"org":       {req.GetOrg()},
+		"catalogue": {req.GetCatalogue()},
+		"sort":      {req.GetSort()},
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	badges, _, err := s.badges.List(stream.Context(), query)
+	if err != nil {
+		return toStatus(err)
+	}
+	for _, b := range badges {
+		if err := stream.Send(toProto(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBadge creates a badge from the non-empty fields of the request
+func (s *service) CreateBadge(ctx context.Context, req *badgesv1.CreateBadgeRequest) (*badgesv1.Badge, error) {
+	fields, err := fromProto(req.GetBadge(), nil)
+	if err != nil {
+		return nil, err
+	}
+	badge, err := s.badges.Create(ctx, fields)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(badge), nil
+}
+
+// UpdateBadge changes the fields named in the update mask, or every non-empty
+// field without one
+func (s *service) UpdateBadge(ctx context.Context, req *badgesv1.UpdateBadgeRequest) (*badgesv1.Badge, error) {
+	fields, err := fromProto(req.GetBadge(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+	badge, err := s.badges.Update(ctx, fields.CommitID, fields)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(badge), nil
+}
+
+// DeleteBadge deletes a badge
+func (s *service) DeleteBadge(ctx context.Context, req *badgesv1.DeleteBadgeRequest) (*badgesv1.DeleteBadgeResponse, error) {
+	if err := s.badges.Delete(ctx, req.GetCommitId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &badgesv1.DeleteBadgeResponse{}, nil
+}
+
+// Verify returns the signed verification statement of a published certificate
+func (s *service) Verify(ctx context.Context, req *badgesv1.VerifyRequest) (*badgesv1.Certificate, error) {
+	if !commitid.Valid(req.GetCommitId()) {
+		return nil, status.Error(codes.InvalidArgument, "Invalid commit ID")
+	}
+	cert, err := s.verifier.Certificate(ctx, req.GetCommitId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to get badge")
+	}
+	if cert == nil {
+		return nil, status.Error(codes.NotFound, "Certificate not found")
+	}
+	statement, signature, err := s.verifier.Sign(cert)
+	if err != nil {
+		s.logger.Error("grpcapi: failed to sign certificate", zap.String("commit_id", cert.CommitID), zap.Error(err))
+		return nil, status.Error(codes.Internal, "Failed to encode response")
+	}
+
+	return &badgesv1.Certificate{
+		CommitId:        cert.CommitID,
+		Status:          cert.Status,
+		SoftwareName:    cert.SoftwareName,
+		SoftwareVersion: cert.SoftwareVersion,
+		CoveredVersion:  cert.CoveredVersion,
+		CertificateName: cert.CertificateName,
+		Issuer:          cert.Issuer,
+		IssuerUrl:       cert.IssuerURL,
+		IssueDate:       cert.IssueDate,
+		ExpiryDate:      cert.ExpiryDate,
+		GitRepository:   cert.GitRepository,
+		GitCommitSha:    cert.GitCommitSHA,
+		GitTag:          cert.GitTag,
+		VerifiedAt:      timestamppb.New(cert.VerifiedAt),
+		KeyId:           cert.KeyID,
+		Statement:       statement,
+		Signature:       signature,
+	}, nil
+}
+
+// unaryAuth authenticates unary calls
+func (s *service) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamAuth authenticates streaming calls
+func (s *service) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream carries the context with the caller's API key
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate validates the client certificate or API key of a call, adds
+// the caller to the context and checks the permission the method requires.
+// Public methods may be called without credentials.
+func (s *service) authenticate(ctx context.Context, method string) (context.Context, error) {
+	action, protected := permissions[method]
+
+	if cert := verifiedCertificate(ctx); cert != nil && s.certificates != nil {
+		claims, err := s.certificates.Claims(cert)
+		if errors.Is(err, auth.ErrCertificateNotMapped) {
+			return nil, status.Error(codes.PermissionDenied, "Client certificate is not mapped to a service account")
+		}
+		if err != nil {
+			s.logger.Error("grpcapi: failed to authenticate client certificate", zap.Error(err))
+			return nil, status.Error(codes.Internal, "Error validating client certificate")
+		}
+		ctx = auth.AddClaimsToContext(ctx, claims)
+		if protected && !auth.HasPermission(ctx, "badges", action) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied for badges:"+action)
+		}
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get("x-api-key")
+	if len(keys) == 0 {
+		if protected {
+			return nil, status.Error(codes.Unauthenticated, "API key required")
+		}
+		return ctx, nil
+	}
+
+	apiKey, err := s.getAPIKey(keys[0])
+	if errors.Is(err, auth.ErrInvalidAPIKey) || (err == nil && apiKey == nil) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid API key")
+	}
+	if err != nil {
+		s.logger.Error("grpcapi: failed to validate API key", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Error validating API key")
+	}
+
+	clientIP := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = p.Addr.String()
+	}
+	if err := auth.CheckAPIKey(apiKey, clientIP); err != nil {
+		if errors.Is(err, auth.ErrIPNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	ctx = auth.AddAPIKeyToContext(ctx, apiKey)
+	if protected && !auth.HasPermission(ctx, "badges", action) {
+		return nil, status.Error(codes.PermissionDenied, "Permission denied for badges:"+action)
+	}
+	return ctx, nil
+}
+
+// verifiedCertificate returns the client certificate of a call, if it was
+// made over a TLS connection that verified one
+func verifiedCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return info.State.VerifiedChains[0][0]
+}
+
+// toStatus converts a badgeapi error to the gRPC status matching its HTTP status
+func toStatus(err error) error {
+	var e *badgeapi.Error
+	if !errors.As(err, &e) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code := codes.Internal
+	switch e.Status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	}
+	return status.Error(code, e.Message)
+}
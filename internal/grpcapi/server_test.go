@@ -0,0 +1,212 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badgeapi"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/grpcapi/badgesv1"
+	"github.com/finki/badges/internal/signing"
+	"github.com/finki/badges/internal/verify"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testKeys are the API keys accepted by the test server, by raw key
+var testKeys = map[string]map[string]bool{
+	"bk_reader": {"read": true},
+	"bk_writer": {"read": true, "write": true, "delete": true},
+}
+
+// setupTestClient serves the badge service over an in-memory connection
+func setupTestClient(t *testing.T) (badgesv1.BadgeServiceClient, *signing.Signer) {
+	t.Helper()
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "grpc.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	signer, _, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+
+	getAPIKey := func(key string) (*auth.APIKeyInfo, error) {
+		perms, ok := testKeys[key]
+		if !ok {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return &auth.APIKeyInfo{
+			ID:          key,
+			UserID:      "user-id",
+			Status:      "active",
+			ExpiresAt:   time.Now().Add(time.Hour),
+			Permissions: map[string]map[string]bool{"badges": perms},
+		}, nil
+	}
+	srv := NewServer(badgeapi.NewHandler(db, logger, cache.New()), verify.NewHandler(db, logger, signer), getAPIKey, nil, logger)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return badgesv1.NewBadgeServiceClient(conn), signer
+}
+
+// withKey authenticates a call with an API key
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+}
+
+func TestBadgeLifecycle(t *testing.T) {
+	client, signer := setupTestClient(t)
+	writer := withKey("bk_writer")
+
+	created, err := client.CreateBadge(writer, &badgesv1.CreateBadgeRequest{Badge: &badgesv1.Badge{
+		CommitId:     "grpc1234",
+		Status:       "valid",
+		SoftwareName: "App",
+		SoftwareUrl:  "https://app.example.org",
+		PublishAt:    timestamppb.New(time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)),
+	}})
+	if err != nil {
+		t.Fatalf("CreateBadge: %v", err)
+	}
+	if created.Type != "badge" || created.SoftwareVersion != "0.0.0" || created.PublishAt.AsTime().Day() != 31 {
+		t.Errorf("expected the web form defaults and publish_at, got %+v", created)
+	}
+	if _, err := client.CreateBadge(writer, &badgesv1.CreateBadgeRequest{Badge: &badgesv1.Badge{CommitId: "grpc1234"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists for a duplicate, got %v", err)
+	}
+
+	// Only the masked fields change; a masked empty field is cleared
+	updated, err := client.UpdateBadge(writer, &badgesv1.UpdateBadgeRequest{
+		Badge:      &badgesv1.Badge{CommitId: "grpc1234", SoftwareVersion: "v2", SoftwareName: "Ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"software_version", "software_url"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateBadge: %v", err)
+	}
+	if updated.SoftwareVersion != "v2" || updated.SoftwareName != "App" || updated.SoftwareUrl != "" {
+		t.Errorf("unexpected update result %+v", updated)
+	}
+	if _, err := client.UpdateBadge(writer, &badgesv1.UpdateBadgeRequest{
+		Badge:      &badgesv1.Badge{CommitId: "grpc1234"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"png_content"}},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown mask path, got %v", err)
+	}
+
+	got, err := client.GetBadge(withKey("bk_reader"), &badgesv1.GetBadgeRequest{CommitId: "grpc1234"})
+	if err != nil || got.SoftwareVersion != "v2" {
+		t.Fatalf("GetBadge: %+v (err %v)", got, err)
+	}
+
+	// Verification is public and carries the signed JSON statement
+	cert, err := client.Verify(context.Background(), &badgesv1.VerifyRequest{CommitId: "grpc1234"})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if cert.Status != "valid" || cert.KeyId != signer.KeyID() || !signing.Verify(signer.PublicKey(), cert.Statement, cert.Signature) {
+		t.Errorf("expected a valid signed certificate, got %+v", cert)
+	}
+
+	if _, err := client.DeleteBadge(writer, &badgesv1.DeleteBadgeRequest{CommitId: "grpc1234"}); err != nil {
+		t.Fatalf("DeleteBadge: %v", err)
+	}
+	if _, err := client.GetBadge(writer, &badgesv1.GetBadgeRequest{CommitId: "grpc1234"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound after delete, got %v", err)
+	}
+	if _, err := client.Verify(context.Background(), &badgesv1.VerifyRequest{CommitId: "grpc1234"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound from Verify after delete, got %v", err)
+	}
+}
+
+func TestListBadges(t *testing.T) {
+	client, _ := setupTestClient(t)
+	writer := withKey("bk_writer")
+	for _, b := range []*badgesv1.Badge{
+		{CommitId: "list1234", Status: "valid", SoftwareName: "B"},
+		{CommitId: "list5678", Status: "revoked", SoftwareName: "A"},
+		{CommitId: "list9012", Status: "valid", SoftwareName: "C"},
+	} {
+		if _, err := client.CreateBadge(writer, &badgesv1.CreateBadgeRequest{Badge: b}); err != nil {
+			t.Fatalf("CreateBadge: %v", err)
+		}
+	}
+
+	stream, err := client.ListBadges(withKey("bk_reader"), &badgesv1.ListBadgesRequest{Status: "valid", Sort: "-software_name"})
+	if err != nil {
+		t.Fatalf("ListBadges: %v", err)
+	}
+	var names []string
+	for {
+		b, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		names = append(names, b.SoftwareName)
+	}
+	if len(names) != 2 || names[0] != "C" || names[1] != "B" {
+		t.Errorf("expected the valid badges by descending name, got %v", names)
+	}
+
+	stream, err = client.ListBadges(withKey("bk_reader"), &badgesv1.ListBadgesRequest{Sort: "bogus"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown sort, got %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	client, _ := setupTestClient(t)
+
+	for name, tc := range map[string]struct {
+		ctx  context.Context
+		want codes.Code
+	}{
+		"no key":      {context.Background(), codes.Unauthenticated},
+		"invalid key": {withKey("bk_unknown"), codes.Unauthenticated},
+		"read only":   {withKey("bk_reader"), codes.PermissionDenied},
+	} {
+		_, err := client.CreateBadge(tc.ctx, &badgesv1.CreateBadgeRequest{Badge: &badgesv1.Badge{CommitId: "auth1234"}})
+		if status.Code(err) != tc.want {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+
+	stream, err := client.ListBadges(context.Background(), &badgesv1.ListBadgesRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected streaming calls to require a key, got %v", err)
+	}
+}
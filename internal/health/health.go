@@ -0,0 +1,125 @@
+// Package health tracks whether the database can be read. While it cannot,
+// the server runs in degraded mode: image handlers serve the last images they
+// rendered from the cache, and /readyz reports the instance as not ready so
+// that load balancers can prefer healthy ones. /health only reports that the
+// process is up.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CheckInterval is how often the database is checked
+const CheckInterval = 5 * time.Second
+
+// Store is checked for being readable, e.g. *database.DB
+type Store interface {
+	Check() error
+}
+
+// Checker checks a store periodically and remembers the outcome
+type Checker struct {
+	db     Store
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu sync.RWMutex
+	// err is the error of the last check, nil while healthy
+	err error
+	// since is when the store became unreadable
+	since time.Time
+	// draining is set when the server shuts down
+	draining bool
+}
+
+// Status is the body of /readyz
+type Status struct {
+	Status string `json:"status"`
+	// Error and Since describe why and since when the instance is degraded
+	Error string     `json:"error,omitempty"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// NewChecker creates a checker of db, healthy until a check fails
+func NewChecker(db Store, logger *zap.Logger) *Checker {
+	return &Checker{db: db, logger: logger, now: time.Now}
+}
+
+// Check checks the store once and logs when degraded mode starts or ends
+func (c *Checker) Check() error {
+	err := c.db.Check()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err != nil && c.err == nil:
+		c.since = c.now()
+		c.logger.Error("health: database unavailable, serving cached images", zap.Error(err))
+	case err == nil && c.err != nil:
+		c.logger.Info("health: database available again", zap.Duration("degraded_for", c.now().Sub(c.since)))
+	}
+	c.err = err
+	return err
+}
+
+// Healthy reports whether the last check succeeded
+func (c *Checker) Healthy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err == nil
+}
+
+// SetDraining makes /readyz report the instance as draining from now on, so
+// that load balancers stop sending it requests before it shuts down
+func (c *Checker) SetDraining() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draining = true
+}
+
+// Run checks the store every CheckInterval until ctx is done
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check()
+		}
+	}
+}
+
+// Readyz serves /readyz: 200 while the database is readable, 503 in degraded
+// mode and while draining. The database is checked on every call rather than
+// reporting the last periodic check, so that recovery is seen at once.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	c.Check()
+
+	c.mu.RLock()
+	s := Status{Status: "ready"}
+	code := http.StatusOK
+	if c.err != nil {
+		since := c.since.UTC()
+		s = Status{Status: "degraded", Error: c.err.Error(), Since: &since}
+		code = http.StatusServiceUnavailable
+	}
+	if c.draining {
+		s = Status{Status: "draining"}
+		code = http.StatusServiceUnavailable
+	}
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
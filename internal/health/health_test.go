@@ -0,0 +1,56 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// store fails its checks while err is set
+type store struct {
+	err error
+}
+
+func (s *store) Check() error {
+	return s.err
+}
+
+func TestReadyz(t *testing.T) {
+	db := &store{}
+	c := NewChecker(db, zap.NewNop())
+
+	readyz := func() (int, Status) {
+		rec := httptest.NewRecorder()
+		c.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var s Status
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return rec.Code, s
+	}
+
+	if code, s := readyz(); code != http.StatusOK || s.Status != "ready" || !c.Healthy() {
+		t.Errorf("expected ready, got %d %+v", code, s)
+	}
+
+	db.err = errors.New("database is locked")
+	if code, s := readyz(); code != http.StatusServiceUnavailable || s.Status != "degraded" ||
+		s.Error != "database is locked" || s.Since == nil || c.Healthy() {
+		t.Errorf("expected degraded, got %d %+v", code, s)
+	}
+
+	db.err = nil
+	if c.Check() != nil || !c.Healthy() {
+		t.Error("expected the checker to recover")
+	}
+
+	// Draining instances are not ready, however healthy
+	c.SetDraining()
+	if code, s := readyz(); code != http.StatusServiceUnavailable || s.Status != "draining" || !c.Healthy() {
+		t.Errorf("expected draining, got %d %+v", code, s)
+	}
+}
@@ -1,10 +1,11 @@
 package home
 
 import (
-	"html/template"
 	"net/http"
 	"time"
 
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/auth"
 	"github.com/finki/badges/internal/cache"
 	"github.com/finki/badges/internal/database"
 	"github.com/finki/badges/internal/version"
@@ -16,6 +17,8 @@ type TemplateData struct {
 	CurrentYear int
 	Version     string
 	Commit      string
+	// CanCreate shows the link to the creation form to users with badges:write
+	CanCreate bool
 }
 
 // Handler handles home page requests
@@ -23,13 +26,13 @@ type Handler struct {
 	db       *database.DB
 	logger   *zap.Logger
 	cache    *cache.Cache
-	template *template.Template
+	template *assets.Template
 }
 
 // NewHandler creates a new home handler
 func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
 	// Parse the template
-	tmpl, err := template.ParseFiles("templates/home/index.html")
+	tmpl, err := assets.ParseTemplate("home/index.html")
 	if err != nil {
 		return nil, err
 	}
@@ -50,9 +53,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Signed-in users get their own links; only the public page is cached
+	canCreate := auth.GetClaimsFromContext(r.Context()) != nil && auth.HasPermission(r.Context(), "badges", "write")
+
 	// Try to get from cache first
 	cacheKey := "home:index"
-	if cachedData, found := h.cache.Get(cacheKey); found {
+	if cachedData, found := h.cache.Get(cacheKey); found && !canCreate {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Write(cachedData)
 		return
@@ -63,6 +69,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		CurrentYear: time.Now().Year(),
 		Version:     version.Version,
 		Commit:      version.Commit,
+		CanCreate:   canCreate,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
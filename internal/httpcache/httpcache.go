@@ -0,0 +1,170 @@
+// Package httpcache sets the client and CDN caching headers of rendered
+// images: a Cache-Control policy chosen per endpoint and badge status, and an
+// ETag so clients can revalidate with If-None-Match instead of downloading
+// the image again. Vary names the request headers a response was negotiated
+// on, and Query gives cache keys that do not depend on the order or spelling
+// of irrelevant query parameters.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// StatusPreview is the status of renders previewing another status; they
+	// are never stored by default
+	StatusPreview = "preview"
+	// Any matches every endpoint or status in a policy key
+	Any = "*"
+	// Stale is the Cache-Control of last-known-good images served while the
+	// database is unavailable: caches may keep them but must revalidate, so
+	// that fresh renders replace them once it is back
+	Stale = "no-cache"
+	// Private is the Cache-Control of renders previewing query overrides the
+	// public policy does not honor, which only their user may see
+	Private = "private, no-store"
+)
+
+// Endpoints and statuses policies can be configured for
+var (
+	endpoints = map[string]bool{"badge": true, "certificate": true, "composite": true, Any: true}
+	statuses  = map[string]bool{"valid": true, "expired": true, "revoked": true, StatusPreview: true, Any: true}
+)
+
+// Policies maps "<endpoint>:<status>" keys to Cache-Control values
+type Policies struct {
+	values map[string]string
+}
+
+// DefaultPolicies returns the policies used unless configured otherwise:
+// valid renders may be kept longer by shared caches and served stale while
+// revalidating, previews are never stored
+func DefaultPolicies() *Policies {
+	return &Policies{values: map[string]string{
+		"*:*":       "public, max-age=300",
+		"*:valid":   "public, max-age=300, s-maxage=3600, stale-while-revalidate=600",
+		"*:preview": "no-store",
+	}}
+}
+
+// ParsePolicies parses entries of the form "<endpoint>:<status>=<Cache-Control>"
+// separated by semicolons over the default policies, e.g.
+// "badge:valid=public, max-age=86400; *:revoked=no-cache". Endpoints are
+// badge, certificate and composite, statuses valid, expired, revoked and
+// preview; * matches any.
+func ParsePolicies(spec string) (*Policies, error) {
+	p := DefaultPolicies()
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid cache policy %q: expected <endpoint>:<status>=<Cache-Control>", entry)
+		}
+		key = strings.TrimSpace(key)
+		endpoint, status, ok := strings.Cut(key, ":")
+		if !ok || !endpoints[endpoint] || !statuses[status] {
+			return nil, fmt.Errorf("invalid cache policy key %q", key)
+		}
+		p.values[key] = strings.TrimSpace(value)
+	}
+	return p, nil
+}
+
+// CacheControl returns the Cache-Control value for an endpoint and badge
+// status, preferring the most specific policy
+func (p *Policies) CacheControl(endpoint, status string) string {
+	for _, key := range []string{endpoint + ":" + status, endpoint + ":" + Any, Any + ":" + status, Any + ":" + Any} {
+		if v, ok := p.values[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// ETag returns a strong entity tag for content
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ServeContent writes data with its content type, Cache-Control value and
+// ETag, or a 304 Not Modified response when the request's If-None-Match
+// already names the ETag
+func ServeContent(w http.ResponseWriter, r *http.Request, data []byte, contentType, cacheControl string) {
+	etag := ETag(data)
+	h := w.Header()
+	h.Set("ETag", etag)
+	if cacheControl != "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+	if r != nil && matches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// matches reports whether an If-None-Match header names etag; the comparison
+// is weak, as RFC 9110 requires for If-None-Match
+func matches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Vary adds headers to the Vary header of w, skipping those already named
+func Vary(w http.ResponseWriter, headers ...string) {
+	h := w.Header()
+	named := map[string]bool{}
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			named[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for _, name := range headers {
+		if name = http.CanonicalHeaderKey(name); !named[name] {
+			named[name] = true
+			h.Add("Vary", name)
+		}
+	}
+}
+
+// Query returns the parameters of q named in params in a canonical form for
+// cache keys: sorted by name, with the first value of each, as handlers read
+// it, and without empty values. Parameters that do not change a response, such
+// as tracking parameters or no_cache, are left out so they cannot multiply
+// the cached entries.
+func Query(q url.Values, params ...string) string {
+	names := make([]string, 0, len(params))
+	for _, name := range params {
+		if q.Get(name) != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(name))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(q.Get(name)))
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParsePolicies(t *testing.T) {
+	p, err := ParsePolicies("badge:valid=public, max-age=86400, immutable; *:revoked=no-cache")
+	if err != nil {
+		t.Fatalf("ParsePolicies: %v", err)
+	}
+	for _, tc := range []struct {
+		endpoint, status, want string
+	}{
+		{"badge", "valid", "public, max-age=86400, immutable"},
+		{"certificate", "valid", "public, max-age=300, s-maxage=3600, stale-while-revalidate=600"},
+		{"certificate", "revoked", "no-cache"},
+		{"composite", "", "public, max-age=300"},
+		{"badge", StatusPreview, "no-store"},
+	} {
+		if got := p.CacheControl(tc.endpoint, tc.status); got != tc.want {
+			t.Errorf("CacheControl(%s, %s) = %q, want %q", tc.endpoint, tc.status, got, tc.want)
+		}
+	}
+
+	for _, spec := range []string{"badge:valid", "badge=public", "page:valid=public", "badge:draft=public", "badge:valid= "} {
+		if _, err := ParsePolicies(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	data := []byte("<svg/>")
+	rec := httptest.NewRecorder()
+	ServeContent(rec, httptest.NewRequest(http.MethodGet, "/badge/abc123", nil), data, "image/svg+xml", "public, max-age=300")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != "<svg/>" || etag == "" || rec.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+
+	for header, want := range map[string]int{
+		etag:                 http.StatusNotModified,
+		`"other", W/` + etag: http.StatusNotModified,
+		"*":                  http.StatusNotModified,
+		`"other"`:            http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/badge/abc123", nil)
+		req.Header.Set("If-None-Match", header)
+		rec := httptest.NewRecorder()
+		ServeContent(rec, req, data, "image/svg+xml", "public, max-age=300")
+		if rec.Code != want {
+			t.Errorf("If-None-Match %s: expected %d, got %d", header, want, rec.Code)
+		}
+		if want == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag) {
+			t.Errorf("If-None-Match %s: expected an empty 304 with the ETag", header)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	params := []string{"theme", "style", "logo"}
+	for query, want := range map[string]string{
+		"style=flat&theme=dark":                         "style=flat&theme=dark",
+		"theme=dark&utm_source=x&style=flat&no_cache=1": "style=flat&theme=dark",
+		"theme=dark&theme=light&style=":                 "theme=dark",
+		"logo=https://example.org/a b.svg":              "logo=https%3A%2F%2Fexample.org%2Fa+b.svg",
+		"format=svg":                                    "",
+	} {
+		q, _ := url.ParseQuery(query)
+		if got := Query(q, params...); got != want {
+			t.Errorf("%s: expected %q, got %q", query, want, got)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Vary", "accept-encoding")
+	Vary(rec, "Accept", "Accept-Encoding")
+	Vary(rec, "accept")
+	if got := rec.Header().Values("Vary"); len(got) != 2 || got[1] != "Accept" {
+		t.Errorf("expected Accept added once, got %v", got)
+	}
+}
@@ -0,0 +1,21 @@
+// Package httpjson writes the JSON responses shared by the API handlers.
+package httpjson
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Write writes v as a JSON response with the given status
+func Write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Error writes a consistent JSON error response with a given HTTP status:
+//
+//	{"error": "message"}
+func Error(w http.ResponseWriter, status int, message string) {
+	Write(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,213 @@
+// Package issuer serves the public profile page of an issuer: who they are,
+// how to reach them, the key they sign with and the certificates they issued.
+package issuer
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/signing"
+	"github.com/finki/badges/internal/version"
+	"go.uber.org/zap"
+)
+
+// IDPattern limits issuer IDs to lowercase URL-safe slugs
+var IDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+
+// Profile is the public JSON representation of an issuer profile
+type Profile struct {
+	IssuerID  string `json:"issuer_id"`
+	Name      string `json:"name"`
+	URL       string `json:"url,omitempty"`
+	Logo      string `json:"logo,omitempty"`
+	Contact   string `json:"contact,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+	PageLink  string `json:"page_link"`
+}
+
+// Certificate is a badge issued by the issuer, as listed on its page
+type Certificate struct {
+	CertID          string `json:"cert_id"`
+	CertificateName string `json:"certificate_name,omitempty"`
+	SoftwareName    string `json:"software_name"`
+	SoftwareVersion string `json:"software_version"`
+	Status          string `json:"status"`
+	IssueDate       string `json:"issue_date"`
+	IsExpired       bool   `json:"is_expired"`
+	DetailsLink     string `json:"details_link"`
+}
+
+// Page is the JSON representation of the issuer page
+type Page struct {
+	Profile
+	Certificates []*Certificate `json:"certificates"`
+}
+
+// TemplateData represents the data passed to the issuer page template
+type TemplateData struct {
+	Page
+	CurrentYear int
+	Version     string
+	Commit      string
+}
+
+// LogoSrc returns the logo for an img src. html/template rejects data: URIs, so
+// those of images, which the issuer API only accepts, are passed through as is.
+func (d TemplateData) LogoSrc() template.URL {
+	if ValidLogo(d.Logo) {
+		return template.URL(d.Logo)
+	}
+	return ""
+}
+
+// ValidLogo reports whether logo is an https URL or an image data: URI
+func ValidLogo(logo string) bool {
+	return strings.HasPrefix(logo, "https://") || strings.HasPrefix(logo, "data:image/")
+}
+
+// Handler handles /issuer/{issuer_id} requests
+type Handler struct {
+	db       *database.DB
+	logger   *zap.Logger
+	cache    *cache.Cache
+	template *assets.Template
+}
+
+// NewHandler creates a new issuer page handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
+	tmpl, err := assets.ParseTemplate("issuer/issuer.html")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		db:       db,
+		logger:   logger,
+		cache:    cache,
+		template: tmpl,
+	}, nil
+}
+
+// NewProfile converts an issuer into its public representation. base is the
+// scheme and host links are made absolute with.
+func NewProfile(i *database.Issuer, base string) Profile {
+	p := Profile{
+		IssuerID: i.IssuerID,
+		Name:     i.Name,
+		URL:      i.URL.String,
+		Logo:     i.Logo.String,
+		Contact:  i.Contact.String,
+		PageLink: base + "/issuer/" + i.IssuerID,
+	}
+	if i.PublicKey.Valid {
+		p.PublicKey = i.PublicKey.String
+		if pub, err := signing.ParsePublicKeyPEM(i.PublicKey.String); err == nil {
+			p.KeyID = signing.KeyID(pub)
+		}
+	}
+	return p
+}
+
+// ServeHTTP handles HTTP requests for the issuer page
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	issuerID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/issuer/"), "/")
+	if !IDPattern.MatchString(issuerID) {
+		http.Error(w, "Invalid issuer ID", http.StatusBadRequest)
+		return
+	}
+
+	// Content negotiation: JSON vs HTML, with a ?format=json|html override
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "json":
+		wantsJSON = true
+	case "html":
+		wantsJSON = false
+	default:
+		httpcache.Vary(w, "Accept")
+	}
+
+	issuer, err := db.GetIssuer(issuerID)
+	if err != nil {
+		h.logger.Error("Failed to get issuer", zap.Error(err), zap.String("issuer_id", issuerID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if issuer == nil {
+		http.Error(w, "Issuer not found", http.StatusNotFound)
+		return
+	}
+
+	badges, err := db.ListBadgesByIssuer(issuerID)
+	if err != nil {
+		h.logger.Error("Failed to list issuer badges", zap.Error(err), zap.String("issuer_id", issuerID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Drafts are only listed for users with badges:write
+	canSeeDrafts := false
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
+		canSeeDrafts = claims.Permissions.Allows("badges", "write")
+	}
+
+	base := links.ForRequest(r)
+	page := Page{Profile: NewProfile(issuer, base), Certificates: []*Certificate{}}
+	for _, b := range badges {
+		// Organization admins only see the drafts of their own organization
+		if !b.IsPublished() && !(canSeeDrafts && auth.CanAccessOrg(r.Context(), b.OrgID.String)) {
+			continue
+		}
+		c := &Certificate{
+			CertID:          b.CommitID,
+			SoftwareName:    b.SoftwareName,
+			SoftwareVersion: b.SoftwareVersion,
+			Status:          string(b.Status),
+			IssueDate:       database.FormatDate(b.IssueDate),
+			IsExpired:       b.IsExpired(),
+			DetailsLink:     base + "/details/" + b.CommitID,
+		}
+		if b.CertificateName.Valid {
+			c.CertificateName = b.CertificateName.String
+		}
+		page.Certificates = append(page.Certificates, c)
+	}
+
+	if wantsJSON {
+		payload, err := json.Marshal(page)
+		if err != nil {
+			h.logger.Error("Failed to marshal issuer JSON", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(payload)
+		return
+	}
+
+	data := TemplateData{
+		Page:        page,
+		CurrentYear: time.Now().Year(),
+		Version:     version.Version,
+		Commit:      version.Commit,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.template.Execute(w, data); err != nil {
+		h.logger.Error("Failed to render template", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
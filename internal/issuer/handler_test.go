@@ -0,0 +1,90 @@
+package issuer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestIssuerPage(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "issuer.db")
+	// Templates are loaded relative to the repository root
+	t.Chdir("../..")
+
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if err := db.CreateIssuer(&database.Issuer{
+		IssuerID:  "geant",
+		Name:      "GÉANT",
+		Logo:      sql.NullString{String: "data:image/png;base64,iVBORw0KGgo=", Valid: true},
+		Contact:   sql.NullString{String: "certs@geant.org", Valid: true},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+	linked := sql.NullString{String: "geant", Valid: true}
+	for _, b := range []*database.Badge{
+		{CommitID: "valid12", Status: "valid", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), IssuerID: linked},
+		{CommitID: "draft12", Status: "draft", IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), IssuerID: linked},
+		{CommitID: "other12", Status: "valid", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		b.Type, b.Issuer, b.SoftwareName, b.SoftwareVersion = "badge", "GÉANT", "eduTEAMS", "v1.0.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/issuer/geant?format=json", nil))
+	var page Page
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if page.Name != "GÉANT" || page.PageLink != "http://example.com/issuer/geant" {
+		t.Errorf("Unexpected profile %+v", page.Profile)
+	}
+	if len(page.Certificates) != 1 || page.Certificates[0].CertID != "valid12" {
+		t.Errorf("Expected only the public linked certificate, got %+v", page.Certificates)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/issuer/geant", nil))
+	body := rec.Body.String()
+	for _, want := range []string{`src="data:image/png;base64,iVBORw0KGgo="`, "certs@geant.org", `href="/details/valid12"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+
+	for url, status := range map[string]int{
+		"/issuer/unknown":  http.StatusNotFound,
+		"/issuer/Bad%20ID": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d", url, status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package issuerapi manages issuer profiles over a JSON API. Badges link to a
+// profile through their issuer_id, which keeps the issuer's name and URL in
+// one place.
+package issuerapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/issuer"
+	"github.com/finki/badges/internal/signing"
+	"go.uber.org/zap"
+)
+
+// Issuer is the JSON representation of an issuer profile
+type Issuer struct {
+	IssuerID  string `json:"issuer_id"`
+	Name      string `json:"name"`
+	URL       string `json:"url,omitempty"`
+	Logo      string `json:"logo,omitempty"`
+	Contact   string `json:"contact,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+	// Timezone is the IANA timezone, e.g. Europe/Amsterdam, in which the
+	// expiry dates of the issuer's badges end; UTC if empty
+	Timezone  string    `json:"timezone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UpdateRequest changes the fields present in the request body; "" clears an
+// optional field
+type UpdateRequest struct {
+	Name      *string `json:"name,omitempty"`
+	URL       *string `json:"url,omitempty"`
+	Logo      *string `json:"logo,omitempty"`
+	Contact   *string `json:"contact,omitempty"`
+	PublicKey *string `json:"public_key,omitempty"`
+	Timezone  *string `json:"timezone,omitempty"`
+}
+
+// Handler serves /api/issuers and /api/issuers/{id}
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+}
+
+// NewHandler creates a new issuer API handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// ServeHTTP dispatches on method and path. Issuers are part of what a badge
+// states, so they are guarded by the badges permissions.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/issuers"), "/")
+	if strings.Contains(id, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", http.HandlerFunc(h.create))
+	case r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withIssuer(id, h.get))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withIssuer(id, h.update))
+	case r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", h.withIssuer(id, h.delete))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// withIssuer loads the issuer before calling fn
+func (h *Handler) withIssuer(id string, fn func(http.ResponseWriter, *http.Request, *database.Issuer)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !issuer.IDPattern.MatchString(id) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid issuer ID")
+			return
+		}
+		i, err := h.db.WithContext(r.Context()).GetIssuer(id)
+		if err != nil {
+			h.logger.Error("issuerapi: failed to get issuer", zap.String("issuer_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get issuer")
+			return
+		}
+		if i == nil {
+			httpjson.Error(w, http.StatusNotFound, "Issuer not found")
+			return
+		}
+		fn(w, r, i)
+	})
+}
+
+// list returns all issuer profiles
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	issuers, err := h.db.WithContext(r.Context()).ListIssuers()
+	if err != nil {
+		h.logger.Error("issuerapi: failed to list issuers", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list issuers")
+		return
+	}
+
+	resp := make([]Issuer, 0, len(issuers))
+	for _, i := range issuers {
+		resp = append(resp, ToJSON(i))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single issuer profile
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, i *database.Issuer) {
+	httpjson.Write(w, http.StatusOK, ToJSON(i))
+}
+
+// create validates and stores a new issuer profile
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req Issuer
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !issuer.IDPattern.MatchString(req.IssuerID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid issuer ID: use 2-63 lowercase letters, digits, - or _")
+		return
+	}
+
+	existing, err := db.GetIssuer(req.IssuerID)
+	if err != nil {
+		h.logger.Error("issuerapi: failed to get issuer", zap.String("issuer_id", req.IssuerID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create issuer")
+		return
+	}
+	if existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Issuer already exists")
+		return
+	}
+
+	now := time.Now()
+	i := &database.Issuer{
+		IssuerID:  req.IssuerID,
+		Name:      strings.TrimSpace(req.Name),
+		URL:       toNull(req.URL),
+		Logo:      toNull(req.Logo),
+		Contact:   toNull(req.Contact),
+		PublicKey: toNull(req.PublicKey),
+		Timezone:  toNull(req.Timezone),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := validate(i); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := db.CreateIssuer(i); err != nil {
+		h.logger.Error("issuerapi: failed to create issuer", zap.String("issuer_id", i.IssuerID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create issuer")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, ToJSON(i))
+}
+
+// update applies the fields present in the request body; a new name or URL is
+// copied to the linked badges
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, i *database.Issuer) {
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		i.Name = strings.TrimSpace(*req.Name)
+	}
+	for _, f := range []struct {
+		dst *sql.NullString
+		v   *string
+	}{{&i.URL, req.URL}, {&i.Logo, req.Logo}, {&i.Contact, req.Contact}, {&i.PublicKey, req.PublicKey}, {&i.Timezone, req.Timezone}} {
+		if f.v != nil {
+			*f.dst = toNull(*f.v)
+		}
+	}
+	if err := validate(i); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	i.UpdatedAt = time.Now()
+	if err := h.db.WithContext(r.Context()).UpdateIssuer(i); err != nil {
+		h.logger.Error("issuerapi: failed to update issuer", zap.String("issuer_id", i.IssuerID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update issuer")
+		return
+	}
+
+	h.invalidate(i.IssuerID)
+	httpjson.Write(w, http.StatusOK, ToJSON(i))
+}
+
+// delete removes an issuer profile; its badges are unlinked but keep their
+// issuer name and URL
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, i *database.Issuer) {
+	h.invalidate(i.IssuerID)
+	if err := h.db.WithContext(r.Context()).DeleteIssuer(i.IssuerID); err != nil {
+		h.logger.Error("issuerapi: failed to delete issuer", zap.String("issuer_id", i.IssuerID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete issuer")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidate drops the cached renders and pages of the issuer's badges
+func (h *Handler) invalidate(issuerID string) {
+	badges, err := h.db.ListBadgesByIssuer(issuerID)
+	if err != nil {
+		h.logger.Error("issuerapi: failed to list issuer badges", zap.String("issuer_id", issuerID), zap.Error(err))
+		return
+	}
+	for _, b := range badges {
+		h.cache.DeletePrefix("badge:" + b.CommitID + ":")
+		h.cache.DeletePrefix("certificate:" + b.CommitID + ":")
+		h.cache.Delete("details:" + b.CommitID)
+	}
+	h.cache.DeletePrefix("badges:list:")
+	h.cache.Delete("home:index")
+}
+
+// validate checks the fields of an issuer profile
+func validate(i *database.Issuer) error {
+	if i.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if i.URL.Valid {
+		u, err := url.Parse(i.URL.String)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+	}
+	if i.Logo.Valid && !issuer.ValidLogo(i.Logo.String) {
+		return fmt.Errorf("logo must be an https URL or an image data: URI")
+	}
+	if i.PublicKey.Valid {
+		if _, err := signing.ParsePublicKeyPEM(i.PublicKey.String); err != nil {
+			return fmt.Errorf("invalid public_key: %w", err)
+		}
+	}
+	if i.Timezone.Valid {
+		if _, err := database.LoadTimezone(i.Timezone.String); err != nil {
+			return fmt.Errorf("timezone must be an IANA timezone such as Europe/Amsterdam")
+		}
+	}
+	return nil
+}
+
+// ToJSON converts a database issuer to its API representation
+func ToJSON(i *database.Issuer) Issuer {
+	profile := issuer.NewProfile(i, "")
+	return Issuer{
+		IssuerID:  i.IssuerID,
+		Name:      i.Name,
+		URL:       profile.URL,
+		Logo:      profile.Logo,
+		Contact:   profile.Contact,
+		PublicKey: profile.PublicKey,
+		KeyID:     profile.KeyID,
+		Timezone:  i.Timezone.String,
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+	}
+}
+
+func toNull(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
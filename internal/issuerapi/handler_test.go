@@ -0,0 +1,98 @@
+package issuerapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/signing"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestIssuerLifecycle(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+
+	signer, _, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "issuer.key"))
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/issuers", Issuer{
+		IssuerID:  "geant",
+		Name:      "GÉANT",
+		URL:       "https://geant.org",
+		PublicKey: signer.PublicKeyPEM(),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Issuer
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.KeyID != signer.KeyID() {
+		t.Errorf("expected key ID %s, got %q", signer.KeyID(), created.KeyID)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/issuers", Issuer{IssuerID: "geant", Name: "Again"}); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate issuer, got %d", rec.Code)
+	}
+
+	badge := &database.Badge{
+		CommitID: "linked1", Type: "badge", Status: "valid", Issuer: "GEANT (old)", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "App", SoftwareVersion: "v1", IssuerID: sql.NullString{String: "geant", Valid: true},
+	}
+	if err := db.CreateBadge(badge); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+
+	name := "GÉANT Association"
+	if rec := testutil.Serve(h, ctx, http.MethodPatch, "/api/issuers/geant", UpdateRequest{Name: &name}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	got, _ := db.GetBadge("linked1")
+	if got.Issuer != name || got.IssuerURL.String != "https://geant.org" {
+		t.Errorf("expected the linked badge to take the issuer's name and URL, got %q %q", got.Issuer, got.IssuerURL.String)
+	}
+
+	if rec := testutil.Serve(h, ctx, http.MethodDelete, "/api/issuers/geant", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	got, _ = db.GetBadge("linked1")
+	if got.IssuerID.Valid || got.Issuer != name {
+		t.Errorf("expected the badge to be unlinked and keep its issuer, got %+v", got.IssuerID)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/issuers/geant", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestIssuerValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	for name, req := range map[string]Issuer{
+		"bad id":    {IssuerID: "Bad ID", Name: "x"},
+		"no name":   {IssuerID: "acme"},
+		"bad url":   {IssuerID: "acme", Name: "Acme", URL: "ftp://acme.org"},
+		"bad logo":  {IssuerID: "acme", Name: "Acme", Logo: "javascript:alert(1)"},
+		"bad key":   {IssuerID: "acme", Name: "Acme", PublicKey: "not a key"},
+		"http logo": {IssuerID: "acme", Name: "Acme", Logo: "http://acme.org/logo.png"},
+		"bad tz":    {IssuerID: "acme", Name: "Acme", Timezone: "Mars/Olympus"},
+		"local tz":  {IssuerID: "acme", Name: "Acme", Timezone: "Local"},
+	} {
+		if rec := testutil.Serve(h, ctx, http.MethodPost, "/api/issuers", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+
+	if rec := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodPost, "/api/issuers", Issuer{IssuerID: "acme", Name: "Acme"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without write permission, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// defaultLimit and maxLimit bound the jobs listed by /api/admin/jobs
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// JobJSON is the API representation of a job
+type JobJSON struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	State       string          `json:"state"`
+	Payload     json.RawMessage `json:"payload"`
+	Progress    json.RawMessage `json:"progress,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// ToJSON converts a database job to its API representation
+func ToJSON(j *database.Job) JobJSON {
+	resp := JobJSON{
+		ID:          j.JobID,
+		Kind:        j.Kind,
+		State:       j.State,
+		Payload:     json.RawMessage(j.Payload),
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		LastError:   j.LastError.String,
+		RunAt:       j.RunAt,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+	}
+	if j.Progress.Valid {
+		resp.Progress = json.RawMessage(j.Progress.String)
+	}
+	if j.FinishedAt.Valid {
+		resp.FinishedAt = &j.FinishedAt.Time
+	}
+	return resp
+}
+
+// ServeHTTP serves the job API:
+//
+//	GET  /api/admin/jobs               job counts per state and the newest jobs
+//	                                   (?kind=, ?state=, ?limit=)
+//	GET  /api/admin/jobs/{id}          a job and its progress
+//	POST /api/admin/jobs/{id}/retry    queue a dead job again (users:write)
+//
+// Jobs belong to the whole instance, so organization-scoped callers are
+// refused.
+func (q *Queue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		httpjson.Error(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/jobs"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		q.list(w, r)
+		return
+	}
+
+	idPart, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		httpjson.Error(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		q.get(w, r, id)
+	case action == "retry" && r.Method == http.MethodPost:
+		if !auth.HasPermission(r.Context(), "users", "write") {
+			httpjson.Error(w, http.StatusForbidden, "Forbidden: insufficient permissions")
+			return
+		}
+		q.retry(w, r, id)
+	case action == "" || action == "retry":
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// list lists the newest jobs with the job counts per state
+func (q *Queue) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			httpjson.Error(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLimit))
+			return
+		}
+		limit = n
+	}
+
+	db := q.db.WithContext(r.Context())
+	jobs, err := db.ListJobs(query.Get("kind"), query.Get("state"), limit)
+	if err != nil {
+		q.logger.Error("jobs: failed to list jobs", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+	counts, err := db.CountJobs()
+	if err != nil {
+		q.logger.Error("jobs: failed to count jobs", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+
+	resp := struct {
+		Counts map[string]int `json:"counts"`
+		Jobs   []JobJSON      `json:"jobs"`
+	}{Counts: counts, Jobs: make([]JobJSON, 0, len(jobs))}
+	for _, j := range jobs {
+		resp.Jobs = append(resp.Jobs, ToJSON(j))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a job
+func (q *Queue) get(w http.ResponseWriter, r *http.Request, id int64) {
+	job, err := q.db.WithContext(r.Context()).GetJob(id)
+	if err != nil {
+		q.logger.Error("jobs: failed to get job", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+	if job == nil {
+		httpjson.Error(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	httpjson.Write(w, http.StatusOK, ToJSON(job))
+}
+
+// retry queues a dead job again
+func (q *Queue) retry(w http.ResponseWriter, r *http.Request, id int64) {
+	ok, err := q.db.WithContext(r.Context()).RetryJob(id, time.Now())
+	if err != nil {
+		q.logger.Error("jobs: failed to retry job", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to retry job")
+		return
+	}
+	if !ok {
+		httpjson.Error(w, http.StatusConflict, "Only dead jobs can be retried")
+		return
+	}
+	q.notify()
+	q.get(w, r, id)
+}
@@ -0,0 +1,320 @@
+// Package jobs runs background work from a queue kept in the database, so
+// that queued work survives restarts. A pool of workers claims due jobs under
+// a lease and runs the handler registered for their kind. Failing jobs are
+// retried with exponential backoff and, after MaxAttempts runs or a
+// Permanent error, moved to the dead jobs for an administrator to inspect
+// and retry through /api/admin/jobs.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultWorkers is the size of the worker pool unless configured
+	DefaultWorkers = 2
+	// MaxAttempts is how often a failing job is run before it is dead
+	MaxAttempts = 5
+	// PollInterval is how often idle workers look for due jobs
+	PollInterval = 5 * time.Second
+	// Lease is how long a job may run without reporting progress before
+	// another worker takes it over
+	Lease = 10 * time.Minute
+	// Retention is how long finished jobs are kept
+	Retention = 7 * 24 * time.Hour
+
+	// retryBase and retryMax bound the backoff between attempts
+	retryBase = 30 * time.Second
+	retryMax  = time.Hour
+)
+
+// ErrUnknownKind is returned by Enqueue for kinds without a handler
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// permanentError is an error retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the job is dead at once, e.g.
+// when its payload is invalid
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Job is a job passed to its handler
+type Job struct {
+	*database.Job
+	queue *Queue
+}
+
+// Decode unmarshals the payload of the job into v
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal([]byte(j.Payload), v); err != nil {
+		return Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	return nil
+}
+
+// Report records v as the progress of the job, shown by /api/admin/jobs,
+// and extends its lease
+func (j *Job) Report(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		j.queue.logger.Error("jobs: failed to encode progress", zap.Int64("job", j.JobID), zap.Error(err))
+		return
+	}
+	now := time.Now()
+	progress := sql.NullString{String: string(data), Valid: true}
+	if err := j.queue.db.ExtendJob(j.JobID, progress, now.Add(Lease), now); err != nil {
+		j.queue.logger.Error("jobs: failed to report progress", zap.Int64("job", j.JobID), zap.Error(err))
+	}
+}
+
+// Handler runs a job. Returned errors are retried unless Permanent.
+type Handler func(ctx context.Context, job *Job) error
+
+// Queue is the job queue and its worker pool
+type Queue struct {
+	db      *database.DB
+	logger  *zap.Logger
+	workers int
+	// wake tells an idle worker that a job was queued
+	wake chan struct{}
+	// draining is closed by Drain to stop the workers claiming jobs
+	draining  chan struct{}
+	drainOnce sync.Once
+	// running counts the workers of Run, which Drain waits for
+	running sync.WaitGroup
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// New creates a queue run by the given number of workers
+func New(db *database.DB, logger *zap.Logger, workers int) *Queue {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	return &Queue{
+		db:       db,
+		logger:   logger,
+		workers:  workers,
+		wake:     make(chan struct{}, 1),
+		draining: make(chan struct{}),
+		handlers: map[string]Handler{},
+	}
+}
+
+// Register makes h run the jobs of a kind
+func (q *Queue) Register(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// handler returns the handler of a kind
+func (q *Queue) handler(kind string) (Handler, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	h, ok := q.handlers[kind]
+	return h, ok
+}
+
+// Enqueue queues a job of a registered kind with payload encoded as JSON
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}) (*database.Job, error) {
+	if _, ok := q.handler(kind); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &database.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		MaxAttempts: MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := q.db.WithContext(ctx).CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return job, nil
+}
+
+// notify wakes an idle worker to look for due jobs
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the worker pool until ctx is done. Jobs running then are queued
+// again for the next start.
+func (q *Queue) Run(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		q.running.Add(1)
+		go func() {
+			defer q.running.Done()
+			q.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		q.prune(time.Now())
+		select {
+		case <-ctx.Done():
+			q.running.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain stops the workers claiming jobs, so that jobs queued from now on
+// are left for the next start, and waits until the running jobs are done or
+// ctx is done. Jobs still running when Run's context is then canceled are
+// queued again for the next start.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.drainOnce.Do(func() { close(q.draining) })
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prune removes the jobs finished before the retention period
+func (q *Queue) prune(now time.Time) {
+	n, err := q.db.DeleteFinishedJobs(now.Add(-Retention))
+	if err != nil {
+		q.logger.Error("jobs: failed to prune finished jobs", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		q.logger.Debug("jobs: pruned finished jobs", zap.Int64("count", n))
+	}
+}
+
+// work runs due jobs one after another until ctx is done
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil && !q.isDraining() && q.RunNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.draining:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// isDraining reports whether Drain was called
+func (q *Queue) isDraining() bool {
+	select {
+	case <-q.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// RunNext runs the next due job, if any, and reports whether there was one
+func (q *Queue) RunNext(ctx context.Context) bool {
+	dbJob, err := q.db.ClaimJob(time.Now(), Lease)
+	if err != nil {
+		q.logger.Error("jobs: failed to claim job", zap.Error(err))
+		return false
+	}
+	if dbJob == nil {
+		return false
+	}
+
+	log := q.logger.With(zap.Int64("job", dbJob.JobID), zap.String("kind", dbJob.Kind), zap.Int("attempt", dbJob.Attempts))
+	err = q.run(ctx, &Job{Job: dbJob, queue: q})
+	now := time.Now()
+	switch {
+	case err == nil:
+		if err := q.db.FinishJob(dbJob.JobID, now); err != nil {
+			log.Error("jobs: failed to finish job", zap.Error(err))
+		}
+		log.Info("jobs: job done")
+	case ctx.Err() != nil:
+		// Stopping; the job is run again on the next start
+		if err := q.db.ReleaseJob(dbJob.JobID, now); err != nil {
+			log.Error("jobs: failed to release job", zap.Error(err))
+		}
+	default:
+		var permanent *permanentError
+		dead := errors.As(err, &permanent) || dbJob.Attempts >= dbJob.MaxAttempts
+		retryAt := now.Add(Backoff(dbJob.Attempts))
+		if err := q.db.FailJob(dbJob.JobID, err.Error(), retryAt, dead, now); err != nil {
+			log.Error("jobs: failed to record job failure", zap.Error(err))
+		}
+		if dead {
+			log.Error("jobs: job dead", zap.Error(err))
+		} else {
+			log.Warn("jobs: job failed, retrying", zap.Error(err), zap.Time("retry_at", retryAt))
+		}
+	}
+	return true
+}
+
+// run runs the handler of job, turning panics into errors
+func (q *Queue) run(ctx context.Context, job *Job) (err error) {
+	h, ok := q.handler(job.Kind)
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// Backoff is the wait before the next run of a job that failed its attempt-th
+// run: 30s doubling per attempt, at most an hour
+func Backoff(attempt int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempt && d < retryMax; i++ {
+		d *= 2
+	}
+	if d > retryMax {
+		d = retryMax
+	}
+	return d
+}
@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func newQueue(t *testing.T) (*Queue, *database.DB) {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "jobs.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, zap.NewNop(), 1), db
+}
+
+func TestQueue(t *testing.T) {
+	q, db := newQueue(t)
+	ctx := context.Background()
+
+	var got struct{ Name string }
+	q.Register("greet", func(ctx context.Context, job *Job) error {
+		if err := job.Decode(&got); err != nil {
+			return err
+		}
+		job.Report(map[string]int{"done": 1})
+		return nil
+	})
+	if _, err := q.Enqueue(ctx, "unknown", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("expected ErrUnknownKind, got %v", err)
+	}
+
+	job, err := q.Enqueue(ctx, "greet", map[string]string{"name": "alice"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if !q.RunNext(ctx) {
+		t.Fatal("expected the job to run")
+	}
+	if q.RunNext(ctx) {
+		t.Error("expected no other job to run")
+	}
+	if got.Name != "alice" {
+		t.Errorf("expected the payload to be decoded, got %+v", got)
+	}
+
+	done, err := db.GetJob(job.JobID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if done.State != database.JobDone || done.Attempts != 1 || done.Progress.String != `{"done":1}` || !done.FinishedAt.Valid {
+		t.Errorf("unexpected finished job %+v", done)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	q, db := newQueue(t)
+	ctx := context.Background()
+
+	runs := 0
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		runs++
+		return errors.New("upstream unavailable")
+	})
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		return Permanent(errors.New("invalid payload"))
+	})
+	q.Register("panics", func(ctx context.Context, job *Job) error {
+		panic("boom")
+	})
+
+	flaky, _ := q.Enqueue(ctx, "flaky", nil)
+	q.RunNext(ctx)
+	job, _ := db.GetJob(flaky.JobID)
+	if job.State != database.JobQueued || job.LastError.String != "upstream unavailable" || time.Until(job.RunAt) < 20*time.Second {
+		t.Fatalf("expected the job to be retried with backoff, got %+v", job)
+	}
+	if q.RunNext(ctx) {
+		t.Fatal("expected the retry to wait for its backoff")
+	}
+
+	// Run the remaining attempts without waiting
+	for i := 1; i < MaxAttempts; i++ {
+		if err := db.FailJob(flaky.JobID, "upstream unavailable", time.Now(), false, time.Now()); err != nil {
+			t.Fatalf("FailJob: %v", err)
+		}
+		q.RunNext(ctx)
+	}
+	job, _ = db.GetJob(flaky.JobID)
+	if runs != MaxAttempts || job.State != database.JobDead {
+		t.Fatalf("expected the job dead after %d runs, got %d runs and %+v", MaxAttempts, runs, job)
+	}
+
+	// Permanent errors kill a job at once; panics are retried like errors
+	for kind, state := range map[string]string{"broken": database.JobDead, "panics": database.JobQueued} {
+		j, _ := q.Enqueue(ctx, kind, nil)
+		q.RunNext(ctx)
+		if job, _ := db.GetJob(j.JobID); job.State != state || job.LastError.String == "" {
+			t.Errorf("expected the %s job %s with its error, got %+v", kind, state, job)
+		}
+	}
+
+	// Dead jobs run again once retried
+	if ok, err := db.RetryJob(flaky.JobID, time.Now()); !ok || err != nil {
+		t.Fatalf("RetryJob: %v %v", ok, err)
+	}
+	if !q.RunNext(ctx) || runs != MaxAttempts+1 {
+		t.Error("expected the retried job to run")
+	}
+}
+
+func TestQueueReleasesJobsOnShutdown(t *testing.T) {
+	q, db := newQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		cancel()
+		return ctx.Err()
+	})
+	j, _ := q.Enqueue(context.Background(), "slow", nil)
+	q.RunNext(ctx)
+	if job, _ := db.GetJob(j.JobID); job.State != database.JobQueued || job.Attempts != 0 {
+		t.Errorf("expected the interrupted job to be queued again, got %+v", job)
+	}
+}
+
+func TestQueueDrain(t *testing.T) {
+	q, db := newQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	q.Register("render", func(ctx context.Context, job *Job) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	running, _ := q.Enqueue(ctx, "render", nil)
+	go q.Run(ctx)
+	<-started
+
+	// Draining waits for the running job, which may finish
+	short, stop := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer stop()
+	if err := q.Drain(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Drain to wait for the running job, got %v", err)
+	}
+	queued, _ := q.Enqueue(ctx, "render", nil)
+	close(release)
+	if err := q.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if job, _ := db.GetJob(running.JobID); job.State != database.JobDone {
+		t.Errorf("expected the running job to finish, got %+v", job)
+	}
+	if job, _ := db.GetJob(queued.JobID); job.State != database.JobQueued {
+		t.Errorf("expected the job queued while draining to be left for the next start, got %+v", job)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: time.Hour} {
+		if got := Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	q, db := newQueue(t)
+	ctx := context.Background()
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		return Permanent(errors.New("invalid payload"))
+	})
+	j, _ := q.Enqueue(ctx, "broken", map[string]string{"id": "abc123"})
+	q.RunNext(ctx)
+
+	reader := &auth.Claims{UserID: "reader"}
+	reader.Permissions = database.Permissions{"users": {"read": true}}
+	admin := &auth.Claims{UserID: "admin"}
+	admin.Permissions = database.Permissions{"users": {"write": true}}
+	serve := func(method, target string, claims *auth.Claims) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), claims))
+		rec := httptest.NewRecorder()
+		q.ServeHTTP(rec, r)
+		return rec
+	}
+
+	var list struct {
+		Counts map[string]int `json:"counts"`
+		Jobs   []JobJSON      `json:"jobs"`
+	}
+	rec := serve(http.MethodGet, "/api/admin/jobs?state=dead", reader)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode jobs: %v", err)
+	}
+	if list.Counts[database.JobDead] != 1 || len(list.Jobs) != 1 || list.Jobs[0].LastError != "invalid payload" ||
+		string(list.Jobs[0].Payload) != `{"id":"abc123"}` {
+		t.Errorf("unexpected job list %s", rec.Body.String())
+	}
+
+	if rec := serve(http.MethodGet, "/api/admin/jobs/99", reader); rec.Code != http.StatusNotFound {
+		t.Errorf("expected unknown jobs to be 404, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/api/admin/jobs/1/retry", reader); rec.Code != http.StatusForbidden {
+		t.Errorf("expected retries to need users:write, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/api/admin/jobs/1/retry", admin); rec.Code != http.StatusOK {
+		t.Errorf("expected the dead job to be retried, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if job, _ := db.GetJob(j.JobID); job.State != database.JobQueued {
+		t.Errorf("expected the retried job to be queued, got %s", job.State)
+	}
+	if rec := serve(http.MethodPost, "/api/admin/jobs/1/retry", admin); rec.Code != http.StatusConflict {
+		t.Errorf("expected only dead jobs to be retried, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/api/admin/jobs", &auth.Claims{UserID: "org-admin", OrgID: "org"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected organization-scoped callers to be refused, got %d", rec.Code)
+	}
+}
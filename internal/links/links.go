@@ -0,0 +1,223 @@
+// Package links builds the absolute URLs of the service's pages. BASE_URL sets
+// the public address; without it, links follow the host a request was made
+// to, which the client controls, and links built outside a request use the
+// production address.
+// PATH_PREFIX, or the path of BASE_URL, serves the service below a path such
+// as /certificates behind a reverse proxy.
+package links
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultBase is the production address, used outside requests when no base
+// URL is configured
+const DefaultBase = "https://certificates.software.geant.org"
+
+var (
+	mu         sync.RWMutex
+	configured string
+	prefix     string
+	// fromProxy reports whether a request came through a trusted proxy,
+	// whose X-Forwarded-Proto is believed
+	fromProxy func(r *http.Request) bool
+)
+
+// Parse checks a base URL: an absolute http(s) URL without query or fragment.
+// It returns the URL without a trailing slash.
+func Parse(base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("expected an http(s) URL such as %s", DefaultBase)
+	}
+	return strings.TrimRight(base, "/"), nil
+}
+
+// SetBase makes base the address of every absolute link; "" derives it from
+// the request again. base must have passed Parse.
+func SetBase(base string) {
+	mu.Lock()
+	defer mu.Unlock()
+	configured = strings.TrimRight(base, "/")
+}
+
+// ParsePrefix checks a path prefix such as /certificates. It returns the
+// prefix without a trailing slash; "" and "/" serve the service at the root.
+func ParsePrefix(p string) (string, error) {
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(p, "/") || strings.Contains(p, "//") || strings.ContainsAny(p, "?#% ") {
+		return "", fmt.Errorf("expected a path such as /certificates")
+	}
+	return p, nil
+}
+
+// SetPrefix serves the service below prefix; "" uses the path of the base
+// URL. prefix must have passed ParsePrefix.
+func SetPrefix(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	prefix = strings.TrimRight(p, "/")
+}
+
+// Prefix returns the path the service is served below, "" at the root
+func Prefix() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return currentPrefix()
+}
+
+// currentPrefix returns the configured prefix or the path of the base URL.
+// mu must be held.
+func currentPrefix() string {
+	if prefix != "" || configured == "" {
+		return prefix
+	}
+	u, err := url.Parse(configured)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// Path returns the root-relative path p below the prefix, e.g. for links in
+// pages and redirects
+func Path(p string) string {
+	return Prefix() + p
+}
+
+// Base returns the configured base URL, or DefaultBase without one, below
+// the prefix. It is used for links built outside a request, such as
+// notifications.
+func Base() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if configured != "" {
+		return withPrefix(configured)
+	}
+	return DefaultBase + currentPrefix()
+}
+
+// withPrefix appends the prefix to base unless base already ends with it.
+// mu must be held.
+func withPrefix(base string) string {
+	p := currentPrefix()
+	if strings.HasSuffix(base, p) {
+		return base
+	}
+	return base + p
+}
+
+// SetTrustedProxy makes ForRequest honour X-Forwarded-Proto on the requests
+// for which fromTrusted reports true; without it the header is ignored
+func SetTrustedProxy(fromTrusted func(r *http.Request) bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	fromProxy = fromTrusted
+}
+
+// ForRequest returns the configured base URL, or the scheme and host r was
+// made to, honouring a trusted TLS terminating proxy, below the prefix
+func ForRequest(r *http.Request) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if configured != "" {
+		return withPrefix(configured)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); (proto == "http" || proto == "https") && fromProxy != nil && fromProxy(r) {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + currentPrefix()
+}
+
+// StripPrefix serves next below the prefix: it removes the prefix from the
+// request path, redirects the bare prefix to its trailing-slash form, answers
+// requests outside it with 404 and adds the prefix to root-relative Location
+// headers of the response
+func StripPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := Prefix()
+		if p == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == p {
+			target := p + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, p+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, p)
+		r2.URL.RawPath = ""
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, p)
+		}
+		next.ServeHTTP(&prefixWriter{ResponseWriter: w, prefix: p}, r2)
+	})
+}
+
+// prefixWriter adds the prefix to a root-relative Location header before the
+// response header is written
+type prefixWriter struct {
+	http.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (w *prefixWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			h.Set("Location", w.prefix+loc)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed responses through
+func (w *prefixWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the underlying writer
+func (w *prefixWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Host returns the host of Base, e.g. as the issuer of session tokens
+func Host() string {
+	u, err := url.Parse(Base())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,93 @@
+package links
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBase(t *testing.T) {
+	t.Cleanup(func() { SetBase(""); SetTrustedProxy(nil) })
+
+	r := httptest.NewRequest("GET", "/details/abc123", nil)
+	r.Host = "staging.example.org"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if got := ForRequest(r); got != "http://staging.example.org" {
+		t.Errorf("expected X-Forwarded-Proto to be ignored without a trusted proxy, got %q", got)
+	}
+	SetTrustedProxy(func(*http.Request) bool { return true })
+	if got := ForRequest(r); got != "https://staging.example.org" {
+		t.Errorf("expected the request's address without a base URL, got %q", got)
+	}
+	if Base() != DefaultBase || Host() != "certificates.software.geant.org" {
+		t.Errorf("expected the production address outside requests, got %q", Base())
+	}
+
+	base, err := Parse("https://badges.example.org/")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	SetBase(base)
+	if ForRequest(r) != "https://badges.example.org" || Base() != "https://badges.example.org" || Host() != "badges.example.org" {
+		t.Errorf("expected the configured base URL everywhere, got %q and %q", ForRequest(r), Base())
+	}
+
+	for _, bad := range []string{"badges.example.org", "ftp://badges.example.org", "https://badges.example.org/?x=1", "https://"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	t.Cleanup(func() { SetBase(""); SetPrefix("") })
+
+	SetBase("https://example.org/certificates")
+	if Prefix() != "/certificates" || Base() != "https://example.org/certificates" {
+		t.Errorf("expected the path of the base URL as prefix, got %q and %q", Prefix(), Base())
+	}
+
+	SetBase("")
+	SetPrefix("/certificates")
+	r := httptest.NewRequest("GET", "/certificates/details/abc123", nil)
+	r.Host = "example.org"
+	if ForRequest(r) != "http://example.org/certificates" || Path("/new") != "/certificates/new" {
+		t.Errorf("expected links below the prefix, got %q and %q", ForRequest(r), Path("/new"))
+	}
+
+	h := StripPrefix(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/new" {
+			http.Redirect(w, r, "/details/abc123", http.StatusSeeOther)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		location     string
+		body         string
+	}{
+		{"GET", "/certificates/details/abc123", http.StatusOK, "", "/details/abc123"},
+		{"GET", "/certificates/", http.StatusOK, "", "/"},
+		{"GET", "/certificates?page=2", http.StatusMovedPermanently, "/certificates/?page=2", ""},
+		{"POST", "/certificates/new", http.StatusSeeOther, "/certificates/details/abc123", ""},
+		{"GET", "/details/abc123", http.StatusNotFound, "", ""},
+		{"GET", "/certificatesx/", http.StatusNotFound, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s: expected %d to %q, got %d to %q", tc.method, tc.path, tc.status, tc.location, w.Code, w.Header().Get("Location"))
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("%s %s: expected the handler to see %q, got %q", tc.method, tc.path, tc.body, w.Body.String())
+		}
+	}
+
+	for _, bad := range []string{"certificates", "/a//b", "/a?b"} {
+		if _, err := ParsePrefix(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package list
 
 import (
+    "bytes"
     "encoding/json"
-    "fmt"
     "html/template"
     "net/http"
+    "net/url"
+    "strconv"
     "strings"
     "time"
 
+    "github.com/finki/badges/internal/assets"
     "github.com/finki/badges/internal/auth"
     "github.com/finki/badges/internal/cache"
+    "github.com/finki/badges/internal/httpcache"
     "github.com/finki/badges/internal/database"
+    "github.com/finki/badges/internal/links"
+    "github.com/finki/badges/internal/redact"
     "github.com/finki/badges/internal/version"
     "go.uber.org/zap"
 )
@@ -21,10 +27,28 @@ type TemplateData struct {
     CurrentYear int
     // Permissions
     CanCreate   bool
+    // Filters, sort and pagination of the current view
+    Status      string
+    Issuer      string
+    Domain      string
+    Org         string
+    Sort        string
+    Page        int
+    TotalPages  int
+    Total       int
+    PrevURL     string
+    NextURL     string
     Version     string
     Commit      string
 }
 
+// defaultPerPage is the page size of the HTML list
+const defaultPerPage = 25
+
+// listCacheTTL bounds how long a rendered list page is reused; badge changes
+// drop every cached page
+const listCacheTTL = 5 * time.Minute
+
 // BadgeData represents the data for a single badge in the list
 type BadgeData struct {
 	    	CommitID        string
@@ -43,13 +67,13 @@ type Handler struct {
 	db       *database.DB
 	logger   *zap.Logger
 	cache    *cache.Cache
-	template *template.Template
+	template *assets.Template
 }
 
 // NewHandler creates a new badges list handler
 func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
 	// Parse the template
-	tmpl, err := template.ParseFiles("templates/list/list.html")
+	tmpl, err := assets.ParseTemplate("list/list.html")
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +88,8 @@ func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handl
 
 // ServeHTTP handles HTTP requests for the badges list page
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    db := h.db.WithContext(r.Context())
+
     accept := r.Header.Get("Accept")
     wantsJSON := strings.Contains(accept, "application/json")
 
@@ -73,18 +99,29 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		wantsJSON = true
 	} else if format == "html" {
 		wantsJSON = false
+	} else {
+		httpcache.Vary(w, "Accept")
 	}
 
  // Determine permissions from JWT claims (if any)
     // We consider users with Badges.Write permission as trusted to view drafts
     canSeeDrafts := false
     if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
-        canSeeDrafts = claims.Permissions.Badges.Write
+        canSeeDrafts = claims.Permissions.Allows("badges", "write")
     }
 
+	query, err := database.ParseBadgeQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.IncludeDrafts = canSeeDrafts
+	query.DraftOrg = auth.GetOrgIDFromContext(r.Context())
+
     if wantsJSON {
-        // Return JSON representation of certificates
-        badges, err := h.db.ListBadges()
+        // Return JSON representation of certificates; paginated only when
+        // page or per_page is given
+        badges, total, err := db.SearchBadges(query)
         if err != nil {
             h.logger.Error("Failed to list badges", zap.Error(err))
             http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -104,9 +141,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
   result := make([]CertificateJSON, 0, len(badges))
   for _, b := range badges {
-      // Hide drafts for unauthenticated/unauthorized users
-      if !canSeeDrafts && strings.EqualFold(b.Status, "draft") {
-          continue
+      if !canSeeDrafts {
+          b = redact.Get().Badge(b)
       }
       certName := ""
       if b.CertificateName.Valid {
@@ -116,10 +152,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				CertID:          b.CommitID,
 				SoftwareName:    b.SoftwareName,
 				CertificateName: certName,
-				Status:          b.Status,
-				IssueDate:       b.IssueDate,
+				Status:          string(b.Status),
+				IssueDate:       database.FormatDate(b.IssueDate),
 				IsExpired:       b.IsExpired(),
-				DetailsLink:     fmt.Sprintf("https://certificates.software.geant.org/details/%s", b.CommitID),
+				DetailsLink:     links.Base() + "/details/" + url.PathEscape(b.CommitID),
 			})
 		}
 
@@ -131,6 +167,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if query.Paginated() {
+			extra := url.Values{}
+			if format != "" {
+				extra.Set("format", format)
+			}
+			w.Header().Set("Link", query.LinkHeader(links.Path(r.URL.Path), total, extra))
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write(payload)
 		return
@@ -138,19 +182,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
  // Default: Return existing HTML page
  // Try to get from cache first (existing behavior)
- // Make cache key depend on visibility to avoid leaking drafts
- cacheKey := "badges:list:public"
+ if query.Page == 0 {
+     query.Page = 1
+ }
+ if query.PerPage == 0 {
+     query.PerPage = defaultPerPage
+ }
+ // Make cache key depend on visibility to avoid leaking drafts, and on the
+ // normalized filters so that every view is cached separately
+ cacheKey := "badges:list:public:"
  if canSeeDrafts {
-     cacheKey = "badges:list:priv"
+     cacheKey = "badges:list:priv:" + query.DraftOrg + ":"
  }
+ cacheKey += strconv.Itoa(query.Page) + "?" + query.Values().Encode()
  if cachedData, found := h.cache.Get(cacheKey); found {
      w.Header().Set("Content-Type", "text/html; charset=utf-8")
      w.Write(cachedData)
      return
  }
 
-	// Get all badges from database
-	badges, err := h.db.ListBadges()
+	// Get the requested page of badges from database
+	badges, total, err := db.SearchBadges(query)
 	if err != nil {
 		h.logger.Error("Failed to list badges", zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -162,16 +214,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         Badges:      make([]*BadgeData, 0, len(badges)),
         CurrentYear: time.Now().Year(),
         CanCreate:   canSeeDrafts,
+        Status:      query.Status,
+        Issuer:      query.Issuer,
+        Domain:      query.Domain,
+        Org:         query.Org,
+        Sort:        query.Values().Get("sort"),
+        Page:        query.Page,
+        TotalPages:  database.TotalPages(total, query.PerPage),
+        Total:       total,
         Version:     version.Version,
         Commit:      version.Commit,
     }
 
+ if data.Page > 1 {
+     data.PrevURL = query.PageURL(links.Path(r.URL.Path), data.Page-1, nil)
+ }
+ if data.Page < data.TotalPages {
+     data.NextURL = query.PageURL(links.Path(r.URL.Path), data.Page+1, nil)
+ }
+
 	// Convert database badges to template badge data
  for _, badge := range badges {
-        // Hide drafts for unauthenticated/unauthorized users
-        if !canSeeDrafts && strings.EqualFold(badge.Status, "draft") {
-            continue
-        }
         certName := ""
         if badge.CertificateName.Valid {
             certName = badge.CertificateName.String
@@ -226,8 +289,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
             CommitID:        badge.CommitID,
             SoftwareName:    badge.SoftwareName,
             CertificateName: certName,
-            Status:          badge.Status,
-            IssueDate:       badge.IssueDate,
+            Status:          string(badge.Status),
+            IssueDate:       database.FormatDate(badge.IssueDate),
             IsExpired:       badge.IsExpired(),
             ColorRight:      colorRight,
             BorderColor:     borderColor,
@@ -236,10 +299,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
  // Render the template
- w.Header().Set("Content-Type", "text/html; charset=utf-8")
- if err := h.template.Execute(w, data); err != nil {
+ var buf bytes.Buffer
+ if err := h.template.Execute(&buf, data); err != nil {
      h.logger.Error("Failed to render template", zap.Error(err))
      http.Error(w, "Internal server error", http.StatusInternalServerError)
      return
  }
-}
\ No newline at end of file
+ h.cache.Set(cacheKey, buf.Bytes(), listCacheTTL)
+ w.Header().Set("Content-Type", "text/html; charset=utf-8")
+ w.Write(buf.Bytes())
+}
@@ -0,0 +1,100 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestListPagination(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "list.db")
+	// Templates are loaded relative to the repository root
+	t.Chdir("../..")
+
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 30; i++ {
+		status := database.StatusValid
+		if i%10 == 0 {
+			status = database.StatusRevoked
+		}
+		b := &database.Badge{
+			CommitID:        fmt.Sprintf("cert%03d", i),
+			Type:            "badge",
+			Status:          status,
+			Issuer:          "Test Issuer",
+			IssueDate:       time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC),
+			SoftwareName:    fmt.Sprintf("App %02d", i),
+			SoftwareVersion: "v1.0.0",
+		}
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+
+	c := cache.New()
+	h, err := NewHandler(db, logger, c)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	body := get("/certificates").Body.String()
+	if !strings.Contains(body, "/details/cert025") || strings.Contains(body, "/details/cert026") {
+		t.Error("Expected the first page to hold the first 25 certificates")
+	}
+	if !strings.Contains(body, "Page 1 of 2") || !strings.Contains(body, `href="/certificates?page=2&amp;per_page=25"`) {
+		t.Error("Expected a link to the second page")
+	}
+
+	body = get("/certificates?sort=-issue_date&page=2").Body.String()
+	if !strings.Contains(body, "/details/cert005") || strings.Contains(body, "/details/cert006") {
+		t.Error("Expected the second page of the newest-first listing to hold the oldest certificates")
+	}
+	if !strings.Contains(body, `href="/certificates?per_page=25&amp;sort=-issue_date"`) {
+		t.Error("Expected the previous link to keep the sort")
+	}
+
+	// Every view is cached under its own key
+	body = get("/certificates?status=revoked").Body.String()
+	if strings.Count(body, `<a href="/details/`) != 3 {
+		t.Errorf("Expected 3 revoked certificates")
+	}
+	if _, found := c.Get("badges:list:public:1?per_page=25&status=revoked"); !found {
+		t.Error("Expected the filtered page to be cached under its normalized parameters")
+	}
+
+	rec := get("/certificates?format=json&per_page=10&page=3")
+	var certs []map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&certs); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(certs) != 10 || certs[0]["cert_id"] != "cert021" {
+		t.Errorf("Expected the third page of 10, got %d starting at %v", len(certs), certs[0]["cert_id"])
+	}
+	if rec.Header().Get("X-Total-Count") != "30" || !strings.Contains(rec.Header().Get("Link"), `rel="prev"`) {
+		t.Errorf("Unexpected pagination headers %v", rec.Header())
+	}
+
+	if rec := get("/certificates?sort=bogus"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid sort, got %d", rec.Code)
+	}
+}
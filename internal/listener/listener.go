@@ -0,0 +1,65 @@
+// Package listener opens the listening socket of the HTTP server for rolling
+// deploys. A socket passed by systemd socket activation is used as is, so
+// the socket outlives restarts and connections queue while the new process
+// starts. Otherwise the port can be opened with SO_REUSEPORT, so that a new
+// process binds it next to the old one, which drains its connections before
+// it exits.
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// ErrReusePortUnsupported is returned for SO_REUSEPORT on platforms without it
+var ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+// activationFD is the first file descriptor passed by systemd
+const activationFD = 3
+
+// Listen returns the socket passed by systemd socket activation, if any, or
+// else a TCP listener on addr, opened with SO_REUSEPORT if reusePort is set.
+// The second result reports whether the socket was passed by systemd.
+func Listen(addr string, reusePort bool) (net.Listener, bool, error) {
+	if l, err := activated(); l != nil || err != nil {
+		return l, l != nil, err
+	}
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = setReusePort
+	}
+	l, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	return l, false, nil
+}
+
+// activated returns the first socket passed by systemd to this process, or
+// nil without socket activation. The activation variables are unset, so that
+// child processes do not take the socket for theirs.
+func activated() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, fmt.Errorf("socket activation without sockets: LISTEN_FDS=%q", os.Getenv("LISTEN_FDS"))
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(activationFD), "LISTEN_FD_3")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket from socket activation: %w", err)
+	}
+	return l, nil
+}
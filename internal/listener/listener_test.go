@@ -0,0 +1,47 @@
+package listener
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+	first, activated, err := Listen("127.0.0.1:0", true)
+	if errors.Is(err, ErrReusePortUnsupported) {
+		t.Skipf("SO_REUSEPORT is not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer first.Close()
+	if activated {
+		t.Error("expected no socket activation")
+	}
+
+	// A new process binds the port while the old one still listens
+	second, _, err := Listen(first.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("expected a second listener on %s: %v", first.Addr(), err)
+	}
+	second.Close()
+
+	// Without SO_REUSEPORT the port is taken
+	if l, _, err := Listen(first.Addr().String(), false); err == nil {
+		l.Close()
+		t.Error("expected the port to be in use")
+	}
+}
+
+func TestListenIgnoresActivationOfOtherProcesses(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	l, activated, err := Listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	if activated {
+		t.Error("expected the sockets of another process to be ignored")
+	}
+}
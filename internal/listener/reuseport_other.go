@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package listener
+
+import "syscall"
+
+// setReusePort fails where SO_REUSEPORT is not available
+func setReusePort(network, address string, c syscall.RawConn) error {
+	return ErrReusePortUnsupported
+}
@@ -0,0 +1,53 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Client certificate policies of a mutual TLS listener
+const (
+	// ClientAuthRequire fails handshakes without a valid client certificate
+	ClientAuthRequire = "require"
+	// ClientAuthOptional accepts clients without a certificate, e.g.
+	// browsers, and verifies the certificates presented
+	ClientAuthOptional = "optional"
+)
+
+// MutualTLSConfig returns the TLS configuration of a listener serving the
+// certificate and key in certFile and keyFile, and verifying client
+// certificates against the CA certificates in clientCAFile (PEM) under the
+// clientAuth policy. The files are read once.
+func MutualTLSConfig(certFile, keyFile, clientCAFile, clientAuth string) (*tls.Config, error) {
+	var policy tls.ClientAuthType
+	switch clientAuth {
+	case ClientAuthRequire:
+		policy = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		policy = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid client certificate policy %q: expected %s or %s", clientAuth, ClientAuthRequire, ClientAuthOptional)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificates found in %s", clientCAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   policy,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue returns a certificate for template signed by parent, or self-signed
+// without one
+func issue(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert, key
+}
+
+// writePEM writes a PEM block to a file of dir and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestMutualTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}, IsCA: true,
+		KeyUsage: x509.KeyUsageCertSign, BasicConstraintsValid: true}, nil, nil)
+	server, serverKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "server"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, ca, caKey)
+	client, clientKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ci-bot"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca, caKey)
+
+	serverKeyDER, _ := x509.MarshalECPrivateKey(serverKey)
+	certFile := writePEM(t, dir, "server.pem", "CERTIFICATE", server.Raw)
+	keyFile := writePEM(t, dir, "server-key.pem", "EC PRIVATE KEY", serverKeyDER)
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", ca.Raw)
+
+	if _, err := MutualTLSConfig(certFile, keyFile, caFile, "sometimes"); err == nil {
+		t.Errorf("expected an unknown policy to be refused")
+	}
+	if _, err := MutualTLSConfig(certFile, keyFile, keyFile, ClientAuthRequire); err == nil {
+		t.Errorf("expected a CA file without certificates to be refused")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}}}}}
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	for _, tc := range []struct {
+		clientAuth    string
+		withoutCertOK bool
+	}{
+		{ClientAuthRequire, false},
+		{ClientAuthOptional, true},
+	} {
+		config, err := MutualTLSConfig(certFile, keyFile, caFile, tc.clientAuth)
+		if err != nil {
+			t.Fatalf("MutualTLSConfig: %v", err)
+		}
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) > 0 {
+				w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+			}
+		}))
+		srv.TLS = config
+		srv.StartTLS()
+
+		resp, err := withCert.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: expected the client certificate to be accepted: %v", tc.clientAuth, err)
+		}
+		body := make([]byte, 16)
+		n, _ := resp.Body.Read(body)
+		resp.Body.Close()
+		if string(body[:n]) != "ci-bot" {
+			t.Errorf("%s: expected the verified client certificate, got %q", tc.clientAuth, body[:n])
+		}
+
+		resp, err = withoutCert.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != tc.withoutCertOK {
+			t.Errorf("%s: connection without certificate: got error %v", tc.clientAuth, err)
+		}
+		srv.Close()
+	}
+}
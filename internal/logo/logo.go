@@ -0,0 +1,193 @@
+// Package logo resolves the per-badge logo set in custom_config ("logo") into
+// a sanitized fragment that the badge and certificate templates nest in place
+// of the theme logo. A logo is either fetched from an allowlisted HTTPS host or
+// uploaded inline as a data: URI; SVG, PNG and JPEG are accepted.
+package logo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/svgtmpl"
+	"github.com/finki/badges/internal/theme"
+)
+
+const (
+	// DefaultMaxSize is the default limit on the size of a logo file
+	DefaultMaxSize = 128 << 10
+	// maxDimension caps the pixel size of raster logos
+	maxDimension = 2048
+	fetchTimeout = 5 * time.Second
+	cacheTTL     = time.Hour
+)
+
+// mediaTypes are the accepted logo formats
+var mediaTypes = map[string]bool{"image/svg+xml": true, "image/png": true, "image/jpeg": true}
+
+// Resolver loads and sanitizes badge logos
+type Resolver struct {
+	allowedHosts []string
+	maxSize      int64
+	client       *http.Client
+	cache        *cache.Cache
+}
+
+// NewResolver creates a resolver that fetches logos only from allowedHosts
+// (exact host names, or "*.example.org" for subdomains). Without hosts, only
+// data: URIs are accepted. Fetched files are kept in c when it is not nil.
+func NewResolver(allowedHosts []string, maxSize int64, c *cache.Cache) *Resolver {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	r := &Resolver{allowedHosts: allowedHosts, maxSize: maxSize, cache: c}
+	r.client = &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("too many redirects")
+			}
+			return r.checkURL(req.URL)
+		},
+	}
+	return r
+}
+
+// Resolve returns the sanitized logo for a custom_config logo reference
+func (r *Resolver) Resolve(ref string) (*theme.Logo, error) {
+	data, err := r.load(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// load returns the raw logo file for a data: URI or an allowlisted URL
+func (r *Resolver) load(ref string) ([]byte, error) {
+	if strings.HasPrefix(ref, "data:") {
+		return r.decodeDataURI(ref)
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo URL: %w", err)
+	}
+	if err := r.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	key := "logo:" + u.String()
+	if r.cache != nil {
+		if data, ok := r.cache.Get(key); ok {
+			return data, nil
+		}
+	}
+
+	resp, err := r.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch logo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch logo: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, r.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+	if int64(len(data)) > r.maxSize {
+		return nil, fmt.Errorf("logo is larger than %d bytes", r.maxSize)
+	}
+
+	if r.cache != nil {
+		r.cache.Set(key, data, cacheTTL)
+	}
+	return data, nil
+}
+
+// checkURL allows only HTTPS URLs on an allowlisted host
+func (r *Resolver) checkURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return errors.New("logo URLs must use https")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range r.allowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("logo host %q is not allowed", host)
+}
+
+// decodeDataURI decodes an uploaded logo given as data:<type>[;base64],<data>
+func (r *Resolver) decodeDataURI(ref string) ([]byte, error) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(ref, "data:"), ",")
+	if !ok {
+		return nil, errors.New("invalid logo data URI")
+	}
+	mediaType, params, _ := strings.Cut(meta, ";")
+	if !mediaTypes[strings.ToLower(mediaType)] {
+		return nil, fmt.Errorf("unsupported logo type %q: use SVG, PNG or JPEG", mediaType)
+	}
+	if int64(len(payload)) > 2*r.maxSize {
+		return nil, fmt.Errorf("logo is larger than %d bytes", r.maxSize)
+	}
+
+	var data []byte
+	var err error
+	if strings.HasSuffix(params, "base64") {
+		data, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		var s string
+		s, err = url.PathUnescape(payload)
+		data = []byte(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo data URI: %w", err)
+	}
+	if int64(len(data)) > r.maxSize {
+		return nil, fmt.Errorf("logo is larger than %d bytes", r.maxSize)
+	}
+	return data, nil
+}
+
+// Parse sanitizes an SVG logo, or wraps a PNG or JPEG logo in an SVG image
+// element, so that it can be nested in the badge and certificate templates
+func Parse(data []byte) (*theme.Logo, error) {
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg":
+		return parseRaster(data)
+	}
+	if !bytes.Contains(data, []byte("<svg")) {
+		return nil, errors.New("logo is not an SVG, PNG or JPEG image")
+	}
+	return sanitizeSVG(data)
+}
+
+// parseRaster embeds a PNG or JPEG logo as a data URI
+func parseRaster(data []byte) (*theme.Logo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo: %w", err)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, fmt.Errorf("logo is %dx%d pixels, at most %d on each side are allowed", cfg.Width, cfg.Height, maxDimension)
+	}
+
+	href := "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return &theme.Logo{
+		ViewBox: fmt.Sprintf("0 0 %d %d", cfg.Width, cfg.Height),
+		Content: svgtmpl.Markup(fmt.Sprintf(`<image width="%d" height="%d" href="%s"/>`, cfg.Width, cfg.Height, href)),
+	}, nil
+}
@@ -0,0 +1,169 @@
+package logo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	svg := `<?xml version="1.0"?>
+<!DOCTYPE svg>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" id="root" width="24" height="12" fill="#333" onload="alert(1)">
+  <script>alert(1)</script>
+  <defs><linearGradient id="g"><stop offset="0" stop-color="#fff"/></linearGradient></defs>
+  <rect width="24" height="12" fill="url(#g)" onclick="alert(1)" class="x"/>
+  <path d="M0 0h4" style="fill:url(https://evil.example/x.svg)"/>
+  <use xlink:href="#g"/>
+  <use href="https://evil.example/sprite.svg#a"/>
+  <foreignObject><div>html</div></foreignObject>
+  <image href="https://evil.example/track.png"/>
+</svg>`
+
+	logo, err := Parse([]byte(svg))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if logo.ViewBox != "0 0 24 12" {
+		t.Errorf("Expected viewBox from width and height, got %q", logo.ViewBox)
+	}
+
+	content := string(logo.Content)
+	for _, want := range []string{`<g fill="#333">`, `id="logo-g"`, `fill="url(#logo-g)"`, `href="#logo-g"`, `<path d="M0 0h4"></path>`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected %s in %s", want, content)
+		}
+	}
+	for _, banned := range []string{"script", "alert", "onload", "onclick", "class", "evil.example", "foreignObject", "<div", "<image", `id="root"`} {
+		if strings.Contains(content, banned) {
+			t.Errorf("Expected %s to be removed from %s", banned, content)
+		}
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"not an image":  "hello",
+		"not svg root":  `<html><svg viewBox="0 0 1 1"></svg></html>`,
+		"no size":       `<svg xmlns="http://www.w3.org/2000/svg"><rect/></svg>`,
+		"malformed xml": `<svg viewBox="0 0 1 1"><rect></svg>`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResolveDataURI(t *testing.T) {
+	r := NewResolver(nil, 0, nil)
+
+	logo, err := r.Resolve("data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(t, 20, 10)))
+	if err != nil {
+		t.Fatalf("Resolve PNG failed: %v", err)
+	}
+	if logo.ViewBox != "0 0 20 10" || !strings.Contains(string(logo.Content), `href="data:image/png;base64,`) {
+		t.Errorf("Unexpected PNG logo %+v", logo)
+	}
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 4 4"><circle r="2"/></svg>`
+	logo, err = r.Resolve("data:image/svg+xml," + url.PathEscape(svg))
+	if err != nil {
+		t.Fatalf("Resolve SVG failed: %v", err)
+	}
+	if logo.ViewBox != "0 0 4 4" || !strings.Contains(string(logo.Content), `<circle r="2">`) {
+		t.Errorf("Unexpected SVG logo %+v", logo)
+	}
+
+	if _, err := r.Resolve("data:text/html,<script>alert(1)</script>"); err == nil {
+		t.Error("Expected an unsupported data URI type to be rejected")
+	}
+	if _, err := NewResolver(nil, 64, nil).Resolve("data:image/svg+xml," + url.PathEscape(svg+strings.Repeat(" ", 64))); err == nil {
+		t.Error("Expected a data URI over the size limit to be rejected")
+	}
+	if _, err := r.Resolve("data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(t, maxDimension+1, 1))); err == nil {
+		t.Error("Expected an oversized PNG to be rejected")
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/logo.svg":
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 8 8"><rect width="8" height="8"/></svg>`))
+		case "/big.svg":
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 8 8">` + strings.Repeat("<g/>", 100) + `</svg>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+	hostname, _, _ := strings.Cut(host, ":")
+
+	r := NewResolver([]string{hostname}, 256, cache.New())
+	r.client.Transport = srv.Client().Transport
+
+	for i := 0; i < 2; i++ {
+		logo, err := r.Resolve(srv.URL + "/logo.svg")
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if logo.ViewBox != "0 0 8 8" {
+			t.Errorf("Unexpected viewBox %q", logo.ViewBox)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the second resolve to hit the cache, got %d requests", requests)
+	}
+
+	if _, err := r.Resolve(srv.URL + "/big.svg"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected a size limit error, got %v", err)
+	}
+	if _, err := r.Resolve(srv.URL + "/missing.svg"); err == nil {
+		t.Error("Expected an error for a missing logo")
+	}
+	if _, err := r.Resolve("http://" + host + "/logo.svg"); err == nil {
+		t.Error("Expected a plain HTTP URL to be rejected")
+	}
+	if _, err := NewResolver([]string{"logos.example.org"}, 0, nil).Resolve(srv.URL + "/logo.svg"); err == nil {
+		t.Error("Expected a host outside the allowlist to be rejected")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	r := NewResolver([]string{"cdn.example.org", "*.geant.org"}, 0, nil)
+	for ref, allowed := range map[string]bool{
+		"https://cdn.example.org/a.svg":      true,
+		"https://CDN.example.org/a.svg":      true,
+		"https://www.geant.org/a.svg":        true,
+		"https://geant.org/a.svg":            false,
+		"https://evilgeant.org/a.svg":        false,
+		"https://example.org/a.svg":          false,
+		"http://cdn.example.org/a.svg":       false,
+		"https://cdn.example.org.evil/a.svg": false,
+	} {
+		u, _ := url.Parse(ref)
+		if err := r.checkURL(u); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", ref, allowed, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package logo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/finki/badges/internal/svgtmpl"
+	"github.com/finki/badges/internal/theme"
+)
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	// idPrefix keeps logo IDs from clashing with the IDs of the templates
+	idPrefix = "logo-"
+)
+
+// allowedElements are the drawing elements kept from an SVG logo; anything
+// else (script, foreignObject, style, image, animation, ...) is dropped with
+// its content
+var allowedElements = map[string]bool{
+	"g": true, "path": true, "rect": true, "circle": true, "ellipse": true,
+	"line": true, "polyline": true, "polygon": true, "text": true, "tspan": true,
+	"defs": true, "linearGradient": true, "radialGradient": true, "stop": true,
+	"clipPath": true, "mask": true, "use": true, "symbol": true, "title": true, "desc": true,
+}
+
+// allowedAttributes are the geometry and presentation attributes kept; event
+// handlers, classes and anything namespaced other than xlink:href are dropped
+var allowedAttributes = map[string]bool{
+	"id": true, "d": true, "x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "fx": true, "fy": true,
+	"width": true, "height": true, "points": true, "transform": true, "viewBox": true,
+	"preserveAspectRatio": true, "fill": true, "fill-opacity": true, "fill-rule": true,
+	"stroke": true, "stroke-width": true, "stroke-linecap": true, "stroke-linejoin": true,
+	"stroke-opacity": true, "stroke-dasharray": true, "stroke-miterlimit": true,
+	"opacity": true, "offset": true, "stop-color": true, "stop-opacity": true,
+	"gradientUnits": true, "gradientTransform": true, "spreadMethod": true,
+	"clip-path": true, "clip-rule": true, "mask": true, "maskUnits": true, "clipPathUnits": true,
+	"font-family": true, "font-size": true, "font-weight": true, "text-anchor": true,
+	"display": true, "visibility": true, "style": true, "href": true,
+}
+
+var (
+	// urlPattern matches url(...) references in attribute and style values
+	urlPattern = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]*)['"]?\s*\)`)
+	// unsafeStyle matches CSS that can load resources or run code
+	unsafeStyle = regexp.MustCompile(`(?i)@import|expression\s*\(|javascript:|behavior\s*:|-moz-binding`)
+	sizePattern = regexp.MustCompile(`^\s*([\d.]+)\s*(px)?\s*$`)
+)
+
+// sanitizeSVG rebuilds an SVG logo from allowlisted elements and attributes,
+// prefixes its IDs and returns the content of its root element
+func sanitizeSVG(data []byte) (*theme.Logo, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out strings.Builder
+	var root *xml.StartElement
+	depth, skip := 0, 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG logo: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root == nil {
+				if t.Name.Local != "svg" {
+					return nil, errors.New("invalid SVG logo: root element is not <svg>")
+				}
+				root = &t
+				depth = 1
+				// Presentation attributes of the root, such as fill, apply to
+				// the whole logo, so they move to a group
+				out.WriteString("<g")
+				writeAttrs(&out, t.Attr, rootOnly)
+				out.WriteString(">")
+				continue
+			}
+			depth++
+			if skip > 0 || !allowedElements[t.Name.Local] || (t.Name.Space != "" && t.Name.Space != svgNamespace) {
+				skip++
+				continue
+			}
+			out.WriteString("<" + t.Name.Local)
+			writeAttrs(&out, t.Attr, nil)
+			out.WriteString(">")
+		case xml.EndElement:
+			depth--
+			if root == nil || depth == 0 {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + t.Name.Local + ">")
+		case xml.CharData:
+			if root != nil && depth > 0 && skip == 0 {
+				xml.EscapeText(&out, t)
+			}
+		}
+		// Comments, processing instructions and DOCTYPE directives are dropped
+	}
+	if root == nil {
+		return nil, errors.New("invalid SVG logo: no <svg> element")
+	}
+	out.WriteString("</g>")
+
+	viewBox, err := rootViewBox(root)
+	if err != nil {
+		return nil, err
+	}
+	return &theme.Logo{ViewBox: viewBox, Content: svgtmpl.Markup(out.String())}, nil
+}
+
+// rootOnly are the attributes of the root element that position the logo
+// itself; the nesting template sets those
+var rootOnly = map[string]bool{"id": true, "x": true, "y": true, "width": true, "height": true, "viewBox": true, "preserveAspectRatio": true}
+
+// writeAttrs writes the allowed attributes, leaving out those in skip
+func writeAttrs(out *strings.Builder, attrs []xml.Attr, skip map[string]bool) {
+	for _, a := range attrs {
+		if skip[a.Name.Local] {
+			continue
+		}
+		if name, value, ok := sanitizeAttr(a); ok {
+			out.WriteString(" " + name + `="`)
+			xml.EscapeText(out, []byte(value))
+			out.WriteString(`"`)
+		}
+	}
+}
+
+// sanitizeAttr returns the attribute to write, if it is allowed
+func sanitizeAttr(a xml.Attr) (string, string, bool) {
+	name, value := a.Name.Local, a.Value
+	switch {
+	case a.Name.Space == xlinkNamespace && name == "href":
+	case a.Name.Space != "" || !allowedAttributes[name]:
+		return "", "", false
+	}
+
+	switch name {
+	case "id":
+		return name, idPrefix + value, true
+	case "href":
+		// Only references to elements of the logo itself
+		if !strings.HasPrefix(value, "#") {
+			return "", "", false
+		}
+		return name, "#" + idPrefix + value[1:], true
+	case "style":
+		if unsafeStyle.MatchString(value) {
+			return "", "", false
+		}
+	}
+
+	// url(...) may only point into the logo, e.g. fill="url(#gradient)"
+	safe := true
+	value = urlPattern.ReplaceAllStringFunc(value, func(m string) string {
+		ref := urlPattern.FindStringSubmatch(m)[1]
+		if !strings.HasPrefix(ref, "#") {
+			safe = false
+			return m
+		}
+		return "url(#" + idPrefix + ref[1:] + ")"
+	})
+	return name, value, safe
+}
+
+// rootViewBox returns the viewBox of the logo's root element, derived from its
+// width and height when missing
+func rootViewBox(root *xml.StartElement) (string, error) {
+	size := map[string]string{}
+	for _, a := range root.Attr {
+		switch a.Name.Local {
+		case "viewBox":
+			return a.Value, nil
+		case "width", "height":
+			if m := sizePattern.FindStringSubmatch(a.Value); m != nil {
+				size[a.Name.Local] = m[1]
+			}
+		}
+	}
+	if size["width"] == "" || size["height"] == "" {
+		return "", errors.New("SVG logo needs a viewBox or width and height")
+	}
+	return "0 0 " + size["width"] + " " + size["height"], nil
+}
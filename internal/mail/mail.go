@@ -0,0 +1,107 @@
+// Package mail sends plain text notifications by email through an SMTP
+// relay.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender sends an email with a subject and a plain text body
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTP sends emails through an SMTP relay, upgrading the connection with
+// STARTTLS when the relay offers it and authenticating when a username is
+// set
+type SMTP struct {
+	// Addr is the host:port of the relay
+	Addr     string
+	Username string
+	Password string
+	// From is the sender address
+	From string
+}
+
+// Send delivers an email to one recipient; ctx bounds the whole exchange
+func (s *SMTP) Send(ctx context.Context, to, subject, body string) error {
+	msg, err := message(s.From, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %w", s.Addr, err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP relay: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet SMTP relay: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate to SMTP relay: %w", err)
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return fmt.Errorf("SMTP relay refused sender: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP relay refused recipient: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP relay refused data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP relay refused email: %w", err)
+	}
+	return c.Quit()
+}
+
+// message returns an email with CRLF line endings. Header values must not
+// contain line breaks, which would let them add headers of their own.
+func message(from, to, subject, body string, date time.Time) ([]byte, error) {
+	for _, v := range []string{from, to, subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("email headers cannot contain line breaks")
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	msg, err := message("badges@example.org", "alice@example.org", "Clé expiring", "Line one\nLine two\n", date)
+	if err != nil {
+		t.Fatalf("message: %v", err)
+	}
+	for _, want := range []string{
+		"From: badges@example.org\r\n",
+		"To: alice@example.org\r\n",
+		"Subject: =?utf-8?q?Cl=C3=A9_expiring?=\r\n",
+		"Date: Sun, 01 Mar 2026 12:00:00 +0000\r\n",
+		"\r\n\r\nLine one\r\nLine two\r\n",
+	} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("expected %q in %q", want, msg)
+		}
+	}
+
+	if _, err := message("badges@example.org", "alice@example.org\r\nBcc: eve@example.org", "Hi", "", date); err == nil {
+		t.Error("expected a line break in a header to be refused")
+	}
+}
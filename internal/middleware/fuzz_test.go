@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/commitid"
+	"go.uber.org/zap"
+)
+
+// FuzzSanitizer sends arbitrary paths through the commit ID sanitizer: valid
+// commit IDs and vanity image paths reach the handler, other IDs get a 400
+func FuzzSanitizer(f *testing.F) {
+	for _, p := range []string{"/badge/abc123", "/details/abc123/", "/edit/ab", "/badge/tool/self-assessed-dependencies",
+		"/certificate/../../etc/passwd", "/badge/composite", "/details/<script>", "/badge/", "/api/badges/x"} {
+		f.Add(p)
+	}
+	s := NewSanitizer(zap.NewNop())
+
+	f.Fuzz(func(t *testing.T, path string) {
+		called := false
+		h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, &http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}, Header: http.Header{}})
+		if !called && rec.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected the handler or a 400, got %d", path, rec.Code)
+		}
+
+		for _, prefix := range commitIDPrefixes {
+			rest, found := strings.CutPrefix(path, prefix)
+			if !found || reservedPaths[path] {
+				continue
+			}
+			id, _, _ := strings.Cut(rest, "/")
+			_, _, vanity := commitid.ParseVanity(rest)
+			image := prefix == "/badge/" || prefix == "/certificate/"
+			switch {
+			case id == "" || commitid.Valid(id) || (vanity && image):
+				if !called {
+					t.Fatalf("%q: expected the request to reach the handler", path)
+				}
+			case called:
+				t.Fatalf("%q: expected invalid commit ID %q to be rejected", path, id)
+			}
+		}
+	})
+}
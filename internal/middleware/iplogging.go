@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// IPLogging is how much of a client's IP address is written to the logs
+type IPLogging string
+
+const (
+	// IPLoggingFull logs the remote address as is
+	IPLoggingFull IPLogging = "full"
+	// IPLoggingTruncated logs the /24 network of IPv4 and the /48 network of
+	// IPv6 addresses, which locate a client without identifying it
+	IPLoggingTruncated IPLogging = "truncated"
+	// IPLoggingOff leaves client addresses out of the logs
+	IPLoggingOff IPLogging = "off"
+)
+
+// ParseIPLogging parses the CLIENT_IP_LOGGING setting; "" means IPLoggingFull
+func ParseIPLogging(s string) (IPLogging, error) {
+	switch m := IPLogging(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return IPLoggingFull, nil
+	case IPLoggingFull, IPLoggingTruncated, IPLoggingOff:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid client IP logging %q: expected full, truncated or off", s)
+	}
+}
+
+// Field returns the client_ip log field for a request's remote address
+func (m IPLogging) Field(remoteAddr string) zap.Field {
+	if m == IPLoggingOff {
+		return zap.Skip()
+	}
+	return zap.String("client_ip", m.Format(remoteAddr))
+}
+
+// Format returns the part of a request's remote address that may be logged,
+// "" when none
+func (m IPLogging) Format(remoteAddr string) string {
+	switch m {
+	case IPLoggingOff:
+		return ""
+	case IPLoggingTruncated:
+		return TruncateIP(remoteAddr)
+	default:
+		return remoteAddr
+	}
+}
+
+// TruncateIP returns the network of an address (with or without port): the
+// /24 of IPv4 and the /48 of IPv6 addresses, or "" if it is not an IP address
+func TruncateIP(remoteAddr string) string {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
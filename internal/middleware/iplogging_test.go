@@ -0,0 +1,31 @@
+package middleware
+
+import "testing"
+
+func TestTruncateIP(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		want string
+	}{
+		{"203.0.113.42:51234", "203.0.113.0"},
+		{"203.0.113.42", "203.0.113.0"},
+		{"[2001:db8:1234:5678::1]:443", "2001:db8:1234::"},
+		{"::ffff:198.51.100.7", "198.51.100.0"},
+		{"@", ""},
+	} {
+		if got := TruncateIP(tc.addr); got != tc.want {
+			t.Errorf("TruncateIP(%q) = %q, want %q", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestParseIPLogging(t *testing.T) {
+	for in, want := range map[string]IPLogging{"": IPLoggingFull, "Truncated": IPLoggingTruncated, " off ": IPLoggingOff} {
+		if got, err := ParseIPLogging(in); err != nil || got != want {
+			t.Errorf("ParseIPLogging(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseIPLogging("hashed"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
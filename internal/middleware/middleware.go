@@ -2,13 +2,14 @@ package middleware
 
 import (
     "bytes"
-    "html/template"
     "net/http"
-    "regexp"
     "strings"
     "sync"
     "time"
 
+	"github.com/finki/badges/internal/accesslog"
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/commitid"
 	"go.uber.org/zap"
 )
 
@@ -23,13 +24,13 @@ type ErrorTemplateData struct {
 // ErrorHandler is a middleware that handles errors
 type ErrorHandler struct {
 	logger   *zap.Logger
-	template *template.Template
+	template *assets.Template
 }
 
 // NewErrorHandler creates a new error handler
 func NewErrorHandler(logger *zap.Logger) (*ErrorHandler, error) {
 	// Parse the error template
-	tmpl, err := template.ParseFiles("templates/error.html")
+	tmpl, err := assets.ParseTemplate("error.html")
 	if err != nil {
 		return nil, err
 	}
@@ -171,34 +172,42 @@ func NewSanitizer(logger *zap.Logger) *Sanitizer {
 	}
 }
 
+// commitIDPrefixes are the paths followed by a commit ID the sanitizer validates
+var commitIDPrefixes = []string{"/badge/", "/certificate/", "/details/", "/edit/"}
+
+// reservedPaths are routes below commitIDPrefixes that take no commit ID
+var reservedPaths = map[string]bool{"/badge/composite": true, "/badge/latest": true}
+
 // Middleware returns a middleware function that sanitizes input
 func (s *Sanitizer) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Validate commit ID
-		if r.URL.Path != "/" && r.URL.Path != "/certificates" {
-			// Extract commit ID from URL
-			var commitID string
-			pathLen := len(r.URL.Path)
-
-			if pathLen >= 7 && r.URL.Path[:7] == "/badge/" {
-				commitID = r.URL.Path[7:]
-			} else if pathLen >= 13 && r.URL.Path[:13] == "/certificate/" {
-				commitID = r.URL.Path[13:]
-			} else if pathLen >= 9 && r.URL.Path[:9] == "/details/" {
-				commitID = r.URL.Path[9:]
+		// Validate the commit ID of pages addressing a badge
+		var commitID, rest string
+		if !reservedPaths[r.URL.Path] {
+			for _, prefix := range commitIDPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					rest = strings.TrimPrefix(r.URL.Path, prefix)
+					commitID = rest
+					break
+				}
 			}
+		}
 
-			// Remove any trailing path segments
-			if idx := regexp.MustCompile(`[/]`).FindStringIndex(commitID); idx != nil {
-				commitID = commitID[:idx[0]]
-			}
+		// Remove any trailing path segments
+		if idx := strings.Index(commitID, "/"); idx >= 0 {
+			commitID = commitID[:idx]
+		}
 
-			// Validate commit ID format (alphanumeric and underscore, 6-40 chars)
-			if commitID != "" && !regexp.MustCompile(`^[a-zA-Z0-9_-]{6,40}$`).MatchString(commitID) {
-				s.logger.Warn("Invalid commit ID format", zap.String("commit_id", commitID))
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
+		// Images may also be addressed by vanity path, resolved by their handlers
+		isImage := strings.HasPrefix(r.URL.Path, "/badge/") || strings.HasPrefix(r.URL.Path, "/certificate/")
+		if _, _, ok := commitid.ParseVanity(rest); ok && isImage {
+			commitID = ""
+		}
+
+		if commitID != "" && !commitid.Valid(commitID) {
+			s.logger.Warn("Invalid commit ID format", zap.String("commit_id", commitID))
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
 
 		// Call the next handler
@@ -214,6 +223,7 @@ type RateLimiter struct {
 	limit           int
 	window          time.Duration
 	cleanupInterval time.Duration
+	ipLogging       IPLogging
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -224,6 +234,7 @@ func NewRateLimiter(logger *zap.Logger, limit int, window time.Duration) *RateLi
 		limit:           limit,
 		window:          window,
 		cleanupInterval: time.Minute,
+		ipLogging:       IPLoggingFull,
 	}
 
 	// Start the cleanup goroutine
@@ -232,6 +243,11 @@ func NewRateLimiter(logger *zap.Logger, limit int, window time.Duration) *RateLi
 	return limiter
 }
 
+// SetIPLogging sets how much of a client's address is logged when it is limited
+func (rl *RateLimiter) SetIPLogging(m IPLogging) {
+	rl.ipLogging = m
+}
+
 // Middleware returns a middleware function that limits the rate of requests
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -240,7 +256,7 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 
 		// Check if the client has exceeded the rate limit
 		if rl.isLimited(clientIP) {
-			rl.logger.Warn("Rate limit exceeded", zap.String("client_ip", clientIP))
+			rl.logger.Warn("Rate limit exceeded", rl.ipLogging.Field(clientIP))
 			w.WriteHeader(http.StatusTooManyRequests)
 			return
 		}
@@ -314,16 +330,39 @@ func (rl *RateLimiter) cleanup() {
 
 // RequestLogger is a middleware that logs HTTP requests
 type RequestLogger struct {
-    logger *zap.Logger
+    logger    *zap.Logger
+    ipLogging IPLogging
+    // access, when set, receives every request instead of the Debug entries
+    access    *accesslog.Logger
+    // slow is the duration past which requests are logged as warnings
+    slow      time.Duration
 }
 
 // NewRequestLogger creates a new request logger
 func NewRequestLogger(logger *zap.Logger) *RequestLogger {
 	return &RequestLogger{
-		logger: logger,
+		logger:    logger,
+		ipLogging: IPLoggingFull,
 	}
 }
 
+// SetIPLogging sets how much of a client's address is logged
+func (rl *RequestLogger) SetIPLogging(m IPLogging) {
+	rl.ipLogging = m
+}
+
+// SetAccessLog writes requests to an access log of their own rather than to
+// the application log at Debug level
+func (rl *RequestLogger) SetAccessLog(l *accesslog.Logger) {
+	rl.access = l
+}
+
+// SetSlowThreshold logs requests taking longer than d at Warn level, whatever
+// the access log; 0 disables it
+func (rl *RequestLogger) SetSlowThreshold(d time.Duration) {
+	rl.slow = d
+}
+
 // Middleware returns a middleware function that logs HTTP requests
 func (rl *RequestLogger) Middleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -339,12 +378,38 @@ func (rl *RequestLogger) Middleware(next http.Handler) http.Handler {
         // Calculate the request duration
         duration := time.Since(startTime)
 
+        if rl.slow > 0 && duration > rl.slow {
+            rl.logger.Warn("Slow HTTP request",
+                zap.String("method", r.Method),
+                zap.String("path", r.URL.Path),
+                zap.Int("status", sr.statusCode),
+                zap.Duration("duration", duration),
+                zap.Duration("threshold", rl.slow),
+            )
+        }
+
+        if rl.access != nil {
+            rl.access.Log(accesslog.Entry{
+                Time:      startTime,
+                Method:    r.Method,
+                URI:       r.URL.RequestURI(),
+                Proto:     r.Proto,
+                Status:    sr.statusCode,
+                Bytes:     sr.bytes,
+                Duration:  duration,
+                ClientIP:  rl.ipLogging.Format(r.RemoteAddr),
+                Referer:   r.Referer(),
+                UserAgent: r.UserAgent(),
+            })
+            return
+        }
+
         // Log the request at trace level (using Debug)
         rl.logger.Debug("HTTP request",
             zap.String("method", r.Method),
             zap.String("path", r.URL.Path),
             zap.String("query", r.URL.RawQuery),
-            zap.String("client_ip", r.RemoteAddr),
+            rl.ipLogging.Field(r.RemoteAddr),
             zap.Int("status", sr.statusCode),
             zap.Duration("duration", duration),
             zap.String("user_agent", r.UserAgent()),
@@ -357,6 +422,7 @@ type statusRecorder struct {
     http.ResponseWriter
     statusCode  int
     wroteHeader bool
+    bytes       int64
 }
 
 func (sr *statusRecorder) WriteHeader(code int) {
@@ -369,5 +435,13 @@ func (sr *statusRecorder) Write(b []byte) (int, error) {
     if !sr.wroteHeader {
         sr.WriteHeader(http.StatusOK)
     }
-    return sr.ResponseWriter.Write(b)
+    n, err := sr.ResponseWriter.Write(b)
+    sr.bytes += int64(n)
+    return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// extend the write deadline of long downloads
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+    return sr.ResponseWriter
 }
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Route groups sharing a time limit
+const (
+	// GroupImages are the badge and certificate images
+	GroupImages = "images"
+	// GroupAPI is the JSON API below /api/
+	GroupAPI = "api"
+	// GroupTransfer are the streamed backups, restores, exports, profiles and
+	// event streams, which extend their own write deadlines
+	GroupTransfer = "transfer"
+	// GroupPages are the HTML pages and every other route
+	GroupPages = "pages"
+)
+
+// transferPrefixes are the routes of GroupTransfer
+var transferPrefixes = []string{"/api/backup", "/api/restore", "/api/admin/export", "/api/events/stream", "/debug/"}
+
+// RouteGroup returns the group whose time limit applies to a request path
+func RouteGroup(path string) string {
+	for _, prefix := range transferPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return GroupTransfer
+		}
+	}
+	switch {
+	case strings.HasPrefix(path, "/badge/"), strings.HasPrefix(path, "/certificate/"):
+		return GroupImages
+	case strings.HasPrefix(path, "/api/"):
+		return GroupAPI
+	}
+	return GroupPages
+}
+
+// RouteTimeouts are the time limits of requests by route group; 0 disables
+// the limit of a group
+type RouteTimeouts map[string]time.Duration
+
+// DefaultRouteTimeouts returns the time limits used for unset groups. They
+// stay within the server's 15s write timeout; transfers have none.
+func DefaultRouteTimeouts() RouteTimeouts {
+	return RouteTimeouts{
+		GroupImages:   10 * time.Second,
+		GroupAPI:      14 * time.Second,
+		GroupTransfer: 0,
+		GroupPages:    10 * time.Second,
+	}
+}
+
+// ParseRouteTimeouts parses entries of the form "<group>=<duration>" separated
+// by commas over the default time limits, e.g. "images=5s,api=0". Groups are
+// images, api, transfer and pages.
+func ParseRouteTimeouts(spec string) (RouteTimeouts, error) {
+	timeouts := DefaultRouteTimeouts()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, value, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !ok {
+			return nil, fmt.Errorf("invalid route timeout %q: expected <group>=<duration>", entry)
+		}
+		if _, known := timeouts[group]; !known {
+			return nil, fmt.Errorf("invalid route timeout group %q: expected images, api, transfer or pages", group)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid route timeout %q: expected a duration that is not negative", entry)
+		}
+		timeouts[group] = d
+	}
+	return timeouts, nil
+}
+
+// Timeout is a middleware that bounds the time handlers take by route group.
+// A request past its limit has its context canceled and is answered with 503;
+// whatever its handler writes afterwards is discarded.
+type Timeout struct {
+	logger   *zap.Logger
+	timeouts RouteTimeouts
+}
+
+// NewTimeout creates a timeout middleware with the given limits
+func NewTimeout(logger *zap.Logger, timeouts RouteTimeouts) *Timeout {
+	return &Timeout{logger: logger, timeouts: timeouts}
+}
+
+// Middleware returns a middleware function that bounds request handling time
+func (t *Timeout) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := RouteGroup(r.URL.Path)
+		limit := t.timeouts[group]
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), limit)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header), statusCode: http.StatusOK}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			for k, vv := range tw.header {
+				w.Header()[k] = vv
+			}
+			w.WriteHeader(tw.statusCode)
+			_, _ = w.Write(tw.body.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			// A client that went away needs no answer
+			if ctx.Err() != context.DeadlineExceeded {
+				return
+			}
+			t.logger.Warn("Request timed out",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("group", group),
+				zap.Duration("timeout", limit),
+			)
+			w.Header().Set("Retry-After", "1")
+			if group == GroupAPI {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "Request timed out"})
+				return
+			}
+			http.Error(w, "Request timed out", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// timeoutWriter buffers a response until its handler returns in time
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	// timedOut is set once the response was answered with 503
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.statusCode = code
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.body.Write(b)
+}
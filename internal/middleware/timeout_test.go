@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRouteGroup(t *testing.T) {
+	for path, want := range map[string]string{
+		"/badge/abc1234":       GroupImages,
+		"/certificate/abc1234": GroupImages,
+		"/api/badges":          GroupAPI,
+		"/api/backup":          GroupTransfer,
+		"/api/admin/export":    GroupTransfer,
+		"/api/events/stream":   GroupTransfer,
+		"/api/events":          GroupAPI,
+		"/debug/pprof/":        GroupTransfer,
+		"/details/abc1234":     GroupPages,
+		"/":                    GroupPages,
+	} {
+		if got := RouteGroup(path); got != want {
+			t.Errorf("RouteGroup(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts, err := ParseRouteTimeouts(" images=5s, api=0 ")
+	if err != nil {
+		t.Fatalf("ParseRouteTimeouts: %v", err)
+	}
+	if timeouts[GroupImages] != 5*time.Second || timeouts[GroupAPI] != 0 || timeouts[GroupPages] != DefaultRouteTimeouts()[GroupPages] {
+		t.Errorf("unexpected timeouts %v", timeouts)
+	}
+	for _, spec := range []string{"images", "videos=5s", "api=soon", "pages=-1s"} {
+		if _, err := ParseRouteTimeouts(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	timeout := NewTimeout(zap.New(core), RouteTimeouts{GroupImages: 20 * time.Millisecond, GroupAPI: 20 * time.Millisecond})
+
+	canceled := make(chan bool, 1)
+	slow := timeout.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(time.Second):
+			canceled <- false
+		}
+		w.Write([]byte("late"))
+	}))
+
+	rec := httptest.NewRecorder()
+	slow.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/badges", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("expected a JSON 503, got %d: %s", rec.Code, rec.Body)
+	}
+	if !<-canceled {
+		t.Error("expected the handler's context to be canceled")
+	}
+	if strings.Contains(rec.Body.String(), "late") {
+		t.Error("expected writes after the timeout to be discarded")
+	}
+	if logs.FilterMessage("Request timed out").Len() != 1 {
+		t.Error("expected the timeout to be logged")
+	}
+
+	// Groups without a limit, and handlers within theirs, are served as is
+	rec = httptest.NewRecorder()
+	slow.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/details/abc1234", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "late" {
+		t.Errorf("expected pages to have no limit, got %d: %s", rec.Code, rec.Body)
+	}
+	<-canceled
+
+	fast := timeout.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<svg/>"))
+	}))
+	rec = httptest.NewRecorder()
+	fast.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/abc1234", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "image/svg+xml" || rec.Body.String() != "<svg/>" {
+		t.Errorf("expected the handler's response, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+}
+
+func TestSlowRequestLogging(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	rl := NewRequestLogger(zap.New(core))
+	rl.SetSlowThreshold(10 * time.Millisecond)
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	entries := logs.FilterMessage("Slow HTTP request").All()
+	if len(entries) != 1 || entries[0].ContextMap()["path"] != "/slow" {
+		t.Errorf("expected the slow request only to be logged, got %v", entries)
+	}
+}
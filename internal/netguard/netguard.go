@@ -0,0 +1,70 @@
+// Package netguard keeps the webhooks users configure, on API keys and chat
+// connectors, from reaching the server's own network: their hosts are
+// checked when they are saved, and the address actually dialed is checked
+// again when posting, since DNS answers may change.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for hosts reaching an address of the server's
+// own network
+var ErrPrivateAddress = errors.New("loopback, private, link-local and unspecified addresses are not allowed")
+
+// PublicAddress reports whether webhooks may be posted to ip
+func PublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// CheckHost resolves host and checks that all its addresses are public
+func CheckHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return fmt.Errorf("%s resolves to %s: %w", host, addr.IP, ErrPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// NewClient returns a client for posting to webhooks. It only connects to
+// public addresses, checked on the address actually dialed, and does not
+// follow redirects, which would post the payload to a host that was never
+// checked. Proxies from the environment are not used, since the check would
+// apply to the proxy instead of the webhook.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicAddress(ip) {
+				return fmt.Errorf("refusing to post to %s: %w", host, ErrPrivateAddress)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			return fmt.Errorf("refusing to follow the redirect to %s", req.URL.Host)
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHost(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		host string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"localhost", false},
+		{"10.0.0.8", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	} {
+		if err := CheckHost(ctx, tc.host); (err == nil) != tc.want {
+			t.Errorf("%q: expected accepted=%v, got %v", tc.host, tc.want, err)
+		}
+	}
+	if !PublicAddress(net.ParseIP("8.8.8.8")) || PublicAddress(net.ParseIP("172.16.0.1")) {
+		t.Errorf("unexpected PublicAddress result")
+	}
+}
+
+func TestClient(t *testing.T) {
+	// The address dialed is checked, whatever the host was when it was saved
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the server on a loopback address not to be posted to")
+	}))
+	defer srv.Close()
+	_, err := NewClient(time.Second).Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected the post to a loopback address to be refused, got %v", err)
+	}
+
+	// Redirects are not followed
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusTemporaryRedirect)
+	}))
+	defer redirect.Close()
+	client := NewClient(time.Second)
+	client.Transport = http.DefaultTransport
+	if _, err := client.Post(redirect.URL, "application/json", strings.NewReader("{}")); err == nil || !strings.Contains(err.Error(), "redirect") {
+		t.Errorf("expected the redirect to be refused, got %v", err)
+	}
+}
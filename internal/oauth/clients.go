@@ -0,0 +1,229 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SecretPrefix is the prefix of client secrets
+const SecretPrefix = "bcs_"
+
+// Client is the JSON representation of an OAuth2 client
+type Client struct {
+	ClientID string `json:"client_id"`
+	// ClientSecret is only returned when the client is registered
+	ClientSecret string               `json:"client_secret,omitempty"`
+	Name         string               `json:"name"`
+	Permissions  database.Permissions `json:"permissions"`
+	OrgID        string               `json:"org_id,omitempty"`
+	CreatedAt    time.Time            `json:"created_at"`
+	LastUsed     *time.Time           `json:"last_used,omitempty"`
+	Status       string               `json:"status"`
+}
+
+// ClientsHandler serves /api/oauth/clients and /api/oauth/clients/{id}
+type ClientsHandler struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+// NewClientsHandler creates a handler managing the clients in db
+func NewClientsHandler(db *database.DB, logger *zap.Logger) *ClientsHandler {
+	return &ClientsHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ServeHTTP dispatches on method and path. Organization administrators only
+// see and manage the clients of their organization.
+func (h *ClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/oauth/clients"), "/")
+	if strings.Contains(id, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("oauth_clients", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("oauth_clients", "write", http.HandlerFunc(h.create))
+	case id != "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("oauth_clients", "read", h.withClient(id, h.get))
+	case id != "" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("oauth_clients", "delete", h.withClient(id, h.revoke))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// withClient loads a client the caller may manage before calling fn
+func (h *ClientsHandler) withClient(id string, fn func(http.ResponseWriter, *http.Request, *database.OAuthClient)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := h.db.WithContext(r.Context()).GetOAuthClient(id)
+		if err != nil {
+			h.logger.Error("oauth: failed to get client", zap.String("client_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get client")
+			return
+		}
+		if client == nil || !auth.CanAccessOrg(r.Context(), client.OrgID) {
+			httpjson.Error(w, http.StatusNotFound, "Client not found")
+			return
+		}
+		fn(w, r, client)
+	})
+}
+
+// list returns the clients the caller may manage
+func (h *ClientsHandler) list(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.db.WithContext(r.Context()).ListOAuthClients()
+	if err != nil {
+		h.logger.Error("oauth: failed to list clients", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list clients")
+		return
+	}
+
+	resp := make([]Client, 0, len(clients))
+	for _, c := range clients {
+		if auth.CanAccessOrg(r.Context(), c.OrgID) {
+			resp = append(resp, ToJSON(c))
+		}
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single client
+func (h *ClientsHandler) get(w http.ResponseWriter, r *http.Request, client *database.OAuthClient) {
+	httpjson.Write(w, http.StatusOK, ToJSON(client))
+}
+
+// create registers a client acting as the caller, returning its secret once.
+// Clients may not be granted permissions the caller does not hold, nor be
+// registered while impersonating.
+func (h *ClientsHandler) create(w http.ResponseWriter, r *http.Request) {
+	// An impersonation must not outlive its token
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil && claims.Impersonated() {
+		httpjson.Error(w, http.StatusForbidden, "Impersonation tokens cannot register clients")
+		return
+	}
+
+	var req Client
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpjson.Error(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if err := auth.ValidatePermissions(req.Permissions); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for resource, actions := range req.Permissions {
+		for action, granted := range actions {
+			if granted && !auth.HasPermission(r.Context(), resource, action) {
+				httpjson.Error(w, http.StatusForbidden, fmt.Sprintf("Cannot grant %s:%s", resource, action))
+				return
+			}
+		}
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		h.logger.Error("oauth: failed to generate client secret", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create client")
+		return
+	}
+	permissions, err := json.Marshal(database.Permissions{}.Merge(req.Permissions))
+	if err != nil {
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create client")
+		return
+	}
+	client := &database.OAuthClient{
+		ClientID:    newClientID(),
+		SecretHash:  hash,
+		Name:        req.Name,
+		UserID:      auth.GetUserIDFromContext(r.Context()),
+		OrgID:       auth.GetOrgIDFromContext(r.Context()),
+		Permissions: string(permissions),
+		CreatedAt:   time.Now(),
+		Status:      "active",
+	}
+	if err := h.db.WithContext(r.Context()).CreateOAuthClient(client); err != nil {
+		h.logger.Error("oauth: failed to create client", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create client")
+		return
+	}
+
+	h.logger.Info("OAuth client registered", zap.String("client_id", client.ClientID), zap.String("name", client.Name), zap.String("user_id", client.UserID))
+	resp := ToJSON(client)
+	resp.ClientSecret = secret
+	httpjson.Write(w, http.StatusCreated, resp)
+}
+
+// revoke revokes a client; the tokens it holds are refused from then on
+func (h *ClientsHandler) revoke(w http.ResponseWriter, r *http.Request, client *database.OAuthClient) {
+	if err := h.db.WithContext(r.Context()).RevokeOAuthClient(client.ClientID); err != nil {
+		h.logger.Error("oauth: failed to revoke client", zap.String("client_id", client.ClientID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to revoke client")
+		return
+	}
+
+	h.logger.Info("OAuth client revoked", zap.String("client_id", client.ClientID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ToJSON converts a database client to its API representation
+func ToJSON(c *database.OAuthClient) Client {
+	permissions, _ := database.ParsePermissions(c.Permissions)
+	client := Client{
+		ClientID:    c.ClientID,
+		Name:        c.Name,
+		Permissions: permissions,
+		OrgID:       c.OrgID,
+		CreatedAt:   c.CreatedAt,
+		Status:      c.Status,
+	}
+	if c.LastUsed.Valid {
+		client.LastUsed = &c.LastUsed.Time
+	}
+	return client
+}
+
+// newClientID returns a random client ID
+func newClientID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSecret returns a random client secret and its bcrypt hash
+func newSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	secret = SecretPrefix + hex.EncodeToString(b)
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), auth.BcryptCost)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash client secret: %w", err)
+	}
+	return secret, string(hashed), nil
+}
@@ -0,0 +1,153 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestClientCredentials(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "oauth.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	auth.SetClientStore(db)
+	t.Cleanup(func() { auth.SetClientStore(nil) })
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil || admin == nil {
+		t.Fatalf("Expected default admin user, err: %v", err)
+	}
+	clients := NewClientsHandler(db, logger)
+	manage := func(method, path, body string, claims *auth.Claims) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r = r.WithContext(auth.AddClaimsToContext(r.Context(), claims))
+		rec := httptest.NewRecorder()
+		clients.ServeHTTP(rec, r)
+		return rec
+	}
+	adminClaims := &auth.Claims{UserID: admin.UserID, Permissions: database.Permissions{"*": {"*": true}}}
+
+	rec := manage(http.MethodPost, "/api/oauth/clients", `{"name": "ci", "permissions": {"badges": {"read": true, "write": true}}}`, adminClaims)
+	var client Client
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &client) != nil || !strings.HasPrefix(client.ClientSecret, SecretPrefix) {
+		t.Fatalf("expected the client with its secret, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Callers cannot grant more than they hold
+	writer := &auth.Claims{UserID: admin.UserID, Permissions: database.Permissions{"oauth_clients": {"write": true}, "badges": {"read": true}}}
+	if rec := manage(http.MethodPost, "/api/oauth/clients", `{"name": "x", "permissions": {"badges": {"write": true}}}`, writer); rec.Code != http.StatusForbidden {
+		t.Errorf("expected escalation to be refused, got %d", rec.Code)
+	}
+	impersonating := &auth.Claims{UserID: admin.UserID, Permissions: adminClaims.Permissions, Actor: &auth.Actor{UserID: "support-id"}}
+	if rec := manage(http.MethodPost, "/api/oauth/clients", `{"name": "x", "permissions": {"badges": {"read": true}}}`, impersonating); rec.Code != http.StatusForbidden {
+		t.Errorf("expected an impersonation to be refused, got %d", rec.Code)
+	}
+	if rec := manage(http.MethodGet, "/api/oauth/clients", "", adminClaims); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "client_secret") {
+		t.Errorf("expected the clients without secrets, got %d: %s", rec.Code, rec.Body)
+	}
+
+	tokens := NewTokenHandler(db, logger)
+	request := func(form url.Values, basicID, basicSecret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basicID != "" {
+			r.SetBasicAuth(url.QueryEscape(basicID), url.QueryEscape(basicSecret))
+		}
+		rec := httptest.NewRecorder()
+		tokens.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// Basic authentication with a narrowed scope
+	rec = request(url.Values{"grant_type": {"client_credentials"}, "scope": {"badges:read"}}, client.ClientID, client.ClientSecret)
+	var resp TokenResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.TokenType != "Bearer" || resp.Scope != "badges:read" || resp.ExpiresIn != 900 {
+		t.Fatalf("expected a token, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the token not to be cached")
+	}
+	claims, err := auth.ValidateToken(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if !claims.Client() || claims.UserID != admin.UserID || !claims.Permissions.Allows("badges", "read") || claims.Permissions.Allows("badges", "write") {
+		t.Errorf("expected a client token acting as the admin with badges:read, got %+v", claims)
+	}
+
+	// Credentials in the body, with every permission of the client
+	rec = request(url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {client.ClientSecret}}, "", "")
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Scope != "badges:read badges:write" {
+		t.Errorf("expected a token with the client's permissions, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		form       url.Values
+		id, secret string
+		status     int
+		code       string
+	}{
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}}, client.ClientID, "bcs_wrong", http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", url.Values{"grant_type": {"client_credentials"}}, "unknown", client.ClientSecret, http.StatusUnauthorized, "invalid_client"},
+		{"no credentials", url.Values{"grant_type": {"client_credentials"}}, "", "", http.StatusBadRequest, "invalid_request"},
+		{"password grant", url.Values{"grant_type": {"password"}}, client.ClientID, client.ClientSecret, http.StatusBadRequest, "unsupported_grant_type"},
+		{"scope beyond client", url.Values{"grant_type": {"client_credentials"}, "scope": {"users:write"}}, client.ClientID, client.ClientSecret, http.StatusBadRequest, "invalid_scope"},
+		{"malformed scope", url.Values{"grant_type": {"client_credentials"}, "scope": {"badges"}}, client.ClientID, client.ClientSecret, http.StatusBadRequest, "invalid_scope"},
+	} {
+		rec := request(tc.form, tc.id, tc.secret)
+		var e map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &e)
+		if rec.Code != tc.status || e["error"] != tc.code {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.name, tc.status, tc.code, rec.Code, rec.Body)
+		}
+	}
+
+	// Tokens are limited to the owner's current role and status
+	viewer, err := db.GetRoleByName("viewer")
+	if err != nil || viewer == nil {
+		t.Fatalf("Expected the viewer role, err: %v", err)
+	}
+	adminRoleID := admin.RoleID
+	admin.RoleID = viewer.RoleID
+	if err := db.UpdateUser(admin); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if claims, err := auth.ValidateToken(resp.AccessToken); err != nil || claims.Permissions.Allows("badges", "write") || !claims.Permissions.Allows("badges", "read") {
+		t.Errorf("expected the token to only read badges after the owner was demoted, got %+v (err %v)", claims, err)
+	}
+	admin.Status = "locked"
+	if err := db.UpdateUser(admin); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, err := auth.ValidateToken(resp.AccessToken); !errors.Is(err, auth.ErrUserNotActive) {
+		t.Errorf("expected the token of a locked owner to be refused, got %v", err)
+	}
+	admin.RoleID, admin.Status = adminRoleID, "active"
+	if err := db.UpdateUser(admin); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+
+	// Revoking the client ends the tokens it holds
+	if rec := manage(http.MethodDelete, "/api/oauth/clients/"+client.ClientID, "", adminClaims); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the client to be revoked, got %d", rec.Code)
+	}
+	if _, err := auth.ValidateToken(resp.AccessToken); !errors.Is(err, auth.ErrClientRevoked) {
+		t.Errorf("expected the token of a revoked client to be refused, got %v", err)
+	}
+	if rec := request(url.Values{"grant_type": {"client_credentials"}}, client.ClientID, client.ClientSecret); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked client to get no token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,198 @@
+// Package oauth lets services authenticate with the OAuth2 client-credentials
+// grant (RFC 6749, section 4.4) instead of long-lived API keys. Clients are
+// registered through /api/oauth/clients with the permissions they may
+// request, and exchange their credentials at /oauth/token for short-lived
+// tokens of the same kind users log in with.
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultTokenTTL is how long issued tokens are valid unless SetTokenTTL is
+// called
+const DefaultTokenTTL = 15 * time.Minute
+
+// GrantClientCredentials is the only grant type of the token endpoint
+const GrantClientCredentials = "client_credentials"
+
+func init() {
+	auth.RegisterResource("oauth_clients", "read", "write", "delete")
+}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// TokenHandler serves /oauth/token, issuing tokens to registered clients
+type TokenHandler struct {
+	db     *database.DB
+	logger *zap.Logger
+	ttl    time.Duration
+}
+
+// NewTokenHandler creates a token endpoint for the clients in db
+func NewTokenHandler(db *database.DB, logger *zap.Logger) *TokenHandler {
+	return &TokenHandler{
+		db:     db,
+		logger: logger,
+		ttl:    DefaultTokenTTL,
+	}
+}
+
+// SetTokenTTL sets how long issued tokens are valid
+func (h *TokenHandler) SetTokenTTL(ttl time.Duration) {
+	h.ttl = ttl
+}
+
+// ServeHTTP issues a token for a form-encoded client-credentials request.
+// Clients authenticate with HTTP Basic (client_secret_basic) or with
+// client_id and client_secret in the body (client_secret_post). The optional
+// scope narrows the permissions of the token to some of the client's, as
+// space-separated "resource:action" grants; without it the token carries
+// them all.
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "The token endpoint only accepts POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return
+	}
+
+	switch grant := r.PostForm.Get("grant_type"); grant {
+	case GrantClientCredentials:
+	case "":
+		writeError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("Grant type %q is not supported", grant))
+		return
+	}
+
+	clientID, secret, basic, err := credentials(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	client, err := db.GetOAuthClient(clientID)
+	if err != nil {
+		h.logger.Error("oauth: failed to get client", zap.String("client_id", clientID), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+		return
+	}
+	if client == nil || client.Status != "active" || VerifySecret(client.SecretHash, secret) != nil {
+		h.logger.Warn("OAuth client authentication failed", zap.String("client_id", clientID), zap.String("ip", r.RemoteAddr))
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	scope, err := grantedScope(client, r.PostForm.Get("scope"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	token, expiresAt, err := auth.GenerateClientToken(client.ClientID, client.Name, client.UserID, client.OrgID, scope, h.ttl)
+	if err != nil {
+		h.logger.Error("oauth: failed to generate token", zap.String("client_id", clientID), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "server_error", "Failed to issue token")
+		return
+	}
+	if err := db.UpdateOAuthClientLastUsed(client.ClientID, time.Now()); err != nil {
+		h.logger.Warn("oauth: failed to record client use", zap.String("client_id", clientID), zap.Error(err))
+	}
+
+	h.logger.Info("OAuth token issued", zap.String("client_id", client.ClientID), zap.String("scope", scope))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	httpjson.Write(w, http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Round(time.Second).Seconds()),
+		Scope:       scope,
+	})
+}
+
+// credentials returns the client ID and secret of a token request and
+// whether they came in the Authorization header. A request must use one
+// method only.
+func credentials(r *http.Request) (clientID, secret string, basic bool, err error) {
+	clientID, secret, basic = r.BasicAuth()
+	if basic {
+		if r.PostForm.Get("client_secret") != "" {
+			return "", "", false, errors.New("Use one client authentication method only")
+		}
+		// The credentials are form-encoded before Basic encoding (RFC 6749, section 2.3.1)
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return "", "", false, errors.New("Invalid client_id encoding")
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return "", "", false, errors.New("Invalid client_secret encoding")
+		}
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || secret == "" {
+		return "", "", false, errors.New("Client credentials are required")
+	}
+	return clientID, secret, basic, nil
+}
+
+// grantedScope returns the scope of a token for the requested scope, which
+// must not exceed the permissions of the client; an empty request grants all
+// of them
+func grantedScope(client *database.OAuthClient, requested string) (string, error) {
+	allowed, err := database.ParsePermissions(client.Permissions)
+	if err != nil {
+		return "", errors.New("Invalid permissions of client")
+	}
+	if requested == "" {
+		return auth.FormatScope(allowed), nil
+	}
+
+	permissions, err := auth.ParseScope(requested)
+	if err != nil {
+		return "", err
+	}
+	for resource, actions := range permissions {
+		for action := range actions {
+			if !allowed.Allows(resource, action) {
+				return "", fmt.Errorf("Scope %s:%s exceeds the permissions of the client", resource, action)
+			}
+		}
+	}
+	return auth.FormatScope(permissions), nil
+}
+
+// VerifySecret checks a client secret against its bcrypt hash
+func VerifySecret(hash, secret string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret))
+}
+
+// writeError writes an error response of the token endpoint (RFC 6749,
+// section 5.2)
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	httpjson.Write(w, status, map[string]string{"error": code, "error_description": description})
+}
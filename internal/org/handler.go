@@ -0,0 +1,106 @@
+// Package org serves the URL namespace of an organization:
+// /org/{org_id}/badge/{commit_id}, /org/{org_id}/certificate/{commit_id} and
+// /org/{org_id}/details/{commit_id} render the organization's badges, and
+// /org/{org_id}/ lists them.
+package org
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// SlugPattern limits organization IDs to lowercase URL-safe slugs
+var SlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+
+// Handler handles /org/{org_id}/... requests by checking that the badge belongs
+// to the organization and handing the request to the instance-level handler
+type Handler struct {
+	db       *database.DB
+	logger   *zap.Logger
+	handlers map[string]http.Handler
+}
+
+// NewHandler creates a new organization namespace handler. handlers maps the
+// path segment after the organization ID (badge, certificate, details) to the
+// handler serving /{segment}/{commit_id}.
+func NewHandler(db *database.DB, logger *zap.Logger, handlers map[string]http.Handler) *Handler {
+	return &Handler{
+		db:       db,
+		logger:   logger,
+		handlers: handlers,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the organization namespace
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/org/"), "/", 3)
+	orgID := parts[0]
+	if !SlugPattern.MatchString(orgID) {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	org, err := db.GetOrganization(orgID)
+	if err != nil {
+		h.logger.Error("Failed to get organization", zap.Error(err), zap.String("org_id", orgID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if org == nil {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	// The namespace root is the list page filtered to the organization
+	if len(parts) == 1 || parts[1] == "" {
+		http.Redirect(w, r, "/certificates?"+url.Values{"org": {orgID}}.Encode(), http.StatusFound)
+		return
+	}
+
+	next, ok := h.handlers[parts[1]]
+	if !ok || len(parts) < 3 || parts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	commitID := strings.Split(parts[2], "/")[0]
+	if !commitid.Valid(commitID) {
+		http.Error(w, "Invalid commit ID", http.StatusBadRequest)
+		return
+	}
+
+	badge, err := db.GetBadge(commitID)
+	if err != nil {
+		h.logger.Error("Failed to get badge", zap.Error(err), zap.String("commit_id", commitID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if badge == nil {
+		canonical, err := db.ResolveBadgeID(commitID)
+		if err != nil {
+			h.logger.Error("Failed to resolve badge ID", zap.Error(err), zap.String("commit_id", commitID))
+		}
+		if canonical != "" && canonical != commitID {
+			commitid.Redirect(w, r, "/org/"+orgID+"/"+parts[1]+"/", commitID, canonical)
+			return
+		}
+	}
+	if badge == nil || badge.OrgID.String != orgID {
+		http.Error(w, "Badge not found", http.StatusNotFound)
+		return
+	}
+
+	// Serve the instance-level route; the badge renders with the organization
+	// theme either way
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + parts[1] + "/" + parts[2]
+	r2.URL.RawPath = ""
+	next.ServeHTTP(w, r2)
+}
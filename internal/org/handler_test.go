@@ -0,0 +1,74 @@
+package org
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestOrgNamespace(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "org.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for _, id := range []string{"geant", "other"} {
+		if err := db.CreateOrganization(&database.Organization{OrgID: id, Name: id, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+	}
+	for commitID, orgID := range map[string]string{"geant12": "geant", "other12": "other", "plain12": ""} {
+		if err := db.CreateBadge(&database.Badge{
+			CommitID:  commitID,
+			Type:      "badge",
+			Status:    "valid",
+			IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			OrgID:     sql.NullString{String: orgID, Valid: orgID != ""},
+		}); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+
+	var served string
+	badge := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r.URL.Path
+	})
+	h := NewHandler(db, logger, map[string]http.Handler{"badge": badge})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/org/geant/badge/geant12/small", nil))
+	if rec.Code != http.StatusOK || served != "/badge/geant12/small" {
+		t.Errorf("Expected delegation to /badge/geant12/small, got %d %q", rec.Code, served)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/org/geant/", nil))
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/certificates?org=geant" {
+		t.Errorf("Expected a redirect to the filtered list, got %d %q", rec.Code, loc)
+	}
+
+	for url, status := range map[string]int{
+		"/org/geant/badge/other12":   http.StatusNotFound,
+		"/org/geant/badge/plain12":   http.StatusNotFound,
+		"/org/geant/badge/missing1":  http.StatusNotFound,
+		"/org/geant/unknown/geant12": http.StatusNotFound,
+		"/org/unknown/badge/geant12": http.StatusNotFound,
+		"/org/geant/badge/bad!id":    http.StatusBadRequest,
+		"/org/Bad%20Org/badge/x":     http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d", url, status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Package orgapi manages organizations over a JSON API. Instance-wide
+// administrators create and delete organizations; organization admins can read
+// and update their own, e.g. to change its theme.
+package orgapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/chat"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/forge"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/org"
+	"github.com/finki/badges/internal/theme"
+	"go.uber.org/zap"
+)
+
+// Organization is the JSON representation of an organization
+type Organization struct {
+	OrgID string `json:"org_id"`
+	Name  string `json:"name"`
+	// Theme holds custom_config defaults (colors, logo, style) applied to the
+	// organization's badges
+	Theme *database.CustomConfig `json:"theme,omitempty"`
+	// Forges holds the GitHub and GitLab credentials used to post commit
+	// statuses for the organization's badges; tokens are never returned
+	Forges []database.Forge `json:"forges,omitempty"`
+	// Connectors lists the chat channels notified about the organization's
+	// badges; webhook URLs are never returned
+	Connectors []database.Connector `json:"connectors,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// UpdateRequest changes the fields present in the request body; an empty theme
+// object clears the theme and an empty forges or connectors list removes them
+type UpdateRequest struct {
+	Name       *string                `json:"name,omitempty"`
+	Theme      *database.CustomConfig `json:"theme,omitempty"`
+	Forges     *[]database.Forge      `json:"forges,omitempty"`
+	Connectors *[]database.Connector  `json:"connectors,omitempty"`
+}
+
+// LogoSource resolves the logo reference of a theme, e.g. *logo.Resolver
+type LogoSource interface {
+	Resolve(ref string) (*theme.Logo, error)
+}
+
+// instanceOnly is the error for organization-scoped callers
+const instanceOnly = "Only instance administrators can create or delete organizations"
+
+// Handler serves /api/orgs and /api/orgs/{id}
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+	logos  LogoSource
+}
+
+// NewHandler creates a new organization API handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// SetLogoSource makes create and update reject theme logos that cannot be loaded
+func (h *Handler) SetLogoSource(src LogoSource) {
+	h.logos = src
+}
+
+// ServeHTTP dispatches on method and path. Organizations group users, so they
+// are guarded by the users permissions.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/orgs"), "/")
+	if strings.Contains(id, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("users", "write", auth.RequireInstanceWideMiddleware(instanceOnly, http.HandlerFunc(h.create)))
+	case r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", h.withOrg(id, h.get))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		next = auth.RequirePermissionMiddleware("users", "write", h.withOrg(id, h.update))
+	case r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("users", "delete", auth.RequireInstanceWideMiddleware(instanceOnly, h.withOrg(id, h.delete)))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// withOrg loads the organization before calling fn. Organizations other than
+// the caller's own are reported as not found.
+func (h *Handler) withOrg(id string, fn func(http.ResponseWriter, *http.Request, *database.Organization)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !org.SlugPattern.MatchString(id) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid organization ID")
+			return
+		}
+		o, err := h.db.WithContext(r.Context()).GetOrganization(id)
+		if err != nil {
+			h.logger.Error("orgapi: failed to get organization", zap.String("org_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get organization")
+			return
+		}
+		if o == nil || !auth.CanAccessOrg(r.Context(), o.OrgID) {
+			httpjson.Error(w, http.StatusNotFound, "Organization not found")
+			return
+		}
+		fn(w, r, o)
+	})
+}
+
+// list returns the organizations the caller can see
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.db.WithContext(r.Context()).ListOrganizations()
+	if err != nil {
+		h.logger.Error("orgapi: failed to list organizations", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list organizations")
+		return
+	}
+
+	resp := make([]Organization, 0, len(orgs))
+	for _, o := range orgs {
+		if auth.CanAccessOrg(r.Context(), o.OrgID) {
+			resp = append(resp, toJSON(o))
+		}
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single organization
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, o *database.Organization) {
+	httpjson.Write(w, http.StatusOK, toJSON(o))
+}
+
+// create validates and stores a new organization
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req Organization
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !org.SlugPattern.MatchString(req.OrgID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid organization ID: use 2-63 lowercase letters, digits, - or _")
+		return
+	}
+
+	existing, err := db.GetOrganization(req.OrgID)
+	if err != nil {
+		h.logger.Error("orgapi: failed to get organization", zap.String("org_id", req.OrgID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+	if existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Organization already exists")
+		return
+	}
+
+	now := time.Now()
+	o := &database.Organization{
+		OrgID:     req.OrgID,
+		Name:      strings.TrimSpace(req.Name),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.setTheme(o, req.Theme); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := setForges(r, o, req.Forges); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := setConnectors(r, o, req.Connectors); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if o.Name == "" {
+		httpjson.Error(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if err := db.CreateOrganization(o); err != nil {
+		h.logger.Error("orgapi: failed to create organization", zap.String("org_id", o.OrgID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+
+	httpjson.Write(w, http.StatusCreated, toJSON(o))
+}
+
+// update applies the fields present in the request body
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, o *database.Organization) {
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		o.Name = strings.TrimSpace(*req.Name)
+		if o.Name == "" {
+			httpjson.Error(w, http.StatusBadRequest, "name is required")
+			return
+		}
+	}
+	if req.Theme != nil {
+		if err := h.setTheme(o, req.Theme); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Forges != nil {
+		if err := setForges(r, o, *req.Forges); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Connectors != nil {
+		if err := setConnectors(r, o, *req.Connectors); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	o.UpdatedAt = time.Now()
+	if err := h.db.WithContext(r.Context()).UpdateOrganization(o); err != nil {
+		h.logger.Error("orgapi: failed to update organization", zap.String("org_id", o.OrgID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update organization")
+		return
+	}
+
+	h.invalidate(o.OrgID)
+	httpjson.Write(w, http.StatusOK, toJSON(o))
+}
+
+// delete removes an organization; its users and badges become instance-level
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, o *database.Organization) {
+	h.invalidate(o.OrgID)
+	if err := h.db.WithContext(r.Context()).DeleteOrganization(o.OrgID); err != nil {
+		h.logger.Error("orgapi: failed to delete organization", zap.String("org_id", o.OrgID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setTheme validates a theme and stores it on o; nil or an empty theme clears it
+func (h *Handler) setTheme(o *database.Organization, t *database.CustomConfig) error {
+	if t == nil || *t == (database.CustomConfig{}) {
+		o.Theme = sql.NullString{}
+		return nil
+	}
+	if t.StatusPreview != "" || t.Animated || t.Show != "" {
+		return fmt.Errorf("theme may only set colors, fonts, style and logo")
+	}
+	if t.LogoURL != "" && h.logos != nil {
+		if _, err := h.logos.Resolve(t.LogoURL); err != nil {
+			return fmt.Errorf("invalid theme logo: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("invalid theme: %w", err)
+	}
+	o.Theme = sql.NullString{String: string(data), Valid: true}
+	return nil
+}
+
+// setForges validates forge credentials and stores them on o. A forge without
+// a token keeps the token already stored for its host. Custom API URLs are
+// reserved to instance administrators, as the service sends requests there.
+func setForges(r *http.Request, o *database.Organization, forges []database.Forge) error {
+	existing, err := o.GetForges()
+	if err != nil {
+		existing = nil
+	}
+
+	seen := map[string]bool{}
+	for i := range forges {
+		f := &forges[i]
+		if err := forge.Validate(f); err != nil {
+			return err
+		}
+		if seen[f.Host] {
+			return fmt.Errorf("forge host %s is listed twice", f.Host)
+		}
+		seen[f.Host] = true
+		if f.APIURL != "" && auth.GetOrgIDFromContext(r.Context()) != "" {
+			return fmt.Errorf("api_url can only be set by instance administrators")
+		}
+		if f.Token == "" {
+			for _, e := range existing {
+				if e.Host == f.Host && e.Type == f.Type {
+					f.Token = e.Token
+				}
+			}
+		}
+		if f.Token == "" {
+			return fmt.Errorf("token is required for forge host %s", f.Host)
+		}
+	}
+
+	if err := o.SetForges(forges); err != nil {
+		return fmt.Errorf("invalid forges: %w", err)
+	}
+	return nil
+}
+
+// setConnectors validates chat connectors and stores them on o. A connector
+// without a URL keeps the URL already stored under its name.
+func setConnectors(r *http.Request, o *database.Organization, connectors []database.Connector) error {
+	existing, err := o.GetConnectors()
+	if err != nil {
+		existing = nil
+	}
+
+	seen := map[string]bool{}
+	for i := range connectors {
+		c := &connectors[i]
+		c.Name = strings.TrimSpace(c.Name)
+		if seen[c.Name] {
+			return fmt.Errorf("connector %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if strings.TrimSpace(c.URL) == "" {
+			for _, e := range existing {
+				if e.Name == c.Name {
+					c.URL = e.URL
+				}
+			}
+		}
+		if err := chat.Validate(r.Context(), c); err != nil {
+			return err
+		}
+	}
+
+	if err := o.SetConnectors(connectors); err != nil {
+		return fmt.Errorf("invalid connectors: %w", err)
+	}
+	return nil
+}
+
+// invalidate drops the cached renders and pages of the organization's badges
+func (h *Handler) invalidate(orgID string) {
+	badges, err := h.db.ListBadgesByOrg(orgID)
+	if err != nil {
+		h.logger.Error("orgapi: failed to list organization badges", zap.String("org_id", orgID), zap.Error(err))
+		return
+	}
+	for _, b := range badges {
+		h.cache.DeletePrefix("badge:" + b.CommitID + ":")
+		h.cache.DeletePrefix("certificate:" + b.CommitID + ":")
+		h.cache.Delete("details:" + b.CommitID)
+	}
+	h.cache.DeletePrefix("badges:list:")
+	h.cache.Delete("home:index")
+}
+
+// toJSON converts a database organization to its API representation
+func toJSON(o *database.Organization) Organization {
+	resp := Organization{
+		OrgID:     o.OrgID,
+		Name:      o.Name,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+	if o.Theme.Valid {
+		if t, err := o.GetTheme(); err == nil {
+			resp.Theme = t
+		}
+	}
+	if forges, err := o.GetForges(); err == nil {
+		for _, f := range forges {
+			f.Token = ""
+			resp.Forges = append(resp.Forges, f)
+		}
+	}
+	if connectors, err := o.GetConnectors(); err == nil {
+		for _, c := range connectors {
+			c.URL = ""
+			resp.Connectors = append(resp.Connectors, c)
+		}
+	}
+	return resp
+}
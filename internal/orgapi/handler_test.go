@@ -0,0 +1,206 @@
+package orgapi
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestOrganizationLifecycle(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	admin := testutil.APIKeyContext("", "users", "read", "write", "delete")
+
+	for _, id := range []string{"geant", "other"} {
+		rec := testutil.Serve(h, admin, http.MethodPost, "/api/orgs", Organization{
+			OrgID: id,
+			Name:  id,
+			Theme: &database.CustomConfig{ColorLeft: "#003f5f"},
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		body   Organization
+		status int
+	}{
+		{Organization{OrgID: "geant", Name: "Duplicate"}, http.StatusConflict},
+		{Organization{OrgID: "Bad ID", Name: "Bad"}, http.StatusBadRequest},
+		{Organization{OrgID: "nameless"}, http.StatusBadRequest},
+		{Organization{OrgID: "animated", Name: "Animated", Theme: &database.CustomConfig{Animated: true}}, http.StatusBadRequest},
+	} {
+		if rec := testutil.Serve(h, admin, http.MethodPost, "/api/orgs", tc.body); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.body.OrgID, tc.status, rec.Code)
+		}
+	}
+
+	orgAdmin := testutil.APIKeyContext("geant", "users", "read", "write", "delete")
+	rec := testutil.Serve(h, orgAdmin, http.MethodGet, "/api/orgs", nil)
+	var list []Organization
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].OrgID != "geant" {
+		t.Errorf("expected only the caller's organization, got %+v", list)
+	}
+
+	name := "GÉANT"
+	rec = testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{
+		Name:  &name,
+		Theme: &database.CustomConfig{ColorLeft: "#ffffff", Style: "flat"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := db.GetOrganization("geant")
+	theme, err := stored.GetTheme()
+	if err != nil || stored.Name != "GÉANT" || theme.ColorLeft != "#ffffff" || theme.Style != "flat" {
+		t.Errorf("unexpected stored organization %+v (theme %+v, err %v)", stored, theme, err)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/orgs/other", http.StatusNotFound},
+		{http.MethodPatch, "/api/orgs/other", http.StatusNotFound},
+		{http.MethodPost, "/api/orgs", http.StatusForbidden},
+		{http.MethodDelete, "/api/orgs/geant", http.StatusForbidden},
+	} {
+		if rec := testutil.Serve(h, orgAdmin, tc.method, tc.path, UpdateRequest{}); rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.status, rec.Code)
+		}
+	}
+
+	// Deleting an organization turns its badges into instance-level badges
+	if err := db.CreateBadge(&database.Badge{
+		CommitID:  "geant12",
+		Type:      "badge",
+		Status:    "valid",
+		IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		OrgID:     sql.NullString{String: "geant", Valid: true},
+	}); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+	if rec := testutil.Serve(h, admin, http.MethodDelete, "/api/orgs/geant", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if o, _ := db.GetOrganization("geant"); o != nil {
+		t.Error("expected the organization to be deleted")
+	}
+	if b, _ := db.GetBadge("geant12"); b == nil || b.OrgID.Valid {
+		t.Errorf("expected the badge to be kept without organization, got %+v", b)
+	}
+}
+
+func TestOrganizationForges(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	admin := testutil.APIKeyContext("", "users", "read", "write")
+	if rec := testutil.Serve(h, admin, http.MethodPost, "/api/orgs", Organization{
+		OrgID:  "geant",
+		Name:   "GÉANT",
+		Forges: []database.Forge{{Host: "GitHub.com", Token: "ghp_secret"}},
+	}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Tokens are stored but never returned
+	orgAdmin := testutil.APIKeyContext("geant", "users", "read", "write")
+	rec := testutil.Serve(h, orgAdmin, http.MethodGet, "/api/orgs/geant", nil)
+	if bytes.Contains(rec.Body.Bytes(), []byte("ghp_secret")) {
+		t.Errorf("expected the token to be redacted, got %s", rec.Body.String())
+	}
+	var got Organization
+	json.NewDecoder(rec.Body).Decode(&got)
+	if len(got.Forges) != 1 || got.Forges[0].Type != "github" || got.Forges[0].Host != "github.com" {
+		t.Errorf("unexpected forges %+v", got.Forges)
+	}
+
+	// Resubmitting the list without tokens keeps them
+	forges := append(got.Forges, database.Forge{Type: "gitlab", Host: "git.example.org", Token: "glpat-x"})
+	if rec := testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{Forges: &forges}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := db.GetOrganization("geant")
+	if sf, err := stored.GetForges(); err != nil || len(sf) != 2 || sf[0].Token != "ghp_secret" || sf[1].Token != "glpat-x" {
+		t.Errorf("unexpected stored forges %+v (err %v)", sf, err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		forges []database.Forge
+	}{
+		{"unknown type", []database.Forge{{Host: "git.example.org", Token: "x"}}},
+		{"missing token", []database.Forge{{Type: "gitlab", Host: "new.example.org"}}},
+		{"duplicate host", []database.Forge{{Host: "github.com", Token: "a"}, {Host: "github.com", Token: "b"}}},
+		{"api_url from an org admin", []database.Forge{{Host: "github.com", Token: "a", APIURL: "http://127.0.0.1:8080"}}},
+	} {
+		if rec := testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{Forges: &tc.forges}); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.name, rec.Code)
+		}
+	}
+
+	empty := []database.Forge{}
+	testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{Forges: &empty})
+	if stored, _ := db.GetOrganization("geant"); stored.Forges.Valid {
+		t.Errorf("expected an empty list to clear the forges, got %s", stored.Forges.String)
+	}
+}
+
+func TestOrganizationConnectors(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	admin := testutil.APIKeyContext("", "users", "read", "write")
+	hook := "https://hooks.slack.com/services/T000/B000/secret"
+	if rec := testutil.Serve(h, admin, http.MethodPost, "/api/orgs", Organization{
+		OrgID:      "geant",
+		Name:       "GÉANT",
+		Connectors: []database.Connector{{Name: "releases", Type: "slack", URL: hook}},
+	}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Webhook URLs are stored but never returned
+	orgAdmin := testutil.APIKeyContext("geant", "users", "read", "write")
+	rec := testutil.Serve(h, orgAdmin, http.MethodGet, "/api/orgs/geant", nil)
+	if bytes.Contains(rec.Body.Bytes(), []byte("secret")) {
+		t.Errorf("expected the webhook URL to be redacted, got %s", rec.Body.String())
+	}
+	var got Organization
+	json.NewDecoder(rec.Body).Decode(&got)
+	if len(got.Connectors) != 1 || got.Connectors[0].Name != "releases" || got.Connectors[0].URL != "" {
+		t.Fatalf("unexpected connectors %+v", got.Connectors)
+	}
+
+	// Resubmitting a connector without its URL keeps it
+	connectors := []database.Connector{{Name: "releases", Type: "slack", Events: []string{"revoked"}}}
+	if rec := testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{Connectors: &connectors}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := db.GetOrganization("geant")
+	if sc, err := stored.GetConnectors(); err != nil || len(sc) != 1 || sc[0].URL != hook || len(sc[0].Events) != 1 {
+		t.Errorf("unexpected stored connectors %+v (err %v)", sc, err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		connectors []database.Connector
+	}{
+		{"new connector without URL", []database.Connector{{Name: "alerts", Type: "teams"}}},
+		{"duplicate name", []database.Connector{{Name: "releases", Type: "slack"}, {Name: "releases", Type: "slack"}}},
+		{"plain http", []database.Connector{{Name: "chat", Type: "mattermost", URL: "http://chat.example.org/hooks/x"}}},
+	} {
+		if rec := testutil.Serve(h, orgAdmin, http.MethodPatch, "/api/orgs/geant", UpdateRequest{Connectors: &tc.connectors}); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.name, rec.Code)
+		}
+	}
+}
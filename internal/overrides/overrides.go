@@ -0,0 +1,191 @@
+// Package overrides decides which rendering query parameters, such as
+// color_left or logo, public badge and certificate images honor, so that
+// official certificates cannot be recolored under the service's domain. The
+// instance policy applies unless a badge names its own in the
+// public_overrides setting of its custom_config; signed-in users with
+// badges:write preview every parameter, and URLs they sign with Sign honor
+// every parameter for anyone until they expire.
+package overrides
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+)
+
+// None is the policy entry honoring no parameter
+const None = "none"
+
+// names are the query parameters that change the look of a badge or
+// certificate
+var names = map[string]bool{
+	"color_left": true, "color_right": true, "text_color": true, "text_color_left": true, "text_color_right": true,
+	"logo": true, "font_size": true, "style": true, "status_preview": true, "theme": true, "show": true, "animated": true,
+}
+
+// Default are the parameters honored unless configured otherwise: they adapt
+// the presentation, but not the colors, logo or status of the badge
+var Default = []string{"animated", "font_size", "show", "style", "theme"}
+
+// Names returns the parameters a policy can allow, sorted
+func Names() []string {
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Policy is the set of parameters honored in public renders
+type Policy struct {
+	allowed map[string]bool
+}
+
+// NewPolicy creates a policy honoring the named parameters; "none" honors
+// none
+func NewPolicy(list []string) (*Policy, error) {
+	p := &Policy{allowed: make(map[string]bool, len(list))}
+	for _, name := range list {
+		name = strings.TrimSpace(name)
+		if name == "" || name == None {
+			continue
+		}
+		if !names[name] {
+			return nil, fmt.Errorf("unknown parameter %q: expected none or some of %s", name, strings.Join(Names(), ", "))
+		}
+		p.allowed[name] = true
+	}
+	return p, nil
+}
+
+// Parse parses the comma-separated public_overrides setting of a badge
+func Parse(setting string) (*Policy, error) {
+	return NewPolicy(strings.Split(setting, ","))
+}
+
+// Allows reports whether the policy honors the named parameter
+func (p *Policy) Allows(name string) bool {
+	return p.allowed[name]
+}
+
+// String lists the honored parameters, e.g. for logs
+func (p *Policy) String() string {
+	list := make([]string, 0, len(p.allowed))
+	for name := range p.allowed {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	if len(list) == 0 {
+		return None
+	}
+	return strings.Join(list, ", ")
+}
+
+var (
+	mu      sync.RWMutex
+	current = mustPolicy(Default)
+)
+
+func mustPolicy(list []string) *Policy {
+	p, err := NewPolicy(list)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Set makes p the instance policy
+func Set(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Get returns the instance policy, honoring Default unless another one is set
+func Get() *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// ForBadge returns the policy of b: its public_overrides setting, or the
+// instance policy without a valid one
+func ForBadge(b *database.Badge) *Policy {
+	config, err := b.GetCustomConfig()
+	if err != nil || config.PublicOverrides == "" {
+		return Get()
+	}
+	p, err := Parse(config.PublicOverrides)
+	if err != nil {
+		return Get()
+	}
+	return p
+}
+
+// CanPreview reports whether r is made by a user allowed to use every
+// parameter
+func CanPreview(r *http.Request) bool {
+	claims := auth.GetClaimsFromContext(r.Context())
+	return claims != nil && claims.Permissions.Allows("badges", "write")
+}
+
+// Preview reports whether r previews parameters beyond a public policy: the
+// render must then bypass the caches shared with anonymous requests
+func Preview(r *http.Request) bool {
+	if !CanPreview(r) {
+		return false
+	}
+	q := r.URL.Query()
+	for name := range names {
+		if q.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// NoCache reports whether r bypasses the caches: with no_cache=true from a
+// signed-in user, so that anonymous requests cannot force renders, or for a
+// preview
+func NoCache(r *http.Request) bool {
+	if Preview(r) {
+		return true
+	}
+	return r.URL.Query().Get("no_cache") == "true" && auth.GetClaimsFromContext(r.Context()) != nil
+}
+
+// Query returns the query parameters of r to render b with: all of them for
+// a user who can preview or a signed URL, otherwise without the parameters
+// b's policy does not honor
+func Query(r *http.Request, b *database.Badge) url.Values {
+	q := r.URL.Query()
+	if CanPreview(r) || Signed(r) {
+		return q
+	}
+	p := ForBadge(b)
+	for name := range q {
+		if names[name] && !p.Allows(name) {
+			q.Del(name)
+		}
+	}
+	return q
+}
+
+// CacheQuery returns the parameters of r named in params in the canonical
+// form of httpcache.Query, marking signed URLs, whose renders differ from
+// those of the same unsigned parameters
+func CacheQuery(r *http.Request, params ...string) string {
+	query := httpcache.Query(r.URL.Query(), params...)
+	if Signed(r) {
+		query += "&signed"
+	}
+	return query
+}
@@ -0,0 +1,101 @@
+package overrides
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+)
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy([]string{"theme", " show", ""})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if !p.Allows("theme") || !p.Allows("show") || p.Allows("color_left") || p.String() != "show, theme" {
+		t.Errorf("unexpected policy %s", p)
+	}
+	if p, err := NewPolicy([]string{None}); err != nil || p.String() != None {
+		t.Errorf("expected an empty policy, got %v (err %v)", p, err)
+	}
+	if _, err := NewPolicy([]string{"format"}); err == nil {
+		t.Error("expected parameters other than overrides to be rejected")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	b := &database.Badge{CommitID: "abc123"}
+	r := httptest.NewRequest("GET", "/badge/abc123?format=png&theme=dark&color_left=%23123456&logo=x", nil)
+
+	q := Query(r, b)
+	if q.Get("format") != "png" || q.Get("theme") != "dark" || q.Get("color_left") != "" || q.Get("logo") != "" {
+		t.Errorf("expected the default policy, got %v", q)
+	}
+	if Preview(r) {
+		t.Error("expected anonymous requests not to preview")
+	}
+
+	// A badge's own policy replaces the instance policy
+	b.CustomConfig = sql.NullString{String: `{"public_overrides":"color_left"}`, Valid: true}
+	if q := Query(r, b); q.Get("color_left") != "#123456" || q.Get("theme") != "" {
+		t.Errorf("expected the badge policy, got %v", q)
+	}
+
+	claims := &auth.Claims{UserID: "user-id"}
+	claims.Permissions = database.Permissions{"badges": {"write": true}}
+	r = r.WithContext(auth.AddClaimsToContext(r.Context(), claims))
+	if q := Query(r, b); q.Get("logo") != "x" || !Preview(r) {
+		t.Errorf("expected writers to preview every parameter, got %v", q)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	r := httptest.NewRequest("GET", "/badge/abc123?no_cache=true", nil)
+	if NoCache(r) {
+		t.Error("expected anonymous requests not to bypass the cache")
+	}
+	r = r.WithContext(auth.AddClaimsToContext(r.Context(), &auth.Claims{UserID: "user-id"}))
+	if !NoCache(r) {
+		t.Error("expected signed-in users to bypass the cache")
+	}
+}
+
+func TestSign(t *testing.T) {
+	if _, err := Sign("/badge/abc123", nil, time.Now().Add(time.Hour)); err != ErrNoSigningKey {
+		t.Errorf("expected ErrNoSigningKey, got %v", err)
+	}
+	SetSigningKey([]byte("test-secret"))
+	t.Cleanup(func() { SetSigningKey(nil) })
+
+	q, err := Sign("/badge/abc123", url.Values{"color_left": {"#123456"}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	for path, want := range map[string]bool{
+		"/badge/abc123?" + q.Encode():                                         true,
+		"/badge/other1?" + q.Encode():                                         false,
+		"/badge/abc123?" + strings.Replace(q.Encode(), "123456", "654321", 1): false,
+		"/badge/abc123?" + q.Encode() + "&logo=x":                             false,
+	} {
+		if got := Signed(httptest.NewRequest("GET", path, nil)); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+
+	expired, _ := Sign("/badge/abc123", nil, time.Now().Add(-time.Minute))
+	r := httptest.NewRequest("GET", "/badge/abc123?"+expired.Encode(), nil)
+	if Signed(r) {
+		t.Error("expected an expired URL not to verify")
+	}
+
+	// Signed URLs honor every parameter and have their own cache entries
+	r = httptest.NewRequest("GET", "/badge/abc123?"+q.Encode(), nil)
+	if Query(r, &database.Badge{}).Get("color_left") != "#123456" || CacheQuery(r, "color_left") != "color_left=%23123456&signed" {
+		t.Errorf("expected the signed parameters, got %q", CacheQuery(r, "color_left"))
+	}
+}
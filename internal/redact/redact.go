@@ -0,0 +1,128 @@
+// Package redact hides badge fields a deployment considers sensitive from
+// public views. The policy is configured once and applied by the details
+// page, the list, software and issuer JSON, and so the static export too;
+// viewers with a badges permission for the badge still see every field.
+package redact
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// SBOM is the field hiding the SBOM summary of the details page, which is
+// stored apart from the badge
+const SBOM = "sbom"
+
+// fields maps the JSON names of the fields that can be hidden to how they are
+// cleared. Fields identifying the badge, its status and dates cannot be.
+var fields = map[string]func(b *database.Badge){
+	"software_url":     func(b *database.Badge) { b.SoftwareURL = sql.NullString{} },
+	"issuer_url":       func(b *database.Badge) { b.IssuerURL = sql.NullString{} },
+	"notes":            func(b *database.Badge) { b.Notes = sql.NullString{} },
+	"last_review":      func(b *database.Badge) { b.LastReview = sql.NullTime{} },
+	"covered_version":  func(b *database.Badge) { b.CoveredVersion = sql.NullString{} },
+	"repositories":     func(b *database.Badge) { b.RepositoryLink = sql.NullString{} },
+	"public_note":      func(b *database.Badge) { b.PublicNote = sql.NullString{} },
+	"contact_details":  func(b *database.Badge) { b.ContactDetails = sql.NullString{} },
+	"specialty_domain": func(b *database.Badge) { b.SpecialtyDomain = sql.NullString{} },
+	"software_sc_id": func(b *database.Badge) {
+		b.SoftwareSCID = sql.NullString{}
+		b.SoftwareSCURL = sql.NullString{}
+	},
+	"git_repository": func(b *database.Badge) { b.GitRepository = sql.NullString{} },
+	"git_commit_sha": func(b *database.Badge) { b.GitCommitSHA = sql.NullString{} },
+	"git_tag":        func(b *database.Badge) { b.GitTag = sql.NullString{} },
+	SBOM:             func(b *database.Badge) {},
+}
+
+// Fields returns the names of the fields a policy can hide, sorted
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Policy is the set of fields hidden from public views
+type Policy struct {
+	hidden map[string]bool
+}
+
+// NewPolicy creates a policy hiding the named fields, by their JSON names
+// in the details API, e.g. contact_details or repositories
+func NewPolicy(names []string) (*Policy, error) {
+	p := &Policy{hidden: make(map[string]bool, len(names))}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q: expected one of %s", name, strings.Join(Fields(), ", "))
+		}
+		p.hidden[name] = true
+	}
+	return p, nil
+}
+
+// Hides reports whether the policy hides the named field
+func (p *Policy) Hides(name string) bool {
+	return p.hidden[name]
+}
+
+// Empty reports whether the policy hides nothing
+func (p *Policy) Empty() bool {
+	return len(p.hidden) == 0
+}
+
+// Badge returns b with the hidden fields cleared. b itself is not modified,
+// and is returned as is when nothing is hidden.
+func (p *Policy) Badge(b *database.Badge) *database.Badge {
+	if b == nil || p.Empty() {
+		return b
+	}
+	redacted := *b
+	for name := range p.hidden {
+		fields[name](&redacted)
+	}
+	return &redacted
+}
+
+// String lists the hidden fields, e.g. for logs
+func (p *Policy) String() string {
+	names := make([]string, 0, len(p.hidden))
+	for name := range p.hidden {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+var (
+	mu      sync.RWMutex
+	current = &Policy{}
+)
+
+// Set makes p the policy applied to public views
+func Set(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Get returns the active policy, hiding nothing unless another one is set
+func Get() *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
@@ -0,0 +1,59 @@
+package redact
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+)
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy([]string{"contact_details", " repositories", ""})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if !p.Hides("contact_details") || !p.Hides("repositories") || p.Hides("notes") {
+		t.Errorf("unexpected policy %s", p)
+	}
+	if _, err := NewPolicy([]string{"software_name"}); err == nil {
+		t.Error("expected fields identifying the badge not to be redactable")
+	}
+	if p, _ := NewPolicy(nil); !p.Empty() || p.String() != "none" {
+		t.Errorf("expected an empty policy, got %s", p)
+	}
+}
+
+func TestPolicyBadge(t *testing.T) {
+	b := &database.Badge{
+		CommitID:       "abc123",
+		SoftwareName:   "App",
+		ContactDetails: sql.NullString{String: "alice@example.org", Valid: true},
+		SoftwareSCID:   sql.NullString{String: "app", Valid: true},
+		SoftwareSCURL:  sql.NullString{String: "https://sc.geant.org/ui/project/app", Valid: true},
+		Notes:          sql.NullString{String: "public", Valid: true},
+	}
+	p, err := NewPolicy([]string{"contact_details", "software_sc_id"})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	got := p.Badge(b)
+	if got.ContactDetails.Valid || got.SoftwareSCID.Valid || got.SoftwareSCURL.Valid {
+		t.Errorf("expected the hidden fields to be cleared, got %+v", got)
+	}
+	if got.CommitID != "abc123" || got.Notes.String != "public" {
+		t.Errorf("expected the other fields to be kept, got %+v", got)
+	}
+	if !b.ContactDetails.Valid || !b.SoftwareSCID.Valid {
+		t.Error("expected the original badge not to be modified")
+	}
+
+	// Every field can be hidden
+	all, err := NewPolicy(Fields())
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if all.Badge(b).ContactDetails.Valid {
+		t.Error("expected a policy of every field to clear contact details")
+	}
+}
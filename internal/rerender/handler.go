@@ -0,0 +1,45 @@
+package rerender
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/jobs"
+	"go.uber.org/zap"
+)
+
+// ServeHTTP serves POST /api/admin/rerender: it queues a job for the badges
+// matching ?type= and ?issuer= (or a JSON body of both) and answers 202
+// Accepted with the job, whose progress /api/admin/jobs/{id} reports.
+// Stored images are shared by the whole instance, so organization-scoped
+// callers are refused.
+func (rr *Rerenderer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if auth.GetOrgIDFromContext(r.Context()) != "" {
+		httpjson.Error(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	f := Filter{Type: r.URL.Query().Get("type"), Issuer: r.URL.Query().Get("issuer")}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	job, err := rr.queue.Enqueue(r.Context(), Kind, f)
+	if err != nil {
+		rr.logger.Error("rerender: failed to queue job", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to queue job")
+		return
+	}
+	w.Header().Set("Location", "/api/admin/jobs/"+strconv.FormatInt(job.JobID, 10))
+	httpjson.Write(w, http.StatusAccepted, jobs.ToJSON(job))
+}
@@ -0,0 +1,162 @@
+// Package rerender regenerates the stored images of badges in the background,
+// e.g. after a certificate template or the theme changed. POST
+// /api/admin/rerender queues a job in the job queue; for each matching badge
+// it drops the stored renders and renders them again through the image
+// handlers, so that the stored and cached images match what a request would
+// now get.
+package rerender
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/jobs"
+	"go.uber.org/zap"
+)
+
+// Kind is the job kind of re-renders
+const Kind = "rerender"
+
+// Formats are the stored formats that are rendered again
+var Formats = []string{"png", "jpg"}
+
+// Filter selects the badges a job re-renders; empty fields match every badge
+type Filter struct {
+	Type   string `json:"type,omitempty"`
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// matches reports whether b is selected by f
+func (f Filter) matches(b *database.Badge) bool {
+	return (f.Type == "" || b.Type == f.Type) && (f.Issuer == "" || b.Issuer == f.Issuer)
+}
+
+// Progress is the progress a re-render job reports
+type Progress struct {
+	// Total is the number of matching badges
+	Total int `json:"total"`
+	// Done counts the processed badges, Failed those of them that could
+	// not be rendered
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+}
+
+// Rerenderer queues and runs re-render jobs
+type Rerenderer struct {
+	queue  *jobs.Queue
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+	// routes are the image handlers by name, "badge" and "certificate"
+	routes map[string]http.Handler
+}
+
+// New creates a rerenderer rendering images with routes and registers its
+// jobs with queue. The handlers should not count requests, as re-rendering
+// would show up in the statistics.
+func New(queue *jobs.Queue, db *database.DB, logger *zap.Logger, cache *cache.Cache, routes map[string]http.Handler) *Rerenderer {
+	rr := &Rerenderer{queue: queue, db: db, logger: logger, cache: cache, routes: routes}
+	queue.Register(Kind, rr.run)
+	return rr
+}
+
+// run renders the badges selected by a job again. Badges that fail to render
+// are counted in the progress rather than failing the job, which would
+// render every badge again.
+func (rr *Rerenderer) run(ctx context.Context, job *jobs.Job) error {
+	var f Filter
+	if err := job.Decode(&f); err != nil {
+		return err
+	}
+
+	badges, err := rr.db.WithContext(ctx).ListBadges()
+	if err != nil {
+		return err
+	}
+	selected := make([]*database.Badge, 0, len(badges))
+	for _, b := range badges {
+		if f.matches(b) {
+			selected = append(selected, b)
+		}
+	}
+
+	progress := Progress{Total: len(selected)}
+	job.Report(progress)
+	for _, b := range selected {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !rr.rerenderBadge(ctx, b.CommitID) {
+			progress.Failed++
+		}
+		progress.Done++
+		job.Report(progress)
+	}
+	rr.logger.Info("rerender: badges rendered again",
+		zap.Int64("job", job.JobID),
+		zap.Int("badges", progress.Total),
+		zap.Int("failed", progress.Failed),
+	)
+	return nil
+}
+
+// rerenderBadge drops the stored and cached images of a badge and renders
+// them again, reporting whether every render succeeded
+func (rr *Rerenderer) rerenderBadge(ctx context.Context, commitID string) bool {
+	if err := rr.db.WithContext(ctx).ClearStoredImages(commitID); err != nil {
+		rr.logger.Error("rerender: failed to clear stored images", zap.String("commit_id", commitID), zap.Error(err))
+		return false
+	}
+	rr.cache.DeletePrefix("badge:" + commitID + ":")
+	rr.cache.DeletePrefix("certificate:" + commitID + ":")
+
+	ok := true
+	for _, endpoint := range []string{"badge", "certificate"} {
+		h, found := rr.routes[endpoint]
+		if !found {
+			continue
+		}
+		for _, format := range Formats {
+			target := "/" + endpoint + "/" + commitID + "?format=" + format
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				rr.logger.Error("rerender: failed to create request", zap.String("url", target), zap.Error(err))
+				ok = false
+				continue
+			}
+			rec := &recorder{header: http.Header{}}
+			h.ServeHTTP(rec, req)
+			if rec.status != 0 && rec.status != http.StatusOK {
+				rr.logger.Warn("rerender: image not rendered", zap.String("url", target), zap.Int("status", rec.status))
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// recorder keeps the status of a handler's response and discards the body,
+// which the handler has stored and cached
+type recorder struct {
+	header http.Header
+	status int
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return len(b), nil
+}
@@ -0,0 +1,102 @@
+package rerender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/jobs"
+	"go.uber.org/zap"
+)
+
+func TestRerender(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "rerender.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	for _, b := range []*database.Badge{
+		{CommitID: "geant123", Issuer: "GÉANT"},
+		{CommitID: "geant456", Issuer: "GÉANT"},
+		{CommitID: "other123", Issuer: "Other"},
+	} {
+		b.Type, b.Status, b.IssueDate, b.SoftwareName = "badge", "valid", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "App"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+		if err := db.UpdateBadgeImage(b.CommitID, "png", []byte("stale")); err != nil {
+			t.Fatalf("Failed to store image: %v", err)
+		}
+	}
+
+	c := cache.New()
+	c.Set("badge:geant123:png:native:format=png", []byte("stale"), time.Hour)
+
+	var rendered []string
+	render := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rendered = append(rendered, r.URL.String())
+		if strings.Contains(r.URL.Path, "geant456") {
+			http.Error(w, "Failed to generate image", http.StatusInternalServerError)
+		}
+	})
+	queue := jobs.New(db, logger, 1)
+	rr := New(queue, db, logger, c, map[string]http.Handler{"badge": render, "certificate": render})
+
+	serve := func(claims *auth.Claims) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/admin/rerender?issuer=GÉANT", nil)
+		if claims != nil {
+			r = r.WithContext(auth.AddClaimsToContext(r.Context(), claims))
+		}
+		rec := httptest.NewRecorder()
+		rr.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(nil)
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != "/api/admin/jobs/1" {
+		t.Fatalf("expected the job to be accepted, got %d %v", rec.Code, rec.Header())
+	}
+	if !queue.RunNext(context.Background()) {
+		t.Fatal("expected the job to run")
+	}
+
+	job, err := db.GetJob(1)
+	if err != nil || job == nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	var progress Progress
+	if err := json.Unmarshal([]byte(job.Progress.String), &progress); err != nil {
+		t.Fatalf("Failed to decode progress: %v", err)
+	}
+	if job.State != database.JobDone || progress != (Progress{Total: 2, Done: 2, Failed: 1}) {
+		t.Fatalf("unexpected job %s with progress %+v", job.State, progress)
+	}
+	if len(rendered) != 8 {
+		t.Errorf("expected 2 badges rendered in 2 formats by 2 handlers, got %v", rendered)
+	}
+	if _, found := c.Get("badge:geant123:png:native:format=png"); found {
+		t.Error("expected the cached image to be dropped")
+	}
+	for id, cleared := range map[string]bool{"geant123": true, "other123": false} {
+		b, err := db.GetBadge(id)
+		if err != nil {
+			t.Fatalf("Failed to get badge: %v", err)
+		}
+		if data, _ := db.GetBadgeImage(b, "png"); (data == nil) != cleared {
+			t.Errorf("%s: expected the stored image cleared: %v", id, cleared)
+		}
+	}
+
+	if rec := serve(&auth.Claims{UserID: "admin", OrgID: "org"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected organization-scoped callers to be refused, got %d", rec.Code)
+	}
+}
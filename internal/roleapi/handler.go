@@ -0,0 +1,352 @@
+// Package roleapi manages roles: named sets of permissions on resources that
+// users are given, each optionally inheriting the permissions of another role.
+package roleapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// roleNamePattern limits role names to lowercase URL-safe slugs
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+
+// Role is the JSON representation of a role
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Inherits names the role whose permissions this one adds to
+	Inherits    string               `json:"inherits,omitempty"`
+	Permissions database.Permissions `json:"permissions"`
+	// Effective are the permissions together with the inherited ones; they
+	// are ignored in requests
+	Effective database.Permissions `json:"effective_permissions,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// UpdateRequest changes the fields present in the request body; permissions
+// replace the role's own
+type UpdateRequest struct {
+	Description *string               `json:"description,omitempty"`
+	Inherits    *string               `json:"inherits,omitempty"`
+	Permissions *database.Permissions `json:"permissions,omitempty"`
+}
+
+// Handler serves /api/roles, /api/roles/{name} and /api/permissions
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+// NewHandler creates a new role API handler
+func NewHandler(db *database.DB, logger *zap.Logger) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ServeHTTP dispatches on method and path. Roles apply across the instance,
+// so only instance-wide administrators manage them.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/permissions" {
+		if r.Method != http.MethodGet {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		auth.RequirePermissionMiddleware("users", "read", http.HandlerFunc(h.resources)).ServeHTTP(w, r)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/roles"), "/")
+	if strings.Contains(name, "/") {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var next http.Handler
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", http.HandlerFunc(h.list))
+	case name == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("users", "write", http.HandlerFunc(h.create))
+	case r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("users", "read", h.withRole(name, h.get))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		next = auth.RequirePermissionMiddleware("users", "write", h.withRole(name, h.update))
+	case r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("users", "delete", h.withRole(name, h.delete))
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	auth.RequireInstanceWideMiddleware("Only instance administrators can manage roles", next).ServeHTTP(w, r)
+}
+
+// withRole loads the role before calling fn
+func (h *Handler) withRole(name string, fn func(http.ResponseWriter, *http.Request, *database.Role)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !roleNamePattern.MatchString(name) {
+			httpjson.Error(w, http.StatusBadRequest, "Invalid role name")
+			return
+		}
+		role, err := h.db.WithContext(r.Context()).GetRoleByName(name)
+		if err != nil {
+			h.logger.Error("roleapi: failed to get role", zap.String("role", name), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get role")
+			return
+		}
+		if role == nil {
+			httpjson.Error(w, http.StatusNotFound, "Role not found")
+			return
+		}
+		fn(w, r, role)
+	})
+}
+
+// resources returns the known resources and their actions
+func (h *Handler) resources(w http.ResponseWriter, r *http.Request) {
+	httpjson.Write(w, http.StatusOK, auth.Resources())
+}
+
+// list returns all roles
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+	roles, err := db.ListRoles()
+	if err != nil {
+		h.logger.Error("roleapi: failed to list roles", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list roles")
+		return
+	}
+
+	resp := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, ToJSON(db, role))
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single role
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, role *database.Role) {
+	httpjson.Write(w, http.StatusOK, ToJSON(h.db.WithContext(r.Context()), role))
+}
+
+// create validates and stores a new role
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req Role
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid role name: use 2-63 lowercase letters, digits, - or _")
+		return
+	}
+
+	existing, err := db.GetRoleByName(req.Name)
+	if err != nil {
+		h.logger.Error("roleapi: failed to get role", zap.String("role", req.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create role")
+		return
+	}
+	if existing != nil {
+		httpjson.Error(w, http.StatusConflict, "Role already exists")
+		return
+	}
+
+	now := time.Now()
+	role := &database.Role{
+		RoleID:      newRoleID(),
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Inherits:    strings.TrimSpace(req.Inherits),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.setPermissions(role, req.Permissions); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.checkInheritance(db, role); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := db.CreateRole(role); err != nil {
+		h.logger.Error("roleapi: failed to create role", zap.String("role", role.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create role")
+		return
+	}
+
+	auth.InvalidatePermissions()
+	h.logger.Info("Role created", zap.String("role", role.Name), zap.String("inherits", role.Inherits))
+	httpjson.Write(w, http.StatusCreated, ToJSON(db, role))
+}
+
+// update applies the fields present in the request body
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, role *database.Role) {
+	db := h.db.WithContext(r.Context())
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Description != nil {
+		role.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Permissions != nil {
+		if err := h.setPermissions(role, *req.Permissions); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Inherits != nil {
+		role.Inherits = strings.TrimSpace(*req.Inherits)
+		if err := h.checkInheritance(db, role); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	role.UpdatedAt = time.Now()
+	if err := db.UpdateRole(role); err != nil {
+		h.logger.Error("roleapi: failed to update role", zap.String("role", role.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update role")
+		return
+	}
+
+	auth.InvalidatePermissions()
+	h.logger.Info("Role updated", zap.String("role", role.Name), zap.String("inherits", role.Inherits))
+	httpjson.Write(w, http.StatusOK, ToJSON(db, role))
+}
+
+// delete removes a role no user has and no role inherits from. The admin
+// role stays, since the default administrator is created with it.
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, role *database.Role) {
+	db := h.db.WithContext(r.Context())
+
+	if role.Name == "admin" {
+		httpjson.Error(w, http.StatusBadRequest, "The admin role cannot be deleted")
+		return
+	}
+	users, err := db.CountUsersWithRole(role.RoleID)
+	if err != nil {
+		h.logger.Error("roleapi: failed to count users", zap.String("role", role.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete role")
+		return
+	}
+	if users > 0 {
+		httpjson.Error(w, http.StatusConflict, fmt.Sprintf("Role is assigned to %d users", users))
+		return
+	}
+	roles, err := db.ListRoles()
+	if err != nil {
+		h.logger.Error("roleapi: failed to list roles", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete role")
+		return
+	}
+	for _, other := range roles {
+		if other.Inherits == role.Name {
+			httpjson.Error(w, http.StatusConflict, fmt.Sprintf("Role %q inherits from it", other.Name))
+			return
+		}
+	}
+
+	if err := db.DeleteRole(role.RoleID); err != nil {
+		h.logger.Error("roleapi: failed to delete role", zap.String("role", role.Name), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete role")
+		return
+	}
+
+	auth.InvalidatePermissions()
+	h.logger.Info("Role deleted", zap.String("role", role.Name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setPermissions checks permissions against the known resources and stores
+// them on role
+func (h *Handler) setPermissions(role *database.Role, permissions database.Permissions) error {
+	if err := auth.ValidatePermissions(permissions); err != nil {
+		return err
+	}
+	if permissions == nil {
+		permissions = database.Permissions{}
+	}
+	return role.SetPermissions(permissions)
+}
+
+// checkInheritance returns an error unless the role role inherits from
+// exists and does not lead back to it
+func (h *Handler) checkInheritance(db *database.DB, role *database.Role) error {
+	if role.Inherits == "" {
+		return nil
+	}
+	if role.Inherits == role.Name {
+		return errors.New("a role cannot inherit from itself")
+	}
+	parent, err := db.GetRoleByName(role.Inherits)
+	if err != nil {
+		h.logger.Error("roleapi: failed to get role", zap.String("role", role.Inherits), zap.Error(err))
+		return fmt.Errorf("failed to look up role %s", role.Inherits)
+	}
+	if parent == nil {
+		return fmt.Errorf("unknown role to inherit from: %s", role.Inherits)
+	}
+	if _, err := auth.ResolvePermissions(pendingRole{db, role}, role); errors.Is(err, auth.ErrRoleCycle) {
+		return fmt.Errorf("inheriting from %s would make a cycle", role.Inherits)
+	}
+	return nil
+}
+
+// pendingRole looks up roles as if role were already stored
+type pendingRole struct {
+	db   *database.DB
+	role *database.Role
+}
+
+// GetRoleByName returns the pending role or the stored one of that name
+func (p pendingRole) GetRoleByName(name string) (*database.Role, error) {
+	if name == p.role.Name {
+		return p.role, nil
+	}
+	return p.db.GetRoleByName(name)
+}
+
+// ToJSON converts a database role to its API representation, with the
+// permissions it inherits resolved
+func ToJSON(db auth.RoleStore, role *database.Role) Role {
+	permissions, _ := role.GetPermissions()
+	effective, _ := auth.ResolvePermissions(db, role)
+	return Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Inherits:    role.Inherits,
+		Permissions: permissions,
+		Effective:   effective,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+// newRoleID returns a random role ID
+func newRoleID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
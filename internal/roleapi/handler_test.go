@@ -0,0 +1,83 @@
+package roleapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRoleLifecycle(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, logger)
+	ctx := testutil.APIKeyContext("", "users", "read", "write", "delete")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/roles", Role{
+		Name:        "reviewer",
+		Inherits:    "viewer",
+		Permissions: database.Permissions{"users": {"read": true}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created Role
+	json.NewDecoder(rec.Body).Decode(&created)
+	if !created.Effective.Allows("badges", "read") || !created.Effective.Allows("users", "read") || created.Permissions.Allows("badges", "read") {
+		t.Errorf("expected the viewer's permissions to be inherited, got %+v", created)
+	}
+
+	for name, tc := range map[string]struct {
+		method, path string
+		body         interface{}
+		status       int
+	}{
+		"duplicate":        {http.MethodPost, "/api/roles", Role{Name: "reviewer"}, http.StatusConflict},
+		"bad name":         {http.MethodPost, "/api/roles", Role{Name: "Not A Slug"}, http.StatusBadRequest},
+		"unknown resource": {http.MethodPost, "/api/roles", Role{Name: "odd", Permissions: database.Permissions{"gadgets": {"read": true}}}, http.StatusBadRequest},
+		"unknown parent":   {http.MethodPost, "/api/roles", Role{Name: "odd", Inherits: "nobody"}, http.StatusBadRequest},
+		"cycle":            {http.MethodPatch, "/api/roles/viewer", map[string]string{"inherits": "reviewer"}, http.StatusBadRequest},
+		"self":             {http.MethodPatch, "/api/roles/reviewer", map[string]string{"inherits": "reviewer"}, http.StatusBadRequest},
+		"missing":          {http.MethodGet, "/api/roles/nobody", nil, http.StatusNotFound},
+		"inherited from":   {http.MethodDelete, "/api/roles/viewer", nil, http.StatusConflict},
+		"admin role":       {http.MethodDelete, "/api/roles/admin", nil, http.StatusBadRequest},
+	} {
+		if rec := testutil.Serve(h, ctx, tc.method, tc.path, tc.body); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", name, tc.status, rec.Code, rec.Body)
+		}
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/roles/reviewer", map[string]interface{}{
+		"inherits":    "",
+		"permissions": map[string]map[string]bool{"badges": {"*": true}},
+	})
+	var updated Role
+	json.NewDecoder(rec.Body).Decode(&updated)
+	if rec.Code != http.StatusOK || updated.Inherits != "" || !updated.Effective.Allows("badges", "delete") || updated.Effective.Allows("users", "read") {
+		t.Errorf("update: expected the new permissions alone, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodGet, "/api/roles", nil)
+	var list []Role
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 4 {
+		t.Errorf("expected the three default roles and the new one, got %+v", list)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodGet, "/api/permissions", nil); rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"api_keys"`)) {
+		t.Errorf("expected the known resources, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := testutil.Serve(h, testutil.APIKeyContext("org", "users", "read", "write", "delete"), http.MethodGet, "/api/roles", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected organization keys to be refused, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, testutil.APIKeyContext("", "users", "read"), http.MethodDelete, "/api/roles/reviewer", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected deleting without users:delete to be refused, got %d", rec.Code)
+	}
+	if rec := testutil.Serve(h, ctx, http.MethodDelete, "/api/roles/reviewer", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+}
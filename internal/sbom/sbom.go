@@ -0,0 +1,312 @@
+// Package sbom parses CycloneDX and SPDX software bills of materials into the
+// summary shown on certificates: how many dependencies a release has and
+// under which licences.
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document formats
+const (
+	CycloneDX = "CycloneDX"
+	SPDX      = "SPDX"
+)
+
+// UnknownLicense groups components that declare no licence
+const UnknownLicense = "unknown"
+
+// ErrUnknownFormat is returned for documents that are neither CycloneDX nor SPDX
+var ErrUnknownFormat = errors.New("not a CycloneDX or SPDX document")
+
+// Summary describes the dependencies listed in an SBOM
+type Summary struct {
+	// Format is CycloneDX or SPDX
+	Format string `json:"format"`
+	// SpecVersion is the version of the format, e.g. "1.5" or "2.3"
+	SpecVersion string `json:"spec_version"`
+	// Encoding is json, xml or tag-value
+	Encoding string `json:"encoding"`
+	// DependencyCount is the number of components other than the described software
+	DependencyCount int `json:"dependency_count"`
+	// Licenses counts the dependencies per licence (ID, name or expression)
+	Licenses []LicenseCount `json:"licenses"`
+}
+
+// LicenseCount is the number of dependencies under a licence
+type LicenseCount struct {
+	License string `json:"license"`
+	Count   int    `json:"count"`
+}
+
+// Filename returns the conventional filename for the document
+func (s *Summary) Filename() string {
+	switch {
+	case s.Format == CycloneDX && s.Encoding == "xml":
+		return "sbom.cdx.xml"
+	case s.Format == CycloneDX:
+		return "sbom.cdx.json"
+	case s.Encoding == "json":
+		return "sbom.spdx.json"
+	default:
+		return "sbom.spdx"
+	}
+}
+
+// Parse detects the format of an SBOM and summarizes it. CycloneDX is read
+// from JSON or XML, SPDX from JSON or tag-value.
+func Parse(content []byte) (*Summary, error) {
+	trimmed := bytes.TrimSpace(content)
+	switch {
+	case len(trimmed) == 0:
+		return nil, ErrUnknownFormat
+	case trimmed[0] == '{':
+		return parseJSON(trimmed)
+	case trimmed[0] == '<':
+		return parseCycloneDXXML(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("SPDXVersion:")):
+		return parseSPDXTagValue(trimmed)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// licenseTally counts licences and builds the sorted breakdown of a summary
+type licenseTally map[string]int
+
+func (t licenseTally) add(licenses []string) {
+	if len(licenses) == 0 {
+		t[UnknownLicense]++
+		return
+	}
+	t[strings.Join(licenses, " AND ")]++
+}
+
+func (t licenseTally) counts() []LicenseCount {
+	counts := make([]LicenseCount, 0, len(t))
+	for license, n := range t {
+		counts = append(counts, LicenseCount{License: license, Count: n})
+	}
+	// Most used licences first
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].License < counts[j].License
+	})
+	return counts
+}
+
+// cdxComponent is the part of a CycloneDX JSON component the summary needs
+type cdxComponent struct {
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Components []cdxComponent `json:"components"`
+}
+
+// spdxJSON is the part of an SPDX JSON document the summary needs
+type spdxJSON struct {
+	SPDXVersion       string   `json:"spdxVersion"`
+	DocumentDescribes []string `json:"documentDescribes"`
+	Packages          []struct {
+		SPDXID           string `json:"SPDXID"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+	} `json:"packages"`
+	Relationships []struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	} `json:"relationships"`
+}
+
+func parseJSON(content []byte) (*Summary, error) {
+	var probe struct {
+		BOMFormat   string         `json:"bomFormat"`
+		SpecVersion string         `json:"specVersion"`
+		Components  []cdxComponent `json:"components"`
+		SPDXVersion string         `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(content, &probe); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch {
+	case probe.BOMFormat == CycloneDX:
+		tally := licenseTally{}
+		n := countCycloneDX(probe.Components, tally)
+		return &Summary{Format: CycloneDX, SpecVersion: probe.SpecVersion, Encoding: "json", DependencyCount: n, Licenses: tally.counts()}, nil
+	case strings.HasPrefix(probe.SPDXVersion, "SPDX-"):
+		var doc spdxJSON
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("invalid SPDX document: %w", err)
+		}
+		described := map[string]bool{}
+		for _, id := range doc.DocumentDescribes {
+			described[id] = true
+		}
+		for _, rel := range doc.Relationships {
+			if rel.Type == "DESCRIBES" {
+				described[rel.Related] = true
+			}
+		}
+		tally := licenseTally{}
+		n := 0
+		for _, p := range doc.Packages {
+			if described[p.SPDXID] {
+				continue
+			}
+			n++
+			tally.add(spdxLicense(p.LicenseConcluded, p.LicenseDeclared))
+		}
+		return &Summary{Format: SPDX, SpecVersion: strings.TrimPrefix(doc.SPDXVersion, "SPDX-"), Encoding: "json", DependencyCount: n, Licenses: tally.counts()}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// countCycloneDX counts components, nested ones included, and tallies their licences
+func countCycloneDX(components []cdxComponent, tally licenseTally) int {
+	n := 0
+	for _, c := range components {
+		var licenses []string
+		for _, l := range c.Licenses {
+			switch {
+			case l.Expression != "":
+				licenses = append(licenses, l.Expression)
+			case l.License.ID != "":
+				licenses = append(licenses, l.License.ID)
+			case l.License.Name != "":
+				licenses = append(licenses, l.License.Name)
+			}
+		}
+		tally.add(licenses)
+		n += 1 + countCycloneDX(c.Components, tally)
+	}
+	return n
+}
+
+// cdxXMLComponent is the part of a CycloneDX XML component the summary needs
+type cdxXMLComponent struct {
+	Licenses struct {
+		License []struct {
+			ID   string `xml:"id"`
+			Name string `xml:"name"`
+		} `xml:"license"`
+		Expression []string `xml:"expression"`
+	} `xml:"licenses"`
+	Components []cdxXMLComponent `xml:"components>component"`
+}
+
+func parseCycloneDXXML(content []byte) (*Summary, error) {
+	var doc struct {
+		XMLName    xml.Name
+		Components []cdxXMLComponent `xml:"components>component"`
+	}
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	if doc.XMLName.Local != "bom" || !strings.HasPrefix(doc.XMLName.Space, "http://cyclonedx.org/schema/bom/") {
+		return nil, ErrUnknownFormat
+	}
+
+	tally := licenseTally{}
+	n := countCycloneDXXML(doc.Components, tally)
+	specVersion := strings.TrimPrefix(doc.XMLName.Space, "http://cyclonedx.org/schema/bom/")
+	return &Summary{Format: CycloneDX, SpecVersion: specVersion, Encoding: "xml", DependencyCount: n, Licenses: tally.counts()}, nil
+}
+
+func countCycloneDXXML(components []cdxXMLComponent, tally licenseTally) int {
+	n := 0
+	for _, c := range components {
+		licenses := append([]string(nil), c.Licenses.Expression...)
+		for _, l := range c.Licenses.License {
+			if l.ID != "" {
+				licenses = append(licenses, l.ID)
+			} else if l.Name != "" {
+				licenses = append(licenses, l.Name)
+			}
+		}
+		tally.add(licenses)
+		n += 1 + countCycloneDXXML(c.Components, tally)
+	}
+	return n
+}
+
+func parseSPDXTagValue(content []byte) (*Summary, error) {
+	type pkg struct{ id, concluded, declared string }
+	var (
+		version   string
+		packages  []*pkg
+		current   *pkg
+		described = map[string]bool{}
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	for scanner.Scan() {
+		tag, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch tag {
+		case "SPDXVersion":
+			version = value
+		case "PackageName":
+			current = &pkg{}
+			packages = append(packages, current)
+		case "SPDXID":
+			if current != nil {
+				current.id = value
+			}
+		case "PackageLicenseConcluded":
+			if current != nil {
+				current.concluded = value
+			}
+		case "PackageLicenseDeclared":
+			if current != nil {
+				current.declared = value
+			}
+		case "Relationship":
+			if fields := strings.Fields(value); len(fields) == 3 && fields[1] == "DESCRIBES" {
+				described[fields[2]] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid SPDX document: %w", err)
+	}
+
+	tally := licenseTally{}
+	n := 0
+	for _, p := range packages {
+		if described[p.id] {
+			continue
+		}
+		n++
+		tally.add(spdxLicense(p.concluded, p.declared))
+	}
+	return &Summary{Format: SPDX, SpecVersion: strings.TrimPrefix(version, "SPDX-"), Encoding: "tag-value", DependencyCount: n, Licenses: tally.counts()}, nil
+}
+
+// spdxLicense prefers the concluded over the declared licence; NOASSERTION
+// and NONE count as no licence
+func spdxLicense(concluded, declared string) []string {
+	for _, l := range []string{concluded, declared} {
+		if l != "" && l != "NOASSERTION" && l != "NONE" {
+			return []string{l}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package sbom
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		doc      string
+		want     Summary
+		filename string
+	}{
+		{
+			name: "CycloneDX JSON",
+			doc: `{
+				"bomFormat": "CycloneDX", "specVersion": "1.5",
+				"metadata": {"component": {"name": "app"}},
+				"components": [
+					{"name": "a", "licenses": [{"license": {"id": "MIT"}}]},
+					{"name": "b", "licenses": [{"expression": "Apache-2.0 OR MIT"}],
+					 "components": [{"name": "b1", "licenses": [{"license": {"id": "MIT"}}]}]},
+					{"name": "c", "licenses": [{"license": {"name": "Custom"}}]},
+					{"name": "d"}
+				]
+			}`,
+			want: Summary{Format: CycloneDX, SpecVersion: "1.5", Encoding: "json", DependencyCount: 5, Licenses: []LicenseCount{
+				{"MIT", 2}, {"Apache-2.0 OR MIT", 1}, {"Custom", 1}, {UnknownLicense, 1},
+			}},
+			filename: "sbom.cdx.json",
+		},
+		{
+			name: "CycloneDX XML",
+			doc: `<?xml version="1.0"?>
+				<bom xmlns="http://cyclonedx.org/schema/bom/1.4" version="1">
+					<metadata><component type="application"><name>app</name></component></metadata>
+					<components>
+						<component type="library"><name>a</name><licenses><license><id>BSD-3-Clause</id></license></licenses></component>
+						<component type="library"><name>b</name><licenses><expression>GPL-2.0-only WITH Classpath-exception-2.0</expression></licenses></component>
+					</components>
+				</bom>`,
+			want: Summary{Format: CycloneDX, SpecVersion: "1.4", Encoding: "xml", DependencyCount: 2, Licenses: []LicenseCount{
+				{"BSD-3-Clause", 1}, {"GPL-2.0-only WITH Classpath-exception-2.0", 1},
+			}},
+			filename: "sbom.cdx.xml",
+		},
+		{
+			name: "SPDX JSON",
+			doc: `{
+				"spdxVersion": "SPDX-2.3",
+				"packages": [
+					{"SPDXID": "SPDXRef-app", "licenseConcluded": "EUPL-1.2"},
+					{"SPDXID": "SPDXRef-a", "licenseConcluded": "NOASSERTION", "licenseDeclared": "MIT"},
+					{"SPDXID": "SPDXRef-b", "licenseConcluded": "NOASSERTION", "licenseDeclared": "NONE"}
+				],
+				"relationships": [{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-app"}]
+			}`,
+			want: Summary{Format: SPDX, SpecVersion: "2.3", Encoding: "json", DependencyCount: 2, Licenses: []LicenseCount{
+				{"MIT", 1}, {UnknownLicense, 1},
+			}},
+			filename: "sbom.spdx.json",
+		},
+		{
+			name: "SPDX tag-value",
+			doc: `SPDXVersion: SPDX-2.2
+DataLicense: CC0-1.0
+Relationship: SPDXRef-DOCUMENT DESCRIBES SPDXRef-app
+
+PackageName: app
+SPDXID: SPDXRef-app
+PackageLicenseConcluded: EUPL-1.2
+
+PackageName: left-pad
+SPDXID: SPDXRef-left-pad
+PackageLicenseConcluded: WTFPL
+`,
+			want: Summary{Format: SPDX, SpecVersion: "2.2", Encoding: "tag-value", DependencyCount: 1, Licenses: []LicenseCount{
+				{"WTFPL", 1},
+			}},
+			filename: "sbom.spdx",
+		},
+	} {
+		got, err := Parse([]byte(tc.doc))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *got, tc.want)
+		}
+		if got.Filename() != tc.filename {
+			t.Errorf("%s: expected filename %s, got %s", tc.name, tc.filename, got.Filename())
+		}
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, doc := range []string{"", `{"name": "package.json"}`, `<project/>`, "PK\x03\x04"} {
+		if _, err := Parse([]byte(doc)); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%q: expected ErrUnknownFormat, got %v", doc, err)
+		}
+	}
+	if _, err := Parse([]byte(`{"bomFormat": `)); err == nil || errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected a JSON syntax error, got %v", err)
+	}
+}
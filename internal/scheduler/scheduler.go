@@ -0,0 +1,74 @@
+// Package scheduler publishes badges whose scheduled publication time has
+// come, so that certificates can go live together with an announcement.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// Interval is how often the publisher looks for due badges
+const Interval = time.Minute
+
+// Publisher flips scheduled drafts live once their publish_at has passed
+type Publisher struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+	// publishDrafts is false when approval is required: only approved badges
+	// are then revealed, drafts wait for review
+	publishDrafts bool
+}
+
+// NewPublisher creates a publisher. With requireApproval, scheduled drafts are
+// not published; approved badges with a publish_at still become visible then.
+func NewPublisher(db *database.DB, logger *zap.Logger, cache *cache.Cache, requireApproval bool) *Publisher {
+	return &Publisher{
+		db:            db,
+		logger:        logger,
+		cache:         cache,
+		publishDrafts: !requireApproval,
+	}
+}
+
+// Run publishes due badges every Interval until ctx is done
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+
+	for {
+		p.PublishDue(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishDue publishes the badges due at now and drops the cached pages that
+// showed them as unpublished
+func (p *Publisher) PublishDue(now time.Time) []string {
+	ids, err := p.db.PublishScheduled(now, p.publishDrafts)
+	if err != nil {
+		p.logger.Error("scheduler: failed to publish scheduled badges", zap.Error(err))
+		return nil
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, commitID := range ids {
+		p.cache.DeletePrefix("badge:" + commitID + ":")
+		p.cache.DeletePrefix("certificate:" + commitID + ":")
+		p.cache.Delete("details:" + commitID)
+		p.logger.Info("scheduler: published badge", zap.String("commit_id", commitID))
+	}
+	p.cache.DeletePrefix("badges:list:")
+	p.cache.Delete("home:index")
+	return ids
+}
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestPublishDue(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "scheduler.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	past := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	future := sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+	for _, b := range []*database.Badge{
+		{CommitID: "due1234", Status: "draft", PublishAt: past},
+		{CommitID: "later12", Status: "draft", PublishAt: future},
+		{CommitID: "approved", Status: "valid", PublishAt: past},
+		{CommitID: "pending1", Status: "pending", PublishAt: past},
+		{CommitID: "plain12", Status: "draft"},
+	} {
+		b.Type, b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = "badge", "GÉANT", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "App", "v1"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create badge: %v", err)
+		}
+	}
+
+	if b, _ := db.GetBadge("later12"); b.IsPublished() {
+		t.Error("Expected a badge scheduled for later to be unpublished")
+	}
+	public, _, err := db.SearchBadges(database.BadgeQuery{})
+	if err != nil || len(public) != 1 || public[0].CommitID != "approved" {
+		t.Errorf("Expected only the due approved badge to be public, got %d (%v)", len(public), err)
+	}
+
+	// With approval required, only the approved badge becomes visible
+	c := cache.New()
+	ids := NewPublisher(db, logger, c, true).PublishDue(now)
+	if !reflect.DeepEqual(ids, []string{"approved"}) {
+		t.Errorf("Expected only the approved badge, got %v", ids)
+	}
+
+	c.Set("badges:list:public", []byte("stale"), time.Hour)
+	ids = NewPublisher(db, logger, c, false).PublishDue(now)
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"due1234"}) {
+		t.Errorf("Expected the due draft to be published, got %v", ids)
+	}
+	if _, found := c.Get("badges:list:public"); found {
+		t.Error("Expected the list cache to be invalidated")
+	}
+
+	for commitID, want := range map[string]database.Status{"due1234": "valid", "later12": "draft", "approved": "valid", "pending1": "pending", "plain12": "draft"} {
+		b, _ := db.GetBadge(commitID)
+		if b.Status != want {
+			t.Errorf("%s: expected status %s, got %s", commitID, want, b.Status)
+		}
+	}
+	if b, _ := db.GetBadge("due1234"); b.PublishAt.Valid || !b.IsPublished() {
+		t.Errorf("Expected due1234 to be published with publish_at cleared, got %+v", b.PublishAt)
+	}
+	entries, _ := db.ListAuditEntries("due1234")
+	if len(entries) != 1 || entries[0].Action != "publish" || entries[0].ActorID != "scheduler" {
+		t.Errorf("Expected a publish audit entry, got %+v", entries)
+	}
+}
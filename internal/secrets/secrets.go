@@ -0,0 +1,103 @@
+// Package secrets reads secrets mounted as files, such as Docker secrets or
+// Kubernetes secret volumes, and reloads them when they rotate.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultInterval is how often watched files are read again. Kubernetes
+// updates mounted secrets within about a minute of a change.
+const DefaultInterval = 30 * time.Second
+
+// ReadFile reads a secret from a file, without surrounding whitespace such
+// as the trailing newline editors and `echo` add
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
+
+// watch is a secret file and the function applying its new value
+type watch struct {
+	name  string
+	path  string
+	value string
+	apply func(string)
+}
+
+// Watcher polls secret files and applies their values when they change.
+// Kubernetes swaps a symlink when a secret rotates, so files are read again
+// rather than watched for events.
+type Watcher struct {
+	logger   *zap.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches []*watch
+}
+
+// NewWatcher creates a watcher reading files every DefaultInterval
+func NewWatcher(logger *zap.Logger) *Watcher {
+	return &Watcher{logger: logger, interval: DefaultInterval}
+}
+
+// SetInterval changes how often files are read
+func (w *Watcher) SetInterval(d time.Duration) {
+	w.interval = d
+}
+
+// Watch calls apply with the content of path whenever it changes from value,
+// the content it was loaded with. name identifies the secret in logs.
+func (w *Watcher) Watch(name, path, value string, apply func(string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches = append(w.watches, &watch{name: name, path: path, value: value, apply: apply})
+}
+
+// Run polls the watched files until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Check reads every watched file once and applies the changed ones. A file
+// that cannot be read, e.g. in the middle of an update, keeps its last value.
+func (w *Watcher) Check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range w.watches {
+		value, err := ReadFile(s.path)
+		if err != nil {
+			w.logger.Warn("Failed to reload secret", zap.String("secret", s.name), zap.Error(err))
+			continue
+		}
+		if value == s.value {
+			continue
+		}
+		s.value = value
+		s.apply(value)
+		w.logger.Info("Reloaded rotated secret", zap.String("secret", s.name), zap.String("path", s.path))
+	}
+}
@@ -0,0 +1,59 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(path, []byte("  s3cret\n"), 0600)
+	if value, err := ReadFile(path); err != nil || value != "s3cret" {
+		t.Errorf("ReadFile = %q, %v; want s3cret", value, err)
+	}
+
+	os.WriteFile(path, []byte("\n"), 0600)
+	if _, err := ReadFile(path); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jwt")
+	os.WriteFile(path, []byte("first\n"), 0600)
+
+	var applied []string
+	w := NewWatcher(zap.NewNop())
+	w.Watch("JWT_SECRET", path, "first", func(v string) { applied = append(applied, v) })
+
+	w.Check()
+	if len(applied) != 0 {
+		t.Fatalf("expected no reload of an unchanged file, got %v", applied)
+	}
+
+	// Kubernetes swaps a symlink to the new content
+	os.WriteFile(filepath.Join(dir, "jwt.new"), []byte("second\n"), 0600)
+	os.Remove(path)
+	os.Symlink(filepath.Join(dir, "jwt.new"), path)
+	w.Check()
+	w.Check()
+	if len(applied) != 1 || applied[0] != "second" {
+		t.Fatalf("expected one reload with the new value, got %v", applied)
+	}
+
+	// A missing or empty file keeps the last value
+	os.Remove(path)
+	w.Check()
+	os.WriteFile(path, []byte("second"), 0600)
+	w.Check()
+	if len(applied) != 1 {
+		t.Errorf("expected no reload while the file was missing, got %v", applied)
+	}
+}
@@ -0,0 +1,257 @@
+package service_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service"
+	"github.com/finki/badges/internal/service/servicetest"
+	"go.uber.org/zap"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// goldenDir holds an SVG per case and the hashes of the raster renders
+var goldenDir = filepath.Join("testdata", "golden")
+
+// rasterHashes lists the SHA-256 of each raster render, preceded by the
+// versions of the converters that produced them
+var rasterHashes = filepath.Join(goldenDir, "raster.sha256")
+
+// rasterTools are the converters each raster format goes through
+var rasterTools = map[string][]string{
+	"png":  {"rsvg-convert"},
+	"jpg":  {"rsvg-convert"},
+	"webp": {"rsvg-convert", "cwebp"},
+	"avif": {"rsvg-convert", "avifenc"},
+}
+
+// goldenCases are representative badges and certificates, covering every
+// style, color scheme, right-segment mode and status. The templates draw the
+// flat and 3d styles alike for now; their cases catch when that changes.
+var goldenCases = []struct {
+	name   string
+	kind   string
+	status database.Status
+	config string
+}{
+	{"badge-flat-light", "badge", "valid", `{}`},
+	{"badge-3d-light", "badge", "valid", `{"style":"3d"}`},
+	{"badge-flat-dark", "badge", "valid", `{"theme":"dark"}`},
+	{"badge-3d-dark", "badge", "valid", `{"style":"3d","theme":"dark"}`},
+	{"badge-flat-auto", "badge", "valid", `{"theme":"auto"}`},
+	{"badge-show-version", "badge", "valid", `{"show":"version"}`},
+	{"badge-show-expiry", "badge", "valid", `{"show":"expiry"}`},
+	{"badge-show-status", "badge", "valid", `{"show":"status"}`},
+	{"badge-expired", "badge", "expired", `{}`},
+	{"badge-revoked-dark", "badge", "revoked", `{"theme":"dark"}`},
+	{"badge-custom-colors", "badge", "valid", `{"color_left":"#003f5f","color_right":"#e78a2d","text_color":"#ffffff","font_size":12}`},
+	{"certificate", "certificate", "valid", `{}`},
+	{"certificate-3d", "certificate", "valid", `{"style":"3d"}`},
+	{"certificate-expired", "certificate", "expired", `{}`},
+	{"certificate-revoked", "certificate", "revoked", `{}`},
+	{"certificate-custom-colors", "certificate", "valid", `{"background_color":"#1d2b53","horizontal_bars_color":"#ffcc00","top_label_color":"#ffcc00","cert_name_color":"#f0f0f0","border_color":"#ffcc00"}`},
+}
+
+// TestRenderGolden renders every golden case in every format through Render
+// and compares SVGs with testdata/golden and raster images with the recorded
+// hashes. Raster formats are skipped when their converters are missing or
+// differ from the recorded versions, and fail when converters are installed
+// but no hashes were recorded. Run with -update after intended changes.
+func TestRenderGolden(t *testing.T) {
+	store := servicetest.NewBadgeStore()
+	for _, c := range goldenCases {
+		b := &database.Badge{
+			CommitID: c.name, Type: c.kind, Status: c.status, Issuer: "GÉANT",
+			IssueDate:       time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+			ExpiryDate:      sql.NullTime{Time: time.Date(2099, 1, 31, 0, 0, 0, 0, time.UTC), Valid: true},
+			SoftwareName:    "eduGAIN Reporting",
+			SoftwareVersion: "v2.4.1",
+			CertificateName: sql.NullString{String: "Self-Assessed Dependencies", Valid: true},
+			CustomConfig:    sql.NullString{String: c.config, Valid: true},
+		}
+		if c.status == "expired" {
+			b.ExpiryDate.Time = time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+		}
+		store.Badges[b.CommitID] = b
+	}
+	images := service.NewImages(store, zap.NewNop())
+	renderers := map[string]service.Renderer{"badge": badge.NewGenerator(), "certificate": certificate.NewGenerator()}
+	ctx := context.Background()
+
+	if *update {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", goldenDir, err)
+		}
+	}
+	recorded, recordedTools, haveHashes := readRasterHashes(t)
+	tools := toolVersions()
+	hashes := map[string]string{}
+
+	for _, c := range goldenCases {
+		t.Run(c.name, func(t *testing.T) {
+			req := service.ImageRequest{CommitID: c.name, Format: "svg", Renderer: renderers[c.kind]}
+			svg, err := images.Render(ctx, req)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			path := filepath.Join(goldenDir, c.name+".svg")
+			if *update {
+				if err := os.WriteFile(path, svg, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(svg, want) {
+				t.Errorf("SVG differs from %s; run go test -update if the change is intended\n%s", path, svg)
+			}
+
+			for _, format := range []string{"png", "jpg", "webp", "avif"} {
+				key := c.name + "." + format
+				if missing := missingTool(format, tools); missing != "" {
+					t.Logf("%s: skipped, %s not found", format, missing)
+					continue
+				}
+				req.Format = format
+				data, err := images.Render(ctx, req)
+				if err != nil {
+					t.Errorf("%s: Render: %v", format, err)
+					continue
+				}
+				sum := sha256.Sum256(data)
+				hashes[key] = hex.EncodeToString(sum[:])
+				switch {
+				case *update:
+				case !haveHashes:
+					t.Errorf("%s: %s is missing; run go test -update", format, rasterHashes)
+				case !sameTools(format, tools, recordedTools):
+					t.Logf("%s: skipped, hashes were recorded with other converter versions", format)
+				case recorded[key] == "":
+					t.Errorf("%s: no recorded hash; run go test -update", format)
+				case recorded[key] != hashes[key]:
+					t.Errorf("%s render differs from the recorded hash; run go test -update if the change is intended", format)
+				}
+			}
+		})
+	}
+
+	if *update {
+		writeRasterHashes(t, tools, hashes)
+	}
+}
+
+// toolVersions returns the first line of the version output of each converter
+// found on the PATH
+func toolVersions() map[string]string {
+	versions := map[string]string{}
+	for tool, arg := range map[string]string{"rsvg-convert": "--version", "cwebp": "-version", "avifenc": "--version"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			continue
+		}
+		out, _ := exec.Command(tool, arg).Output()
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		versions[tool] = strings.TrimSpace(line)
+	}
+	return versions
+}
+
+// missingTool returns the first converter of format that is not installed
+func missingTool(format string, tools map[string]string) string {
+	for _, tool := range rasterTools[format] {
+		if _, ok := tools[tool]; !ok {
+			return tool
+		}
+	}
+	return ""
+}
+
+// sameTools reports whether the converters of format have the recorded versions
+func sameTools(format string, tools, recorded map[string]string) bool {
+	for _, tool := range rasterTools[format] {
+		if tools[tool] != recorded[tool] {
+			return false
+		}
+	}
+	return true
+}
+
+// readRasterHashes reads the recorded hashes by case and format, and the
+// converter versions they were recorded with. ok is false when no hashes
+// were recorded yet.
+func readRasterHashes(t *testing.T) (hashes, tools map[string]string, ok bool) {
+	hashes, tools = map[string]string{}, map[string]string{}
+	f, err := os.Open(rasterHashes)
+	if os.IsNotExist(err) {
+		return hashes, tools, false
+	}
+	if err != nil {
+		t.Fatalf("Failed to read raster hashes: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if tool, version, ok := strings.Cut(strings.TrimPrefix(line, "# "), ": "); ok && strings.HasPrefix(line, "# ") {
+			tools[tool] = version
+			continue
+		}
+		if sum, name, ok := strings.Cut(line, "  "); ok {
+			hashes[name] = sum
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read raster hashes: %v", err)
+	}
+	return hashes, tools, true
+}
+
+// writeRasterHashes records the hashes, in sha256sum format, under the
+// converter versions that produced them. Formats whose converters are missing
+// lose their hashes, so record them where all converters are installed.
+func writeRasterHashes(t *testing.T, tools, hashes map[string]string) {
+	if len(hashes) == 0 {
+		t.Log("No converters found; raster hashes left unchanged")
+		return
+	}
+	var buf bytes.Buffer
+	names := make([]string, 0, len(tools))
+	for tool := range tools {
+		names = append(names, tool)
+	}
+	sort.Strings(names)
+	for _, tool := range names {
+		fmt.Fprintf(&buf, "# %s: %s\n", tool, tools[tool])
+	}
+
+	keys := make([]string, 0, len(hashes))
+	for key := range hashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s  %s\n", hashes[key], key)
+	}
+	if err := os.WriteFile(rasterHashes, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to update raster hashes: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned when the badge does not exist
+	ErrNotFound = errors.New("badge not found")
+	// ErrInvalidConfig is returned when the requested configuration cannot be applied
+	ErrInvalidConfig = errors.New("invalid badge configuration")
+	// ErrRender is returned when the image cannot be generated
+	ErrRender = errors.New("failed to generate image")
+)
+
+// ImageRequest describes a badge image to render
+type ImageRequest struct {
+	CommitID string
+	// Format is one of svg, png, jpg, webp or avif
+	Format string
+	// Size is the raster size; ignored for SVG
+	Size utils.Size
+	// Quality is the webp and avif quality, 0 for the encoder default
+	Quality int
+	// Renderer draws the SVG the other formats are converted from
+	Renderer Renderer
+	// Configure adjusts the badge before rendering, e.g. from query parameters
+	Configure func(b *database.Badge) error
+	// Persist allows reading and storing PNG and JPG renders; badges past
+	// their expiry date are never stored, as their stored render may predate it
+	Persist bool
+}
+
+// Images renders badge images, reusing and storing PNG and JPG renders in the
+// badge store
+type Images struct {
+	store  BadgeStore
+	logger *zap.Logger
+}
+
+// NewImages creates a new image service
+func NewImages(store BadgeStore, logger *zap.Logger) *Images {
+	return &Images{store: store, logger: logger}
+}
+
+// Render returns the image described by req, reading the store under ctx.
+// Renders other than stored ones wait for a slot of the render limit.
+// Errors wrap ErrNotFound, ErrInvalidConfig, ErrRender or ErrBusy, or come
+// from the store.
+func (s *Images) Render(ctx context.Context, req ImageRequest) ([]byte, error) {
+	store := WithContext(s.store, ctx)
+	badge, err := store.GetBadge(req.CommitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get badge: %w", err)
+	}
+	if badge == nil {
+		return nil, ErrNotFound
+	}
+
+	// Apply the organization theme under the badge's own configuration
+	if err := store.ApplyOrgTheme(badge); err != nil {
+		return nil, fmt.Errorf("failed to apply organization theme: %w", err)
+	}
+	if req.Configure != nil {
+		if err := req.Configure(badge); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+
+	persist := req.Persist && !badge.IsExpired()
+	stored := req.Format == "png" || req.Format == "jpg"
+	if stored && persist {
+		data, err := store.GetBadgeImage(badge, req.Format)
+		if err != nil {
+			s.logger.Warn("Failed to read stored image", zap.Error(err), zap.String("commit_id", req.CommitID), zap.String("format", req.Format))
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+
+	release, err := AcquireRender(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	svgData, err := req.Renderer.GenerateSVG(badge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRender, err)
+	}
+
+	var data []byte
+	switch req.Format {
+	case "svg":
+		return svgData, nil
+	case "png":
+		data, err = utils.SVGToPNG(ctx, svgData, req.Size)
+	case "jpg":
+		data, err = utils.SVGToJPG(ctx, svgData, req.Size)
+	case "webp":
+		data, err = utils.SVGToWebP(ctx, svgData, req.Size, req.Quality)
+	case "avif":
+		data, err = utils.SVGToAVIF(ctx, svgData, req.Size, req.Quality)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrRender, req.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRender, err)
+	}
+
+	// Modern formats are not stored; they are only kept in the cache
+	if stored && persist {
+		if err := store.UpdateBadgeImage(req.CommitID, req.Format, data); err != nil {
+			s.logger.Error("Failed to store image", zap.Error(err), zap.String("commit_id", req.CommitID), zap.String("format", req.Format))
+		}
+	}
+	return data, nil
+}
+
+// Resolve returns the commit ID of the badge id refers to through an alias or
+// in another case, or "" if none, so handlers can redirect instead of
+// reporting ErrNotFound
+func (s *Images) Resolve(ctx context.Context, id string) (string, error) {
+	commitID, err := WithContext(s.store, ctx).ResolveBadgeID(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve badge ID: %w", err)
+	}
+	return commitID, nil
+}
+
+// ResolveSlug returns the commit ID of the badge a vanity URL of a Software
+// Catalogue project and certificate slug refers to, or "" if none
+func (s *Images) ResolveSlug(ctx context.Context, scID, slug string) (string, error) {
+	badge, err := WithContext(s.store, ctx).FindBadgeBySlug(scID, slug)
+	if err != nil {
+		return "", fmt.Errorf("failed to find badge by slug: %w", err)
+	}
+	if badge == nil {
+		return "", nil
+	}
+	return badge.CommitID, nil
+}
+
+// ResolveLatest returns the commit ID of the most recently issued valid badge
+// of a Software Catalogue project with the given certificate slug, or of any
+// certificate if slug is empty, or "" if none
+func (s *Images) ResolveLatest(ctx context.Context, scID, slug string) (string, error) {
+	badge, err := WithContext(s.store, ctx).FindLatestValidBadge(scID, slug)
+	if err != nil {
+		return "", fmt.Errorf("failed to find latest badge: %w", err)
+	}
+	if badge == nil {
+		return "", nil
+	}
+	return badge.CommitID, nil
+}
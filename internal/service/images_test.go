@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service"
+	"github.com/finki/badges/internal/service/servicetest"
+	"go.uber.org/zap"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"></svg>`
+
+func TestRenderSVG(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "abc123", Status: "valid"})
+	renderer := &servicetest.Renderer{SVG: []byte(testSVG)}
+	images := service.NewImages(store, zap.NewNop())
+	ctx := context.Background()
+
+	var configured string
+	data, err := images.Render(ctx, service.ImageRequest{
+		CommitID: "abc123",
+		Format:   "svg",
+		Renderer: renderer,
+		Configure: func(b *database.Badge) error {
+			configured = b.CommitID
+			return nil
+		},
+		Persist: true,
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if string(data) != testSVG || renderer.Calls != 1 || configured != "abc123" {
+		t.Errorf("expected the configured render, got %q after %d calls (configured %q)", data, renderer.Calls, configured)
+	}
+	if len(store.Images) != 0 {
+		t.Errorf("expected SVG renders not to be stored, got %v", store.Images)
+	}
+}
+
+func TestRenderStoredImage(t *testing.T) {
+	store := servicetest.NewBadgeStore(
+		&database.Badge{CommitID: "abc123", Status: "valid"},
+		&database.Badge{CommitID: "old12345", Status: "valid", ExpiryDate: sql.NullTime{Time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}},
+	)
+	store.Images["abc123.png"] = []byte("stored")
+	store.Images["old12345.png"] = []byte("stale")
+	renderer := &servicetest.Renderer{Err: errors.New("not rendered")}
+	images := service.NewImages(store, zap.NewNop())
+	ctx := context.Background()
+
+	data, err := images.Render(ctx, service.ImageRequest{CommitID: "abc123", Format: "png", Renderer: renderer, Persist: true})
+	if err != nil || string(data) != "stored" || renderer.Calls != 0 {
+		t.Errorf("expected the stored render, got %q (err %v, %d calls)", data, err, renderer.Calls)
+	}
+
+	// Stored renders are bypassed when not persisting and for expired badges
+	for _, req := range []service.ImageRequest{
+		{CommitID: "abc123", Format: "png", Renderer: renderer},
+		{CommitID: "old12345", Format: "png", Renderer: renderer, Persist: true},
+	} {
+		if _, err := images.Render(ctx, req); !errors.Is(err, service.ErrRender) {
+			t.Errorf("%s: expected a fresh render, got %v", req.CommitID, err)
+		}
+	}
+	if renderer.Calls != 2 {
+		t.Errorf("expected 2 renders, got %d", renderer.Calls)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "abc123"})
+	images := service.NewImages(store, zap.NewNop())
+	ctx := context.Background()
+	renderer := &servicetest.Renderer{SVG: []byte(testSVG)}
+
+	tests := []struct {
+		name string
+		req  service.ImageRequest
+		want error
+	}{
+		{"missing badge", service.ImageRequest{CommitID: "missing1", Format: "svg", Renderer: renderer}, service.ErrNotFound},
+		{"invalid config", service.ImageRequest{CommitID: "abc123", Format: "svg", Renderer: renderer,
+			Configure: func(*database.Badge) error { return errors.New("bad config") }}, service.ErrInvalidConfig},
+		{"render failure", service.ImageRequest{CommitID: "abc123", Format: "svg",
+			Renderer: &servicetest.Renderer{Err: errors.New("boom")}}, service.ErrRender},
+	}
+	for _, tt := range tests {
+		if _, err := images.Render(ctx, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	store.Err = errors.New("database is locked")
+	_, err := images.Render(ctx, service.ImageRequest{CommitID: "abc123", Format: "svg", Renderer: renderer})
+	if !errors.Is(err, store.Err) || errors.Is(err, service.ErrNotFound) {
+		t.Errorf("expected the store error, got %v", err)
+	}
+}
+
+func TestRenderLimit(t *testing.T) {
+	store := servicetest.NewBadgeStore(&database.Badge{CommitID: "abc123", Status: "valid"})
+	images := service.NewImages(store, zap.NewNop())
+	ctx := context.Background()
+	renderer := &servicetest.Renderer{SVG: []byte(testSVG)}
+	service.SetRenderLimit(1, 10*time.Millisecond)
+	defer service.SetRenderLimit(0, 0)
+
+	release, err := service.AcquireRender(ctx)
+	if err != nil {
+		t.Fatalf("AcquireRender: %v", err)
+	}
+	_, err = images.Render(ctx, service.ImageRequest{CommitID: "abc123", Format: "svg", Renderer: renderer})
+	if !errors.Is(err, service.ErrBusy) || renderer.Calls != 0 {
+		t.Errorf("expected ErrBusy while the only slot is taken, got %v after %d calls", err, renderer.Calls)
+	}
+
+	// Stored renders do not need a slot
+	store.Images["abc123.png"] = []byte("stored")
+	if data, err := images.Render(ctx, service.ImageRequest{CommitID: "abc123", Format: "png", Renderer: renderer, Persist: true}); err != nil || string(data) != "stored" {
+		t.Errorf("expected the stored render, got %q (err %v)", data, err)
+	}
+
+	release()
+	if _, err := images.Render(ctx, service.ImageRequest{CommitID: "abc123", Format: "svg", Renderer: renderer}); err != nil {
+		t.Errorf("expected the render once the slot is released, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned when no render slot frees up in time; handlers answer
+// it with 503 Service Unavailable
+var ErrBusy = errors.New("too many renders in progress")
+
+// renderLimit bounds the renders running at once across all handlers, as
+// each may start an external converter
+var renderLimit struct {
+	sync.RWMutex
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// SetRenderLimit allows at most n renders at once, each waiting up to wait
+// for a slot; n <= 0 removes the limit
+func SetRenderLimit(n int, wait time.Duration) {
+	renderLimit.Lock()
+	defer renderLimit.Unlock()
+	renderLimit.slots = nil
+	if n > 0 {
+		renderLimit.slots = make(chan struct{}, n)
+	}
+	renderLimit.wait = wait
+}
+
+// AcquireRender waits for a render slot and returns the function releasing
+// it. It returns ErrBusy if none frees up within the configured wait or
+// before ctx is done.
+func AcquireRender(ctx context.Context) (func(), error) {
+	renderLimit.RLock()
+	slots, wait := renderLimit.slots, renderLimit.wait
+	renderLimit.RUnlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrBusy
+	case <-ctx.Done():
+		return nil, ErrBusy
+	}
+}
@@ -0,0 +1,74 @@
+// Package service holds the storage and rendering interfaces handlers depend
+// on, and the services built on them. *database.DB implements the stores and
+// the badge and certificate generators implement Renderer, so handler logic
+// can be tested against the in-memory implementations in servicetest and
+// other backends can be plugged in.
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+// BadgeStore reads badges and stores their rendered images
+type BadgeStore interface {
+	// GetBadge returns a badge by commit ID, or nil if it does not exist
+	GetBadge(commitID string) (*database.Badge, error)
+	// ResolveBadgeID returns the commit ID an alias or differently-cased ID
+	// refers to, or "" if none
+	ResolveBadgeID(id string) (string, error)
+	// FindBadgeBySlug returns the newest published badge of a Software
+	// Catalogue project with the given certificate slug, or nil if none
+	FindBadgeBySlug(scID, slug string) (*database.Badge, error)
+	// FindLatestValidBadge returns the most recently issued valid badge of a
+	// Software Catalogue project with the given certificate slug, or of any
+	// certificate if slug is empty, or nil if none
+	FindLatestValidBadge(scID, slug string) (*database.Badge, error)
+	// ApplyOrgTheme applies the theme of the badge's organization to its custom config
+	ApplyOrgTheme(b *database.Badge) error
+	// GetBadgeImage returns the stored PNG or JPG render of a badge, or nil if none
+	GetBadgeImage(b *database.Badge, format string) ([]byte, error)
+	// UpdateBadgeImage stores a render of a badge
+	UpdateBadgeImage(commitID, format string, content []byte) error
+}
+
+// UserStore reads and updates users and the roles and organizations they
+// belong to
+type UserStore interface {
+	GetUser(userID string) (*database.User, error)
+	GetUserByUsername(username string) (*database.User, error)
+	GetUserByEmail(email string) (*database.User, error)
+	CreateUser(user *database.User) error
+	UpdateUser(user *database.User) error
+	UpdateUserPassword(userID, passwordHash string) error
+	UpdateUserFailedAttempts(userID string, attempts int) error
+	UpdateUserLastLogin(userID string, lastLogin time.Time) error
+	GetRole(roleID string) (*database.Role, error)
+	GetRoleByName(name string) (*database.Role, error)
+	GetOrganization(orgID string) (*database.Organization, error)
+	CreateUserAuditEntry(e *database.UserAuditEntry) error
+	ListUserAuditEntries(action string, limit int) ([]*database.UserAuditEntry, error)
+}
+
+// Renderer draws a badge as SVG, e.g. *badge.Generator or *certificate.Generator
+type Renderer interface {
+	GenerateSVG(b *database.Badge) ([]byte, error)
+}
+
+var (
+	_ BadgeStore = (*database.DB)(nil)
+	_ UserStore  = (*database.DB)(nil)
+)
+
+// WithContext returns store bound to ctx when it is a *database.DB, and store
+// unchanged otherwise
+func WithContext[S any](store S, ctx context.Context) S {
+	if db, ok := any(store).(*database.DB); ok {
+		if bound, ok := any(db.WithContext(ctx)).(S); ok {
+			return bound
+		}
+	}
+	return store
+}
@@ -0,0 +1,488 @@
+// Package servicetest provides in-memory implementations of the service
+// interfaces for handler tests that do not need a database.
+package servicetest
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/service"
+)
+
+var (
+	_ service.BadgeStore = (*BadgeStore)(nil)
+	_ service.UserStore  = (*UserStore)(nil)
+	_ service.Renderer   = (*Renderer)(nil)
+)
+
+// BadgeStore is an in-memory service.BadgeStore that also supplies
+// certificate templates
+type BadgeStore struct {
+	mu        sync.Mutex
+	Badges    map[string]*database.Badge
+	Templates map[string]*database.Template
+	// Aliases maps alternate IDs to commit IDs
+	Aliases map[string]string
+	// Images holds stored renders by commit ID and format, e.g. "abc123.png"
+	Images map[string][]byte
+	// Err, when set, is returned by every method
+	Err error
+}
+
+// NewBadgeStore creates a badge store holding the given badges
+func NewBadgeStore(badges ...*database.Badge) *BadgeStore {
+	s := &BadgeStore{
+		Badges:    map[string]*database.Badge{},
+		Templates: map[string]*database.Template{},
+		Aliases:   map[string]string{},
+		Images:    map[string][]byte{},
+	}
+	for _, b := range badges {
+		s.Badges[b.CommitID] = b
+	}
+	return s
+}
+
+// GetBadge returns a copy of a badge, or nil if it does not exist
+func (s *BadgeStore) GetBadge(commitID string) (*database.Badge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	b, ok := s.Badges[commitID]
+	if !ok {
+		return nil, nil
+	}
+	c := *b
+	return &c, nil
+}
+
+// ResolveBadgeID returns the commit ID of an alias or of a badge in another
+// case, or ""
+func (s *BadgeStore) ResolveBadgeID(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return "", s.Err
+	}
+	for alias, commitID := range s.Aliases {
+		if strings.EqualFold(alias, id) {
+			return commitID, nil
+		}
+	}
+	for commitID := range s.Badges {
+		if strings.EqualFold(commitID, id) {
+			return commitID, nil
+		}
+	}
+	return "", nil
+}
+
+// FindBadgeBySlug returns the published badge of a project with the given
+// certificate slug and the latest issue date, or nil
+func (s *BadgeStore) FindBadgeBySlug(scID, slug string) (*database.Badge, error) {
+	return s.findSoftwareBadge(scID, func(b *database.Badge) bool {
+		return b.IsPublished() && b.CertificateSlug() == slug
+	})
+}
+
+// FindLatestValidBadge returns the valid badge of a project with the given
+// certificate slug, or any if slug is empty, and the latest issue date, or nil
+func (s *BadgeStore) FindLatestValidBadge(scID, slug string) (*database.Badge, error) {
+	return s.findSoftwareBadge(scID, func(b *database.Badge) bool {
+		return b.IsPublished() && b.DisplayStatus() == "valid" && (slug == "" || b.CertificateSlug() == slug)
+	})
+}
+
+// findSoftwareBadge returns a copy of the badge of a project accepted by match
+// with the latest issue date, or nil
+func (s *BadgeStore) findSoftwareBadge(scID string, match func(b *database.Badge) bool) (*database.Badge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var found *database.Badge
+	for _, b := range s.Badges {
+		if b.SoftwareSCID.String != scID || !match(b) {
+			continue
+		}
+		if found == nil || b.IssueDate.After(found.IssueDate) {
+			found = b
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	c := *found
+	return &c, nil
+}
+
+// ApplyOrgTheme leaves the badge unchanged
+func (s *BadgeStore) ApplyOrgTheme(b *database.Badge) error {
+	return s.Err
+}
+
+// GetBadgeImage returns a stored render, or nil if none
+func (s *BadgeStore) GetBadgeImage(b *database.Badge, format string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Images[b.CommitID+"."+format], nil
+}
+
+// UpdateBadgeImage stores a render
+func (s *BadgeStore) UpdateBadgeImage(commitID, format string, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.Images[commitID+"."+format] = content
+	return nil
+}
+
+// GetDefaultTemplate returns the template stored for a badge type, or nil
+func (s *BadgeStore) GetDefaultTemplate(badgeType string) (*database.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Templates[badgeType], nil
+}
+
+// UserStore is an in-memory service.UserStore
+type UserStore struct {
+	mu            sync.Mutex
+	Users         map[string]*database.User
+	Roles         map[string]*database.Role
+	Organizations map[string]*database.Organization
+	Audit         []*database.UserAuditEntry
+	Sessions      map[string]*database.Session
+	LoginFailures map[string]*database.LoginFailure
+	// Err, when set, is returned by every method
+	Err error
+}
+
+// NewUserStore creates a user store holding the given roles and users
+func NewUserStore(roles []*database.Role, users ...*database.User) *UserStore {
+	s := &UserStore{
+		Users:         map[string]*database.User{},
+		Roles:         map[string]*database.Role{},
+		Organizations: map[string]*database.Organization{},
+		Sessions:      map[string]*database.Session{},
+		LoginFailures: map[string]*database.LoginFailure{},
+	}
+	for _, r := range roles {
+		s.Roles[r.RoleID] = r
+	}
+	for _, u := range users {
+		s.Users[u.UserID] = u
+	}
+	return s
+}
+
+// find returns a copy of the first user matching match, or nil
+func (s *UserStore) find(match func(u *database.User) bool) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	for _, u := range s.Users {
+		if match(u) {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// update applies fn to a stored user; unknown users are ignored like an
+// UPDATE matching no rows
+func (s *UserStore) update(userID string, fn func(u *database.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	if u, ok := s.Users[userID]; ok {
+		fn(u)
+	}
+	return nil
+}
+
+// GetUser returns a user by ID, or nil
+func (s *UserStore) GetUser(userID string) (*database.User, error) {
+	return s.find(func(u *database.User) bool { return u.UserID == userID })
+}
+
+// GetUserByUsername returns a user by username, or nil
+func (s *UserStore) GetUserByUsername(username string) (*database.User, error) {
+	return s.find(func(u *database.User) bool { return u.Username == username })
+}
+
+// GetUserByEmail returns a user by email, ignoring its case, or nil
+func (s *UserStore) GetUserByEmail(email string) (*database.User, error) {
+	email = database.NormalizeEmail(email)
+	return s.find(func(u *database.User) bool { return database.NormalizeEmail(u.Email) == email })
+}
+
+// CreateUser stores a copy of a user
+func (s *UserStore) CreateUser(user *database.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	c := *user
+	s.Users[user.UserID] = &c
+	return nil
+}
+
+// UpdateUser replaces a stored user
+func (s *UserStore) UpdateUser(user *database.User) error {
+	return s.update(user.UserID, func(u *database.User) { *u = *user })
+}
+
+// UpdateUserPassword sets a user's password hash
+func (s *UserStore) UpdateUserPassword(userID, passwordHash string) error {
+	return s.update(userID, func(u *database.User) { u.PasswordHash = passwordHash })
+}
+
+// UpdateUserFailedAttempts sets a user's failed login attempts
+func (s *UserStore) UpdateUserFailedAttempts(userID string, attempts int) error {
+	return s.update(userID, func(u *database.User) { u.FailedAttempts = attempts })
+}
+
+// UpdateUserLastLogin sets a user's last login time
+func (s *UserStore) UpdateUserLastLogin(userID string, lastLogin time.Time) error {
+	return s.update(userID, func(u *database.User) { u.LastLogin = sql.NullTime{Time: lastLogin, Valid: true} })
+}
+
+// GetRole returns a role by ID, or nil
+func (s *UserStore) GetRole(roleID string) (*database.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Roles[roleID], nil
+}
+
+// GetRoleByName returns a role by name, or nil
+func (s *UserStore) GetRoleByName(name string) (*database.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	for _, r := range s.Roles {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOrganization returns an organization by ID, or nil
+func (s *UserStore) GetOrganization(orgID string) (*database.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Organizations[orgID], nil
+}
+
+// CreateUserAuditEntry stores a copy of an audit entry
+func (s *UserStore) CreateUserAuditEntry(e *database.UserAuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	e.AuditID = int64(len(s.Audit) + 1)
+	c := *e
+	s.Audit = append(s.Audit, &c)
+	return nil
+}
+
+// ListUserAuditEntries returns the newest entries of an action, at most limit
+func (s *UserStore) ListUserAuditEntries(action string, limit int) ([]*database.UserAuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var entries []*database.UserAuditEntry
+	for i := len(s.Audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.Audit[i].Action == action {
+			c := *s.Audit[i]
+			entries = append(entries, &c)
+		}
+	}
+	return entries, nil
+}
+
+// CreateSession stores a copy of a session
+func (s *UserStore) CreateSession(session *database.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	c := *session
+	s.Sessions[session.SessionID] = &c
+	return nil
+}
+
+// GetSession returns a copy of a session by ID, or nil
+func (s *UserStore) GetSession(sessionID string) (*database.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	session, ok := s.Sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	c := *session
+	return &c, nil
+}
+
+// ListActiveSessions returns the sessions of a user neither revoked nor
+// expired at now, most recently seen first
+func (s *UserStore) ListActiveSessions(userID string, now time.Time) ([]*database.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var sessions []*database.Session
+	for _, session := range s.Sessions {
+		if session.UserID == userID && !session.RevokedAt.Valid && session.ExpiresAt.After(now) {
+			c := *session
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeen.After(sessions[j].LastSeen) })
+	return sessions, nil
+}
+
+// TouchSession sets the last use of a session
+func (s *UserStore) TouchSession(sessionID, ip string, lastSeen time.Time) error {
+	return s.updateSession(sessionID, func(session *database.Session) {
+		session.IP = ip
+		session.LastSeen = lastSeen
+	})
+}
+
+// ExtendSession sets the expiry of a session
+func (s *UserStore) ExtendSession(sessionID string, expiresAt time.Time) error {
+	return s.updateSession(sessionID, func(session *database.Session) { session.ExpiresAt = expiresAt })
+}
+
+// RevokeSession revokes a session that is not revoked yet
+func (s *UserStore) RevokeSession(sessionID string, revokedAt time.Time) error {
+	return s.updateSession(sessionID, func(session *database.Session) {
+		if !session.RevokedAt.Valid {
+			session.RevokedAt = sql.NullTime{Time: revokedAt, Valid: true}
+		}
+	})
+}
+
+// updateSession applies fn to a stored session; unknown sessions are ignored
+func (s *UserStore) updateSession(sessionID string, fn func(session *database.Session)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	if session, ok := s.Sessions[sessionID]; ok {
+		fn(session)
+	}
+	return nil
+}
+
+// GetLoginFailure returns a copy of the failed logins of key, or nil
+func (s *UserStore) GetLoginFailure(key string) (*database.LoginFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	f, ok := s.LoginFailures[key]
+	if !ok {
+		return nil, nil
+	}
+	c := *f
+	return &c, nil
+}
+
+// RecordLoginFailure counts a failed login of key, starting over when the
+// last one is before resetBefore
+func (s *UserStore) RecordLoginFailure(key string, at, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return 0, s.Err
+	}
+	f, ok := s.LoginFailures[key]
+	if !ok || f.LastFailure.Before(resetBefore) {
+		f = &database.LoginFailure{Key: key}
+		s.LoginFailures[key] = f
+	}
+	f.Failures++
+	f.LastFailure = at
+	return f.Failures, nil
+}
+
+// BlockLogin blocks logins of key until the given time
+func (s *UserStore) BlockLogin(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	if f, ok := s.LoginFailures[key]; ok {
+		f.BlockedUntil = sql.NullTime{Time: until, Valid: true}
+	}
+	return nil
+}
+
+// DeleteLoginFailure resets the failed logins of key
+func (s *UserStore) DeleteLoginFailure(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	delete(s.LoginFailures, key)
+	return nil
+}
+
+// Renderer is a service.Renderer returning fixed SVG and counting its calls
+type Renderer struct {
+	mu    sync.Mutex
+	SVG   []byte
+	Err   error
+	Calls int
+}
+
+// GenerateSVG returns SVG or Err
+func (r *Renderer) GenerateSVG(b *database.Badge) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Calls++
+	return r.SVG, r.Err
+}
@@ -0,0 +1,135 @@
+// Package signing holds the instance signing key used to sign public
+// verification responses, so third parties can check that a response really
+// came from this instance and was not altered on the way.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Algorithm is the signature algorithm advertised alongside signatures
+const Algorithm = "ed25519"
+
+// Signer signs data with the instance's Ed25519 key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// New creates a signer for an existing private key
+func New(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256, in hex
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePublicKeyPEM reads a PEM encoded PKIX Ed25519 public key, as written by
+// PublicKeyPEM
+func ParsePublicKeyPEM(data string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return key, nil
+}
+
+// LoadOrCreate reads a PEM encoded PKCS#8 Ed25519 private key from path. If the
+// file does not exist a new key is generated and written there, so the key
+// survives restarts without any setup.
+func LoadOrCreate(path string) (*Signer, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s, err := generate(path)
+		return s, true, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, false, fmt.Errorf("signing key %s is not a PEM encoded private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, false, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return New(key), false, nil
+}
+
+// generate creates a new key and stores it at path
+func generate(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return New(key), nil
+}
+
+// KeyID identifies the key: the first 8 bytes of the SHA-256 of the public key, in hex
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey returns the public half of the signing key
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// PublicKeyPEM returns the public key as a PEM encoded PKIX block
+func (s *Signer) PublicKeyPEM() string {
+	der, _ := x509.MarshalPKIXPublicKey(s.PublicKey())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Sign returns the base64 encoded signature of data
+func (s *Signer) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+// Verify checks a base64 encoded signature made by Sign
+func Verify(pub ed25519.PublicKey, data []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, data, sig)
+}
@@ -0,0 +1,39 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateReusesKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "key")
+	first, _, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("failed to create signing key: %v", err)
+	}
+	second, created, err := LoadOrCreate(path)
+	if err != nil || created {
+		t.Fatalf("expected the stored key to be loaded, err %v, created %v", err, created)
+	}
+	if !ed25519.PublicKey.Equal(first.PublicKey(), second.PublicKey()) {
+		t.Error("expected the same key after reloading")
+	}
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	signer, _, err := LoadOrCreate(filepath.Join(t.TempDir(), "key"))
+	if err != nil {
+		t.Fatalf("failed to create signing key: %v", err)
+	}
+	pub, err := ParsePublicKeyPEM(signer.PublicKeyPEM())
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	if !pub.Equal(signer.PublicKey()) || KeyID(pub) != signer.KeyID() {
+		t.Error("expected the parsed key to match the signer")
+	}
+	if _, err := ParsePublicKeyPEM("not a key"); err == nil {
+		t.Error("expected an error for invalid PEM")
+	}
+}
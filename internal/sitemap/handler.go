@@ -0,0 +1,151 @@
+// Package sitemap serves /sitemap.xml and /robots.txt so that search engines
+// index the public details pages without crawling the image endpoints.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/links"
+	"go.uber.org/zap"
+)
+
+const (
+	// cacheTTL bounds how stale the sitemap can be after a badge changes
+	cacheTTL = 5 * time.Minute
+	// maxURLs is the sitemap protocol limit for a single file
+	maxURLs = 50000
+)
+
+// defaultRobots keeps crawlers on the HTML pages; {{sitemap}} is replaced with
+// the absolute sitemap URL
+const defaultRobots = `User-agent: *
+Disallow: /badge/
+Disallow: /certificate/
+Disallow: /api/
+Disallow: /admin
+Disallow: /edit/
+Disallow: /certificates/new
+Disallow: /backup
+Disallow: /restore
+Disallow: /password
+
+Sitemap: {{sitemap}}
+`
+
+// urlSet is the root element of a sitemap
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []url    `xml:"url"`
+}
+
+// url is a single sitemap entry
+type url struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Handler serves the sitemap and robots.txt
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	cache  *cache.Cache
+	robots string
+}
+
+// NewHandler creates a new sitemap handler. robotsFile optionally replaces the
+// built-in robots.txt; it may use the {{sitemap}} placeholder too.
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache, robotsFile string) (*Handler, error) {
+	robots := defaultRobots
+	if robotsFile != "" {
+		data, err := os.ReadFile(robotsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read robots file: %w", err)
+		}
+		robots = string(data)
+	}
+
+	return &Handler{
+		db:     db,
+		logger: logger,
+		cache:  cache,
+		robots: robots,
+	}, nil
+}
+
+// ServeSitemap serves /sitemap.xml with every public details page
+func (h *Handler) ServeSitemap(w http.ResponseWriter, r *http.Request) {
+	base := links.ForRequest(r)
+	cacheKey := "sitemap:" + base
+	if cachedData, found := h.cache.Get(cacheKey); found {
+		h.serveXML(w, cachedData)
+		return
+	}
+
+	badges, err := h.db.WithContext(r.Context()).ListBadges()
+	if err != nil {
+		h.logger.Error("Failed to list badges for sitemap", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	set := urlSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, b := range badges {
+		// Drafts and badges pending review are not public
+		if !b.IsPublished() {
+			continue
+		}
+		if len(set.URLs) == maxURLs {
+			h.logger.Warn("Sitemap truncated", zap.Int("max_urls", maxURLs))
+			break
+		}
+		set.URLs = append(set.URLs, url{
+			Loc:     base + "/details/" + b.CommitID,
+			LastMod: lastMod(b),
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		h.logger.Error("Failed to encode sitemap", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.cache.Set(cacheKey, buf.Bytes(), cacheTTL)
+	h.serveXML(w, buf.Bytes())
+}
+
+// ServeRobots serves /robots.txt
+func (h *Handler) ServeRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write([]byte(strings.ReplaceAll(h.robots, "{{sitemap}}", links.ForRequest(r)+"/sitemap.xml")))
+}
+
+// serveXML writes a sitemap response
+func (h *Handler) serveXML(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(data)
+}
+
+// lastMod returns the date of the last review, falling back to the issue
+// date; badges without either are left out
+func lastMod(b *database.Badge) string {
+	if b.LastReview.Valid {
+		return database.FormatNullDate(b.LastReview)
+	}
+	return database.FormatDate(b.IssueDate)
+}
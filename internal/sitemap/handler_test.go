@@ -0,0 +1,107 @@
+package sitemap
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/links"
+	"go.uber.org/zap"
+)
+
+func TestServeSitemap(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "sitemap.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for _, b := range []*database.Badge{
+		{CommitID: "review1", Status: "valid", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), LastReview: sql.NullTime{Time: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true}},
+		{CommitID: "issued1", Status: "revoked", IssueDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{CommitID: "draft12", Status: "draft", IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		b.Type, b.Issuer, b.SoftwareName, b.SoftwareVersion = "badge", "Test Issuer", "eduTEAMS", "v1.0.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+
+	h, err := NewHandler(db, logger, cache.New(), "")
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeSitemap(rec, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	var set urlSet
+	if err := xml.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("Invalid sitemap: %v", err)
+	}
+	got := map[string]string{}
+	for _, u := range set.URLs {
+		got[u.Loc] = u.LastMod
+	}
+	want := map[string]string{
+		"http://example.com/details/review1": "2025-03-01",
+		"http://example.com/details/issued1": "2024-02-01",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d URLs, got %v", len(want), got)
+	}
+	for loc, lastmod := range want {
+		if got[loc] != lastmod {
+			t.Errorf("Expected %s with lastmod %s, got %q", loc, lastmod, got[loc])
+		}
+	}
+}
+
+func TestServeRobots(t *testing.T) {
+	h, err := NewHandler(nil, zap.NewNop(), cache.New(), "")
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	// X-Forwarded-Proto is honoured from trusted proxies only
+	links.SetTrustedProxy(func(*http.Request) bool { return true })
+	t.Cleanup(func() { links.SetTrustedProxy(nil) })
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	h.ServeRobots(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{"Disallow: /badge/\n", "Disallow: /certificate/\n", "Sitemap: https://example.com/sitemap.xml\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected robots.txt to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	robotsFile := filepath.Join(t.TempDir(), "robots.txt")
+	if err := os.WriteFile(robotsFile, []byte("User-agent: *\nDisallow: /\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err = NewHandler(nil, zap.NewNop(), cache.New(), robotsFile)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeRobots(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if rec.Body.String() != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("Expected the configured robots.txt, got %q", rec.Body.String())
+	}
+
+	if _, err := NewHandler(nil, zap.NewNop(), cache.New(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing robots file")
+	}
+}
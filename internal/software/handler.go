@@ -0,0 +1,189 @@
+// Package software serves the landing page of a Software Catalogue project:
+// every badge and certificate issued for it, as HTML or JSON.
+package software
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/assets"
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpcache"
+	"github.com/finki/badges/internal/links"
+	"github.com/finki/badges/internal/version"
+	"go.uber.org/zap"
+)
+
+// Certificate is a badge issued for the project, as listed on the page and in
+// the JSON response
+type Certificate struct {
+	CertID          string `json:"cert_id"`
+	CertificateName string `json:"certificate_name,omitempty"`
+	SoftwareName    string `json:"software_name"`
+	SoftwareVersion string `json:"software_version"`
+	Status          string `json:"status"`
+	IssueDate       string `json:"issue_date"`
+	ExpiryDate      string `json:"expiry_date,omitempty"`
+	IsExpired       bool   `json:"is_expired"`
+	DetailsLink     string `json:"details_link"`
+	BadgeLink       string `json:"badge_link"`
+	// VanityBadgeLink addresses the newest certificate with this name, so it
+	// stays valid when the certificate is reissued
+	VanityBadgeLink string `json:"vanity_badge_link,omitempty"`
+}
+
+// Software is the JSON representation of the landing page
+type Software struct {
+	SoftwareSCID  string         `json:"software_sc_id"`
+	SoftwareSCURL string         `json:"software_sc_url,omitempty"`
+	SoftwareName  string         `json:"software_name"`
+	Certificates  []*Certificate `json:"certificates"`
+}
+
+// TemplateData represents the data passed to the landing page template
+type TemplateData struct {
+	Software
+	// CompositeIDs lists the commit IDs for the combined badge strip
+	CompositeIDs string
+	CurrentYear  int
+	Version      string
+	Commit       string
+}
+
+// Handler handles /software/{software_sc_id} requests
+type Handler struct {
+	db       *database.DB
+	logger   *zap.Logger
+	cache    *cache.Cache
+	template *assets.Template
+}
+
+// NewHandler creates a new software landing page handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) (*Handler, error) {
+	tmpl, err := assets.ParseTemplate("software/software.html")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		db:       db,
+		logger:   logger,
+		cache:    cache,
+		template: tmpl,
+	}, nil
+}
+
+// ServeHTTP handles HTTP requests for the software landing page
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/software/"), "/")
+	if !commitid.SoftwareIDPattern.MatchString(scID) {
+		http.Error(w, "Invalid software ID", http.StatusBadRequest)
+		return
+	}
+
+	// Content negotiation: JSON vs HTML, with a ?format=json|html override
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "json":
+		wantsJSON = true
+	case "html":
+		wantsJSON = false
+	default:
+		httpcache.Vary(w, "Accept")
+	}
+
+	// Drafts are only listed for users with badges:write
+	canSeeDrafts := false
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
+		canSeeDrafts = claims.Permissions.Allows("badges", "write")
+	}
+
+	badges, err := h.db.WithContext(r.Context()).ListBadgesBySoftwareSCID(scID)
+	if err != nil {
+		h.logger.Error("Failed to list software badges", zap.Error(err), zap.String("software_sc_id", scID))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	software := Software{SoftwareSCID: scID, Certificates: []*Certificate{}}
+	for _, b := range badges {
+		// Organization admins only see the drafts of their own organization
+		if !b.IsPublished() && !(canSeeDrafts && auth.CanAccessOrg(r.Context(), b.OrgID.String)) {
+			continue
+		}
+		if software.SoftwareName == "" {
+			software.SoftwareName = b.SoftwareName
+		}
+		if software.SoftwareSCURL == "" && b.SoftwareSCURL.Valid {
+			software.SoftwareSCURL = b.SoftwareSCURL.String
+		}
+		software.Certificates = append(software.Certificates, newCertificate(b, links.ForRequest(r)))
+	}
+	if len(software.Certificates) == 0 {
+		http.Error(w, "Software not found", http.StatusNotFound)
+		return
+	}
+
+	if wantsJSON {
+		payload, err := json.Marshal(software)
+		if err != nil {
+			h.logger.Error("Failed to marshal software JSON", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(payload)
+		return
+	}
+
+	// The strip shows the newest certificates the composite endpoint can combine
+	var ids []string
+	for _, c := range software.Certificates {
+		if len(ids) < badge.MaxCompositeBadges {
+			ids = append(ids, c.CertID)
+		}
+	}
+	data := TemplateData{
+		Software:     software,
+		CompositeIDs: strings.Join(ids, ","),
+		CurrentYear:  time.Now().Year(),
+		Version:      version.Version,
+		Commit:       version.Commit,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.template.Execute(w, data); err != nil {
+		h.logger.Error("Failed to render template", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// newCertificate converts a badge into its landing page entry
+func newCertificate(b *database.Badge, base string) *Certificate {
+	c := &Certificate{
+		CertID:          b.CommitID,
+		SoftwareName:    b.SoftwareName,
+		SoftwareVersion: b.SoftwareVersion,
+		Status:          string(b.Status),
+		IssueDate:       database.FormatDate(b.IssueDate),
+		IsExpired:       b.IsExpired(),
+		DetailsLink:     base + "/details/" + b.CommitID,
+		BadgeLink:       base + "/badge/" + b.CommitID,
+	}
+	if b.CertificateName.Valid {
+		c.CertificateName = b.CertificateName.String
+	}
+	if slug := b.CertificateSlug(); slug != "" {
+		c.VanityBadgeLink = base + "/badge/" + b.SoftwareSCID.String + "/" + slug
+	}
+	if b.ExpiryDate.Valid {
+		c.ExpiryDate = database.FormatNullDate(b.ExpiryDate)
+	}
+	return c
+}
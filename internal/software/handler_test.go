@@ -0,0 +1,103 @@
+package software
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+func TestSoftwareHandler(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "software.db")
+	// Templates are loaded relative to the repository root
+	t.Chdir("../..")
+
+	logger := zap.NewNop()
+	db, err := database.New(dbFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	scID := sql.NullString{String: "eduteams", Valid: true}
+	for _, b := range []*database.Badge{
+		{CommitID: "deps123", Status: "valid", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: sql.NullString{String: "Verified Dependencies", Valid: true}},
+		{CommitID: "lic1234", Status: "valid", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID, CertificateName: sql.NullString{String: "Licence Assurance", Valid: true}},
+		{CommitID: "draft12", Status: "draft", IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: scID},
+		{CommitID: "other12", Status: "valid", IssueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), SoftwareSCID: sql.NullString{String: "other", Valid: true}},
+	} {
+		b.Type, b.Issuer, b.SoftwareName, b.SoftwareVersion = "badge", "Test Issuer", "eduTEAMS", "v1.0.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("Failed to create test badge: %v", err)
+		}
+	}
+
+	h, err := NewHandler(db, logger, cache.New())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/software/eduteams?format=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got Software
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(got.Certificates) != 2 || got.Certificates[0].CertID != "lic1234" || got.Certificates[1].CertID != "deps123" {
+		t.Errorf("Expected the two public certificates newest first, got %+v", got.Certificates)
+	}
+	if got.Certificates[0].DetailsLink != "http://example.com/details/lic1234" {
+		t.Errorf("Unexpected details link %q", got.Certificates[0].DetailsLink)
+	}
+	if got.Certificates[0].VanityBadgeLink != "http://example.com/badge/eduteams/licence-assurance" {
+		t.Errorf("Unexpected vanity link %q", got.Certificates[0].VanityBadgeLink)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/software/eduteams", nil))
+	body := rec.Body.String()
+	for _, want := range []string{`href="/details/deps123"`, `/badge/composite?ids=lic1234%2cdeps123`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+	if strings.Contains(body, "draft12") {
+		t.Error("Expected drafts to be hidden")
+	}
+
+	for url, status := range map[string]int{
+		"/software/unknown":   http.StatusNotFound,
+		"/software/":          http.StatusBadRequest,
+		"/software/bad%20id!": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d", url, status, rec.Code)
+		}
+	}
+
+	// Vanity URLs resolve to the newest published certificate with the name
+	reissued := &database.Badge{CommitID: "lic5678", Type: "badge", Status: "valid", Issuer: "Test Issuer", IssueDate: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "eduTEAMS", SoftwareVersion: "v2.0.0", SoftwareSCID: scID, CertificateName: sql.NullString{String: "Licence Assurance", Valid: true}}
+	if err := db.CreateBadge(reissued); err != nil {
+		t.Fatalf("Failed to create test badge: %v", err)
+	}
+	if b, err := db.FindBadgeBySlug("eduteams", "licence-assurance"); err != nil || b == nil || b.CommitID != "lic5678" {
+		t.Errorf("Expected the reissued certificate, got %+v (err %v)", b, err)
+	}
+	if b, err := db.FindBadgeBySlug("other", "licence-assurance"); err != nil || b != nil {
+		t.Errorf("Expected no certificate of another project, got %+v (err %v)", b, err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package stats counts badge image requests and renders per badge and day,
+// and the sites the requests come from. Counts are kept in memory and added
+// to the database periodically, so that serving an image never waits for a
+// write. Nothing identifying a visitor is recorded: only aggregated counts and
+// the scheme and host of the referring page.
+package stats
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// FlushInterval is how often the counts are written to the database
+const FlushInterval = time.Minute
+
+// maxReferrerLength bounds the referrers recorded
+const maxReferrerLength = 255
+
+// key identifies the counts of a badge on a day, in total or from a referrer
+type key struct {
+	day      string
+	commitID string
+	referrer string
+}
+
+// Recorder counts badge image requests and renders. A nil *Recorder records
+// nothing.
+type Recorder struct {
+	db        *database.DB
+	logger    *zap.Logger
+	mu        sync.Mutex
+	counts    map[key]*database.BadgeStats
+	referrers map[key]*database.ReferrerStats
+	now       func() time.Time
+	// honorDNT skips the referrer of requests sending DNT or Sec-GPC
+	honorDNT bool
+	// aggregateAfter is the age in days after which daily counts are merged
+	// into monthly ones; 0 keeps them
+	aggregateAfter int
+}
+
+// NewRecorder creates a recorder writing to db
+func NewRecorder(db *database.DB, logger *zap.Logger) *Recorder {
+	return &Recorder{
+		db:        db,
+		logger:    logger,
+		counts:    map[key]*database.BadgeStats{},
+		referrers: map[key]*database.ReferrerStats{},
+		now:       time.Now,
+		honorDNT:  true,
+	}
+}
+
+// SetHonorDNT sets whether the referrer of requests asking not to be tracked,
+// with DNT: 1 or Sec-GPC: 1, is left out; they are still counted. It is on by
+// default.
+func (r *Recorder) SetHonorDNT(honor bool) {
+	r.honorDNT = honor
+}
+
+// SetAggregateAfter makes Run merge daily counts older than days into one
+// count per badge (and referrer) and month, dated the first of the month; 0
+// keeps daily counts
+func (r *Recorder) SetAggregateAfter(days int) {
+	r.aggregateAfter = days
+}
+
+// Request counts a served image of a badge, from the cache or not, and the
+// site of its Referer header, if any
+func (r *Recorder) Request(commitID string, req *http.Request) {
+	if r == nil {
+		return
+	}
+	r.add(commitID, 1, 0)
+
+	if r.honorDNT && (req.Header.Get("DNT") == "1" || req.Header.Get("Sec-GPC") == "1") {
+		return
+	}
+	site := Referrer(req.Referer())
+	if site == "" {
+		return
+	}
+	k := key{day: r.now().UTC().Format("2006-01-02"), commitID: commitID, referrer: site}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.referrers[k]
+	if !ok {
+		s = &database.ReferrerStats{Day: k.day, CommitID: commitID, Referrer: site}
+		r.referrers[k] = s
+	}
+	s.Requests++
+}
+
+// Render counts an image of a badge that had to be generated
+func (r *Recorder) Render(commitID string) {
+	if r == nil {
+		return
+	}
+	r.add(commitID, 0, 1)
+}
+
+// add adds to the counts of a badge today
+func (r *Recorder) add(commitID string, requests, renders int64) {
+	k := key{day: r.now().UTC().Format("2006-01-02"), commitID: commitID}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.counts[k]
+	if !ok {
+		s = &database.BadgeStats{Day: k.day, CommitID: commitID}
+		r.counts[k] = s
+	}
+	s.Requests += requests
+	s.Renders += renders
+}
+
+// Referrer returns the scheme and host of an http(s) Referer header in lower
+// case, e.g. "https://github.com", or "" if there is none; paths and query
+// strings are dropped as they may identify a visitor
+func Referrer(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	site := strings.ToLower(u.Scheme + "://" + u.Host)
+	if len(site) > maxReferrerLength {
+		return ""
+	}
+	return site
+}
+
+// Flush writes the counts recorded so far to the database. Counts that cannot
+// be written are kept for the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	counts, referrers := r.counts, r.referrers
+	r.counts, r.referrers = map[key]*database.BadgeStats{}, map[key]*database.ReferrerStats{}
+	r.mu.Unlock()
+	if len(counts) == 0 && len(referrers) == 0 {
+		return nil
+	}
+
+	stats := make([]*database.BadgeStats, 0, len(counts))
+	for _, s := range counts {
+		stats = append(stats, s)
+	}
+	sites := make([]*database.ReferrerStats, 0, len(referrers))
+	for _, s := range referrers {
+		sites = append(sites, s)
+	}
+	if err := r.db.WithContext(ctx).AddBadgeStats(stats, sites); err != nil {
+		r.mu.Lock()
+		for k, s := range counts {
+			if c, ok := r.counts[k]; ok {
+				s.Requests += c.Requests
+				s.Renders += c.Renders
+			}
+			r.counts[k] = s
+		}
+		for k, s := range referrers {
+			if c, ok := r.referrers[k]; ok {
+				s.Requests += c.Requests
+			}
+			r.referrers[k] = s
+		}
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Forget drops the counts of a badge not written yet, e.g. when its
+// statistics are purged
+func (r *Recorder) Forget(commitID string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.counts {
+		if k.commitID == commitID {
+			delete(r.counts, k)
+		}
+	}
+	for k := range r.referrers {
+		if k.commitID == commitID {
+			delete(r.referrers, k)
+		}
+	}
+}
+
+// Aggregate merges the daily counts older than the configured age into
+// monthly counts
+func (r *Recorder) Aggregate(ctx context.Context) error {
+	if r == nil || r.aggregateAfter <= 0 {
+		return nil
+	}
+	before := r.now().UTC().AddDate(0, 0, -r.aggregateAfter).Format("2006-01-02")
+	return r.db.WithContext(ctx).AggregateBadgeStats(before)
+}
+
+// Run flushes the counts every FlushInterval and aggregates old counts once a
+// day until ctx is done; the last counts are left for a final Flush once the
+// server has stopped
+func (r *Recorder) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	var aggregated string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				r.logger.Error("stats: failed to write badge stats", zap.Error(err))
+			}
+			if today := r.now().UTC().Format("2006-01-02"); today != aggregated {
+				if err := r.Aggregate(ctx); err != nil {
+					r.logger.Error("stats: failed to aggregate badge stats", zap.Error(err))
+					continue
+				}
+				aggregated = today
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package stats
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRecorder(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "stats.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	r := NewRecorder(db, logger)
+	day := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return day }
+	r.Request("abc123", testutil.ImageRequest(""))
+	r.Render("abc123")
+	r.Request("abc123", testutil.ImageRequest(""))
+	r.Request("def456", testutil.ImageRequest(""))
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// Counts of the same day add up across flushes
+	r.Request("def456", testutil.ImageRequest(""))
+	r.Request("def456", testutil.ImageRequest(""))
+	day = day.Add(2 * time.Hour)
+	r.Request("abc123", testutil.ImageRequest(""))
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	daily, err := db.ListDailyStats("2026-03-01")
+	if err != nil {
+		t.Fatalf("ListDailyStats: %v", err)
+	}
+	if len(daily) != 2 || daily[0].Day != "2026-03-01" || daily[0].Requests != 5 || daily[0].Renders != 1 || daily[1].Requests != 1 {
+		t.Errorf("expected two days of counts, got %+v", daily)
+	}
+
+	top, err := db.TopRequestedBadges("2026-03-01", 1)
+	if err != nil {
+		t.Fatalf("TopRequestedBadges: %v", err)
+	}
+	if len(top) != 1 || top[0].CommitID != "abc123" || top[0].Requests != 3 {
+		t.Errorf("expected abc123 to be the most requested, got %+v", top)
+	}
+	if top, _ := db.TopRequestedBadges("2026-03-02", 10); len(top) != 1 || top[0].Requests != 1 {
+		t.Errorf("expected only the second day to count, got %+v", top)
+	}
+
+	// Referrers are kept as scheme and host only
+	r.Request("abc123", testutil.ImageRequest("https://GitHub.com/org/repo?tab=readme"))
+	r.Request("abc123", testutil.ImageRequest("https://github.com/other/repo"))
+	r.Request("abc123", testutil.ImageRequest("http://example.org:8080/docs"))
+	r.Request("abc123", testutil.ImageRequest("android-app://com.example"))
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	referrers, err := db.TopReferrers("abc123", "2026-03-01", 10)
+	if err != nil {
+		t.Fatalf("TopReferrers: %v", err)
+	}
+	if len(referrers) != 2 || referrers[0].Referrer != "https://github.com" || referrers[0].Requests != 2 ||
+		referrers[1].Referrer != "http://example.org:8080" {
+		t.Errorf("expected two referring sites, got %+v", referrers)
+	}
+	if daily, _ := db.ListBadgeDailyStats("abc123", "2026-03-02"); len(daily) != 1 || daily[0].Requests != 5 {
+		t.Errorf("expected the referred requests to count, got %+v", daily)
+	}
+
+	// Counts that cannot be written are kept for the next flush
+	r.Request("abc123", testutil.ImageRequest(""))
+	db.Close()
+	if err := r.Flush(ctx); err == nil {
+		t.Fatal("expected Flush to fail on a closed database")
+	}
+	if s := r.counts[key{day: "2026-03-02", commitID: "abc123"}]; s == nil || s.Requests != 1 {
+		t.Errorf("expected the counts to be kept, got %+v", s)
+	}
+
+	// A nil recorder records nothing
+	var none *Recorder
+	none.Request("abc123", testutil.ImageRequest(""))
+	if err := none.Flush(ctx); err != nil {
+		t.Errorf("expected a nil recorder to flush nothing, got %v", err)
+	}
+}
+
+func TestRecorderPrivacy(t *testing.T) {
+	logger := zap.NewNop()
+	db, err := database.New(filepath.Join(t.TempDir(), "stats.db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	r := NewRecorder(db, logger)
+	day := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return day }
+
+	// Requests asking not to be tracked count without their referrer
+	dnt := testutil.ImageRequest("https://github.com/org/repo")
+	dnt.Header.Set("DNT", "1")
+	gpc := testutil.ImageRequest("https://github.com/org/repo")
+	gpc.Header.Set("Sec-GPC", "1")
+	r.Request("abc123", dnt)
+	r.Request("abc123", gpc)
+	if len(r.referrers) != 0 || r.counts[key{day: "2026-01-10", commitID: "abc123"}].Requests != 2 {
+		t.Errorf("expected only the requests to be counted, got %+v", r.referrers)
+	}
+	r.SetHonorDNT(false)
+	r.Request("abc123", dnt)
+	if len(r.referrers) != 1 {
+		t.Errorf("expected the referrer to be counted, got %+v", r.referrers)
+	}
+
+	// Forget drops the pending counts of a badge only
+	r.Request("def456", testutil.ImageRequest("https://example.org/"))
+	r.Forget("abc123")
+	if len(r.counts) != 1 || len(r.referrers) != 1 {
+		t.Errorf("expected only def456 to be left, got %+v %+v", r.counts, r.referrers)
+	}
+	r.Forget("def456")
+
+	// Daily counts older than the configured age are merged per month
+	for _, d := range []time.Time{
+		time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		day = d
+		r.Request("abc123", testutil.ImageRequest("https://github.com/org/repo"))
+		r.Render("abc123")
+	}
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	day = time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	if err := r.Aggregate(ctx); err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	if daily, _ := db.ListBadgeDailyStats("abc123", "2026-01-01"); len(daily) != 4 {
+		t.Errorf("expected no aggregation by default, got %+v", daily)
+	}
+	r.SetAggregateAfter(30)
+	if err := r.Aggregate(ctx); err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	daily, err := db.ListBadgeDailyStats("abc123", "2026-01-01")
+	if err != nil {
+		t.Fatalf("ListBadgeDailyStats: %v", err)
+	}
+	if len(daily) != 3 || daily[0].Day != "2026-01-01" || daily[0].Requests != 2 || daily[0].Renders != 2 ||
+		daily[1].Day != "2026-02-03" || daily[2].Day != "2026-03-01" {
+		t.Errorf("expected January to be merged, got %+v", daily)
+	}
+	referrers, _ := db.TopReferrers("abc123", "2026-01-01", 10)
+	if len(referrers) != 1 || referrers[0].Requests != 4 {
+		t.Errorf("expected the referrer counts to be kept, got %+v", referrers)
+	}
+	// Aggregating again changes nothing
+	if err := r.Aggregate(ctx); err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	if again, _ := db.ListBadgeDailyStats("abc123", "2026-01-01"); len(again) != 3 || again[0].Requests != 2 {
+		t.Errorf("expected the same counts, got %+v", again)
+	}
+}
@@ -0,0 +1,205 @@
+// Package svgsafe removes active content from SVG documents before they are
+// stored or served as image/svg+xml. Browsers run scripts, event handlers and
+// embedded HTML of an SVG opened directly, and follow its external
+// references, so user-supplied SVG — stored svg_content and the output of
+// uploaded certificate templates — goes through Sanitize first.
+package svgsafe
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// ErrInvalid is returned for input that is not a well-formed SVG document
+var ErrInvalid = errors.New("invalid SVG")
+
+// forbiddenElements are dropped with their content wherever they appear
+var forbiddenElements = map[string]bool{
+	"script": true, "foreignObject": true, "iframe": true, "object": true,
+	"embed": true, "handler": true, "listener": true,
+}
+
+// animations can set attributes, such as href, that are checked on elements
+var animations = map[string]bool{
+	"animate": true, "set": true, "animateMotion": true, "animateTransform": true,
+}
+
+var (
+	// urlPattern matches url(...) references in attribute and style values
+	urlPattern = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]*)['"]?\s*\)`)
+	// unsafeStyle matches CSS that can load resources or run code
+	unsafeStyle = regexp.MustCompile(`(?i)@import|expression\s*\(|javascript:|behavior\s*:|-moz-binding`)
+	// rasterData matches data URLs of images that cannot carry scripts
+	rasterData = regexp.MustCompile(`(?i)^\s*data:image/(png|jpeg|gif|webp);`)
+)
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// Sanitize returns data without scripts, foreignObject and other embedded
+// documents, event handler attributes, references outside the document
+// (except raster data URLs), unsafe CSS, elements and attributes of foreign
+// namespaces, comments, processing instructions and DOCTYPE declarations.
+// It fails if data is not well-formed XML with an <svg> root element.
+func Sanitize(data []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	// stack holds the written name of each open element, "" if dropped
+	var stack []string
+	skip, root := 0, false
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !root {
+				if t.Name.Local != "svg" || (t.Name.Space != "" && t.Name.Space != svgNamespace) {
+					return nil, fmt.Errorf("%w: root element is not <svg>", ErrInvalid)
+				}
+				root = true
+			} else if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: more than one root element", ErrInvalid)
+			}
+			if skip > 0 || !allowedElement(t) {
+				skip++
+				stack = append(stack, "")
+				continue
+			}
+			out.WriteString("<" + t.Name.Local)
+			written := map[string]bool{}
+			for _, a := range t.Attr {
+				if name, ok := attrName(a); ok && safeValue(name, a.Value) {
+					out.WriteString(" " + name + `="` + attrEscaper.Replace(a.Value) + `"`)
+					written[name] = true
+				}
+			}
+			// xlink attributes are written with the xlink prefix, whatever
+			// prefix the input declared
+			if len(stack) == 0 {
+				if !written["xmlns"] {
+					out.WriteString(` xmlns="` + svgNamespace + `"`)
+				}
+				if !written["xmlns:xlink"] {
+					out.WriteString(` xmlns:xlink="` + xlinkNamespace + `"`)
+				}
+			}
+			stack = append(stack, t.Name.Local)
+			out.WriteString(">")
+		case xml.EndElement:
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if name == "" {
+				skip--
+				continue
+			}
+			out.WriteString("</" + name + ">")
+		case xml.CharData:
+			if len(stack) == 0 || skip > 0 {
+				continue
+			}
+			// Unsafe style sheets are emptied rather than partly kept
+			if stack[len(stack)-1] == "style" && !safeCSS(string(t)) {
+				continue
+			}
+			out.WriteString(textEscaper.Replace(string(t)))
+		}
+		// Comments, processing instructions and directives are dropped
+	}
+	if !root {
+		return nil, fmt.Errorf("%w: no <svg> element", ErrInvalid)
+	}
+	return out.Bytes(), nil
+}
+
+// allowedElement reports whether an element is kept: SVG elements other than
+// the forbidden ones and animations of references or event handlers
+func allowedElement(t xml.StartElement) bool {
+	if t.Name.Space != "" && t.Name.Space != svgNamespace {
+		return false
+	}
+	if forbiddenElements[t.Name.Local] {
+		return false
+	}
+	if animations[t.Name.Local] {
+		for _, a := range t.Attr {
+			if a.Name.Local == "attributeName" {
+				target := strings.ToLower(strings.TrimSpace(a.Value))
+				if strings.HasSuffix(target, "href") || strings.HasPrefix(target, "on") {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// attrName returns the name to write an attribute under, if it is kept:
+// unprefixed attributes other than event handlers, xlink and xml attributes,
+// and the declaration of the xlink prefix
+func attrName(a xml.Attr) (string, bool) {
+	switch a.Name.Space {
+	case "":
+		if strings.HasPrefix(strings.ToLower(a.Name.Local), "on") {
+			return "", false
+		}
+		return a.Name.Local, true
+	case xlinkNamespace:
+		return "xlink:" + a.Name.Local, true
+	case xmlNamespace:
+		return "xml:" + a.Name.Local, true
+	case "xmlns":
+		return "xmlns:" + a.Name.Local, a.Name.Local == "xlink" && a.Value == xlinkNamespace
+	}
+	return "", false
+}
+
+// safeValue reports whether an attribute value only refers to the document
+// itself or to raster data
+func safeValue(name, value string) bool {
+	switch {
+	case name == "href" || name == "xlink:href" || name == "src":
+		v := strings.TrimSpace(value)
+		return strings.HasPrefix(v, "#") || rasterData.MatchString(v)
+	case name == "style":
+		return safeCSS(value)
+	case name == "xmlns":
+		return value == svgNamespace
+	}
+	return localURLs(value)
+}
+
+// safeCSS reports whether CSS neither imports nor runs anything and only
+// refers to the document
+func safeCSS(css string) bool {
+	return !unsafeStyle.MatchString(css) && localURLs(css)
+}
+
+// localURLs reports whether every url(...) in value is a fragment reference
+func localURLs(value string) bool {
+	for _, m := range urlPattern.FindAllStringSubmatch(value, -1) {
+		if ref := strings.TrimSpace(m[1]); !strings.HasPrefix(ref, "#") && !rasterData.MatchString(ref) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package svgsafe
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	svg := `<?xml version="1.0"?>
+<!DOCTYPE svg>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:x="http://www.w3.org/1999/xlink" xmlns:html="http://www.w3.org/1999/xhtml" width="24" height="12" onload="alert(1)">
+  <!-- comment -->
+  <script>alert(1)</script>
+  <style>@import url(https://evil.example/x.css);</style>
+  <style>.a { fill: url(#g) }</style>
+  <defs><linearGradient id="g"><stop offset="0" stop-color="#fff"/></linearGradient></defs>
+  <rect class="a" width="24" height="12" fill="url(#g)" ONCLICK="alert(1)"/>
+  <path d="M0 0h4" style="fill:url(https://evil.example/x.svg)"/>
+  <use x:href="#g"/>
+  <use href="https://evil.example/sprite.svg#a"/>
+  <a href="javascript:alert(1)"><text xml:space="preserve">A &amp; B &lt;3</text></a>
+  <foreignObject><div>html</div></foreignObject>
+  <html:iframe src="https://evil.example"/>
+  <image href="data:image/png;base64,AAAA"/>
+  <image href="data:image/svg+xml;base64,AAAA"/>
+  <set attributeName="href" to="javascript:alert(1)"/>
+  <animate attributeName="opacity" from="0" to="1"/>
+</svg>`
+
+	out, err := Sanitize([]byte(svg))
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="24" height="12" xmlns:xlink="http://www.w3.org/1999/xlink">`,
+		`<style>.a { fill: url(#g) }</style>`, `fill="url(#g)"`, `<use xlink:href="#g">`,
+		`<text xml:space="preserve">A &amp; B &lt;3</text>`, `<image href="data:image/png;base64,AAAA">`,
+		`<animate attributeName="opacity"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in %s", want, got)
+		}
+	}
+	for _, banned := range []string{"alert", "onload", "ONCLICK", "evil.example", "@import", "comment", "DOCTYPE", "<?xml",
+		"foreignObject", "<div", "iframe", "svg+xml", "<set"} {
+		if strings.Contains(got, banned) {
+			t.Errorf("expected %s to be removed from %s", banned, got)
+		}
+	}
+
+	// Sanitizing is idempotent
+	again, err := Sanitize(out)
+	if err != nil || string(again) != got {
+		t.Errorf("expected sanitizing twice to change nothing, got %s (err %v)", again, err)
+	}
+}
+
+func TestSanitizeRejectsInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"not svg":       "hello",
+		"html root":     `<html><svg></svg></html>`,
+		"malformed":     `<svg xmlns="http://www.w3.org/2000/svg"><rect></svg>`,
+		"two roots":     `<svg xmlns="http://www.w3.org/2000/svg"></svg><svg></svg>`,
+		"custom entity": `<!DOCTYPE svg [<!ENTITY x "y">]><svg xmlns="http://www.w3.org/2000/svg">&x;</svg>`,
+		"foreign root":  `<x:svg xmlns:x="urn:other"></x:svg>`,
+	} {
+		if _, err := Sanitize([]byte(data)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestSanitizeBuiltInTemplates(t *testing.T) {
+	// The shipped templates render unchanged apart from their markup, as
+	// generated certificates must keep their content
+	data, err := os.ReadFile("../certificate/testdata/greek.golden.svg")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	out, err := Sanitize(data)
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	for _, want := range []string{"Σύστημα", "<linearGradient", "<style", "</svg>"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s to be kept", want)
+		}
+	}
+	if strings.Count(string(out), "<text") != strings.Count(string(data), "<text") {
+		t.Error("expected every text element to be kept")
+	}
+}
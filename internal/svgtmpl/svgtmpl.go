@@ -0,0 +1,129 @@
+// Package svgtmpl renders the badge and certificate SVG templates with
+// text/template and explicit escaping. html/template escapes for HTML, so in
+// SVG it mangles values in style and href attributes and cannot tell markup
+// that is already sanitized, such as logos, from text. Here every string of
+// the template data is wrapped by Escape into Text, which prints XML-escaped
+// in element content and quoted attributes alike, while Markup is printed as
+// is.
+package svgtmpl
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Text is a string printed XML-escaped by templates
+type Text string
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;")
+
+// String returns the escaped text; templates print values through it
+func (t Text) String() string {
+	return escaper.Replace(strings.Map(xmlChar, string(t)))
+}
+
+// xmlChar drops the characters XML documents cannot contain, such as control
+// characters other than tab and newlines. Invalid UTF-8 reaches it as
+// utf8.RuneError and is written as U+FFFD.
+func xmlChar(r rune) rune {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r',
+		r >= 0x20 && r <= 0xD7FF,
+		r >= 0xE000 && r <= 0xFFFD,
+		r >= 0x10000 && r <= 0x10FFFF:
+		return r
+	}
+	return -1
+}
+
+// Markup is trusted SVG markup, such as a sanitized logo, printed as is
+type Markup string
+
+var (
+	textType   = reflect.TypeOf(Text(""))
+	markupType = reflect.TypeOf(Markup(""))
+)
+
+// New creates an empty template with the given functions
+func New(name string, funcs template.FuncMap) *template.Template {
+	return template.New(name).Funcs(funcs)
+}
+
+// comments matches the XML comments of template sources
+var comments = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// StripComments removes XML comments from a template source, as html/template
+// did, so notes in templates do not reach the generated images
+func StripComments(src string) string {
+	return comments.ReplaceAllString(src, "")
+}
+
+// Escape returns template data in which every string, including those of
+// slices, maps, structs and the types based on string, is Text. Structs
+// become maps of their exported fields, so templates address them the same
+// way. Markup, numbers and booleans are kept.
+func Escape(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		out[k] = escape(reflect.ValueOf(v))
+	}
+	return out
+}
+
+// escape returns the escaped form of v
+func escape(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case textType, markupType:
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return Text(v.String())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return escape(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				fields[f.Name] = escape(v.Field(i))
+			}
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.String && v.Type().Elem() != markupType {
+			texts := make([]Text, v.Len())
+			for i := range texts {
+				texts[i] = Text(v.Index(i).String())
+			}
+			return texts
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = escape(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		items := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			items[iter.Key().String()] = escape(iter.Value())
+		}
+		return items
+	}
+	return v.Interface()
+}
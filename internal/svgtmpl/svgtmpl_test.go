@@ -0,0 +1,82 @@
+package svgtmpl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	Name  string
+	Logo  Markup
+	Width int
+	tag   string // unexported fields are left out
+}
+
+func TestEscape(t *testing.T) {
+	hostile := `"><script>alert('x')</script>&amp;` + "\x00\x1b\uffff"
+	tmpl, err := New("test", nil).Parse(`<svg xmlns="http://www.w3.org/2000/svg">` +
+		`<text title="{{.Name}}">{{.Name}}</text>{{range .Words}}<tspan>{{.}}</tspan>{{end}}` +
+		`{{.Entry.Logo}}<g width="{{.Entry.Width}}">{{.Entry.Name}}</g>{{.Labels.status}}</svg>`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Escape(map[string]interface{}{
+		"Name":   hostile,
+		"Words":  []string{hostile, "b"},
+		"Entry":  &entry{Name: hostile, Logo: `<path d="M0 0"/>`, Width: 12, tag: "x"},
+		"Labels": map[string]string{"status": hostile},
+	}))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	got := buf.String()
+	if strings.Contains(got, "<script") || strings.ContainsAny(got, "\x00\x1b\uffff") {
+		t.Errorf("expected the name to be escaped, got %s", got)
+	}
+	for _, want := range []string{`<path d="M0 0"/>`, `width="12"`, "&amp;amp;", "&#34;&gt;"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in %s", want, got)
+		}
+	}
+
+	// The output is well-formed and every value reads back as given
+	dec := xml.NewDecoder(strings.NewReader(got))
+	texts := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected well-formed XML, got %v in %s", err, got)
+		}
+		want := strings.Trim(hostile, "\x00\x1b\uffff")
+		if c, ok := tok.(xml.CharData); ok && string(c) == want {
+			texts++
+		}
+		if s, ok := tok.(xml.StartElement); ok && s.Name.Local == "text" && s.Attr[0].Value != want {
+			t.Errorf("expected the attribute to read back as %q, got %q", want, s.Attr[0].Value)
+		}
+	}
+	if texts != 4 {
+		t.Errorf("expected the name to read back 4 times, got %d", texts)
+	}
+}
+
+func TestTextInvalidUTF8(t *testing.T) {
+	if got, want := Text("a\xd8b").String(), "a\ufffdb"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	src := "<svg><!-- note {{.X}} -->\n<style><!-- fill -->.a{}</style><!--\nmulti\n--></svg>"
+	if got, want := StripComments(src), "<svg>\n<style>.a{}</style></svg>"; got != want {
+		t.Errorf("StripComments = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,422 @@
+// Package templateapi manages stored certificate SVG templates over a JSON API, so
+// design changes can be rolled out without redeploying the binary.
+package templateapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/httpjson"
+	"go.uber.org/zap"
+)
+
+// Template is the JSON representation of a stored template. Content is left out
+// of list responses.
+type Template struct {
+	TemplateID string    `json:"template_id"`
+	Name       string    `json:"name"`
+	BadgeType  string    `json:"badge_type"`
+	Content    string    `json:"content,omitempty"`
+	IsDefault  bool      `json:"is_default"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CreateRequest uploads a new template, optionally making it the default for
+// its badge type straight away
+type CreateRequest struct {
+	Name      string `json:"name"`
+	BadgeType string `json:"badge_type"`
+	Content   string `json:"content"`
+	Default   bool   `json:"default"`
+}
+
+// UpdateRequest changes the fields present in the request body
+type UpdateRequest struct {
+	Name      *string `json:"name,omitempty"`
+	BadgeType *string `json:"badge_type,omitempty"`
+	Content   *string `json:"content,omitempty"`
+}
+
+// ContentRequest carries template content to validate or preview. CommitID
+// selects the badge used for a preview; a sample badge is used without it.
+type ContentRequest struct {
+	Content  string `json:"content"`
+	CommitID string `json:"commit_id,omitempty"`
+}
+
+// Handler serves /api/templates and /api/templates/{id}
+type Handler struct {
+	db        *database.DB
+	logger    *zap.Logger
+	cache     *cache.Cache
+	generator *certificate.Generator
+}
+
+// NewHandler creates a new template API handler
+func NewHandler(db *database.DB, logger *zap.Logger, cache *cache.Cache) *Handler {
+	return &Handler{
+		db:        db,
+		logger:    logger,
+		cache:     cache,
+		generator: certificate.NewGenerator(),
+	}
+}
+
+// ServeHTTP dispatches on method and path. Templates are part of how badges are
+// rendered, so they are guarded by the badges permissions.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/templates"), "/"), "/")
+	id, action := parts[0], ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+	if len(parts) > 2 {
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	// JSON escaping can double the size of template content
+	r.Body = http.MaxBytesReader(w, r.Body, 2*certificate.MaxTemplateSize)
+
+	var next http.Handler
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", http.HandlerFunc(h.list))
+	case id == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", http.HandlerFunc(h.create))
+	case id == "validate" && action == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", http.HandlerFunc(h.validate))
+	case id == "preview" && action == "" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", http.HandlerFunc(h.previewContent))
+	case action == "" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withTemplate(id, h.get))
+	case action == "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withTemplate(id, h.update))
+	case action == "" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "delete", h.withTemplate(id, h.delete))
+	case action == "preview" && r.Method == http.MethodGet:
+		next = auth.RequirePermissionMiddleware("badges", "read", h.withTemplate(id, h.preview))
+	case action == "default" && r.Method == http.MethodPost:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withTemplate(id, h.setDefault))
+	case action == "default" && r.Method == http.MethodDelete:
+		next = auth.RequirePermissionMiddleware("badges", "write", h.withTemplate(id, h.unsetDefault))
+	case action != "" && action != "preview" && action != "default":
+		httpjson.Error(w, http.StatusNotFound, "Not found")
+		return
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// withTemplate loads the template before calling fn
+func (h *Handler) withTemplate(id string, fn func(http.ResponseWriter, *http.Request, *database.Template)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := h.db.WithContext(r.Context()).GetTemplate(id)
+		if err != nil {
+			h.logger.Error("templateapi: failed to get template", zap.String("template_id", id), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get template")
+			return
+		}
+		if t == nil {
+			httpjson.Error(w, http.StatusNotFound, "Template not found")
+			return
+		}
+		fn(w, r, t)
+	})
+}
+
+// list returns all templates without their content
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.db.WithContext(r.Context()).ListTemplates()
+	if err != nil {
+		h.logger.Error("templateapi: failed to list templates", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to list templates")
+		return
+	}
+
+	resp := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		item := toJSON(t)
+		item.Content = ""
+		resp = append(resp, item)
+	}
+	httpjson.Write(w, http.StatusOK, resp)
+}
+
+// get returns a single template including its content
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	httpjson.Write(w, http.StatusOK, toJSON(t))
+}
+
+// create validates and stores a new template
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	db := h.db.WithContext(r.Context())
+
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name == "" || req.Content == "" {
+		httpjson.Error(w, http.StatusBadRequest, "name and content are required")
+		return
+	}
+	if req.BadgeType == "" {
+		req.BadgeType = "badge"
+	}
+	if err := h.check(req.Content); err != nil {
+		httpjson.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if !h.nameAvailable(w, r, req.Name, "") {
+		return
+	}
+
+	now := time.Now()
+	t := &database.Template{
+		TemplateID: fmt.Sprintf("tpl_%x", now.UnixNano()),
+		Name:       req.Name,
+		BadgeType:  req.BadgeType,
+		Content:    req.Content,
+		CreatedBy:  auth.GetUserIDFromContext(r.Context()),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := db.CreateTemplate(t); err != nil {
+		h.logger.Error("templateapi: failed to create template", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to create template")
+		return
+	}
+
+	if req.Default {
+		if err := db.SetDefaultTemplate(t.TemplateID); err != nil {
+			h.logger.Error("templateapi: failed to set default template", zap.String("template_id", t.TemplateID), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Template created but could not be made the default")
+			return
+		}
+		t.IsDefault = true
+		h.invalidate(t.BadgeType)
+	}
+
+	h.logger.Info("Template created",
+		zap.String("template_id", t.TemplateID),
+		zap.String("badge_type", t.BadgeType),
+		zap.Bool("default", t.IsDefault),
+	)
+	httpjson.Write(w, http.StatusCreated, toJSON(t))
+}
+
+// update applies the fields present in the request body
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	oldType := t.BadgeType
+	if req.Name != nil && *req.Name != t.Name {
+		if *req.Name == "" {
+			httpjson.Error(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		if !h.nameAvailable(w, r, *req.Name, t.TemplateID) {
+			return
+		}
+		t.Name = *req.Name
+	}
+	if req.BadgeType != nil && *req.BadgeType != "" {
+		t.BadgeType = *req.BadgeType
+	}
+	if req.Content != nil {
+		if err := h.check(*req.Content); err != nil {
+			httpjson.Error(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		t.Content = *req.Content
+	}
+	t.UpdatedAt = time.Now()
+
+	if err := h.db.WithContext(r.Context()).UpdateTemplate(t); err != nil {
+		h.logger.Error("templateapi: failed to update template", zap.String("template_id", t.TemplateID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to update template")
+		return
+	}
+
+	// Moving a default template to another type un-defaults it (see UpdateTemplate)
+	if t.IsDefault {
+		h.invalidate(oldType)
+		t.IsDefault = t.BadgeType == oldType
+	}
+	httpjson.Write(w, http.StatusOK, toJSON(t))
+}
+
+// delete removes a template; deleting the default reverts its type to the template file
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	if err := h.db.WithContext(r.Context()).DeleteTemplate(t.TemplateID); err != nil {
+		h.logger.Error("templateapi: failed to delete template", zap.String("template_id", t.TemplateID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to delete template")
+		return
+	}
+
+	if t.IsDefault {
+		h.invalidate(t.BadgeType)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setDefault makes the template the default for its badge type. The template
+// is checked again, since the rules may have tightened since it was stored.
+func (h *Handler) setDefault(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	if err := h.check(t.Content); err != nil {
+		httpjson.Error(w, http.StatusUnprocessableEntity, "Template cannot be activated: "+err.Error())
+		return
+	}
+	if err := h.db.WithContext(r.Context()).SetDefaultTemplate(t.TemplateID); err != nil {
+		h.logger.Error("templateapi: failed to set default template", zap.String("template_id", t.TemplateID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to set default template")
+		return
+	}
+
+	h.logger.Info("Default template changed",
+		zap.String("template_id", t.TemplateID),
+		zap.String("badge_type", t.BadgeType),
+		zap.String("changed_by", auth.GetUserIDFromContext(r.Context())),
+	)
+	t.IsDefault = true
+	h.invalidate(t.BadgeType)
+	httpjson.Write(w, http.StatusOK, toJSON(t))
+}
+
+// unsetDefault reverts the template's badge type to the template file
+func (h *Handler) unsetDefault(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	if err := h.db.WithContext(r.Context()).UnsetDefaultTemplate(t.TemplateID); err != nil {
+		h.logger.Error("templateapi: failed to unset default template", zap.String("template_id", t.TemplateID), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to unset default template")
+		return
+	}
+
+	if t.IsDefault {
+		h.invalidate(t.BadgeType)
+	}
+	t.IsDefault = false
+	httpjson.Write(w, http.StatusOK, toJSON(t))
+}
+
+// validate reports whether template content can be used, without storing it
+func (h *Handler) validate(w http.ResponseWriter, r *http.Request) {
+	var req ContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.check(req.Content); err != nil {
+		httpjson.Write(w, http.StatusUnprocessableEntity, map[string]interface{}{"valid": false, "error": err.Error()})
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]interface{}{"valid": true})
+}
+
+// previewContent renders unsaved template content
+func (h *Handler) previewContent(w http.ResponseWriter, r *http.Request) {
+	var req ContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := h.check(req.Content); err != nil {
+		httpjson.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	h.render(w, r, req.Content, req.CommitID)
+}
+
+// preview renders a stored template, for ?commit_id= or a sample badge
+func (h *Handler) preview(w http.ResponseWriter, r *http.Request, t *database.Template) {
+	h.render(w, r, t.Content, r.URL.Query().Get("commit_id"))
+}
+
+// render writes content rendered for a badge as an SVG response
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, content, commitID string) {
+	badge := certificate.SampleBadge()
+	if commitID != "" {
+		b, err := h.db.WithContext(r.Context()).GetBadge(commitID)
+		if err != nil {
+			h.logger.Error("templateapi: failed to get badge", zap.String("commit_id", commitID), zap.Error(err))
+			httpjson.Error(w, http.StatusInternalServerError, "Failed to get badge")
+			return
+		}
+		if b == nil {
+			httpjson.Error(w, http.StatusNotFound, "Badge not found")
+			return
+		}
+		badge = b
+	}
+
+	svg, err := h.generator.GenerateSVGWithTemplate(badge, []byte(content))
+	if err != nil {
+		httpjson.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(svg)
+}
+
+// check runs the sandbox checks on template content before it is stored or activated
+func (h *Handler) check(content string) error {
+	return h.generator.ValidateTemplate([]byte(content))
+}
+
+// nameAvailable writes a conflict response if another template already uses name
+func (h *Handler) nameAvailable(w http.ResponseWriter, r *http.Request, name, templateID string) bool {
+	existing, err := h.db.WithContext(r.Context()).GetTemplateByName(name)
+	if err != nil {
+		h.logger.Error("templateapi: failed to check template name", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to check template name")
+		return false
+	}
+	if existing != nil && existing.TemplateID != templateID {
+		httpjson.Error(w, http.StatusConflict, "A template with this name already exists")
+		return false
+	}
+	return true
+}
+
+// invalidate drops cached and stored renders that may have used the badge type's
+// default template
+func (h *Handler) invalidate(badgeType string) {
+	if err := h.db.ClearBadgeImages(badgeType); err != nil {
+		h.logger.Error("templateapi: failed to clear stored images", zap.String("badge_type", badgeType), zap.Error(err))
+	}
+	h.cache.DeletePrefix("badge:")
+	h.cache.DeletePrefix("certificate:")
+}
+
+// toJSON converts a database template to its API representation
+func toJSON(t *database.Template) Template {
+	return Template{
+		TemplateID: t.TemplateID,
+		Name:       t.Name,
+		BadgeType:  t.BadgeType,
+		Content:    t.Content,
+		IsDefault:  t.IsDefault,
+		CreatedBy:  t.CreatedBy,
+		CreatedAt:  t.CreatedAt,
+		UpdatedAt:  t.UpdatedAt,
+	}
+}
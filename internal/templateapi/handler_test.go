@@ -0,0 +1,99 @@
+package templateapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/finki/badges/internal/cache"
+	"github.com/finki/badges/internal/certificate"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/testutil"
+	"go.uber.org/zap"
+)
+
+const testTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}"><text>{{.SoftwareName}} custom</text></svg>`
+
+func TestTemplateLifecycle(t *testing.T) {
+	db := testutil.OpenDB(t)
+	h := NewHandler(db, zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write", "delete")
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/templates", CreateRequest{Name: "custom", Content: testTemplate})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Template
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.BadgeType != "badge" || created.IsDefault || created.CreatedBy != "user-id" {
+		t.Errorf("create: unexpected template %+v", created)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPost, "/api/templates", CreateRequest{Name: "custom", Content: testTemplate})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate name: expected 409, got %d", rec.Code)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodGet, "/api/templates/"+created.TemplateID+"/preview", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Sample Software custom") {
+		t.Errorf("preview: expected rendered sample, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The certificate generator only picks the template up once it is the default
+	gen := certificate.NewGenerator()
+	gen.SetTemplatePath("../../templates/svg/big-template.svg")
+	gen.SetTemplateSource(db)
+	badge := &database.Badge{CommitID: "abc1234", Type: "badge", Status: "valid", SoftwareName: "Tool", SoftwareVersion: "1.0"}
+	if svg, _ := gen.GenerateSVG(badge); strings.Contains(string(svg), "Tool custom") {
+		t.Error("expected the template file before a default is set")
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPost, "/api/templates/"+created.TemplateID+"/default", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set default: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	svg, err := gen.GenerateSVG(badge)
+	if err != nil || !strings.Contains(string(svg), "Tool custom") {
+		t.Errorf("expected the default template to be used, got %q (err %v)", svg, err)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodPatch, "/api/templates/"+created.TemplateID, map[string]string{"content": "{{.Broken"})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid update: expected 422, got %d", rec.Code)
+	}
+
+	rec = testutil.Serve(h, ctx, http.MethodDelete, "/api/templates/"+created.TemplateID, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", rec.Code)
+	}
+	if svg, _ := gen.GenerateSVG(badge); strings.Contains(string(svg), "Tool custom") {
+		t.Error("expected the template file after the default was deleted")
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	h := NewHandler(testutil.OpenDB(t), zap.NewNop(), cache.New())
+	ctx := testutil.APIKeyContext("", "badges", "read", "write")
+
+	for name, content := range map[string]string{
+		"parse error":   "<svg>{{.Missing</svg>",
+		"unknown field": "<svg>{{.NoSuchField}}</svg>",
+		"not svg":       "<p>hello</p>",
+		"script":        `<svg><script>alert(1)</script></svg>`,
+	} {
+		rec := testutil.Serve(h, ctx, http.MethodPost, "/api/templates/validate", ContentRequest{Content: content})
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d", name, rec.Code)
+		}
+	}
+
+	rec := testutil.Serve(h, ctx, http.MethodPost, "/api/templates/validate", ContentRequest{Content: testTemplate})
+	if rec.Code != http.StatusOK {
+		t.Errorf("valid template: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := testutil.Serve(h, testutil.APIKeyContext("", "badges", "read"), http.MethodPost, "/api/templates", CreateRequest{Name: "x", Content: testTemplate}); rec.Code != http.StatusForbidden {
+		t.Errorf("create without write: expected 403, got %d", rec.Code)
+	}
+}
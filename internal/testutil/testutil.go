@@ -0,0 +1,76 @@
+// Package testutil provides the database, authentication and request
+// fixtures shared by the API handler tests.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/auth"
+	"github.com/finki/badges/internal/database"
+	"go.uber.org/zap"
+)
+
+// OpenDB creates a database in a temporary directory, closed when the test
+// ends
+func OpenDB(t testing.TB) *database.DB {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create test DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// APIKeyContext returns a context authenticated by an active API key of
+// user-id granting the actions on the resource. A non-empty orgID scopes the
+// key to that organization.
+func APIKeyContext(orgID, resource string, actions ...string) context.Context {
+	perms := map[string]bool{}
+	for _, a := range actions {
+		perms[a] = true
+	}
+	return APIKeyContextWith(orgID, database.Permissions{resource: perms})
+}
+
+// APIKeyContextWith is APIKeyContext with the key's full permissions
+func APIKeyContextWith(orgID string, perms database.Permissions) context.Context {
+	return auth.AddAPIKeyToContext(context.Background(), &auth.APIKeyInfo{
+		ID:          "key-id",
+		UserID:      "user-id",
+		OrgID:       orgID,
+		Status:      "active",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		Permissions: perms,
+	})
+}
+
+// Serve sends a request with body encoded as JSON, if not nil, to h and
+// returns the recorded response
+func Serve(h http.Handler, ctx context.Context, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// ImageRequest returns a request for the image of badge abc123 with the
+// given Referer, if not empty
+func ImageRequest(referer string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/badge/abc123", nil)
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	return req
+}
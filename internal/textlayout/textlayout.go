@@ -0,0 +1,111 @@
+// Package textlayout estimates how much room text takes in the generated SVGs
+// and which direction it runs in. The renderers (browsers, rsvg-convert) do the
+// actual shaping; the generators only need widths good enough to size badges
+// and fit names, for any script, and the base direction of RTL names.
+package textlayout
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/width"
+)
+
+// boldFactor is how much wider bold (font-weight 600+) text is than regular
+const boldFactor = 1.1
+
+// asciiAdvances are the advance widths of printable ASCII in DejaVu Sans, in
+// ems, starting at the space character. Verdana, the usual fallback, is close.
+var asciiAdvances = [...]float64{
+	0.318, 0.401, 0.460, 0.838, 0.636, 0.950, 0.780, 0.275, // space ! " # $ % & '
+	0.390, 0.390, 0.500, 0.838, 0.318, 0.361, 0.318, 0.337, // ( ) * + , - . /
+	0.636, 0.636, 0.636, 0.636, 0.636, 0.636, 0.636, 0.636, // 0-7
+	0.636, 0.636, 0.337, 0.337, 0.838, 0.838, 0.838, 0.531, // 8 9 : ; < = > ?
+	1.000, 0.684, 0.686, 0.698, 0.770, 0.632, 0.575, 0.775, // @ A-G
+	0.752, 0.295, 0.295, 0.656, 0.557, 0.863, 0.748, 0.787, // H-O
+	0.603, 0.787, 0.695, 0.635, 0.611, 0.732, 0.684, 0.989, // P-W
+	0.685, 0.611, 0.685, 0.390, 0.337, 0.390, 0.838, 0.500, // X Y Z [ \ ] ^ _
+	0.500, 0.613, 0.635, 0.550, 0.635, 0.615, 0.352, 0.635, // ` a-g
+	0.634, 0.278, 0.278, 0.579, 0.278, 0.974, 0.634, 0.612, // h-o
+	0.635, 0.635, 0.411, 0.521, 0.392, 0.634, 0.592, 0.818, // p-w
+	0.592, 0.592, 0.525, 0.636, 0.337, 0.636, 0.838, // x y z { | } ~
+}
+
+// Width returns the approximate width in pixels of s set at fontSize
+func Width(s string, fontSize float64, bold bool) float64 {
+	ems := 0.0
+	for _, r := range s {
+		ems += advance(r)
+	}
+	if bold {
+		ems *= boldFactor
+	}
+	return ems * fontSize
+}
+
+// latinAdvance is the average advance of a Latin character in ems
+const latinAdvance = 0.62
+
+// Columns returns the length of s in average Latin characters, for layouts
+// that were tuned by character count: printable ASCII counts one, combining
+// marks and joiners nothing, and other runes their width relative to Latin
+// text (CJK about two)
+func Columns(s string) float64 {
+	n := 0.0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			n++
+		} else {
+			n += advance(r) / latinAdvance
+		}
+	}
+	return n
+}
+
+// advance returns the approximate advance width of a rune in ems
+func advance(r rune) float64 {
+	switch {
+	case r >= ' ' && r <= '~':
+		return asciiAdvances[r-' ']
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc):
+		// Combining marks, joiners and bidi controls take no room of their own
+		return 0
+	}
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		// CJK ideographs, kana, hangul and fullwidth forms are square
+		return 1
+	}
+
+	switch {
+	case unicode.Is(unicode.Arabic, r):
+		// Joined Arabic letters are narrower than their isolated forms
+		return 0.5
+	case unicode.IsSpace(r):
+		return 0.318
+	case unicode.IsUpper(r):
+		return 0.72
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		// Greek, Cyrillic, Hebrew and accented Latin are about as wide as
+		// their Latin counterparts
+		return latinAdvance
+	}
+	return 0.6
+}
+
+// IsRTL reports whether the base direction of s is right-to-left, i.e. its
+// first strong character is Hebrew, Arabic or another RTL script (rules P2 and
+// P3 of the Unicode bidirectional algorithm)
+func IsRTL(s string) bool {
+	for _, r := range s {
+		p, _ := bidi.LookupRune(r)
+		switch p.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package textlayout
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWidth(t *testing.T) {
+	// The same word in different scripts must be sized by glyphs, not bytes
+	latin := Width("Programma", 12, false)
+	for _, s := range []string{"Программа", "Πρόγραμμα"} {
+		if w := Width(s, 12, false); math.Abs(w-latin) > latin*0.2 {
+			t.Errorf("Width(%q) = %.1f, expected about the Latin width %.1f", s, w, latin)
+		}
+	}
+	if Width("软件", 12, false) != 24 {
+		t.Errorf("expected CJK characters to be one em wide, got %.1f", Width("软件", 12, false))
+	}
+	if Width("é", 12, false) != Width("e", 12, false) {
+		t.Error("expected combining marks to take no room")
+	}
+	if Width("Name", 12, true) <= Width("Name", 12, false) {
+		t.Error("expected bold text to be wider")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	for s, want := range map[string]float64{"Shibboleth": 10, "": 0, "软件": 2 / latinAdvance, "λογισμικό": 9} {
+		if got := Columns(s); math.Abs(got-want) > 0.01 {
+			t.Errorf("Columns(%q) = %.2f, want %.2f", s, got, want)
+		}
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	for s, want := range map[string]bool{
+		"Shibboleth":      false,
+		"برنامج الشهادات": true,
+		"תוכנה":           true,
+		"2.0 برنامج":      true, // digits are weak, the first strong character decides
+		"eduGAIN برنامج":  false,
+		"":                false,
+	} {
+		if got := IsRTL(s); got != want {
+			t.Errorf("IsRTL(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package theme holds the instance-wide defaults used when rendering badges and
+// certificates: colors, fonts, logo, slogan and the issuer for new badges. The
+// built-in theme is the GÉANT one; other deployments can override any part of it
+// with a JSON theme file instead of forking the generators.
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/finki/badges/internal/svgtmpl"
+)
+
+// Badge holds the defaults for the small badge outlook. Its colors are the
+// light palette.
+type Badge struct {
+	ColorLeft   string `json:"color_left"`
+	ColorRight  string `json:"color_right"`
+	TextColor   string `json:"text_color"`
+	BorderColor string `json:"border_color"`
+	FontSize    int    `json:"font_size"`
+	Style       string `json:"style"`
+	FontFamily  string `json:"font_family"`
+	// Dark is the palette for theme=dark, and for theme=auto when the viewer
+	// prefers a dark color scheme
+	Dark Palette `json:"dark"`
+}
+
+// Palette holds the colors of one badge color scheme
+type Palette struct {
+	ColorLeft   string `json:"color_left"`
+	ColorRight  string `json:"color_right"`
+	TextColor   string `json:"text_color"`
+	BorderColor string `json:"border_color"`
+}
+
+// Certificate holds the defaults for the certificate outlook
+type Certificate struct {
+	LogoColor           string `json:"logo_color"`
+	BackgroundColor     string `json:"background_color"`
+	HorizontalBarsColor string `json:"horizontal_bars_color"`
+	TopLabelColor       string `json:"top_label_color"`
+	GradientStartColor  string `json:"gradient_start_color"`
+	GradientEndColor    string `json:"gradient_end_color"`
+	BorderColor         string `json:"border_color"`
+	CertNameColor       string `json:"cert_name_color"`
+	FontFamily          string `json:"font_family"`
+	// NameMaxLines is how many lines the certificate name may wrap into
+	NameMaxLines int `json:"name_max_lines"`
+}
+
+// Logo is an SVG logo that replaces the built-in GÉANT logo
+type Logo struct {
+	// ViewBox is the viewBox of the logo's root svg element
+	ViewBox string
+	// Content is the markup inside the root svg element
+	Content svgtmpl.Markup
+}
+
+// Theme is the complete set of instance-level rendering defaults
+type Theme struct {
+	Badge       Badge       `json:"badge"`
+	Certificate Certificate `json:"certificate"`
+	// LogoPath points to an SVG file used instead of the GÉANT logo
+	LogoPath string `json:"logo_path"`
+	// Slogan is the footer line of the legacy certificate template
+	Slogan string `json:"slogan"`
+	// Issuer is the issuer given to badges created without one
+	Issuer string `json:"issuer"`
+
+	// Logo is loaded from LogoPath; nil means the built-in logo
+	Logo *Logo `json:"-"`
+}
+
+// Default returns the built-in GÉANT theme
+func Default() *Theme {
+	return &Theme{
+		Badge: Badge{
+			ColorLeft:   "#333",
+			ColorRight:  "#4CAF50",
+			TextColor:   "#FFFFFF",
+			BorderColor: "#E5E7EB",
+			FontSize:    12,
+			Style:       "3d",
+			FontFamily:  "DejaVu Sans,Verdana,Geneva,sans-serif",
+			// Muted colors that keep contrast on dark pages such as GitHub's dark mode
+			Dark: Palette{
+				ColorLeft:   "#21262D",
+				ColorRight:  "#238636",
+				TextColor:   "#F0F6FC",
+				BorderColor: "#30363D",
+			},
+		},
+		Certificate: Certificate{
+			LogoColor:           "#ffffff", // White
+			BackgroundColor:     "#0e3f5f", // Dark blue
+			HorizontalBarsColor: "#e78a2d", // Orange
+			TopLabelColor:       "#e78a2d", // Orange
+			GradientStartColor:  "#ff1463", // Pink
+			GradientEndColor:    "#013a40", // Dark teal
+			BorderColor:         "#e78a2d", // Orange
+			CertNameColor:       "#ffffff", // White
+			FontFamily:          "Verdana,sans-serif",
+			NameMaxLines:        3,
+		},
+		Slogan: "Networks • Services • People",
+		Issuer: "Unknown",
+	}
+}
+
+// Load reads a JSON theme file. Fields missing from the file keep their
+// values from the default theme.
+func Load(path string) (*Theme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme file: %w", err)
+	}
+
+	t := Default()
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse theme file %s: %w", path, err)
+	}
+
+	if t.LogoPath != "" {
+		t.Logo, err = loadLogo(t.LogoPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+var (
+	rootSVGPattern = regexp.MustCompile(`(?is)<svg\b[^>]*>`)
+	viewBoxPattern = regexp.MustCompile(`(?i)\bviewBox\s*=\s*["']([^"']+)["']`)
+	sizePattern    = regexp.MustCompile(`(?i)\b(width|height)\s*=\s*["']([\d.]+)(px)?["']`)
+)
+
+// loadLogo reads an SVG file and extracts what is needed to nest it inside the
+// badge and certificate templates
+func loadLogo(path string) (*Logo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo file: %w", err)
+	}
+
+	svg := string(data)
+	loc := rootSVGPattern.FindStringIndex(svg)
+	end := strings.LastIndex(strings.ToLower(svg), "</svg>")
+	if loc == nil || end < loc[1] {
+		return nil, fmt.Errorf("logo file %s is not an SVG document", path)
+	}
+	root := svg[loc[0]:loc[1]]
+
+	logo := &Logo{Content: svgtmpl.Markup(svg[loc[1]:end])}
+	if m := viewBoxPattern.FindStringSubmatch(root); m != nil {
+		logo.ViewBox = m[1]
+	} else {
+		// Without a viewBox the logo cannot be scaled, so derive one from its size
+		size := map[string]string{}
+		for _, m := range sizePattern.FindAllStringSubmatch(root, -1) {
+			size[strings.ToLower(m[1])] = m[2]
+		}
+		if size["width"] == "" || size["height"] == "" {
+			return nil, fmt.Errorf("logo file %s needs a viewBox or width and height", path)
+		}
+		logo.ViewBox = "0 0 " + size["width"] + " " + size["height"]
+	}
+	return logo, nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = Default()
+)
+
+// Set makes t the theme used by generators created afterwards
+func Set(t *Theme) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = t
+}
+
+// Get returns the active theme
+func Get() *Theme {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
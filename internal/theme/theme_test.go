@@ -0,0 +1,61 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadKeepsDefaultsForMissingFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "theme.json")
+	if err := os.WriteFile(path, []byte(`{"badge": {"color_right": "#123456"}, "slogan": "Open Science"}`), 0644); err != nil {
+		t.Fatalf("Failed to write theme file: %v", err)
+	}
+
+	th, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load theme: %v", err)
+	}
+	if th.Badge.ColorRight != "#123456" || th.Slogan != "Open Science" {
+		t.Errorf("Expected overrides to apply, got %+v", th)
+	}
+	def := Default()
+	if th.Badge.ColorLeft != def.Badge.ColorLeft || th.Certificate.BackgroundColor != def.Certificate.BackgroundColor {
+		t.Errorf("Expected unset fields to keep defaults, got %+v", th)
+	}
+	if th.Logo != nil {
+		t.Error("Expected no logo without logo_path")
+	}
+}
+
+func TestLoadLogo(t *testing.T) {
+	dir := t.TempDir()
+	logoPath := filepath.Join(dir, "logo.svg")
+	logo := `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="40px" height="10"><rect width="40" height="10"/></svg>`
+	if err := os.WriteFile(logoPath, []byte(logo), 0644); err != nil {
+		t.Fatalf("Failed to write logo: %v", err)
+	}
+	themePath := filepath.Join(dir, "theme.json")
+	if err := os.WriteFile(themePath, []byte(`{"logo_path": "`+logoPath+`"}`), 0644); err != nil {
+		t.Fatalf("Failed to write theme file: %v", err)
+	}
+
+	th, err := Load(themePath)
+	if err != nil {
+		t.Fatalf("Failed to load theme: %v", err)
+	}
+	if th.Logo == nil || th.Logo.ViewBox != "0 0 40 10" {
+		t.Fatalf("Expected viewBox derived from logo size, got %+v", th.Logo)
+	}
+	if !strings.Contains(string(th.Logo.Content), "<rect") || strings.Contains(string(th.Logo.Content), "<svg") {
+		t.Errorf("Expected only the logo's inner markup, got %q", th.Logo.Content)
+	}
+
+	if err := os.WriteFile(logoPath, []byte("not an svg"), 0644); err != nil {
+		t.Fatalf("Failed to write logo: %v", err)
+	}
+	if _, err := Load(themePath); err == nil {
+		t.Error("Expected an error for a logo that is not SVG")
+	}
+}
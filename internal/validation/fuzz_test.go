@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// FuzzCustomConfig checks arbitrary custom_config blobs: a config that passes
+// validation must parse for the generators and survive a round trip
+func FuzzCustomConfig(f *testing.F) {
+	f.Add(`{"color_left":"#003f5f","style":"3d","theme":"dark","font_size":12}`)
+	f.Add(`{"logo":"data:image/svg+xml;base64,PHN2Zz4=","public_overrides":"colors,logo"}`)
+	f.Add(`{"font_size":1e400}`)
+	f.Add(`{} {}`)
+	f.Add(`null`)
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		b := validBadge()
+		b.CustomConfig = sql.NullString{String: raw, Valid: true}
+		if errs := Badge(b); errs["custom_config"] != "" {
+			return
+		}
+
+		config, err := b.GetCustomConfig()
+		if err != nil {
+			t.Fatalf("validated custom config %q does not parse: %v", raw, err)
+		}
+		if err := b.SetCustomConfig(config); err != nil {
+			t.Fatalf("SetCustomConfig: %v", err)
+		}
+		again, err := b.GetCustomConfig()
+		if err != nil || !reflect.DeepEqual(again, config) {
+			t.Fatalf("expected %+v after a round trip, got %+v (err %v)", config, again, err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+// Package validation checks badges before they are stored. The badge API, the
+// creation and edit forms and the seed import share these checks, so a badge
+// is rejected with the same field-level messages wherever it comes from.
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/finki/badges/internal/badge"
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/overrides"
+)
+
+// Errors are validation errors by field. Fields are named as in the badge
+// API, with custom config settings as custom_config.<setting>.
+type Errors map[string]string
+
+// Error lists the errors sorted by field, e.g. "issue_date: Issue date must
+// be a date such as 2026-01-31"
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, field+": "+e[field])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Badge checks the fields of b, returning nil if it is valid
+func Badge(b *database.Badge) Errors {
+	errs := Errors{}
+
+	if !commitid.Valid(b.CommitID) {
+		errs["commit_id"] = "Invalid commit ID"
+	}
+	for field, v := range map[string]string{
+		"type":             b.Type,
+		"issuer":           b.Issuer,
+		"software_name":    b.SoftwareName,
+		"software_version": b.SoftwareVersion,
+	} {
+		if strings.TrimSpace(v) == "" {
+			errs[field] = label(field) + " is required"
+		}
+	}
+	if !b.Status.Valid() {
+		errs["status"] = "Status must be one of " + database.StatusNames()
+	}
+
+	if b.IssueDate.IsZero() {
+		errs["issue_date"] = "Issue date is required"
+	} else if b.ExpiryDate.Valid && b.ExpiryDate.Time.Before(b.IssueDate) {
+		errs["expiry_date"] = "Expiry date must not be before the issue date"
+	}
+
+	for field, v := range map[string]string{
+		"software_url":    b.SoftwareURL.String,
+		"issuer_url":      b.IssuerURL.String,
+		"software_sc_url": b.SoftwareSCURL.String,
+	} {
+		if v != "" && !isWebURL(v) {
+			errs[field] = label(field) + " must be an http or https URL"
+		}
+	}
+
+	if b.CustomConfig.Valid {
+		checkCustomConfig(b.CustomConfig.String, errs)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Dates checks date fields given as text, by field name, before they are
+// parsed into a badge; empty values are left to Badge. It returns nil if every
+// date is YYYY-MM-DD.
+func Dates(values map[string]string) Errors {
+	errs := Errors{}
+	for field, v := range values {
+		if v == "" {
+			continue
+		}
+		if _, err := database.ParseDate(v); err != nil {
+			errs[field] = label(field) + " must be a date such as 2026-01-31"
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Merge adds the errors of other for fields e has no error for yet and
+// returns the result, nil if neither has errors
+func (e Errors) Merge(other Errors) Errors {
+	if len(e) == 0 && len(other) == 0 {
+		return nil
+	}
+	merged := Errors{}
+	for field, msg := range other {
+		merged[field] = msg
+	}
+	for field, msg := range e {
+		merged[field] = msg
+	}
+	return merged
+}
+
+// checkCustomConfig checks that a custom config is a JSON object of known
+// settings with supported values
+func checkCustomConfig(raw string, errs Errors) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	var config database.CustomConfig
+	if err := dec.Decode(&config); err != nil {
+		errs["custom_config"] = "Custom config must be a JSON object: " + err.Error()
+		return
+	}
+	// More misses stray closing brackets, so look for any token after it
+	if _, err := dec.Token(); err != io.EOF {
+		errs["custom_config"] = "Custom config must be a single JSON object"
+		return
+	}
+
+	if config.Style != "" && config.Style != "flat" && config.Style != "3d" {
+		errs["custom_config.style"] = "Style must be flat or 3d"
+	}
+	if config.Theme != "" && !badge.IsTheme(config.Theme) {
+		errs["custom_config.theme"] = "Theme must be light, dark or auto"
+	}
+	if config.Show != "" && !badge.IsShowMode(config.Show) {
+		errs["custom_config.show"] = "Show must be name, version, expiry or status"
+	}
+	if config.StatusPreview != "" && !database.IsStatusPreview(config.StatusPreview) {
+		errs["custom_config.status_preview"] = "Status preview must be valid, expired or revoked"
+	}
+	if config.FontSize != 0 && (config.FontSize < 8 || config.FontSize > 16) {
+		errs["custom_config.font_size"] = "Font size must be between 8 and 16"
+	}
+	if _, err := overrides.Parse(config.PublicOverrides); err != nil {
+		errs["custom_config.public_overrides"] = "Public overrides must be none or some of " + strings.Join(overrides.Names(), ", ")
+	}
+}
+
+// isWebURL reports whether raw is an absolute http or https URL
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// label returns the name of a field for messages, e.g. "Software URL"
+func label(field string) string {
+	words := strings.Split(field, "_")
+	for i, w := range words {
+		switch w {
+		case "url", "sc":
+			words[i] = strings.ToUpper(w)
+		}
+	}
+	words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	return strings.Join(words, " ")
+}
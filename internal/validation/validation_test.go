@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+)
+
+func validBadge() *database.Badge {
+	return &database.Badge{
+		CommitID:        "abc123",
+		Type:            "badge",
+		Status:          "valid",
+		Issuer:          "GÉANT",
+		IssueDate:       time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC),
+		SoftwareName:    "Tool",
+		SoftwareVersion: "1.0",
+		ExpiryDate:      sql.NullTime{Time: time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), Valid: true},
+		SoftwareURL:     sql.NullString{String: "https://example.org/tool", Valid: true},
+		CustomConfig:    sql.NullString{String: `{"color_left":"#003f5f","style":"3d","theme":"dark","font_size":12}`, Valid: true},
+	}
+}
+
+func TestBadgeValid(t *testing.T) {
+	if errs := Badge(validBadge()); errs != nil {
+		t.Errorf("expected a valid badge, got %v", errs)
+	}
+}
+
+func TestBadgeFieldErrors(t *testing.T) {
+	for field, mutate := range map[string]func(b *database.Badge){
+		"commit_id":                    func(b *database.Badge) { b.CommitID = "bad id!" },
+		"software_name":                func(b *database.Badge) { b.SoftwareName = " " },
+		"status":                       func(b *database.Badge) { b.Status = "active" },
+		"issue_date":                   func(b *database.Badge) { b.IssueDate = time.Time{} },
+		"expiry_date":                  func(b *database.Badge) { b.ExpiryDate.Time = time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC) },
+		"software_url":                 func(b *database.Badge) { b.SoftwareURL.String = "javascript:alert(1)" },
+		"issuer_url":                   func(b *database.Badge) { b.IssuerURL = sql.NullString{String: "example.org", Valid: true} },
+		"custom_config":                func(b *database.Badge) { b.CustomConfig.String = "{not json" },
+		"custom_config.style":          func(b *database.Badge) { b.CustomConfig.String = `{"style":"plastic"}` },
+		"custom_config.theme":          func(b *database.Badge) { b.CustomConfig.String = `{"theme":"neon"}` },
+		"custom_config.show":           func(b *database.Badge) { b.CustomConfig.String = `{"show":"everything"}` },
+		"custom_config.status_preview": func(b *database.Badge) { b.CustomConfig.String = `{"status_preview":"draft"}` },
+		"custom_config.font_size":      func(b *database.Badge) { b.CustomConfig.String = `{"font_size":40}` },
+	} {
+		b := validBadge()
+		mutate(b)
+		errs := Badge(b)
+		if len(errs) != 1 || errs[field] == "" {
+			t.Errorf("%s: expected a single error for the field, got %v", field, errs)
+		}
+	}
+
+	b := validBadge()
+	b.CustomConfig.String = `{"colour_left":"#fff"}`
+	if errs := Badge(b); !strings.Contains(errs["custom_config"], "colour_left") {
+		t.Errorf("expected unknown custom config settings to be reported, got %v", errs)
+	}
+}
+
+func TestDates(t *testing.T) {
+	errs := Dates(map[string]string{
+		"issue_date":  "2026-01-31",
+		"expiry_date": "31.01.2027",
+		"last_review": "",
+	})
+	if len(errs) != 1 || errs["expiry_date"] != "Expiry date must be a date such as 2026-01-31" {
+		t.Errorf("expected an error for expiry_date only, got %v", errs)
+	}
+	if errs := Dates(map[string]string{"issue_date": "2026-01-31"}); errs != nil {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestErrorsMerge(t *testing.T) {
+	var none Errors
+	if merged := none.Merge(nil); merged != nil {
+		t.Errorf("expected nil, got %v", merged)
+	}
+	merged := Errors{"issue_date": "first"}.Merge(Errors{"issue_date": "second", "status": "bad"})
+	if merged["issue_date"] != "first" || merged["status"] != "bad" {
+		t.Errorf("unexpected merge result %v", merged)
+	}
+}
+
+func TestErrorsError(t *testing.T) {
+	errs := Errors{"status": "Status is bad", "issue_date": "Issue date is bad"}
+	if got, want := errs.Error(), "issue_date: Issue date is bad; status: Status is bad"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,239 @@
+// Package verify serves the public verification API: a signed statement of a
+// certificate's current status that third parties can check programmatically.
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finki/badges/internal/commitid"
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/gitref"
+	"github.com/finki/badges/internal/httpjson"
+	"github.com/finki/badges/internal/issuer"
+	"github.com/finki/badges/internal/signing"
+	"go.uber.org/zap"
+)
+
+// Response is the signed body of GET /api/verify/{commit_id}
+type Response struct {
+	CommitID        string    `json:"commit_id"`
+	Status          string    `json:"status"` // "valid", "expired" or "revoked"
+	SoftwareName    string    `json:"software_name"`
+	SoftwareVersion string    `json:"software_version"`
+	CoveredVersion  string    `json:"covered_version,omitempty"`
+	CertificateName string    `json:"certificate_name,omitempty"`
+	Issuer          string    `json:"issuer"`
+	IssuerURL       string    `json:"issuer_url,omitempty"`
+	IssueDate       string    `json:"issue_date"`
+	ExpiryDate      string    `json:"expiry_date,omitempty"`
+	GitRepository   string    `json:"git_repository,omitempty"`
+	GitCommitSHA    string    `json:"git_commit_sha,omitempty"`
+	GitTag          string    `json:"git_tag,omitempty"`
+	VerifiedAt      time.Time `json:"verified_at"`
+	KeyID           string    `json:"key_id"`
+	// IssuerProfile describes the linked issuer, including the key it signs with
+	IssuerProfile *issuer.Profile `json:"issuer_profile,omitempty"`
+}
+
+// CommitResponse is the signed body of GET /api/verify-by-commit. Covered is
+// true when at least one matching certificate is valid.
+type CommitResponse struct {
+	Repository   string     `json:"repository"`
+	CommitSHA    string     `json:"commit_sha"`
+	Covered      bool       `json:"covered"`
+	Certificates []Response `json:"certificates"`
+	VerifiedAt   time.Time  `json:"verified_at"`
+	KeyID        string     `json:"key_id"`
+}
+
+// Key is the body of GET /api/verify/key
+type Key struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// Handler serves /api/verify/{commit_id}, /api/verify/key and /api/verify-by-commit
+type Handler struct {
+	db     *database.DB
+	logger *zap.Logger
+	signer *signing.Signer
+}
+
+// NewHandler creates a new verification handler
+func NewHandler(db *database.DB, logger *zap.Logger, signer *signing.Signer) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		signer: signer,
+	}
+}
+
+// ServeHTTP answers verification requests. The exact response body is signed
+// and the detached signature is returned in the X-Signature header, together
+// with X-Signature-Algorithm and X-Signature-Key-Id.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	commitID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/verify"), "/")
+	if commitID == "key" {
+		httpjson.Write(w, http.StatusOK, Key{KeyID: h.signer.KeyID(), Algorithm: signing.Algorithm, PublicKey: h.signer.PublicKeyPEM()})
+		return
+	}
+	if !commitid.Valid(commitID) {
+		httpjson.Error(w, http.StatusBadRequest, "Invalid commit ID")
+		return
+	}
+
+	cert, err := h.Certificate(r.Context(), commitID)
+	if err != nil {
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to get badge")
+		return
+	}
+	if cert == nil {
+		httpjson.Error(w, http.StatusNotFound, "Certificate not found")
+		return
+	}
+
+	h.writeSigned(w, cert)
+}
+
+// Certificate returns the verification statement of a badge, or nil if there
+// is no such badge. Drafts and pending badges have not been issued, so they
+// cannot be verified either.
+func (h *Handler) Certificate(ctx context.Context, commitID string) (*Response, error) {
+	badge, err := h.db.WithContext(ctx).GetBadge(commitID)
+	if err != nil {
+		h.logger.Error("verify: failed to get badge", zap.String("commit_id", commitID), zap.Error(err))
+		return nil, err
+	}
+	if badge == nil || !badge.IsPublished() {
+		return nil, nil
+	}
+	resp := h.toResponse(ctx, badge)
+	return &resp, nil
+}
+
+// ByCommit serves GET /api/verify-by-commit?repo=&sha=, so CI can check whether
+// the commit it built is covered by a certificate. Both the stored and the
+// given SHA may be abbreviated; repository URLs match across https, ssh and
+// scp-like forms.
+func (h *Handler) ByCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	repo := strings.TrimSpace(r.URL.Query().Get("repo"))
+	if repo == "" {
+		httpjson.Error(w, http.StatusBadRequest, "repo is required")
+		return
+	}
+	sha, err := gitref.NormalizeSHA(r.URL.Query().Get("sha"))
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	badges, err := h.db.WithContext(r.Context()).ListBadgesByGitCommit(sha)
+	if err != nil {
+		h.logger.Error("verify: failed to look up badges by commit", zap.String("sha", sha), zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to look up certificates")
+		return
+	}
+
+	resp := CommitResponse{
+		Repository:   repo,
+		CommitSHA:    sha,
+		Certificates: []Response{},
+		VerifiedAt:   time.Now().UTC().Truncate(time.Second),
+		KeyID:        h.signer.KeyID(),
+	}
+	for _, b := range badges {
+		if !b.IsPublished() || !gitref.SameRepo(b.GitRepository.String, repo) {
+			continue
+		}
+		cert := h.toResponse(r.Context(), b)
+		resp.Certificates = append(resp.Certificates, cert)
+		resp.Covered = resp.Covered || cert.Status == "valid"
+	}
+	h.writeSigned(w, resp)
+}
+
+// toResponse builds the verification statement for a badge
+func (h *Handler) toResponse(ctx context.Context, badge *database.Badge) Response {
+	return Response{
+		CommitID:        badge.CommitID,
+		Status:          Status(badge),
+		SoftwareName:    badge.SoftwareName,
+		SoftwareVersion: badge.SoftwareVersion,
+		CoveredVersion:  badge.CoveredVersion.String,
+		CertificateName: badge.CertificateName.String,
+		Issuer:          badge.Issuer,
+		IssuerURL:       badge.IssuerURL.String,
+		IssueDate:       database.FormatDate(badge.IssueDate),
+		ExpiryDate:      database.FormatNullDate(badge.ExpiryDate),
+		GitRepository:   badge.GitRepository.String,
+		GitCommitSHA:    badge.GitCommitSHA.String,
+		GitTag:          badge.GitTag.String,
+		VerifiedAt:      time.Now().UTC().Truncate(time.Second),
+		KeyID:           h.signer.KeyID(),
+		IssuerProfile:   h.issuerProfile(ctx, badge),
+	}
+}
+
+// issuerProfile returns the profile of the issuer a badge is linked to, if any
+func (h *Handler) issuerProfile(ctx context.Context, badge *database.Badge) *issuer.Profile {
+	if !badge.IssuerID.Valid {
+		return nil
+	}
+	i, err := h.db.WithContext(ctx).GetIssuer(badge.IssuerID.String)
+	if err != nil {
+		h.logger.Error("verify: failed to get issuer", zap.String("issuer_id", badge.IssuerID.String), zap.Error(err))
+		return nil
+	}
+	if i == nil {
+		return nil
+	}
+	profile := issuer.NewProfile(i, "")
+	return &profile
+}
+
+// writeSigned writes v as JSON with a detached signature over the exact body
+func (h *Handler) writeSigned(w http.ResponseWriter, v interface{}) {
+	body, signature, err := h.Sign(v)
+	if err != nil {
+		h.logger.Error("verify: failed to encode response", zap.Error(err))
+		httpjson.Error(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Signature", signature)
+	w.Header().Set("X-Signature-Algorithm", signing.Algorithm)
+	w.Header().Set("X-Signature-Key-Id", h.signer.KeyID())
+	w.Write(body)
+}
+
+// Sign encodes v as JSON and returns the body with its detached signature
+func (h *Handler) Sign(v interface{}) ([]byte, string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, h.signer.Sign(body), nil
+}
+
+// Status reduces a badge to the verification status: revoked, expired (by
+// status or expiry date) or valid
+func Status(b *database.Badge) string {
+	return string(b.DisplayStatus())
+}
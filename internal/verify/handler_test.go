@@ -0,0 +1,187 @@
+package verify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finki/badges/internal/database"
+	"github.com/finki/badges/internal/signing"
+	"go.uber.org/zap"
+)
+
+func TestVerify(t *testing.T) {
+	dbFile := "test_verify.db"
+	defer os.Remove(dbFile)
+	db, err := database.New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create test DB: %v", err)
+	}
+	defer db.Close()
+
+	signer, created, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil || !created {
+		t.Fatalf("failed to create signing key: %v (created %v)", err, created)
+	}
+	h := NewHandler(db, zap.NewNop(), signer)
+
+	for id, b := range map[string]*database.Badge{
+		"valid12345":  {Status: "valid"},
+		"revoked1234": {Status: "revoked"},
+		"lapsed12345": {Status: "valid", ExpiryDate: sql.NullTime{Time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}},
+		"draft123456": {Status: "draft"},
+	} {
+		b.CommitID, b.Type, b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = id, "badge", "Issuer", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "Tool", "1.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("failed to create badge %s: %v", id, err)
+		}
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for id, want := range map[string]string{"valid12345": "valid", "revoked1234": "revoked", "lapsed12345": "expired"} {
+		rec := get("/api/verify/" + id)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", id, rec.Code)
+		}
+		if !signing.Verify(signer.PublicKey(), rec.Body.Bytes(), rec.Header().Get("X-Signature")) {
+			t.Errorf("%s: signature does not verify", id)
+		}
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", id, err)
+		}
+		if resp.Status != want || resp.KeyID != signer.KeyID() {
+			t.Errorf("%s: expected status %s, got %+v", id, want, resp)
+		}
+
+		tampered := append([]byte{}, rec.Body.Bytes()...)
+		tampered[len(tampered)-2] ^= 1
+		if signing.Verify(signer.PublicKey(), tampered, rec.Header().Get("X-Signature")) {
+			t.Errorf("%s: tampered body must not verify", id)
+		}
+	}
+
+	for path, code := range map[string]int{
+		"/api/verify/draft123456": http.StatusNotFound,
+		"/api/verify/missing123":  http.StatusNotFound,
+		"/api/verify/bad.id":      http.StatusBadRequest,
+	} {
+		if rec := get(path); rec.Code != code {
+			t.Errorf("%s: expected %d, got %d", path, code, rec.Code)
+		}
+	}
+
+	var key Key
+	if err := json.Unmarshal(get("/api/verify/key").Body.Bytes(), &key); err != nil || key.KeyID != signer.KeyID() {
+		t.Errorf("unexpected key response %+v (err %v)", key, err)
+	}
+}
+
+func TestVerifyByCommit(t *testing.T) {
+	dbFile := "test_verify_by_commit.db"
+	defer os.Remove(dbFile)
+	db, err := database.New(dbFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create test DB: %v", err)
+	}
+	defer db.Close()
+
+	signer, _, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatalf("failed to create signing key: %v", err)
+	}
+	h := NewHandler(db, zap.NewNop(), signer)
+
+	sha := "4d07ae0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e"
+	ns := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	for id, b := range map[string]*database.Badge{
+		"bound12345": {Status: "valid", GitRepository: ns("https://github.com/owner/repo"), GitCommitSHA: ns(sha[:12]), GitTag: ns("v1.0")},
+		"other12345": {Status: "valid", GitRepository: ns("https://github.com/other/repo"), GitCommitSHA: ns(sha)},
+		"draft12345": {Status: "draft", GitRepository: ns("https://github.com/owner/repo"), GitCommitSHA: ns(sha)},
+	} {
+		b.CommitID, b.Type, b.Issuer, b.IssueDate, b.SoftwareName, b.SoftwareVersion = id, "badge", "Issuer", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "Tool", "1.0"
+		if err := db.CreateBadge(b); err != nil {
+			t.Fatalf("failed to create badge %s: %v", id, err)
+		}
+	}
+
+	get := func(query string) (*httptest.ResponseRecorder, CommitResponse) {
+		rec := httptest.NewRecorder()
+		h.ByCommit(rec, httptest.NewRequest(http.MethodGet, "/api/verify-by-commit?"+query, nil))
+		var resp CommitResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := get("repo=git@github.com:Owner/repo.git&sha=" + sha)
+	if rec.Code != http.StatusOK || !resp.Covered || len(resp.Certificates) != 1 || resp.Certificates[0].CommitID != "bound12345" {
+		t.Fatalf("expected the bound certificate to cover the commit, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !signing.Verify(signer.PublicKey(), rec.Body.Bytes(), rec.Header().Get("X-Signature")) {
+		t.Error("signature does not verify")
+	}
+
+	if _, resp := get("repo=https://github.com/owner/repo&sha=0123456789"); resp.Covered || len(resp.Certificates) != 0 {
+		t.Errorf("expected an unknown commit not to be covered, got %+v", resp)
+	}
+
+	for _, query := range []string{"sha=" + sha, "repo=https://github.com/owner/repo&sha=xyz"} {
+		if rec, _ := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestVerifyIssuerProfile(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "verify.db"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create test DB: %v", err)
+	}
+	defer db.Close()
+
+	signer, _, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatalf("failed to create signing key: %v", err)
+	}
+	h := NewHandler(db, zap.NewNop(), signer)
+
+	now := time.Now()
+	if err := db.CreateIssuer(&database.Issuer{
+		IssuerID:  "geant",
+		Name:      "GÉANT",
+		URL:       sql.NullString{String: "https://geant.org", Valid: true},
+		PublicKey: sql.NullString{String: signer.PublicKeyPEM(), Valid: true},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to create issuer: %v", err)
+	}
+	b := &database.Badge{
+		CommitID: "linked123", Type: "badge", Status: "valid", Issuer: "GÉANT", IssueDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SoftwareName: "Tool", SoftwareVersion: "1.0", IssuerID: sql.NullString{String: "geant", Valid: true},
+	}
+	if err := db.CreateBadge(b); err != nil {
+		t.Fatalf("failed to create badge: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/verify/linked123", nil))
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	p := resp.IssuerProfile
+	if p == nil || p.IssuerID != "geant" || p.URL != "https://geant.org" || p.KeyID != signer.KeyID() || p.PageLink != "/issuer/geant" {
+		t.Errorf("unexpected issuer profile %+v", p)
+	}
+}
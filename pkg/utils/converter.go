@@ -2,19 +2,26 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image/jpeg"
-	"image/png"
-	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/disintegration/imaging"
 )
 
-// SVGToJPG converts SVG content to JPG format
-func SVGToJPG(svgContent []byte, width, height int) ([]byte, error) {
+// SVGToJPG converts SVG content to JPG format at the given size
+func SVGToJPG(ctx context.Context, svgContent []byte, size Size) ([]byte, error) {
+	if err := size.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Convert SVG to PNG first (using rsvg-convert or similar)
-	pngData, err := svgToPNG(svgContent)
+	pngData, err := svgToPNG(ctx, svgContent, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert SVG to PNG: %w", err)
 	}
@@ -25,11 +32,6 @@ func SVGToJPG(svgContent []byte, width, height int) ([]byte, error) {
 		return nil, fmt.Errorf("failed to decode PNG: %w", err)
 	}
 
-	// Resize if needed
-	if width > 0 && height > 0 {
-		img = imaging.Resize(img, width, height, imaging.Lanczos)
-	}
-
 	// Encode to JPG
 	var buf bytes.Buffer
 	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
@@ -40,43 +42,37 @@ func SVGToJPG(svgContent []byte, width, height int) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// SVGToPNG converts SVG content to PNG format
-func SVGToPNG(svgContent []byte, width, height int) ([]byte, error) {
-	// Convert SVG to PNG
-	pngData, err := svgToPNG(svgContent)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert SVG to PNG: %w", err)
-	}
-
-	// If no resizing needed, return as is
-	if width <= 0 || height <= 0 {
-		return pngData, nil
+// SVGToPNG converts SVG content to PNG format at the given size. The SVG is
+// rendered at the target size rather than resized afterwards, so 2x and 4x
+// versions stay sharp.
+func SVGToPNG(ctx context.Context, svgContent []byte, size Size) ([]byte, error) {
+	if err := size.Validate(); err != nil {
+		return nil, err
 	}
 
-	// Decode PNG for resizing
-	img, err := imaging.Decode(bytes.NewReader(pngData))
+	pngData, err := svgToPNG(ctx, svgContent, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode PNG: %w", err)
+		return nil, fmt.Errorf("failed to convert SVG to PNG: %w", err)
 	}
 
-	// Resize
-	img = imaging.Resize(img, width, height, imaging.Lanczos)
+	return pngData, nil
+}
 
-	// Encode back to PNG
-	var buf bytes.Buffer
-	err = png.Encode(&buf, img)
+// SVGToPDF converts SVG content to a single-page PDF
+func SVGToPDF(ctx context.Context, svgContent []byte) ([]byte, error) {
+	pdfData, err := convertWithRSVG(ctx, svgContent, "pdf")
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+		return nil, fmt.Errorf("failed to convert SVG to PDF: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	return pdfData, nil
 }
 
 // svgToPNG converts SVG to PNG using external tools
 // This is a helper function that tries multiple methods
-func svgToPNG(svgContent []byte) ([]byte, error) {
+func svgToPNG(ctx context.Context, svgContent []byte, size Size) ([]byte, error) {
 	// Try using rsvg-convert if available (usually on Linux/macOS)
-	pngData, err := convertWithRSVG(svgContent)
+	pngData, err := convertWithRSVG(ctx, svgContent, "png", size.rsvgArgs()...)
 	if err == nil {
 		return pngData, nil
 	}
@@ -89,42 +85,93 @@ func svgToPNG(svgContent []byte) ([]byte, error) {
 	return nil, fmt.Errorf("failed to convert SVG to PNG: %w", err)
 }
 
-// convertWithRSVG uses rsvg-convert to convert SVG to PNG
-func convertWithRSVG(svgContent []byte) ([]byte, error) {
+// convertWithRSVG uses rsvg-convert to convert SVG to the given output format
+// (png, pdf), passing any extra options such as the output size
+func convertWithRSVG(ctx context.Context, svgContent []byte, format string, options ...string) ([]byte, error) {
 	// Check if rsvg-convert is available
 	_, err := exec.LookPath("rsvg-convert")
 	if err != nil {
 		return nil, fmt.Errorf("rsvg-convert not found: %w", err)
 	}
 
-	// Create command
-	cmd := exec.Command("rsvg-convert", "-f", "png")
+	return runTool(ctx, "rsvg-convert", svgContent, append([]string{"-f", format}, options...)...)
+}
+
+// Default qualities for the lossy modern formats, on a 1-100 scale
+const (
+	DefaultWebPQuality = 80
+	DefaultAVIFQuality = 60
+)
+
+// SVGToWebP converts SVG content to WebP using cwebp (libwebp). A quality of 0
+// uses DefaultWebPQuality.
+func SVGToWebP(ctx context.Context, svgContent []byte, size Size, quality int) ([]byte, error) {
+	if quality <= 0 {
+		quality = DefaultWebPQuality
+	}
+	pngData, err := SVGToPNG(ctx, svgContent, size)
+	if err != nil {
+		return nil, err
+	}
+
+	webpData, err := encodeWithTool(ctx, pngData, "webp", "cwebp", "-quiet", "-q", strconv.Itoa(quality), "{in}", "-o", "{out}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert SVG to WebP: %w", err)
+	}
+	return webpData, nil
+}
 
-	// Set up pipes
-	stdin, err := cmd.StdinPipe()
+// SVGToAVIF converts SVG content to AVIF using avifenc (libavif). A quality of
+// 0 uses DefaultAVIFQuality.
+func SVGToAVIF(ctx context.Context, svgContent []byte, size Size, quality int) ([]byte, error) {
+	if quality <= 0 {
+		quality = DefaultAVIFQuality
+	}
+	pngData, err := SVGToPNG(ctx, svgContent, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+		return nil, err
 	}
 
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
+	// avifenc takes a quantizer (0 best, 63 worst) rather than a quality;
+	// --min/--max work with both old and new libavif releases
+	quantizer := strconv.Itoa((100 - quality) * 63 / 100)
+	avifData, err := encodeWithTool(ctx, pngData, "avif", "avifenc", "--min", quantizer, "--max", quantizer, "{in}", "{out}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert SVG to AVIF: %w", err)
+	}
+	return avifData, nil
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start rsvg-convert: %w", err)
+// encodeWithTool runs an external encoder on PNG data. The encoders only work
+// on files, so {in} and {out} in args are replaced with temporary file paths.
+func encodeWithTool(ctx context.Context, pngData []byte, ext, tool string, args ...string) ([]byte, error) {
+	limit := GetConverterLimits().MaxOutput
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, fmt.Errorf("%s not found: %w", tool, err)
 	}
 
-	// Write SVG to stdin
-	_, err = io.WriteString(stdin, string(svgContent))
+	dir, err := os.MkdirTemp("", "badge-"+ext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write to stdin: %w", err)
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
-	stdin.Close()
+	defer os.RemoveAll(dir)
 
-	// Wait for the command to finish
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("rsvg-convert failed: %w", err)
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out."+ext)
+	if err := os.WriteFile(in, pngData, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write PNG: %w", err)
 	}
 
-	return stdout.Bytes(), nil
+	cmdArgs := make([]string, len(args))
+	for i, a := range args {
+		cmdArgs[i] = strings.NewReplacer("{in}", in, "{out}", out).Replace(a)
+	}
+	if _, err := runTool(ctx, tool, nil, cmdArgs...); err != nil {
+		return nil, err
+	}
+
+	// The output file is checked against the same limit as piped output
+	if info, err := os.Stat(out); err == nil && limit > 0 && info.Size() > limit {
+		return nil, fmt.Errorf("%s failed: %w (limit %d bytes)", tool, ErrOutputTooLarge, limit)
+	}
+	return os.ReadFile(out)
 }
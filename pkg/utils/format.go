@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formats are the image formats the badge and certificate endpoints serve, in
+// order of preference when content negotiation finds several equally acceptable
+var Formats = []string{"svg", "png", "webp", "avif", "jpg"}
+
+var contentTypes = map[string]string{
+	"svg":  "image/svg+xml",
+	"png":  "image/png",
+	"webp": "image/webp",
+	"avif": "image/avif",
+	"jpg":  "image/jpeg",
+}
+
+// IsFormat reports whether format is one of Formats
+func IsFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// ContentType returns the MIME type of an image format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// NegotiateFormat picks the format for an Accept header: the one with the
+// highest q-value, with ties going to the earlier entry in Formats. SVG is
+// returned when the header is empty or accepts none of the formats, so
+// browsers and clients without an Accept header keep getting SVG.
+func NegotiateFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return "svg"
+	}
+
+	best, bestQ := "svg", 0.0
+	for _, format := range Formats {
+		if q := acceptQuality(accept, contentTypes[format]); q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value the Accept header gives a MIME type, using
+// the most specific matching media range
+func acceptQuality(accept, mimeType string) float64 {
+	typ, _, _ := strings.Cut(mimeType, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		s := -1
+		switch mediaRange {
+		case mimeType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		rangeQ := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					rangeQ = f
+				}
+			}
+		}
+		q, specificity = rangeQ, s
+	}
+	return q
+}
+
+// ParseQuality parses the quality query parameter: empty means the encoder
+// default (0), otherwise an integer from 1 to 100
+func ParseQuality(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	q, err := strconv.Atoi(s)
+	if err != nil || q < 1 || q > 100 {
+		return 0, fmt.Errorf("invalid quality %q: expected 1-100", s)
+	}
+	return q, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                 "svg",
+		"*/*":                              "svg",
+		"image/webp":                       "webp",
+		"image/avif,image/webp;q=0.9":      "avif",
+		"image/png;q=0.5, image/jpeg":      "jpg",
+		"image/*;q=0.8, image/svg+xml;q=0": "png",
+		"text/html":                        "svg",
+		"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8": "svg",
+	} {
+		if got := NegotiateFormat(accept); got != want {
+			t.Errorf("NegotiateFormat(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	if q, err := ParseQuality(""); err != nil || q != 0 {
+		t.Errorf("expected empty quality to mean the default, got %d (err %v)", q, err)
+	}
+	if q, err := ParseQuality("75"); err != nil || q != 75 {
+		t.Errorf("expected 75, got %d (err %v)", q, err)
+	}
+	for _, bad := range []string{"0", "101", "high"} {
+		if _, err := ParseQuality(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
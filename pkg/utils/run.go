@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConverterTimeout is returned when an external converter runs past
+	// its time limit and is killed
+	ErrConverterTimeout = errors.New("converter timed out")
+	// ErrOutputTooLarge is returned when an external converter writes more
+	// than its output limit
+	ErrOutputTooLarge = errors.New("converter output too large")
+)
+
+// ConverterLimits bound the external converters: how long one may run, how
+// much it may write, and how many may run at once (0 for no limit)
+type ConverterLimits struct {
+	Timeout   time.Duration
+	MaxOutput int64
+	Workers   int
+}
+
+// DefaultConverterLimits are used until SetConverterLimits is called
+var DefaultConverterLimits = ConverterLimits{Timeout: 10 * time.Second, MaxOutput: 32 << 20}
+
+// maxStderr is how much of a converter's error output is kept for the error
+const maxStderr = 1024
+
+// converterEnv lists the environment variables converters inherit; the rest,
+// such as the service's secrets, are withheld from them
+var converterEnv = []string{"PATH", "HOME", "TMPDIR", "LANG", "LC_", "FONTCONFIG_", "XDG_"}
+
+var converters = struct {
+	sync.RWMutex
+	limits  ConverterLimits
+	workers chan struct{}
+}{limits: DefaultConverterLimits}
+
+// SetConverterLimits replaces the limits of the external converters
+func SetConverterLimits(l ConverterLimits) {
+	converters.Lock()
+	defer converters.Unlock()
+	converters.limits = l
+	converters.workers = nil
+	if l.Workers > 0 {
+		converters.workers = make(chan struct{}, l.Workers)
+	}
+}
+
+// GetConverterLimits returns the limits of the external converters
+func GetConverterLimits() ConverterLimits {
+	converters.RLock()
+	defer converters.RUnlock()
+	return converters.limits
+}
+
+// runTool runs an external converter with stdin as its input and returns its
+// output. It waits for a worker if their number is limited, kills the tool
+// when ctx is done or it exceeds the time or output limit, and reports the
+// start of its error output in errors.
+func runTool(ctx context.Context, tool string, stdin []byte, args ...string) ([]byte, error) {
+	converters.RLock()
+	limits, workers := converters.limits, converters.workers
+	converters.RUnlock()
+
+	if workers != nil {
+		select {
+		case workers <- struct{}{}:
+			defer func() { <-workers }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s not started: %w", tool, ctx.Err())
+		}
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	// Exceeding the output limit kills the tool rather than leave it blocked
+	// on a full pipe
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
+
+	stdout := &limitedBuffer{max: limits.MaxOutput, exceed: kill}
+	stderr := &limitedBuffer{max: maxStderr, truncate: true}
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Env = toolEnv(os.Environ())
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// A killed tool may leave its output pipes open in a child
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	recordRun(tool, start, err)
+	switch {
+	case stdout.exceeded:
+		return nil, fmt.Errorf("%s failed: %w (limit %d bytes)", tool, ErrOutputTooLarge, limits.MaxOutput)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("%s failed: %w after %s", tool, ErrConverterTimeout, time.Since(start).Round(time.Millisecond))
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+			return nil, fmt.Errorf("%s failed: %w: %s", tool, err, msg)
+		}
+		return nil, fmt.Errorf("%s failed: %w", tool, err)
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// toolEnv returns the variables of env converters may inherit
+func toolEnv(env []string) []string {
+	var kept []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, allowed := range converterEnv {
+			if name == allowed || (strings.HasSuffix(allowed, "_") && strings.HasPrefix(name, allowed)) {
+				kept = append(kept, kv)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// limitedBuffer keeps up to max bytes (0 for no limit). Past it, writes fail
+// and exceed is called, unless truncate is set: the rest is then dropped. The
+// buffer is not embedded, as its ReadFrom would bypass the limit.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	truncate bool
+	exceed   func()
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		if !b.truncate {
+			if !b.exceeded && b.exceed != nil {
+				b.exceed()
+			}
+			b.exceeded = true
+			return 0, ErrOutputTooLarge
+		}
+		if room := int(b.max) - b.buf.Len(); room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTool(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	SetConverterLimits(ConverterLimits{Timeout: 200 * time.Millisecond, MaxOutput: 16, Workers: 1})
+	defer SetConverterLimits(DefaultConverterLimits)
+	ctx := context.Background()
+
+	if out, err := runTool(ctx, "sh", []byte("input"), "-c", "cat"); err != nil || string(out) != "input" {
+		t.Errorf("expected the input back, got %q (err %v)", out, err)
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		want   error
+	}{
+		{"hung tool", "sleep 5", ErrConverterTimeout},
+		{"large output", "yes", ErrOutputTooLarge},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if _, err := runTool(ctx, "sh", nil, "-c", tt.script); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if d := time.Since(start); d > 3*time.Second {
+			t.Errorf("%s: expected the tool to be killed, took %s", tt.name, d)
+		}
+	}
+
+	_, err := runTool(ctx, "sh", nil, "-c", "echo 'bad svg' >&2; exit 1")
+	if err == nil || !strings.Contains(err.Error(), "bad svg") {
+		t.Errorf("expected the error output in the error, got %v", err)
+	}
+
+	// Secrets in the environment are withheld from converters
+	t.Setenv("JWT_SECRET", "secret")
+	if out, err := runTool(ctx, "sh", nil, "-c", "echo -n $JWT_SECRET"); err != nil || len(out) != 0 {
+		t.Errorf("expected JWT_SECRET to be withheld, got %q (err %v)", out, err)
+	}
+}
+
+func TestToolEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "JWT_SECRET=x", "LC_ALL=C", "XDG_CACHE_HOME=/tmp", "PATHEXT=y"}
+	if got, want := toolEnv(env), []string{"PATH=/bin", "LC_ALL=C", "XDG_CACHE_HOME=/tmp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("toolEnv = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Caps on the requested raster size, so a single request cannot make the
+// converter allocate an arbitrarily large image
+const (
+	MaxRasterDimension = 4096
+	MaxRasterScale     = 4
+)
+
+// Size is the requested size of a raster image. The zero Size renders at the
+// SVG's native size; Width or Height alone keep the aspect ratio, both fit the
+// image inside that box, and Scale multiplies the native size.
+type Size struct {
+	Width  int
+	Height int
+	Scale  float64
+}
+
+// ParseSize parses the width, height and scale query parameters; empty values
+// are left unset
+func ParseSize(width, height, scale string) (Size, error) {
+	var s Size
+	var err error
+	if width != "" {
+		if s.Width, err = strconv.Atoi(width); err != nil {
+			return Size{}, fmt.Errorf("invalid width %q: expected a number of pixels", width)
+		}
+	}
+	if height != "" {
+		if s.Height, err = strconv.Atoi(height); err != nil {
+			return Size{}, fmt.Errorf("invalid height %q: expected a number of pixels", height)
+		}
+	}
+	if scale != "" {
+		if s.Scale, err = strconv.ParseFloat(scale, 64); err != nil {
+			return Size{}, fmt.Errorf("invalid scale %q: expected a number such as 2", scale)
+		}
+	}
+	return s, s.Validate()
+}
+
+// Validate checks a Size against the caps
+func (s Size) Validate() error {
+	switch {
+	case s.Width < 0 || s.Width > MaxRasterDimension:
+		return fmt.Errorf("invalid width %d: expected 1-%d", s.Width, MaxRasterDimension)
+	case s.Height < 0 || s.Height > MaxRasterDimension:
+		return fmt.Errorf("invalid height %d: expected 1-%d", s.Height, MaxRasterDimension)
+	case s.Scale < 0 || s.Scale > MaxRasterScale || (s.Scale > 0 && s.Scale < 0.1):
+		return fmt.Errorf("invalid scale %g: expected 0.1-%d", s.Scale, MaxRasterScale)
+	case s.Scale > 0 && (s.Width > 0 || s.Height > 0):
+		return errors.New("scale cannot be combined with width or height")
+	}
+	return nil
+}
+
+// IsNative reports whether no size was requested
+func (s Size) IsNative() bool {
+	return s == Size{}
+}
+
+// String returns a compact form of the size for cache keys and logs
+func (s Size) String() string {
+	switch {
+	case s.Scale > 0:
+		return "x" + strconv.FormatFloat(s.Scale, 'g', -1, 64)
+	case s.IsNative():
+		return "native"
+	}
+	return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// rsvgArgs are the rsvg-convert options that render at this size
+func (s Size) rsvgArgs() []string {
+	var args []string
+	if s.Scale > 0 {
+		args = append(args, "--zoom", strconv.FormatFloat(s.Scale, 'f', -1, 64))
+	}
+	if s.Width > 0 {
+		args = append(args, "--width", strconv.Itoa(s.Width))
+	}
+	if s.Height > 0 {
+		args = append(args, "--height", strconv.Itoa(s.Height))
+	}
+	if s.Width > 0 && s.Height > 0 {
+		args = append(args, "--keep-aspect-ratio")
+	}
+	return args
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		width, height, scale string
+		want                 Size
+		wantErr              bool
+	}{
+		{"", "", "", Size{}, false},
+		{"680", "", "", Size{Width: 680}, false},
+		{"680", "80", "", Size{Width: 680, Height: 80}, false},
+		{"", "", "2", Size{Scale: 2}, false},
+		{"", "", "1.5", Size{Scale: 1.5}, false},
+		{"abc", "", "", Size{}, true},
+		{"-1", "", "", Size{}, true},
+		{"", "5000", "", Size{}, true},
+		{"", "", "10", Size{}, true},
+		{"", "", "0.01", Size{}, true},
+		{"200", "", "2", Size{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.width, tt.height, tt.scale)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseSize(%q, %q, %q) = %+v, %v", tt.width, tt.height, tt.scale, got, err)
+		}
+	}
+}
+
+func TestSizeRSVGArgs(t *testing.T) {
+	tests := []struct {
+		size Size
+		key  string
+		args []string
+	}{
+		{Size{}, "native", nil},
+		{Size{Scale: 2}, "x2", []string{"--zoom", "2"}},
+		{Size{Width: 680}, "680x0", []string{"--width", "680"}},
+		{Size{Width: 680, Height: 80}, "680x80", []string{"--width", "680", "--height", "80", "--keep-aspect-ratio"}},
+	}
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.key {
+			t.Errorf("%+v: expected key %q, got %q", tt.size, tt.key, got)
+		}
+		if got := tt.size.rsvgArgs(); !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("%+v: expected args %v, got %v", tt.size, tt.args, got)
+		}
+	}
+}
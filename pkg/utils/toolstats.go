@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// ToolStats counts the runs of an external converter since startup
+type ToolStats struct {
+	Runs     int64         `json:"runs"`
+	Failures int64         `json:"failures"`
+	Duration time.Duration `json:"duration_ns"`
+	// Max is the longest run
+	Max time.Duration `json:"max_ns"`
+}
+
+var (
+	toolStatsMu sync.Mutex
+	toolStats   = map[string]*ToolStats{}
+)
+
+// ConverterStats returns the runs of each external converter, e.g.
+// rsvg-convert, by tool name
+func ConverterStats() map[string]ToolStats {
+	toolStatsMu.Lock()
+	defer toolStatsMu.Unlock()
+
+	stats := make(map[string]ToolStats, len(toolStats))
+	for tool, s := range toolStats {
+		stats[tool] = *s
+	}
+	return stats
+}
+
+// recordRun adds a run of tool that started at start
+func recordRun(tool string, start time.Time, err error) {
+	d := time.Since(start)
+
+	toolStatsMu.Lock()
+	defer toolStatsMu.Unlock()
+	s, ok := toolStats[tool]
+	if !ok {
+		s = &ToolStats{}
+		toolStats[tool] = s
+	}
+	s.Runs++
+	if err != nil {
+		s.Failures++
+	}
+	s.Duration += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
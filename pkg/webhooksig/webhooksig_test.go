@@ -0,0 +1,86 @@
+package webhooksig
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec")
+	body := []byte(`{"event":"api_key.expiring"}`)
+	now := time.Unix(1767268800, 0)
+	header := Sign(secret, body, now)
+
+	tests := []struct {
+		name   string
+		secret []byte
+		body   []byte
+		header string
+		at     time.Time
+		want   error
+	}{
+		{"valid", secret, body, header, now, nil},
+		{"within tolerance", secret, body, header, now.Add(4 * time.Minute), nil},
+		{"replayed", secret, body, header, now.Add(6 * time.Minute), ErrTimestampOutOfTolerance},
+		{"from the future", secret, body, header, now.Add(-6 * time.Minute), ErrTimestampOutOfTolerance},
+		{"wrong secret", []byte("other"), body, header, now, ErrSignatureMismatch},
+		{"altered body", secret, []byte(`{"event":"x"}`), header, now, ErrSignatureMismatch},
+		{"rotated secret", secret, body, Sign([]byte("old"), body, now) + ",v1=" + Compute(secret, body, now), now, nil},
+		{"other schemes", secret, body, header + ",v0=abc", now, nil},
+		{"empty", secret, body, "", now, ErrNoSignature},
+		{"no timestamp", secret, body, "v1=" + Compute(secret, body, now), now, ErrInvalidHeader},
+		{"no signature", secret, body, "t=1767268800", now, ErrInvalidHeader},
+		{"bad hex", secret, body, "t=1767268800,v1=zz", now, ErrInvalidHeader},
+		{"garbage", secret, body, "signature", now, ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		if err := verify(tt.secret, tt.body, tt.header, 0, tt.at); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if err := verify(secret, body, header, time.Hour, now.Add(30*time.Minute)); err != nil {
+		t.Errorf("expected a custom tolerance to be used, got %v", err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	secret := []byte("whsec")
+	body := `{"event":"api_key.expiring"}`
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := VerifyRequest(r, secret, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	SignRequest(req, secret, []byte(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got != body {
+		t.Errorf("expected the signed request to be accepted with its body, got %d and %q", resp.StatusCode, got)
+	}
+
+	resp, err = http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned request to be refused, got %d", resp.StatusCode)
+	}
+}
@@ -2,9 +2,14 @@
 // visitor has an authenticated session. The menu is built entirely on the client so
 // that cached, auth-agnostic page HTML (e.g. the home page) is never polluted.
 (function () {
+  // The service may be served below a path prefix; this script lives at
+  // <prefix>/static/js/admin-nav.js
+  const script = document.currentScript;
+  const prefix = script ? new URL(script.src).pathname.replace(/\/static\/js\/admin-nav\.js$/, '') : '';
+
   async function getSession() {
     try {
-      const res = await fetch('/api/auth/session', { credentials: 'same-origin' });
+      const res = await fetch(prefix + '/api/auth/session', { credentials: 'same-origin' });
       if (!res.ok) return { authenticated: false };
       return await res.json();
     } catch (e) {
@@ -20,12 +25,12 @@
     links.className = 'admin-nav-links';
 
     const items = [
-      { label: 'Certificates', href: '/certificates' },
-      { label: 'Add Certificate', href: '/certificates#new' },
-      { label: 'Backup', href: '/backup' },
-      { label: 'Restore', href: '/restore' },
-      { label: 'Change Password', href: '/password' },
-      { label: 'Admin', href: '/admin' },
+      { label: 'Certificates', href: prefix + '/certificates' },
+      { label: 'Add Certificate', href: prefix + '/certificates#new' },
+      { label: 'Backup', href: prefix + '/backup' },
+      { label: 'Restore', href: prefix + '/restore' },
+      { label: 'Change Password', href: prefix + '/password' },
+      { label: 'Admin', href: prefix + '/admin' },
     ];
     const current = window.location.pathname;
     items.forEach(function (it) {
@@ -52,11 +57,11 @@
     logout.textContent = 'Log out';
     logout.addEventListener('click', async function () {
       try {
-        await fetch('/api/auth/logout', { method: 'POST', credentials: 'same-origin' });
+        await fetch(prefix + '/api/auth/logout', { method: 'POST', credentials: 'same-origin' });
       } catch (e) {
         /* ignore network errors and redirect anyway */
       }
-      window.location.href = '/';
+      window.location.href = prefix + '/';
     });
     right.appendChild(logout);
 